@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/build"
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/tester"
+)
+
+// lintCmd lints the bundles in args, exiting with 1 if any has errors
+func lintCmd(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("challenge lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ctfjx challenge lint [flags] <dir>...")
+		fs.PrintDefaults()
+	}
+	var (
+		asJSON     = fs.Bool("json", false, "print the findings as JSON, one report per line")
+		strict     = fs.Bool("strict", false, "fail on warnings too")
+		flagFormat = fs.String("flag-format", "", "regex static flags are expected to match, e.g. ^ctf\\{.+\\}$")
+		flagPrefix = fs.String("flag-prefix", "", "expect flags in the canonical <prefix>{...} format, e.g. "+flags.DEFAULT_PREFIX)
+		maxSize    = challenge.DEFAULT_MAX_ATTACHMENT_SIZE
+	)
+	fs.TextVar(&maxSize, "max-attachment-size", challenge.DEFAULT_MAX_ATTACHMENT_SIZE, "largest allowed attachment")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := challenge.LintOptions{MaxAttachmentSize: maxSize}
+	switch {
+	case *flagFormat != "" && *flagPrefix != "":
+		fmt.Fprintln(stderr, "-flag-format and -flag-prefix are exclusive")
+		return 2
+	case *flagPrefix != "":
+		opts.FlagFormat = flags.Format{Prefix: *flagPrefix}.Regexp()
+	case *flagFormat != "":
+		re, err := regexp.Compile(*flagFormat)
+		if err != nil {
+			fmt.Fprintf(stderr, "bad -flag-format: %v\n", err)
+			return 2
+		}
+		opts.FlagFormat = re
+	}
+
+	code := 0
+	enc := json.NewEncoder(stdout)
+	for _, report := range challenge.LintAll(fs.Args(), opts) {
+		if report.Failed() || (*strict && len(report.Findings) > 0) {
+			code = 1
+		}
+		if *asJSON {
+			if err := enc.Encode(report); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 2
+			}
+			continue
+		}
+		for _, f := range report.Findings {
+			fmt.Fprintln(stdout, f)
+		}
+	}
+	return code
+}
+
+// testCmd builds the bundles in args on a local runtime and runs
+// their solve scripts, exiting with 1 if any fails
+func testCmd(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("challenge test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ctfjx challenge test [flags] <dir>...")
+		fs.PrintDefaults()
+	}
+	var (
+		asJSON  = fs.Bool("json", false, "print the results as JSON, one per line")
+		runtime = fs.String("runtime", container.RUNTIME_DOCKER, "container runtime to deploy on, docker, podman or containerd")
+		address = fs.String("address", "", "address of the runtime, its default if empty")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	rt, err := container.New(*runtime, *address)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	images, ok := rt.(container.ImageBuilder)
+	if !ok {
+		fmt.Fprintf(stderr, "%s cannot build images\n", rt.Name())
+		return 2
+	}
+	tmp, err := os.MkdirTemp("", "ctfjx-test-*")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer os.RemoveAll(tmp)
+	store, err := artifacts.NewStore(tmp)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	registry, err := challenge.OpenRegistry("")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	deployer, err := tester.NewLocal(rt)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	ctx := context.Background()
+	builder := build.New(images, store, registry)
+	t := tester.New(deployer)
+	code := 0
+	enc := json.NewEncoder(stdout)
+	for _, dir := range fs.Args() {
+		r := tester.Result{Challenge: dir, Status: tester.StatusFail}
+		if b, err := builder.Build(ctx, dir); err != nil {
+			r.Error = err.Error()
+		} else {
+			r = t.Test(ctx, b)
+		}
+		if r.Status == tester.StatusFail {
+			code = 1
+		}
+		if *asJSON {
+			if err := enc.Encode(r); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 2
+			}
+			continue
+		}
+		fmt.Fprintln(stdout, r)
+		if r.Status == tester.StatusFail && r.Output != "" {
+			fmt.Fprintln(stdout, r.Output)
+		}
+	}
+	return code
+}
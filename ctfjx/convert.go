@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/convert"
+)
+
+// printNotes prints what a conversion could not carry over
+func printNotes(w io.Writer, notes []convert.Note, asJSON bool) error {
+	enc := json.NewEncoder(w)
+	for _, n := range notes {
+		if asJSON {
+			if err := enc.Encode(n); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintln(w, "note:", n)
+	}
+	return nil
+}
+
+// writeBundles writes bundles into dir, exiting with 1 if any fails
+func writeBundles(dir string, bundles []convert.Bundle, stdout, stderr io.Writer) int {
+	code := 0
+	for _, b := range bundles {
+		c, err := convert.WriteBundle(dir, b)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", b.Challenge.Id, err)
+			code = 1
+			continue
+		}
+		fmt.Fprintln(stdout, "imported", c.Dir)
+	}
+	return code
+}
+
+// ctfdImportCmd converts a CTFd export into bundles and a teams file
+func ctfdImportCmd(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ctfd import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ctfjx ctfd import [flags] <export.zip> <dir>")
+		fs.PrintDefaults()
+	}
+	var (
+		asJSON = fs.Bool("json", false, "print the notes as JSON, one per line")
+		teams  = fs.String("teams", "", "file to write the teams to, "+convert.TEAMS_FILENAME+" in <dir> if empty")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	src, dir := fs.Arg(0), fs.Arg(1)
+	if *teams == "" {
+		*teams = filepath.Join(dir, convert.TEAMS_FILENAME)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	export, err := convert.ReadCTFd(f, info.Size())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	bundles, notes := export.Bundles()
+	accounts, accountNotes := export.Accounts()
+	if err := printNotes(stdout, append(notes, accountNotes...), *asJSON); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	code := writeBundles(dir, bundles, stdout, stderr)
+	if len(accounts) > 0 {
+		if err := convert.WriteTeams(*teams, accounts); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+// ctfdExportCmd converts the bundles below a directory, and teams,
+// into a CTFd export
+func ctfdExportCmd(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ctfd export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ctfjx ctfd export [flags] <dir>")
+		fs.PrintDefaults()
+	}
+	var (
+		asJSON  = fs.Bool("json", false, "print the notes as JSON, one per line")
+		out     = fs.String("o", "ctfd.zip", "file to write the export to")
+		teams   = fs.String("teams", "", "teams to export, "+convert.TEAMS_FILENAME+" in <dir> if it exists")
+		alembic = fs.String("alembic", "", "database migration of the CTFd to import into, the version_num of its db/alembic_version.json")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	dir := fs.Arg(0)
+
+	graph, err := challenge.LoadAll(dir)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	var accounts []convert.Team
+	pth := *teams
+	if pth == "" {
+		pth = filepath.Join(dir, convert.TEAMS_FILENAME)
+	}
+	if accounts, err = convert.ReadTeams(pth); err != nil && (*teams != "" || !errors.Is(err, os.ErrNotExist)) {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	export, notes, err := convert.ExportCTFd(graph.Challenges(), accounts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	export.Alembic = *alembic
+	if *alembic == "" {
+		notes = append(notes, convert.Note{Message: "no -alembic, CTFd refuses exports without db/alembic_version.json"})
+	}
+	if err := printNotes(stdout, notes, *asJSON); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := export.Write(f); err != nil {
+		f.Close()
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// rctfImportCmd converts a dump of rCTF challenges into bundles
+func rctfImportCmd(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rctf import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ctfjx rctf import [flags] <challs.json> <dir>")
+		fs.PrintDefaults()
+	}
+	var (
+		asJSON   = fs.Bool("json", false, "print the notes as JSON, one per line")
+		download = fs.Bool("download", false, "download the attachments from their URLs")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	cs, err := convert.ReadRCTF(data)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	var fetch func(string) (io.ReadCloser, error)
+	if *download {
+		fetch = func(url string) (io.ReadCloser, error) {
+			resp, err := http.Get(url)
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode != http.StatusOK {
+				resp.Body.Close()
+				return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+			}
+			return resp.Body, nil
+		}
+	}
+	bundles, notes := convert.RCTFBundles(cs, fetch)
+	if err := printNotes(stdout, notes, *asJSON); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return writeBundles(fs.Arg(1), bundles, stdout, stderr)
+}
+
+// kctfImportCmd converts the kCTF challenges below a directory into
+// bundles
+func kctfImportCmd(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kctf import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ctfjx kctf import [flags] <kctf dir> <dir>")
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print the notes as JSON, one per line")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	bundles, notes, err := convert.KCTFBundles(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if err := printNotes(stdout, notes, *asJSON); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return writeBundles(fs.Arg(1), bundles, stdout, stderr)
+}
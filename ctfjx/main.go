@@ -1,3 +1,47 @@
+// Ctfjx is the command line tool for organizers
 package main
 
-func main() {}
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: ctfjx <command> [arguments]
+
+commands:
+  challenge lint   validate challenge bundles
+  challenge test   deploy challenge bundles locally and run their solve scripts
+  ctfd import      convert a CTFd export into challenge bundles and teams
+  ctfd export      convert challenge bundles and teams into a CTFd export
+  rctf import      convert a dump of rCTF challenges into challenge bundles
+  kctf import      convert kCTF challenge directories into challenge bundles
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 2 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] + " " + args[1] {
+	case "challenge lint":
+		return lintCmd(args[2:], stdout, stderr)
+	case "challenge test":
+		return testCmd(args[2:], stdout, stderr)
+	case "ctfd import":
+		return ctfdImportCmd(args[2:], stdout, stderr)
+	case "ctfd export":
+		return ctfdExportCmd(args[2:], stdout, stderr)
+	case "rctf import":
+		return rctfImportCmd(args[2:], stdout, stderr)
+	case "kctf import":
+		return kctfImportCmd(args[2:], stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n%s", args[0]+" "+args[1], usage)
+	return 2
+}
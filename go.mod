@@ -4,9 +4,12 @@ go 1.24.6
 
 require (
 	dario.cat/mergo v1.0.2
+	github.com/BurntSushi/toml v1.6.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/goccy/go-yaml v1.18.0
 	github.com/lattesec/log v0.2.3
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/sys v0.13.0
 )
 
 require (
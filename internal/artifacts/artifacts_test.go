@@ -0,0 +1,177 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/ctfjx/internal/socket/sockettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPush(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "chall"), []byte(strings.Repeat("A", DEFAULT_CHUNK_SIZE+10)), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "conf"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "conf", "flag.txt"), []byte("ctfjx{test}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "empty"), nil, 0o644))
+
+	daemonStore, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	agentStore, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	b, err := daemonStore.PackDir("pwn1", src)
+	require.NoError(t, err)
+	assert.Len(t, b.Files, 3)
+
+	pusher := NewPusher(daemonStore)
+	receiver := NewReceiver(agentStore)
+	agentHandlers := receiver.Handlers()
+
+	var chunks atomic.Int32
+	onChunk := agentHandlers[socket.ActionSendFileChunk]
+	agentHandlers[socket.ActionSendFileChunk] = func(c *socket.Conn, h socket.Header, r io.Reader) {
+		chunks.Add(1)
+		onChunk(c, h, r)
+	}
+
+	daemon, _ := sockettest.Pair(t, pusher.Handlers(), agentHandlers)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, pusher.Push(ctx, daemon, b))
+	assert.Equal(t, int32(4), chunks.Load(), "2 chunks for chall, 1 each for the others")
+
+	require.NoError(t, pusher.Push(ctx, daemon, b))
+	assert.Equal(t, int32(4), chunks.Load(), "cached blobs are not sent again")
+
+	out := t.TempDir()
+	require.NoError(t, agentStore.Materialize(b, out))
+	flag, err := os.ReadFile(filepath.Join(out, "conf", "flag.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "ctfjx{test}", string(flag))
+	info, err := os.Stat(filepath.Join(out, "chall"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+
+	evil := Bundle{Files: []File{{Path: "../escape", Digest: b.Files[0].Digest}}}
+	assert.ErrorIs(t, agentStore.Materialize(evil, out), ErrUnsafePath)
+}
+
+func TestReceiver_Chunks(t *testing.T) {
+	agentStore, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	receiver := NewReceiver(agentStore)
+
+	requests := make(chan blobRequest, 4)
+	readies := make(chan bundleReady, 4)
+	daemon, _ := sockettest.Pair(t, map[socket.Action]socket.HandlerFunc{
+		socket.ActionRequestArtifacts: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var req blobRequest
+			assert.NoError(t, json.NewDecoder(r).Decode(&req))
+			requests <- req
+		},
+		socket.ActionArtifactsReady: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var ready bundleReady
+			assert.NoError(t, json.NewDecoder(r).Decode(&ready))
+			readies <- ready
+		},
+	}, receiver.Handlers())
+
+	data := []byte("ctfjx{chunked}")
+	digest := Digest(data)
+	tmpFiles := func() []os.DirEntry {
+		entries, err := os.ReadDir(filepath.Join(agentStore.dir, "tmp"))
+		require.NoError(t, err)
+		return entries
+	}
+	offer := func(name string) {
+		b := Bundle{Name: name, Files: []File{{Path: "flag.txt", Digest: digest, Size: int64(len(data))}}}
+		require.NoError(t, daemon.SendJSON(socket.ActionOfferArtifacts, b))
+		select {
+		case req := <-requests:
+			assert.Equal(t, []string{digest}, req.Digests)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no artifact request")
+		}
+	}
+	send := func(offset int64, part []byte) {
+		require.NoError(t, daemon.SendJSON(socket.ActionSendFileChunk, Chunk{Digest: digest, Offset: offset, Size: int64(len(data)), Data: part}))
+	}
+	waitReady := func() bundleReady {
+		select {
+		case ready := <-readies:
+			return ready
+		case <-time.After(5 * time.Second):
+			t.Fatal("bundle never got ready")
+		}
+		return bundleReady{}
+	}
+
+	send(0, data)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, tmpFiles(), "chunks nobody asked for are refused")
+	assert.False(t, agentStore.Has(digest))
+
+	offer("bad")
+	send(0, data[:4])
+	send(int64(len(data)), []byte("!"))
+	ready := waitReady()
+	assert.Equal(t, "bad", ready.Bundle)
+	assert.Contains(t, ready.Error, ErrInvalidChunk.Error(), "offsets past the end fail the bundle")
+	assert.Empty(t, tmpFiles(), "and remove what was received")
+
+	offer("good")
+	send(4, data[4:])
+	send(0, data[:4])
+	ready = waitReady()
+	assert.Equal(t, bundleReady{Bundle: "good"}, ready)
+	assert.True(t, agentStore.Has(digest))
+
+	send(0, data[:4])
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, tmpFiles(), "duplicates after the commit leave nothing behind")
+}
+
+func TestPusher_OnlyPushedBlobs(t *testing.T) {
+	daemonStore, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	pushed, _, err := daemonStore.Put(strings.NewReader("pushed"))
+	require.NoError(t, err)
+	secret, _, err := daemonStore.Put(strings.NewReader("ctfjx{other challenge}"))
+	require.NoError(t, err)
+
+	pusher := NewPusher(daemonStore)
+	sent := make(chan string, 4)
+	daemon, _ := sockettest.Pair(t, pusher.Handlers(), map[socket.Action]socket.HandlerFunc{
+		socket.ActionOfferArtifacts: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var b Bundle
+			assert.NoError(t, json.NewDecoder(r).Decode(&b))
+			assert.NoError(t, c.SendJSON(socket.ActionRequestArtifacts, blobRequest{Bundle: "other", Digests: []string{secret}}))
+			assert.NoError(t, c.SendJSON(socket.ActionRequestArtifacts, blobRequest{Bundle: b.Name, Digests: []string{secret, pushed}}))
+		},
+		socket.ActionSendFileChunk: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var chunk Chunk
+			assert.NoError(t, json.NewDecoder(r).Decode(&chunk))
+			sent <- chunk.Digest
+			if chunk.Digest == pushed {
+				assert.NoError(t, c.SendJSON(socket.ActionArtifactsReady, bundleReady{Bundle: "web1"}))
+			}
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, pusher.Push(ctx, daemon, Bundle{Name: "web1", Files: []File{{Path: "index.html", Digest: pushed}}}))
+	assert.Equal(t, pushed, <-sent)
+	assert.Empty(t, sent, "blobs of other bundles are refused")
+}
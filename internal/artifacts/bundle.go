@@ -0,0 +1,132 @@
+package artifacts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrUnsafePath = errors.New("path escapes the bundle")
+
+// File is a file of a bundle, stored under its digest
+type File struct {
+	Path   string      `json:"path"` // slash-separated, relative to the bundle root
+	Digest string      `json:"digest"`
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+}
+
+// Bundle is a named set of files, such as a challenge's binaries,
+// compose file and configs
+type Bundle struct {
+	Name  string `json:"name"`
+	Files []File `json:"files"`
+}
+
+// Digests returns the distinct digests of the bundle's files
+func (b Bundle) Digests() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, f := range b.Files {
+		if !seen[f.Digest] {
+			seen[f.Digest] = true
+			out = append(out, f.Digest)
+		}
+	}
+	return out
+}
+
+// Size returns the size of a blob of the bundle
+func (b Bundle) Size(digest string) (int64, bool) {
+	for _, f := range b.Files {
+		if f.Digest == digest {
+			return f.Size, true
+		}
+	}
+	return 0, false
+}
+
+// PackDir stores every regular file under dir and
+// returns them as a bundle called name
+func (s *Store) PackDir(name, dir string) (Bundle, error) {
+	b := Bundle{Name: name}
+	err := filepath.WalkDir(dir, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, pth)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(pth)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		digest, size, err := s.Put(f)
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", rel, err)
+		}
+
+		b.Files = append(b.Files, File{
+			Path:   filepath.ToSlash(rel),
+			Digest: digest,
+			Size:   size,
+			Mode:   info.Mode().Perm(),
+		})
+		return nil
+	})
+	return b, err
+}
+
+// Materialize writes the files of b to dir
+func (s *Store) Materialize(b Bundle, dir string) error {
+	for _, f := range b.Files {
+		clean := path.Clean(f.Path)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("%w: %s", ErrUnsafePath, f.Path)
+		}
+		if err := s.materializeFile(f, filepath.Join(dir, filepath.FromSlash(clean))); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) materializeFile(f File, dst string) error {
+	src, err := s.Open(f.Digest)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	mode := f.Mode
+	if mode == 0 {
+		mode = 0o644
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, mode)
+}
@@ -0,0 +1,160 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	ErrInvalidDigest  = errors.New("invalid digest")
+	ErrDigestMismatch = errors.New("digest mismatch")
+	ErrBlobNotFound   = errors.New("blob not found")
+
+	digestRegex = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Store is a content-addressed blob store on disk,
+// laid out as <dir>/sha256/<first 2 hex chars>/<hex>
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Digest returns the digest of b, e.g. "sha256:ab12..."
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func ValidDigest(d string) bool {
+	return digestRegex.MatchString(d)
+}
+
+func (s *Store) path(digest string) (string, error) {
+	if !ValidDigest(digest) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	hex := digest[len("sha256:"):]
+	return filepath.Join(s.dir, "sha256", hex[:2], hex), nil
+}
+
+func (s *Store) Has(digest string) bool {
+	pth, err := s.path(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(pth)
+	return err == nil
+}
+
+// Open returns the blob with digest
+func (s *Store) Open(digest string) (*os.File, error) {
+	pth, err := s.path(digest)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(pth)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, digest)
+	}
+	return f, err
+}
+
+// Remove deletes the blob with digest, if there is one
+func (s *Store) Remove(digest string) error {
+	pth, err := s.path(digest)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(pth); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Verifier reads through to r and fails with ErrDigestMismatch at
+// the end if what was read does not have digest
+type Verifier struct {
+	r      io.Reader
+	h      hash.Hash
+	digest string
+}
+
+func NewVerifier(r io.Reader, digest string) *Verifier {
+	return &Verifier{r: r, h: sha256.New(), digest: digest}
+}
+
+func (v *Verifier) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		if got := "sha256:" + hex.EncodeToString(v.h.Sum(nil)); got != v.digest {
+			return n, fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, v.digest, got)
+		}
+	}
+	return n, err
+}
+
+// Put stores the content of r and returns its digest and size
+func (s *Store) Put(r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "tmp"), "put-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		_ = tmp.Close()
+		return "", 0, err
+	}
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+	return digest, n, s.commit(tmp, digest)
+}
+
+// commit verifies and moves a fully written temp file into place
+func (s *Store) commit(tmp *os.File, digest string) error {
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != digest {
+		return fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, digest, got)
+	}
+
+	pth, err := s.path(digest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(pth), 0o700); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), pth)
+}
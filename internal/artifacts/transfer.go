@@ -0,0 +1,389 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+const DEFAULT_CHUNK_SIZE = 256 << 10 // 256KB
+
+var (
+	ErrTransferFailed = errors.New("artifact transfer failed")
+	ErrInvalidChunk   = errors.New("invalid file chunk")
+)
+
+// Chunk is a part of a blob, sent with ActionSendFileChunk.
+// Chunks may be handled out of order.
+type Chunk struct {
+	Digest string `json:"digest"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"` // of the whole blob
+	Data   []byte `json:"data"`
+}
+
+type blobRequest struct {
+	Bundle  string   `json:"bundle"`
+	Digests []string `json:"digests"`
+}
+
+type bundleReady struct {
+	Bundle string `json:"bundle"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Pusher sends bundles from the daemon's store to agents,
+// only sending the blobs an agent does not have yet
+type Pusher struct {
+	store *Store
+
+	mu      sync.Mutex
+	waiters map[pushKey]*push
+}
+
+type pushKey struct {
+	conn   *socket.Conn
+	bundle string
+}
+
+// push is a bundle being pushed, whose blobs alone the agent
+// may request
+type push struct {
+	digests map[string]bool
+	done    chan error
+}
+
+func NewPusher(store *Store) *Pusher {
+	return &Pusher{
+		store:   store,
+		waiters: make(map[pushKey]*push),
+	}
+}
+
+// Push offers b to the agent on c and waits until it has every file
+func (p *Pusher) Push(ctx context.Context, c *socket.Conn, b Bundle) error {
+	key := pushKey{c, b.Name}
+	ps := &push{digests: make(map[string]bool), done: make(chan error, 1)}
+	for _, d := range b.Digests() {
+		ps.digests[d] = true
+	}
+	p.mu.Lock()
+	p.waiters[key] = ps
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiters, key)
+		p.mu.Unlock()
+	}()
+
+	if err := c.SendJSON(socket.ActionOfferArtifacts, b); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-ps.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pusher) sendBlob(c *socket.Conn, digest string) error {
+	f, err := p.store.Open(digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, DEFAULT_CHUNK_SIZE)
+	var offset int64
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 || offset == 0 {
+			chunk := Chunk{Digest: digest, Offset: offset, Size: info.Size(), Data: buf[:n]}
+			if err := c.SendJSON(socket.ActionSendFileChunk, chunk); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Handlers serves ActionRequestArtifacts and ActionArtifactsReady
+func (p *Pusher) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionRequestArtifacts: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var req blobRequest
+			if err := json.NewDecoder(r).Decode(&req); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid artifact request: %v", err).Send()
+				return
+			}
+			p.mu.Lock()
+			ps, ok := p.waiters[pushKey{c, req.Bundle}]
+			p.mu.Unlock()
+			if !ok {
+				c.GenLogMsg().Warn().Msgf("refused artifact request for %s: not pushed", req.Bundle).Send()
+				return
+			}
+
+			for _, digest := range req.Digests {
+				if !ps.digests[digest] {
+					c.GenLogMsg().Warn().Msgf("refused artifact request for %s: not in %s", digest, req.Bundle).Send()
+					continue
+				}
+				if err := p.sendBlob(c, digest); err != nil {
+					p.resolve(c, req.Bundle, fmt.Errorf("%w: %s: %v", ErrTransferFailed, digest, err))
+					return
+				}
+			}
+		},
+		socket.ActionArtifactsReady: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var ready bundleReady
+			if err := json.NewDecoder(r).Decode(&ready); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid artifacts ready: %v", err).Send()
+				return
+			}
+			var err error
+			if ready.Error != "" {
+				err = fmt.Errorf("%w: %s", ErrTransferFailed, ready.Error)
+			}
+			p.resolve(c, ready.Bundle, err)
+		},
+	}
+}
+
+func (p *Pusher) resolve(c *socket.Conn, bundle string, err error) {
+	p.mu.Lock()
+	ps, ok := p.waiters[pushKey{c, bundle}]
+	p.mu.Unlock()
+	if ok {
+		select {
+		case ps.done <- err:
+		default:
+		}
+	}
+}
+
+// Receiver stores the bundles pushed to an agent
+type Receiver struct {
+	store   *Store
+	OnReady func(c *socket.Conn, b Bundle) // optional, called once a bundle is complete
+
+	mu       sync.Mutex
+	partials map[string]*partial
+	bundles  map[string]*pendingBundle
+}
+
+type partial struct {
+	f        *os.File
+	size     int64
+	received int64
+}
+
+type pendingBundle struct {
+	conn    *socket.Conn
+	bundle  Bundle
+	missing map[string]bool
+}
+
+func NewReceiver(store *Store) *Receiver {
+	return &Receiver{
+		store:    store,
+		partials: make(map[string]*partial),
+		bundles:  make(map[string]*pendingBundle),
+	}
+}
+
+// Handlers serves ActionOfferArtifacts and ActionSendFileChunk
+func (rc *Receiver) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionOfferArtifacts: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var b Bundle
+			if err := json.NewDecoder(r).Decode(&b); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid artifact offer: %v", err).Send()
+				return
+			}
+			rc.offer(c, b)
+		},
+		socket.ActionSendFileChunk: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var chunk Chunk
+			if err := json.NewDecoder(r).Decode(&chunk); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid file chunk: %v", err).Send()
+				return
+			}
+			rc.chunk(c, chunk)
+		},
+	}
+}
+
+func (rc *Receiver) offer(c *socket.Conn, b Bundle) {
+	pb := &pendingBundle{conn: c, bundle: b, missing: make(map[string]bool)}
+	var missing []string
+	for _, d := range b.Digests() {
+		if !rc.store.Has(d) {
+			pb.missing[d] = true
+			missing = append(missing, d)
+		}
+	}
+
+	log.Info().
+		WithMeta("scope", "artifacts").
+		WithMeta("bundle", b.Name).
+		Msgf("offered %d blobs, %d missing", len(b.Digests()), len(missing)).Send()
+
+	if len(missing) == 0 {
+		rc.ready(pb, nil)
+		return
+	}
+
+	rc.mu.Lock()
+	rc.bundles[b.Name] = pb
+	rc.mu.Unlock()
+	if err := c.SendJSON(socket.ActionRequestArtifacts, blobRequest{Bundle: b.Name, Digests: missing}); err != nil {
+		c.GenLogMsg().Error().Msgf("failed to request artifacts: %v", err).Send()
+	}
+}
+
+func (rc *Receiver) chunk(c *socket.Conn, chunk Chunk) {
+	rc.mu.Lock()
+	if !rc.requested(c, chunk.Digest) {
+		rc.mu.Unlock()
+		c.GenLogMsg().Warn().Msgf("refused chunk of %s: not requested", chunk.Digest).Send()
+		return
+	}
+
+	p, ok := rc.partials[chunk.Digest]
+	end := chunk.Offset + int64(len(chunk.Data))
+	if chunk.Size < 0 || chunk.Offset < 0 || end > chunk.Size ||
+		(chunk.Size > 0 && chunk.Offset >= chunk.Size) || (ok && chunk.Size != p.size) {
+		rc.discard(chunk.Digest)
+		rc.mu.Unlock()
+		rc.fail(chunk.Digest, fmt.Errorf("%w: offset %d of %d bytes", ErrInvalidChunk, chunk.Offset, chunk.Size))
+		return
+	}
+	if !ok {
+		f, err := os.CreateTemp(filepath.Join(rc.store.dir, "tmp"), "recv-*")
+		if err != nil {
+			rc.mu.Unlock()
+			rc.fail(chunk.Digest, err)
+			return
+		}
+		p = &partial{f: f, size: chunk.Size}
+		rc.partials[chunk.Digest] = p
+	}
+
+	if _, err := p.f.WriteAt(chunk.Data, chunk.Offset); err != nil {
+		rc.discard(chunk.Digest)
+		rc.mu.Unlock()
+		rc.fail(chunk.Digest, err)
+		return
+	}
+	p.received += int64(len(chunk.Data))
+	done := p.received >= p.size
+	if done {
+		delete(rc.partials, chunk.Digest)
+	}
+	rc.mu.Unlock()
+
+	if !done {
+		return
+	}
+	err := rc.store.commit(p.f, chunk.Digest)
+	_ = os.Remove(p.f.Name())
+	if err != nil {
+		rc.fail(chunk.Digest, err)
+		return
+	}
+	rc.complete(chunk.Digest)
+}
+
+// requested reports whether a bundle offered over c is missing digest.
+// callers responsibility to hold mu
+func (rc *Receiver) requested(c *socket.Conn, digest string) bool {
+	for _, pb := range rc.bundles {
+		if pb.conn == c && pb.missing[digest] {
+			return true
+		}
+	}
+	return false
+}
+
+// discard removes the temporary file of digest, if any.
+// callers responsibility to hold mu
+func (rc *Receiver) discard(digest string) {
+	if p, ok := rc.partials[digest]; ok {
+		delete(rc.partials, digest)
+		_ = p.f.Close()
+		_ = os.Remove(p.f.Name())
+	}
+}
+
+// complete marks digest as received in every bundle waiting for it
+func (rc *Receiver) complete(digest string) {
+	rc.mu.Lock()
+	var done []*pendingBundle
+	for name, pb := range rc.bundles {
+		delete(pb.missing, digest)
+		if len(pb.missing) == 0 {
+			done = append(done, pb)
+			delete(rc.bundles, name)
+		}
+	}
+	rc.mu.Unlock()
+
+	for _, pb := range done {
+		rc.ready(pb, nil)
+	}
+}
+
+// fail aborts every bundle waiting for digest
+func (rc *Receiver) fail(digest string, err error) {
+	rc.mu.Lock()
+	var failed []*pendingBundle
+	for name, pb := range rc.bundles {
+		if pb.missing[digest] {
+			failed = append(failed, pb)
+			delete(rc.bundles, name)
+		}
+	}
+	rc.mu.Unlock()
+
+	for _, pb := range failed {
+		rc.ready(pb, fmt.Errorf("%s: %w", digest, err))
+	}
+}
+
+func (rc *Receiver) ready(pb *pendingBundle, err error) {
+	msg := bundleReady{Bundle: pb.bundle.Name}
+	if err != nil {
+		msg.Error = err.Error()
+		log.Error().
+			WithMeta("scope", "artifacts").
+			WithMeta("bundle", pb.bundle.Name).
+			Msgf("failed to receive bundle: %v", err).Send()
+	} else if rc.OnReady != nil {
+		rc.OnReady(pb.conn, pb.bundle)
+	}
+
+	if err := pb.conn.SendJSON(socket.ActionArtifactsReady, msg); err != nil {
+		pb.conn.GenLogMsg().Error().Msgf("failed to send artifacts ready: %v", err).Send()
+	}
+}
@@ -0,0 +1,251 @@
+// Build package turns challenge bundles into what the platform
+// deploys and hands out: images tagged by the digest of their build
+// context, attachments in the artifact store with their checksums,
+// and the files of compose and static deployments as bundles.
+// Results are recorded in the challenge registry.
+package build
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/log"
+)
+
+const (
+	DEFAULT_REPOSITORY = "ctfjx"
+
+	// Label of built images, with the challenge's id
+	LABEL_CHALLENGE = "ctfjx.challenge"
+
+	// Hex digits of digests used in tags and versions
+	SHORT_DIGEST_LEN = 12
+)
+
+var ErrBuildFailed = errors.New("build failed")
+
+// Builder builds challenges
+type Builder struct {
+	images     container.ImageBuilder
+	artifacts  *artifacts.Store
+	registry   *challenge.Registry
+	Repository string // images are tagged <Repository>/<challenge id>:<context digest>
+	Push       bool   // push built images so agents can pull them
+}
+
+func New(images container.ImageBuilder, store *artifacts.Store, registry *challenge.Registry) *Builder {
+	return &Builder{images: images, artifacts: store, registry: registry, Repository: DEFAULT_REPOSITORY}
+}
+
+// Build loads the bundle in dir, builds it and records the result.
+// Images whose tag already exists are not built again.
+func (b *Builder) Build(ctx context.Context, dir string) (challenge.Build, error) {
+	c, err := challenge.Load(dir)
+	if err != nil {
+		return challenge.Build{}, err
+	}
+	out := challenge.Build{Id: c.Id, Source: dir, Challenge: *c, BuiltAt: time.Now()}
+
+	if d := c.Deploy; d != nil {
+		switch {
+		case d.Image != "":
+			out.Image = d.Image
+		case d.Build != "":
+			if out.Image, err = b.buildImage(ctx, c); err != nil {
+				return challenge.Build{}, err
+			}
+		case d.Compose != "":
+			// the compose file's directory holds what it refers to
+			if out.Bundle, err = b.pack(c, filepath.Dir(d.Compose)); err != nil {
+				return challenge.Build{}, err
+			}
+		case d.Static != "":
+			if out.Bundle, err = b.pack(c, d.Static); err != nil {
+				return challenge.Build{}, err
+			}
+		}
+	}
+
+	for _, a := range c.Attachments {
+		built, err := b.packAttachment(c, a)
+		if err != nil {
+			return challenge.Build{}, fmt.Errorf("%w: attachment %s: %w", ErrBuildFailed, a.Path, err)
+		}
+		out.Attachments = append(out.Attachments, built)
+	}
+
+	if out.Version, err = version(out); err != nil {
+		return challenge.Build{}, err
+	}
+	if err := b.registry.Put(out); err != nil {
+		return challenge.Build{}, err
+	}
+	log.Info().WithMeta("scope", "build").Msgf("built %s version %s", out.Id, out.Version).Send()
+	return out, nil
+}
+
+func (b *Builder) buildImage(ctx context.Context, c *challenge.Challenge) (string, error) {
+	dir, err := c.Path(c.Deploy.Build)
+	if err != nil {
+		return "", err
+	}
+	digest, err := ContextDigest(dir)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBuildFailed, err)
+	}
+	tag := fmt.Sprintf("%s/%s:%s", b.Repository, c.Id, short(digest))
+
+	exists, err := b.images.HasImage(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return tag, nil
+	}
+	if err := b.images.BuildImage(ctx, dir, tag, map[string]string{LABEL_CHALLENGE: c.Id}); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBuildFailed, err)
+	}
+	if b.Push {
+		if err := b.images.PushImage(ctx, tag); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrBuildFailed, err)
+		}
+	}
+	return tag, nil
+}
+
+func (b *Builder) pack(c *challenge.Challenge, rel string) (*artifacts.Bundle, error) {
+	dir, err := c.Path(rel)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := b.artifacts.PackDir(c.Id, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBuildFailed, err)
+	}
+	return &bundle, nil
+}
+
+// packAttachment stores a, archiving it first if it is a directory
+func (b *Builder) packAttachment(c *challenge.Challenge, a challenge.Attachment) (challenge.BuiltAttachment, error) {
+	pth, err := c.Path(a.Path)
+	if err != nil {
+		return challenge.BuiltAttachment{}, err
+	}
+	info, err := os.Stat(pth)
+	if err != nil {
+		return challenge.BuiltAttachment{}, err
+	}
+
+	var r io.Reader
+	name := a.Name
+	if info.IsDir() {
+		pr, pw := io.Pipe()
+		go func() { pw.CloseWithError(zipDir(pw, pth)) }()
+		defer pr.Close()
+		r = pr
+		if !strings.HasSuffix(name, ".zip") {
+			name += ".zip"
+		}
+	} else {
+		f, err := os.Open(pth)
+		if err != nil {
+			return challenge.BuiltAttachment{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	digest, size, err := b.artifacts.Put(r)
+	if err != nil {
+		return challenge.BuiltAttachment{}, err
+	}
+	built := challenge.BuiltAttachment{Name: name, Digest: digest, Size: size}
+	if a.SHA256 != "" && a.SHA256 != built.SHA256() {
+		return challenge.BuiltAttachment{}, fmt.Errorf("%w: pinned sha256 %s, got %s", artifacts.ErrDigestMismatch, a.SHA256, built.SHA256())
+	}
+	return built, nil
+}
+
+// zipDir archives dir with sorted entries and fixed times,
+// so the same files always produce the same archive
+func zipDir(w io.Writer, dir string) error {
+	zw := zip.NewWriter(w)
+	base := filepath.Base(dir)
+	err := filepath.WalkDir(dir, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, pth)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr := &zip.FileHeader{Name: base + "/" + filepath.ToSlash(rel), Method: zip.Deflate, Modified: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)}
+		hdr.SetMode(info.Mode().Perm())
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(pth)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ContextDigest returns the digest of dir as a build context,
+// which only changes with the files' names, modes and contents
+func ContextDigest(dir string) (string, error) {
+	h := sha256.New()
+	if err := container.WriteContext(h, dir); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// version digests everything a build deploys and hands out
+func version(b challenge.Build) (string, error) {
+	h := sha256.New()
+	spec, err := os.ReadFile(b.Challenge.SpecFile())
+	if err != nil {
+		return "", err
+	}
+	h.Write(spec)
+	fmt.Fprintf(h, "\x00image %s\n", b.Image)
+	if b.Bundle != nil {
+		for _, f := range b.Bundle.Files {
+			fmt.Fprintf(h, "file %s %o %s\n", f.Path, f.Mode, f.Digest)
+		}
+	}
+	for _, a := range b.Attachments {
+		fmt.Fprintf(h, "attachment %s %s\n", a.Name, a.Digest)
+	}
+	return short("sha256:" + hex.EncodeToString(h.Sum(nil))), nil
+}
+
+func short(digest string) string {
+	return strings.TrimPrefix(digest, "sha256:")[:SHORT_DIGEST_LEN]
+}
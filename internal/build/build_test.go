@@ -0,0 +1,140 @@
+package build
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeImages struct {
+	mu     sync.Mutex
+	images map[string]bool
+	built  []string
+	pushed []string
+}
+
+func (f *fakeImages) HasImage(_ context.Context, image string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.images[image], nil
+}
+
+func (f *fakeImages) BuildImage(_ context.Context, dir, tag string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err != nil {
+		return err
+	}
+	f.images[tag] = true
+	f.built = append(f.built, tag)
+	return nil
+}
+
+func (f *fakeImages) PushImage(_ context.Context, image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushed = append(f.pushed, image)
+	return nil
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		pth := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0o755))
+		require.NoError(t, os.WriteFile(pth, []byte(content), 0o644))
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "notes")
+	writeFiles(t, dir, map[string]string{
+		challenge.FILENAME: `name: Notes
+category: pwn
+points: 100
+flag:
+  value: ctf{notes}
+deploy:
+  build: src
+  ports:
+    - port: 1337
+attachments:
+  - path: dist
+  - path: src/notes.c
+`,
+		"src/Dockerfile": "FROM scratch\nCOPY notes.c /\n",
+		"src/notes.c":    "int main() {}\n",
+		"dist/notes":     "\x7fELF",
+		"dist/libc.so.6": "libc",
+	})
+
+	store, err := artifacts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	registry, err := challenge.OpenRegistry(filepath.Join(t.TempDir(), "challenges.json"))
+	require.NoError(t, err)
+	images := &fakeImages{images: make(map[string]bool)}
+	b := New(images, store, registry)
+	b.Push = true
+
+	first, err := b.Build(context.Background(), dir)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(first.Image, "ctfjx/notes:"), first.Image)
+	assert.Equal(t, []string{first.Image}, images.built)
+	assert.Equal(t, []string{first.Image}, images.pushed)
+	require.Len(t, first.Attachments, 2)
+	assert.Equal(t, "dist.zip", first.Attachments[0].Name)
+	assert.Equal(t, "notes.c", first.Attachments[1].Name)
+	assert.True(t, store.Has(first.Attachments[1].Digest))
+	assert.Equal(t, artifacts.Digest([]byte("int main() {}\n")), first.Attachments[1].Digest, "digests are checksums")
+
+	f, err := store.Open(first.Attachments[0].Digest)
+	require.NoError(t, err)
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, f.Close())
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var names []string
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+	}
+	assert.Equal(t, []string{"dist/libc.so.6", "dist/notes"}, names)
+
+	recorded, ok := registry.Get("notes")
+	require.True(t, ok)
+	assert.Equal(t, first.Version, recorded.Version)
+	assert.Equal(t, "Notes", recorded.Challenge.Name)
+
+	// Unchanged sources are not rebuilt and keep their version
+	second, err := b.Build(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, first.Image, second.Image)
+	assert.Equal(t, first.Version, second.Version)
+	assert.Equal(t, first.Attachments, second.Attachments)
+	assert.Len(t, images.built, 1)
+
+	writeFiles(t, dir, map[string]string{"src/notes.c": "int main() { return 1; }\n"})
+	third, err := b.Build(context.Background(), dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Image, third.Image)
+	assert.NotEqual(t, first.Version, third.Version)
+	assert.Len(t, images.built, 2)
+
+	// notes.c no longer has the checksum it is pinned to
+	spec, err := os.ReadFile(filepath.Join(dir, challenge.FILENAME))
+	require.NoError(t, err)
+	pinned := strings.Replace(string(spec), "  - path: src/notes.c\n",
+		"  - path: src/notes.c\n    sha256: "+first.Attachments[1].SHA256()+"\n", 1)
+	writeFiles(t, dir, map[string]string{challenge.FILENAME: pinned})
+	_, err = b.Build(context.Background(), dir)
+	assert.ErrorIs(t, err, artifacts.ErrDigestMismatch)
+}
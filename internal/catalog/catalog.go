@@ -0,0 +1,313 @@
+// Catalog package lists what players and stats may know about the
+// challenges, filtered by their metadata, e.g.
+//
+//	GET /challenges?category=web&tag=xss&difficulty=easy,medium
+//	GET /challenges/facets?author=latte
+//	GET /challenges/notes
+//	GET /challenges/notes/attachments/notes.zip
+//
+// Flags, deployment details and anything else private never leave
+// the registry.
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/storage"
+)
+
+const (
+	SORT_NAME       = "name"
+	SORT_POINTS     = "points"
+	SORT_DIFFICULTY = "difficulty"
+	SORT_CATEGORY   = "category"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Entry is the public metadata of a challenge
+type Entry struct {
+	Id          string               `json:"id"`
+	Name        string               `json:"name"`
+	Category    string               `json:"category"`
+	Points      int                  `json:"points"`
+	Difficulty  challenge.Difficulty `json:"difficulty,omitempty"`
+	Authors     []string             `json:"authors,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Attachments []Attachment         `json:"attachments,omitempty"`
+	OnDemand    bool                 `json:"on_demand"` // teams start their own instance
+	Version     string               `json:"version"`
+}
+
+// EntryOf returns the public metadata of b
+func EntryOf(b challenge.Build) Entry {
+	c := b.Challenge
+	e := Entry{
+		Id:          b.Id,
+		Name:        c.Name,
+		Category:    c.Category,
+		Points:      c.Points,
+		Difficulty:  c.Difficulty,
+		Authors:     c.Authors,
+		Tags:        c.Tags,
+		Description: c.Description,
+		OnDemand:    c.Deploy != nil && c.Deploy.PerTeam,
+		Version:     b.Version,
+	}
+	for _, a := range b.Attachments {
+		e.Attachments = append(e.Attachments, Attachment{Name: a.Name, Size: a.Size, SHA256: a.SHA256()})
+	}
+	return e
+}
+
+// Attachment is a file players download, with the checksum they
+// can check it against
+type Attachment struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // hex
+}
+
+// Filter selects entries, empty fields match everything. Entries
+// must match one of the values of every field set, and every tag.
+type Filter struct {
+	Categories   []string
+	Tags         []string
+	Difficulties []challenge.Difficulty
+	Authors      []string
+	Query        string // in the name or description, case insensitive
+	Sort         string // SORT_NAME by default
+}
+
+// ParseFilter reads a filter from query parameters, whose values
+// may be repeated or comma separated
+func ParseFilter(q url.Values) (Filter, error) {
+	list := func(key string) []string {
+		var out []string
+		for _, v := range q[key] {
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+					out = append(out, s)
+				}
+			}
+		}
+		return out
+	}
+
+	f := Filter{
+		Categories: list("category"),
+		Tags:       list("tag"),
+		Authors:    list("author"),
+		Query:      strings.TrimSpace(q.Get("q")),
+		Sort:       q.Get("sort"),
+	}
+	for _, d := range list("difficulty") {
+		if challenge.Difficulty(d).Rank() == 0 {
+			return Filter{}, fmt.Errorf("%w: unknown difficulty %q", ErrInvalidFilter, d)
+		}
+		f.Difficulties = append(f.Difficulties, challenge.Difficulty(d))
+	}
+	switch f.Sort {
+	case "":
+		f.Sort = SORT_NAME
+	case SORT_NAME, SORT_POINTS, SORT_DIFFICULTY, SORT_CATEGORY:
+	default:
+		return Filter{}, fmt.Errorf("%w: cannot sort by %q", ErrInvalidFilter, f.Sort)
+	}
+	return f, nil
+}
+
+// Match tells if e passes f
+func (f Filter) Match(e Entry) bool {
+	fold := func(values []string, v string) bool {
+		return slices.ContainsFunc(values, func(s string) bool { return strings.EqualFold(s, v) })
+	}
+	switch {
+	case len(f.Categories) > 0 && !fold(f.Categories, e.Category):
+		return false
+	case len(f.Difficulties) > 0 && !slices.Contains(f.Difficulties, e.Difficulty):
+		return false
+	case len(f.Authors) > 0 && !slices.ContainsFunc(e.Authors, func(a string) bool { return fold(f.Authors, a) }):
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !fold(e.Tags, tag) {
+			return false
+		}
+	}
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(e.Name), q) && !strings.Contains(strings.ToLower(e.Description), q) {
+			return false
+		}
+	}
+	return true
+}
+
+// sort orders entries by f.Sort, then by name
+func (f Filter) sort(entries []Entry) {
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		var c int
+		switch f.Sort {
+		case SORT_POINTS:
+			c = a.Points - b.Points
+		case SORT_DIFFICULTY:
+			c = a.Difficulty.Rank() - b.Difficulty.Rank()
+		case SORT_CATEGORY:
+			c = strings.Compare(a.Category, b.Category)
+		}
+		if c != 0 {
+			return c
+		}
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+}
+
+// Facets counts the entries by each dimension, for filter menus and stats
+type Facets struct {
+	Total        int            `json:"total"`
+	Categories   map[string]int `json:"categories"`
+	Tags         map[string]int `json:"tags"`
+	Difficulties map[string]int `json:"difficulties"` // "" for unrated
+	Authors      map[string]int `json:"authors"`
+	Points       map[string]int `json:"points"` // by category
+}
+
+// Catalog lists the challenges of a registry
+type Catalog struct {
+	challenges *challenge.Registry
+	// Signs attachment downloads, which are not served if nil
+	Storage *storage.Storage
+	// Tells if the player behind r may see challenge id, e.g. from
+	// the unlock graph. Every challenge is visible if nil.
+	Visible func(r *http.Request, id string) bool
+	// Current value of challenge id, e.g. from the scoreboard. Entries
+	// have their static points if nil.
+	Points func(id string) int
+}
+
+func New(challenges *challenge.Registry) *Catalog {
+	return &Catalog{challenges: challenges}
+}
+
+// List returns the entries matching f, sorted by f.Sort. visible
+// tells if a challenge may be listed, every one is if nil.
+func (c *Catalog) List(f Filter, visible func(id string) bool) []Entry {
+	out := []Entry{}
+	for _, b := range c.challenges.List() {
+		if visible != nil && !visible(b.Id) {
+			continue
+		}
+		if e := c.entry(b); f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	f.sort(out)
+	return out
+}
+
+// Facets counts the entries matching f
+func (c *Catalog) Facets(f Filter, visible func(id string) bool) Facets {
+	fc := Facets{
+		Categories:   make(map[string]int),
+		Tags:         make(map[string]int),
+		Difficulties: make(map[string]int),
+		Authors:      make(map[string]int),
+		Points:       make(map[string]int),
+	}
+	for _, e := range c.List(f, visible) {
+		fc.Total++
+		fc.Categories[e.Category]++
+		fc.Difficulties[string(e.Difficulty)]++
+		fc.Points[e.Category] += e.Points
+		for _, t := range e.Tags {
+			fc.Tags[t]++
+		}
+		for _, a := range e.Authors {
+			fc.Authors[a]++
+		}
+	}
+	return fc
+}
+
+// Handler serves the catalog under /challenges
+func (c *Catalog) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /challenges", func(w http.ResponseWriter, r *http.Request) {
+		f, err := ParseFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, c.List(f, c.visible(r)))
+	})
+	mux.HandleFunc("GET /challenges/facets", func(w http.ResponseWriter, r *http.Request) {
+		f, err := ParseFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, c.Facets(f, c.visible(r)))
+	})
+	mux.HandleFunc("GET /challenges/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		b, ok := c.challenges.Get(id)
+		if visible := c.visible(r); !ok || (visible != nil && !visible(id)) {
+			http.Error(w, "no such challenge", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, c.entry(b))
+	})
+	mux.HandleFunc("GET /challenges/{id}/attachments/{name}", func(w http.ResponseWriter, r *http.Request) {
+		id, name := r.PathValue("id"), r.PathValue("name")
+		b, ok := c.challenges.Get(id)
+		if visible := c.visible(r); !ok || (visible != nil && !visible(id)) {
+			http.Error(w, "no such challenge", http.StatusNotFound)
+			return
+		}
+		i := slices.IndexFunc(b.Attachments, func(a challenge.BuiltAttachment) bool { return a.Name == name })
+		if i < 0 || c.Storage == nil {
+			http.Error(w, "no such attachment", http.StatusNotFound)
+			return
+		}
+		a := b.Attachments[i]
+		u, _, err := c.Storage.URL(r.Context(), a.Digest, a.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the checksum comes from the registry, not the backend serving the file
+		w.Header().Set("Repr-Digest", storage.ReprDigest(a.Digest))
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, u, http.StatusFound)
+	})
+	return mux
+}
+
+func (c *Catalog) entry(b challenge.Build) Entry {
+	e := EntryOf(b)
+	if c.Points != nil {
+		e.Points = c.Points(b.Id)
+	}
+	return e
+}
+
+func (c *Catalog) visible(r *http.Request) func(id string) bool {
+	if c.Visible == nil {
+		return nil
+	}
+	return func(id string) bool { return c.Visible(r, id) }
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
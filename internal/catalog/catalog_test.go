@@ -0,0 +1,138 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func registry(t *testing.T) *challenge.Registry {
+	reg, err := challenge.OpenRegistry("")
+	require.NoError(t, err)
+	for _, c := range []challenge.Challenge{
+		{Id: "notes", Name: "Notes", Category: "pwn", Points: 500, Difficulty: challenge.DifficultyHard, Authors: []string{"latte"}, Tags: []string{"heap"}, Flag: challenge.Flag{Value: "ctf{secret}"}},
+		{Id: "xss", Name: "Guestbook", Category: "web", Points: 100, Difficulty: challenge.DifficultyEasy, Authors: []string{"latte", "mocha"}, Tags: []string{"xss", "client"}, Description: "Sign the guestbook"},
+		{Id: "csp", Name: "Bypass", Category: "web", Points: 300, Difficulty: challenge.DifficultyMedium, Authors: []string{"mocha"}, Tags: []string{"xss"}, Deploy: &challenge.Deploy{PerTeam: true}},
+	} {
+		require.NoError(t, reg.Put(challenge.Build{Id: c.Id, Version: "v1", Challenge: c}))
+	}
+	return reg
+}
+
+func ids(entries []Entry) []string {
+	out := []string{}
+	for _, e := range entries {
+		out = append(out, e.Id)
+	}
+	return out
+}
+
+func TestList(t *testing.T) {
+	c := New(registry(t))
+	list := func(q string) []string {
+		values, err := url.ParseQuery(q)
+		require.NoError(t, err)
+		f, err := ParseFilter(values)
+		require.NoError(t, err)
+		return ids(c.List(f, nil))
+	}
+
+	assert.Equal(t, []string{"csp", "xss", "notes"}, list(""))
+	assert.Equal(t, []string{"xss", "csp"}, list("category=WEB&sort=points"))
+	assert.Equal(t, []string{"xss"}, list("tag=xss&tag=client"))
+	assert.Equal(t, []string{"xss", "csp"}, list("difficulty=easy,medium&sort=difficulty"))
+	assert.Equal(t, []string{"notes", "xss"}, list("author=latte&sort=category"))
+	assert.Equal(t, []string{"xss"}, list("q=guestbook"))
+	assert.Empty(t, list("category=crypto"))
+
+	_, err := ParseFilter(url.Values{"difficulty": {"trivial"}})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = ParseFilter(url.Values{"sort": {"flag"}})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	fc := c.Facets(Filter{}, func(id string) bool { return id != "notes" })
+	assert.Equal(t, 2, fc.Total)
+	assert.Equal(t, map[string]int{"xss": 2, "client": 1}, fc.Tags)
+	assert.Equal(t, map[string]int{"latte": 1, "mocha": 2}, fc.Authors)
+	assert.Equal(t, map[string]int{"web": 400}, fc.Points)
+
+	c.Points = func(id string) int { return 1 }
+	assert.Equal(t, map[string]int{"web": 2}, c.Facets(Filter{}, func(id string) bool { return id != "notes" }).Points, "current values replace static points")
+}
+
+func TestHandler(t *testing.T) {
+	c := New(registry(t))
+	c.Visible = func(r *http.Request, id string) bool { return id != "csp" }
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	get := func(path string, v any) int {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	var entries []Entry
+	assert.Equal(t, http.StatusOK, get("/challenges?category=web", &entries))
+	assert.Equal(t, []string{"xss"}, ids(entries))
+
+	var e Entry
+	assert.Equal(t, http.StatusOK, get("/challenges/notes", &e))
+	assert.Equal(t, challenge.DifficultyHard, e.Difficulty)
+	assert.Equal(t, http.StatusNotFound, get("/challenges/csp", nil), "locked challenges are hidden")
+	assert.Equal(t, http.StatusNotFound, get("/challenges/nope", nil))
+
+	var fc Facets
+	assert.Equal(t, http.StatusOK, get("/challenges/facets", &fc))
+	assert.Equal(t, map[string]int{"pwn": 1, "web": 1}, fc.Categories)
+	assert.Equal(t, http.StatusBadRequest, get("/challenges?sort=flag", nil))
+
+	resp, err := http.Get(srv.URL + "/challenges/notes")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var raw map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&raw))
+	assert.NotContains(t, raw, "flag")
+}
+
+func TestAttachments(t *testing.T) {
+	reg := registry(t)
+	store, err := storage.Open(storage.Config{Local: storage.LocalConfig{Dir: t.TempDir(), BaseURL: "https://files.ctf.example", Secret: "k"}})
+	require.NoError(t, err)
+	obj, err := store.Upload(context.Background(), strings.NewReader("\x7fELF"))
+	require.NoError(t, err)
+	b, _ := reg.Get("notes")
+	b.Attachments = []challenge.BuiltAttachment{{Name: "notes", Digest: obj.Digest, Size: obj.Size}}
+	require.NoError(t, reg.Put(b))
+
+	c := New(reg)
+	e := c.List(Filter{Categories: []string{"pwn"}}, nil)[0]
+	assert.Equal(t, []Attachment{{Name: "notes", Size: 4, SHA256: strings.TrimPrefix(obj.Digest, "sha256:")}}, e.Attachments)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, get("/challenges/notes/attachments/notes").Code, "no storage")
+
+	c.Storage = store
+	w := get("/challenges/notes/attachments/notes")
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), "https://files.ctf.example/files/"))
+	assert.Equal(t, storage.ReprDigest(obj.Digest), w.Header().Get("Repr-Digest"))
+	assert.Equal(t, http.StatusNotFound, get("/challenges/notes/attachments/libc.so.6").Code)
+}
@@ -0,0 +1,236 @@
+// Challenge package describes challenge bundles: a directory holding
+// a challenge.yml next to everything it references, e.g.
+//
+//	version: 1
+//	name: Baby Heap
+//	category: pwn
+//	points: 500
+//	author: latte
+//	flag:
+//	  value: ctf{...}
+//	deploy:
+//	  build: ./src
+//	  ports:
+//	    - port: 1337
+//	healthcheck:
+//	  type: tcp
+//	attachments:
+//	  - path: dist/chall
+//
+// See Load.
+package challenge
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/lattesec/ctfjx/internal/scoring"
+)
+
+const (
+	FILENAME     = "challenge.yml"
+	SPEC_VERSION = 1
+
+	DEFAULT_HEALTHCHECK_INTERVAL = env.Duration(30 * time.Second)
+	DEFAULT_HEALTHCHECK_TIMEOUT  = env.Duration(5 * time.Second)
+	DEFAULT_HEALTHCHECK_RETRIES  = 3
+	DEFAULT_HEALTHCHECK_ESCALATE = 3
+
+	DEFAULT_SOLVE_TIMEOUT = env.Duration(2 * time.Minute)
+)
+
+var (
+	ErrNoChallenge      = errors.New("no challenge.yml")
+	ErrInvalidChallenge = errors.New("invalid challenge")
+)
+
+// Challenge is a parsed challenge.yml
+type Challenge struct {
+	Version     int          `yaml:"version" json:"version"`
+	Id          string       `yaml:"id,omitempty" json:"id"` // defaults to the bundle's directory name
+	Name        string       `yaml:"name" json:"name"`
+	Category    string       `yaml:"category" json:"category"`
+	Points      int          `yaml:"points" json:"points"`
+	Author      string       `yaml:"author,omitempty" json:"-"` // merged into Authors
+	Authors     []string     `yaml:"authors,omitempty" json:"authors,omitempty"`
+	Difficulty  Difficulty   `yaml:"difficulty,omitempty" json:"difficulty,omitempty"`
+	Description string       `yaml:"description,omitempty" json:"description,omitempty"`
+	Tags        []string     `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Flag        Flag         `yaml:"flag" json:"flag"`
+	Deploy      *Deploy      `yaml:"deploy,omitempty" json:"deploy,omitempty"` // nil for challenges without a service
+	Attachments []Attachment `yaml:"attachments,omitempty" json:"attachments,omitempty"`
+	Healthcheck *Healthcheck `yaml:"healthcheck,omitempty" json:"healthcheck,omitempty"`
+	Unlock      *Unlock      `yaml:"unlock,omitempty" json:"unlock,omitempty"` // nil if visible from the start
+	Solve       *Solve       `yaml:"solve,omitempty" json:"solve,omitempty"`
+	Scoring     *Scoring     `yaml:"scoring,omitempty" json:"scoring,omitempty"` // decays Points, the event's if nil
+
+	// Dir is the bundle's directory, paths in the spec are relative to it
+	Dir  string `yaml:"-" json:"-"`
+	spec string
+}
+
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"
+	DifficultyMedium Difficulty = "medium"
+	DifficultyHard   Difficulty = "hard"
+	DifficultyInsane Difficulty = "insane"
+)
+
+var difficulties = []Difficulty{DifficultyEasy, DifficultyMedium, DifficultyHard, DifficultyInsane}
+
+// Rank orders difficulties from 1 for easy, 0 if unrated or unknown
+func (d Difficulty) Rank() int {
+	return slices.Index(difficulties, d) + 1
+}
+
+// Unlock lists what a team must solve to see a challenge, e.g.
+//
+//	unlock:
+//	  after: [intro, warmup]
+//	  categories:
+//	    web: 2
+//
+// unlocks it once intro, warmup and two web challenges are solved
+type Unlock struct {
+	After      []string       `yaml:"after,omitempty" json:"after,omitempty"`           // challenge ids
+	Any        bool           `yaml:"any,omitempty" json:"any,omitempty"`               // one of After is enough
+	Categories map[string]int `yaml:"categories,omitempty" json:"categories,omitempty"` // category -> solves in it
+}
+
+// Scoring is how Points decay as teams solve the challenge, e.g.
+//
+//	scoring:
+//	  formula: logarithmic
+//	  minimum: 100
+//	  decay: 30
+//
+// see the scoring package
+type Scoring = scoring.Spec
+
+type FlagType = flags.Type
+
+const (
+	FlagStatic FlagType = flags.Static // the submission must equal Value
+	FlagRegex  FlagType = flags.Regex  // the submission must fully match Value
+	// Value is a template every team's instance gets its own flag
+	// from, see the flags package
+	FlagDynamic FlagType = flags.Dynamic
+)
+
+type FlagScope string
+
+const (
+	FlagPerTeam     FlagScope = "team"     // a team keeps its flag across instances
+	FlagPerInstance FlagScope = "instance" // every new instance gets a new flag
+)
+
+// Flag defines what a correct submission is
+type Flag struct {
+	Type            FlagType `yaml:"type,omitempty" json:"type"` // static by default
+	Value           string   `yaml:"value,omitempty" json:"value,omitempty"`
+	File            string   `yaml:"file,omitempty" json:"file,omitempty"` // read Value from this file instead
+	CaseInsensitive bool     `yaml:"case_insensitive,omitempty" json:"case_insensitive,omitempty"`
+
+	// Dynamic flags only
+	Per  FlagScope `yaml:"per,omitempty" json:"per,omitempty"`   // team by default
+	Env  string    `yaml:"env,omitempty" json:"env,omitempty"`   // variable the flag is injected as, FLAG by default
+	Path string    `yaml:"path,omitempty" json:"path,omitempty"` // also written to this file in the instance
+}
+
+type DeployType string
+
+const (
+	DeployImage   DeployType = "image"   // a single container, from Image or built from Build
+	DeployCompose DeployType = "compose" // a compose stack
+	DeployStatic  DeployType = "static"  // files served over http
+)
+
+// Deploy describes the service of a challenge.
+// Exactly one of Image, Build, Compose and Static is set.
+type Deploy struct {
+	Type    DeployType `yaml:"type,omitempty" json:"type"` // inferred from the fields below if empty
+	Image   string     `yaml:"image,omitempty" json:"image,omitempty"`
+	Build   string     `yaml:"build,omitempty" json:"build,omitempty"`     // directory with a Dockerfile
+	Compose string     `yaml:"compose,omitempty" json:"compose,omitempty"` // compose file
+	Static  string     `yaml:"static,omitempty" json:"static,omitempty"`   // directory to serve
+
+	Ports     []Port            `yaml:"ports,omitempty" json:"ports,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Limits    Limits            `yaml:"limits,omitempty" json:"limits"`
+	Selector  labels.Selector   `yaml:"selector,omitempty" json:"selector,omitempty"` // agents it may run on
+	PerTeam   bool              `yaml:"per_team,omitempty" json:"per_team,omitempty"` // one instance per team instead of a shared one
+	Isolate   bool              `yaml:"isolate,omitempty" json:"isolate,omitempty"`   // on its own firewalled network
+	Instances int               `yaml:"instances,omitempty" json:"instances,omitempty"`
+}
+
+const (
+	PROTOCOL_TCP  = "tcp"
+	PROTOCOL_UDP  = "udp"
+	PROTOCOL_HTTP = "http"
+)
+
+// Port is a port the service listens on
+type Port struct {
+	Port     int    `yaml:"port" json:"port"`
+	Protocol string `yaml:"protocol,omitempty" json:"protocol"` // tcp (default), udp or http
+	Name     string `yaml:"name,omitempty" json:"name,omitempty"`
+}
+
+// Limits restricts the resources of the service, zero means unlimited
+type Limits struct {
+	CPUs   float64      `yaml:"cpus,omitempty" json:"cpus,omitempty"`
+	Memory env.ByteSize `yaml:"memory,omitempty" json:"memory,omitempty"`
+	Pids   int64        `yaml:"pids,omitempty" json:"pids,omitempty"`
+	Disk   env.ByteSize `yaml:"disk,omitempty" json:"disk,omitempty"`
+}
+
+func (l Limits) Container() container.Limits {
+	return container.Limits{CPUs: l.CPUs, Memory: l.Memory.Int64(), Pids: l.Pids, Disk: l.Disk.Int64()}
+}
+
+// Attachment is a file or directory handed out to players,
+// directories are archived when the challenge is built
+type Attachment struct {
+	Path string `yaml:"path" json:"path"`
+	Name string `yaml:"name,omitempty" json:"name,omitempty"` // defaults to the base of Path
+	// Hex SHA-256 the built attachment must have, so a file changed by
+	// mistake fails the build instead of being handed out
+	SHA256 string `yaml:"sha256,omitempty" json:"sha256,omitempty"`
+}
+
+// Solve is a script solving the challenge, run from the bundle's
+// directory against a fresh instance, see the tester package. It
+// finds the instance in CTFJX_HOST and CTFJX_PORT and passes if it
+// prints the flag.
+type Solve struct {
+	Command []string     `yaml:"command" json:"command"`
+	Port    int          `yaml:"port,omitempty" json:"port,omitempty"` // defaults to the first declared port
+	Timeout env.Duration `yaml:"timeout,omitempty" json:"timeout"`
+}
+
+type HealthcheckType string
+
+const (
+	HealthcheckTCP  HealthcheckType = "tcp"  // the port accepts connections
+	HealthcheckHTTP HealthcheckType = "http" // GET Path answers with a 2xx or 3xx
+	HealthcheckExec HealthcheckType = "exec" // Command exits with 0, run from the bundle's directory
+)
+
+// Healthcheck tells if a deployed challenge works
+type Healthcheck struct {
+	Type     HealthcheckType `yaml:"type" json:"type"`
+	Port     int             `yaml:"port,omitempty" json:"port,omitempty"` // defaults to the first declared port
+	Path     string          `yaml:"path,omitempty" json:"path,omitempty"`
+	Command  []string        `yaml:"command,omitempty" json:"command,omitempty"`
+	Interval env.Duration    `yaml:"interval,omitempty" json:"interval"`
+	Timeout  env.Duration    `yaml:"timeout,omitempty" json:"timeout"`
+	Retries  int             `yaml:"retries,omitempty" json:"retries"`   // failures in a row before a restart
+	Escalate int             `yaml:"escalate,omitempty" json:"escalate"` // restarts in a row before organizers are alerted
+}
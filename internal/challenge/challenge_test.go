@@ -0,0 +1,298 @@
+package challenge
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const babyHeap = `name: Baby Heap
+category: pwn
+points: 500
+author: latte
+flag:
+  file: flag.txt
+deploy:
+  build: src
+  ports:
+    - port: 1337
+  limits:
+    memory: 256MiB
+  selector: arch=amd64
+healthcheck:
+  type: tcp
+attachments:
+  - path: dist/chall
+`
+
+// writeBundle writes files, by slash separated path, into a new bundle
+func writeBundle(t *testing.T, files map[string]string) string {
+	dir := filepath.Join(t.TempDir(), "baby-heap")
+	for name, content := range files {
+		pth := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0o755))
+		require.NoError(t, os.WriteFile(pth, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeBundle(t, map[string]string{
+		FILENAME:         babyHeap,
+		"flag.txt":       "ctf{heap}\n",
+		"src/Dockerfile": "FROM scratch\n",
+		"dist/chall":     "\x7fELF",
+	})
+
+	c, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "baby-heap", c.Id)
+	assert.Equal(t, SPEC_VERSION, c.Version)
+	assert.Equal(t, FlagStatic, c.Flag.Type)
+	assert.Equal(t, DeployImage, c.Deploy.Type)
+	assert.Equal(t, PROTOCOL_TCP, c.Deploy.Ports[0].Protocol)
+	assert.Equal(t, int64(256<<20), c.Deploy.Limits.Container().Memory)
+	assert.True(t, c.Deploy.Selector.Matches(labels.Labels{"arch": "amd64"}))
+	assert.Equal(t, 1337, c.Healthcheck.Port)
+	assert.Equal(t, 30*time.Second, c.Healthcheck.Interval.Duration())
+	assert.Equal(t, "chall", c.Attachments[0].Name)
+
+	flag, err := c.FlagValue()
+	require.NoError(t, err)
+	assert.Equal(t, "ctf{heap}", flag)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "dist", "chall")))
+	_, err = Load(dir)
+	var ce *env.ConfigError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, "attachments[0].path", ce.Key)
+	assert.Equal(t, filepath.Join(dir, FILENAME), ce.Path)
+
+	_, err = Load(t.TempDir())
+	assert.ErrorIs(t, err, ErrNoChallenge)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse("challenge.yml", []byte("name: x\ncategory: web\npoints: 1\nflag:\n  value: f\nhealtcheck: {}\n"))
+	var ce *env.ConfigError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, 6, ce.Line, "unknown fields are located")
+
+	_, err = Parse("bad/challenge.yml", []byte(`
+version: 2
+points: -1
+scoring:
+  formula: linear
+flag:
+  type: regex
+  value: "ctf{["
+deploy:
+  image: nginx
+  compose: compose.yml
+  ports:
+    - port: 80
+      protocol: http
+    - port: 80
+    - port: 70000
+      protocol: sctp
+healthcheck:
+  type: http
+  port: 8080
+  path: health
+attachments:
+  - path: ../secret
+    sha256: md5
+`))
+	require.ErrorIs(t, err, ErrInvalidChallenge)
+
+	var keys []string
+	for _, p := range Problems(err) {
+		require.True(t, errors.As(p, &ce))
+		assert.Equal(t, "bad/challenge.yml", ce.Path)
+		keys = append(keys, ce.Key)
+	}
+	assert.ElementsMatch(t, []string{
+		"version", "name", "category", "points", "scoring", "flag.value",
+		"attachments[0].path", "attachments[0].sha256", "deploy", "deploy.type", "deploy.ports[1]",
+		"deploy.ports[2].port", "deploy.ports[2].protocol",
+		"healthcheck.port", "healthcheck.path",
+	}, keys)
+}
+
+func TestPath(t *testing.T) {
+	c := &Challenge{Dir: "/chals/x"}
+	pth, err := c.Path("dist/a.zip")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/chals/x", "dist", "a.zip"), pth)
+
+	for _, bad := range []string{"../y", "/etc/passwd", ""} {
+		_, err := c.Path(bad)
+		assert.ErrorIs(t, err, ErrInvalidChallenge, bad)
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := writeBundle(t, map[string]string{
+		FILENAME:         babyHeap + "description: heap notes\n",
+		"flag.txt":       "\n",
+		"src/Dockerfile": "FROM scratch\nEXPOSE 8080\n",
+		"dist/chall":     string(make([]byte, 2048)),
+	})
+
+	r := Lint(dir, LintOptions{MaxAttachmentSize: env.KiB})
+	assert.Equal(t, "baby-heap", r.Id)
+	assert.True(t, r.Failed())
+
+	rules := make(map[string]Finding)
+	for _, f := range r.Findings {
+		rules[f.Rule] = f
+	}
+	assert.Len(t, rules, 3)
+	assert.Equal(t, "flag.file", rules[RULE_MISSING_FLAG].Key)
+	assert.Equal(t, SeverityWarning, rules[RULE_PORT_NOT_EXPOSED].Severity)
+	oversized := rules[RULE_OVERSIZED_ATTACHMENT]
+	assert.Equal(t, SeverityError, oversized.Severity)
+	assert.Equal(t, filepath.Join(dir, FILENAME), oversized.Path)
+	assert.Equal(t, 17, oversized.Line, "findings are located in the spec")
+
+	r = Lint(writeBundle(t, map[string]string{FILENAME: `name: x
+category: web
+points: 100
+deploy:
+  image: nginx
+  ports:
+    - port: 0
+healthcheck:
+  type: exec
+  command: [./check.sh]
+`}), LintOptions{})
+	got := make(map[string]int)
+	for _, f := range r.Findings {
+		got[f.Rule] = f.Line
+	}
+	assert.Equal(t, map[string]int{
+		RULE_MISSING_FLAG:            0,
+		RULE_BAD_PORT:                7,
+		RULE_UNREACHABLE_HEALTHCHECK: 10,
+		RULE_NO_DESCRIPTION:          0,
+	}, got)
+}
+
+func TestGraph(t *testing.T) {
+	root := t.TempDir()
+	write := func(id, category, unlock string) {
+		pth := filepath.Join(root, id, FILENAME)
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0o755))
+		spec := "name: " + id + "\ncategory: " + category + "\nflag:\n  value: ctf{x}\n" + unlock
+		require.NoError(t, os.WriteFile(pth, []byte(spec), 0o644))
+	}
+	write("intro", "misc", "")
+	write("xss", "web", "")
+	write("sqli", "web", "unlock:\n  after: [intro]\n")
+	write("ssrf", "web", "unlock:\n  after: [xss, sqli]\n  any: true\n")
+	write("rce", "web", "unlock:\n  categories:\n    web: 2\n")
+
+	g, err := LoadAll(root)
+	require.NoError(t, err)
+	assert.Len(t, g.Challenges(), 5)
+	assert.Equal(t, []string{"intro", "xss"}, g.Visible(nil))
+	assert.Equal(t, []string{"intro", "sqli", "ssrf", "xss"}, g.Visible(map[string]bool{"intro": true, "xss": true}))
+	assert.True(t, g.Unlocked("rce", map[string]bool{"xss": true, "sqli": true}))
+	assert.False(t, g.Unlocked("rce", map[string]bool{"xss": true, "intro": true}))
+	assert.False(t, g.Unlocked("nope", nil))
+	assert.Equal(t, []string{"ssrf"}, g.Dependents("xss"))
+
+	// a cycle, and a category that never has enough solves
+	write("intro", "misc", "unlock:\n  after: [ssrf]\n")
+	write("xss", "web", "unlock:\n  categories:\n    crypto: 1\n")
+	_, err = LoadAll(root)
+	require.ErrorIs(t, err, ErrNeverUnlocked)
+	assert.Contains(t, err.Error(), "unlock cycle intro -> ssrf -> sqli -> intro")
+	problems := Problems(err)
+	assert.Len(t, problems, 5, "everything depends on the cycle")
+
+	write("intro", "misc", "unlock:\n  after: [missing]\n")
+	_, err = LoadAll(root)
+	assert.ErrorIs(t, err, ErrUnknownPrerequisite)
+
+	// linting a subset only warns about what is outside of it
+	reports := LintAll([]string{filepath.Join(root, "intro")}, LintOptions{})
+	require.Len(t, reports, 1)
+	found := false
+	for _, f := range reports[0].Findings {
+		if f.Rule == RULE_UNLOCK {
+			found = true
+			assert.Equal(t, SeverityWarning, f.Severity)
+			assert.Equal(t, 6, f.Line)
+		}
+	}
+	assert.True(t, found)
+
+	write("intro", "misc", "unlock:\n  after: [intro]\n")
+	_, err = LoadAll(root)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+}
+
+func TestMetadata(t *testing.T) {
+	c, err := Parse("challenge.yml", []byte(`id: notes
+name: Notes
+category: " Pwn "
+author: latte
+authors: [mocha]
+difficulty: Hard
+tags: [Heap, heap, " uaf "]
+flag:
+  value: ctf{x}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "pwn", c.Category)
+	assert.Equal(t, []string{"latte", "mocha"}, c.Authors)
+	assert.Equal(t, DifficultyHard, c.Difficulty)
+	assert.Equal(t, 3, c.Difficulty.Rank())
+	assert.Equal(t, []string{"heap", "uaf"}, c.Tags)
+
+	_, err = Parse("challenge.yml", []byte("id: notes\nname: Notes\ncategory: pwn\ndifficulty: trivial\nflag:\n  value: ctf{x}\n"))
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+}
+
+func TestDynamicFlag(t *testing.T) {
+	c, err := Parse("challenge.yml", []byte(`id: heap
+name: Heap
+category: pwn
+flag:
+  type: dynamic
+  value: ctfjx{heap_{{hmac}}}
+deploy:
+  image: ctfjx/heap
+  per_team: true
+  ports:
+    - port: 1337
+`))
+	require.NoError(t, err)
+	assert.Equal(t, FlagPerTeam, c.Flag.Per)
+	assert.Equal(t, "FLAG", c.Flag.Env)
+
+	_, err = Parse("challenge.yml", []byte(`id: heap
+name: Heap
+category: pwn
+flag:
+  type: dynamic
+  value: ctfjx{heap}
+  per: round
+  path: flag.txt
+`))
+	var keys []string
+	for _, p := range Problems(err) {
+		var ce *env.ConfigError
+		require.ErrorAs(t, p, &ce)
+		keys = append(keys, ce.Key)
+	}
+	assert.ElementsMatch(t, []string{"flag.value", "flag.type", "flag.per", "flag.path"}, keys)
+}
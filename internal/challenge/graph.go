@@ -0,0 +1,222 @@
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/env"
+)
+
+var (
+	ErrUnknownPrerequisite = errors.New("unknown prerequisite")
+	ErrNeverUnlocked       = errors.New("challenge can never be unlocked")
+)
+
+// Graph is the unlock graph of a set of challenges
+type Graph struct {
+	challenges map[string]*Challenge
+	dependents map[string][]string // id -> challenges listing it in unlock.after
+}
+
+// NewGraph checks the unlock rules of cs against each other: every
+// prerequisite must exist and every challenge must be unlockable,
+// which rules out cycles
+func NewGraph(cs []*Challenge) (*Graph, error) {
+	g := &Graph{challenges: make(map[string]*Challenge), dependents: make(map[string][]string)}
+	var errs []error
+	for _, c := range cs {
+		if _, dup := g.challenges[c.Id]; dup {
+			errs = append(errs, graphError(c, "id", ErrInvalidChallenge, "duplicate challenge id %q", c.Id))
+			continue
+		}
+		g.challenges[c.Id] = c
+	}
+	for _, c := range cs {
+		if c.Unlock == nil {
+			continue
+		}
+		for i, id := range c.Unlock.After {
+			if _, ok := g.challenges[id]; !ok {
+				errs = append(errs, graphError(c, fmt.Sprintf("unlock.after[%d]", i), ErrUnknownPrerequisite, "no challenge %q", id))
+				continue
+			}
+			g.dependents[id] = append(g.dependents[id], c.Id)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// solve everything that can be, whatever is left is locked forever
+	solvable := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for id := range g.challenges {
+			if !solvable[id] && g.Unlocked(id, solvable) {
+				solvable[id], changed = true, true
+			}
+		}
+	}
+	for _, id := range g.ids() {
+		if solvable[id] {
+			continue
+		}
+		c := g.challenges[id]
+		if cycle := g.cycle(id, solvable); cycle != nil {
+			errs = append(errs, graphError(c, "unlock.after", ErrNeverUnlocked, "unlock cycle %s", strings.Join(cycle, " -> ")))
+		} else {
+			errs = append(errs, graphError(c, "unlock", ErrNeverUnlocked, "its prerequisites cannot all be solved"))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return g, nil
+}
+
+func graphError(c *Challenge, key string, err error, format string, args ...any) error {
+	return &env.ConfigError{Path: c.spec, Key: key, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// cycle returns a cycle of unlock.after edges through id
+// among the challenges that are not solvable, if there is one
+func (g *Graph) cycle(id string, solvable map[string]bool) []string {
+	var path []string
+	onPath := make(map[string]bool)
+	var visit func(cur string) []string
+	visit = func(cur string) []string {
+		if cur == id && len(path) > 0 {
+			return append(slices.Clone(path), id)
+		}
+		if onPath[cur] || solvable[cur] {
+			return nil
+		}
+		onPath[cur] = true
+		path = append(path, cur)
+		if u := g.challenges[cur].Unlock; u != nil {
+			for _, next := range u.After {
+				if found := visit(next); found != nil {
+					return found
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return nil
+	}
+	return visit(id)
+}
+
+func (g *Graph) ids() []string {
+	ids := make([]string, 0, len(g.challenges))
+	for id := range g.challenges {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Get returns challenge id
+func (g *Graph) Get(id string) (*Challenge, bool) {
+	c, ok := g.challenges[id]
+	return c, ok
+}
+
+// Challenges returns every challenge, sorted by id
+func (g *Graph) Challenges() []*Challenge {
+	out := make([]*Challenge, 0, len(g.challenges))
+	for _, id := range g.ids() {
+		out = append(out, g.challenges[id])
+	}
+	return out
+}
+
+// Unlocked tells if a team that solved the challenges in solved
+// may see and submit challenge id
+func (g *Graph) Unlocked(id string, solved map[string]bool) bool {
+	c, ok := g.challenges[id]
+	if !ok {
+		return false
+	}
+	u := c.Unlock
+	if u == nil {
+		return true
+	}
+
+	if len(u.After) > 0 {
+		met := 0
+		for _, req := range u.After {
+			if solved[req] {
+				met++
+			}
+		}
+		if (u.Any && met == 0) || (!u.Any && met < len(u.After)) {
+			return false
+		}
+	}
+	for category, n := range u.Categories {
+		count := 0
+		for sid, ok := range solved {
+			if s, known := g.challenges[sid]; ok && known && sid != id && s.Category == category {
+				count++
+			}
+		}
+		if count < n {
+			return false
+		}
+	}
+	return true
+}
+
+// Visible returns the challenges a team that solved the challenges
+// in solved may see, sorted by id
+func (g *Graph) Visible(solved map[string]bool) []string {
+	var out []string
+	for _, id := range g.ids() {
+		if g.Unlocked(id, solved) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Dependents returns the challenges listing id in unlock.after
+func (g *Graph) Dependents(id string) []string {
+	return slices.Sorted(slices.Values(g.dependents[id]))
+}
+
+// LoadAll loads every bundle below root and checks their unlock graph
+func LoadAll(root string) (*Graph, error) {
+	var (
+		cs   []*Challenge
+		errs []error
+	)
+	err := filepath.WalkDir(root, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if _, err := SpecPath(pth); err != nil {
+			return nil
+		}
+		c, err := Load(pth)
+		if err != nil {
+			errs = append(errs, Problems(err)...)
+		} else {
+			cs = append(cs, c)
+		}
+		return filepath.SkipDir // bundles do not nest
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return NewGraph(cs)
+}
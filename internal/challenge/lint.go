@@ -0,0 +1,388 @@
+package challenge
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/lattesec/ctfjx/internal/flags"
+)
+
+const DEFAULT_MAX_ATTACHMENT_SIZE = 50 * env.MiB
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Lint rules, a finding's Rule
+const (
+	RULE_SYNTAX                  = "syntax"
+	RULE_INVALID                 = "invalid"
+	RULE_MISSING_FLAG            = "missing-flag"
+	RULE_FLAG_FORMAT             = "flag-format"
+	RULE_BAD_PORT                = "bad-port"
+	RULE_PORT_NOT_EXPOSED        = "port-not-exposed"
+	RULE_UNREACHABLE_HEALTHCHECK = "unreachable-healthcheck"
+	RULE_NO_HEALTHCHECK          = "no-healthcheck"
+	RULE_MISSING_FILE            = "missing-file"
+	RULE_OVERSIZED_ATTACHMENT    = "oversized-attachment"
+	RULE_NO_DESCRIPTION          = "no-description"
+	RULE_UNLOCK                  = "unlock"
+)
+
+// Finding is a problem Lint found in a bundle
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Path     string   `json:"path"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Key      string   `json:"key,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	ce := env.ConfigError{Path: f.Path, Line: f.Line, Column: f.Column, Key: f.Key, Msg: f.Message}
+	return fmt.Sprintf("%s: %s [%s]", f.Severity, ce.Error(), f.Rule)
+}
+
+// LintOptions tune Lint, the zero value uses the defaults
+type LintOptions struct {
+	MaxAttachmentSize env.ByteSize   // DEFAULT_MAX_ATTACHMENT_SIZE if 0
+	FlagFormat        *regexp.Regexp // static flags not matching it are warned about
+}
+
+// LintReport is the result of linting a bundle
+type LintReport struct {
+	Dir      string    `json:"dir"`
+	Id       string    `json:"id,omitempty"`
+	Findings []Finding `json:"findings"`
+}
+
+// Failed tells if any finding is an error
+func (r LintReport) Failed() bool {
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool { return f.Severity == SeverityError })
+}
+
+// Lint checks the bundle in dir beyond what Load validates,
+// e.g. attachment sizes and ports the image does not expose.
+// It reports every problem it finds instead of stopping at the first.
+func Lint(dir string, opts LintOptions) LintReport {
+	if opts.MaxAttachmentSize == 0 {
+		opts.MaxAttachmentSize = DEFAULT_MAX_ATTACHMENT_SIZE
+	}
+	r := LintReport{Dir: dir, Findings: []Finding{}}
+
+	pth, err := SpecPath(dir)
+	if err != nil {
+		if errors.Is(err, ErrNoChallenge) {
+			err = ErrNoChallenge
+		}
+		r.Findings = append(r.Findings, Finding{Severity: SeverityError, Rule: RULE_MISSING_FILE, Path: dir, Message: err.Error()})
+		return r
+	}
+	data, err := os.ReadFile(pth)
+	if err != nil {
+		r.Findings = append(r.Findings, Finding{Severity: SeverityError, Rule: RULE_MISSING_FILE, Path: pth, Message: err.Error()})
+		return r
+	}
+	c, err := Decode(pth, data)
+	if err != nil {
+		r.add(SeverityError, RULE_SYNTAX, err)
+		return r
+	}
+	r.Id = c.Id
+
+	if err := c.Validate(); err != nil {
+		for _, p := range Problems(withPath(pth, err)) {
+			r.add(SeverityError, ruleOf(p), p)
+		}
+	}
+	for _, p := range Problems(c.CheckFiles()) {
+		r.add(SeverityError, RULE_MISSING_FILE, p)
+	}
+	c.lintFlag(&r, opts)
+	c.lintAttachments(&r, opts)
+	c.lintPorts(&r)
+	c.lintHealthcheck(&r)
+	if strings.TrimSpace(c.Description) == "" {
+		r.warn(RULE_NO_DESCRIPTION, c.spec, "description", "players get no description")
+	}
+
+	locate(pth, data, r.Findings)
+	slices.SortStableFunc(r.Findings, func(a, b Finding) int { return a.Line - b.Line })
+	return r
+}
+
+// LintAll lints the bundles in dirs, and their unlock graph.
+// Prerequisites outside of dirs are only warned about.
+func LintAll(dirs []string, opts LintOptions) []LintReport {
+	reports := make([]LintReport, len(dirs))
+	var cs []*Challenge
+	bySpec := make(map[string]int) // spec -> index in reports
+	for i, dir := range dirs {
+		reports[i] = Lint(dir, opts)
+		if reports[i].Failed() {
+			continue
+		}
+		if c, err := Load(dir); err == nil {
+			cs = append(cs, c)
+			bySpec[c.spec] = i
+		}
+	}
+
+	_, err := NewGraph(cs)
+	for _, p := range Problems(err) {
+		var ce *env.ConfigError
+		if !errors.As(p, &ce) {
+			continue
+		}
+		i, ok := bySpec[ce.Path]
+		if !ok {
+			continue
+		}
+		sev := SeverityError
+		if errors.Is(p, ErrUnknownPrerequisite) {
+			sev = SeverityWarning
+		}
+		reports[i].add(sev, RULE_UNLOCK, p)
+		if data, err := os.ReadFile(ce.Path); err == nil {
+			locate(ce.Path, data, reports[i].Findings)
+		}
+		slices.SortStableFunc(reports[i].Findings, func(a, b Finding) int { return a.Line - b.Line })
+	}
+	return reports
+}
+
+func (r *LintReport) add(sev Severity, rule string, err error) {
+	f := Finding{Severity: sev, Rule: rule, Message: err.Error()}
+	var ce *env.ConfigError
+	if errors.As(err, &ce) {
+		f.Path, f.Line, f.Column, f.Key, f.Message = ce.Path, ce.Line, ce.Column, ce.Key, ce.Msg
+	}
+	r.Findings = append(r.Findings, f)
+}
+
+func (r *LintReport) error(rule, pth, key, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Severity: SeverityError, Rule: rule, Path: pth, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *LintReport) warn(rule, pth, key, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Severity: SeverityWarning, Rule: rule, Path: pth, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// ruleOf names the rule a validation failure breaks
+func ruleOf(err error) string {
+	var ce *env.ConfigError
+	if !errors.As(err, &ce) {
+		return RULE_INVALID
+	}
+	switch {
+	case ce.Key == "flag" || strings.HasPrefix(ce.Key, "flag."):
+		return RULE_MISSING_FLAG
+	case strings.HasPrefix(ce.Key, "deploy.ports"):
+		return RULE_BAD_PORT
+	case strings.HasPrefix(ce.Key, "healthcheck"):
+		return RULE_UNREACHABLE_HEALTHCHECK
+	}
+	return RULE_INVALID
+}
+
+func (c *Challenge) lintFlag(r *LintReport, opts LintOptions) {
+	if c.Flag.File == "" {
+		if c.Flag.Type != FlagRegex && opts.FlagFormat != nil && c.Flag.Value != "" && !opts.FlagFormat.MatchString(sampleFlag(c.Flag.Value)) {
+			r.warn(RULE_FLAG_FORMAT, c.spec, "flag.value", "flag does not match %s", opts.FlagFormat)
+		}
+		return
+	}
+	flag, err := c.FlagValue()
+	switch {
+	case err != nil:
+		// missing files are reported by CheckFiles
+	case flag == "":
+		r.error(RULE_MISSING_FLAG, c.spec, "flag.file", "%s is empty", c.Flag.File)
+	case c.Flag.Type != FlagRegex && opts.FlagFormat != nil && !opts.FlagFormat.MatchString(sampleFlag(flag)):
+		r.warn(RULE_FLAG_FORMAT, c.spec, "flag.file", "flag in %s does not match %s", c.Flag.File, opts.FlagFormat)
+	}
+}
+
+// sampleFlag fills the placeholder of dynamic flags, static ones
+// have none
+func sampleFlag(value string) string {
+	return strings.ReplaceAll(value, flags.PLACEHOLDER, strings.Repeat("0", flags.HMAC_LEN))
+}
+
+func (c *Challenge) lintAttachments(r *LintReport, opts LintOptions) {
+	for i, a := range c.Attachments {
+		pth, err := c.Path(a.Path)
+		if err != nil {
+			continue
+		}
+		size, err := diskUsage(pth)
+		if err != nil {
+			continue
+		}
+		if size > opts.MaxAttachmentSize.Int64() {
+			r.error(RULE_OVERSIZED_ATTACHMENT, c.spec, fmt.Sprintf("attachments[%d].path", i),
+				"%s is %s, more than %s", a.Path, env.ByteSize(size), opts.MaxAttachmentSize)
+		}
+	}
+}
+
+// diskUsage sums the sizes of the files under pth
+func diskUsage(pth string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(pth, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// lintPorts warns about declared ports the Dockerfile does not EXPOSE,
+// when it exposes any
+func (c *Challenge) lintPorts(r *LintReport) {
+	if c.Deploy == nil || c.Deploy.Build == "" {
+		return
+	}
+	pth, err := c.Path(filepath.Join(c.Deploy.Build, "Dockerfile"))
+	if err != nil {
+		return
+	}
+	exposed, err := dockerfileExposes(pth)
+	if err != nil || len(exposed) == 0 {
+		return
+	}
+	for i, p := range c.Deploy.Ports {
+		transport := p.Protocol
+		if transport == PROTOCOL_HTTP {
+			transport = PROTOCOL_TCP
+		}
+		if !exposed[fmt.Sprintf("%d/%s", p.Port, transport)] {
+			r.warn(RULE_PORT_NOT_EXPOSED, c.spec, fmt.Sprintf("deploy.ports[%d].port", i),
+				"%d/%s is not exposed by %s", p.Port, transport, filepath.ToSlash(filepath.Join(c.Deploy.Build, "Dockerfile")))
+		}
+	}
+}
+
+// dockerfileExposes returns the port/protocol pairs of EXPOSE instructions
+func dockerfileExposes(pth string) (map[string]bool, error) {
+	f, err := os.Open(pth)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	exposed := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "EXPOSE") {
+			continue
+		}
+		for _, p := range fields[1:] {
+			port, proto, _ := strings.Cut(p, "/")
+			if proto == "" {
+				proto = PROTOCOL_TCP
+			}
+			if _, err := strconv.Atoi(port); err == nil {
+				exposed[port+"/"+strings.ToLower(proto)] = true
+			}
+		}
+	}
+	return exposed, sc.Err()
+}
+
+func (c *Challenge) lintHealthcheck(r *LintReport) {
+	h := c.Healthcheck
+	if h == nil {
+		if c.Deploy != nil && c.Deploy.Type != DeployStatic {
+			r.warn(RULE_NO_HEALTHCHECK, c.spec, "deploy", "broken instances will not be noticed without a healthcheck")
+		}
+		return
+	}
+	if h.Type != HealthcheckExec || len(h.Command) == 0 {
+		return
+	}
+	// scripts shipped with the bundle have to be there
+	script := h.Command[0]
+	if !strings.HasPrefix(script, "./") {
+		return
+	}
+	pth, err := c.Path(script)
+	if err != nil {
+		r.error(RULE_UNREACHABLE_HEALTHCHECK, c.spec, "healthcheck.command", "%s is outside the challenge", script)
+		return
+	}
+	if info, err := os.Stat(pth); err != nil {
+		r.error(RULE_UNREACHABLE_HEALTHCHECK, c.spec, "healthcheck.command", "%s does not exist", script)
+	} else if info.Mode()&0o111 == 0 && filepath.Separator == '/' {
+		r.error(RULE_UNREACHABLE_HEALTHCHECK, c.spec, "healthcheck.command", "%s is not executable", script)
+	}
+}
+
+// locate fills in the position of findings in the spec
+// which only know their key
+func locate(pth string, data []byte, findings []Finding) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return
+	}
+	for i, f := range findings {
+		if f.Line != 0 || f.Key == "" || f.Path != pth {
+			continue
+		}
+		// fall back to the closest parent that is in the file
+		for key := f.Key; key != ""; key = parentKey(key) {
+			if node := lookup(file, key); node != nil {
+				pos := node.GetToken().Position
+				findings[i].Line, findings[i].Column = pos.Line, pos.Column
+				break
+			}
+		}
+	}
+}
+
+func lookup(file *ast.File, key string) ast.Node {
+	p, err := yaml.PathString("$." + key)
+	if err != nil {
+		return nil
+	}
+	node, err := p.FilterFile(file)
+	if err != nil {
+		return nil
+	}
+	return node
+}
+
+// parentKey returns the parent of key, e.g. deploy.ports for deploy.ports[1]
+func parentKey(key string) string {
+	i := strings.LastIndexAny(key, ".[")
+	if i < 0 {
+		return ""
+	}
+	return key[:i]
+}
@@ -0,0 +1,235 @@
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/lattesec/ctfjx/internal/flags"
+)
+
+// also accepted, in this order, if there is no FILENAME
+var altFilenames = []string{"challenge.yaml"}
+
+// SpecPath returns the challenge.yml of the bundle in dir
+func SpecPath(dir string) (string, error) {
+	for _, name := range append([]string{FILENAME}, altFilenames...) {
+		pth := filepath.Join(dir, name)
+		if _, err := os.Stat(pth); err == nil {
+			return pth, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w in %s", ErrNoChallenge, dir)
+}
+
+// Load parses and validates the bundle in dir,
+// including that the files it references exist
+func Load(dir string) (*Challenge, error) {
+	pth, err := SpecPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(pth, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.CheckFiles(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Parse parses and validates the challenge.yml at pth, read as data.
+// Unknown fields are errors, and so are all validation failures,
+// joined as *env.ConfigError.
+func Parse(pth string, data []byte) (*Challenge, error) {
+	c, err := Decode(pth, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, withPath(pth, err)
+	}
+	return c, nil
+}
+
+// Decode parses the challenge.yml at pth and fills in defaults,
+// without validating it
+func Decode(pth string, data []byte) (*Challenge, error) {
+	c := &Challenge{}
+	if err := yaml.UnmarshalWithOptions(data, c, yaml.Strict()); err != nil {
+		return nil, env.DescribeError(pth, data, err)
+	}
+	c.Dir, c.spec = filepath.Dir(pth), pth
+	c.setDefaults()
+	return c, nil
+}
+
+func (c *Challenge) setDefaults() {
+	if c.Version == 0 {
+		c.Version = SPEC_VERSION
+	}
+	if c.Id == "" && c.Dir != "" {
+		c.Id = strings.ToLower(filepath.Base(c.Dir))
+	}
+	if c.Flag.Type == "" {
+		c.Flag.Type = FlagStatic
+	}
+	if c.Flag.Type == FlagDynamic {
+		if c.Flag.Per == "" {
+			c.Flag.Per = FlagPerTeam
+		}
+		if c.Flag.Env == "" {
+			c.Flag.Env = flags.DEFAULT_ENV
+		}
+	}
+	if c.Author != "" && !slices.Contains(c.Authors, c.Author) {
+		c.Authors = append([]string{c.Author}, c.Authors...)
+	}
+	c.Category = strings.ToLower(strings.TrimSpace(c.Category))
+	c.Difficulty = Difficulty(strings.ToLower(string(c.Difficulty)))
+	tags := c.Tags[:0]
+	for _, tag := range c.Tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	c.Tags = tags
+	for i, a := range c.Attachments {
+		if a.Name == "" {
+			c.Attachments[i].Name = filepath.Base(a.Path)
+		}
+		c.Attachments[i].SHA256 = strings.ToLower(strings.TrimSpace(a.SHA256))
+	}
+	if d := c.Deploy; d != nil {
+		if d.Type == "" {
+			switch {
+			case d.Image != "" || d.Build != "":
+				d.Type = DeployImage
+			case d.Compose != "":
+				d.Type = DeployCompose
+			case d.Static != "":
+				d.Type = DeployStatic
+			}
+		}
+		for i, p := range d.Ports {
+			if p.Protocol == "" {
+				d.Ports[i].Protocol = PROTOCOL_TCP
+			}
+		}
+		if d.Instances == 0 {
+			d.Instances = 1
+		}
+	}
+	if h := c.Healthcheck; h != nil {
+		if h.Port == 0 && c.Deploy != nil && len(c.Deploy.Ports) > 0 && h.Type != HealthcheckExec {
+			h.Port = c.Deploy.Ports[0].Port
+		}
+		if h.Interval == 0 {
+			h.Interval = DEFAULT_HEALTHCHECK_INTERVAL
+		}
+		if h.Timeout == 0 {
+			h.Timeout = DEFAULT_HEALTHCHECK_TIMEOUT
+		}
+		if h.Retries == 0 {
+			h.Retries = DEFAULT_HEALTHCHECK_RETRIES
+		}
+		if h.Escalate == 0 {
+			h.Escalate = DEFAULT_HEALTHCHECK_ESCALATE
+		}
+	}
+	if s := c.Solve; s != nil {
+		if s.Port == 0 && c.Deploy != nil && len(c.Deploy.Ports) > 0 {
+			s.Port = c.Deploy.Ports[0].Port
+		}
+		if s.Timeout == 0 {
+			s.Timeout = DEFAULT_SOLVE_TIMEOUT
+		}
+	}
+}
+
+// SpecFile returns the path of the challenge.yml c was loaded from
+func (c *Challenge) SpecFile() string {
+	return c.spec
+}
+
+// Path resolves rel, a path from the spec, in the bundle's directory
+func (c *Challenge) Path(rel string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf("%w: %q is outside the challenge", ErrInvalidChallenge, rel)
+	}
+	return filepath.Join(c.Dir, filepath.FromSlash(rel)), nil
+}
+
+// FlagValue returns the flag's value, reading it from its file if set
+func (c *Challenge) FlagValue() (string, error) {
+	if c.Flag.File == "" {
+		return c.Flag.Value, nil
+	}
+	pth, err := c.Path(c.Flag.File)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(pth)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// FlagSpec returns what the flags package checks submissions with
+func (c *Challenge) FlagSpec() (flags.Spec, error) {
+	value, err := c.FlagValue()
+	if err != nil {
+		return flags.Spec{}, err
+	}
+	return flags.Spec{Type: c.Flag.Type, Value: value, CaseInsensitive: c.Flag.CaseInsensitive}, nil
+}
+
+// CheckFiles checks that every file the spec references exists
+func (c *Challenge) CheckFiles() error {
+	var errs []error
+	check := func(key, rel string, dir bool) {
+		if rel == "" {
+			return
+		}
+		pth, err := c.Path(rel)
+		if err != nil {
+			return // reported by Validate
+		}
+		info, err := os.Stat(pth)
+		switch {
+		case err != nil:
+			errs = append(errs, invalid(key, "%s does not exist", rel))
+		case dir && !info.IsDir():
+			errs = append(errs, invalid(key, "%s is not a directory", rel))
+		}
+	}
+
+	check("flag.file", c.Flag.File, false)
+	for i, a := range c.Attachments {
+		check(fmt.Sprintf("attachments[%d].path", i), a.Path, false)
+	}
+	if d := c.Deploy; d != nil {
+		check("deploy.build", d.Build, true)
+		check("deploy.compose", d.Compose, false)
+		check("deploy.static", d.Static, true)
+		if d.Build != "" {
+			check("deploy.build", path.Join(d.Build, "Dockerfile"), false)
+		}
+	}
+	return withPath(c.spec, errors.Join(errs...))
+}
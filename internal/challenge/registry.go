@@ -0,0 +1,132 @@
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/store"
+)
+
+// Build is a challenge turned into what gets deployed
+// and handed out, see the build package
+type Build struct {
+	Id      string    `json:"id"`
+	Version string    `json:"version"` // changes whenever anything deployed or handed out does
+	Source  string    `json:"source"`  // the bundle's directory
+	BuiltAt time.Time `json:"built_at"`
+
+	Challenge   Challenge         `json:"challenge"`
+	Image       string            `json:"image,omitempty"`  // for image deployments
+	Bundle      *artifacts.Bundle `json:"bundle,omitempty"` // the files of compose and static deployments
+	Attachments []BuiltAttachment `json:"attachments,omitempty"`
+}
+
+// BuiltAttachment is an attachment stored in the artifact store,
+// directories archived as zip files
+type BuiltAttachment struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"` // also its checksum
+	Size   int64  `json:"size"`
+}
+
+// SHA256 returns the hex checksum of a
+func (a BuiltAttachment) SHA256() string {
+	return strings.TrimPrefix(a.Digest, "sha256:")
+}
+
+var ErrUnknownVersion = errors.New("unknown challenge version")
+
+// Registry holds the current build of every challenge,
+// and every version it had
+type Registry struct {
+	builds  *store.Collection[Build]
+	history *store.Collection[Build] // by <id>@<version>
+	gen     atomic.Uint64
+}
+
+// OpenRegistry loads the registry persisted at pth, with its
+// history next to it, or a memory-only one if empty
+func OpenRegistry(pth string) (*Registry, error) {
+	builds, err := store.Open[Build](pth)
+	if err != nil {
+		return nil, err
+	}
+	historyPath := ""
+	if pth != "" {
+		ext := filepath.Ext(pth)
+		historyPath = strings.TrimSuffix(pth, ext) + ".history" + ext
+	}
+	history, err := store.Open[Build](historyPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{builds: builds, history: history}, nil
+}
+
+// Put makes b the current build of its challenge
+func (r *Registry) Put(b Build) error {
+	if err := r.history.Put(b.Id+"@"+b.Version, b); err != nil {
+		return err
+	}
+	defer r.gen.Add(1)
+	return r.builds.Put(b.Id, b)
+}
+
+// Generation changes whenever a build is put or deleted, to cache
+// what is derived from the builds
+func (r *Registry) Generation() uint64 {
+	return r.gen.Load()
+}
+
+// Versions returns every build challenge id had, oldest first
+func (r *Registry) Versions(id string) []Build {
+	var out []Build
+	for _, b := range r.history.List() {
+		if b.Id == id {
+			out = append(out, b)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Build) int { return a.BuiltAt.Compare(b.BuiltAt) })
+	return out
+}
+
+// Version returns the build of challenge id at version
+func (r *Registry) Version(id, version string) (Build, error) {
+	b, ok := r.history.Get(id + "@" + version)
+	if !ok {
+		return Build{}, fmt.Errorf("%w: %s@%s", ErrUnknownVersion, id, version)
+	}
+	return b, nil
+}
+
+func (r *Registry) Get(id string) (Build, bool) {
+	return r.builds.Get(id)
+}
+
+// List returns every build, sorted by challenge id
+func (r *Registry) List() []Build {
+	return r.builds.List()
+}
+
+// Delete forgets challenge id and its history
+func (r *Registry) Delete(id string) error {
+	err := r.history.Update(func(items map[string]Build) error {
+		for k, b := range items {
+			if b.Id == id {
+				delete(items, k)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer r.gen.Add(1)
+	return r.builds.Delete(id)
+}
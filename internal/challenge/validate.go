@@ -0,0 +1,282 @@
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/lattesec/ctfjx/internal/flags"
+)
+
+var idRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]{0,62}[a-z0-9])?$`)
+
+// invalid is a validation failure of the field at key,
+// e.g. deploy.ports[0].port
+func invalid(key, format string, args ...any) error {
+	return &env.ConfigError{Key: key, Msg: fmt.Sprintf(format, args...), Err: ErrInvalidChallenge}
+}
+
+// withPath sets the file of the validation failures in err
+func withPath(pth string, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, e := range Problems(err) {
+		var ce *env.ConfigError
+		if errors.As(e, &ce) {
+			ce.Path = pth
+		}
+	}
+	return err
+}
+
+// Problems splits an error of Parse, Load or Validate
+// into its validation failures
+func Problems(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// Validate checks the spec, all failures are joined as *env.ConfigError
+func (c *Challenge) Validate() error {
+	var errs []error
+	add := func(err error) { errs = append(errs, err) }
+	local := func(key, rel string) {
+		if rel != "" && !filepath.IsLocal(filepath.FromSlash(rel)) {
+			add(invalid(key, "%s is outside the challenge", rel))
+		}
+	}
+
+	if c.Version < 0 || c.Version > SPEC_VERSION {
+		add(invalid("version", "unsupported version %d, at most %d", c.Version, SPEC_VERSION))
+	}
+	if !idRe.MatchString(c.Id) {
+		add(invalid("id", "%q must be lowercase letters, digits, - and _", c.Id))
+	}
+	if strings.TrimSpace(c.Name) == "" {
+		add(invalid("name", "is required"))
+	}
+	if strings.TrimSpace(c.Category) == "" {
+		add(invalid("category", "is required"))
+	}
+	if c.Points < 0 {
+		add(invalid("points", "must not be negative"))
+	}
+	if sc := c.Scoring; sc != nil {
+		if err := sc.Validate(); err != nil {
+			add(invalid("scoring", "%v", err))
+		} else if sc.Minimum > c.Points {
+			add(invalid("scoring.minimum", "%d is above the %d points", sc.Minimum, c.Points))
+		}
+	}
+	if c.Difficulty != "" && c.Difficulty.Rank() == 0 {
+		add(invalid("difficulty", "unknown difficulty %q, one of %v", c.Difficulty, difficulties))
+	}
+	for i, author := range c.Authors {
+		if strings.TrimSpace(author) == "" {
+			add(invalid(fmt.Sprintf("authors[%d]", i), "must not be empty"))
+		}
+	}
+
+	switch {
+	case c.Flag.Value == "" && c.Flag.File == "":
+		add(invalid("flag", "value or file is required"))
+	case c.Flag.Value != "" && c.Flag.File != "":
+		add(invalid("flag", "only one of value and file can be set"))
+	}
+	local("flag.file", c.Flag.File)
+	switch c.Flag.Type {
+	case FlagStatic:
+	case FlagRegex, FlagDynamic:
+		spec := flags.Spec{Type: c.Flag.Type, Value: c.Flag.Value, CaseInsensitive: c.Flag.CaseInsensitive}
+		if err := spec.Validate(); c.Flag.Value != "" && err != nil {
+			add(invalid("flag.value", "%v", err))
+		}
+	default:
+		add(invalid("flag.type", "unknown type %q", c.Flag.Type))
+	}
+	if c.Flag.Type == FlagDynamic {
+		if c.Deploy == nil || !c.Deploy.PerTeam {
+			add(invalid("flag.type", "dynamic flags need deploy.per_team"))
+		}
+		if c.Flag.Per != FlagPerTeam && c.Flag.Per != FlagPerInstance {
+			add(invalid("flag.per", "must be %s or %s", FlagPerTeam, FlagPerInstance))
+		}
+		if c.Flag.Path != "" && !path.IsAbs(c.Flag.Path) {
+			add(invalid("flag.path", "must be absolute"))
+		}
+	}
+
+	names := make(map[string]bool, len(c.Attachments))
+	for i, a := range c.Attachments {
+		key := fmt.Sprintf("attachments[%d]", i)
+		if a.Path == "" {
+			add(invalid(key+".path", "is required"))
+		}
+		local(key+".path", a.Path)
+		if a.SHA256 != "" && !artifacts.ValidDigest("sha256:"+a.SHA256) {
+			add(invalid(key+".sha256", "must be 64 hex characters"))
+		}
+		if names[a.Name] {
+			add(invalid(key+".name", "duplicate attachment %q", a.Name))
+		}
+		names[a.Name] = true
+	}
+
+	if c.Deploy != nil {
+		errs = append(errs, c.Deploy.validate()...)
+	}
+	if c.Healthcheck != nil {
+		errs = append(errs, c.validateHealthcheck()...)
+	}
+	if c.Unlock != nil {
+		errs = append(errs, c.validateUnlock()...)
+	}
+	if s := c.Solve; s != nil {
+		if len(s.Command) == 0 {
+			add(invalid("solve.command", "is required"))
+		}
+		if s.Port != 0 && (c.Deploy == nil || !slices.ContainsFunc(c.Deploy.Ports, func(p Port) bool { return p.Port == s.Port })) {
+			add(invalid("solve.port", "%d is not a declared port", s.Port))
+		}
+		if s.Timeout < 0 {
+			add(invalid("solve.timeout", "must not be negative"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Deploy) validate() []error {
+	var errs []error
+	add := func(err error) { errs = append(errs, err) }
+
+	sources := 0
+	for _, src := range []string{d.Image, d.Build, d.Compose, d.Static} {
+		if src != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		add(invalid("deploy", "exactly one of image, build, compose and static is required"))
+	}
+	for _, src := range []struct{ key, rel string }{
+		{"deploy.build", d.Build}, {"deploy.compose", d.Compose}, {"deploy.static", d.Static},
+	} {
+		if src.rel != "" && !filepath.IsLocal(filepath.FromSlash(src.rel)) {
+			add(invalid(src.key, "%s is outside the challenge", src.rel))
+		}
+	}
+	switch d.Type {
+	case DeployImage:
+		if d.Compose != "" || d.Static != "" {
+			add(invalid("deploy.type", "image deployments need image or build"))
+		}
+	case DeployCompose:
+		if d.Compose == "" {
+			add(invalid("deploy.type", "compose deployments need compose"))
+		}
+	case DeployStatic:
+		if d.Static == "" {
+			add(invalid("deploy.type", "static deployments need static"))
+		}
+	default:
+		add(invalid("deploy.type", "unknown type %q", d.Type))
+	}
+
+	seen := make(map[string]bool, len(d.Ports))
+	for i, p := range d.Ports {
+		key := fmt.Sprintf("deploy.ports[%d]", i)
+		if p.Port < 1 || p.Port > 65535 {
+			add(invalid(key+".port", "%d is not a port", p.Port))
+		}
+		if !slices.Contains([]string{PROTOCOL_TCP, PROTOCOL_UDP, PROTOCOL_HTTP}, p.Protocol) {
+			add(invalid(key+".protocol", "unknown protocol %q", p.Protocol))
+		}
+		// http is served over tcp
+		transport := p.Protocol
+		if transport == PROTOCOL_HTTP {
+			transport = PROTOCOL_TCP
+		}
+		id := fmt.Sprintf("%d/%s", p.Port, transport)
+		if seen[id] {
+			add(invalid(key, "port %s is declared twice", id))
+		}
+		seen[id] = true
+	}
+	if d.Type == DeployStatic && len(d.Ports) > 0 {
+		add(invalid("deploy.ports", "static deployments are served by ctfjx"))
+	}
+	if d.Instances < 0 {
+		add(invalid("deploy.instances", "must not be negative"))
+	}
+	if d.Limits.CPUs < 0 || d.Limits.Memory < 0 || d.Limits.Pids < 0 || d.Limits.Disk < 0 {
+		add(invalid("deploy.limits", "must not be negative"))
+	}
+	return errs
+}
+
+func (c *Challenge) validateHealthcheck() []error {
+	var errs []error
+	add := func(err error) { errs = append(errs, err) }
+	h := c.Healthcheck
+
+	switch h.Type {
+	case HealthcheckTCP, HealthcheckHTTP:
+		switch {
+		case c.Deploy == nil:
+			add(invalid("healthcheck", "%s healthchecks need a deployment", h.Type))
+		case c.Deploy.Type == DeployStatic:
+		case !slices.ContainsFunc(c.Deploy.Ports, func(p Port) bool { return p.Port == h.Port && p.Protocol != PROTOCOL_UDP }):
+			add(invalid("healthcheck.port", "%d is not a declared tcp or http port", h.Port))
+		}
+		if h.Type == HealthcheckHTTP && h.Path != "" && !strings.HasPrefix(h.Path, "/") {
+			add(invalid("healthcheck.path", "must start with /"))
+		}
+	case HealthcheckExec:
+		if len(h.Command) == 0 {
+			add(invalid("healthcheck.command", "is required"))
+		}
+	default:
+		add(invalid("healthcheck.type", "unknown type %q", h.Type))
+	}
+	if h.Interval < 0 || h.Timeout < 0 || h.Retries < 0 || h.Escalate < 0 {
+		add(invalid("healthcheck", "interval, timeout, retries and escalate must not be negative"))
+	}
+	if h.Timeout > h.Interval {
+		add(invalid("healthcheck.timeout", "must not be longer than the interval"))
+	}
+	return errs
+}
+
+func (c *Challenge) validateUnlock() []error {
+	var errs []error
+	u := c.Unlock
+	if len(u.After) == 0 && len(u.Categories) == 0 {
+		errs = append(errs, invalid("unlock", "needs after or categories"))
+	}
+	for i, id := range u.After {
+		switch {
+		case !idRe.MatchString(id):
+			errs = append(errs, invalid(fmt.Sprintf("unlock.after[%d]", i), "%q is not a challenge id", id))
+		case id == c.Id:
+			errs = append(errs, invalid(fmt.Sprintf("unlock.after[%d]", i), "a challenge cannot unlock itself"))
+		}
+	}
+	for category, n := range u.Categories {
+		if n < 1 {
+			errs = append(errs, invalid("unlock.categories."+category, "must be at least 1"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,192 @@
+package container
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ImageBuilder builds images and pushes them to a registry
+// agents pull from
+type ImageBuilder interface {
+	HasImage(ctx context.Context, image string) (bool, error)
+	// BuildImage builds the Dockerfile in dir as tag
+	BuildImage(ctx context.Context, dir, tag string, labels map[string]string) error
+	PushImage(ctx context.Context, image string) error
+}
+
+var (
+	_ ImageBuilder = (*Docker)(nil)
+	_ ImageBuilder = (*Containerd)(nil)
+)
+
+// WriteContext writes dir as a build context tar stream. Entries are
+// sorted and stripped of times and owners, so the same files always
+// produce the same stream.
+func WriteContext(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	// WalkDir walks in lexical order
+	err := filepath.WalkDir(dir, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil || pth == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, pth)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: filepath.ToSlash(rel), Mode: int64(info.Mode().Perm()), ModTime: time.Unix(0, 0), Format: tar.FormatPAX}
+		switch {
+		case d.IsDir():
+			hdr.Typeflag, hdr.Name = tar.TypeDir, hdr.Name+"/"
+			return tw.WriteHeader(hdr)
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(pth)
+			if err != nil {
+				return err
+			}
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, target
+			return tw.WriteHeader(hdr)
+		case !d.Type().IsRegular():
+			return nil
+		}
+
+		hdr.Typeflag, hdr.Size = tar.TypeReg, info.Size()
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(pth)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// WriteFiles writes files, absolute path -> content, as a tar stream
+// to extract at /, with their parent directories
+func WriteFiles(w io.Writer, files map[string]string) error {
+	tw := tar.NewWriter(w)
+	dirs := make(map[string]bool)
+	for _, pth := range slices.Sorted(maps.Keys(files)) {
+		name := strings.TrimPrefix(path.Clean(pth), "/")
+		for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	for _, dir := range slices.Sorted(maps.Keys(dirs)) {
+		hdr := &tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0o755, ModTime: time.Unix(0, 0), Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+	}
+	for _, pth := range slices.Sorted(maps.Keys(files)) {
+		content := files[pth]
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: strings.TrimPrefix(path.Clean(pth), "/"), Mode: 0o444, Size: int64(len(content)), ModTime: time.Unix(0, 0), Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// BuildImage sends dir as the build context of tag
+func (d *Docker) BuildImage(ctx context.Context, dir, tag string, labels map[string]string) error {
+	lbls, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	q := url.Values{"t": {tag}, "labels": {string(lbls)}, "rm": {"1"}, "forcerm": {"1"}}
+
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(WriteContext(pw, dir)) }()
+	defer pr.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.base+"/build?"+q.Encode(), pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+	return d.stream(req, "build "+tag)
+}
+
+// PushImage pushes image to its registry, with the engine's credentials
+func (d *Docker) PushImage(ctx context.Context, image string) error {
+	name, tag := splitImage(image)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.base+"/images/"+name+"/push?tag="+url.QueryEscape(tag), nil)
+	if err != nil {
+		return err
+	}
+	// required even when empty
+	req.Header.Set("X-Registry-Auth", base64.URLEncoding.EncodeToString([]byte("{}")))
+	return d.stream(req, "push "+image)
+}
+
+// stream sends req and waits for the end of its progress stream,
+// which reports failures in its messages rather than the status
+func (d *Docker) stream(req *http.Request, what string) error {
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		b, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%w: %s: %d %s", ErrRuntimeError, what, res.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&msg); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("%w: %s: %s", ErrRuntimeError, what, strings.TrimSpace(msg.Error))
+		}
+	}
+}
+
+func (c *Containerd) BuildImage(ctx context.Context, dir, tag string, labels map[string]string) error {
+	args := []string{"build", "--quiet", "--tag", tag}
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+	_, err := c.run(ctx, append(args, dir)...)
+	return err
+}
+
+func (c *Containerd) PushImage(ctx context.Context, image string) error {
+	_, err := c.run(ctx, "push", "--quiet", image)
+	return err
+}
@@ -0,0 +1,304 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/lattesec/ctfjx/internal/tasks"
+	"github.com/lattesec/log"
+)
+
+// The task verbs the daemon manages compose stacks with
+const (
+	VERB_COMPOSE_UP   = "compose-up"   // args: project, a JSON artifacts.Bundle, optionally the compose file in it
+	VERB_COMPOSE_DOWN = "compose-down" // args: project
+	VERB_COMPOSE_PS   = "compose-ps"   // args: project, prints the Stack
+)
+
+// The compose files looked for in a bundle, in order
+var COMPOSE_FILES = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+var ErrNoComposeFile = errors.New("no compose file in bundle")
+
+// Stack is the state of a compose project
+type Stack struct {
+	Project  string `json:"project"`
+	Health   Health `json:"health"` // healthy only if every service is
+	Services []Info `json:"services"`
+}
+
+// Compose runs multi-container challenges described by a compose file,
+// bringing each project up and down as a unit
+type Compose struct {
+	Command []string // e.g. docker compose
+	Dir     string   // where the bundles of the projects are written
+
+	// Swapped out in tests
+	run func(ctx context.Context, dir string, args ...string) ([]byte, error)
+}
+
+// NewCompose uses the compose command of runtime,
+// writing projects under dir
+func NewCompose(runtime, dir string) *Compose {
+	var cmd []string
+	switch runtime {
+	case RUNTIME_PODMAN:
+		cmd = []string{"podman", "compose"}
+	case RUNTIME_CONTAINERD:
+		cmd = []string{"nerdctl", "--namespace", DEFAULT_CONTAINERD_NAMESPACE, "compose"}
+	default:
+		cmd = []string{"docker", "compose"}
+	}
+	c := &Compose{Command: cmd, Dir: dir}
+	c.run = c.exec
+	return c
+}
+
+func (c *Compose) exec(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	args = append(c.Command[1:len(c.Command):len(c.Command)], args...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Command[0], args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: compose: %v: %s", ErrRuntimeError, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func (c *Compose) projectDir(project string) (string, error) {
+	if project == "" || project != filepath.Base(project) || strings.HasPrefix(project, ".") {
+		return "", fmt.Errorf("%w: invalid project %q", ErrInvalidSpec, project)
+	}
+	return filepath.Join(c.Dir, project), nil
+}
+
+// Up writes bundle b from store and brings its stack up as project.
+// file is the compose file in the bundle, found by name if empty.
+func (c *Compose) Up(ctx context.Context, store *artifacts.Store, project string, b artifacts.Bundle, file string) error {
+	dir, err := c.projectDir(project)
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		if file, err = findComposeFile(b); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := store.Materialize(b, dir); err != nil {
+		return err
+	}
+
+	_, err = c.run(ctx, dir, "--project-name", project, "--file", file, "up", "--detach", "--remove-orphans")
+	if err != nil {
+		return err
+	}
+	log.Info().
+		WithMeta("scope", "container").
+		WithMeta("project", project).
+		Msgf("compose stack %s is up", b.Name).Send()
+	return nil
+}
+
+func findComposeFile(b artifacts.Bundle) (string, error) {
+	for _, name := range COMPOSE_FILES {
+		for _, f := range b.Files {
+			if f.Path == name {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoComposeFile, b.Name)
+}
+
+// Down stops project and removes its containers, networks and volumes
+func (c *Compose) Down(ctx context.Context, project string) error {
+	dir, err := c.projectDir(project)
+	if err != nil {
+		return err
+	}
+	if _, err := c.run(ctx, dir, "--project-name", project, "down", "--volumes", "--remove-orphans"); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+type composeService struct {
+	ID       string `json:"ID"`
+	Name     string `json:"Name"`
+	Image    string `json:"Image"`
+	Service  string `json:"Service"`
+	State    string `json:"State"`
+	Health   string `json:"Health"`
+	ExitCode int    `json:"ExitCode"`
+}
+
+// Ps returns the state of every service of project
+func (c *Compose) Ps(ctx context.Context, project string) (Stack, error) {
+	dir, err := c.projectDir(project)
+	if err != nil {
+		return Stack{}, err
+	}
+	out, err := c.run(ctx, dir, "--project-name", project, "ps", "--all", "--format", "json")
+	if err != nil {
+		return Stack{}, err
+	}
+	services, err := parseComposePs(out)
+	if err != nil {
+		return Stack{}, err
+	}
+
+	stack := Stack{Project: project}
+	for _, s := range services {
+		info := Info{
+			Id:       s.ID,
+			Name:     s.Name,
+			Image:    s.Image,
+			Labels:   map[string]string{"com.docker.compose.service": s.Service},
+			State:    s.State,
+			Running:  s.State == "running",
+			Health:   HealthNone,
+			ExitCode: s.ExitCode,
+		}
+		if s.Health != "" {
+			info.Health = Health(s.Health)
+		}
+		stack.Services = append(stack.Services, info)
+	}
+	stack.Health = aggregateHealth(stack.Services)
+	return stack, nil
+}
+
+// parseComposePs reads both the JSON array of older compose
+// versions and the JSON lines of newer ones
+func parseComposePs(out []byte) ([]composeService, error) {
+	out = bytes.TrimSpace(out)
+	var services []composeService
+	if bytes.HasPrefix(out, []byte("[")) {
+		return services, json.Unmarshal(out, &services)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var s composeService
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, err
+		}
+		services = append(services, s)
+	}
+	return services, sc.Err()
+}
+
+// aggregateHealth is unhealthy if any service is down or unhealthy,
+// starting if any is starting and healthy otherwise
+func aggregateHealth(services []Info) Health {
+	if len(services) == 0 {
+		return HealthUnhealthy
+	}
+	health := HealthHealthy
+	for _, s := range services {
+		switch {
+		case !s.Running, s.Health == HealthUnhealthy:
+			return HealthUnhealthy
+		case s.Health == HealthStarting:
+			health = HealthStarting
+		}
+	}
+	return health
+}
+
+// RegisterComposeVerbs lets the daemon manage compose stacks through
+// signed tasks. Bundles must already be pushed to store.
+func RegisterComposeVerbs(e *tasks.Executor, c *Compose, store *artifacts.Store) {
+	e.RegisterVerb(VERB_COMPOSE_UP, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("%w: expected a project, a JSON bundle and optionally a compose file", ErrInvalidSpec)
+		}
+		var b artifacts.Bundle
+		if err := json.Unmarshal([]byte(args[1]), &b); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+		}
+		var file string
+		if len(args) == 3 {
+			file = args[2]
+		}
+		return c.Up(ctx, store, args[0], b, file)
+	})
+	e.RegisterVerb(VERB_COMPOSE_DOWN, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		return forEach(args, func(project string) error { return c.Down(ctx, project) })
+	})
+	e.RegisterVerb(VERB_COMPOSE_PS, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		if len(args) != 1 {
+			return fmt.Errorf("%w: expected a project", ErrInvalidSpec)
+		}
+		stack, err := c.Ps(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(stdout).Encode(stack)
+	})
+}
+
+// Projects returns the projects that have been brought up
+func (c *Compose) Projects() []string {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return nil
+	}
+	var projects []string
+	for _, e := range entries {
+		if e.IsDir() {
+			projects = append(projects, e.Name())
+		}
+	}
+	return projects
+}
+
+// AttachComposeReporter adds the compose projects of c and their
+// aggregate health to r's status reports, after those of AttachReporter
+func AttachComposeReporter(r *status.Reporter, c *Compose) {
+	instances, health := r.Instances, r.Health
+
+	r.Instances = func() []string {
+		var out []string
+		if instances != nil {
+			out = instances()
+		}
+		return append(out, c.Projects()...)
+	}
+	r.Health = func() map[string]string {
+		out := make(map[string]string)
+		if health != nil {
+			maps.Copy(out, health())
+		}
+		for _, project := range c.Projects() {
+			ctx, cancel := context.WithTimeout(context.Background(), REPORT_TIMEOUT)
+			stack, err := c.Ps(ctx, project)
+			cancel()
+			if err != nil {
+				stack.Health = HealthUnhealthy
+			}
+			out[project] = string(stack.Health)
+		}
+		return out
+	}
+}
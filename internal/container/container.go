@@ -0,0 +1,99 @@
+// Container package runs challenge containers on the agent.
+//
+// Deployments are driven by the daemon through signed tasks,
+// see RegisterVerbs.
+package container
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+const (
+	// Every container started by ctfjx carries this label
+	LABEL_MANAGED = "ctfjx.managed"
+
+	DEFAULT_STOP_TIMEOUT = 10 * time.Second
+)
+
+var (
+	ErrNotFound     = errors.New("container not found")
+	ErrInvalidSpec  = errors.New("invalid container spec")
+	ErrRuntimeError = errors.New("container runtime error")
+)
+
+// Limits restricts the resources of a container, zero means unlimited
+type Limits struct {
+	CPUs   float64 `json:"cpus,omitempty" yaml:"cpus,omitempty"`     // e.g. 0.5 for half a core
+	Memory int64   `json:"memory,omitempty" yaml:"memory,omitempty"` // bytes
+	Pids   int64   `json:"pids,omitempty" yaml:"pids,omitempty"`
+	Disk   int64   `json:"disk,omitempty" yaml:"disk,omitempty"` // bytes of writable layer, Docker and Podman only
+}
+
+// Port publishes a container port on the host
+type Port struct {
+	Container int    `json:"container"`
+	Host      int    `json:"host,omitempty"` // 0 picks a free port
+	HostIP    string `json:"host_ip,omitempty"`
+	Protocol  string `json:"protocol,omitempty"` // tcp (default) or udp
+}
+
+// Spec describes a container to deploy
+type Spec struct {
+	Name     string            `json:"name"`
+	Image    string            `json:"image"`
+	Cmd      []string          `json:"cmd,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Ports    []Port            `json:"ports,omitempty"`
+	Networks []string          `json:"networks,omitempty"` // the first one is the container's network mode
+	Limits   Limits            `json:"limits"`
+	Pull     bool              `json:"pull,omitempty"`    // pull even if the image is present
+	Isolate  bool              `json:"isolate,omitempty"` // on its own isolated network, see DeployIsolated
+	// Absolute path -> content of read-only files written into
+	// the container before it starts
+	Files map[string]string `json:"files,omitempty"`
+}
+
+func (s Spec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSpec)
+	}
+	if s.Image == "" {
+		return fmt.Errorf("%w: image is required", ErrInvalidSpec)
+	}
+	for pth := range s.Files {
+		if !path.IsAbs(pth) || path.Clean(pth) == "/" {
+			return fmt.Errorf("%w: file %q must be an absolute path", ErrInvalidSpec, pth)
+		}
+	}
+	return nil
+}
+
+// Health of a container, from its healthcheck if it has one
+type Health string
+
+const (
+	HealthNone      Health = "none" // no healthcheck
+	HealthStarting  Health = "starting"
+	HealthHealthy   Health = "healthy"
+	HealthUnhealthy Health = "unhealthy"
+)
+
+// Info is the state of a container
+type Info struct {
+	Id        string            `json:"id"`
+	Name      string            `json:"name"`
+	Image     string            `json:"image"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	State     string            `json:"state"` // created, running, exited, ...
+	Running   bool              `json:"running"`
+	Health    Health            `json:"health"`
+	ExitCode  int               `json:"exit_code"`
+	OOMKilled bool              `json:"oom_killed"`
+	StartedAt time.Time         `json:"started_at"`
+	Limits    Limits            `json:"limits"`
+	Ports     []Port            `json:"ports,omitempty"` // the published ports
+}
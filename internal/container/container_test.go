@@ -0,0 +1,454 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEngine implements the parts of the Docker Engine API the runtime uses
+type fakeEngine struct {
+	mu         sync.Mutex
+	images     map[string]bool
+	containers map[string]*dockerInspect
+	created    []dockerCreate
+	connected  []string
+	networks   map[string]string // name -> bridge
+	stats      Stats
+	files      map[string]string // copied into containers
+}
+
+func newFakeEngine(t *testing.T) (*fakeEngine, *Docker) {
+	f := &fakeEngine{images: make(map[string]bool), containers: make(map[string]*dockerInspect), networks: make(map[string]string)}
+	mux := http.NewServeMux()
+	prefix := "/" + DOCKER_API_VERSION
+
+	mux.HandleFunc("GET "+prefix+"/images/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.images[r.PathValue("name")] {
+			http.Error(w, `{"message":"no such image"}`, http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("POST "+prefix+"/images/create", func(w http.ResponseWriter, r *http.Request) {
+		image := r.URL.Query().Get("fromImage")
+		if image == "missing" {
+			fmt.Fprintln(w, `{"status":"Pulling"}`)
+			fmt.Fprintln(w, `{"error":"manifest unknown"}`)
+			return
+		}
+		f.mu.Lock()
+		f.images[image+":"+r.URL.Query().Get("tag")] = true
+		f.mu.Unlock()
+		fmt.Fprintln(w, `{"status":"Downloaded"}`)
+	})
+	mux.HandleFunc("POST "+prefix+"/build", func(w http.ResponseWriter, r *http.Request) {
+		tag := r.URL.Query().Get("t")
+		tr := tar.NewReader(r.Body)
+		var files []string
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			files = append(files, hdr.Name)
+		}
+		if !slices.Contains(files, "Dockerfile") {
+			fmt.Fprintln(w, `{"error":"Cannot locate specified Dockerfile: Dockerfile"}`)
+			return
+		}
+		f.mu.Lock()
+		f.images[tag] = true
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"stream":"Successfully tagged %s"}`+"\n", tag)
+	})
+	mux.HandleFunc("POST "+prefix+"/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		var req dockerCreate
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := fmt.Sprintf("c%d", len(f.containers)+1)
+		c := &dockerInspect{Id: id, Name: "/" + r.URL.Query().Get("name")}
+		c.Config.Image = req.Image
+		c.Config.Labels = req.Labels
+		c.HostConfig = req.HostConfig
+		c.NetworkSettings.Ports = req.HostConfig.PortBindings
+		c.State.Status = "created"
+		f.containers[id] = c
+		f.created = append(f.created, req)
+		fmt.Fprintf(w, `{"Id":%q}`, id)
+	})
+	mux.HandleFunc("POST "+prefix+"/networks/create", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name    string
+			Options map[string]string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		f.mu.Lock()
+		f.networks[req.Name] = req.Options[BRIDGE_NAME_OPTION]
+		f.mu.Unlock()
+	})
+	mux.HandleFunc("DELETE "+prefix+"/networks/{network}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		delete(f.networks, r.PathValue("network"))
+		f.mu.Unlock()
+	})
+	mux.HandleFunc("POST "+prefix+"/networks/{network}/connect", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.connected = append(f.connected, r.PathValue("network"))
+		f.mu.Unlock()
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix+"/containers/"), "/")
+		if parts[0] == "json" {
+			var out []map[string]string
+			for id := range f.containers {
+				out = append(out, map[string]string{"Id": id})
+			}
+			_ = json.NewEncoder(w).Encode(out)
+			return
+		}
+		c, ok := f.containers[parts[0]]
+		if !ok {
+			http.Error(w, `{"message":"no such container"}`, http.StatusNotFound)
+			return
+		}
+		switch {
+		case r.Method == http.MethodDelete:
+			delete(f.containers, parts[0])
+		case parts[1] == "start":
+			c.State.Status, c.State.Running = "running", true
+			c.State.Health = &struct {
+				Status string `json:"Status"`
+			}{"starting"}
+		case parts[1] == "archive" && r.Method == http.MethodPut:
+			tr := tar.NewReader(r.Body)
+			for {
+				hdr, err := tr.Next()
+				if err != nil {
+					break
+				}
+				data, _ := io.ReadAll(tr)
+				if f.files == nil {
+					f.files = make(map[string]string)
+				}
+				f.files[r.URL.Query().Get("path")+hdr.Name] = string(data)
+			}
+		case parts[1] == "stop":
+			c.State.Status, c.State.Running = "exited", false
+		case parts[1] == "json":
+			_ = json.NewEncoder(w).Encode(c)
+		case parts[1] == "stats":
+			fmt.Fprintf(w, `{"memory_stats":{"usage":%d,"stats":{"inactive_file":100}},"pids_stats":{"current":%d},`+
+				`"cpu_stats":{"throttling_data":{"periods":%d,"throttled_periods":%d}}}`,
+				f.stats.Memory+100, f.stats.Pids, f.stats.CPUPeriods, f.stats.CPUThrottled)
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	d, err := NewDocker("tcp://" + srv.Listener.Addr().String())
+	require.NoError(t, err)
+	return f, d
+}
+
+func TestDeploy(t *testing.T) {
+	f, d := newFakeEngine(t)
+	ctx := context.Background()
+
+	spec := Spec{
+		Name:     "web1-team3",
+		Image:    "nginx:1.27",
+		Env:      map[string]string{"FLAG": "ctfjx{x}"},
+		Ports:    []Port{{Container: 80, Host: 31337}},
+		Networks: []string{"web1", "shared"},
+		Limits:   Limits{CPUs: 0.5, Memory: 64 << 20, Pids: 128},
+		Files:    map[string]string{"/home/ctf/flag.txt": "ctfjx{x}\n"},
+	}
+	info, err := Deploy(ctx, d, spec)
+	require.NoError(t, err)
+	assert.Equal(t, "web1-team3", info.Name)
+	assert.True(t, info.Running)
+	assert.Equal(t, HealthStarting, info.Health)
+	assert.Equal(t, []Port{{Container: 80, Host: 31337, Protocol: "tcp"}}, info.Ports)
+	assert.True(t, f.images["nginx:1.27"], "missing image is pulled")
+
+	req := f.created[0]
+	assert.Equal(t, int64(5e8), req.HostConfig.NanoCpus)
+	assert.Equal(t, int64(128), req.HostConfig.PidsLimit)
+	assert.Equal(t, []dockerPortBinding{{HostPort: "31337"}}, req.HostConfig.PortBindings["80/tcp"])
+	assert.Equal(t, []string{"FLAG=ctfjx{x}"}, req.Env)
+	assert.Equal(t, "true", req.Labels[LABEL_MANAGED])
+	assert.Equal(t, "web1", req.HostConfig.NetworkMode)
+	assert.Equal(t, []string{"shared"}, f.connected)
+	assert.Equal(t, map[string]string{"/home/": "", "/home/ctf/": "", "/home/ctf/flag.txt": "ctfjx{x}\n"}, f.files)
+
+	infos, err := d.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, infos, 1)
+
+	require.NoError(t, d.Stop(ctx, info.Id, DEFAULT_STOP_TIMEOUT))
+	require.NoError(t, d.Remove(ctx, info.Id))
+	_, err = d.Inspect(ctx, info.Id)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = Deploy(ctx, d, Spec{Name: "bad", Image: "missing"})
+	assert.ErrorIs(t, err, ErrRuntimeError)
+	_, err = Deploy(ctx, d, Spec{Name: "bad"})
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+	_, err = Deploy(ctx, d, Spec{Name: "bad", Image: "nginx:1.27", Files: map[string]string{"flag.txt": "x"}})
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+}
+
+func TestContainerd(t *testing.T) {
+	var calls [][]string
+	c := NewContainerd("")
+	c.run = func(ctx context.Context, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		switch args[0] {
+		case "image":
+			return nil, fmt.Errorf("%w: image", ErrNotFound)
+		case "create":
+			return []byte("abc123\n"), nil
+		case "ps":
+			return []byte("abc123\n"), nil
+		case "inspect":
+			return []byte(`[{"Id":"abc123","Name":"pwn1","State":{"Status":"running","Running":true,"OOMKilled":true}}]`), nil
+		case "cp":
+			data, err := os.ReadFile(filepath.Join(strings.TrimSuffix(args[1], "/."), "flag"))
+			require.NoError(t, err)
+			assert.Equal(t, "ctfjx{x}", string(data))
+		}
+		return nil, nil
+	}
+
+	var rt Runtime = c
+	info, err := Deploy(context.Background(), rt, Spec{
+		Name:   "pwn1",
+		Image:  "pwn1:latest",
+		Ports:  []Port{{Container: 1337, Host: 31337, Protocol: "tcp"}},
+		Limits: Limits{CPUs: 1.5, Pids: 64},
+		Files:  map[string]string{"/flag": "ctfjx{x}"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", info.Id)
+	assert.True(t, info.OOMKilled)
+
+	assert.Equal(t, []string{"pull", "--quiet", "pwn1:latest"}, calls[1], "missing image is pulled")
+	assert.Equal(t, []string{
+		"create", "--name", "pwn1", "--label", LABEL_MANAGED + "=true",
+		"--publish", "31337:1337/tcp", "--cpus", "1.5", "--pids-limit", "64", "pwn1:latest",
+	}, calls[2])
+	assert.Equal(t, "abc123:/", calls[3][2])
+	assert.Equal(t, []string{"start", "abc123"}, calls[4])
+
+	infos, err := rt.List(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, infos, 1)
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("CONTAINER_HOST", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+
+	rt, err := New(RUNTIME_PODMAN, "")
+	require.NoError(t, err)
+	assert.Equal(t, RUNTIME_PODMAN, rt.Name())
+
+	rt, err = New(RUNTIME_CONTAINERD, "")
+	require.NoError(t, err)
+	assert.Equal(t, DEFAULT_CONTAINERD_ADDRESS, rt.(*Containerd).Address)
+
+	_, err = New("lxc", "")
+	assert.Error(t, err)
+}
+
+func TestCompose(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "docker-compose.yml"), []byte("services: {}"), 0o644))
+	store, err := artifacts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	b, err := store.PackDir("web2", src)
+	require.NoError(t, err)
+
+	var calls [][]string
+	c := NewCompose(RUNTIME_DOCKER, t.TempDir())
+	c.run = func(ctx context.Context, dir string, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		if slices.Contains(args, "ps") {
+			return []byte(`{"ID":"a","Name":"web2-app-1","Service":"app","State":"running","Health":"healthy"}
+{"ID":"b","Name":"web2-db-1","Service":"db","State":"running","Health":"starting"}
+`), nil
+		}
+		assert.FileExists(t, filepath.Join(dir, "docker-compose.yml"))
+		return nil, nil
+	}
+	ctx := context.Background()
+
+	require.NoError(t, c.Up(ctx, store, "web2-team3", b, ""))
+	assert.Equal(t, []string{"--project-name", "web2-team3", "--file", "docker-compose.yml", "up", "--detach", "--remove-orphans"}, calls[0])
+
+	stack, err := c.Ps(ctx, "web2-team3")
+	require.NoError(t, err)
+	assert.Len(t, stack.Services, 2)
+	assert.Equal(t, HealthStarting, stack.Health)
+
+	require.NoError(t, c.Down(ctx, "web2-team3"))
+	assert.NoDirExists(t, filepath.Join(c.Dir, "web2-team3"))
+
+	assert.ErrorIs(t, c.Up(ctx, store, "../escape", b, ""), ErrInvalidSpec)
+	assert.ErrorIs(t, c.Up(ctx, store, "empty", artifacts.Bundle{Name: "empty"}, ""), ErrNoComposeFile)
+
+	assert.Equal(t, HealthUnhealthy, aggregateHealth([]Info{{Running: true, Health: HealthHealthy}, {Running: false}}))
+	assert.Equal(t, HealthHealthy, aggregateHealth([]Info{{Running: true, Health: HealthNone}}))
+}
+
+type fakeFirewall struct {
+	isolated map[string]bool
+}
+
+func (f *fakeFirewall) Name() string                    { return "fake" }
+func (f *fakeFirewall) Setup(ctx context.Context) error { return nil }
+func (f *fakeFirewall) Isolate(ctx context.Context, bridge string) error {
+	f.isolated[bridge] = true
+	return nil
+}
+func (f *fakeFirewall) Release(ctx context.Context, bridge string) error {
+	delete(f.isolated, bridge)
+	return nil
+}
+
+func TestIsolation(t *testing.T) {
+	f, d := newFakeEngine(t)
+	fw := &fakeFirewall{isolated: make(map[string]bool)}
+	ctx := context.Background()
+
+	iso, err := NewIsolator(ctx, d, fw)
+	require.NoError(t, err)
+
+	info, err := DeployIsolated(ctx, d, iso, Spec{Name: "pwn1-team3", Image: "pwn1:latest"})
+	require.NoError(t, err)
+	bridge := BridgeName("pwn1-team3")
+	assert.LessOrEqual(t, len(bridge), 15)
+	assert.Equal(t, bridge, f.networks["ctfjx-pwn1-team3"])
+	assert.Equal(t, "ctfjx-pwn1-team3", f.created[0].HostConfig.NetworkMode)
+	assert.True(t, fw.isolated[bridge])
+
+	// A restarted agent isolates the existing instances again
+	restarted := &fakeFirewall{isolated: make(map[string]bool)}
+	_, err = NewIsolator(ctx, d, restarted)
+	require.NoError(t, err)
+	assert.True(t, restarted.isolated[bridge])
+
+	require.NoError(t, Remove(ctx, d, iso, info.Id))
+	assert.Empty(t, f.networks)
+	assert.Empty(t, fw.isolated)
+}
+
+func TestFirewalls(t *testing.T) {
+	var cmds []string
+	run := func(ctx context.Context, stdin string, name string, args ...string) error {
+		cmds = append(cmds, strings.TrimSpace(name+" "+strings.Join(args, " ")+" "+stdin))
+		if len(args) > 1 && args[1] == "-C" {
+			return fmt.Errorf("no such rule")
+		}
+		return nil
+	}
+
+	ipt := &Iptables{run: run}
+	require.NoError(t, ipt.Isolate(context.Background(), "cj-0123456789"))
+	assert.Contains(t, cmds, "iptables -w -A CTFJX-FORWARD -i cj-0123456789 -d "+strings.Join(PRIVATE_RANGES, ",")+" -j DROP")
+
+	cmds = nil
+	nft := &Nftables{run: run}
+	require.NoError(t, nft.Isolate(context.Background(), "cj-0123456789"))
+	assert.Equal(t, []string{`nft -f - add element inet ctfjx isolated { "cj-0123456789" }
+add element inet ctfjx same { "cj-0123456789" . "cj-0123456789" }`}, cmds)
+}
+
+func TestMonitor(t *testing.T) {
+	f, d := newFakeEngine(t)
+	ctx := context.Background()
+
+	info, err := Deploy(ctx, d, Spec{Name: "pwn2", Image: "pwn2:latest", Limits: Limits{Memory: 1000, Pids: 10, Disk: 1 << 30}})
+	require.NoError(t, err)
+	assert.Equal(t, Limits{Memory: 1000, Pids: 10, Disk: 1 << 30}, info.Limits)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMonitor("agent-1", d)
+	m.now = func() time.Time { return now }
+
+	kinds := func(vs []Violation) []string {
+		var out []string
+		for _, v := range vs {
+			out = append(out, v.Kind)
+		}
+		return out
+	}
+
+	f.stats = Stats{Memory: 100, Pids: 2, CPUPeriods: 100}
+	vs, err := m.Check(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, vs)
+
+	f.stats = Stats{Memory: 990, Pids: 10, CPUPeriods: 200, CPUThrottled: 95}
+	vs, err = m.Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{VIOLATION_PIDS, VIOLATION_MEMORY, VIOLATION_CPU}, kinds(vs))
+	assert.Equal(t, "agent-1", vs[0].AgentId)
+
+	vs, err = m.Check(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, vs, "within the cooldown")
+
+	now = now.Add(DEFAULT_VIOLATION_COOLDOWN)
+	f.mu.Lock()
+	c := f.containers[info.Id]
+	c.State.Running, c.State.Status, c.State.OOMKilled, c.State.ExitCode = false, "exited", true, 137
+	f.mu.Unlock()
+	vs, err = m.Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{VIOLATION_OOM}, kinds(vs))
+
+	vs, err = m.Check(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, vs, "an OOM kill is reported once")
+}
+
+func TestBuildImage(t *testing.T) {
+	f, d := newFakeEngine(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644))
+	require.NoError(t, d.BuildImage(ctx, dir, "chal:1", nil))
+	assert.True(t, f.images["chal:1"])
+
+	empty := t.TempDir()
+	assert.ErrorIs(t, d.BuildImage(ctx, empty, "chal:2", nil), ErrRuntimeError, "stream errors fail the build")
+
+	// contexts only depend on the files
+	var a, b bytes.Buffer
+	require.NoError(t, WriteContext(&a, dir))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "Dockerfile"), time.Now(), time.Now().Add(time.Hour)))
+	require.NoError(t, WriteContext(&b, dir))
+	assert.Equal(t, a.Bytes(), b.Bytes())
+}
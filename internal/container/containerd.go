@@ -0,0 +1,206 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_CONTAINERD_ADDRESS   = "/run/containerd/containerd.sock"
+	DEFAULT_CONTAINERD_NAMESPACE = "ctfjx"
+)
+
+// Containerd runs containers on containerd through nerdctl,
+// its Docker compatible CLI, which also supports rootless setups
+type Containerd struct {
+	Binary    string // nerdctl by default
+	Address   string
+	Namespace string
+
+	// Swapped out in tests
+	run func(ctx context.Context, args ...string) ([]byte, error)
+}
+
+// NewContainerd connects to the containerd socket at address,
+// or DEFAULT_CONTAINERD_ADDRESS if empty
+func NewContainerd(address string) *Containerd {
+	if address == "" {
+		address = DEFAULT_CONTAINERD_ADDRESS
+	}
+	c := &Containerd{Binary: "nerdctl", Address: address, Namespace: DEFAULT_CONTAINERD_NAMESPACE}
+	c.run = c.exec
+	return c
+}
+
+func (c *Containerd) Name() string { return RUNTIME_CONTAINERD }
+
+func (c *Containerd) exec(ctx context.Context, args ...string) ([]byte, error) {
+	sub := args[0]
+	args = append([]string{"--address", c.Address, "--namespace", c.Namespace}, args...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "not found") || strings.Contains(msg, "no such") {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, msg)
+		}
+		return nil, fmt.Errorf("%w: %s: %s", ErrRuntimeError, sub, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (c *Containerd) Pull(ctx context.Context, image string) error {
+	_, err := c.run(ctx, "pull", "--quiet", image)
+	return err
+}
+
+func (c *Containerd) HasImage(ctx context.Context, image string) (bool, error) {
+	_, err := c.run(ctx, "image", "inspect", image)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func createArgs(spec Spec) []string {
+	args := []string{"create", "--name", spec.Name, "--label", LABEL_MANAGED + "=true"}
+	for k, v := range spec.Labels {
+		args = append(args, "--label", k+"="+v)
+	}
+	for k, v := range spec.Env {
+		args = append(args, "--env", k+"="+v)
+	}
+	for _, p := range spec.Ports {
+		publish := strconv.Itoa(p.Container)
+		if p.Host != 0 {
+			publish = strconv.Itoa(p.Host) + ":" + publish
+		}
+		if p.HostIP != "" {
+			publish = p.HostIP + ":" + publish
+		}
+		if p.Protocol != "" {
+			publish += "/" + p.Protocol
+		}
+		args = append(args, "--publish", publish)
+	}
+	for _, n := range spec.Networks {
+		args = append(args, "--network", n)
+	}
+	if spec.Limits.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(spec.Limits.CPUs, 'f', -1, 64))
+	}
+	if spec.Limits.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(spec.Limits.Memory, 10))
+	}
+	if spec.Limits.Pids > 0 {
+		args = append(args, "--pids-limit", strconv.FormatInt(spec.Limits.Pids, 10))
+	}
+	return append(append(args, spec.Image), spec.Cmd...)
+}
+
+func (c *Containerd) Create(ctx context.Context, spec Spec) (string, error) {
+	if err := spec.Validate(); err != nil {
+		return "", err
+	}
+	if err := pullIfMissing(ctx, c, spec); err != nil {
+		return "", err
+	}
+	out, err := c.run(ctx, createArgs(spec)...)
+	if err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(string(out))
+	if len(spec.Files) > 0 {
+		if err := c.copyFiles(ctx, id, spec.Files); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// copyFiles lays files out in a temporary directory and
+// copies it into the root of the container id
+func (c *Containerd) copyFiles(ctx context.Context, id string, files map[string]string) error {
+	dir, err := os.MkdirTemp("", "ctfjx-files-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for pth, content := range files {
+		local := filepath.Join(dir, filepath.FromSlash(path.Clean(pth)))
+		if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(local, []byte(content), 0o444); err != nil {
+			return err
+		}
+	}
+	_, err = c.run(ctx, "cp", dir+"/.", id+":/")
+	return err
+}
+
+func (c *Containerd) Start(ctx context.Context, id string) error {
+	_, err := c.run(ctx, "start", id)
+	return err
+}
+
+func (c *Containerd) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	_, err := c.run(ctx, "stop", "--time", strconv.Itoa(int(timeout.Seconds())), id)
+	return err
+}
+
+func (c *Containerd) Remove(ctx context.Context, id string) error {
+	_, err := c.run(ctx, "rm", "--force", "--volumes", id)
+	return err
+}
+
+func (c *Containerd) Inspect(ctx context.Context, id string) (Info, error) {
+	out, err := c.run(ctx, "inspect", "--mode", "dockercompat", id)
+	if err != nil {
+		return Info{}, err
+	}
+	var raw []dockerInspect
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return Info{}, err
+	}
+	if len(raw) == 0 {
+		return Info{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return raw[0].info(), nil
+}
+
+func (c *Containerd) List(ctx context.Context) ([]Info, error) {
+	out, err := c.run(ctx, "ps", "--all", "--quiet", "--no-trunc", "--filter", "label="+LABEL_MANAGED+"=true")
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []Info
+	for _, id := range strings.Fields(string(out)) {
+		info, err := c.Inspect(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,399 @@
+package container
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_DOCKER_HOST = "unix:///var/run/docker.sock"
+	DEFAULT_PODMAN_HOST = "unix:///run/podman/podman.sock"
+	DOCKER_API_VERSION  = "v1.41"
+)
+
+// Docker talks to the Docker Engine API, or to
+// the Docker compatible API of Podman
+type Docker struct {
+	name   string
+	client *http.Client
+	base   string
+}
+
+// NewDocker connects to host, e.g. unix:///var/run/docker.sock or
+// tcp://127.0.0.1:2375. An empty host uses $DOCKER_HOST or
+// DEFAULT_DOCKER_HOST.
+func NewDocker(host string) (*Docker, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DEFAULT_DOCKER_HOST
+	}
+	return newDockerAPI(RUNTIME_DOCKER, host)
+}
+
+// NewPodman connects to the Podman API socket at host. An empty host
+// uses $CONTAINER_HOST, the rootless socket under $XDG_RUNTIME_DIR
+// if it exists, or DEFAULT_PODMAN_HOST.
+func NewPodman(host string) (*Docker, error) {
+	if host == "" {
+		host = os.Getenv("CONTAINER_HOST")
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); host == "" && dir != "" {
+		if sock := dir + "/podman/podman.sock"; fileExists(sock) {
+			host = "unix://" + sock
+		}
+	}
+	if host == "" {
+		host = DEFAULT_PODMAN_HOST
+	}
+	return newDockerAPI(RUNTIME_PODMAN, host)
+}
+
+func fileExists(pth string) bool {
+	_, err := os.Stat(pth)
+	return err == nil
+}
+
+func newDockerAPI(name, host string) (*Docker, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", u.Path)
+			},
+		}
+		return &Docker{name: name, client: &http.Client{Transport: transport}, base: "http://docker/" + DOCKER_API_VERSION}, nil
+	case "tcp", "http":
+		return &Docker{name: name, client: &http.Client{}, base: "http://" + u.Host + "/" + DOCKER_API_VERSION}, nil
+	}
+	return nil, fmt.Errorf("unsupported %s host %q", name, host)
+}
+
+func (d *Docker) Name() string { return d.name }
+
+// do sends a request and decodes the JSON response into out, if set.
+// Bodies are sent as JSON, or as a tar stream if they are a reader.
+// Engine errors are returned as ErrNotFound or ErrRuntimeError.
+func (d *Docker) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var rd io.Reader
+	contentType := "application/json"
+	if r, ok := body.(io.Reader); ok {
+		rd, contentType = r, "application/x-tar"
+	} else if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	u := d.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		var msg struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&msg)
+		if res.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", ErrNotFound, msg.Message)
+		}
+		return fmt.Errorf("%w: %s %s: %d %s", ErrRuntimeError, method, path, res.StatusCode, msg.Message)
+	}
+	if out == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// Pull pulls image, e.g. nginx:1.27
+func (d *Docker) Pull(ctx context.Context, image string) error {
+	name, tag := splitImage(image)
+	q := url.Values{"fromImage": {name}, "tag": {tag}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.base+"/images/create?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return d.stream(req, "pull "+image)
+}
+
+// HasImage reports whether image is present locally
+func (d *Docker) HasImage(ctx context.Context, image string) (bool, error) {
+	err := d.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func splitImage(image string) (name, tag string) {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+type dockerPortBinding struct {
+	HostIp   string `json:"HostIp,omitempty"`
+	HostPort string `json:"HostPort,omitempty"`
+}
+
+type dockerCreate struct {
+	Image        string               `json:"Image"`
+	Cmd          []string             `json:"Cmd,omitempty"`
+	Env          []string             `json:"Env,omitempty"`
+	Labels       map[string]string    `json:"Labels"`
+	ExposedPorts map[string]struct{}  `json:"ExposedPorts,omitempty"`
+	HostConfig   dockerHostConfig     `json:"HostConfig"`
+	Networking   *dockerNetworkConfig `json:"NetworkingConfig,omitempty"`
+}
+
+type dockerHostConfig struct {
+	NanoCpus     int64                          `json:"NanoCpus,omitempty"`
+	Memory       int64                          `json:"Memory,omitempty"`
+	PidsLimit    int64                          `json:"PidsLimit,omitempty"`
+	StorageOpt   map[string]string              `json:"StorageOpt,omitempty"`
+	PortBindings map[string][]dockerPortBinding `json:"PortBindings,omitempty"`
+	NetworkMode  string                         `json:"NetworkMode,omitempty"`
+}
+
+type dockerNetworkConfig struct {
+	EndpointsConfig map[string]struct{} `json:"EndpointsConfig"`
+}
+
+func createRequest(spec Spec) dockerCreate {
+	req := dockerCreate{
+		Image:  spec.Image,
+		Cmd:    spec.Cmd,
+		Labels: map[string]string{LABEL_MANAGED: "true"},
+		HostConfig: dockerHostConfig{
+			NanoCpus:  int64(spec.Limits.CPUs * 1e9),
+			Memory:    spec.Limits.Memory,
+			PidsLimit: spec.Limits.Pids,
+		},
+	}
+	if spec.Limits.Disk > 0 {
+		// Needs overlay2 on xfs with project quotas, creating fails otherwise
+		req.HostConfig.StorageOpt = map[string]string{"size": strconv.FormatInt(spec.Limits.Disk, 10)}
+	}
+	for k, v := range spec.Labels {
+		req.Labels[k] = v
+	}
+	for k, v := range spec.Env {
+		req.Env = append(req.Env, k+"="+v)
+	}
+	if len(spec.Ports) > 0 {
+		req.ExposedPorts = make(map[string]struct{})
+		req.HostConfig.PortBindings = make(map[string][]dockerPortBinding)
+	}
+	for _, p := range spec.Ports {
+		proto := p.Protocol
+		if proto == "" {
+			proto = "tcp"
+		}
+		key := fmt.Sprintf("%d/%s", p.Container, proto)
+		req.ExposedPorts[key] = struct{}{}
+		binding := dockerPortBinding{HostIp: p.HostIP}
+		if p.Host != 0 {
+			binding.HostPort = strconv.Itoa(p.Host)
+		}
+		req.HostConfig.PortBindings[key] = append(req.HostConfig.PortBindings[key], binding)
+	}
+	if len(spec.Networks) > 0 {
+		req.HostConfig.NetworkMode = spec.Networks[0]
+		req.Networking = &dockerNetworkConfig{EndpointsConfig: map[string]struct{}{spec.Networks[0]: {}}}
+	}
+	return req
+}
+
+// Create creates a container from spec, pulling its image if needed,
+// and returns its id. It is not started.
+func (d *Docker) Create(ctx context.Context, spec Spec) (string, error) {
+	if err := spec.Validate(); err != nil {
+		return "", err
+	}
+
+	if err := pullIfMissing(ctx, d, spec); err != nil {
+		return "", err
+	}
+
+	var out struct {
+		Id string `json:"Id"`
+	}
+	if err := d.do(ctx, http.MethodPost, "/containers/create", url.Values{"name": {spec.Name}}, createRequest(spec), &out); err != nil {
+		return "", err
+	}
+
+	for _, network := range spec.Networks[min(1, len(spec.Networks)):] {
+		if err := d.Connect(ctx, network, out.Id); err != nil {
+			return out.Id, err
+		}
+	}
+	if len(spec.Files) > 0 {
+		var buf bytes.Buffer
+		if err := WriteFiles(&buf, spec.Files); err != nil {
+			return out.Id, err
+		}
+		if err := d.do(ctx, http.MethodPut, "/containers/"+out.Id+"/archive", url.Values{"path": {"/"}}, &buf, nil); err != nil {
+			return out.Id, err
+		}
+	}
+	return out.Id, nil
+}
+
+// Connect attaches the container id to network
+func (d *Docker) Connect(ctx context.Context, network, id string) error {
+	body := map[string]string{"Container": id}
+	return d.do(ctx, http.MethodPost, "/networks/"+network+"/connect", nil, body, nil)
+}
+
+// Start starts the container id, doing nothing if it is running
+func (d *Docker) Start(ctx context.Context, id string) error {
+	return d.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// Stop stops the container id, killing it after timeout
+func (d *Docker) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	q := url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}}
+	return d.do(ctx, http.MethodPost, "/containers/"+id+"/stop", q, nil, nil)
+}
+
+// Remove removes the container id and its anonymous volumes,
+// killing it if it is running
+func (d *Docker) Remove(ctx context.Context, id string) error {
+	q := url.Values{"force": {"true"}, "v": {"true"}}
+	return d.do(ctx, http.MethodDelete, "/containers/"+id, q, nil, nil)
+}
+
+type dockerInspect struct {
+	Id     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	HostConfig      dockerHostConfig `json:"HostConfig"`
+	NetworkSettings struct {
+		Ports map[string][]dockerPortBinding `json:"Ports"` // e.g. 1337/tcp
+	} `json:"NetworkSettings"`
+	State struct {
+		Status    string `json:"Status"`
+		Running   bool   `json:"Running"`
+		ExitCode  int    `json:"ExitCode"`
+		OOMKilled bool   `json:"OOMKilled"`
+		StartedAt string `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+// Inspect returns the state of the container id
+func (d *Docker) Inspect(ctx context.Context, id string) (Info, error) {
+	var raw dockerInspect
+	if err := d.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &raw); err != nil {
+		return Info{}, err
+	}
+	return raw.info(), nil
+}
+
+func (raw dockerInspect) info() Info {
+	info := Info{
+		Id:        raw.Id,
+		Name:      strings.TrimPrefix(raw.Name, "/"),
+		Image:     raw.Config.Image,
+		Labels:    raw.Config.Labels,
+		State:     raw.State.Status,
+		Running:   raw.State.Running,
+		Health:    HealthNone,
+		ExitCode:  raw.State.ExitCode,
+		OOMKilled: raw.State.OOMKilled,
+		Limits: Limits{
+			CPUs:   float64(raw.HostConfig.NanoCpus) / 1e9,
+			Memory: raw.HostConfig.Memory,
+			Pids:   raw.HostConfig.PidsLimit,
+		},
+	}
+	if size, err := strconv.ParseInt(raw.HostConfig.StorageOpt["size"], 10, 64); err == nil {
+		info.Limits.Disk = size
+	}
+	if raw.State.Health != nil && raw.State.Health.Status != "" {
+		info.Health = Health(raw.State.Health.Status)
+	}
+	info.StartedAt, _ = time.Parse(time.RFC3339Nano, raw.State.StartedAt)
+	for key, bindings := range raw.NetworkSettings.Ports {
+		port, proto, _ := strings.Cut(key, "/")
+		containerPort, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+		for _, b := range bindings {
+			if hostPort, err := strconv.Atoi(b.HostPort); err == nil {
+				info.Ports = append(info.Ports, Port{Container: containerPort, Host: hostPort, HostIP: b.HostIp, Protocol: proto})
+			}
+		}
+	}
+	slices.SortFunc(info.Ports, func(a, b Port) int {
+		return cmp.Or(a.Container-b.Container, strings.Compare(a.Protocol, b.Protocol), strings.Compare(a.HostIP, b.HostIP))
+	})
+	return info
+}
+
+// List returns every container managed by ctfjx
+func (d *Docker) List(ctx context.Context) ([]Info, error) {
+	filters, _ := json.Marshal(map[string][]string{"label": {LABEL_MANAGED + "=true"}})
+	var raw []struct {
+		Id string `json:"Id"`
+	}
+	q := url.Values{"all": {"true"}, "filters": {string(filters)}}
+	if err := d.do(ctx, http.MethodGet, "/containers/json", q, nil, &raw); err != nil {
+		return nil, err
+	}
+
+	out := make([]Info, 0, len(raw))
+	for _, c := range raw {
+		info, err := d.Inspect(ctx, c.Id)
+		if errors.Is(err, ErrNotFound) {
+			continue // removed in the meantime
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
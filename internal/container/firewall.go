@@ -0,0 +1,163 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PRIVATE_RANGES are dropped from isolated bridges: other instances,
+// the agent's LAN and cloud metadata endpoints live there
+var PRIVATE_RANGES = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "100.64.0.0/10"}
+
+var ErrNoFirewall = errors.New("no supported firewall")
+
+// Firewall isolates bridges: traffic from an isolated bridge may only
+// stay on it or go to public addresses, and it may not open
+// connections to the host, which runs the agent
+type Firewall interface {
+	Name() string
+	// Setup creates the firewall's rules, dropping every isolated bridge
+	Setup(ctx context.Context) error
+	Isolate(ctx context.Context, bridge string) error
+	Release(ctx context.Context, bridge string) error
+}
+
+type commandFunc func(ctx context.Context, stdin string, name string, args ...string) error
+
+func runCommand(ctx context.Context, stdin string, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+const (
+	IPTABLES_FORWARD_CHAIN = "CTFJX-FORWARD"
+	IPTABLES_INPUT_CHAIN   = "CTFJX-INPUT"
+)
+
+// Iptables isolates bridges with iptables rules in their own chains,
+// jumped to from DOCKER-USER if it exists or FORWARD, and INPUT
+type Iptables struct {
+	run commandFunc
+}
+
+func NewIptables() *Iptables {
+	return &Iptables{run: runCommand}
+}
+
+func (f *Iptables) Name() string { return "iptables" }
+
+func (f *Iptables) iptables(ctx context.Context, args ...string) error {
+	return f.run(ctx, "", "iptables", append([]string{"-w"}, args...)...)
+}
+
+func (f *Iptables) Setup(ctx context.Context) error {
+	forward := "FORWARD"
+	if f.iptables(ctx, "-n", "-L", "DOCKER-USER") == nil {
+		forward = "DOCKER-USER"
+	}
+	for _, hook := range []struct{ chain, from string }{
+		{IPTABLES_FORWARD_CHAIN, forward},
+		{IPTABLES_INPUT_CHAIN, "INPUT"},
+	} {
+		if f.iptables(ctx, "-N", hook.chain) != nil {
+			if err := f.iptables(ctx, "-F", hook.chain); err != nil {
+				return err
+			}
+		}
+		if f.iptables(ctx, "-C", hook.from, "-j", hook.chain) != nil {
+			if err := f.iptables(ctx, "-I", hook.from, "1", "-j", hook.chain); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Iptables) rules(bridge string) [][]string {
+	return [][]string{
+		{IPTABLES_FORWARD_CHAIN, "-i", bridge, "-o", bridge, "-j", "RETURN"},
+		{IPTABLES_FORWARD_CHAIN, "-i", bridge, "-d", strings.Join(PRIVATE_RANGES, ","), "-j", "DROP"},
+		{IPTABLES_INPUT_CHAIN, "-i", bridge, "-m", "conntrack", "!", "--ctstate", "ESTABLISHED,RELATED", "-j", "DROP"},
+	}
+}
+
+func (f *Iptables) Isolate(ctx context.Context, bridge string) error {
+	for _, rule := range f.rules(bridge) {
+		if f.iptables(ctx, append([]string{"-C"}, rule...)...) == nil {
+			continue
+		}
+		if err := f.iptables(ctx, append([]string{"-A"}, rule...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Iptables) Release(ctx context.Context, bridge string) error {
+	var errs []error
+	for _, rule := range f.rules(bridge) {
+		for f.iptables(ctx, append([]string{"-C"}, rule...)...) == nil {
+			if err := f.iptables(ctx, append([]string{"-D"}, rule...)...); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+const NFT_TABLE = "ctfjx"
+
+// Nftables isolates bridges with the inet ctfjx table,
+// adding and removing them from its sets
+type Nftables struct {
+	run commandFunc
+}
+
+func NewNftables() *Nftables {
+	return &Nftables{run: runCommand}
+}
+
+func (f *Nftables) Name() string { return "nftables" }
+
+func (f *Nftables) Setup(ctx context.Context) error {
+	_ = f.run(ctx, "", "nft", "delete", "table", "inet", NFT_TABLE)
+	script := fmt.Sprintf(`table inet %s {
+	set isolated { type ifname; }
+	set same { type ifname . ifname; }
+	set private { type ipv4_addr; flags interval; elements = { %s } }
+
+	chain forward {
+		type filter hook forward priority -1; policy accept;
+		iifname . oifname @same accept
+		iifname @isolated ip daddr @private drop
+	}
+
+	chain input {
+		type filter hook input priority -1; policy accept;
+		iifname @isolated ct state != { established, related } drop
+	}
+}
+`, NFT_TABLE, strings.Join(PRIVATE_RANGES, ", "))
+	return f.run(ctx, script, "nft", "-f", "-")
+}
+
+func (f *Nftables) Isolate(ctx context.Context, bridge string) error {
+	script := fmt.Sprintf("add element inet %[1]s isolated { %[2]q }\nadd element inet %[1]s same { %[2]q . %[2]q }\n", NFT_TABLE, bridge)
+	return f.run(ctx, script, "nft", "-f", "-")
+}
+
+func (f *Nftables) Release(ctx context.Context, bridge string) error {
+	script := fmt.Sprintf("delete element inet %[1]s isolated { %[2]q }\ndelete element inet %[1]s same { %[2]q . %[2]q }\n", NFT_TABLE, bridge)
+	return f.run(ctx, script, "nft", "-f", "-")
+}
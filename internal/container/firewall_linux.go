@@ -0,0 +1,16 @@
+//go:build linux
+
+package container
+
+import "os/exec"
+
+// DetectFirewall prefers nftables and falls back to iptables
+func DetectFirewall() (Firewall, error) {
+	if _, err := exec.LookPath("nft"); err == nil {
+		return NewNftables(), nil
+	}
+	if _, err := exec.LookPath("iptables"); err == nil {
+		return NewIptables(), nil
+	}
+	return nil, ErrNoFirewall
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package container
+
+// DetectFirewall fails, bridges can only be isolated on Linux
+func DetectFirewall() (Firewall, error) {
+	return nil, ErrNoFirewall
+}
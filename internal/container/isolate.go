@@ -0,0 +1,107 @@
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/lattesec/log"
+)
+
+const (
+	// Every isolated network is called this plus the instance's name
+	ISOLATED_NETWORK_PREFIX = "ctfjx-"
+
+	// Set on the containers deployed with DeployIsolated
+	LABEL_ISOLATED = "ctfjx.isolated"
+)
+
+// Isolator gives each challenge instance its own bridge network,
+// isolated by the firewall from other instances and from the host
+type Isolator struct {
+	rt Networker
+	fw Firewall
+}
+
+// NewIsolator sets up fw and isolates the networks created on rt,
+// including those of the instances deployed before a restart
+func NewIsolator(ctx context.Context, rt Networker, fw Firewall) (*Isolator, error) {
+	if err := fw.Setup(ctx); err != nil {
+		return nil, fmt.Errorf("failed to set up %s: %w", fw.Name(), err)
+	}
+
+	infos, err := rt.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.Labels[LABEL_ISOLATED] != "true" {
+			continue
+		}
+		if err := fw.Isolate(ctx, BridgeName(info.Name)); err != nil {
+			return nil, fmt.Errorf("failed to isolate %s: %w", info.Name, err)
+		}
+	}
+	return &Isolator{rt: rt, fw: fw}, nil
+}
+
+// BridgeName returns the host interface of instance's network,
+// short enough for the 15 character limit on interface names
+func BridgeName(instance string) string {
+	sum := sha256.Sum256([]byte(instance))
+	return "cj-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// Create creates and isolates the network of instance, returning its name
+func (i *Isolator) Create(ctx context.Context, instance string) (string, error) {
+	name := ISOLATED_NETWORK_PREFIX + instance
+	bridge := BridgeName(instance)
+	spec := NetworkSpec{Name: name, Bridge: bridge, Labels: map[string]string{"ctfjx.instance": instance}}
+
+	// Isolate first, so the bridge never carries traffic unfiltered
+	if err := i.fw.Isolate(ctx, bridge); err != nil {
+		return "", err
+	}
+	if err := i.rt.CreateNetwork(ctx, spec); err != nil {
+		return "", errors.Join(err, i.fw.Release(context.WithoutCancel(ctx), bridge))
+	}
+	return name, nil
+}
+
+// Remove removes the network of instance and its firewall rules
+func (i *Isolator) Remove(ctx context.Context, instance string) error {
+	return errors.Join(
+		i.rt.RemoveNetwork(ctx, ISOLATED_NETWORK_PREFIX+instance),
+		i.fw.Release(ctx, BridgeName(instance)),
+	)
+}
+
+// DeployIsolated deploys spec on its own isolated network, which
+// becomes its network mode. Other networks of spec are still attached.
+func DeployIsolated(ctx context.Context, rt Runtime, iso *Isolator, spec Spec) (Info, error) {
+	network, err := iso.Create(ctx, spec.Name)
+	if err != nil {
+		return Info{}, err
+	}
+	spec.Networks = append([]string{network}, spec.Networks...)
+	spec.Labels = maps.Clone(spec.Labels)
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string)
+	}
+	spec.Labels[LABEL_ISOLATED] = "true"
+
+	info, err := Deploy(ctx, rt, spec)
+	if err != nil {
+		if rerr := iso.Remove(context.WithoutCancel(ctx), spec.Name); rerr != nil {
+			log.Warn().
+				WithMeta("scope", "container").
+				WithMeta("name", spec.Name).
+				Msgf("failed to remove network: %v", rerr).Send()
+		}
+		return Info{}, err
+	}
+	return info, nil
+}
@@ -0,0 +1,232 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+const (
+	DEFAULT_MONITOR_INTERVAL   = 10 * time.Second
+	DEFAULT_VIOLATION_COOLDOWN = 5 * time.Minute // before the same violation is reported again
+
+	// Usage above these fractions of a limit is reported
+	PIDS_THRESHOLD     = 0.9
+	MEMORY_THRESHOLD   = 0.95
+	THROTTLE_THRESHOLD = 0.9 // of the CPU periods since the last check
+)
+
+// The kinds of violation
+const (
+	VIOLATION_OOM    = "oom"    // killed for running out of memory
+	VIOLATION_MEMORY = "memory" // close to its memory limit
+	VIOLATION_PIDS   = "pids"   // close to its pids limit, e.g. a fork bomb
+	VIOLATION_CPU    = "cpu"    // throttled most of the time
+)
+
+// Violation is an instance hitting one of its limits,
+// sent to the daemon with ActionReportViolation
+type Violation struct {
+	AgentId   string    `json:"agent_id"`
+	Container string    `json:"container"`
+	Kind      string    `json:"kind"`
+	Usage     int64     `json:"usage,omitempty"`
+	Limit     int64     `json:"limit,omitempty"`
+	Detail    string    `json:"detail"`
+	Time      time.Time `json:"time"`
+}
+
+// Stats is the resource usage of a running container
+type Stats struct {
+	Memory           int64 // bytes, without the page cache
+	Pids             int64
+	CPUPeriods       int64 // cumulative CFS periods
+	CPUThrottled     int64 // cumulative throttled CFS periods
+	CPUThrottledTime time.Duration
+}
+
+// StatsReader is a Runtime that can report resource usage
+type StatsReader interface {
+	Stats(ctx context.Context, id string) (Stats, error)
+}
+
+func (d *Docker) Stats(ctx context.Context, id string) (Stats, error) {
+	var raw struct {
+		MemoryStats struct {
+			Usage int64            `json:"usage"`
+			Stats map[string]int64 `json:"stats"`
+		} `json:"memory_stats"`
+		PidsStats struct {
+			Current int64 `json:"current"`
+		} `json:"pids_stats"`
+		CPUStats struct {
+			ThrottlingData struct {
+				Periods          int64 `json:"periods"`
+				ThrottledPeriods int64 `json:"throttled_periods"`
+				ThrottledTime    int64 `json:"throttled_time"`
+			} `json:"throttling_data"`
+		} `json:"cpu_stats"`
+	}
+	q := url.Values{"stream": {"false"}, "one-shot": {"true"}}
+	if err := d.do(ctx, http.MethodGet, "/containers/"+id+"/stats", q, nil, &raw); err != nil {
+		return Stats{}, err
+	}
+
+	// cgroup v2 reports inactive_file, v1 total_inactive_file
+	cache := raw.MemoryStats.Stats["inactive_file"] + raw.MemoryStats.Stats["total_inactive_file"]
+	throttling := raw.CPUStats.ThrottlingData
+	return Stats{
+		Memory:           max(0, raw.MemoryStats.Usage-cache),
+		Pids:             raw.PidsStats.Current,
+		CPUPeriods:       throttling.Periods,
+		CPUThrottled:     throttling.ThrottledPeriods,
+		CPUThrottledTime: time.Duration(throttling.ThrottledTime),
+	}, nil
+}
+
+// Monitor watches the instances on an agent for limit violations
+type Monitor struct {
+	AgentId  string
+	Interval time.Duration
+	Cooldown time.Duration
+
+	rt  Runtime
+	now func() time.Time
+
+	mu       sync.Mutex
+	reported map[string]time.Time // container/kind -> last report
+	oomSeen  map[string]bool      // container/started at
+	cpu      map[string]Stats     // the previous sample, for throttling deltas
+}
+
+func NewMonitor(agentId string, rt Runtime) *Monitor {
+	return &Monitor{
+		AgentId:  agentId,
+		Interval: DEFAULT_MONITOR_INTERVAL,
+		Cooldown: DEFAULT_VIOLATION_COOLDOWN,
+		rt:       rt,
+		now:      time.Now,
+		reported: make(map[string]time.Time),
+		oomSeen:  make(map[string]bool),
+		cpu:      make(map[string]Stats),
+	}
+}
+
+// Check returns the new violations of every managed container.
+// A violation that persists is reported again after the cooldown,
+// an OOM kill only once per start of the container.
+func (m *Monitor) Check(ctx context.Context) ([]Violation, error) {
+	infos, err := m.rt.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sr, hasStats := m.rt.(StatsReader)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var out []Violation
+	report := func(info Info, kind string, usage, limit int64, detail string) {
+		key := info.Name + "/" + kind
+		if last, ok := m.reported[key]; ok && now.Sub(last) < m.Cooldown {
+			return
+		}
+		m.reported[key] = now
+		out = append(out, Violation{
+			AgentId:   m.AgentId,
+			Container: info.Name,
+			Kind:      kind,
+			Usage:     usage,
+			Limit:     limit,
+			Detail:    detail,
+			Time:      now,
+		})
+	}
+
+	cpu := make(map[string]Stats, len(infos))
+	for _, info := range infos {
+		if info.OOMKilled {
+			key := info.Name + "/" + info.StartedAt.String()
+			if !m.oomSeen[key] {
+				m.oomSeen[key] = true
+				out = append(out, Violation{
+					AgentId:   m.AgentId,
+					Container: info.Name,
+					Kind:      VIOLATION_OOM,
+					Limit:     info.Limits.Memory,
+					Detail:    fmt.Sprintf("killed out of memory with exit code %d", info.ExitCode),
+					Time:      now,
+				})
+			}
+		}
+		if !info.Running || !hasStats {
+			continue
+		}
+
+		stats, err := sr.Stats(ctx, info.Id)
+		if err != nil {
+			log.Warn().
+				WithMeta("scope", "container").
+				WithMeta("name", info.Name).
+				Msgf("failed to read stats: %v", err).Send()
+			continue
+		}
+
+		if l := info.Limits.Pids; l > 0 && float64(stats.Pids) >= PIDS_THRESHOLD*float64(l) {
+			report(info, VIOLATION_PIDS, stats.Pids, l, fmt.Sprintf("%d of %d pids", stats.Pids, l))
+		}
+		if l := info.Limits.Memory; l > 0 && float64(stats.Memory) >= MEMORY_THRESHOLD*float64(l) {
+			report(info, VIOLATION_MEMORY, stats.Memory, l, fmt.Sprintf("%d of %d bytes of memory", stats.Memory, l))
+		}
+		if prev, ok := m.cpu[info.Id]; ok {
+			periods := stats.CPUPeriods - prev.CPUPeriods
+			throttled := stats.CPUThrottled - prev.CPUThrottled
+			if periods > 0 && float64(throttled) >= THROTTLE_THRESHOLD*float64(periods) {
+				report(info, VIOLATION_CPU, throttled, periods, fmt.Sprintf("throttled in %d of %d periods", throttled, periods))
+			}
+		}
+		cpu[info.Id] = stats
+	}
+	m.cpu = cpu // forget removed containers
+	return out, nil
+}
+
+// Run checks the instances every interval and reports
+// violations over c until ctx is done
+func (m *Monitor) Run(ctx context.Context, c *socket.Conn) {
+	t := time.NewTicker(m.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		violations, err := m.Check(ctx)
+		if err != nil {
+			log.Warn().
+				WithMeta("scope", "container").
+				Msgf("failed to check limits: %v", err).Send()
+			continue
+		}
+		for _, v := range violations {
+			log.Warn().
+				WithMeta("scope", "container").
+				WithMeta("name", v.Container).
+				WithMeta("kind", v.Kind).
+				Msg(v.Detail).Send()
+			if err := c.SendJSON(socket.ActionReportViolation, v); err != nil {
+				c.GenLogMsg().Warn().Msgf("failed to report violation: %v", err).Send()
+			}
+		}
+	}
+}
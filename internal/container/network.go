@@ -0,0 +1,74 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// The driver option naming a bridge network's host interface
+const BRIDGE_NAME_OPTION = "com.docker.network.bridge.name"
+
+// NetworkSpec describes a bridge network
+type NetworkSpec struct {
+	Name     string
+	Bridge   string // the host interface, at most 15 characters
+	Internal bool   // no route out of the network
+	Labels   map[string]string
+}
+
+// Networker is a Runtime that can manage bridge networks
+type Networker interface {
+	Runtime
+	CreateNetwork(ctx context.Context, spec NetworkSpec) error
+	RemoveNetwork(ctx context.Context, name string) error
+}
+
+func networkLabels(spec NetworkSpec) map[string]string {
+	labels := map[string]string{LABEL_MANAGED: "true"}
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (d *Docker) CreateNetwork(ctx context.Context, spec NetworkSpec) error {
+	body := map[string]any{
+		"Name":           spec.Name,
+		"Driver":         "bridge",
+		"Internal":       spec.Internal,
+		"CheckDuplicate": true,
+		"Labels":         networkLabels(spec),
+		"Options":        map[string]string{BRIDGE_NAME_OPTION: spec.Bridge},
+	}
+	return d.do(ctx, http.MethodPost, "/networks/create", nil, body, nil)
+}
+
+// RemoveNetwork removes the network name, doing nothing if it is gone
+func (d *Docker) RemoveNetwork(ctx context.Context, name string) error {
+	err := d.do(ctx, http.MethodDelete, "/networks/"+name, nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (c *Containerd) CreateNetwork(ctx context.Context, spec NetworkSpec) error {
+	args := []string{"network", "create", "--driver", "bridge", "--opt", BRIDGE_NAME_OPTION + "=" + spec.Bridge}
+	for k, v := range networkLabels(spec) {
+		args = append(args, "--label", k+"="+v)
+	}
+	if spec.Internal {
+		args = append(args, "--internal")
+	}
+	_, err := c.run(ctx, append(args, spec.Name)...)
+	return err
+}
+
+func (c *Containerd) RemoveNetwork(ctx context.Context, name string) error {
+	_, err := c.run(ctx, "network", "rm", name)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
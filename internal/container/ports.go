@@ -0,0 +1,36 @@
+package container
+
+import "fmt"
+
+// PortAllocator hands out the host ports of containers,
+// owned by the container's name. See the ports package.
+type PortAllocator interface {
+	Allocate(owner, protocol string) (int, error)
+	Reserve(owner string, port int, protocol string) error
+	Release(owner string) error
+}
+
+// AllocatePorts fills in the host ports of spec that are 0 and
+// reserves the others, releasing them all again if any fails
+func AllocatePorts(pa PortAllocator, spec Spec) (Spec, error) {
+	ports := make([]Port, len(spec.Ports))
+	for i, p := range spec.Ports {
+		protocol := p.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		var err error
+		if p.Host == 0 {
+			p.Host, err = pa.Allocate(spec.Name, protocol)
+		} else {
+			err = pa.Reserve(spec.Name, p.Host, protocol)
+		}
+		if err != nil {
+			_ = pa.Release(spec.Name)
+			return spec, fmt.Errorf("%w: port %d: %w", ErrInvalidSpec, p.Container, err)
+		}
+		ports[i] = p
+	}
+	spec.Ports = ports
+	return spec, nil
+}
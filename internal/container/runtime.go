@@ -0,0 +1,56 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	RUNTIME_DOCKER     = "docker"
+	RUNTIME_PODMAN     = "podman"
+	RUNTIME_CONTAINERD = "containerd"
+)
+
+// Runtime runs containers on the agent's host
+type Runtime interface {
+	Name() string
+
+	Pull(ctx context.Context, image string) error
+	HasImage(ctx context.Context, image string) (bool, error)
+
+	// Create creates a container from spec, pulling its image
+	// if needed, and returns its id. It is not started.
+	Create(ctx context.Context, spec Spec) (string, error)
+	Start(ctx context.Context, id string) error
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+	Remove(ctx context.Context, id string) error
+
+	Inspect(ctx context.Context, id string) (Info, error)
+	List(ctx context.Context) ([]Info, error) // every container managed by ctfjx
+}
+
+// New returns the runtime called name, connected to address.
+// An empty address uses the runtime's default.
+func New(name, address string) (Runtime, error) {
+	switch name {
+	case RUNTIME_DOCKER, "":
+		return NewDocker(address)
+	case RUNTIME_PODMAN:
+		return NewPodman(address)
+	case RUNTIME_CONTAINERD:
+		return NewContainerd(address), nil
+	}
+	return nil, fmt.Errorf("unknown container runtime %q", name)
+}
+
+// pullIfMissing pulls spec's image if it is absent or spec.Pull is set
+func pullIfMissing(ctx context.Context, rt Runtime, spec Spec) error {
+	if !spec.Pull {
+		has, err := rt.HasImage(ctx, spec.Image)
+		if err != nil || has {
+			return err
+		}
+	}
+	return rt.Pull(ctx, spec.Image)
+}
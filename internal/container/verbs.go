@@ -0,0 +1,182 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/lattesec/ctfjx/internal/tasks"
+	"github.com/lattesec/log"
+)
+
+// The task verbs the daemon deploys containers with
+const (
+	VERB_DEPLOY  = "deploy"  // args: a JSON Spec, prints the started container's Info
+	VERB_STOP    = "stop"    // args: container ids or names
+	VERB_REMOVE  = "remove"  // args: container ids or names
+	VERB_INSPECT = "inspect" // args: container ids or names, every managed container if none
+
+	// How long a status report may take to list the containers
+	REPORT_TIMEOUT = 5 * time.Second
+)
+
+// RegisterVerbs lets the daemon manage containers on rt through signed tasks.
+// Specs with Isolate set need iso, which may otherwise be nil. With pa,
+// host ports are allocated from it instead of picked by the runtime.
+func RegisterVerbs(e *tasks.Executor, rt Runtime, iso *Isolator, pa PortAllocator) {
+	e.RegisterVerb(VERB_DEPLOY, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		if len(args) != 1 {
+			return fmt.Errorf("%w: expected a single JSON spec", ErrInvalidSpec)
+		}
+		var spec Spec
+		if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+		}
+		if pa != nil && spec.Validate() == nil {
+			var err error
+			if spec, err = AllocatePorts(pa, spec); err != nil {
+				return err
+			}
+		}
+		var info Info
+		var err error
+		switch {
+		case spec.Isolate && iso == nil:
+			return fmt.Errorf("%w: network isolation is not set up", ErrInvalidSpec)
+		case spec.Isolate:
+			info, err = DeployIsolated(ctx, rt, iso, spec)
+		default:
+			info, err = Deploy(ctx, rt, spec)
+		}
+		if err != nil {
+			if pa != nil {
+				_ = pa.Release(spec.Name)
+			}
+			return err
+		}
+		return json.NewEncoder(stdout).Encode(info)
+	})
+	e.RegisterVerb(VERB_STOP, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		return forEach(args, func(id string) error { return rt.Stop(ctx, id, DEFAULT_STOP_TIMEOUT) })
+	})
+	e.RegisterVerb(VERB_REMOVE, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		return forEach(args, func(id string) error {
+			name := id
+			if info, err := rt.Inspect(ctx, id); err == nil {
+				name = info.Name
+			}
+			if err := Remove(ctx, rt, iso, id); err != nil {
+				return err
+			}
+			if pa != nil {
+				return pa.Release(name)
+			}
+			return nil
+		})
+	})
+	e.RegisterVerb(VERB_INSPECT, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		if len(args) == 0 {
+			infos, err := rt.List(ctx)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(stdout).Encode(infos)
+		}
+		infos := make([]Info, 0, len(args))
+		for _, id := range args {
+			info, err := rt.Inspect(ctx, id)
+			if err != nil {
+				return err
+			}
+			infos = append(infos, info)
+		}
+		return json.NewEncoder(stdout).Encode(infos)
+	})
+}
+
+func forEach(ids []string, fn func(id string) error) error {
+	var errs []error
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Deploy creates and starts a container from spec,
+// removing it again if it fails to start
+func Deploy(ctx context.Context, rt Runtime, spec Spec) (Info, error) {
+	id, err := rt.Create(ctx, spec)
+	if err == nil {
+		err = rt.Start(ctx, id)
+	}
+	if err != nil {
+		if id != "" {
+			_ = rt.Remove(context.WithoutCancel(ctx), id)
+		}
+		return Info{}, err
+	}
+
+	log.Info().
+		WithMeta("scope", "container").
+		WithMeta("runtime", rt.Name()).
+		WithMeta("name", spec.Name).
+		WithMeta("image", spec.Image).
+		Msgf("started container %s", id).Send()
+	return rt.Inspect(ctx, id)
+}
+
+// Remove removes the container id, and its isolated network if it has one
+func Remove(ctx context.Context, rt Runtime, iso *Isolator, id string) error {
+	info, err := rt.Inspect(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := rt.Remove(ctx, id); err != nil {
+		return err
+	}
+	if iso != nil && info.Labels[LABEL_ISOLATED] == "true" {
+		return iso.Remove(ctx, info.Name)
+	}
+	return nil
+}
+
+// AttachReporter reports the running containers of rt
+// and their health in r's status reports
+func AttachReporter(r *status.Reporter, rt Runtime) {
+	list := func() []Info {
+		ctx, cancel := context.WithTimeout(context.Background(), REPORT_TIMEOUT)
+		defer cancel()
+		infos, err := rt.List(ctx)
+		if err != nil {
+			log.Warn().
+				WithMeta("scope", "container").
+				Msgf("failed to list containers: %v", err).Send()
+		}
+		return infos
+	}
+
+	r.Instances = func() []string {
+		var names []string
+		for _, info := range list() {
+			if info.Running {
+				names = append(names, info.Name)
+			}
+		}
+		return names
+	}
+	r.Health = func() map[string]string {
+		health := make(map[string]string)
+		for _, info := range list() {
+			if info.Health != HealthNone {
+				health[info.Name] = string(info.Health)
+			}
+		}
+		return health
+	}
+}
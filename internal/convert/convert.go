@@ -0,0 +1,160 @@
+// Convert package migrates events between ctfjx and other platforms:
+// their challenges become bundles, see WriteBundle, and their
+// accounts Teams. CTFd exports are read and written, rCTF dumps and
+// kCTF challenge directories are imported. What ctfjx cannot
+// represent is reported as a Note instead of being dropped silently.
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lattesec/ctfjx/internal/challenge"
+)
+
+// Bundle directories are named after ids of at most this length
+const MAX_ID_LEN = 64
+
+var ErrBundleExists = errors.New("bundle already exists")
+
+// Note is something a conversion could not carry over as is
+type Note struct {
+	Subject string `json:"subject,omitempty"` // challenge or team it is about
+	Message string `json:"message"`
+}
+
+func (n Note) String() string {
+	if n.Subject == "" {
+		return n.Message
+	}
+	return n.Subject + ": " + n.Message
+}
+
+// notes collects the notes of a conversion
+type notes []Note
+
+func (ns *notes) add(subject, format string, args ...any) {
+	*ns = append(*ns, Note{Subject: subject, Message: fmt.Sprintf(format, args...)})
+}
+
+// File is a file of a converted bundle
+type File struct {
+	Path string      // in the bundle, slash separated
+	Mode fs.FileMode // 0644 if zero
+	Open func() (io.ReadCloser, error)
+}
+
+// Bundle is a converted challenge, with the files its spec refers to
+type Bundle struct {
+	Challenge *challenge.Challenge
+	Files     []File
+}
+
+// WriteBundle writes b into dir/<id>, which must not exist yet, and
+// loads it back so only valid bundles are left behind
+func WriteBundle(dir string, b Bundle) (c *challenge.Challenge, err error) {
+	out := filepath.Join(dir, b.Challenge.Id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(out, 0o755); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("%w: %s", ErrBundleExists, out)
+		}
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(out)
+		}
+	}()
+
+	data, err := yaml.Marshal(b.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(out, challenge.FILENAME), data, 0o644); err != nil {
+		return nil, err
+	}
+	for _, f := range b.Files {
+		if err := writeFile(out, f); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+	return challenge.Load(out)
+}
+
+func writeFile(dir string, f File) error {
+	if !filepath.IsLocal(filepath.FromSlash(f.Path)) {
+		return fmt.Errorf("%w: %q is outside the challenge", challenge.ErrInvalidChallenge, f.Path)
+	}
+	pth := filepath.Join(dir, filepath.FromSlash(f.Path))
+	if err := os.MkdirAll(filepath.Dir(pth), 0o755); err != nil {
+		return err
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	mode := f.Mode.Perm()
+	if mode == 0 {
+		mode = 0o644
+	}
+	w, err := os.OpenFile(pth, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// ids hands out unique challenge ids made from names
+type ids map[string]bool
+
+// next returns the id of name, suffixed with a number if taken
+func (taken ids) next(name string) string {
+	base := slug(name)
+	id := base
+	for i := 2; taken[id]; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		id = strings.TrimRight(base[:min(len(base), MAX_ID_LEN-len(suffix))], "-_") + suffix
+	}
+	taken[id] = true
+	return id
+}
+
+// slug turns name into a challenge id, e.g. "Baby Heap!" into baby-heap
+func slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+		if b.Len() >= MAX_ID_LEN {
+			break
+		}
+	}
+	s := strings.TrimRight(b.String()[:min(b.Len(), MAX_ID_LEN)], "-")
+	if s == "" {
+		return "challenge"
+	}
+	return s
+}
@@ -0,0 +1,291 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/scoring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIds(t *testing.T) {
+	taken := make(ids)
+	assert.Equal(t, "baby-heap", taken.next("Baby Heap!"))
+	assert.Equal(t, "baby-heap-2", taken.next("baby heap"))
+	assert.Equal(t, "challenge", taken.next("???"))
+	assert.Len(t, taken.next(string(bytes.Repeat([]byte("a"), 100))), MAX_ID_LEN)
+}
+
+// ctfdExport zips files as a CTFd export
+func ctfdExport(t *testing.T, files map[string]string) *CTFd {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	a, err := ReadCTFd(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	return a
+}
+
+func checker(t *testing.T, c *challenge.Challenge) *flags.Checker {
+	spec, err := c.FlagSpec()
+	require.NoError(t, err)
+	checker, err := flags.Compile(c.Id, spec, nil)
+	require.NoError(t, err)
+	return checker
+}
+
+func accepts(t *testing.T, c *challenge.Challenge, submitted string) bool {
+	ok, err := checker(t, c).Check(submitted, "")
+	require.NoError(t, err)
+	return ok
+}
+
+func TestCTFd(t *testing.T) {
+	a := ctfdExport(t, map[string]string{
+		"db/alembic_version.json": `{"count": 1, "results": [{"version_num": "abc123"}], "meta": {}}`,
+		"db/challenges.json": `{"count": 4, "results": [
+			{"id": 1, "name": "Warmup", "description": "easy", "value": 100, "category": "Misc", "type": "standard", "state": "visible", "requirements": null},
+			{"id": 2, "name": "Baby Heap", "description": "pwn it", "connection_info": "nc pwn.ctf 1337", "value": 0, "category": "pwn", "type": "dynamic", "state": "hidden", "max_attempts": 5, "requirements": "{\"prerequisites\": [1, 3]}"},
+			{"id": 3, "name": "Lost", "value": 50, "category": "misc", "type": "standard", "state": "visible"},
+			{"id": 4, "name": "Later", "value": 50, "category": "", "type": "standard", "state": "visible", "requirements": {"prerequisites": [2]}}
+		], "meta": {}}`,
+		"db/dynamic_challenge.json": `{"count": 1, "results": [{"id": 2, "initial": 500, "minimum": 100, "decay": 20, "function": "logarithmic"}], "meta": {}}`,
+		"db/flags.json": `{"count": 4, "results": [
+			{"id": 1, "challenge_id": 1, "type": "static", "content": "ctfjx{warm}", "data": "case_insensitive"},
+			{"id": 2, "challenge_id": 2, "type": "static", "content": "ctfjx{heap.}", "data": ""},
+			{"id": 3, "challenge_id": 2, "type": "regex", "content": "ctfjx\\{h[e3]ap\\}", "data": "case_insensitive"},
+			{"id": 4, "challenge_id": 4, "type": "static", "content": "ctfjx{later}", "data": null}
+		], "meta": {}}`,
+		"db/files.json": `{"count": 2, "results": [
+			{"id": 1, "type": "challenge", "location": "0a1b/chall", "challenge_id": 2},
+			{"id": 2, "type": "page", "location": "ffff/logo.png", "challenge_id": null}
+		], "meta": {}}`,
+		"uploads/0a1b/chall":    "ELF",
+		"uploads/ffff/logo.png": "PNG",
+		"db/tags.json":          `{"count": 1, "results": [{"id": 1, "challenge_id": 2, "value": "heap"}], "meta": {}}`,
+		"db/hints.json":         `{"count": 1, "results": [{"id": 1, "challenge_id": 2, "content": "tcache", "cost": 10}], "meta": {}}`,
+		"db/users.json": `{"count": 4, "results": [
+			{"id": 1, "name": "admin", "type": "admin", "hidden": 1, "banned": 0, "team_id": null},
+			{"id": 2, "name": "alice", "email": "a@x", "password": "$bcrypt-sha256$x", "type": "user", "hidden": 0, "banned": 0, "team_id": 1},
+			{"id": 3, "name": "bob", "type": "user", "hidden": false, "banned": false, "team_id": 1},
+			{"id": 4, "name": "carol", "type": "user", "country": "FR", "hidden": false, "banned": true, "team_id": null}
+		], "meta": {}}`,
+		"db/teams.json":  `{"count": 1, "results": [{"id": 1, "name": "latte", "affiliation": "uni", "hidden": 0, "banned": 0, "captain_id": 3}], "meta": {}}`,
+		"db/awards.json": `{"count": 0, "results": [], "meta": {}}`,
+	})
+	assert.Equal(t, "abc123", a.Alembic)
+
+	bundles, notes := a.Bundles()
+	require.Len(t, bundles, 3, "challenges without a flag are left out")
+	var messages []string
+	for _, n := range notes {
+		messages = append(messages, n.String())
+	}
+	assert.Contains(t, messages, "lost: not imported: invalid flag: no flag ctfjx can check")
+	assert.Contains(t, messages, "baby-heap: is hidden in CTFd but visible once imported")
+	assert.Contains(t, messages, "baby-heap: 1 hints are not supported and were dropped")
+	assert.Contains(t, messages, "baby-heap: requirement on challenge 3 dropped, it was not imported")
+	assert.Contains(t, messages, "later: has no category, imported in misc")
+
+	dir := t.TempDir()
+	cs := make(map[string]*challenge.Challenge)
+	for _, b := range bundles {
+		c, err := WriteBundle(dir, b)
+		require.NoError(t, err)
+		cs[c.Id] = c
+	}
+	_, err := WriteBundle(dir, bundles[0])
+	assert.ErrorIs(t, err, ErrBundleExists)
+
+	warmup := cs["warmup"]
+	assert.Equal(t, "misc", warmup.Category)
+	assert.True(t, accepts(t, warmup, "CTFJX{WARM}"))
+
+	heap := cs["baby-heap"]
+	assert.Equal(t, 500, heap.Points)
+	assert.Equal(t, &challenge.Scoring{Formula: scoring.Logarithmic, Minimum: 100, Decay: 20}, heap.Scoring)
+	assert.Equal(t, "pwn it\n\nnc pwn.ctf 1337", heap.Description)
+	assert.Equal(t, []string{"heap"}, heap.Tags)
+	assert.Equal(t, &challenge.Unlock{After: []string{"warmup"}}, heap.Unlock)
+	assert.True(t, accepts(t, heap, "ctfjx{heap.}"))
+	assert.False(t, accepts(t, heap, "CTFJX{HEAP.}"), "only the flag marked so is case insensitive")
+	assert.False(t, accepts(t, heap, "ctfjx{heapx}"), "static flags are not regexes")
+	assert.True(t, accepts(t, heap, "CTFJX{H3AP}"))
+	require.Len(t, heap.Attachments, 1)
+	assert.Equal(t, "chall", heap.Attachments[0].Name)
+	assert.FileExists(t, filepath.Join(dir, "baby-heap", "dist", "chall"))
+	assert.Equal(t, &challenge.Unlock{After: []string{"baby-heap"}}, cs["later"].Unlock)
+
+	teams, notes := a.Accounts()
+	assert.Equal(t, []Note{{Subject: "admin", Message: "admin has no team and was not imported"}}, notes)
+	assert.Equal(t, []Team{
+		{Name: "latte", Affiliation: "uni", Members: []Member{
+			{Name: "alice", Email: "a@x", PasswordHash: "$bcrypt-sha256$x"},
+			{Name: "bob", Captain: true},
+		}},
+		{Name: "carol", Country: "FR", Banned: true, Members: []Member{{Name: "carol", Captain: true}}},
+	}, teams)
+
+	t.Run("export", func(t *testing.T) {
+		teamsFile := filepath.Join(t.TempDir(), TEAMS_FILENAME)
+		require.NoError(t, WriteTeams(teamsFile, teams))
+		teams, err := ReadTeams(teamsFile)
+		require.NoError(t, err)
+
+		graph, err := challenge.LoadAll(dir)
+		require.NoError(t, err)
+		out, notes, err := ExportCTFd(graph.Challenges(), teams)
+		require.NoError(t, err)
+		assert.Empty(t, notes)
+		out.Alembic = a.Alembic
+
+		var buf bytes.Buffer
+		require.NoError(t, out.Write(&buf))
+		back, err := ReadCTFd(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		assert.Equal(t, a.Alembic, back.Alembic)
+		assert.Len(t, back.Files, 1)
+		assert.Len(t, back.uploads, 1)
+
+		again, notes := back.Bundles()
+		assert.Empty(t, notes)
+		dir := t.TempDir()
+		for _, b := range again {
+			c, err := WriteBundle(dir, b)
+			require.NoError(t, err)
+			assert.Equal(t, cs[c.Id].Name, c.Name)
+			assert.Equal(t, cs[c.Id].Points, c.Points)
+			assert.Equal(t, cs[c.Id].Scoring, c.Scoring)
+			assert.Equal(t, cs[c.Id].Flag, c.Flag)
+			assert.Equal(t, cs[c.Id].Unlock, c.Unlock)
+			assert.Len(t, c.Attachments, len(cs[c.Id].Attachments))
+		}
+		roundTrip, notes := back.Accounts()
+		assert.Empty(t, notes)
+		assert.Equal(t, teams, roundTrip)
+	})
+}
+
+func TestNotCTFd(t *testing.T) {
+	_, err := ReadCTFd(bytes.NewReader([]byte("nope")), 4)
+	assert.ErrorIs(t, err, ErrNotCTFd)
+}
+
+func TestRCTF(t *testing.T) {
+	cs, err := ReadRCTF([]byte(`{"kind": "goodChallenges", "message": "ok", "data": [
+		{"id": "web-notes", "name": "Notes", "description": "take notes", "category": "web", "author": "latte",
+		 "files": [{"name": "notes.zip", "url": "https://files.example/abc/notes.zip"}],
+		 "points": {"min": 100, "max": 500}, "flag": "ctfjx{notes}", "tiebreakEligible": false},
+		{"id": "noflag", "name": "No Flag", "category": "misc", "points": {"min": 1, "max": 1}}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, cs, 2)
+	_, err = ReadRCTF([]byte(`{"kind": "badToken"}`))
+	assert.Error(t, err)
+
+	var fetched []string
+	fetch := func(url string) (io.ReadCloser, error) {
+		fetched = append(fetched, url)
+		return io.NopCloser(strings.NewReader("zip")), nil
+	}
+	bundles, notes := RCTFBundles(cs, fetch)
+	require.Len(t, bundles, 1)
+	assert.Contains(t, notes, Note{Subject: "noflag", Message: "not imported: it has no flag"})
+	assert.Contains(t, notes, Note{Subject: "web-notes", Message: "dynamic scoring from 500 down to 100 is imported as 500 static points"})
+	assert.Contains(t, notes, Note{Subject: "web-notes", Message: "excluding it from tiebreaks is not supported"})
+
+	c, err := WriteBundle(t.TempDir(), bundles[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Notes", c.Name)
+	assert.Equal(t, 500, c.Points)
+	assert.Equal(t, []string{"latte"}, c.Authors)
+	assert.Equal(t, "notes.zip", c.Attachments[0].Name)
+	assert.Equal(t, []string{"https://files.example/abc/notes.zip"}, fetched)
+
+	_, notes = RCTFBundles(cs, nil)
+	assert.Contains(t, notes, Note{Subject: "web-notes", Message: "attachment notes.zip was not downloaded from https://files.example/abc/notes.zip"})
+}
+
+func TestKCTF(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string, mode os.FileMode) {
+		pth := filepath.Join(root, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0o755))
+		require.NoError(t, os.WriteFile(pth, []byte(content), mode))
+	}
+	write("pwn/baby/challenge.yaml", `apiVersion: kctf.dev/v1
+kind: Challenge
+metadata:
+  name: baby
+spec:
+  deployed: true
+  powDifficultySeconds: 10
+  network:
+    public: true
+    ports:
+      - protocol: "TCP"
+        targetPort: 1337
+        port: 1
+  healthcheck:
+    enabled: true
+  podTemplate:
+    template:
+      spec:
+        containers:
+          - name: challenge
+            resources:
+              limits:
+                cpu: 500m
+                memory: 256Mi
+`, 0o644)
+	write("pwn/baby/challenge/Dockerfile", "FROM gcr.io/kctf-docker/challenge@sha256:0\nCOPY chal /home/user/\n", 0o644)
+	write("pwn/baby/challenge/chal", "ELF", 0o755)
+	write("pwn/baby/challenge/flag", "ctfjx{baby}\n", 0o644)
+	write("pwn/baby/healthcheck/healthcheck.py", "print('ok')", 0o755)
+	write("pwn/baby/attachments/chal", "ELF", 0o644)
+	write("web/noflag/challenge.yaml", "apiVersion: kctf.dev/v1\nkind: Challenge\nmetadata:\n  name: noflag\n", 0o644)
+	write("k8s/challenge.yaml", "apiVersion: apps/v1\nkind: Deployment\n", 0o644)
+
+	bundles, notes, err := KCTFBundles(root)
+	require.NoError(t, err)
+	require.Len(t, bundles, 1)
+	assert.Contains(t, notes, Note{Subject: "baby", Message: "its image runs nsjail, which needs privileged containers ctfjx does not run, rebase it on a plain image"})
+	assert.Contains(t, notes, Note{Subject: "baby", Message: "proof of work before connecting (10s) is not supported"})
+	assert.Contains(t, notes, Note{Subject: "baby", Message: "its healthcheck solver runs in an image of its own, port it to a solve script"})
+	assert.Contains(t, notes, Note{Subject: filepath.Join(root, "web", "noflag"), Message: "not imported: no challenge/flag to read its flag from"})
+
+	dir := t.TempDir()
+	c, err := WriteBundle(dir, bundles[0])
+	require.NoError(t, err)
+	assert.Equal(t, "baby", c.Id)
+	flag, err := c.FlagValue()
+	require.NoError(t, err)
+	assert.Equal(t, "ctfjx{baby}", flag)
+	assert.Equal(t, "challenge", c.Deploy.Build)
+	assert.Equal(t, []challenge.Port{{Port: 1337, Protocol: challenge.PROTOCOL_TCP}}, c.Deploy.Ports)
+	assert.Equal(t, challenge.Limits{CPUs: 0.5, Memory: 256 * env.MiB}, c.Deploy.Limits)
+	assert.Equal(t, challenge.HealthcheckTCP, c.Healthcheck.Type)
+	assert.Equal(t, []challenge.Attachment{{Path: "attachments/chal", Name: "chal"}}, c.Attachments)
+	assert.FileExists(t, filepath.Join(dir, "baby", "kctf.yaml"))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dir, "baby", "challenge", "chal"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm(), "modes are kept")
+	}
+}
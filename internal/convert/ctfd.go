@@ -0,0 +1,681 @@
+package convert
+
+import (
+	"archive/zip"
+	"cmp"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/scoring"
+)
+
+// CTFd exports are zips of a JSON file per table, db/<table>.json
+// holding {"count": n, "results": [rows], "meta": {}}, next to the
+// uploaded files in uploads/<location>
+const (
+	CTFD_DB_DIR      = "db/"
+	CTFD_UPLOADS_DIR = "uploads/"
+
+	// Data of case insensitive flags
+	CTFD_CASE_INSENSITIVE = "case_insensitive"
+)
+
+var ErrNotCTFd = errors.New("not a CTFd export")
+
+// CTFd is a CTFd export, reduced to the tables ctfjx has a use for
+type CTFd struct {
+	Challenges []CTFdChallenge
+	Dynamic    []CTFdDynamic // scoring of dynamic challenges
+	Flags      []CTFdFlag
+	Files      []CTFdFile
+	Tags       []CTFdTag
+	Hints      []CTFdHint
+	Users      []CTFdUser
+	Teams      []CTFdTeam
+
+	// Database migration the export is at, CTFd only imports
+	// exports of its own version
+	Alembic string
+
+	uploads map[string]func() (io.ReadCloser, error) // location -> content
+}
+
+type CTFdChallenge struct {
+	Id             int    `json:"id"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	ConnectionInfo string `json:"connection_info,omitempty"`
+	MaxAttempts    int    `json:"max_attempts"`
+	Value          int    `json:"value"`
+	Category       string `json:"category"`
+	Type           string `json:"type"`  // standard or dynamic, or a plugin's
+	State          string `json:"state"` // visible or hidden
+	// {"prerequisites": [challenge ids]}, or that as a string
+	Requirements json.RawMessage `json:"requirements,omitempty"`
+}
+
+// CTFdDynamic is the scoring of a dynamic challenge
+type CTFdDynamic struct {
+	Id       int    `json:"id"`
+	Initial  int    `json:"initial"`
+	Minimum  int    `json:"minimum"`
+	Decay    int    `json:"decay"`
+	Function string `json:"function,omitempty"`
+}
+
+type CTFdFlag struct {
+	Id          int    `json:"id"`
+	ChallengeId int    `json:"challenge_id"`
+	Type        string `json:"type"` // static or regex
+	Content     string `json:"content"`
+	Data        string `json:"data,omitempty"` // CTFD_CASE_INSENSITIVE or empty
+}
+
+type CTFdFile struct {
+	Id          int    `json:"id"`
+	Type        string `json:"type"`     // challenge or page
+	Location    string `json:"location"` // <directory>/<name> in uploads
+	ChallengeId int    `json:"challenge_id,omitempty"`
+	SHA1        string `json:"sha1sum,omitempty"`
+}
+
+type CTFdTag struct {
+	Id          int    `json:"id"`
+	ChallengeId int    `json:"challenge_id"`
+	Value       string `json:"value"`
+}
+
+type CTFdHint struct {
+	Id          int    `json:"id"`
+	ChallengeId int    `json:"challenge_id"`
+	Content     string `json:"content"`
+	Cost        int    `json:"cost"`
+}
+
+type CTFdUser struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Email       string   `json:"email,omitempty"`
+	Password    string   `json:"password,omitempty"` // hash
+	Type        string   `json:"type"`               // user or admin
+	Website     string   `json:"website,omitempty"`
+	Affiliation string   `json:"affiliation,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	Hidden      ctfdBool `json:"hidden"`
+	Banned      ctfdBool `json:"banned"`
+	TeamId      int      `json:"team_id,omitempty"`
+}
+
+type CTFdTeam struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Email       string   `json:"email,omitempty"`
+	Website     string   `json:"website,omitempty"`
+	Affiliation string   `json:"affiliation,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	Hidden      ctfdBool `json:"hidden"`
+	Banned      ctfdBool `json:"banned"`
+	CaptainId   int      `json:"captain_id,omitempty"`
+}
+
+// ctfdBool is a boolean column, exported as 0 and 1 from MySQL
+type ctfdBool bool
+
+func (b *ctfdBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", "1":
+		*b = true
+	case "false", "0", "null":
+		*b = false
+	default:
+		return fmt.Errorf("bad boolean %s", data)
+	}
+	return nil
+}
+
+type ctfdTable struct {
+	Count   int             `json:"count"`
+	Results json.RawMessage `json:"results"`
+	Meta    struct{}        `json:"meta"`
+}
+
+type ctfdAlembic struct {
+	Version string `json:"version_num"`
+}
+
+func (a *CTFd) tables(alembic *[]ctfdAlembic) map[string]any {
+	return map[string]any{
+		"challenges":        &a.Challenges,
+		"dynamic_challenge": &a.Dynamic,
+		"flags":             &a.Flags,
+		"files":             &a.Files,
+		"tags":              &a.Tags,
+		"hints":             &a.Hints,
+		"users":             &a.Users,
+		"teams":             &a.Teams,
+		"alembic_version":   alembic,
+	}
+}
+
+// ReadCTFd reads the CTFd export in r, of size bytes
+func ReadCTFd(r io.ReaderAt, size int64) (*CTFd, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotCTFd, err)
+	}
+	a := &CTFd{uploads: make(map[string]func() (io.ReadCloser, error))}
+	var alembic []ctfdAlembic
+	tables, found := a.tables(&alembic), false
+	for _, f := range zr.File {
+		switch {
+		case strings.HasPrefix(f.Name, CTFD_UPLOADS_DIR) && !f.FileInfo().IsDir():
+			a.uploads[strings.TrimPrefix(f.Name, CTFD_UPLOADS_DIR)] = f.Open
+		case strings.HasPrefix(f.Name, CTFD_DB_DIR) && path.Ext(f.Name) == ".json":
+			found = true
+			dst, ok := tables[strings.TrimSuffix(strings.TrimPrefix(f.Name, CTFD_DB_DIR), ".json")]
+			if !ok {
+				continue
+			}
+			if err := readTable(f, dst); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: no %s", ErrNotCTFd, CTFD_DB_DIR)
+	}
+	if len(alembic) > 0 {
+		a.Alembic = alembic[0].Version
+	}
+	return a, nil
+}
+
+func readTable(f *zip.File, dst any) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var t ctfdTable
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return err
+	}
+	if len(t.Results) == 0 {
+		return nil
+	}
+	return json.Unmarshal(t.Results, dst)
+}
+
+// Write writes a as a zip CTFd can import
+func (a *CTFd) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	var alembic []ctfdAlembic
+	if a.Alembic != "" {
+		alembic = []ctfdAlembic{{Version: a.Alembic}}
+	}
+	tables := a.tables(&alembic)
+	for _, name := range slices.Sorted(maps.Keys(tables)) {
+		if name == "alembic_version" && a.Alembic == "" {
+			continue
+		}
+		if err := writeTable(zw, name, tables[name]); err != nil {
+			return err
+		}
+	}
+	for _, location := range slices.Sorted(maps.Keys(a.uploads)) {
+		if err := writeUpload(zw, location, a.uploads[location]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTable(zw *zip.Writer, name string, rows any) error {
+	results, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	var count []json.RawMessage
+	if err := json.Unmarshal(results, &count); err != nil {
+		return err
+	}
+	if count == nil {
+		results = []byte("[]")
+	}
+	w, err := zw.Create(CTFD_DB_DIR + name + ".json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(ctfdTable{Count: len(count), Results: results})
+}
+
+func writeUpload(zw *zip.Writer, location string, open func() (io.ReadCloser, error)) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := zw.Create(CTFD_UPLOADS_DIR + location)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func byId[T any](rows []T, id func(T) int) []T {
+	return slices.SortedFunc(slices.Values(rows), func(a, b T) int { return cmp.Compare(id(a), id(b)) })
+}
+
+// prerequisites returns the ids of the challenges c requires
+func (c CTFdChallenge) prerequisites() ([]int, error) {
+	raw := c.Requirements
+	// some databases export JSON columns as strings
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		raw = []byte(s)
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var r struct {
+		Prerequisites []int `json:"prerequisites"`
+	}
+	err := json.Unmarshal(raw, &r)
+	return r.Prerequisites, err
+}
+
+// Bundles converts the challenges of a. Challenges whose flags
+// ctfjx cannot check are left out, with a note.
+func (a *CTFd) Bundles() ([]Bundle, []Note) {
+	var ns notes
+	flagsOf := make(map[int][]CTFdFlag)
+	for _, f := range byId(a.Flags, func(f CTFdFlag) int { return f.Id }) {
+		flagsOf[f.ChallengeId] = append(flagsOf[f.ChallengeId], f)
+	}
+	filesOf := make(map[int][]CTFdFile)
+	for _, f := range byId(a.Files, func(f CTFdFile) int { return f.Id }) {
+		if f.Type == "challenge" {
+			filesOf[f.ChallengeId] = append(filesOf[f.ChallengeId], f)
+		}
+	}
+	tagsOf := make(map[int][]string)
+	for _, t := range byId(a.Tags, func(t CTFdTag) int { return t.Id }) {
+		tagsOf[t.ChallengeId] = append(tagsOf[t.ChallengeId], t.Value)
+	}
+	hints := make(map[int]int)
+	for _, h := range a.Hints {
+		hints[h.ChallengeId]++
+	}
+	dynamic := make(map[int]CTFdDynamic)
+	for _, d := range a.Dynamic {
+		dynamic[d.Id] = d
+	}
+
+	var (
+		out       []Bundle
+		converted = make(map[int]*challenge.Challenge)
+		taken     = make(ids)
+		rows      = byId(a.Challenges, func(c CTFdChallenge) int { return c.Id })
+	)
+	for _, row := range rows {
+		id := taken.next(row.Name)
+		flag, err := ctfdFlag(flagsOf[row.Id], id, &ns)
+		if err != nil {
+			ns.add(id, "not imported: %v", err)
+			continue
+		}
+		c := &challenge.Challenge{
+			Version:     challenge.SPEC_VERSION,
+			Id:          id,
+			Name:        row.Name,
+			Category:    row.Category,
+			Points:      row.Value,
+			Description: row.Description,
+			Tags:        tagsOf[row.Id],
+			Flag:        flag,
+		}
+		if strings.TrimSpace(c.Category) == "" {
+			c.Category = "misc"
+			ns.add(id, "has no category, imported in %s", c.Category)
+		}
+		switch row.Type {
+		case "standard":
+		case "dynamic":
+			d := dynamic[row.Id]
+			c.Points = d.Initial
+			c.Scoring = importScoring(d, id, &ns)
+		default:
+			ns.add(id, "%s challenges are imported as standard ones", row.Type)
+		}
+		if row.State != "" && row.State != "visible" {
+			ns.add(id, "is %s in CTFd but visible once imported", row.State)
+		}
+		if row.MaxAttempts > 0 {
+			ns.add(id, "max attempts (%d) are not supported", row.MaxAttempts)
+		}
+		if info := strings.TrimSpace(row.ConnectionInfo); info != "" {
+			c.Description = strings.TrimSpace(c.Description + "\n\n" + info)
+			ns.add(id, "connection info %q is kept in the description, give it a deploy section to host its service", info)
+		}
+		if n := hints[row.Id]; n > 0 {
+			ns.add(id, "%d hints are not supported and were dropped", n)
+		}
+
+		b := Bundle{Challenge: c}
+		names := make(map[string]bool)
+		for _, f := range filesOf[row.Id] {
+			open, ok := a.uploads[f.Location]
+			if !ok {
+				ns.add(id, "attachment %s is missing from the export", f.Location)
+				continue
+			}
+			name := path.Base(f.Location)
+			if names[name] {
+				name = strconv.Itoa(f.Id) + "-" + name
+			}
+			names[name] = true
+			c.Attachments = append(c.Attachments, challenge.Attachment{Path: "dist/" + name, Name: path.Base(f.Location)})
+			b.Files = append(b.Files, File{Path: "dist/" + name, Open: open})
+		}
+		converted[row.Id] = c
+		out = append(out, b)
+	}
+
+	// prerequisites may come later and may not have been imported
+	for _, row := range rows {
+		c, ok := converted[row.Id]
+		if !ok {
+			continue
+		}
+		prerequisites, err := row.prerequisites()
+		if err != nil {
+			ns.add(c.Id, "unreadable requirements dropped: %v", err)
+			continue
+		}
+		for _, pid := range prerequisites {
+			p, ok := converted[pid]
+			if !ok {
+				ns.add(c.Id, "requirement on challenge %d dropped, it was not imported", pid)
+				continue
+			}
+			if c.Unlock == nil {
+				c.Unlock = &challenge.Unlock{}
+			}
+			c.Unlock.After = append(c.Unlock.After, p.Id)
+		}
+	}
+	return out, ns
+}
+
+// ctfdFlag converts the flags of a challenge. ctfjx has one flag per
+// challenge, several become a regex matching any of them.
+func ctfdFlag(rows []CTFdFlag, id string, ns *notes) (challenge.Flag, error) {
+	var alternatives []string
+	for _, f := range rows {
+		insensitive := f.Data == CTFD_CASE_INSENSITIVE
+		var expr string
+		switch f.Type {
+		case "static":
+			if len(rows) == 1 {
+				return challenge.Flag{Type: challenge.FlagStatic, Value: f.Content, CaseInsensitive: insensitive}, nil
+			}
+			expr = regexp.QuoteMeta(f.Content)
+		case "regex":
+			if len(rows) == 1 {
+				flag := challenge.Flag{Type: challenge.FlagRegex, Value: f.Content, CaseInsensitive: insensitive}
+				return flag, flags.Spec{Type: flag.Type, Value: flag.Value, CaseInsensitive: insensitive}.Validate()
+			}
+			expr = f.Content
+		default:
+			ns.add(id, "%s flag %d is not supported and was dropped", f.Type, f.Id)
+			continue
+		}
+		if insensitive {
+			alternatives = append(alternatives, "(?i:"+expr+")")
+		} else {
+			alternatives = append(alternatives, "(?:"+expr+")")
+		}
+	}
+	if len(alternatives) == 0 {
+		return challenge.Flag{}, fmt.Errorf("%w: no flag ctfjx can check", flags.ErrInvalidFlag)
+	}
+	flag := challenge.Flag{Type: challenge.FlagRegex, Value: strings.Join(alternatives, "|")}
+	return flag, flags.Spec{Type: flag.Type, Value: flag.Value}.Validate()
+}
+
+// Accounts converts the accounts of a. Players outside of teams, as in
+// CTFd's user mode, become teams of one.
+func (a *CTFd) Accounts() ([]Team, []Note) {
+	var ns notes
+	captains := make(map[int]int)
+	known := make(map[int]bool)
+	for _, t := range a.Teams {
+		captains[t.Id], known[t.Id] = t.CaptainId, true
+	}
+
+	var solo []Team
+	members := make(map[int][]Member)
+	for _, u := range byId(a.Users, func(u CTFdUser) int { return u.Id }) {
+		m := Member{Name: u.Name, Email: u.Email, PasswordHash: u.Password, Admin: u.Type == "admin"}
+		switch {
+		case u.TeamId == 0 && m.Admin:
+			ns.add(u.Name, "admin has no team and was not imported")
+		case u.TeamId == 0:
+			m.Captain = true
+			solo = append(solo, Team{
+				Name: u.Name, Email: u.Email, Affiliation: u.Affiliation, Country: u.Country, Website: u.Website,
+				Hidden: bool(u.Hidden), Banned: bool(u.Banned), Members: []Member{m},
+			})
+		case !known[u.TeamId]:
+			ns.add(u.Name, "member of unknown team %d, not imported", u.TeamId)
+		default:
+			m.Captain = captains[u.TeamId] == u.Id
+			members[u.TeamId] = append(members[u.TeamId], m)
+		}
+	}
+
+	var out []Team
+	for _, t := range byId(a.Teams, func(t CTFdTeam) int { return t.Id }) {
+		out = append(out, Team{
+			Name: t.Name, Email: t.Email, Affiliation: t.Affiliation, Country: t.Country, Website: t.Website,
+			Hidden: bool(t.Hidden), Banned: bool(t.Banned), Members: members[t.Id],
+		})
+	}
+	return append(out, solo...), ns
+}
+
+// ExportCTFd converts challenges and teams to a CTFd export, set its
+// Alembic to the migration of the CTFd it is imported into
+func ExportCTFd(cs []*challenge.Challenge, teams []Team) (*CTFd, []Note, error) {
+	var ns notes
+	a := &CTFd{uploads: make(map[string]func() (io.ReadCloser, error))}
+	cs = slices.SortedFunc(slices.Values(cs), func(a, b *challenge.Challenge) int { return strings.Compare(a.Id, b.Id) })
+	ctfdIds := make(map[string]int, len(cs))
+	for i, c := range cs {
+		ctfdIds[c.Id] = i + 1
+	}
+
+	for _, c := range cs {
+		row := CTFdChallenge{
+			Id:          ctfdIds[c.Id],
+			Name:        c.Name,
+			Description: c.Description,
+			Value:       c.Points,
+			Category:    c.Category,
+			Type:        "standard",
+			State:       "visible",
+		}
+		if err := exportFlag(a, c, row.Id, &ns); err != nil {
+			return nil, nil, err
+		}
+		exportScoring(a, c, &row, &ns)
+		if c.Deploy != nil {
+			ns.add(c.Id, "its service is not deployed by CTFd, fill in its connection info once hosted")
+		}
+		if u := c.Unlock; u != nil {
+			switch {
+			case len(u.Categories) > 0:
+				ns.add(c.Id, "unlocking by solves in categories is not supported, it is visible from the start")
+			case u.Any && len(u.After) > 1:
+				ns.add(c.Id, "unlocking by any of several challenges is not supported, it is visible from the start")
+			default:
+				var r struct {
+					Prerequisites []int `json:"prerequisites"`
+				}
+				for _, id := range u.After {
+					r.Prerequisites = append(r.Prerequisites, ctfdIds[id])
+				}
+				data, err := json.Marshal(r)
+				if err != nil {
+					return nil, nil, err
+				}
+				row.Requirements = data
+			}
+		}
+		for _, tag := range c.Tags {
+			a.Tags = append(a.Tags, CTFdTag{Id: len(a.Tags) + 1, ChallengeId: row.Id, Value: tag})
+		}
+		for _, at := range c.Attachments {
+			if err := exportAttachment(a, c, at, row.Id, &ns); err != nil {
+				return nil, nil, err
+			}
+		}
+		a.Challenges = append(a.Challenges, row)
+	}
+
+	for _, t := range teams {
+		team := CTFdTeam{
+			Id: len(a.Teams) + 1, Name: t.Name, Email: t.Email, Affiliation: t.Affiliation, Country: t.Country,
+			Website: t.Website, Hidden: ctfdBool(t.Hidden), Banned: ctfdBool(t.Banned),
+		}
+		for _, m := range t.Members {
+			u := CTFdUser{Id: len(a.Users) + 1, Name: m.Name, Email: m.Email, Password: m.PasswordHash, Type: "user", TeamId: team.Id}
+			if m.Admin {
+				u.Type = "admin"
+			}
+			if m.Captain && team.CaptainId == 0 {
+				team.CaptainId = u.Id
+			}
+			a.Users = append(a.Users, u)
+		}
+		if team.CaptainId == 0 && len(t.Members) > 0 {
+			team.CaptainId = len(a.Users) - len(t.Members) + 1
+		}
+		a.Teams = append(a.Teams, team)
+	}
+	return a, ns, nil
+}
+
+func exportFlag(a *CTFd, c *challenge.Challenge, challengeId int, ns *notes) error {
+	spec, err := c.FlagSpec()
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Id, err)
+	}
+	if spec.Type == flags.Dynamic {
+		ns.add(c.Id, "dynamic flags cannot be checked by CTFd, it has no flag")
+		return nil
+	}
+	f := CTFdFlag{Id: len(a.Flags) + 1, ChallengeId: challengeId, Type: string(spec.Type), Content: spec.Value}
+	if spec.CaseInsensitive {
+		f.Data = CTFD_CASE_INSENSITIVE
+	}
+	a.Flags = append(a.Flags, f)
+	return nil
+}
+
+// importScoring converts the scoring of a dynamic challenge, which
+// CTFd decays logarithmically by default
+func importScoring(d CTFdDynamic, id string, ns *notes) *challenge.Scoring {
+	sc := &challenge.Scoring{Minimum: min(d.Minimum, d.Initial), Decay: float64(d.Decay)}
+	switch d.Function {
+	case "", "logarithmic":
+		sc.Formula = scoring.Logarithmic
+	case "linear":
+		sc.Formula = scoring.Linear
+	default:
+		ns.add(id, "%s dynamic scoring is imported as %d static points", d.Function, d.Initial)
+		return nil
+	}
+	if err := sc.Validate(); err != nil {
+		ns.add(id, "dynamic scoring from %d down to %d (decay %d) is imported as %d static points: %v", d.Initial, d.Minimum, d.Decay, d.Initial, err)
+		return nil
+	}
+	return sc
+}
+
+// exportScoring makes row dynamic if c decays the way CTFd can
+func exportScoring(a *CTFd, c *challenge.Challenge, row *CTFdChallenge, ns *notes) {
+	sc := c.Scoring
+	if sc == nil || sc.Formula == scoring.Static {
+		return
+	}
+	d := CTFdDynamic{Id: row.Id, Initial: c.Points, Minimum: sc.Minimum, Decay: int(math.Round(sc.Decay))}
+	switch {
+	case sc.Formula == scoring.Linear:
+		d.Function = "linear"
+	case sc.Formula == scoring.Logarithmic,
+		sc.Formula == scoring.Parametric && (sc.Exponent == 0 || sc.Exponent == scoring.DEFAULT_EXPONENT):
+		d.Function = "logarithmic"
+	default:
+		ns.add(c.Id, "%s scoring with exponent %g is not supported, it is worth %d static points", sc.Formula, sc.Exponent, c.Points)
+		return
+	}
+	if d.Decay < 1 {
+		ns.add(c.Id, "decay %g is too small for CTFd, it is worth %d static points", sc.Decay, c.Points)
+		return
+	}
+	if float64(d.Decay) != sc.Decay {
+		ns.add(c.Id, "decay %g is rounded to %d", sc.Decay, d.Decay)
+	}
+	row.Type = "dynamic"
+	a.Dynamic = append(a.Dynamic, d)
+}
+
+func exportAttachment(a *CTFd, c *challenge.Challenge, at challenge.Attachment, challengeId int, ns *notes) error {
+	pth, err := c.Path(at.Path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(pth)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Id, err)
+	}
+	if info.IsDir() {
+		ns.add(c.Id, "directory attachment %s is only archived when built, upload it by hand", at.Path)
+		return nil
+	}
+	f, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	// CTFd keeps uploads in a directory of their own
+	dir := sha256.Sum256([]byte(c.Id + "/" + at.Name))
+	location := hex.EncodeToString(dir[:16]) + "/" + at.Name
+	a.uploads[location] = func() (io.ReadCloser, error) { return os.Open(pth) }
+	a.Files = append(a.Files, CTFdFile{
+		Id: len(a.Files) + 1, Type: "challenge", Location: location, ChallengeId: challengeId, SHA1: hex.EncodeToString(h.Sum(nil)),
+	})
+	return nil
+}
@@ -0,0 +1,266 @@
+package convert
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/env"
+)
+
+// kCTF challenges are directories holding a Challenge resource in
+// challenge.yaml, the image in challenge/ with the flag in
+// challenge/flag, a solver in healthcheck/ and the files handed out
+// in attachments/
+const (
+	KCTF_FILENAME    = "challenge.yaml"
+	KCTF_API_VERSION = "kctf.dev/v1"
+
+	// Port kCTF challenges listen on if they declare none
+	KCTF_DEFAULT_PORT = 1337
+)
+
+var errNoKCTF = errors.New("not a kCTF challenge")
+
+type kctfChallenge struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Deployed             *bool  `yaml:"deployed"`
+		PowDifficultySeconds int    `yaml:"powDifficultySeconds"`
+		Image                string `yaml:"image"`
+		Network              struct {
+			Ports []struct {
+				Protocol   string `yaml:"protocol"`
+				TargetPort int    `yaml:"targetPort"`
+			} `yaml:"ports"`
+		} `yaml:"network"`
+		Healthcheck struct {
+			Enabled bool `yaml:"enabled"`
+		} `yaml:"healthcheck"`
+		HorizontalPodAutoscalerSpec *struct {
+			MinReplicas int `yaml:"minReplicas"`
+			MaxReplicas int `yaml:"maxReplicas"`
+		} `yaml:"horizontalPodAutoscalerSpec"`
+		PodTemplate *struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Name      string `yaml:"name"`
+						Resources struct {
+							Limits map[string]any `yaml:"limits"`
+						} `yaml:"resources"`
+					} `yaml:"containers"`
+				} `yaml:"spec"`
+			} `yaml:"template"`
+		} `yaml:"podTemplate"`
+		PersistentVolumeClaims []string `yaml:"persistentVolumeClaims"`
+		AllowConnectTo         []string `yaml:"allowConnectTo"`
+	} `yaml:"spec"`
+}
+
+// KCTFBundles converts the kCTF challenges below root. Bundles are
+// copies of the challenges' directories, with the Challenge resource
+// kept as kctf.yaml.
+func KCTFBundles(root string) ([]Bundle, []Note, error) {
+	var (
+		ns    notes
+		out   []Bundle
+		taken = make(ids)
+	)
+	err := filepath.WalkDir(root, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(pth, KCTF_FILENAME))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b, err := kctfBundle(pth, data, taken, &ns)
+		switch {
+		case errors.Is(err, errNoKCTF):
+			return nil
+		case err != nil:
+			ns.add(pth, "not imported: %v", err)
+		default:
+			out = append(out, b)
+		}
+		return filepath.SkipDir // challenges do not nest
+	})
+	return out, ns, err
+}
+
+func kctfBundle(dir string, data []byte, taken ids, ns *notes) (Bundle, error) {
+	var k kctfChallenge
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		return Bundle{}, env.DescribeError(filepath.Join(dir, KCTF_FILENAME), data, err)
+	}
+	if k.Kind != "Challenge" || k.APIVersion != KCTF_API_VERSION {
+		return Bundle{}, errNoKCTF
+	}
+	name := cmp.Or(k.Metadata.Name, filepath.Base(dir))
+	id := taken.next(name)
+	exists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel)))
+		return err == nil
+	}
+	if !exists("challenge/flag") {
+		delete(taken, id)
+		return Bundle{}, fmt.Errorf("no challenge/flag to read its flag from")
+	}
+
+	c := &challenge.Challenge{
+		Version:  challenge.SPEC_VERSION,
+		Id:       id,
+		Name:     name,
+		Category: "misc",
+		Flag:     challenge.Flag{Type: challenge.FlagStatic, File: "challenge/flag"},
+		Deploy:   &challenge.Deploy{},
+	}
+	ns.add(id, "kCTF has no category, points nor description, fill them in")
+
+	d, s := c.Deploy, k.Spec
+	switch {
+	case exists("challenge/Dockerfile"):
+		d.Build = "challenge"
+		// kCTF's base images jail the challenge with nsjail
+		if dockerfile, err := os.ReadFile(filepath.Join(dir, "challenge", "Dockerfile")); err == nil &&
+			(bytes.Contains(dockerfile, []byte("kctf-docker")) || bytes.Contains(dockerfile, []byte("nsjail"))) {
+			ns.add(id, "its image runs nsjail, which needs privileged containers ctfjx does not run, rebase it on a plain image")
+		}
+	case s.Image != "":
+		d.Image = s.Image
+	default:
+		delete(taken, id)
+		return Bundle{}, fmt.Errorf("neither challenge/Dockerfile nor spec.image")
+	}
+	for _, p := range s.Network.Ports {
+		port := challenge.Port{Port: cmp.Or(p.TargetPort, KCTF_DEFAULT_PORT), Protocol: challenge.PROTOCOL_TCP}
+		switch strings.ToUpper(p.Protocol) {
+		case "", "TCP":
+		case "HTTPS", "HTTP":
+			port.Protocol = challenge.PROTOCOL_HTTP
+		case "UDP":
+			port.Protocol = challenge.PROTOCOL_UDP
+		default:
+			ns.add(id, "port %d uses unsupported protocol %s, imported as tcp", port.Port, p.Protocol)
+		}
+		d.Ports = append(d.Ports, port)
+	}
+	if len(d.Ports) == 0 {
+		d.Ports = []challenge.Port{{Port: KCTF_DEFAULT_PORT, Protocol: challenge.PROTOCOL_TCP}}
+	}
+	if t := s.PodTemplate; t != nil {
+		for _, ct := range t.Template.Spec.Containers {
+			if ct.Name != "" && ct.Name != "challenge" {
+				continue
+			}
+			if err := kctfLimits(&d.Limits, ct.Resources.Limits); err != nil {
+				ns.add(id, "resource limits dropped: %v", err)
+			}
+		}
+	}
+	if s.Healthcheck.Enabled {
+		c.Healthcheck = &challenge.Healthcheck{Type: challenge.HealthcheckTCP}
+		if exists("healthcheck") {
+			ns.add(id, "its healthcheck solver runs in an image of its own, port it to a solve script")
+		}
+	}
+	if s.Deployed != nil && !*s.Deployed {
+		ns.add(id, "is not deployed in kCTF, but would be once imported")
+	}
+	if s.PowDifficultySeconds > 0 {
+		ns.add(id, "proof of work before connecting (%ds) is not supported", s.PowDifficultySeconds)
+	}
+	if a := s.HorizontalPodAutoscalerSpec; a != nil {
+		d.Instances = a.MinReplicas
+		ns.add(id, "autoscaling is not supported, it runs %d instances", max(a.MinReplicas, 1))
+	}
+	if len(s.PersistentVolumeClaims) > 0 {
+		ns.add(id, "persistent volumes are not supported")
+	}
+	if len(s.AllowConnectTo) > 0 {
+		ns.add(id, "connecting to %v is not supported", s.AllowConnectTo)
+	}
+
+	b := Bundle{Challenge: c}
+	err := filepath.WalkDir(dir, func(pth string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, pth)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if e.IsDir() {
+			return nil
+		}
+		if !e.Type().IsRegular() {
+			ns.add(id, "%s is not a regular file, not copied", rel)
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		target := rel
+		if rel == KCTF_FILENAME {
+			target = "kctf.yaml"
+		}
+		b.Files = append(b.Files, File{Path: target, Mode: info.Mode(), Open: func() (io.ReadCloser, error) { return os.Open(pth) }})
+		if path.Dir(rel) == "attachments" {
+			c.Attachments = append(c.Attachments, challenge.Attachment{Path: rel})
+		}
+		return nil
+	})
+	if err != nil {
+		return Bundle{}, err
+	}
+	return b, nil
+}
+
+// kctfLimits reads the limits of a Kubernetes container into l
+func kctfLimits(l *challenge.Limits, limits map[string]any) error {
+	if v, ok := limits["cpu"]; ok {
+		s := fmt.Sprint(v)
+		var (
+			cpus float64
+			err  error
+		)
+		if milli, ok := strings.CutSuffix(s, "m"); ok {
+			cpus, err = strconv.ParseFloat(milli, 64)
+			cpus /= 1000
+		} else {
+			cpus, err = strconv.ParseFloat(s, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("bad cpu limit %q", s)
+		}
+		l.CPUs = cpus
+	}
+	if v, ok := limits["memory"]; ok {
+		size, err := env.ParseByteSize(fmt.Sprint(v))
+		if err != nil {
+			return fmt.Errorf("bad memory limit %v: %w", v, err)
+		}
+		l.Memory = size
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+)
+
+// RCTFChallenge is a challenge as rCTF's admin API lists them
+type RCTFChallenge struct {
+	Id          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Category    string     `json:"category"`
+	Author      string     `json:"author"`
+	Files       []RCTFFile `json:"files"`
+	Points      struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	} `json:"points"`
+	Flag             string `json:"flag"`
+	TiebreakEligible *bool  `json:"tiebreakEligible,omitempty"`
+}
+
+type RCTFFile struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ReadRCTF reads a dump of rCTF challenges: the response of
+// GET /api/v1/admin/challs, or its data
+func ReadRCTF(data []byte) ([]RCTFChallenge, error) {
+	var out []RCTFChallenge
+	if err := json.Unmarshal(data, &out); err == nil {
+		return out, nil
+	}
+	var response struct {
+		Kind string          `json:"kind"`
+		Data []RCTFChallenge `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("not an rCTF dump: %w", err)
+	}
+	if response.Kind != "goodChallenges" {
+		return nil, fmt.Errorf("not an rCTF dump: response is %q", response.Kind)
+	}
+	return response.Data, nil
+}
+
+// RCTFBundles converts rCTF challenges. rCTF hosts attachments
+// elsewhere, fetch downloads them and may be nil to leave them out.
+func RCTFBundles(cs []RCTFChallenge, fetch func(url string) (io.ReadCloser, error)) ([]Bundle, []Note) {
+	var (
+		ns    notes
+		out   []Bundle
+		taken = make(ids)
+	)
+	for _, rc := range cs {
+		id := taken.next(cmp.Or(rc.Id, rc.Name))
+		if rc.Flag == "" {
+			ns.add(id, "not imported: it has no flag")
+			continue
+		}
+		c := &challenge.Challenge{
+			Version:     challenge.SPEC_VERSION,
+			Id:          id,
+			Name:        cmp.Or(rc.Name, rc.Id),
+			Category:    rc.Category,
+			Points:      rc.Points.Max,
+			Description: rc.Description,
+			Author:      strings.TrimSpace(rc.Author),
+			Flag:        challenge.Flag{Type: challenge.FlagStatic, Value: rc.Flag},
+		}
+		if strings.TrimSpace(c.Category) == "" {
+			c.Category = "misc"
+			ns.add(id, "has no category, imported in %s", c.Category)
+		}
+		if rc.Points.Min != rc.Points.Max {
+			ns.add(id, "dynamic scoring from %d down to %d is imported as %d static points", rc.Points.Max, rc.Points.Min, rc.Points.Max)
+		}
+		if rc.TiebreakEligible != nil && !*rc.TiebreakEligible {
+			ns.add(id, "excluding it from tiebreaks is not supported")
+		}
+
+		b := Bundle{Challenge: c}
+		names := make(map[string]bool)
+		for _, f := range rc.Files {
+			if fetch == nil {
+				ns.add(id, "attachment %s was not downloaded from %s", f.Name, f.URL)
+				continue
+			}
+			name := path.Base(cmp.Or(f.Name, f.URL))
+			if names[name] || name == "." || name == "/" {
+				ns.add(id, "attachment %q has a bad or duplicate name, not imported", f.Name)
+				continue
+			}
+			names[name] = true
+			url := f.URL
+			c.Attachments = append(c.Attachments, challenge.Attachment{Path: "dist/" + name})
+			b.Files = append(b.Files, File{Path: "dist/" + name, Open: func() (io.ReadCloser, error) { return fetch(url) }})
+		}
+		out = append(out, b)
+	}
+	return out, ns
+}
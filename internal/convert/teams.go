@@ -0,0 +1,57 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Accounts are kept next to the imported bundles in this file
+const TEAMS_FILENAME = "teams.json"
+
+// Team is an account migrated from or to another platform. Players
+// of individual events are teams of one.
+type Team struct {
+	Name        string   `json:"name"`
+	Email       string   `json:"email,omitempty"`
+	Affiliation string   `json:"affiliation,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	Website     string   `json:"website,omitempty"`
+	Hidden      bool     `json:"hidden,omitempty"` // not on the scoreboard
+	Banned      bool     `json:"banned,omitempty"`
+	Members     []Member `json:"members,omitempty"`
+}
+
+// Member is a player of a team
+type Member struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	// Hash in the format of the platform it was migrated from,
+	// so players keep their passwords
+	PasswordHash string `json:"password_hash,omitempty"`
+	Captain      bool   `json:"captain,omitempty"`
+	Admin        bool   `json:"admin,omitempty"`
+}
+
+// ReadTeams reads teams written by WriteTeams
+func ReadTeams(pth string) ([]Team, error) {
+	data, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+	var teams []Team
+	if err := json.Unmarshal(data, &teams); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", pth, err)
+	}
+	return teams, nil
+}
+
+// WriteTeams writes teams to pth, readable by its owner only as
+// it holds password hashes
+func WriteTeams(pth string, teams []Team) error {
+	data, err := json.MarshalIndent(teams, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pth, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,137 @@
+// Drain package takes agents out of rotation for maintenance
+// in the middle of an event.
+package drain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/tasks"
+	"github.com/lattesec/log"
+)
+
+var ErrAgentOffline = errors.New("agent is not connected")
+
+// Mode is what happens to the instances running on a drained agent
+type Mode int
+
+const (
+	MODE_KEEP    Mode = iota // leave them running until they end on their own
+	MODE_STOP                // stop and remove them gracefully
+	MODE_MIGRATE             // redeploy them elsewhere, then stop them
+)
+
+// MigrateFunc redeploys an instance of agent on another agent
+type MigrateFunc func(ctx context.Context, agent registry.Agent, instance container.Info) error
+
+type Options struct {
+	Mode    Mode
+	Migrate MigrateFunc // required for MODE_MIGRATE
+}
+
+// Report is the outcome of draining an agent
+type Report struct {
+	Agent    string           `json:"agent"`
+	Stopped  []string         `json:"stopped,omitempty"`
+	Migrated []string         `json:"migrated,omitempty"`
+	Failed   map[string]error `json:"-"`
+}
+
+// Drainer drains agents through the registry, running
+// the container verbs on them with signed tasks
+type Drainer struct {
+	registry   *registry.Registry
+	dispatcher *tasks.Dispatcher
+}
+
+func New(r *registry.Registry, d *tasks.Dispatcher) *Drainer {
+	return &Drainer{registry: r, dispatcher: d}
+}
+
+// Drain marks agent id as draining, so that no new instances are
+// scheduled on it, and handles its instances according to opts.
+// The agent stays draining until Undrain, even if some failed.
+func (dr *Drainer) Drain(ctx context.Context, id string, opts Options) (Report, error) {
+	report := Report{Agent: id, Failed: make(map[string]error)}
+	if opts.Mode == MODE_MIGRATE && opts.Migrate == nil {
+		return report, errors.New("migrating needs a MigrateFunc")
+	}
+	if err := dr.registry.SetDraining(id, true); err != nil {
+		return report, err
+	}
+	log.Info().
+		WithMeta("scope", "drain").
+		WithMeta("agent", id).
+		Msg("agent is draining").Send()
+	if opts.Mode == MODE_KEEP {
+		return report, nil
+	}
+
+	agent, err := dr.registry.Get(id)
+	if err != nil {
+		return report, err
+	}
+	instances, err := dr.instances(ctx, id)
+	if err != nil {
+		return report, err
+	}
+
+	for _, inst := range instances {
+		if opts.Mode == MODE_MIGRATE {
+			if err := opts.Migrate(ctx, agent, inst); err != nil {
+				report.Failed[inst.Name] = fmt.Errorf("migrate: %w", err)
+				continue // keep it running rather than lose it
+			}
+		}
+		if err := dr.run(ctx, id, container.VERB_STOP, inst.Id); err != nil {
+			report.Failed[inst.Name] = err
+			continue
+		}
+		if err := dr.run(ctx, id, container.VERB_REMOVE, inst.Id); err != nil {
+			report.Failed[inst.Name] = err
+			continue
+		}
+		if opts.Mode == MODE_MIGRATE {
+			report.Migrated = append(report.Migrated, inst.Name)
+		} else {
+			report.Stopped = append(report.Stopped, inst.Name)
+		}
+	}
+
+	var errs []error
+	for name, err := range report.Failed {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	return report, errors.Join(errs...)
+}
+
+// Undrain makes agent id schedulable again
+func (dr *Drainer) Undrain(id string) error {
+	return dr.registry.SetDraining(id, false)
+}
+
+func (dr *Drainer) instances(ctx context.Context, id string) ([]container.Info, error) {
+	c, ok := dr.registry.Conn(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAgentOffline, id)
+	}
+	out, err := dr.dispatcher.Run(ctx, c, tasks.Task{Verb: container.VERB_INSPECT})
+	if err != nil {
+		return nil, err
+	}
+	var infos []container.Info
+	return infos, json.Unmarshal(out, &infos)
+}
+
+func (dr *Drainer) run(ctx context.Context, id, verb string, args ...string) error {
+	c, ok := dr.registry.Conn(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentOffline, id)
+	}
+	_, err := dr.dispatcher.Run(ctx, c, tasks.Task{Verb: verb, Args: args})
+	return err
+}
@@ -0,0 +1,96 @@
+package drain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/socket/sockettest"
+	"github.com/lattesec/ctfjx/internal/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	reg, err := registry.New("")
+	require.NoError(t, err)
+	reg.Token = registry.Tokens(map[string]string{"agent": "secret"})
+	dispatcher := tasks.NewDispatcher(priv)
+	daemonHandlers := reg.Handlers()
+	maps.Copy(daemonHandlers, dispatcher.Handlers())
+
+	var mu sync.Mutex
+	running := map[string]bool{"c1": true, "c2": true}
+	executor := tasks.NewExecutor(pub)
+	executor.RegisterVerb(container.VERB_INSPECT, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		mu.Lock()
+		defer mu.Unlock()
+		var infos []container.Info
+		for _, id := range slices.Sorted(maps.Keys(running)) {
+			infos = append(infos, container.Info{Id: id, Name: "inst-" + id, Running: true})
+		}
+		return json.NewEncoder(stdout).Encode(infos)
+	})
+	executor.RegisterVerb(container.VERB_STOP, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		return nil
+	})
+	executor.RegisterVerb(container.VERB_REMOVE, func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(running, args[0])
+		return nil
+	})
+
+	_, agent := sockettest.Pair(t, daemonHandlers, executor.Handlers())
+	agent.Config.Token = "secret"
+	require.NoError(t, agent.SendHello())
+	require.Eventually(t, func() bool {
+		_, ok := reg.Conn("agent")
+		return ok
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dr := New(reg, dispatcher)
+
+	var migrated []string
+	report, err := dr.Drain(ctx, "agent", Options{
+		Mode: MODE_MIGRATE,
+		Migrate: func(ctx context.Context, agent registry.Agent, inst container.Info) error {
+			if inst.Id == "c2" {
+				return errors.New("no capacity")
+			}
+			migrated = append(migrated, inst.Name)
+			return nil
+		},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"inst-c1"}, report.Migrated)
+	assert.Contains(t, report.Failed, "inst-c2")
+	assert.Equal(t, []string{"inst-c1"}, migrated)
+
+	assert.Empty(t, reg.Find(registry.Query{Schedulable: true}))
+	a, err := reg.Get("agent")
+	require.NoError(t, err)
+	assert.True(t, a.Draining)
+
+	report, err = dr.Drain(ctx, "agent", Options{Mode: MODE_STOP})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"inst-c2"}, report.Stopped)
+	assert.Empty(t, running)
+
+	require.NoError(t, dr.Undrain("agent"))
+	assert.Len(t, reg.Find(registry.Query{Schedulable: true}), 1)
+}
@@ -0,0 +1,137 @@
+package env
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/token"
+)
+
+// ConfigError locates a failure to load a config file,
+// so it can be reported as e.g. config.yml:14:3: timeout: ...
+//
+// Use errors.As to get it from the errors of the file loaders.
+type ConfigError struct {
+	Path   string
+	Line   int    // 1-based, 0 if unknown
+	Column int    // 1-based, 0 if unknown
+	Key    string // the offending key, if known
+	Msg    string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Path)
+	if e.Line > 0 {
+		b.WriteString(":" + strconv.Itoa(e.Line))
+		if e.Column > 0 {
+			b.WriteString(":" + strconv.Itoa(e.Column))
+		}
+	}
+	b.WriteString(": ")
+	if e.Key != "" {
+		b.WriteString(e.Key + ": ")
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// DescribeError locates err, returned while decoding the YAML,
+// TOML or JSON data of the file at pth
+func DescribeError(pth string, data []byte, err error) *ConfigError {
+	return newConfigError(pth, data, err)
+}
+
+// newConfigError describes err, returned while parsing data
+// read from cfgPath, with as much position info as it carries
+func newConfigError(cfgPath string, data []byte, err error) *ConfigError {
+	ce := &ConfigError{Path: cfgPath, Msg: err.Error(), Err: err}
+
+	var (
+		cfgErr     *ConfigError
+		yamlErr    yaml.Error
+		tomlErr    toml.ParseError
+		syntaxErr  *json.SyntaxError
+		typeErr    *json.UnmarshalTypeError
+		unknownErr *yaml.UnknownFieldError
+	)
+	switch {
+	case errors.As(err, &cfgErr):
+		cfgErr.Path = cfgPath
+		return cfgErr
+	case errors.As(err, &unknownErr):
+		ce.Msg = "unknown field"
+		if tk := unknownErr.GetToken(); tk != nil {
+			ce.Line, ce.Column, ce.Key = tk.Position.Line, tk.Position.Column, tk.Value
+		}
+	case errors.As(err, &yamlErr):
+		ce.Msg = yamlErr.GetMessage()
+		if tk := yamlErr.GetToken(); tk != nil {
+			ce.Line, ce.Column, ce.Key = tk.Position.Line, tk.Position.Column, yamlKeyOf(tk)
+		}
+	case errors.As(err, &tomlErr):
+		ce.Msg = tomlErr.Message
+		ce.Line, ce.Column, ce.Key = tomlErr.Position.Line, tomlErr.Position.Col, tomlErr.LastKey
+	case errors.As(err, &syntaxErr):
+		ce.Line, ce.Column = offsetPosition(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		ce.Msg = fmt.Sprintf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+		ce.Key = typeErr.Field
+		ce.Line, ce.Column = offsetPosition(data, typeErr.Offset)
+	default:
+		// json's unknown field errors only carry the key's name
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			ce.Msg, ce.Key = "unknown field", strings.Trim(name, `"`)
+		}
+	}
+	return ce
+}
+
+// yamlKeyOf returns the key a value token belongs to
+func yamlKeyOf(tk *token.Token) string {
+	if tk.Prev != nil && tk.Prev.Type == token.MappingValueType && tk.Prev.Prev != nil {
+		return tk.Prev.Prev.Value
+	}
+	if tk.Next != nil && tk.Next.Type == token.MappingValueType {
+		return tk.Value
+	}
+	return ""
+}
+
+func offsetPosition(data []byte, offset int64) (int, int) {
+	if offset <= 0 || offset > int64(len(data)) {
+		return 0, 0
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// unmarshalYAMLScalar decodes a scalar node with v's UnmarshalText,
+// attaching the node's position to errors as go-yaml drops it
+func unmarshalYAMLScalar(node ast.Node, v encoding.TextUnmarshaler) error {
+	tk := node.GetToken()
+	err := v.UnmarshalText([]byte(tk.Value))
+	if err == nil {
+		return nil
+	}
+	return &ConfigError{
+		Line:   tk.Position.Line,
+		Column: tk.Position.Column,
+		Key:    yamlKeyOf(tk),
+		Msg:    err.Error(),
+		Err:    err,
+	}
+}
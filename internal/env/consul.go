@@ -0,0 +1,192 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+)
+
+const (
+	CONSUL_HTTP_ADDR_ENV  = "CONSUL_HTTP_ADDR"
+	CONSUL_HTTP_TOKEN_ENV = "CONSUL_HTTP_TOKEN"
+
+	DEFAULT_CONSUL_ADDR    = "http://127.0.0.1:8500"
+	DEFAULT_CONSUL_TIMEOUT = 10 * time.Second
+	DEFAULT_CONSUL_WAIT    = 5 * time.Minute
+	CONSUL_RETRY_INTERVAL  = 5 * time.Second
+)
+
+var ErrConsulMissingKey = errors.New("consul key is required")
+
+// ConsulConfig locates a config document in Consul's KV store
+type ConsulConfig struct {
+	Address string // defaults to $CONSUL_HTTP_ADDR, then http://127.0.0.1:8500
+	Token   string // defaults to $CONSUL_HTTP_TOKEN
+	Key     string // e.g. ctfjx/config.yml, the extension picks the format
+
+	Client *http.Client // defaults to a client with a 10s timeout
+}
+
+func (cc ConsulConfig) withDefaults() (ConsulConfig, error) {
+	if cc.Address == "" {
+		cc.Address = os.Getenv(CONSUL_HTTP_ADDR_ENV)
+	}
+	if cc.Address == "" {
+		cc.Address = DEFAULT_CONSUL_ADDR
+	}
+	if !strings.Contains(cc.Address, "://") {
+		cc.Address = "http://" + cc.Address // as accepted by the consul CLI
+	}
+	if cc.Token == "" {
+		cc.Token = os.Getenv(CONSUL_HTTP_TOKEN_ENV)
+	}
+	cc.Key = strings.Trim(cc.Key, "/")
+	if cc.Key == "" {
+		return cc, ErrConsulMissingKey
+	}
+	return cc, nil
+}
+
+func (cc ConsulConfig) format() fileFormat {
+	if f, ok := formatForExt(path.Ext(cc.Key)); ok {
+		return f
+	}
+	return yamlFormat
+}
+
+// FromConsul loads a config document stored under a Consul KV key,
+// so that several daemons can share one config. A missing key is
+// not an error unless RequireFile is given.
+//
+// Use Loader.WatchConsul to reload whenever the key changes.
+func FromConsul[T Configurable](cc ConsulConfig, opts ...FileOption) (func(T) error, error) {
+	cc, err := cc.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if cc.Client == nil {
+		cc.Client = &http.Client{Timeout: DEFAULT_CONSUL_TIMEOUT}
+	}
+	o := newFileOptions(opts)
+
+	return func(cfg T) error {
+		data, _, err := readConsulKey(context.Background(), cc, 0)
+		if err != nil {
+			return err
+		}
+
+		source := "consul:" + cc.Key
+		if data == nil {
+			if o.requireFile {
+				return noConfigFileError(loggerFor(cfg), []string{source})
+			}
+			return nil
+		}
+		return mergeParsed(cfg, source, data, cc.format(), o)
+	}, nil
+}
+
+// WatchConsul reloads the config whenever the Consul key changes,
+// using blocking queries, until ctx is done.
+func (l *Loader[T]) WatchConsul(ctx context.Context, cc ConsulConfig) error {
+	cc, err := cc.withDefaults()
+	if err != nil {
+		return err
+	}
+	if cc.Client == nil {
+		cc.Client = &http.Client{} // bounded by the blocking query's wait
+	}
+
+	go nopanic.NoPanicRunVoid("env-watch-consul", func() {
+		l.consulWatchLoop(ctx, cc)
+	})
+	return nil
+}
+
+func (l *Loader[T]) consulWatchLoop(ctx context.Context, cc ConsulConfig) {
+	var index uint64
+	for ctx.Err() == nil {
+		_, next, err := readConsulKey(ctx, cc, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			l.logger().Warn().
+				WithMeta("scope", "env").
+				WithMeta("consul_key", cc.Key).
+				Msgf("consul watch failed, retrying in %s: %v", CONSUL_RETRY_INTERVAL, err).Send()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(CONSUL_RETRY_INTERVAL):
+			}
+			continue
+		}
+
+		switch {
+		case index == 0:
+			// first query, the current value is already loaded
+		case next < index:
+			next = 0 // the index went backwards, e.g. after a restore
+		case next != index:
+			l.reload("consul key " + cc.Key + " changed")
+		}
+		index = next
+	}
+}
+
+// readConsulKey reads the raw value of cc.Key, blocking until it
+// changes if index is non-zero. A missing key returns nil data.
+func readConsulKey(ctx context.Context, cc ConsulConfig, index uint64) ([]byte, uint64, error) {
+	u, err := url.JoinPath(cc.Address, "v1", "kv", cc.Key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q := url.Values{"raw": {""}}
+	if index > 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", DEFAULT_CONSUL_WAIT.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cc.Token != "" {
+		req.Header.Set("X-Consul-Token", cc.Token)
+	}
+
+	resp, err := cc.Client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read consul key %s: %w", cc.Key, err)
+	}
+	defer resp.Body.Close()
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, next, nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return nil, 0, fmt.Errorf("failed to read consul key %s: %s: %s", cc.Key, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read consul key %s: %w", cc.Key, err)
+	}
+	return data, next, nil
+}
@@ -0,0 +1,187 @@
+package env
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ConfigKey documents a single config key
+type ConfigKey struct {
+	Key         string // dotted YAML path, e.g. db.url
+	Type        string
+	Default     string // from the `default` tag
+	Description string // from the `usage` tag
+	Env         string // the variable FromEnv reads, if any
+	Required    bool
+}
+
+// DescribeConfig lists every key of the config struct T, in
+// field order, with nested structs flattened into dotted keys.
+// envPrefix is the prefix given to FromEnv, e.g. CTFJX_ENV_PREFIX.
+func DescribeConfig[T Configurable](envPrefix string) []ConfigKey {
+	var zero T
+	t := reflect.TypeOf(zero)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var keys []ConfigKey
+	describeStruct(t, "", strings.Trim(strings.ToUpper(envPrefix), "_"), &keys)
+	return keys
+}
+
+func describeStruct(t reflect.Type, prefix, envPrefix string, keys *[]ConfigKey) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		envTag := field.Tag.Get("env")
+		fieldEnv := ""
+		if envPrefix != "" && envTag != "-" {
+			fieldEnv = envPrefix
+			if !field.Anonymous {
+				fieldEnv += "_" + envName(field, envTag)
+			}
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous {
+			if ft.Kind() == reflect.Struct {
+				describeStruct(ft, prefix, fieldEnv, keys)
+			}
+			continue
+		}
+
+		name, skip := yamlKey(field)
+		if skip {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if isNestedStruct(ft) && ft != reflect.TypeOf(time.Time{}) {
+			describeStruct(ft, key, fieldEnv, keys)
+			continue
+		}
+
+		*keys = append(*keys, ConfigKey{
+			Key:         key,
+			Type:        describeType(field.Type),
+			Default:     field.Tag.Get("default"),
+			Description: field.Tag.Get("usage"),
+			Env:         fieldEnv,
+			Required:    hasRule(field.Tag.Get("validate"), "required"),
+		})
+	}
+}
+
+func describeType(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(time.Duration(0)), reflect.TypeOf(Duration(0)):
+		return "duration"
+	case reflect.TypeOf(ByteSize(0)):
+		return "size"
+	case reflect.TypeOf(time.Time{}):
+		return "timestamp"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return describeType(t.Elem())
+	case reflect.Slice, reflect.Array:
+		return "list of " + describeType(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map of %s to %s", describeType(t.Key()), describeType(t.Elem()))
+	case reflect.Struct:
+		return "object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	}
+	return "string"
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if name, _, _ := strings.Cut(strings.TrimSpace(r), "="); name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteReference writes keys as a Markdown table
+func WriteReference(w io.Writer, keys []ConfigKey) error {
+	var b strings.Builder
+	b.WriteString("| Key | Type | Default | Env | Description |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, k := range keys {
+		desc := k.Description
+		if k.Required {
+			desc = strings.TrimSpace("**Required.** " + desc)
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n",
+			k.Key, k.Type, markdownCode(k.Default), markdownCode(k.Env), strings.ReplaceAll(desc, "|", `\|`))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + s + "`"
+}
+
+// WriteSample writes a YAML config with every key set
+// to its default, each preceded by its description
+func WriteSample(w io.Writer, keys []ConfigKey) error {
+	var (
+		b       strings.Builder
+		section []string
+	)
+	for _, k := range keys {
+		parts := strings.Split(k.Key, ".")
+		parents := parts[:len(parts)-1]
+
+		// open the sections that differ from the previous key's
+		common := 0
+		for common < len(parents) && common < len(section) && parents[common] == section[common] {
+			common++
+		}
+		for i := common; i < len(parents); i++ {
+			fmt.Fprintf(&b, "%s%s:\n", strings.Repeat("  ", i), parents[i])
+		}
+		section = parents
+
+		indent := strings.Repeat("  ", len(parents))
+		if k.Description != "" {
+			fmt.Fprintf(&b, "%s# %s\n", indent, k.Description)
+		}
+		if k.Required {
+			fmt.Fprintf(&b, "%s# required\n", indent)
+		}
+		if k.Default == "" {
+			fmt.Fprintf(&b, "%s%s:\n", indent, parts[len(parts)-1])
+		} else {
+			fmt.Fprintf(&b, "%s%s: %s\n", indent, parts[len(parts)-1], k.Default)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,124 @@
+package env
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lattesec/log"
+)
+
+const DOTENV_FILENAME = ".env"
+
+// FromDotEnv loads .env files into the process environment, so it
+// must be registered before FromEnv. Without paths, ./.ctfjx/.env
+// is loaded. Missing files are skipped.
+//
+// Variables that are already set are left untouched,
+// so the real environment always wins.
+func FromDotEnv[T Configurable](paths ...string) (func(T) error, error) {
+	if len(paths) == 0 {
+		paths = []string{filepath.Join(CTFJX_CWD_CONFIG_DIR, DOTENV_FILENAME)}
+	}
+	return func(cfg T) error {
+		return loadDotEnv(loggerFor(cfg), paths)
+	}, nil
+}
+
+// LoadDotEnv sets the variables of every .env file in paths that
+// are not set yet. Earlier files take precedence over later ones.
+func LoadDotEnv(paths ...string) error {
+	return loadDotEnv(log.DefaultLogger(), paths)
+}
+
+func loadDotEnv(lg *log.Logger, paths []string) error {
+	for _, pth := range paths {
+		data, err := os.ReadFile(filepath.Clean(pth))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", pth, err)
+		}
+
+		vars, err := parseDotEnv(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", pth, err)
+		}
+
+		set := 0
+		for _, kv := range vars {
+			if _, ok := os.LookupEnv(kv[0]); ok {
+				continue
+			}
+			if err := os.Setenv(kv[0], kv[1]); err != nil {
+				return fmt.Errorf("failed to set %s from %s: %w", kv[0], pth, err)
+			}
+			set++
+		}
+
+		lg.Debug().
+			WithMeta("scope", "env").
+			WithMeta("path", pth).
+			Msgf("loaded %d variables from %s", set, pth).Send()
+	}
+	return nil
+}
+
+// parseDotEnv parses KEY=value lines, with optional `export`
+// prefixes, # comments, 'literal' and "escaped" values
+func parseDotEnv(data []byte) ([][2]string, error) {
+	var vars [][2]string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=value", n)
+		}
+
+		val, err := parseDotEnvValue(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		vars = append(vars, [2]string{key, val})
+	}
+	return vars, sc.Err()
+}
+
+func parseDotEnvValue(val string) (string, error) {
+	switch {
+	case strings.HasPrefix(val, "'"):
+		end := strings.Index(val[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return val[1 : end+1], nil
+	case strings.HasPrefix(val, `"`):
+		// find the closing quote, skipping escaped ones
+		for i := 1; i < len(val); i++ {
+			switch val[i] {
+			case '\\':
+				i++
+			case '"':
+				return strconv.Unquote(val[:i+1])
+			}
+		}
+		return "", fmt.Errorf("unterminated quote")
+	}
+
+	if i := strings.Index(val, " #"); i >= 0 {
+		val = val[:i]
+	}
+	return strings.TrimSpace(val), nil
+}
@@ -0,0 +1,135 @@
+package env
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+const REDACTED = "<redacted>"
+
+// Field names that are redacted even without a `secret` tag
+var secretNameHints = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "privatekey", "private_key"}
+
+// Dump writes the current config as YAML, with a comment after
+// every value naming the source that set it.
+//
+// With redact, the values of secret fields are replaced with
+// <redacted>. A field is secret if it is tagged `secret:"true"`
+// or `vault:"..."`, has an XFile sibling (see FromSecretFiles) or
+// its name looks like a password, token or key.
+func (l *Loader[T]) Dump(w io.Writer, redact bool) error {
+	snap := l.current()
+	v := reflect.ValueOf(snap.Config)
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return ErrNoConfigLoaded
+	}
+
+	d := &dumper{w: w, redact: redact, sources: snap.sources}
+	d.dumpStruct(reflect.Indirect(v), "", 0)
+	return d.err
+}
+
+type dumper struct {
+	w       io.Writer
+	redact  bool
+	sources map[string]string
+	err     error
+}
+
+func (d *dumper) printf(format string, args ...any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+func (d *dumper) dumpStruct(v reflect.Value, prefix string, depth int) {
+	t := v.Type()
+	indent := strings.Repeat("  ", depth)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Anonymous {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				d.dumpStruct(fv, prefix, depth)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		key, skip := yamlKey(field)
+		if skip {
+			continue
+		}
+		pth := joinFieldPath(prefix, field.Name)
+
+		if inner := reflect.Indirect(fv); inner.Kind() == reflect.Struct && !isLeafStruct(inner.Type()) {
+			d.printf("%s%s:\n", indent, key)
+			d.dumpStruct(inner, pth, depth+1)
+			continue
+		}
+
+		val := d.formatValue(fv)
+		if d.redact && isSecretField(t, field) && !fv.IsZero() {
+			val = REDACTED
+		}
+
+		if src, ok := d.sources[pth]; ok {
+			d.printf("%s%s: %s # %s\n", indent, key, val, src)
+		} else {
+			d.printf("%s%s: %s\n", indent, key, val)
+		}
+	}
+}
+
+func (d *dumper) formatValue(v reflect.Value) string {
+	data, err := yaml.MarshalWithOptions(v.Interface(), yaml.Flow(true))
+	if err != nil {
+		return fmt.Sprintf("%v", v.Interface())
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// yamlKey mirrors how go-yaml names a field
+func yamlKey(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", true
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, false
+	}
+	return strings.ToLower(field.Name), false
+}
+
+func isSecretField(parent reflect.Type, field reflect.StructField) bool {
+	if field.Tag.Get("secret") == "true" || field.Tag.Get("vault") != "" {
+		return true
+	}
+	if _, ok := parent.FieldByName(field.Name + SECRET_FILE_SUFFIX); ok {
+		return true
+	}
+
+	name := strings.ToLower(field.Name)
+	if strings.HasSuffix(name, strings.ToLower(SECRET_FILE_SUFFIX)) {
+		return false // a path to a secret, not the secret itself
+	}
+	for _, hint := range secretNameHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package env
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+)
+
+const (
+	ENCRYPTED_PREFIX = "enc:"
+	CONFIG_KEY_SIZE  = 32 // AES-256
+
+	CTFJX_CONFIG_KEY_ENV      = "CTFJX_CONFIG_KEY"
+	CTFJX_CONFIG_KEY_FILE_ENV = "CTFJX_CONFIG_KEY_FILE"
+)
+
+var (
+	ErrMissingConfigKey = errors.New("missing config key")
+	ErrInvalidConfigKey = errors.New("invalid config key")
+	ErrDecryptFailed    = errors.New("failed to decrypt config value")
+)
+
+// FromEncrypted decrypts every string value of the form
+// "enc:<base64>" in place, so that secrets can be committed to
+// infrastructure repos. Values are sealed with AES-256-GCM, see
+// EncryptValue.
+//
+// The key is read from $CTFJX_CONFIG_KEY, or from the file named
+// by $CTFJX_CONFIG_KEY_FILE, either raw or base64 encoded. It
+// should be registered after every loader that may set values.
+func FromEncrypted[T Configurable]() (func(T) error, error) {
+	return func(cfg T) error {
+		key, err := LoadConfigKey()
+		if err != nil {
+			return err
+		}
+		return trackSource(cfg, "decrypted", func() error {
+			return decryptValues(cfg, key)
+		})
+	}, nil
+}
+
+// LoadConfigKey reads the config key from the environment
+func LoadConfigKey() ([]byte, error) {
+	if s := os.Getenv(CTFJX_CONFIG_KEY_ENV); s != "" {
+		return parseConfigKey([]byte(s))
+	}
+	if pth := os.Getenv(CTFJX_CONFIG_KEY_FILE_ENV); pth != "" {
+		data, err := os.ReadFile(pth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config key from %s: %w", pth, err)
+		}
+		return parseConfigKey(data)
+	}
+	return nil, fmt.Errorf("%w: set $%s or $%s", ErrMissingConfigKey, CTFJX_CONFIG_KEY_ENV, CTFJX_CONFIG_KEY_FILE_ENV)
+}
+
+func parseConfigKey(data []byte) ([]byte, error) {
+	if len(data) == CONFIG_KEY_SIZE {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != CONFIG_KEY_SIZE {
+		return nil, fmt.Errorf("%w: expected %d bytes, raw or base64", ErrInvalidConfigKey, CONFIG_KEY_SIZE)
+	}
+	return key, nil
+}
+
+// GenerateConfigKey returns a new random base64 encoded config key
+func GenerateConfigKey() (string, error) {
+	key := make([]byte, CONFIG_KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// EncryptValue seals plaintext into an "enc:" value
+// that FromEncrypted decrypts with the same key
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	gcm, err := newConfigGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return ENCRYPTED_PREFIX + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue opens an "enc:" value, returning
+// values without the prefix as they are
+func DecryptValue(key []byte, value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, ENCRYPTED_PREFIX)
+	if !ok {
+		return value, nil
+	}
+
+	gcm, err := newConfigGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("%w: malformed value", ErrDecryptFailed)
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: wrong key or tampered value", ErrDecryptFailed)
+	}
+	return string(plaintext), nil
+}
+
+func newConfigGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != CONFIG_KEY_SIZE {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidConfigKey, CONFIG_KEY_SIZE, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decryptValues(v any, key []byte) error {
+	var errs []error
+	mirror.MapStrings(reflect.ValueOf(v), func(s string) string {
+		plaintext, err := DecryptValue(key, s)
+		if err != nil {
+			errs = append(errs, err)
+			return s
+		}
+		return plaintext
+	})
+	return errors.Join(errs...)
+}
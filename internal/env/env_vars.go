@@ -0,0 +1,140 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+	"github.com/lattesec/log"
+)
+
+const CTFJX_ENV_PREFIX = "CTFJX"
+
+var ErrInvalidEnvPrefix = errors.New("invalid env prefix")
+
+// FromEnv overlays environment variables onto the config
+//
+// Every field is read from PREFIX_FIELD, where FIELD is either
+// the field's `env:"NAME"` tag or its name in SNAKE_CASE. Nested
+// structs add their own name to the prefix, e.g. PREFIX_DB_URL
+// for Cfg.DB.URL. Fields tagged `env:"-"` are skipped.
+//
+// It should be registered after the file loaders so that
+// environment variables take precedence.
+func FromEnv[T Configurable](prefix string) (func(T) error, error) {
+	prefix = strings.Trim(strings.ToUpper(prefix), "_")
+	if prefix == "" || strings.ContainsAny(prefix, "= \t\n") {
+		return nil, ErrInvalidEnvPrefix
+	}
+
+	return func(cfg T) error {
+		v := reflect.ValueOf(cfg)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("config must be a struct pointer, got %T", cfg)
+		}
+		return trackSource(cfg, "env "+prefix+"_*", func() error {
+			return overlayEnv(loggerFor(cfg), v.Elem(), prefix)
+		})
+	}, nil
+}
+
+func overlayEnv(lg *log.Logger, v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// exported fields of embedded unexported structs are still settable
+		if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			continue
+		}
+
+		tag := field.Tag.Get("env")
+		if tag == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if isNestedStruct(field.Type) {
+			nestedPrefix := prefix
+			if !field.Anonymous {
+				nestedPrefix = prefix + "_" + envName(field, tag)
+			}
+			if err := overlayNestedEnv(lg, fv, nestedPrefix); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := prefix + "_" + envName(field, tag)
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+
+		if err := mirror.SetString(fv, val); err != nil {
+			return fmt.Errorf("failed to set %s from $%s: %w", field.Name, key, err)
+		}
+
+		lg.Debug().
+			WithMeta("scope", "env").
+			WithMeta("key", key).
+			Msgf("loaded %s from environment", field.Name).Send()
+	}
+	return nil
+}
+
+// Pointers to nested structs are only allocated when
+// one of their fields is actually set
+func overlayNestedEnv(lg *log.Logger, v reflect.Value, prefix string) error {
+	if v.Kind() != reflect.Ptr {
+		return overlayEnv(lg, v, prefix)
+	}
+
+	if !v.IsNil() {
+		return overlayEnv(lg, v.Elem(), prefix)
+	}
+
+	tmp := reflect.New(v.Type().Elem())
+	if err := overlayEnv(lg, tmp.Elem(), prefix); err != nil {
+		return err
+	}
+	if !tmp.Elem().IsZero() {
+		v.Set(tmp)
+	}
+	return nil
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !mirror.IsTextUnmarshaler(t)
+}
+
+func envName(field reflect.StructField, tag string) string {
+	if tag != "" {
+		return strings.ToUpper(tag)
+	}
+	return toSnakeCase(field.Name)
+}
+
+// toSnakeCase converts a Go identifier to SNAKE_CASE,
+// keeping acronyms together: DBUrl -> DB_URL
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
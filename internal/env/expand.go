@@ -0,0 +1,36 @@
+package env
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+)
+
+// Matches ${VAR} and ${VAR:-default}
+var envRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ExpandEnv replaces ${VAR} and ${VAR:-default} in the string
+// values of config files with the value of the environment
+// variable VAR, or default when VAR is unset or empty.
+//
+// Bare $VAR is left untouched, so that secrets containing a
+// dollar sign do not need escaping.
+func ExpandEnv() FileOption {
+	return func(o *fileOptions) { o.expandEnv = true }
+}
+
+func expandEnvString(s string) string {
+	return envRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRefRegex.FindStringSubmatch(ref)
+		if val := os.Getenv(m[1]); val != "" {
+			return val
+		}
+		return m[2]
+	})
+}
+
+func expandEnvValues(v any) {
+	mirror.MapStrings(reflect.ValueOf(v), expandEnvString)
+}
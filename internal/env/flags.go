@@ -0,0 +1,163 @@
+package env
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+	"github.com/lattesec/log"
+)
+
+var ErrFlagsNotParsed = errors.New("flags have not been parsed")
+
+// Holds the raw value of a config flag until it is applied
+type configFlag struct {
+	typ    reflect.Type
+	isBool bool
+	raw    string
+}
+
+func (f *configFlag) String() string { return f.raw }
+
+func (f *configFlag) Set(s string) error {
+	if err := mirror.SetString(reflect.New(f.typ).Elem(), s); err != nil {
+		return err
+	}
+	f.raw = s
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool { return f.isBool }
+
+// FromFlags registers a flag on fs for every field tagged
+// `flag:"name"` (with an optional `usage:"..."` tag) and overlays
+// the flags that were set on the command line.
+//
+// Flags are registered when FromFlags is called, so it has to be
+// called before fs is parsed, and the callback fails if fs has not
+// been parsed by the time the config is loaded. It should be
+// registered last so flags take precedence over files and env.
+//
+// [fs] defaults to flag.CommandLine when nil.
+func FromFlags[T Configurable](fs *flag.FlagSet) (func(T) error, error) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+
+	var zero T
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a struct pointer, got %T", zero)
+	}
+
+	flags := make(map[string]*configFlag)
+	if err := registerFlags(fs, t.Elem(), flags); err != nil {
+		return nil, err
+	}
+
+	return func(cfg T) error {
+		if !fs.Parsed() {
+			return ErrFlagsNotParsed
+		}
+
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+		return trackSource(cfg, "flags", func() error {
+			return overlayFlags(loggerFor(cfg), reflect.ValueOf(cfg).Elem(), flags, set)
+		})
+	}, nil
+}
+
+func registerFlags(fs *flag.FlagSet, t reflect.Type, flags map[string]*configFlag) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isNestedStruct(field.Type) {
+			nested := field.Type
+			if nested.Kind() == reflect.Ptr {
+				nested = nested.Elem()
+			}
+			if err := registerFlags(fs, nested, flags); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("flag")
+		if name == "" || name == "-" {
+			continue
+		}
+		if fs.Lookup(name) != nil {
+			return fmt.Errorf("flag %q is already defined", name)
+		}
+
+		cf := &configFlag{typ: field.Type, isBool: field.Type.Kind() == reflect.Bool}
+		flags[name] = cf
+		fs.Var(cf, name, field.Tag.Get("usage"))
+	}
+	return nil
+}
+
+func overlayFlags(lg *log.Logger, v reflect.Value, flags map[string]*configFlag, set map[string]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+
+		if isNestedStruct(field.Type) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					if !anyFlagSet(field.Type.Elem(), set) {
+						continue
+					}
+					fv.Set(reflect.New(field.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := overlayFlags(lg, fv, flags, set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("flag")
+		cf, ok := flags[name]
+		if !ok || !set[name] {
+			continue
+		}
+
+		if err := mirror.SetString(fv, cf.raw); err != nil {
+			return fmt.Errorf("failed to set %s from --%s: %w", field.Name, name, err)
+		}
+
+		lg.Debug().
+			WithMeta("scope", "env").
+			WithMeta("flag", name).
+			WithMeta("value", strconv.Quote(cf.raw)).
+			Msgf("loaded %s from flags", field.Name).Send()
+	}
+	return nil
+}
+
+func anyFlagSet(t reflect.Type, set map[string]bool) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isNestedStruct(field.Type) {
+			nested := field.Type
+			if nested.Kind() == reflect.Ptr {
+				nested = nested.Elem()
+			}
+			if anyFlagSet(nested, set) {
+				return true
+			}
+			continue
+		}
+		if set[field.Tag.Get("flag")] {
+			return true
+		}
+	}
+	return false
+}
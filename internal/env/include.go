@@ -0,0 +1,82 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrIncludeCycle = errors.New("config include cycle")
+
+// Includes can be embedded in config structs to declare the
+// `include` key, which is needed when loading with Strict.
+//
+// Every config file may list other config files to include:
+//
+//	include:
+//	  - base.yml
+//	  - ../shared/agents.toml
+//
+// Included paths are relative to the including file. They are
+// loaded before the including file, which thus overrides them.
+type Includes struct {
+	Include []string `yaml:"include,omitempty" toml:"include,omitempty" json:"include,omitempty"`
+}
+
+func loadIncludes[T Configurable](cfg T, cfgPath string, data []byte, format fileFormat, o fileOptions, chain []string) error {
+	var inc Includes
+	if err := format.unmarshal(data, &inc, fileOptions{}); err != nil {
+		return newConfigError(cfgPath, data, err)
+	}
+	if len(inc.Include) == 0 {
+		return nil
+	}
+
+	abs, err := filepath.Abs(cfgPath)
+	if err != nil {
+		return err
+	}
+	for _, prev := range chain {
+		if prev == abs {
+			return fmt.Errorf("%w: %s -> %s", ErrIncludeCycle, strings.Join(chain, " -> "), abs)
+		}
+	}
+	chain = append(chain, abs)
+
+	for _, pth := range inc.Include {
+		if !filepath.IsAbs(pth) {
+			pth = filepath.Join(filepath.Dir(abs), pth)
+		}
+		if err := loadInclude(cfg, filepath.Clean(pth), format, o, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlike the searched config paths, included files must exist
+func loadInclude[T Configurable](cfg T, pth string, parent fileFormat, o fileOptions, chain []string) error {
+	lg := loggerFor(cfg)
+	format := parent
+	if ext := filepath.Ext(pth); ext != "" {
+		f, ok := formatForExt(ext)
+		if !ok {
+			return fmt.Errorf("%w: cannot include %s", ErrInvalidConfigFilename, pth)
+		}
+		format = f
+	}
+
+	lg.Debug().
+		WithMeta("scope", "env").
+		WithMeta("path", pth).
+		WithMeta("included_by", chain[len(chain)-1]).
+		Msg("including config").Send()
+
+	data, err := os.ReadFile(pth)
+	if err != nil {
+		return fmt.Errorf("failed to include config %s: %w", pth, err)
+	}
+	return mergeData(cfg, pth, data, format, o, chain)
+}
@@ -4,24 +4,57 @@ import (
 	"errors"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 
 	"github.com/lattesec/ctfjx/internal/helpers/mirror"
 	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
-	"github.com/lattesec/log"
 )
 
-var ErrInvalidConfigFilename = errors.New("invalid config filename")
+var (
+	ErrInvalidConfigFilename = errors.New("invalid config filename")
+	ErrConfigRejected        = errors.New("config rejected")
+	ErrNoConfigFile          = errors.New("no config file found")
+)
 
 type Configurable interface {
 	Validate() error
 }
 
+// Snapshot is a loaded config and the generation it was loaded as.
+// Read every field from one Snapshot rather than calling Current
+// repeatedly, which may return configs of different generations
+// during a reload.
+type Snapshot[T Configurable] struct {
+	Config     T
+	Generation uint64
+
+	sources map[string]string // see provenance
+}
+
+// Copy returns a deep copy of the snapshot, whose
+// config can be changed without affecting the loader
+func (s Snapshot[T]) Copy() Snapshot[T] {
+	s.Config = mirror.DeepCopy(s.Config)
+	return s
+}
+
 // Where T is a struct pointer
 type Loader[T Configurable] struct {
-	cfgValue  atomic.Value
+	cfgValue  atomic.Value // Snapshot[T]
 	callbacks []func(T) error
+	lastErr   atomic.Pointer[error]
+	logs      loaderLogger
+
+	loadMu sync.Mutex // serializes loads so subscribers see them in order
+
+	mu          sync.Mutex
+	watchPaths  []string
+	subIdGen    uint64
+	subscribers map[uint64]func(old, new T)
+	checks      map[uint64]func(old, new T) error
 }
 
 func NewLoader[T Configurable]() *Loader[T] {
@@ -33,16 +66,49 @@ func (l *Loader[T]) RegisterCallback(cb ...func(T) error) {
 }
 
 func (l *Loader[T]) Current() T {
+	return l.current().Config
+}
+
+// Snapshot returns the current config together with its generation
+func (l *Loader[T]) Snapshot() Snapshot[T] {
+	return l.current()
+}
+
+// Generation returns how many configs have been set so far,
+// so callers holding on to a config can detect that it is stale
+func (l *Loader[T]) Generation() uint64 {
+	return l.current().Generation
+}
+
+// LastError returns the error of the most recent load,
+// or nil if it succeeded
+func (l *Loader[T]) LastError() error {
+	if err := l.lastErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (l *Loader[T]) current() Snapshot[T] {
 	v := l.cfgValue.Load()
 	if v == nil {
-		var zero T
-		return zero
+		return Snapshot[T]{}
 	}
-	return v.(T)
+	return v.(Snapshot[T])
 }
 
 func (l *Loader[T]) Set(cfg T) {
-	l.cfgValue.Store(cfg)
+	l.set(cfg, nil)
+}
+
+func (l *Loader[T]) set(cfg T, sources map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfgValue.Store(Snapshot[T]{
+		Config:     cfg,
+		Generation: l.current().Generation + 1,
+		sources:    sources,
+	})
 }
 
 // AutoReload watches for SIGHUP
@@ -52,36 +118,94 @@ func (l *Loader[T]) AutoReload() {
 
 	go func() {
 		for range ch {
-			log.Info().
-				WithMeta("scope", "env").
-				Msg("received SIGHUP, reloading config").Send()
-
-			err := nopanic.NoPanicRun("env-nohup-reload", func() error {
-				return l.Load()
-			})
-			if err != nil {
-				log.Error().
-					WithMeta("scope", "env").
-					Msgf("failed to reload config: %v", err).Send()
-			}
+			l.reload("received SIGHUP")
 		}
 	}()
 }
 
+func (l *Loader[T]) reload(reason string) {
+	l.logger().Info().
+		WithMeta("scope", "env").
+		Msgf("%s, reloading config", reason).Send()
+
+	old := l.current()
+	err := nopanic.NoPanicRunErr("env-reload", func() error {
+		return l.Load()
+	})
+	if err != nil {
+		l.logger().Error().
+			WithMeta("scope", "env").
+			Msgf("failed to reload config: %v", err).Send()
+		return
+	}
+
+	// only the paths are logged, the values may be secrets
+	changes := mirror.Diff(old.Config, l.Current())
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Path
+	}
+	l.logger().Info().
+		WithMeta("scope", "env").
+		WithMeta("changed", strings.Join(paths, ",")).
+		Msgf("config reloaded, %d fields changed", len(changes)).Send()
+}
+
+// Load builds a new config from the callbacks, validates it and
+// sets it. If anything fails, the previous config stays in place.
 func (l *Loader[T]) Load() error {
+	l.loadMu.Lock()
+	defer l.loadMu.Unlock()
+
+	err := l.load()
+	l.lastErr.Store(&err)
+	return err
+}
+
+func (l *Loader[T]) load() error {
 	cfg := mirror.Fresh[T]().(T) // *Cfg
-	log.Debug().Msgf("%#v", cfg).Send()
+	l.logger().Debug().Msgf("%#v", cfg).Send()
+
+	prov := recordProvenance(cfg)
+	defer stopProvenance(cfg)
+	loadLoggers.Store(cfg, l.logger())
+	defer loadLoggers.Delete(cfg)
+
+	err := trackSource(cfg, "defaults", func() error {
+		return mirror.ApplyDefaults(cfg)
+	})
+	if err != nil {
+		return err
+	}
 	for _, cb := range l.callbacks {
 		if err := cb(cfg); err != nil {
 			return err
 		}
 	}
 
+	var errs []error
+	if err := ValidateStruct(cfg); err != nil {
+		errs = append(errs, err)
+	}
 	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	old := l.Current()
+	if err := l.check(old, cfg); err != nil {
+		l.logger().Warn().
+			WithMeta("scope", "env").
+			WithMeta("generation", l.Generation()).
+			Msgf("config rejected, keeping current config: %v", err).Send()
 		return err
 	}
 
-	l.Set(cfg)
-	log.Debug().WithMeta("scope", "env").Msgf("config loaded: %#v", cfg).Send()
+	l.set(cfg, prov.sources)
+	l.logger().Debug().WithMeta("scope", "env").Msgf("config loaded: %#v", cfg).Send()
+
+	l.notify(old, cfg)
 	return nil
 }
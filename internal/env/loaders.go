@@ -1,12 +1,14 @@
 package env
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"dario.cat/mergo"
+	"github.com/BurntSushi/toml"
 	"github.com/goccy/go-yaml"
 	"github.com/lattesec/ctfjx/internal/helpers/mirror"
 	"github.com/lattesec/log"
@@ -19,94 +21,275 @@ func MustFn[T any](fn func(T) error, err error) func(T) error {
 	return fn
 }
 
+// A config file format
+type fileFormat struct {
+	exts      []string // accepted extensions, in load order
+	unmarshal func(data []byte, v any, o fileOptions) error
+	marshal   func(v any) ([]byte, error)
+}
+
+var (
+	yamlFormat = fileFormat{
+		exts:      []string{".yml", ".yaml"},
+		unmarshal: unmarshalYAML,
+		marshal:   yaml.Marshal,
+	}
+	tomlFormat = fileFormat{
+		exts:      []string{".toml"},
+		unmarshal: unmarshalTOML,
+		marshal:   toml.Marshal,
+	}
+	jsonFormat = fileFormat{
+		exts:      []string{".json"},
+		unmarshal: unmarshalJSON,
+		marshal:   json.Marshal,
+	}
+)
+
+func unmarshalYAML(data []byte, v any, o fileOptions) error {
+	var opts []yaml.DecodeOption
+	if o.strict {
+		opts = append(opts, yaml.Strict())
+	}
+	return yaml.UnmarshalWithOptions(data, v, opts...)
+}
+
+func unmarshalTOML(data []byte, v any, o fileOptions) error {
+	md, err := toml.Decode(string(data), v)
+	if err != nil {
+		return err
+	}
+	if undecoded := md.Undecoded(); o.strict && len(undecoded) > 0 {
+		return &ConfigError{
+			Key: undecoded[0].String(),
+			Msg: "unknown field",
+			Err: fmt.Errorf("unknown fields: %v", undecoded),
+		}
+	}
+	return nil
+}
+
+func unmarshalJSON(data []byte, v any, o fileOptions) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if o.strict {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+func (f fileFormat) hasExt(ext string) bool {
+	for _, e := range f.exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func formatForExt(ext string) (fileFormat, bool) {
+	for _, f := range [3]fileFormat{yamlFormat, tomlFormat, jsonFormat} {
+		if f.hasExt(ext) {
+			return f, true
+		}
+	}
+	return fileFormat{}, false
+}
+
 // FromYAML loads a config from a file with the given filename
 //
 // [pth] should be a filename or filepath to the config file.
 // The extension is optional and will be automatically added.
-func FromYAML[T Configurable](pth string) (func(T) error, error) {
+func FromYAML[T Configurable](pth string, opts ...FileOption) (func(T) error, error) {
+	return fromFile[T](pth, yamlFormat, newFileOptions(opts))
+}
+
+// FromTOML loads a config from a file with the given filename
+//
+// [pth] should be a filename or filepath to the config file.
+// The extension is optional and will be automatically added.
+func FromTOML[T Configurable](pth string, opts ...FileOption) (func(T) error, error) {
+	return fromFile[T](pth, tomlFormat, newFileOptions(opts))
+}
+
+// FromJSON loads a config from a file with the given filename
+//
+// [pth] should be a filename or filepath to the config file.
+// The extension is optional and will be automatically added.
+func FromJSON[T Configurable](pth string, opts ...FileOption) (func(T) error, error) {
+	return fromFile[T](pth, jsonFormat, newFileOptions(opts))
+}
+
+func fromFile[T Configurable](pth string, format fileFormat, o fileOptions) (func(T) error, error) {
+	pth, err := trimConfigExt(pth, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(cfg T) error {
+		tried, found, err := loadFileSet(cfg, pth, format, o)
+		if err != nil {
+			return err
+		}
+		if o.requireFile && !found {
+			return noConfigFileError(loggerFor(cfg), tried)
+		}
+		return nil
+	}, nil
+}
+
+func trimConfigExt(pth string, format fileFormat) (string, error) {
 	pth = filepath.Clean(pth)
 	if pth == "." {
-		return nil, ErrInvalidConfigFilename
+		return "", ErrInvalidConfigFilename
 	}
 
 	if ext := filepath.Ext(pth); ext != "" {
-		if ext == ".yaml" || ext == ".yml" {
-			pth = strings.TrimSuffix(pth, ext)
-		} else {
-			log.Warn().
-				WithMeta("scope", "env").
-				WithMeta("path", pth).
-				Msg("invalid config extension").Send()
-			return nil, ErrInvalidConfigFilename
+		if !format.hasExt(ext) {
+			return "", fmt.Errorf("%w: %s is not a %s file", ErrInvalidConfigFilename, pth, strings.Join(format.exts, " or "))
 		}
+		pth = strings.TrimSuffix(pth, ext)
 	}
+	return pth, nil
+}
 
-	return func(cfg T) error {
-		for _, ext := range [2]string{".yml", ".yaml"} {
-			cfgPath := filepath.Clean(pth + ext)
+// loadFileSet loads pth with every extension of format, followed
+// by the active profile's files. It returns the paths it tried and
+// whether any of them existed.
+func loadFileSet[T Configurable](cfg T, pth string, format fileFormat, o fileOptions) ([]string, bool, error) {
+	var (
+		tried []string
+		found bool
+	)
+	load := func(cfgPath string) error {
+		tried = append(tried, cfgPath)
+		ok, err := loadFile(cfg, cfgPath, format, o)
+		found = found || ok
+		return err
+	}
+
+	for _, ext := range format.exts {
+		if err := load(filepath.Clean(pth + ext)); err != nil {
+			return tried, found, err
+		}
+	}
+
+	if profile := o.activeProfile(); profile != "" {
+		for _, ext := range format.exts {
+			if err := load(filepath.Clean(pth + "." + profile + ext)); err != nil {
+				return tried, found, err
+			}
+		}
+	}
+	return tried, found, nil
+}
 
-			log.Debug().
+func noConfigFileError(lg *log.Logger, tried []string) error {
+	lg.Error().
+		WithMeta("scope", "env").
+		WithMeta("tried", strings.Join(tried, ",")).
+		Msg("no config file found").Send()
+	return fmt.Errorf("%w, tried:\n  %s", ErrNoConfigFile, strings.Join(tried, "\n  "))
+}
+
+// loadFile reports whether cfgPath exists, a missing file is not an error
+func loadFile[T Configurable](cfg T, cfgPath string, format fileFormat, o fileOptions) (bool, error) {
+	lg := loggerFor(cfg)
+	lg.Debug().
+		WithMeta("scope", "env").
+		WithMeta("path", cfgPath).
+		Msg("attempting to load config").Send()
+
+	data, err := os.ReadFile(filepath.Clean(cfgPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			lg.Debug().
 				WithMeta("scope", "env").
 				WithMeta("path", cfgPath).
-				Msg("attempting to load config").Send()
+				Msg("not found").Send()
+			return false, nil
+		}
 
-			data, err := os.ReadFile(filepath.Clean(cfgPath))
-			if err != nil {
-				if os.IsNotExist(err) {
-					log.Debug().
-						WithMeta("scope", "env").
-						WithMeta("path", cfgPath).
-						Msg("not found").Send()
-					continue
-				}
-
-				log.Error().
-					WithMeta("scope", "env").
-					WithMeta("path", cfgPath).
-					Msgf("failed to read config file: %v", err).Send()
+		lg.Error().
+			WithMeta("scope", "env").
+			WithMeta("path", cfgPath).
+			Msgf("failed to read config file: %v", err).Send()
 
-				return err
-			}
+		return false, err
+	}
 
-			tmp := mirror.Fresh[T]()
-			if err := yaml.Unmarshal(data, tmp); err != nil {
-				log.Warn().
-					WithMeta("scope", "env").
-					WithMeta("path", cfgPath).
-					Msgf("failed to parse: %v", err).Send()
+	return true, mergeData(cfg, cfgPath, data, format, o, nil)
+}
 
-				log.Debug().
-					WithMeta("scope", "env").
-					WithMeta("path", cfgPath).
-					WithMeta("data", string(data)).
-					Msgf("failed to parse: %v", err).Send()
+// mergeData parses data read from cfgPath and merges it into cfg,
+// after the files it includes. [chain] holds the including files.
+func mergeData[T Configurable](cfg T, cfgPath string, data []byte, format fileFormat, o fileOptions, chain []string) error {
+	if o.checkPerms {
+		if err := checkFilePermissions(cfg, cfgPath, o); err != nil {
+			return err
+		}
+	}
+	if err := loadIncludes(cfg, cfgPath, data, format, o, chain); err != nil {
+		return err
+	}
+	return mergeParsed(cfg, cfgPath, data, format, o)
+}
 
-				return fmt.Errorf("failed to parse config from %s: %v", cfgPath, err)
-			}
+// mergeParsed parses data read from source and merges it into cfg
+func mergeParsed[T Configurable](cfg T, cfgPath string, data []byte, format fileFormat, o fileOptions) error {
+	lg := loggerFor(cfg)
+	data, err := migrateData(lg, cfgPath, data, format, o)
+	if err != nil {
+		return err
+	}
 
-			if err := mergo.Merge(cfg, tmp, mergo.WithOverride); err != nil {
-				log.Warn().
-					WithMeta("scope", "env").
-					WithMeta("path", cfgPath).
-					Msgf("failed to merge config: %v", err).Send()
+	tmp := mirror.Fresh[T]()
+	if err := format.unmarshal(data, tmp, o); err != nil {
+		lg.Warn().
+			WithMeta("scope", "env").
+			WithMeta("path", cfgPath).
+			Msgf("failed to parse: %v", err).Send()
 
-				log.Debug().
-					WithMeta("scope", "env").
-					WithMeta("path", cfgPath).
-					WithMeta("data", string(data)).
-					WithMeta("merge_with", cfg).
-					Msgf("failed to merge config: %v", err).Send()
+		lg.Debug().
+			WithMeta("scope", "env").
+			WithMeta("path", cfgPath).
+			WithMeta("data", string(data)).
+			Msgf("failed to parse: %v", err).Send()
 
-				return fmt.Errorf("failed to merge config from %s: %v", cfgPath, err)
-			}
+		return newConfigError(cfgPath, data, err)
+	}
 
-			log.Info().
-				WithMeta("scope", "env").
-				WithMeta("path", cfgPath).
-				Msgf("loaded config from %s", cfgPath).Send()
-		}
-		return nil
-	}, nil
+	if o.expandEnv {
+		expandEnvValues(tmp)
+	}
+
+	err = trackSource(cfg, cfgPath, func() error {
+		return mergeConfig(cfg, tmp)
+	})
+	if err != nil {
+		lg.Warn().
+			WithMeta("scope", "env").
+			WithMeta("path", cfgPath).
+			Msgf("failed to merge config: %v", err).Send()
+
+		lg.Debug().
+			WithMeta("scope", "env").
+			WithMeta("path", cfgPath).
+			WithMeta("data", string(data)).
+			WithMeta("merge_with", cfg).
+			Msgf("failed to merge config: %v", err).Send()
+
+		return &ConfigError{Path: cfgPath, Msg: fmt.Sprintf("failed to merge config: %v", err), Err: err}
+	}
+
+	if err := mergeProfileSection(cfg, cfgPath, data, format, o); err != nil {
+		return err
+	}
+
+	lg.Info().
+		WithMeta("scope", "env").
+		WithMeta("path", cfgPath).
+		Msgf("loaded config from %s", cfgPath).Send()
+	return nil
 }
 
 // FromYAMLConfigs loads a config from a file with
@@ -123,24 +306,66 @@ func FromYAML[T Configurable](pth string) (func(T) error, error) {
 // [filename] should be a filename or filepath relative to
 // any of the above locations. The extension is optional and
 // will be automatically added.
-func FromYAMLConfigs[T Configurable](filename string) (func(T) error, error) {
+func FromYAMLConfigs[T Configurable](filename string, opts ...FileOption) (func(T) error, error) {
+	return fromConfigs[T](filename, yamlFormat, newFileOptions(opts))
+}
+
+// FromTOMLConfigs is FromYAMLConfigs for TOML config files
+func FromTOMLConfigs[T Configurable](filename string, opts ...FileOption) (func(T) error, error) {
+	return fromConfigs[T](filename, tomlFormat, newFileOptions(opts))
+}
+
+// FromJSONConfigs is FromYAMLConfigs for JSON config files
+func FromJSONConfigs[T Configurable](filename string, opts ...FileOption) (func(T) error, error) {
+	return fromConfigs[T](filename, jsonFormat, newFileOptions(opts))
+}
+
+// YAMLConfigPaths returns every path FromYAMLConfigs may load
+// [filename] from, e.g. for Loader.WatchPaths
+func YAMLConfigPaths(filename string) []string { return configPaths(filename, yamlFormat) }
+
+// TOMLConfigPaths returns every path FromTOMLConfigs may load [filename] from
+func TOMLConfigPaths(filename string) []string { return configPaths(filename, tomlFormat) }
+
+// JSONConfigPaths returns every path FromJSONConfigs may load [filename] from
+func JSONConfigPaths(filename string) []string { return configPaths(filename, jsonFormat) }
+
+func configPaths(filename string, format fileFormat) []string {
 	filename = filepath.Clean(filename)
-	if filename == "." {
-		return nil, ErrInvalidConfigFilename
+	if format.hasExt(filepath.Ext(filename)) {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename))
 	}
 
-	return func(cfg T) error {
-		paths := resolvePaths()
+	var paths []string
+	for _, dir := range configDirs() {
+		for _, ext := range format.exts {
+			paths = append(paths, filepath.Join(dir, filename+ext))
+		}
+	}
+	return paths
+}
 
-		for _, dir := range paths {
-			exec, err := FromYAML[T](filepath.Join(dir, filename))
+func fromConfigs[T Configurable](filename string, format fileFormat, o fileOptions) (func(T) error, error) {
+	filename, err := trimConfigExt(filename, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(cfg T) error {
+		var (
+			tried []string
+			found bool
+		)
+		for _, dir := range resolvePaths(loggerFor(cfg)) {
+			t, ok, err := loadFileSet(cfg, filepath.Join(dir, filename), format, o)
+			tried, found = append(tried, t...), found || ok
 			if err != nil {
 				return err
 			}
+		}
 
-			if err := exec(cfg); err != nil {
-				return err
-			}
+		if o.requireFile && !found {
+			return noConfigFileError(loggerFor(cfg), tried)
 		}
 		return nil
 	}, nil
@@ -0,0 +1,792 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/logging/logtest"
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCfg struct {
+	Name string `yaml:"name" toml:"name" json:"name"`
+	Port int    `yaml:"port" toml:"port" json:"port"`
+}
+
+func (c *testCfg) Validate() error { return nil }
+
+type includeCfg struct {
+	Includes `yaml:",inline"`
+	Name     string `yaml:"name" toml:"name"`
+	Port     int    `yaml:"port" toml:"port"`
+}
+
+func (c *includeCfg) Validate() error { return nil }
+
+func writeFile(t *testing.T, pth, data string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0o700))
+	require.NoError(t, os.WriteFile(pth, []byte(data), 0o600))
+}
+
+func TestFromYAML_TOML_Merge(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), "name: yaml\nport: 1\n")
+	writeFile(t, filepath.Join(dir, "config.toml"), "port = 2\n")
+
+	loader := NewLoader[*testCfg]()
+	loader.RegisterCallback(
+		MustFn(FromYAML[*testCfg](filepath.Join(dir, "config"))),
+		MustFn(FromTOML[*testCfg](filepath.Join(dir, "config.toml"))),
+	)
+	require.NoError(t, loader.Load())
+
+	assert.Equal(t, &testCfg{Name: "yaml", Port: 2}, loader.Current())
+}
+
+func TestFromTOML_InvalidExtension(t *testing.T) {
+	lg, capture := logtest.NewLogger(t, log.DEBUG)
+	prev := log.DefaultLogger()
+	log.Register(lg)
+	defer log.Register(prev)
+
+	_, err := FromTOML[*testCfg]("config.yml")
+	assert.ErrorIs(t, err, ErrInvalidConfigFilename)
+	assert.ErrorContains(t, err, "config.yml is not a .toml file")
+	assert.NotEmpty(t, TOMLConfigPaths("config"))
+	assert.Empty(t, capture.Entries(), "callers log what they want, not the default logger")
+}
+
+func TestFromJSONConfigs(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(CTFJX_CONFIG_DIR_ENV, dir)
+	writeFile(t, filepath.Join(dir, "generated.json"), `{"name": "json", "port": 3}`)
+
+	loader := NewLoader[*testCfg]()
+	loader.RegisterCallback(MustFn(FromJSONConfigs[*testCfg]("generated")))
+	require.NoError(t, loader.Load())
+
+	assert.Equal(t, &testCfg{Name: "json", Port: 3}, loader.Current())
+}
+
+func TestFromEnv(t *testing.T) {
+	type dbCfg struct {
+		URL string
+	}
+	type envCfg struct {
+		testCfg
+		DB       *dbCfg
+		MaxConns int `env:"CONNS"`
+		Tags     []string
+		Secret   string `env:"-"`
+	}
+
+	t.Setenv("CTFJX_NAME", "env")
+	t.Setenv("CTFJX_DB_URL", "postgres://db")
+	t.Setenv("CTFJX_CONNS", "8")
+	t.Setenv("CTFJX_TAGS", "a, b")
+	t.Setenv("CTFJX_SECRET", "nope")
+
+	cfg := &envCfg{}
+	fn := MustFn(FromEnv[*envCfg](CTFJX_ENV_PREFIX))
+	require.NoError(t, fn(cfg))
+
+	assert.Equal(t, "env", cfg.Name)
+	require.NotNil(t, cfg.DB)
+	assert.Equal(t, "postgres://db", cfg.DB.URL)
+	assert.Equal(t, 8, cfg.MaxConns)
+	assert.Equal(t, []string{"a", "b"}, cfg.Tags)
+	assert.Empty(t, cfg.Secret)
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for in, out := range map[string]string{
+		"HeartbeatInterval": "HEARTBEAT_INTERVAL",
+		"DBUrl":             "DB_URL",
+		"URL":               "URL",
+		"Port2":             "PORT2",
+	} {
+		assert.Equal(t, out, toSnakeCase(in))
+	}
+}
+
+func TestFromFlags(t *testing.T) {
+	type flagCfg struct {
+		testCfg
+		ListenAddr string `flag:"listen-addr" usage:"address to listen on"`
+		Debug      bool   `flag:"debug"`
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fn := MustFn(FromFlags[*flagCfg](fs))
+	require.NoError(t, fs.Parse([]string{"--listen-addr", ":8443", "--debug"}))
+
+	cfg := &flagCfg{ListenAddr: ":80"}
+	require.NoError(t, fn(cfg))
+
+	assert.Equal(t, ":8443", cfg.ListenAddr)
+	assert.True(t, cfg.Debug)
+}
+
+func TestValidateStruct(t *testing.T) {
+	type validateCfg struct {
+		Name    string        `validate:"required"`
+		Port    int           `validate:"min=1,max=65535"`
+		URL     string        `validate:"url"`
+		Mode    string        `validate:"oneof=dev prod"`
+		Timeout time.Duration `validate:"min=1s"`
+	}
+
+	err := ValidateStruct(&validateCfg{Port: 0, URL: "nope", Mode: "test", Timeout: time.Millisecond})
+
+	var verrs ValidationErrors
+	require.ErrorAs(t, err, &verrs)
+	assert.Len(t, verrs, 5)
+
+	assert.NoError(t, ValidateStruct(&validateCfg{
+		Name: "ok", Port: 80, URL: "https://ctf.example", Mode: "prod", Timeout: time.Second,
+	}))
+}
+
+func TestLoader_WatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "config.yml")
+	writeFile(t, pth, "port: 1\n")
+
+	loader := NewLoader[*testCfg]()
+	loader.RegisterCallback(MustFn(FromYAML[*testCfg](pth)))
+	loader.WatchPaths(pth)
+	require.NoError(t, loader.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, loader.WatchFiles(ctx))
+
+	writeFile(t, pth, "port: 2\n")
+	assert.Eventually(t, func() bool {
+		return loader.Current().Port == 2
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestLoader_Subscribe(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "config.yml")
+	writeFile(t, pth, "port: 1\n")
+
+	loader := NewLoader[*testCfg]()
+	loader.RegisterCallback(MustFn(FromYAML[*testCfg](pth)))
+
+	var calls [][2]int
+	loader.Subscribe(func(old, new *testCfg) {
+		oldPort := 0
+		if old != nil {
+			oldPort = old.Port
+		}
+		calls = append(calls, [2]int{oldPort, new.Port})
+	})
+
+	require.NoError(t, loader.Load())
+	writeFile(t, pth, "port: 2\n")
+	require.NoError(t, loader.Load())
+
+	assert.Equal(t, [][2]int{{0, 1}, {1, 2}}, calls)
+}
+
+func TestLoader_RejectKeepsPrevious(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "config.yml")
+	writeFile(t, pth, "port: 1\n")
+
+	loader := NewLoader[*testCfg]()
+	loader.RegisterCallback(MustFn(FromYAML[*testCfg](pth)))
+	loader.SubscribeCheck(func(old, new *testCfg) error {
+		if new.Port > 1 {
+			return errors.New("port change not allowed")
+		}
+		return nil
+	})
+
+	require.NoError(t, loader.Load())
+	assert.Equal(t, uint64(1), loader.Generation())
+
+	writeFile(t, pth, "port: 2\n")
+	err := loader.Load()
+	assert.ErrorIs(t, err, ErrConfigRejected)
+	assert.ErrorIs(t, loader.LastError(), ErrConfigRejected)
+	assert.Equal(t, 1, loader.Current().Port)
+	assert.Equal(t, uint64(1), loader.Generation())
+}
+
+func TestFromYAML_Strict(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "config.yml")
+	writeFile(t, pth, "name: typo\nprot: 1\n")
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromYAML[*testCfg](pth))(cfg))
+	assert.Error(t, MustFn(FromYAML[*testCfg](pth, Strict()))(&testCfg{}))
+}
+
+func TestFromYAML_ExpandEnv(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "config.yml")
+	writeFile(t, pth, "name: ${TEST_CTFJX_HOST:-localhost}-$KEEP-${TEST_CTFJX_SUFFIX}\n")
+	t.Setenv("TEST_CTFJX_SUFFIX", "a")
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromYAML[*testCfg](pth, ExpandEnv()))(cfg))
+	assert.Equal(t, "localhost-$KEEP-a", cfg.Name)
+}
+
+func TestFromYAML_Include(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "shared", "base.toml"), "name = \"base\"\nport = 1\n")
+	writeFile(t, filepath.Join(dir, "agent.yml"), "include: [shared/base.toml]\nport: 2\n")
+
+	cfg := &includeCfg{}
+	require.NoError(t, MustFn(FromYAML[*includeCfg](filepath.Join(dir, "agent.yml"), Strict()))(cfg))
+	assert.Equal(t, "base", cfg.Name)
+	assert.Equal(t, 2, cfg.Port)
+
+	writeFile(t, filepath.Join(dir, "a.yml"), "include: [b.yml]\n")
+	writeFile(t, filepath.Join(dir, "b.yml"), "include: [a.yml]\n")
+	err := MustFn(FromYAML[*includeCfg](filepath.Join(dir, "a.yml")))(&includeCfg{})
+	assert.ErrorIs(t, err, ErrIncludeCycle)
+}
+
+func TestFromSecretFiles(t *testing.T) {
+	type secretCfg struct {
+		Password     string
+		PasswordFile string
+	}
+
+	pth := filepath.Join(t.TempDir(), "db")
+	writeFile(t, pth, "hunter2\n")
+
+	cfg := &secretCfg{PasswordFile: pth}
+	require.NoError(t, resolveSecretFiles(quietLogger, reflect.ValueOf(cfg).Elem()))
+	assert.Equal(t, "hunter2", cfg.Password)
+}
+
+func TestFromRemote(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	daemon := make(chan *socket.Conn, 1)
+	go func() {
+		raw, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		cfg := socket.DefaultConnConfig(raw.RemoteAddr().String(), "daemon", nil)
+		cfg.HeartbeatInterval = 0
+		cfg.Handlers[socket.ActionRequestConfig] = RemoteConfigHandler(func(token string) ([]byte, error) {
+			if token != "enroll" {
+				return nil, errors.New("bad token")
+			}
+			return []byte("name: remote\n"), nil
+		})
+		c := socket.NewConnWithRaw(raw, cfg)
+		daemon <- c
+		c.Listen()
+	}()
+
+	connCfg := socket.DefaultConnConfig(ln.Addr().String(), "agent", nil)
+	connCfg.HeartbeatInterval = 0
+	conn := socket.NewConn(connCfg)
+	require.NoError(t, conn.Connect())
+	defer conn.Close()
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromRemote[*testCfg](conn, "enroll", time.Second))(cfg))
+	assert.Equal(t, "remote", cfg.Name)
+
+	err = MustFn(FromRemote[*testCfg](conn, "nope", time.Second))(&testCfg{})
+	assert.ErrorIs(t, err, ErrRemoteConfigRefused)
+	assert.ErrorContains(t, err, "bad token", "the daemon's reason is returned without waiting")
+
+	load := MustFn(FromRemote[*testCfg](conn, "enroll", time.Second))
+	require.NoError(t, (<-daemon).Send(socket.ActionPushConfig, []byte("name: stale\n")))
+	time.Sleep(50 * time.Millisecond)
+	cfg = &testCfg{}
+	require.NoError(t, load(cfg))
+	assert.Equal(t, "remote", cfg.Name, "a push from before the request does not answer it")
+}
+
+func TestFromYAML_Profile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), "name: base\nport: 1\nprofiles:\n  prod:\n    port: 2\n")
+	writeFile(t, filepath.Join(dir, "config.prod.yml"), "name: prod\n")
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromYAML[*testCfg](filepath.Join(dir, "config"), Profile("prod")))(cfg))
+	assert.Equal(t, &testCfg{Name: "prod", Port: 2}, cfg)
+
+	t.Setenv(CTFJX_PROFILE_ENV, "dev")
+	cfg = &testCfg{}
+	require.NoError(t, MustFn(FromYAML[*testCfg](filepath.Join(dir, "config")))(cfg))
+	assert.Equal(t, &testCfg{Name: "base", Port: 1}, cfg)
+}
+
+func TestLoader_Save(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "config.yml")
+
+	l := NewLoader[*testCfg]()
+	assert.ErrorIs(t, l.Save(pth), ErrNoConfigLoaded)
+
+	l.Set(&testCfg{Name: "saved", Port: 8080})
+	require.NoError(t, l.Save(pth))
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromYAML[*testCfg](strings.TrimSuffix(pth, ".yml")))(cfg))
+	assert.Equal(t, &testCfg{Name: "saved", Port: 8080}, cfg)
+}
+
+type dumpCfg struct {
+	Name     string `yaml:"name"`
+	Port     int    `yaml:"port"`
+	Password string `yaml:"password"`
+}
+
+func (c *dumpCfg) Validate() error { return nil }
+
+func TestLoader_Dump(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), "name: dumped\npassword: hunter2\n")
+	t.Setenv("CTFJX_PORT", "8080")
+
+	l := NewLoader[*dumpCfg]()
+	l.RegisterCallback(
+		MustFn(FromYAML[*dumpCfg](filepath.Join(dir, "config"))),
+		MustFn(FromEnv[*dumpCfg](CTFJX_ENV_PREFIX)),
+	)
+	require.NoError(t, l.Load())
+
+	var buf bytes.Buffer
+	require.NoError(t, l.Dump(&buf, true))
+	out := buf.String()
+	assert.Contains(t, out, "name: dumped # "+filepath.Join(dir, "config.yml"))
+	assert.Contains(t, out, "port: 8080 # env CTFJX_*")
+	assert.Contains(t, out, "password: "+REDACTED)
+	assert.NotContains(t, out, "hunter2")
+}
+
+type defaultsCfg struct {
+	Name    string   `yaml:"name" default:"ctfjx"`
+	Port    int      `yaml:"port" default:"1337"`
+	Timeout Duration `yaml:"timeout" default:"5s"`
+}
+
+func (c *defaultsCfg) Validate() error { return nil }
+
+func TestLoader_Defaults(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), "port: 8080\n")
+
+	l := NewLoader[*defaultsCfg]()
+	l.RegisterCallback(MustFn(FromYAML[*defaultsCfg](filepath.Join(dir, "config"))))
+	require.NoError(t, l.Load())
+
+	cfg := l.Current()
+	assert.Equal(t, "ctfjx", cfg.Name)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, Duration(5*time.Second), cfg.Timeout)
+
+	var buf bytes.Buffer
+	require.NoError(t, l.Dump(&buf, false))
+	assert.Contains(t, buf.String(), "name: ctfjx # defaults")
+}
+
+type schemaCfg struct {
+	Name    string        `yaml:"name" validate:"required,min=3" usage:"event name"`
+	Mode    string        `yaml:"mode" validate:"oneof=jeopardy koth"`
+	Timeout time.Duration `yaml:"timeout"`
+	Ignored string        `yaml:"-"`
+}
+
+func (c *schemaCfg) Validate() error { return nil }
+
+func TestGenerateSchema(t *testing.T) {
+	s := GenerateSchema[*schemaCfg](true)
+
+	assert.Equal(t, JSON_SCHEMA_DRAFT, s.Schema)
+	assert.Equal(t, false, s.AdditionalProperties)
+	assert.Equal(t, []string{"name"}, s.Required)
+	assert.NotContains(t, s.Properties, "ignored")
+
+	name := s.Properties["name"]
+	assert.Equal(t, "event name", name.Description)
+	require.NotNil(t, name.MinLength)
+	assert.Equal(t, 3, *name.MinLength)
+	assert.Equal(t, []any{"jeopardy", "koth"}, s.Properties["mode"].Enum)
+	assert.Equal(t, "string", s.Properties["timeout"].Type)
+
+	_, err := GenerateSchemaJSON[*schemaCfg](false)
+	assert.NoError(t, err)
+}
+
+type unitsCfg struct {
+	Timeout Duration `yaml:"timeout" toml:"timeout" validate:"max=1m"`
+	MaxSize ByteSize `yaml:"max_size" toml:"max_size"`
+}
+
+func (c *unitsCfg) Validate() error { return nil }
+
+func TestUnits(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), "timeout: 30s\nmax_size: 10MB\n")
+
+	cfg := &unitsCfg{}
+	require.NoError(t, MustFn(FromYAML[*unitsCfg](filepath.Join(dir, "config")))(cfg))
+	assert.Equal(t, 30*time.Second, cfg.Timeout.Duration())
+	assert.Equal(t, 10*MB, cfg.MaxSize)
+	assert.NoError(t, ValidateStruct(cfg))
+
+	t.Setenv("CTFJX_TIMEOUT", "2m")
+	t.Setenv("CTFJX_MAX_SIZE", "1.5KiB")
+	require.NoError(t, MustFn(FromEnv[*unitsCfg](CTFJX_ENV_PREFIX))(cfg))
+	assert.Equal(t, 2*time.Minute, cfg.Timeout.Duration())
+	assert.Equal(t, ByteSize(1536), cfg.MaxSize)
+	assert.Error(t, ValidateStruct(cfg))
+
+	var d Duration
+	assert.ErrorIs(t, d.UnmarshalText([]byte("30")), ErrInvalidDuration)
+	_, err := ParseByteSize("10XB")
+	assert.ErrorIs(t, err, ErrInvalidByteSize)
+	assert.Equal(t, "1GiB", GiB.String())
+	assert.Equal(t, "1500B", ByteSize(1500).String())
+}
+
+func TestFromEncrypted(t *testing.T) {
+	encoded, err := GenerateConfigKey()
+	require.NoError(t, err)
+	key, err := parseConfigKey([]byte(encoded))
+	require.NoError(t, err)
+
+	sealed, err := EncryptValue(key, "hunter2")
+	require.NoError(t, err)
+
+	cfg := &testCfg{Name: sealed}
+	t.Setenv(CTFJX_CONFIG_KEY_ENV, "")
+	t.Setenv(CTFJX_CONFIG_KEY_FILE_ENV, "")
+	assert.ErrorIs(t, MustFn(FromEncrypted[*testCfg]())(cfg), ErrMissingConfigKey)
+
+	t.Setenv(CTFJX_CONFIG_KEY_ENV, encoded)
+	require.NoError(t, MustFn(FromEncrypted[*testCfg]())(cfg))
+	assert.Equal(t, "hunter2", cfg.Name)
+
+	other, err := GenerateConfigKey()
+	require.NoError(t, err)
+	t.Setenv(CTFJX_CONFIG_KEY_ENV, other)
+	cfg = &testCfg{Name: sealed}
+	assert.ErrorIs(t, MustFn(FromEncrypted[*testCfg]())(cfg), ErrDecryptFailed)
+}
+
+func TestLoader_Watch(t *testing.T) {
+	l := NewLoader[*testCfg]()
+	l.Set(&testCfg{Name: "first"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := l.Watch(ctx)
+
+	snap := <-ch
+	assert.Equal(t, uint64(1), snap.Generation)
+	assert.Equal(t, "first", snap.Config.Name)
+
+	snap.Config.Name = "mutated"
+	assert.Equal(t, "first", l.Current().Name, "receivers get a copy")
+
+	l.RegisterCallback(func(c *testCfg) error { c.Name = "loaded"; return nil })
+	require.NoError(t, l.Load())
+	require.NoError(t, l.Load())
+
+	snap = <-ch
+	assert.Equal(t, uint64(3), snap.Generation)
+	assert.Equal(t, l.Snapshot().Generation, snap.Generation)
+
+	cancel()
+	for range ch {
+		// drained until closed
+	}
+}
+
+type mergeUser struct {
+	Name  string `yaml:"name"`
+	Email string `yaml:"email"`
+	Admin bool   `yaml:"admin"`
+}
+
+type mergeCfg struct {
+	CIDRs  []string          `yaml:"cidrs" merge:"append"`
+	Labels map[string]string `yaml:"labels" merge:"replace"`
+	Users  []mergeUser       `yaml:"users" merge:"key=Name"`
+	Tags   []string          `yaml:"tags"`
+}
+
+func (c *mergeCfg) Validate() error { return nil }
+
+func TestFromYAML_MergeStrategies(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+cidrs: [10.0.0.0/8]
+labels: {a: "1", b: "2"}
+users: [{name: alice, email: a@example.com}, {name: bob}]
+tags: [x]
+`)
+	writeFile(t, filepath.Join(dir, "config.yaml"), `
+cidrs: [10.0.0.0/8, 192.168.0.0/16]
+labels: {c: "3"}
+users: [{name: alice, admin: true}, {name: carol}]
+tags: [y]
+`)
+
+	cfg := &mergeCfg{}
+	require.NoError(t, MustFn(FromYAML[*mergeCfg](filepath.Join(dir, "config")))(cfg))
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.0.0/16"}, cfg.CIDRs)
+	assert.Equal(t, map[string]string{"c": "3"}, cfg.Labels)
+	assert.Equal(t, []mergeUser{
+		{Name: "alice", Email: "a@example.com", Admin: true},
+		{Name: "bob"},
+		{Name: "carol"},
+	}, cfg.Users)
+	assert.Equal(t, []string{"y"}, cfg.Tags)
+}
+
+func TestFromYAML_RequireFile(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "config")
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromYAML[*testCfg](pth))(cfg))
+
+	err := MustFn(FromYAML[*testCfg](pth, RequireFile()))(cfg)
+	assert.ErrorIs(t, err, ErrNoConfigFile)
+	assert.ErrorContains(t, err, pth+".yml")
+	assert.ErrorContains(t, err, pth+".yaml")
+
+	writeFile(t, pth+".yaml", "name: found\n")
+	require.NoError(t, MustFn(FromYAML[*testCfg](pth, RequireFile()))(cfg))
+	assert.Equal(t, "found", cfg.Name)
+}
+
+func TestFromConsul_Watch(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		value = "name: first\n"
+		index = 1
+	)
+	changed, blocking := make(chan struct{}), make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/kv/ctfjx/config.yml", r.URL.Path)
+		assert.Equal(t, "token", r.Header.Get("X-Consul-Token"))
+		if r.URL.Query().Get("index") != "" {
+			select {
+			case blocking <- struct{}{}:
+			default:
+			}
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		_, _ = w.Write([]byte(value))
+	}))
+	defer srv.Close()
+
+	cc := ConsulConfig{Address: srv.URL, Token: "token", Key: "ctfjx/config.yml"}
+	l := NewLoader[*testCfg]()
+	l.RegisterCallback(MustFn(FromConsul[*testCfg](cc)))
+	require.NoError(t, l.Load())
+	assert.Equal(t, "first", l.Current().Name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, l.WatchConsul(ctx, cc))
+	<-blocking
+
+	mu.Lock()
+	value, index = "name: second\n", 2
+	mu.Unlock()
+	close(changed)
+
+	assert.Eventually(t, func() bool {
+		return l.Current().Name == "second"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+type versionedCfg struct {
+	Version int    `yaml:"version"`
+	Name    string `yaml:"name"`
+	Port    int    `yaml:"port"`
+}
+
+func (c *versionedCfg) Validate() error { return nil }
+
+func TestFromYAML_Migrations(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "config")
+	writeFile(t, pth+".yml", "title: old\nport: 1\n")
+
+	migrations := Migrations(
+		func(doc map[string]any) error { // v1 renamed title to name
+			doc["name"] = doc["title"]
+			delete(doc, "title")
+			return nil
+		},
+		func(doc map[string]any) error { // v2 moved to a new port range
+			doc["port"] = 8000
+			return nil
+		},
+	)
+
+	cfg := &versionedCfg{}
+	require.NoError(t, MustFn(FromYAML[*versionedCfg](pth, migrations, Strict()))(cfg))
+	assert.Equal(t, &versionedCfg{Version: 3, Name: "old", Port: 8000}, cfg)
+
+	writeFile(t, pth+".yml", "version: 4\n")
+	assert.ErrorIs(t, MustFn(FromYAML[*versionedCfg](pth, migrations))(cfg), ErrConfigTooNew)
+}
+
+type docsCfg struct {
+	Name string `yaml:"name" validate:"required" usage:"event name"`
+	DB   struct {
+		URL     string   `yaml:"url" usage:"database url"`
+		Timeout Duration `yaml:"timeout" default:"5s"`
+	} `yaml:"db"`
+	Tags []string `yaml:"tags" env:"-"`
+}
+
+func (c *docsCfg) Validate() error { return nil }
+
+func TestDescribeConfig(t *testing.T) {
+	keys := DescribeConfig[*docsCfg](CTFJX_ENV_PREFIX)
+	assert.Equal(t, []ConfigKey{
+		{Key: "name", Type: "string", Description: "event name", Env: "CTFJX_NAME", Required: true},
+		{Key: "db.url", Type: "string", Description: "database url", Env: "CTFJX_DB_URL"},
+		{Key: "db.timeout", Type: "duration", Default: "5s", Env: "CTFJX_DB_TIMEOUT"},
+		{Key: "tags", Type: "list of string"},
+	}, keys)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSample(&buf, keys))
+	assert.Equal(t, "# event name\n# required\nname:\ndb:\n  # database url\n  url:\n  timeout: 5s\ntags:\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteReference(&buf, keys))
+	assert.Contains(t, buf.String(), "| `db.timeout` | duration | `5s` | `CTFJX_DB_TIMEOUT` |  |")
+}
+
+func TestFromDotEnv(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), ".env")
+	writeFile(t, pth, `
+# local dev
+export CTFJX_NAME="dot\tenv"
+CTFJX_PORT=8080 # inline comment
+CTFJX_SET='literal \n'
+`)
+	t.Setenv("CTFJX_SET", "already set")
+	t.Setenv("CTFJX_NAME", "")
+	os.Unsetenv("CTFJX_NAME")
+	t.Setenv("CTFJX_PORT", "")
+	os.Unsetenv("CTFJX_PORT")
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromDotEnv[*testCfg](pth))(cfg))
+	require.NoError(t, MustFn(FromEnv[*testCfg](CTFJX_ENV_PREFIX))(cfg))
+	assert.Equal(t, &testCfg{Name: "dot\tenv", Port: 8080}, cfg)
+	assert.Equal(t, "already set", os.Getenv("CTFJX_SET"))
+
+	vars, err := parseDotEnv([]byte("A='literal \\n'\n"))
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{{"A", `literal \n`}}, vars)
+
+	_, err = parseDotEnv([]byte("not a var\n"))
+	assert.Error(t, err)
+}
+
+func TestLoader_SetLogger(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), "name: logged\n")
+
+	lg, capture := logtest.NewLogger(t, log.DEBUG)
+	l := NewLoader[*testCfg]()
+	l.SetLogger(lg)
+	l.RegisterCallback(MustFn(FromYAML[*testCfg](filepath.Join(dir, "config"))))
+	require.NoError(t, l.Load())
+	assert.True(t, capture.Contains(log.INFO, "loaded config from"))
+
+	capture.Reset()
+	l.Quiet()
+	require.NoError(t, l.Load())
+	assert.Empty(t, capture.Entries())
+}
+
+func TestFromYAML_CheckPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+
+	pth := filepath.Join(t.TempDir(), "config")
+	writeFile(t, pth+".yml", "name: perms\n")
+	require.NoError(t, os.Chmod(pth+".yml", 0o600))
+
+	cfg := &testCfg{}
+	require.NoError(t, MustFn(FromYAML[*testCfg](pth, CheckPermissions()))(cfg))
+
+	require.NoError(t, os.Chmod(pth+".yml", 0o666))
+	assert.ErrorIs(t, MustFn(FromYAML[*testCfg](pth, CheckPermissions()))(cfg), ErrInsecureConfigFile)
+
+	require.NoError(t, os.Chmod(pth+".yml", 0o600))
+	assert.ErrorIs(t, MustFn(FromYAML[*testCfg](pth, CheckPermissions(os.Geteuid()+1)))(cfg), ErrInsecureConfigFile)
+
+	assert.True(t, hasSecretFields(reflect.TypeOf(&dumpCfg{})))
+	assert.False(t, hasSecretFields(reflect.TypeOf(&testCfg{})))
+}
+
+func TestConfigError(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "config")
+
+	writeFile(t, pth+".yml", "name: typo\nprot: 1\n")
+	err := MustFn(FromYAML[*testCfg](pth, Strict()))(&testCfg{})
+	var ce *ConfigError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, pth+".yml", ce.Path)
+	assert.Equal(t, 2, ce.Line)
+	assert.Equal(t, "prot", ce.Key)
+	assert.Equal(t, pth+".yml:2:1: prot: unknown field", ce.Error())
+
+	writeFile(t, pth+".yml", "timeout: 30s\nmax_size: lots\n")
+	err = MustFn(FromYAML[*unitsCfg](pth))(&unitsCfg{})
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, 2, ce.Line)
+	assert.Equal(t, "max_size", ce.Key)
+
+	require.NoError(t, os.Remove(pth+".yml"))
+	writeFile(t, pth+".json", "{\n  \"name\": \"x\",\n  \"port\": \"nope\"\n}")
+	err = MustFn(FromJSON[*testCfg](pth))(&testCfg{})
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, 3, ce.Line)
+	assert.Equal(t, "port", ce.Key)
+}
@@ -0,0 +1,58 @@
+package env
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/lattesec/log"
+)
+
+// Loggers of the loaders that are currently loading, keyed by the
+// config being loaded, so the file, env and secret loaders log
+// through the Loader that called them
+var loadLoggers sync.Map // any -> *log.Logger
+
+var quietLogger = func() *log.Logger {
+	lg, err := log.NewLogger().
+		Name("env").
+		WithLevel(log.QUIET).
+		WithStdout(false).
+		WithStderr(false).
+		Build()
+	if err != nil {
+		panic(err)
+	}
+	return lg
+}()
+
+type loaderLogger struct {
+	lg atomic.Pointer[log.Logger]
+}
+
+// SetLogger makes the loader and the loaders registered with it
+// log through lg instead of the default logger. nil restores the
+// default logger.
+func (l *Loader[T]) SetLogger(lg *log.Logger) {
+	l.logs.lg.Store(lg)
+}
+
+// Quiet silences every message logged while loading,
+// for programs embedding ctfjx config loading
+func (l *Loader[T]) Quiet() {
+	l.SetLogger(quietLogger)
+}
+
+func (l *Loader[T]) logger() *log.Logger {
+	if lg := l.logs.lg.Load(); lg != nil {
+		return lg
+	}
+	return log.DefaultLogger()
+}
+
+// loggerFor returns the logger of the Loader loading cfg
+func loggerFor(cfg any) *log.Logger {
+	if lg, ok := loadLoggers.Load(cfg); ok {
+		return lg.(*log.Logger)
+	}
+	return log.DefaultLogger()
+}
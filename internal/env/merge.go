@@ -0,0 +1,177 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"dario.cat/mergo"
+)
+
+const (
+	MERGE_REPLACE = "replace"
+	MERGE_APPEND  = "append"
+	MERGE_BY_KEY  = "key"
+)
+
+var ErrInvalidMergeStrategy = errors.New("invalid merge strategy")
+
+// mergeConfig merges src over dst like mergo.WithOverride, except
+// for fields with a `merge` tag, which control how a layer
+// combines with the layers loaded before it:
+//
+//   - merge:"replace": the layer's slice or map replaces the
+//     previous one wholesale (the default for slices)
+//   - merge:"append": the layer's slice is appended to the previous
+//     one, skipping duplicates. Maps are merged key by key (the
+//     default for maps).
+//   - merge:"key=Name": slices of structs are merged element by
+//     element, matching elements by their Name field
+//
+// so that e.g. lists of trusted CIDRs can compose across files.
+// src may be modified.
+func mergeConfig(dst, src any) error {
+	if err := prepareMerge(reflect.ValueOf(dst), reflect.ValueOf(src)); err != nil {
+		return err
+	}
+	return mergo.Merge(dst, src, mergo.WithOverride)
+}
+
+// prepareMerge rewrites src (and dst for replaced maps)
+// so that mergo's override implements the merge tags
+func prepareMerge(dst, src reflect.Value) error {
+	for dst.Kind() == reflect.Ptr {
+		if dst.IsNil() || src.IsNil() {
+			return nil
+		}
+		dst, src = dst.Elem(), src.Elem()
+	}
+	if dst.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		df, sf := dst.Field(i), src.Field(i)
+		if !df.CanSet() {
+			continue
+		}
+
+		tag := field.Tag.Get("merge")
+		if tag == "" {
+			if err := prepareMerge(df, sf); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.IsZero() {
+			continue // not set by this layer
+		}
+		if err := applyMergeStrategy(field, tag, df, sf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMergeStrategy(field reflect.StructField, tag string, dst, src reflect.Value) error {
+	strategy, key, _ := strings.Cut(tag, "=")
+
+	switch {
+	case strategy == MERGE_REPLACE && dst.Kind() == reflect.Map:
+		dst.SetZero()
+	case strategy == MERGE_REPLACE && dst.Kind() == reflect.Slice,
+		strategy == MERGE_APPEND && dst.Kind() == reflect.Map:
+		// already what mergo does
+	case strategy == MERGE_APPEND && dst.Kind() == reflect.Slice:
+		src.Set(appendUnique(dst, src))
+	case strategy == MERGE_BY_KEY && dst.Kind() == reflect.Slice && key != "":
+		merged, err := mergeByKey(dst, src, key)
+		if err != nil {
+			return fmt.Errorf("failed to merge %s: %w", field.Name, err)
+		}
+		src.Set(merged)
+	default:
+		return fmt.Errorf("%w: %q for %s (%s)", ErrInvalidMergeStrategy, tag, field.Name, field.Type)
+	}
+	return nil
+}
+
+func appendUnique(dst, src reflect.Value) reflect.Value {
+	out := reflect.MakeSlice(dst.Type(), 0, dst.Len()+src.Len())
+	out = reflect.AppendSlice(out, dst)
+	for i := 0; i < src.Len(); i++ {
+		if !containsValue(out, src.Index(i)) {
+			out = reflect.Append(out, src.Index(i))
+		}
+	}
+	return out
+}
+
+func containsValue(s, v reflect.Value) bool {
+	for i := 0; i < s.Len(); i++ {
+		if reflect.DeepEqual(s.Index(i).Interface(), v.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeByKey merges the elements of src into those of dst with
+// the same key field, appending elements with new keys
+func mergeByKey(dst, src reflect.Value, key string) (reflect.Value, error) {
+	elemType := dst.Type().Elem()
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("%w: key=%s needs a slice of structs", ErrInvalidMergeStrategy, key)
+	}
+	if _, ok := structType.FieldByName(key); !ok {
+		return reflect.Value{}, fmt.Errorf("%w: %s has no field %s", ErrInvalidMergeStrategy, structType, key)
+	}
+
+	keyOf := func(v reflect.Value) any {
+		v = reflect.Indirect(v)
+		if !v.IsValid() {
+			return nil
+		}
+		return v.FieldByName(key).Interface()
+	}
+
+	out := reflect.MakeSlice(dst.Type(), 0, dst.Len()+src.Len())
+	index := make(map[any]int, dst.Len())
+	for i := 0; i < dst.Len(); i++ {
+		index[keyOf(dst.Index(i))] = out.Len()
+		out = reflect.Append(out, dst.Index(i))
+	}
+
+	for i := 0; i < src.Len(); i++ {
+		elem := src.Index(i)
+		j, ok := index[keyOf(elem)]
+		if !ok {
+			index[keyOf(elem)] = out.Len()
+			out = reflect.Append(out, elem)
+			continue
+		}
+
+		// merge into a copy so dst's elements are left untouched
+		merged := reflect.New(structType)
+		merged.Elem().Set(reflect.Indirect(out.Index(j)))
+		overlay := reflect.New(structType)
+		overlay.Elem().Set(reflect.Indirect(elem))
+		if err := mergeConfig(merged.Interface(), overlay.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+
+		if elemType.Kind() == reflect.Ptr {
+			out.Index(j).Set(merged)
+		} else {
+			out.Index(j).Set(merged.Elem())
+		}
+	}
+	return out, nil
+}
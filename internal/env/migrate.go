@@ -0,0 +1,88 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lattesec/log"
+)
+
+const (
+	CONFIG_VERSION_KEY     = "version"
+	DEFAULT_CONFIG_VERSION = 1 // of files without a version key
+)
+
+var (
+	ErrConfigTooNew         = errors.New("config version is newer than supported")
+	ErrInvalidConfigVersion = errors.New("invalid config version")
+)
+
+// Migration upgrades a config document by one version, in place.
+// The document is the file as decoded into generic maps.
+type Migration func(doc map[string]any) error
+
+// Migrations upgrades config files written for older schemas
+// before they are decoded into the config struct.
+//
+// A file's version is read from its top-level `version` key,
+// defaulting to 1. migrations[0] upgrades version 1 to 2,
+// migrations[1] version 2 to 3 and so on, so the current version
+// is len(migrations)+1. Files newer than that fail to load.
+//
+// Config structs loaded with Strict have to declare a Version field.
+func Migrations(migrations ...Migration) FileOption {
+	return func(o *fileOptions) {
+		o.migrations = migrations
+		o.version = DEFAULT_CONFIG_VERSION + len(migrations)
+	}
+}
+
+// migrateData returns data upgraded to the current version,
+// re-encoded in the same format
+func migrateData(lg *log.Logger, cfgPath string, data []byte, format fileFormat, o fileOptions) ([]byte, error) {
+	if len(o.migrations) == 0 {
+		return data, nil
+	}
+
+	doc := make(map[string]any)
+	if err := format.unmarshal(data, &doc, fileOptions{}); err != nil {
+		return nil, newConfigError(cfgPath, data, err)
+	}
+
+	version, err := docVersion(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfgPath, err)
+	}
+	switch {
+	case version > o.version:
+		return nil, fmt.Errorf("%w: %s is version %d, expected at most %d", ErrConfigTooNew, cfgPath, version, o.version)
+	case version == o.version:
+		return data, nil
+	}
+
+	for v := version; v < o.version; v++ {
+		if err := o.migrations[v-DEFAULT_CONFIG_VERSION](doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s from version %d to %d: %w", cfgPath, v, v+1, err)
+		}
+	}
+	doc[CONFIG_VERSION_KEY] = o.version
+
+	lg.Info().
+		WithMeta("scope", "env").
+		WithMeta("path", cfgPath).
+		Msgf("migrated config from version %d to %d", version, o.version).Send()
+	return format.marshal(doc)
+}
+
+func docVersion(doc map[string]any) (int, error) {
+	raw, ok := doc[CONFIG_VERSION_KEY]
+	if !ok {
+		return DEFAULT_CONFIG_VERSION, nil
+	}
+	version, err := strconv.Atoi(fmt.Sprint(raw))
+	if err != nil || version < DEFAULT_CONFIG_VERSION {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidConfigVersion, raw)
+	}
+	return version, nil
+}
@@ -0,0 +1,43 @@
+package env
+
+// FileOption configures how the file loaders read config files
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	strict    bool
+	expandEnv bool
+	profile   string
+
+	requireFile bool
+
+	version    int
+	migrations []Migration
+
+	checkPerms bool
+	owners     []int
+}
+
+func newFileOptions(opts []FileOption) fileOptions {
+	var o fileOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Strict fails loading when a config file contains keys that do
+// not exist in the config struct, so that typos are caught instead
+// of silently falling back to the defaults.
+//
+// Config structs loading files with an `include` key
+// have to embed Includes to be loaded strictly.
+func Strict() FileOption {
+	return func(o *fileOptions) { o.strict = true }
+}
+
+// RequireFile fails loading when none of the candidate files
+// exist, reporting every path that was tried. Without it, a
+// missing file silently leaves the config at its defaults.
+func RequireFile() FileOption {
+	return func(o *fileOptions) { o.requireFile = true }
+}
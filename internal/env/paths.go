@@ -23,7 +23,16 @@ const (
 // ./.ctfjx/
 // $XDG_CONFIG_HOME/ctfjx/ OR $HOME/.config/ctfjx/
 // /etc/ctfjx/ OR %APPDATA%/ctfjx/
-func resolvePaths() []string {
+func resolvePaths(lg *log.Logger) []string {
+	paths := configDirs()
+	lg.Debug().
+		WithMeta("scope", "env").
+		Msgf("using config paths: %s", strings.Join(paths, ", ")).Send()
+	return paths
+}
+
+// configDirs returns the config directories, see resolvePaths
+func configDirs() []string {
 	var paths []string
 
 	if runtime.GOOS == "windows" {
@@ -46,9 +55,5 @@ func resolvePaths() []string {
 		paths = append(paths, p)
 	}
 
-	log.Debug().
-		WithMeta("scope", "env").
-		Msgf("using config paths: %s", strings.Join(paths, ", ")).Send()
-
 	return paths
 }
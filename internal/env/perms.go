@@ -0,0 +1,84 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var ErrInsecureConfigFile = errors.New("insecure config file")
+
+// CheckPermissions refuses config files that anyone can write to,
+// or that are owned by a user other than owners, since configs
+// may hold enrollment tokens. owners default to the current user
+// and root. Ownership is not checked on Windows.
+//
+// Files readable by others are allowed, but warned about if the
+// config struct has secret fields (see Loader.Dump).
+func CheckPermissions(owners ...int) FileOption {
+	return func(o *fileOptions) {
+		o.checkPerms = true
+		o.owners = owners
+	}
+}
+
+func checkFilePermissions[T Configurable](cfg T, cfgPath string, o fileOptions) error {
+	fi, err := os.Stat(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	mode := fi.Mode().Perm()
+	if mode&0o002 != 0 {
+		return fmt.Errorf("%w: %s is world-writable (%s)", ErrInsecureConfigFile, cfgPath, mode)
+	}
+
+	if uid, ok := fileOwner(fi); ok {
+		owners := o.owners
+		if len(owners) == 0 {
+			owners = []int{os.Geteuid(), 0}
+		}
+		if !slices.Contains(owners, uid) {
+			return fmt.Errorf("%w: %s is owned by uid %d", ErrInsecureConfigFile, cfgPath, uid)
+		}
+	}
+
+	if mode&0o044 != 0 && hasSecretFields(reflect.TypeOf(cfg)) {
+		loggerFor(cfg).Warn().
+			WithMeta("scope", "env").
+			WithMeta("path", cfgPath).
+			WithMeta("mode", mode.String()).
+			Msgf("%s may contain secrets but is readable by other users", cfgPath).Send()
+	}
+	return nil
+}
+
+func hasSecretFields(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		if isNestedStruct(field.Type) {
+			if hasSecretFields(field.Type) {
+				return true
+			}
+			continue
+		}
+		// secret file paths are not secrets themselves
+		if !strings.HasSuffix(field.Name, SECRET_FILE_SUFFIX) && isSecretField(t, field) {
+			return true
+		}
+	}
+	return false
+}
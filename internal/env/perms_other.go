@@ -0,0 +1,9 @@
+//go:build !unix
+
+package env
+
+import "os"
+
+func fileOwner(os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,69 @@
+package env
+
+import (
+	"fmt"
+	"os"
+)
+
+const CTFJX_PROFILE_ENV = "CTFJX_PROFILE"
+
+// Profile selects the config profile to overlay on top of the
+// base config, overriding $CTFJX_PROFILE.
+//
+// With a profile selected, e.g. "prod", the file loaders merge
+//
+//  1. config.yml
+//  2. the `profiles.prod` section of config.yml
+//  3. config.prod.yml
+//
+// so that one config tree serves local testing and the live event.
+// Config structs loaded with Strict have to declare the section as
+// `Profiles map[string]*Cfg` to be allowed a `profiles` key.
+func Profile(name string) FileOption {
+	return func(o *fileOptions) { o.profile = name }
+}
+
+func (o fileOptions) activeProfile() string {
+	if o.profile != "" {
+		return o.profile
+	}
+	return os.Getenv(CTFJX_PROFILE_ENV)
+}
+
+func mergeProfileSection[T Configurable](cfg T, cfgPath string, data []byte, format fileFormat, o fileOptions) error {
+	lg := loggerFor(cfg)
+	profile := o.activeProfile()
+	if profile == "" {
+		return nil
+	}
+
+	var section struct {
+		Profiles map[string]T `yaml:"profiles" toml:"profiles" json:"profiles"`
+	}
+	if err := format.unmarshal(data, &section, fileOptions{}); err != nil {
+		return newConfigError(cfgPath, data, err)
+	}
+
+	overlay, ok := section.Profiles[profile]
+	if !ok {
+		return nil
+	}
+	if o.expandEnv {
+		expandEnvValues(overlay)
+	}
+
+	source := fmt.Sprintf("%s (profile %s)", cfgPath, profile)
+	err := trackSource(cfg, source, func() error {
+		return mergeConfig(cfg, overlay)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to merge profile %s from %s: %v", profile, cfgPath, err)
+	}
+
+	lg.Info().
+		WithMeta("scope", "env").
+		WithMeta("path", cfgPath).
+		WithMeta("profile", profile).
+		Msgf("applied profile %s from %s", profile, cfgPath).Send()
+	return nil
+}
@@ -0,0 +1,100 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+)
+
+// Sources being recorded for the configs currently being loaded,
+// keyed by the config pointer
+var provenances sync.Map // any -> *provenance
+
+// Which source set each field, keyed by its Go path, e.g. DB.URL
+type provenance struct {
+	mu      sync.Mutex
+	sources map[string]string
+}
+
+func recordProvenance(cfg any) *provenance {
+	p := &provenance{sources: make(map[string]string)}
+	provenances.Store(cfg, p)
+	return p
+}
+
+func stopProvenance(cfg any) {
+	provenances.Delete(cfg)
+}
+
+// trackSource runs fn and attributes every field of cfg it changed
+// to source. It is a plain call if cfg's sources aren't recorded.
+func trackSource(cfg any, source string, fn func() error) error {
+	v, ok := provenances.Load(cfg)
+	if !ok {
+		return fn()
+	}
+	p := v.(*provenance)
+
+	before := make(map[string]string)
+	flattenFields(reflect.ValueOf(cfg), "", before)
+	if err := fn(); err != nil {
+		return err
+	}
+	after := make(map[string]string)
+	flattenFields(reflect.ValueOf(cfg), "", after)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, val := range after {
+		if prev, ok := before[k]; !ok || prev != val {
+			p.sources[k] = source
+		}
+	}
+	return nil
+}
+
+func flattenFields(v reflect.Value, prefix string, out map[string]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			out[prefix] = "nil"
+			return
+		}
+		flattenFields(v.Elem(), prefix, out)
+	case reflect.Struct:
+		if isLeafStruct(v.Type()) {
+			out[prefix] = fmt.Sprintf("%#v", v.Interface())
+			return
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() && !field.Anonymous {
+				continue
+			}
+			if field.Anonymous {
+				flattenFields(v.Field(i), prefix, out)
+				continue
+			}
+			flattenFields(v.Field(i), joinFieldPath(prefix, field.Name), out)
+		}
+	default:
+		if v.CanInterface() {
+			out[prefix] = fmt.Sprintf("%#v", v.Interface())
+		}
+	}
+}
+
+// Structs that are values rather than config sections, e.g. time.Time
+func isLeafStruct(t reflect.Type) bool {
+	return t.PkgPath() == "time" || mirror.IsTextUnmarshaler(t)
+}
+
+func joinFieldPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
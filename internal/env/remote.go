@@ -0,0 +1,115 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+var (
+	ErrRemoteConfigTimeout = errors.New("timed out waiting for remote config")
+	ErrRemoteConfigRefused = errors.New("daemon refused the config request")
+)
+
+// FromRemote requests the config from the daemon over conn and
+// merges the YAML it pushes back, so that agents can be
+// bootstrapped with only the daemon's address and a token.
+//
+// The request is an ActionRequestConfig carrying the token,
+// answered with an ActionPushConfig carrying the config, or with
+// an ActionError carrying why the daemon refused it. It registers
+// the ActionPushConfig and ActionError handlers on conn.
+//
+// [timeout] defaults to the connection's MessageRecvTimeout.
+func FromRemote[T Configurable](conn *socket.Conn, token string, timeout time.Duration, opts ...FileOption) (func(T) error, error) {
+	if conn == nil {
+		return nil, socket.ErrConnectionNotEstablished
+	}
+	if timeout <= 0 {
+		timeout = conn.Config.MessageRecvTimeout
+	}
+
+	o := newFileOptions(opts)
+	pushed := make(chan []byte, 1)
+	conn.Register(socket.ActionPushConfig, func(c *socket.Conn, header socket.Header, r io.Reader) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			c.GenLogMsg().Error().Msgf("failed to read pushed config: %v", err).Send()
+			return
+		}
+
+		select {
+		case pushed <- data:
+		default:
+		}
+	})
+	refused := make(chan string, 1)
+	conn.Register(socket.ActionError, func(c *socket.Conn, header socket.Header, r io.Reader) {
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			c.GenLogMsg().Error().Msgf("failed to read error: %v", err).Send()
+			return
+		}
+		c.GenLogMsg().Warn().Msgf("daemon sent an error: %s", msg).Send()
+
+		select {
+		case refused <- string(msg):
+		default:
+		}
+	})
+
+	return func(cfg T) error {
+		// answers that arrived unasked do not answer this request
+		for drained := false; !drained; {
+			select {
+			case <-pushed:
+			case <-refused:
+			default:
+				drained = true
+			}
+		}
+
+		source := "remote:" + conn.Config.Address
+		if err := conn.Send(socket.ActionRequestConfig, []byte(token)); err != nil {
+			return fmt.Errorf("failed to request config from %s: %w", conn.Config.Address, err)
+		}
+
+		select {
+		case data := <-pushed:
+			return mergeParsed(cfg, source, data, yamlFormat, o)
+		case msg := <-refused:
+			return fmt.Errorf("%w: %s", ErrRemoteConfigRefused, msg)
+		case <-time.After(timeout):
+			return fmt.Errorf("%w from %s", ErrRemoteConfigTimeout, conn.Config.Address)
+		}
+	}, nil
+}
+
+// RemoteConfigHandler answers ActionRequestConfig on the daemon
+// with the YAML config returned by fn for the request's token,
+// or with an ActionError if fn fails.
+func RemoteConfigHandler(fn func(token string) ([]byte, error)) socket.HandlerFunc {
+	return func(c *socket.Conn, header socket.Header, r io.Reader) {
+		token, err := io.ReadAll(r)
+		if err != nil {
+			c.GenLogMsg().Error().Msgf("failed to read config request: %v", err).Send()
+			return
+		}
+
+		action, payload := socket.ActionPushConfig, []byte(nil)
+		if payload, err = fn(string(token)); err != nil {
+			c.GenLogMsg().Warn().Msgf("refused config request: %v", err).Send()
+			action, payload = socket.ActionError, []byte(err.Error())
+		}
+
+		if err := c.Send(action, payload); err != nil {
+			log.Error().
+				WithMeta("scope", "env").
+				Msgf("failed to send config: %v", err).Send()
+		}
+	}
+}
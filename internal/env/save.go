@@ -0,0 +1,63 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/goccy/go-yaml"
+)
+
+const DEFAULT_CONFIG_FILE_MODE os.FileMode = 0o600
+
+var ErrNoConfigLoaded = errors.New("no config loaded")
+
+// Save writes the current config to pth as YAML.
+//
+// The file is written to a temp file next to pth and renamed over it,
+// so readers never see a partially written config.
+func (l *Loader[T]) Save(pth string) error {
+	cfg := l.Current()
+	if v := reflect.ValueOf(cfg); !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+		return ErrNoConfigLoaded
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+	return writeFileAtomic(pth, data, DEFAULT_CONFIG_FILE_MODE)
+}
+
+func writeFileAtomic(pth string, data []byte, mode os.FileMode) error {
+	dir := filepath.Dir(pth)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(pth)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file in %s: %v", dir, err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", tmpName, err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to chmod %s: %v", tmpName, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync %s: %v", tmpName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", tmpName, err)
+	}
+
+	if err := os.Rename(tmpName, pth); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %v", tmpName, pth, err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package env
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+)
+
+const JSON_SCHEMA_DRAFT = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is the subset of JSON Schema (draft-07)
+// that config structs can be described with
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+}
+
+// Matches the durations time.ParseDuration accepts
+const durationPattern = `^[-+]?([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+// Matches the sizes ParseByteSize accepts
+const byteSizePattern = `^[0-9.]+\s*([kKmMgGtT][iI]?)?[bB]?$`
+
+// GenerateSchema describes the config struct T as a JSON Schema,
+// so editors can complete and CI can lint ctfjx config files.
+//
+// Properties are named as in YAML files and described by their
+// `usage` tag, the same text FromFlags prints. `validate` tags
+// become required, bounds, enums and formats. With strict, unknown
+// keys are rejected as with the Strict option.
+func GenerateSchema[T Configurable](strict bool) *JSONSchema {
+	var zero T
+	s := schemaFor(reflect.TypeOf(zero), strict)
+	s.Schema = JSON_SCHEMA_DRAFT
+	return s
+}
+
+// GenerateSchemaJSON is GenerateSchema, encoded and indented
+func GenerateSchemaJSON[T Configurable](strict bool) ([]byte, error) {
+	return json.MarshalIndent(GenerateSchema[T](strict), "", "  ")
+}
+
+func schemaFor(t reflect.Type, strict bool) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)), t == reflect.TypeOf(Duration(0)):
+		return &JSONSchema{Type: "string", Pattern: durationPattern}
+	case t == reflect.TypeOf(ByteSize(0)):
+		return &JSONSchema{Type: "string", Pattern: byteSizePattern}
+	case t == reflect.TypeOf(time.Time{}):
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case mirror.IsTextUnmarshaler(t):
+		return &JSONSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaFor(t.Elem(), strict)}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), strict)}
+	case reflect.Struct:
+		s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		if strict {
+			s.AdditionalProperties = false
+		}
+		addStructProperties(s, t, strict)
+		return s
+	}
+	return &JSONSchema{}
+}
+
+func addStructProperties(s *JSONSchema, t reflect.Type, strict bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructProperties(s, ft, strict)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		key, skip := yamlKey(field)
+		if skip {
+			continue
+		}
+
+		prop := schemaFor(field.Type, strict)
+		prop.Description = field.Tag.Get("usage")
+		if applyValidateTag(prop, field.Tag.Get("validate")) {
+			s.Required = append(s.Required, key)
+		}
+		s.Properties[key] = prop
+	}
+}
+
+// applyValidateTag narrows prop by the rules of a `validate`
+// tag, reporting whether the field is required
+func applyValidateTag(prop *JSONSchema, tag string) (required bool) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			required = true
+		case "min", "max":
+			applyBound(prop, name, arg)
+		case "oneof":
+			for _, opt := range strings.Fields(arg) {
+				prop.Enum = append(prop.Enum, enumValue(prop.Type, opt))
+			}
+		case "url":
+			prop.Format = "uri"
+		}
+	}
+	return required
+}
+
+func applyBound(prop *JSONSchema, name, arg string) {
+	if prop.Pattern != "" {
+		return // durations and sizes can't be bounded by a pattern
+	}
+	n, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return
+	}
+	i := int(n)
+
+	switch prop.Type {
+	case "string":
+		if name == "min" {
+			prop.MinLength = &i
+		} else {
+			prop.MaxLength = &i
+		}
+	case "array":
+		if name == "min" {
+			prop.MinItems = &i
+		} else {
+			prop.MaxItems = &i
+		}
+	case "integer", "number":
+		if name == "min" {
+			prop.Minimum = &n
+		} else {
+			prop.Maximum = &n
+		}
+	}
+}
+
+func enumValue(typ, s string) any {
+	switch typ {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
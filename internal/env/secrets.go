@@ -0,0 +1,81 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/lattesec/log"
+)
+
+const SECRET_FILE_SUFFIX = "File"
+
+// FromSecretFiles resolves secrets from files, so that plaintext
+// secrets never need to live in the config tree.
+//
+// A string field X is read from the file named by its sibling
+// field XFile when X is empty, e.g.
+//
+//	type Cfg struct {
+//		DBPassword     string `yaml:"db_password"`
+//		DBPasswordFile string `yaml:"db_password_file"` // /run/secrets/db
+//	}
+//
+// Trailing newlines are trimmed from the file's contents. It
+// should be registered after the file and env loaders.
+func FromSecretFiles[T Configurable]() (func(T) error, error) {
+	return func(cfg T) error {
+		v := reflect.ValueOf(cfg)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("config must be a struct pointer, got %T", cfg)
+		}
+		return trackSource(cfg, "secret files", func() error {
+			return resolveSecretFiles(loggerFor(cfg), v.Elem())
+		})
+	}, nil
+}
+
+func resolveSecretFiles(lg *log.Logger, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := resolveSecretFiles(lg, fv); err != nil {
+				return err
+			}
+			continue
+		case fv.Kind() == reflect.Ptr && !fv.IsNil() && fv.Elem().Kind() == reflect.Struct:
+			if err := resolveSecretFiles(lg, fv.Elem()); err != nil {
+				return err
+			}
+			continue
+		case fv.Kind() != reflect.String || fv.Len() > 0:
+			continue
+		}
+
+		fileField := v.FieldByName(field.Name + SECRET_FILE_SUFFIX)
+		if !fileField.IsValid() || fileField.Kind() != reflect.String || fileField.Len() == 0 {
+			continue
+		}
+
+		pth := fileField.String()
+		data, err := os.ReadFile(pth)
+		if err != nil {
+			return fmt.Errorf("failed to read secret %s from %s: %w", field.Name, pth, err)
+		}
+		fv.SetString(strings.TrimRight(string(data), "\r\n"))
+
+		lg.Debug().
+			WithMeta("scope", "env").
+			WithMeta("path", pth).
+			Msgf("loaded %s from secret file", field.Name).Send()
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+)
+
+// Subscribe registers fn to be called with the previous and the
+// new config after every successful load. On the first load the
+// previous config is the zero value.
+//
+// Subscribers are called in registration order, after the new
+// config is visible through Current.
+func (l *Loader[T]) Subscribe(fn func(old, new T)) uint64 {
+	id := atomic.AddUint64(&l.subIdGen, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscribers == nil {
+		l.subscribers = make(map[uint64]func(old, new T))
+	}
+	l.subscribers[id] = fn
+	return id
+}
+
+// SubscribeCheck registers fn to be called with the current and
+// the new config before the new config is set. If any check
+// returns an error, the new config is rejected and the current
+// one stays in place.
+func (l *Loader[T]) SubscribeCheck(fn func(old, new T) error) uint64 {
+	id := atomic.AddUint64(&l.subIdGen, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.checks == nil {
+		l.checks = make(map[uint64]func(old, new T) error)
+	}
+	l.checks[id] = fn
+	return id
+}
+
+// Unsubscribe removes a subscriber or check
+func (l *Loader[T]) Unsubscribe(id uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subscribers, id)
+	delete(l.checks, id)
+}
+
+func (l *Loader[T]) check(old, new T) error {
+	l.mu.Lock()
+	fns := make([]func(old, new T) error, 0, len(l.checks))
+	for _, id := range sortedIds(l.checks) {
+		fns = append(fns, l.checks[id])
+	}
+	l.mu.Unlock()
+
+	var errs []error
+	for _, fn := range fns {
+		err := nopanic.NoPanicRunErr(fmt.Sprintf("env-check-%p", fn), func() error {
+			return fn(old, new)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrConfigRejected}, errs...)...)
+	}
+	return nil
+}
+
+func sortedIds[V any](m map[uint64]V) []uint64 {
+	ids := make([]uint64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (l *Loader[T]) notify(old, new T) {
+	l.mu.Lock()
+	fns := make([]func(old, new T), 0, len(l.subscribers))
+	for _, id := range sortedIds(l.subscribers) {
+		fns = append(fns, l.subscribers[id])
+	}
+	l.mu.Unlock()
+
+	for _, fn := range fns {
+		nopanic.NoPanicRunVoid(fmt.Sprintf("env-subscriber-%p", fn), func() {
+			fn(old, new)
+		})
+	}
+}
+
+// Watch returns a channel receiving the current snapshot, if a
+// config has been loaded, and one for every successful load after
+// it, until ctx is done.
+//
+// It sends snapshots rather than bare configs, so that receivers
+// know the generation of what they got, and takes ctx to end the
+// subscription and close the channel.
+//
+// The channel holds only the latest snapshot, so slow receivers
+// skip straight to the newest config instead of blocking loads.
+// Every receiver gets its own copy of the config.
+func (l *Loader[T]) Watch(ctx context.Context) <-chan Snapshot[T] {
+	ch := make(chan Snapshot[T], 1)
+	var mu sync.Mutex
+	closed := false
+
+	send := func(snap Snapshot[T]) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case <-ch: // drop the stale snapshot
+		default:
+		}
+		ch <- snap.Copy()
+	}
+
+	id := l.Subscribe(func(_, _ T) {
+		// loads are serialized, so this is the config just set
+		send(l.current())
+	})
+	if snap := l.current(); snap.Generation > 0 {
+		send(snap)
+	}
+
+	go func() {
+		<-ctx.Done()
+		l.Unsubscribe(id)
+		mu.Lock()
+		closed = true
+		close(ch)
+		mu.Unlock()
+	}()
+	return ch
+}
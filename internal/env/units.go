@@ -0,0 +1,158 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml/ast"
+)
+
+var (
+	ErrInvalidDuration = errors.New("invalid duration")
+	ErrInvalidByteSize = errors.New("invalid byte size")
+)
+
+// Duration is a time.Duration written as "30s" or "1h30m" in
+// config files and env vars, instead of integer nanoseconds
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration { return time.Duration(d) }
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText parses a time.ParseDuration string. Bare numbers
+// other than 0 are rejected, as their unit is a guess.
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "0" {
+		*d = 0
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		if _, numErr := strconv.ParseFloat(s, 64); numErr == nil {
+			return fmt.Errorf("%w: %q needs a unit, e.g. %ss", ErrInvalidDuration, s, s)
+		}
+		return fmt.Errorf("%w: %q", ErrInvalidDuration, s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalYAML keeps the value's position in errors
+func (d *Duration) UnmarshalYAML(node ast.Node) error {
+	return unmarshalYAMLScalar(node, d)
+}
+
+// UnmarshalJSON also accepts a bare 0, which JSON has no string for
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	return d.UnmarshalText([]byte(strings.Trim(string(data), `"`)))
+}
+
+// ByteSize is a size in bytes written as "512", "10MB" or "1GiB"
+// in config files and env vars.
+//
+// KB, MB, GB and TB are powers of 1000, KiB, MiB, GiB and TiB
+// powers of 1024. Units are case-insensitive and the B is optional.
+type ByteSize int64
+
+const (
+	Byte ByteSize = 1
+
+	KB = 1000 * Byte
+	MB = 1000 * KB
+	GB = 1000 * MB
+	TB = 1000 * GB
+
+	KiB = 1024 * Byte
+	MiB = 1024 * KiB
+	GiB = 1024 * MiB
+	TiB = 1024 * GiB
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"": Byte, "b": Byte,
+	"k": KB, "kb": KB, "m": MB, "mb": MB, "g": GB, "gb": GB, "t": TB, "tb": TB,
+	"ki": KiB, "kib": KiB, "mi": MiB, "mib": MiB, "gi": GiB, "gib": GiB, "ti": TiB, "tib": TiB,
+}
+
+// Largest first, so String picks the shortest exact form
+var byteSizeNames = []struct {
+	size ByteSize
+	name string
+}{
+	{TiB, "TiB"}, {TB, "TB"}, {GiB, "GiB"}, {GB, "GB"},
+	{MiB, "MiB"}, {MB, "MB"}, {KiB, "KiB"}, {KB, "KB"},
+}
+
+func (b ByteSize) Int64() int64 { return int64(b) }
+
+func (b ByteSize) String() string {
+	if b != 0 {
+		for _, u := range byteSizeNames {
+			if b%u.size == 0 {
+				return fmt.Sprintf("%d%s", b/u.size, u.name)
+			}
+		}
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// UnmarshalYAML keeps the value's position in errors
+func (b *ByteSize) UnmarshalYAML(node ast.Node) error {
+	return unmarshalYAMLScalar(node, b)
+}
+
+// UnmarshalJSON also accepts bare numbers of bytes
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	return b.UnmarshalText([]byte(strings.Trim(string(data), `"`)))
+}
+
+// ParseByteSize parses sizes such as "512", "1.5GB" or "64 KiB"
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	num, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	mult, ok := byteSizeUnits[unit]
+	if !ok || num == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidByteSize, s)
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidByteSize, s)
+	}
+	size := n * float64(mult)
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %q overflows", ErrInvalidByteSize, s)
+	}
+	return ByteSize(size), nil
+}
@@ -0,0 +1,196 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownValidationRule = errors.New("unknown validation rule")
+
+// ValidationError is a single `validate` tag violation
+type ValidationError struct {
+	Field string // dotted path to the field, e.g. DB.URL
+	Rule  string // the violated rule, e.g. min=1
+	Msg   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Msg)
+}
+
+// ValidationErrors holds every violation found in a config
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid config:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// ValidateStruct checks every field of the struct v points to
+// against its `validate` tag, reporting all violations at once.
+//
+// Rules are comma-separated:
+//
+//   - required: must not be the zero value
+//   - min=N, max=N: bounds of numbers, durations, byte sizes or the length
+//     of strings, slices and maps
+//   - oneof=a b c: must be one of the space-separated values
+//   - url: must be an absolute URL
+//   - hostport: must be a host:port address
+func ValidateStruct(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot validate %T, expected a struct", v)
+	}
+
+	var errs ValidationErrors
+	validateStruct(rv, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, path string, errs *ValidationErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+		fv := v.Field(i)
+
+		if tag := field.Tag.Get("validate"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				if msg := checkRule(fv, strings.TrimSpace(rule)); msg != "" {
+					*errs = append(*errs, &ValidationError{Field: fieldPath, Rule: rule, Msg: msg})
+				}
+			}
+		}
+
+		validateNested(fv, fieldPath, errs)
+	}
+}
+
+func validateNested(v reflect.Value, path string, errs *ValidationErrors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			validateNested(v.Elem(), path, errs)
+		}
+	case reflect.Struct:
+		validateStruct(v, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateNested(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// checkRule returns why v violates rule, or "" if it does not
+func checkRule(v reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(rule, "=")
+
+	switch name {
+	case "":
+		return ""
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		return checkBound(v, name, arg)
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, opt := range strings.Fields(arg) {
+			if s == opt {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s], got %q", arg, s)
+	case "url":
+		if v.Kind() == reflect.String && v.Len() > 0 {
+			u, err := url.Parse(v.String())
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Sprintf("must be an absolute url, got %q", v.String())
+			}
+		}
+	case "hostport":
+		if v.Kind() == reflect.String && v.Len() > 0 {
+			if _, _, err := net.SplitHostPort(v.String()); err != nil {
+				return fmt.Sprintf("must be a host:port address, got %q", v.String())
+			}
+		}
+	default:
+		return fmt.Sprintf("%v: %q", ErrUnknownValidationRule, rule)
+	}
+	return ""
+}
+
+func checkBound(v reflect.Value, name, arg string) string {
+	var (
+		got   float64
+		bound float64
+		err   error
+		what  = "be"
+	)
+
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		got, what = float64(v.Len()), "have a length of"
+		bound, err = strconv.ParseFloat(arg, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		got = float64(v.Int())
+		switch v.Type() {
+		case reflect.TypeOf(time.Duration(0)), reflect.TypeOf(Duration(0)):
+			var d time.Duration
+			d, err = time.ParseDuration(arg)
+			bound = float64(d)
+		case reflect.TypeOf(ByteSize(0)):
+			var b ByteSize
+			b, err = ParseByteSize(arg)
+			bound = float64(b)
+		default:
+			bound, err = strconv.ParseFloat(arg, 64)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		got = float64(v.Uint())
+		bound, err = strconv.ParseFloat(arg, 64)
+	case reflect.Float32, reflect.Float64:
+		got = v.Float()
+		bound, err = strconv.ParseFloat(arg, 64)
+	default:
+		return fmt.Sprintf("%s is not supported for %s", name, v.Type())
+	}
+
+	if err != nil {
+		return fmt.Sprintf("invalid %s bound %q: %v", name, arg, err)
+	}
+	if name == "min" && got < bound {
+		return fmt.Sprintf("must %s at least %s", what, arg)
+	}
+	if name == "max" && got > bound {
+		return fmt.Sprintf("must %s at most %s", what, arg)
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+	"github.com/lattesec/log"
+)
+
+const (
+	VAULT_ADDR_ENV  = "VAULT_ADDR"
+	VAULT_TOKEN_ENV = "VAULT_TOKEN"
+
+	DEFAULT_VAULT_MOUNT   = "secret"
+	DEFAULT_VAULT_TIMEOUT = 10 * time.Second
+)
+
+var ErrVaultMissingConfig = errors.New("vault address, token and path are required")
+
+// VaultConfig locates a secret in a Vault KV version 2 engine
+type VaultConfig struct {
+	Address string // defaults to $VAULT_ADDR
+	Token   string // defaults to $VAULT_TOKEN
+	Mount   string // the KV engine's mount, defaults to "secret"
+	Path    string // the secret's path within the mount
+
+	Client *http.Client // defaults to a client with a 10s timeout
+}
+
+// FromVault reads a secret from HashiCorp Vault and sets every
+// field tagged `vault:"key"` to the secret's value for key.
+// Keys missing from the secret leave their fields untouched.
+func FromVault[T Configurable](vc VaultConfig) (func(T) error, error) {
+	if vc.Address == "" {
+		vc.Address = os.Getenv(VAULT_ADDR_ENV)
+	}
+	if vc.Token == "" {
+		vc.Token = os.Getenv(VAULT_TOKEN_ENV)
+	}
+	if vc.Mount == "" {
+		vc.Mount = DEFAULT_VAULT_MOUNT
+	}
+	if vc.Client == nil {
+		vc.Client = &http.Client{Timeout: DEFAULT_VAULT_TIMEOUT}
+	}
+	if vc.Address == "" || vc.Token == "" || vc.Path == "" {
+		return nil, ErrVaultMissingConfig
+	}
+
+	return func(cfg T) error {
+		secret, err := readVaultSecret(context.Background(), loggerFor(cfg), vc)
+		if err != nil {
+			return err
+		}
+
+		v := reflect.ValueOf(cfg)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("config must be a struct pointer, got %T", cfg)
+		}
+		return trackSource(cfg, "vault "+vc.Mount+"/"+vc.Path, func() error {
+			return applyVaultSecret(v.Elem(), secret)
+		})
+	}, nil
+}
+
+func readVaultSecret(ctx context.Context, lg *log.Logger, vc VaultConfig) (map[string]any, error) {
+	u, err := url.JoinPath(vc.Address, "v1", vc.Mount, "data", vc.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", vc.Token)
+
+	resp, err := vc.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s: %w", vc.Path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return nil, fmt.Errorf("failed to read vault secret %s: %s: %s", vc.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode vault secret %s: %w", vc.Path, err)
+	}
+
+	lg.Debug().
+		WithMeta("scope", "env").
+		WithMeta("vault_path", vc.Path).
+		Msg("loaded secret from vault").Send()
+	return payload.Data.Data, nil
+}
+
+func applyVaultSecret(v reflect.Value, secret map[string]any) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+
+		if fv.Kind() == reflect.Struct {
+			if err := applyVaultSecret(fv, secret); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := field.Tag.Get("vault")
+		val, ok := secret[key]
+		if key == "" || !ok {
+			continue
+		}
+
+		if err := mirror.SetString(fv, fmt.Sprint(val)); err != nil {
+			return fmt.Errorf("failed to set %s from vault key %q: %w", field.Name, key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+)
+
+const DEFAULT_RELOAD_DEBOUNCE = 500 * time.Millisecond
+
+// WatchPaths adds config file paths for WatchFiles to watch
+func (l *Loader[T]) WatchPaths(paths ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pth := range paths {
+		l.watchPaths = append(l.watchPaths, filepath.Clean(pth))
+	}
+}
+
+// WatchFiles reloads the config whenever one of the watched
+// paths is created, written, renamed or removed, until ctx is done.
+//
+// Events are debounced, so editors writing a file in several
+// steps trigger a single reload. Unlike AutoReload this also works
+// on Windows and under container orchestrators.
+func (l *Loader[T]) WatchFiles(ctx context.Context) error {
+	l.mu.Lock()
+	paths := append([]string(nil), l.watchPaths...)
+	l.mu.Unlock()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// directories are watched instead of the files themselves, as
+	// files that are replaced by a rename or do not exist yet
+	// would otherwise be missed
+	watched := make(map[string]bool, len(paths))
+	dirs := make(map[string]bool)
+	for _, pth := range paths {
+		watched[pth] = true
+		dir := filepath.Dir(pth)
+		if dirs[dir] {
+			continue
+		}
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+		dirs[dir] = true
+	}
+
+	go nopanic.NoPanicRunVoid("env-watch-files", func() {
+		defer watcher.Close()
+		l.watchLoop(ctx, watcher, watched)
+	})
+	return nil
+}
+
+func (l *Loader[T]) watchLoop(ctx context.Context, watcher *fsnotify.Watcher, watched map[string]bool) {
+	debounce := time.NewTimer(DEFAULT_RELOAD_DEBOUNCE)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !watched[filepath.Clean(ev.Name)] || ev.Op == fsnotify.Chmod {
+				continue
+			}
+			debounce.Reset(DEFAULT_RELOAD_DEBOUNCE)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			l.logger().Warn().
+				WithMeta("scope", "env").
+				Msgf("config watcher error: %v", err).Send()
+
+		case <-debounce.C:
+			l.reload("config file changed")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package flags
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Type string
+
+const (
+	Static  Type = "static"  // the submission must equal the value
+	Regex   Type = "regex"   // the submission must fully match the value
+	Dynamic Type = "dynamic" // the value is a template, see Generator
+)
+
+var (
+	ErrInvalidFlag = errors.New("invalid flag")
+	ErrNoGenerator = errors.New("no generator for dynamic flags")
+)
+
+// Spec is the flag of a challenge
+type Spec struct {
+	Type            Type
+	Value           string
+	CaseInsensitive bool
+}
+
+// Validate checks s could be compiled
+func (s Spec) Validate() error {
+	_, err := s.compile()
+	return err
+}
+
+func (s Spec) compile() (*regexp.Regexp, error) {
+	if s.Value == "" {
+		return nil, fmt.Errorf("%w: empty value", ErrInvalidFlag)
+	}
+	switch s.Type {
+	case Static:
+	case Regex:
+		expr := "^(?:" + s.Value + ")$"
+		if s.CaseInsensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad regex: %w", ErrInvalidFlag, err)
+		}
+		return re, nil
+	case Dynamic:
+		if err := ValidateTemplate(s.Value); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidFlag, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidFlag, s.Type)
+	}
+	return nil, nil
+}
+
+// Checker tells if submissions to a challenge are correct
+type Checker struct {
+	challenge string
+	spec      Spec
+	re        *regexp.Regexp
+	generator *Generator
+}
+
+// Compile returns the checker of the flag s of challengeId,
+// g derives dynamic flags and may be nil for other types
+func Compile(challengeId string, s Spec, g *Generator) (*Checker, error) {
+	re, err := s.compile()
+	if err != nil {
+		return nil, err
+	}
+	return &Checker{challenge: challengeId, spec: s, re: re, generator: g}, nil
+}
+
+// Expected returns the flag subject must submit, regex flags
+// have none
+func (c *Checker) Expected(subject string) (string, error) {
+	switch c.spec.Type {
+	case Regex:
+		return "", fmt.Errorf("%w: regex flags have no single value", ErrInvalidFlag)
+	case Dynamic:
+		if c.generator == nil {
+			return "", fmt.Errorf("%w: %s", ErrNoGenerator, c.challenge)
+		}
+		return c.generator.Derive(c.spec.Value, c.challenge, subject), nil
+	}
+	return c.spec.Value, nil
+}
+
+// Check tells if submitted is correct for subject, the team or
+// instance dynamic flags are derived for
+func (c *Checker) Check(submitted, subject string) (bool, error) {
+	submitted = Normalize(submitted)
+	if c.re != nil {
+		return c.re.MatchString(submitted), nil
+	}
+	flag, err := c.Expected(subject)
+	if err != nil {
+		return false, err
+	}
+	return Equal(submitted, flag, c.spec.CaseInsensitive), nil
+}
+
+// Normalize strips what players paste around flags
+func Normalize(submitted string) string {
+	return strings.TrimSpace(submitted)
+}
+
+// Equal compares a submission to a flag in constant time
+func Equal(submitted, flag string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		submitted, flag = strings.ToLower(submitted), strings.ToLower(flag)
+	}
+	return subtle.ConstantTimeCompare([]byte(submitted), []byte(flag)) == 1
+}
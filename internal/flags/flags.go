@@ -0,0 +1,64 @@
+// Flags package checks submitted flags, for the challenge loader and
+// the submission service alike. Flags are static strings, regexes a
+// submission must fully match, or dynamic: a template such as
+//
+//	ctfjx{heap_{{hmac}}}
+//
+// whose placeholder is replaced by an HMAC of the challenge and the
+// team under a secret only the daemon knows, so dynamic flags are
+// never stored and a leaked flag tells which team leaked it.
+package flags
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	PLACEHOLDER = "{{hmac}}"
+	// Variable dynamic flags are injected as by default
+	DEFAULT_ENV = "FLAG"
+	// Hex characters of the HMAC in a flag
+	HMAC_LEN = 24
+
+	// Secrets shorter than this are refused
+	MIN_SECRET_LEN = 16
+)
+
+var (
+	ErrInvalidTemplate = errors.New("invalid flag template")
+	ErrWeakSecret      = errors.New("flag secret is too short")
+)
+
+// ValidateTemplate checks tmpl has a placeholder to derive flags with
+func ValidateTemplate(tmpl string) error {
+	if !strings.Contains(tmpl, PLACEHOLDER) {
+		return fmt.Errorf("%w: %q has no %s", ErrInvalidTemplate, tmpl, PLACEHOLDER)
+	}
+	return nil
+}
+
+// Generator derives flags from a secret
+type Generator struct {
+	secret []byte
+}
+
+func NewGenerator(secret string) (*Generator, error) {
+	if len(secret) < MIN_SECRET_LEN {
+		return nil, fmt.Errorf("%w: need at least %d bytes", ErrWeakSecret, MIN_SECRET_LEN)
+	}
+	return &Generator{secret: []byte(secret)}, nil
+}
+
+// Derive returns the flag of subject, a team or an instance,
+// for challengeId
+func (g *Generator) Derive(tmpl, challengeId, subject string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	fmt.Fprintf(mac, "%s\x00%s", challengeId, subject)
+	sum := hex.EncodeToString(mac.Sum(nil))[:HMAC_LEN]
+	return strings.ReplaceAll(tmpl, PLACEHOLDER, sum)
+}
@@ -0,0 +1,85 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator(t *testing.T) {
+	_, err := NewGenerator("short")
+	assert.ErrorIs(t, err, ErrWeakSecret)
+
+	g, err := NewGenerator("0123456789abcdef")
+	require.NoError(t, err)
+	flag := g.Derive("ctfjx{heap_{{hmac}}}", "heap", "team42")
+	assert.Regexp(t, `^ctfjx\{heap_[0-9a-f]{24}\}$`, flag)
+	assert.Equal(t, flag, g.Derive("ctfjx{heap_{{hmac}}}", "heap", "team42"))
+	assert.NotEqual(t, flag, g.Derive("ctfjx{heap_{{hmac}}}", "heap", "team7"))
+	assert.NotEqual(t, flag, g.Derive("ctfjx{heap_{{hmac}}}", "race", "team42"))
+
+	other, err := NewGenerator("fedcba9876543210")
+	require.NoError(t, err)
+	assert.NotEqual(t, flag, other.Derive("ctfjx{heap_{{hmac}}}", "heap", "team42"))
+
+	assert.NoError(t, ValidateTemplate("ctfjx{{{hmac}}}"))
+	assert.ErrorIs(t, ValidateTemplate("ctfjx{static}"), ErrInvalidTemplate)
+
+	assert.True(t, Equal("CTFJX{A}", "ctfjx{a}", true))
+	assert.False(t, Equal("CTFJX{A}", "ctfjx{a}", false))
+	assert.False(t, Equal("ctfjx{a", "ctfjx{a}", false))
+}
+
+func TestChecker(t *testing.T) {
+	check := func(s Spec, submitted string) bool {
+		c, err := Compile("notes", s, nil)
+		require.NoError(t, err)
+		ok, err := c.Check(submitted, "team42")
+		require.NoError(t, err)
+		return ok
+	}
+	assert.True(t, check(Spec{Type: Static, Value: "ctfjx{a}"}, " ctfjx{a}\n"))
+	assert.False(t, check(Spec{Type: Static, Value: "ctfjx{a}"}, "CTFJX{A}"))
+	assert.True(t, check(Spec{Type: Static, Value: "ctfjx{a}", CaseInsensitive: true}, "CTFJX{A}"))
+	assert.True(t, check(Spec{Type: Regex, Value: `ctfjx\{[0-9]+\}`}, "ctfjx{42}"))
+	assert.False(t, check(Spec{Type: Regex, Value: `ctfjx\{[0-9]+\}`}, "xctfjx{42}x"), "regexes match fully")
+	assert.False(t, check(Spec{Type: Regex, Value: `a|b`}, "ab"))
+	assert.True(t, check(Spec{Type: Regex, Value: `ctfjx\{a+\}`, CaseInsensitive: true}, "CTFJX{AA}"))
+
+	for _, s := range []Spec{{Type: Static}, {Type: Regex, Value: "("}, {Type: Dynamic, Value: "ctfjx{x}"}, {Type: "md5", Value: "x"}} {
+		assert.ErrorIs(t, s.Validate(), ErrInvalidFlag, s)
+	}
+
+	dynamic := Spec{Type: Dynamic, Value: "ctfjx{heap_{{hmac}}}"}
+	c, err := Compile("heap", dynamic, nil)
+	require.NoError(t, err)
+	_, err = c.Check("ctfjx{x}", "team42")
+	assert.ErrorIs(t, err, ErrNoGenerator)
+
+	g, err := NewGenerator("0123456789abcdef")
+	require.NoError(t, err)
+	c, err = Compile("heap", dynamic, g)
+	require.NoError(t, err)
+	flag, err := c.Expected("team42")
+	require.NoError(t, err)
+	assert.Equal(t, g.Derive(dynamic.Value, "heap", "team42"), flag)
+	ok, err := c.Check(flag, "team42")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Check(flag, "team7")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestFormat(t *testing.T) {
+	f := Format{}
+	assert.Equal(t, "ctfjx{heap}", f.Wrap("heap"))
+	body, ok := f.Unwrap("ctfjx{use_after_free}")
+	assert.True(t, ok)
+	assert.Equal(t, "use_after_free", body)
+	for _, flag := range []string{"ctfjx{}", "ctf{x}", "ctfjx{a\nb}", "xctfjx{a}"} {
+		assert.False(t, f.Valid(flag), flag)
+	}
+	assert.True(t, Format{Prefix: "flag"}.Valid("flag{a b}"))
+}
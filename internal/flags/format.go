@@ -0,0 +1,44 @@
+package flags
+
+import (
+	"regexp"
+	"strings"
+)
+
+const DEFAULT_PREFIX = "ctfjx"
+
+// Format is the canonical shape of flags, <Prefix>{<body>}
+type Format struct {
+	Prefix string // DEFAULT_PREFIX if empty
+}
+
+func (f Format) prefix() string {
+	if f.Prefix == "" {
+		return DEFAULT_PREFIX
+	}
+	return f.Prefix
+}
+
+// Wrap returns body as a flag, e.g. ctfjx{body}
+func (f Format) Wrap(body string) string {
+	return f.prefix() + "{" + body + "}"
+}
+
+// Unwrap returns the body of flag, if it has the format
+func (f Format) Unwrap(flag string) (string, bool) {
+	if !f.Valid(flag) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(flag, f.prefix()+"{"), "}"), true
+}
+
+// Regexp matches the flags with the format, bodies are printable
+// ASCII on a single line
+func (f Format) Regexp() *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(f.prefix()) + `\{[[:print:]]+\}$`)
+}
+
+// Valid tells if flag has the format
+func (f Format) Valid(flag string) bool {
+	return f.Regexp().MatchString(flag)
+}
@@ -0,0 +1,164 @@
+// Health package runs the healthchecks of challenges.
+//
+// Checks travel with their containers as a label, so the agent's
+// Monitor finds them again after a restart. It probes, restarts
+// instances that keep failing, and reports the state of every
+// check to the daemon, where a Tracker keeps the uptime of each
+// challenge and alerts organizers about instances that restarting
+// did not fix.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+)
+
+// Container label holding the JSON Check of a container
+const LABEL_HEALTHCHECK = "ctfjx.healthcheck"
+
+var (
+	ErrInvalidCheck = errors.New("invalid healthcheck")
+	ErrUnhealthy    = errors.New("healthcheck failed")
+)
+
+// Check is a healthcheck of a container
+type Check struct {
+	Type     challenge.HealthcheckType `json:"type"`
+	Port     int                       `json:"port,omitempty"` // container port
+	Path     string                    `json:"path,omitempty"`
+	Command  []string                  `json:"command,omitempty"`
+	Dir      string                    `json:"dir,omitempty"` // of Command on the agent
+	Interval time.Duration             `json:"interval"`
+	Timeout  time.Duration             `json:"timeout"`
+	Retries  int                       `json:"retries"`
+	Escalate int                       `json:"escalate"`
+}
+
+// FromChallenge returns the check of a challenge's healthcheck
+func FromChallenge(h challenge.Healthcheck) Check {
+	return Check{
+		Type:     h.Type,
+		Port:     h.Port,
+		Path:     h.Path,
+		Command:  h.Command,
+		Interval: time.Duration(h.Interval),
+		Timeout:  time.Duration(h.Timeout),
+		Retries:  max(h.Retries, 1),
+		Escalate: max(h.Escalate, 1),
+	}
+}
+
+// Label formats c as the value of LABEL_HEALTHCHECK
+func (c Check) Label() string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+// ParseLabel reads a check from the value of LABEL_HEALTHCHECK
+func ParseLabel(s string) (Check, error) {
+	var c Check
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		return Check{}, fmt.Errorf("%w: %v", ErrInvalidCheck, err)
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Duration(challenge.DEFAULT_HEALTHCHECK_INTERVAL)
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = time.Duration(challenge.DEFAULT_HEALTHCHECK_TIMEOUT)
+	}
+	c.Retries = max(c.Retries, 1)
+	c.Escalate = max(c.Escalate, 1)
+	return c, nil
+}
+
+// address returns where the agent reaches container port of info,
+// the first published port if port is 0
+func address(info container.Info, port int) (string, error) {
+	for _, p := range info.Ports {
+		if (port == 0 || p.Container == port) && p.Protocol != "udp" {
+			host := p.HostIP
+			if host == "" || host == "0.0.0.0" || host == "::" {
+				host = "127.0.0.1"
+			}
+			return net.JoinHostPort(host, strconv.Itoa(p.Host)), nil
+		}
+	}
+	if port == 0 {
+		return "", fmt.Errorf("%w: no published port", ErrInvalidCheck)
+	}
+	return "", fmt.Errorf("%w: port %d is not published", ErrInvalidCheck, port)
+}
+
+// Probe runs c once against the container info
+func Probe(ctx context.Context, c Check, info container.Info) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	if !info.Running {
+		return fmt.Errorf("%w: container is %s", ErrUnhealthy, info.State)
+	}
+
+	switch c.Type {
+	case challenge.HealthcheckTCP:
+		addr, err := address(info, c.Port)
+		if err != nil {
+			return err
+		}
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUnhealthy, err)
+		}
+		return conn.Close()
+
+	case challenge.HealthcheckHTTP:
+		addr, err := address(info, c.Port)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+c.Path, nil)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCheck, err)
+		}
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUnhealthy, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("%w: status %d", ErrUnhealthy, resp.StatusCode)
+		}
+		return nil
+
+	case challenge.HealthcheckExec:
+		if len(c.Command) == 0 {
+			return fmt.Errorf("%w: no command", ErrInvalidCheck)
+		}
+		// Solve probes find the instance in their environment
+		cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+		cmd.Dir = c.Dir
+		cmd.Env = append(os.Environ(), "CTFJX_CONTAINER="+info.Name)
+		if addr, err := address(info, c.Port); err == nil {
+			host, port, _ := net.SplitHostPort(addr)
+			cmd.Env = append(cmd.Env, "CTFJX_HOST="+host, "CTFJX_PORT="+port)
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if len(out) > 200 {
+				out = out[len(out)-200:]
+			}
+			return fmt.Errorf("%w: %v: %s", ErrUnhealthy, err, out)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown type %q", ErrInvalidCheck, c.Type)
+}
@@ -0,0 +1,207 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/build"
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func published(t *testing.T, addr string) container.Info {
+	_, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	p, _ := strconv.Atoi(port)
+	return container.Info{Name: "web1-team42", Running: true, Ports: []container.Port{{Container: 80, Host: p, Protocol: "tcp"}}}
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+	code := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+	info := published(t, srv.Listener.Addr().String())
+
+	check := Check{Type: challenge.HealthcheckHTTP, Port: 80, Path: "/", Timeout: time.Second}
+	assert.NoError(t, Probe(ctx, check, info))
+	code = http.StatusInternalServerError
+	assert.ErrorIs(t, Probe(ctx, check, info), ErrUnhealthy)
+
+	check.Type = challenge.HealthcheckTCP
+	assert.NoError(t, Probe(ctx, check, info))
+	check.Port = 1337
+	assert.ErrorIs(t, Probe(ctx, check, info), ErrInvalidCheck)
+
+	stopped := info
+	stopped.Running, stopped.State = false, "exited"
+	assert.ErrorIs(t, Probe(ctx, Check{Type: challenge.HealthcheckTCP, Timeout: time.Second}, stopped), ErrUnhealthy)
+
+	if _, err := exec.LookPath("sh"); err == nil {
+		check = Check{Type: challenge.HealthcheckExec, Command: []string{"sh", "-c", `test "$CTFJX_HOST" = 127.0.0.1`}, Timeout: time.Second}
+		assert.NoError(t, Probe(ctx, check, info))
+		check.Command = []string{"sh", "-c", "echo no flag; exit 1"}
+		err := Probe(ctx, check, info)
+		assert.ErrorIs(t, err, ErrUnhealthy)
+		assert.Contains(t, err.Error(), "no flag")
+	}
+}
+
+func TestLabel(t *testing.T) {
+	c := FromChallenge(challenge.Healthcheck{Type: challenge.HealthcheckTCP, Port: 80, Interval: challenge.DEFAULT_HEALTHCHECK_INTERVAL})
+	parsed, err := ParseLabel(c.Label())
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, parsed.Interval)
+	assert.Equal(t, 5*time.Second, parsed.Timeout)
+	assert.Equal(t, 1, parsed.Retries)
+
+	_, err = ParseLabel("{")
+	assert.ErrorIs(t, err, ErrInvalidCheck)
+}
+
+type fakeRuntime struct {
+	container.Runtime
+	infos    []container.Info
+	restarts int
+}
+
+func (f *fakeRuntime) List(context.Context) ([]container.Info, error) { return f.infos, nil }
+func (f *fakeRuntime) Stop(context.Context, string, time.Duration) error {
+	return nil
+}
+func (f *fakeRuntime) Start(context.Context, string) error {
+	f.restarts++
+	return nil
+}
+
+func TestMonitor(t *testing.T) {
+	check := Check{Type: challenge.HealthcheckTCP, Interval: time.Minute, Timeout: time.Second, Retries: 2, Escalate: 2}
+	rt := &fakeRuntime{infos: []container.Info{
+		{Id: "c1", Name: "web1-team42", Running: true, Labels: map[string]string{LABEL_HEALTHCHECK: check.Label(), build.LABEL_CHALLENGE: "web1"}},
+		{Id: "c2", Name: "unchecked", Running: true},
+	}}
+	m := NewMonitor(rt)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	var fail error = errors.New("connection refused")
+	probes := 0
+	m.probe = func(context.Context, Check, container.Info) error {
+		probes++
+		return fail
+	}
+	step := func() {
+		now = now.Add(time.Minute)
+		m.CheckDue(context.Background())
+	}
+
+	m.CheckDue(context.Background())
+	assert.Zero(t, probes, "the first check waits an interval")
+	assert.Equal(t, StatusStarting, m.Checks()["web1-team42"].Status)
+	assert.Len(t, m.Checks(), 1)
+
+	step()
+	assert.Equal(t, 1, m.Checks()["web1-team42"].Failures)
+	assert.Zero(t, rt.restarts)
+	step()
+	c := m.Checks()["web1-team42"]
+	assert.Equal(t, StatusUnhealthy, c.Status)
+	assert.Equal(t, 1, rt.restarts)
+	assert.False(t, c.Escalated)
+	step()
+	step()
+	c = m.Checks()["web1-team42"]
+	assert.Equal(t, 2, rt.restarts)
+	assert.True(t, c.Escalated)
+	assert.Equal(t, "web1", c.Challenge)
+	assert.Equal(t, "connection refused", c.Error)
+
+	fail = nil
+	step()
+	c = m.Checks()["web1-team42"]
+	assert.Equal(t, StatusHealthy, c.Status)
+	assert.False(t, c.Escalated)
+	assert.Equal(t, int64(5), c.Checks)
+	assert.Equal(t, int64(1), c.Passed)
+
+	r := status.NewReporter("a")
+	r.Health = func() map[string]string { return map[string]string{"other": "healthy"} }
+	m.Attach(r)
+	rep := r.Collect()
+	assert.Equal(t, map[string]string{"other": "healthy", "web1-team42": StatusHealthy}, rep.Health)
+	assert.Contains(t, rep.Checks, "web1-team42")
+
+	rt.infos = nil
+	step()
+	assert.Empty(t, m.Checks())
+}
+
+func TestTracker(t *testing.T) {
+	reg, err := registry.New("")
+	require.NoError(t, err)
+	require.NoError(t, reg.Register(registry.Agent{Id: "a"}))
+	report := func(checks map[string]status.Check) {
+		require.NoError(t, reg.RecordStatus("a", status.Report{AgentId: "a", Time: time.Now().UTC(), Checks: checks}))
+	}
+
+	tr, err := NewTracker(reg, "")
+	require.NoError(t, err)
+	var alerts []Alert
+	tr.Notify = append(tr.Notify, func(_ context.Context, a Alert) error {
+		alerts = append(alerts, a)
+		return nil
+	})
+	ctx := context.Background()
+
+	report(map[string]status.Check{
+		"web1-team1": {Challenge: "web1", Status: StatusHealthy},
+		"web1-team2": {Challenge: "web1", Status: StatusUnhealthy, Restarts: 3, Escalated: true, Error: "refused"},
+	})
+	require.NoError(t, tr.Sample(ctx))
+	require.NoError(t, tr.Sample(ctx))
+	require.Len(t, alerts, 1, "escalations are alerted once")
+	assert.Equal(t, Alert{Agent: "a", Instance: "web1-team2", Challenge: "web1", Restarts: 3, Error: "refused", Time: alerts[0].Time}, alerts[0])
+
+	u, ok := tr.Uptime("web1")
+	require.True(t, ok)
+	assert.Equal(t, int64(4), u.Total)
+	assert.Equal(t, 50.0, u.Percent())
+	assert.False(t, u.LastFailure.IsZero())
+
+	report(map[string]status.Check{
+		"web1-team1": {Challenge: "web1", Status: StatusHealthy},
+		"web1-team2": {Challenge: "web1", Status: StatusHealthy},
+	})
+	require.NoError(t, tr.Sample(ctx))
+	u, _ = tr.Uptime("web1")
+	assert.InDelta(t, 66.6, u.Percent(), 0.1)
+	assert.Equal(t, 2, u.Healthy)
+
+	// escalated again after recovering
+	report(map[string]status.Check{"web1-team2": {Challenge: "web1", Status: StatusUnhealthy, Escalated: true}})
+	require.NoError(t, tr.Sample(ctx))
+	assert.Len(t, alerts, 2)
+	assert.Len(t, tr.Uptimes(), 1)
+}
+
+func TestWebhook(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+	require.NoError(t, Webhook(srv.URL)(context.Background(), Alert{Instance: "web1-team2"}))
+	assert.Equal(t, "application/json", got)
+}
@@ -0,0 +1,184 @@
+package health
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/build"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/lattesec/log"
+)
+
+const (
+	StatusStarting  = "starting"
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+
+	// How often the monitor looks for checks that are due
+	DEFAULT_TICK = time.Second
+)
+
+// Monitor runs the checks of the containers on an agent
+type Monitor struct {
+	rt container.Runtime
+
+	mu     sync.Mutex
+	checks map[string]*state // container name -> state
+
+	// Swapped out in tests
+	now   func() time.Time
+	probe func(ctx context.Context, c Check, info container.Info) error
+}
+
+type state struct {
+	status.Check
+	next time.Time
+}
+
+// NewMonitor creates a monitor of the containers of rt
+func NewMonitor(rt container.Runtime) *Monitor {
+	return &Monitor{rt: rt, checks: make(map[string]*state), now: time.Now, probe: Probe}
+}
+
+// Run checks the containers every tick until ctx is done
+func (m *Monitor) Run(ctx context.Context, tick time.Duration) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	for {
+		m.CheckDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// CheckDue probes the containers whose check is due, restarting
+// the ones that failed Retries times in a row
+func (m *Monitor) CheckDue(ctx context.Context) {
+	infos, err := m.rt.List(ctx)
+	if err != nil {
+		log.Warn().WithMeta("scope", "health").Msgf("failed to list containers: %v", err).Send()
+		return
+	}
+
+	now := m.now()
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		label, ok := info.Labels[LABEL_HEALTHCHECK]
+		if !ok {
+			continue
+		}
+		check, err := ParseLabel(label)
+		if err != nil {
+			log.Warn().WithMeta("scope", "health").WithMeta("instance", info.Name).Msgf("%v", err).Send()
+			continue
+		}
+		seen[info.Name] = true
+
+		m.mu.Lock()
+		st, ok := m.checks[info.Name]
+		if !ok {
+			// the first check waits an interval, for the instance to start
+			st = &state{Check: status.Check{Challenge: info.Labels[build.LABEL_CHALLENGE], Status: StatusStarting, Since: now}, next: now.Add(check.Interval)}
+			m.checks[info.Name] = st
+		}
+		due := !now.Before(st.next)
+		m.mu.Unlock()
+		if due {
+			m.run(ctx, check, info, st)
+		}
+	}
+
+	m.mu.Lock()
+	for name := range m.checks {
+		if !seen[name] {
+			delete(m.checks, name)
+		}
+	}
+	m.mu.Unlock()
+}
+
+func (m *Monitor) run(ctx context.Context, check Check, info container.Info, st *state) {
+	err := m.probe(ctx, check, info)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	st.next = now.Add(check.Interval)
+	st.Checks++
+	setStatus := func(s string) {
+		if st.Status != s {
+			st.Status, st.Since = s, now
+		}
+	}
+
+	if err == nil {
+		st.Passed++
+		st.Failures, st.Restarts, st.Escalated, st.Error = 0, 0, false, ""
+		setStatus(StatusHealthy)
+		return
+	}
+	st.Failures++
+	st.Error = err.Error()
+	if st.Failures < check.Retries {
+		return
+	}
+
+	setStatus(StatusUnhealthy)
+	st.Failures = 0
+	st.Restarts++
+	log.Warn().
+		WithMeta("scope", "health").
+		WithMeta("instance", info.Name).
+		Msgf("restarting after %d failed checks: %v", check.Retries, err).Send()
+	if err := m.restart(ctx, info.Id); err != nil {
+		log.Error().WithMeta("scope", "health").WithMeta("instance", info.Name).Msgf("failed to restart: %v", err).Send()
+	}
+	if st.Restarts >= check.Escalate && !st.Escalated {
+		st.Escalated = true
+		log.Error().
+			WithMeta("scope", "health").
+			WithMeta("instance", info.Name).
+			Msgf("still unhealthy after %d restarts, escalating", st.Restarts).Send()
+	}
+}
+
+func (m *Monitor) restart(ctx context.Context, id string) error {
+	if err := m.rt.Stop(ctx, id, container.DEFAULT_STOP_TIMEOUT); err != nil {
+		return err
+	}
+	return m.rt.Start(ctx, id)
+}
+
+// Checks returns the state of every check, by container name
+func (m *Monitor) Checks() map[string]status.Check {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]status.Check, len(m.checks))
+	for name, st := range m.checks {
+		out[name] = st.Check
+	}
+	return out
+}
+
+// Attach reports the checks in r's status reports, on top of
+// the health it already reports
+func (m *Monitor) Attach(r *status.Reporter) {
+	r.Checks = m.Checks
+	prev := r.Health
+	r.Health = func() map[string]string {
+		health := make(map[string]string)
+		if prev != nil {
+			maps.Copy(health, prev())
+		}
+		for name, c := range m.Checks() {
+			health[name] = c.Status
+		}
+		return health
+	}
+}
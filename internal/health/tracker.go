@@ -0,0 +1,196 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/store"
+	"github.com/lattesec/log"
+)
+
+// Alert tells organizers an instance is down for good
+type Alert struct {
+	Agent     string    `json:"agent"`
+	Instance  string    `json:"instance"`
+	Challenge string    `json:"challenge,omitempty"`
+	Restarts  int       `json:"restarts"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Notifier delivers alerts, e.g. Webhook
+type Notifier func(ctx context.Context, a Alert) error
+
+// Webhook posts alerts as JSON to url
+func Webhook(url string) Notifier {
+	return func(ctx context.Context, a Alert) error {
+		body, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook answered %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// Uptime of a challenge, sampled across its instances
+type Uptime struct {
+	Challenge   string    `json:"challenge"`
+	Up          int64     `json:"up"`    // samples of healthy instances
+	Total       int64     `json:"total"` // samples of every instance
+	Healthy     int       `json:"healthy"`
+	Instances   int       `json:"instances"` // in the latest sample
+	LastFailure time.Time `json:"last_failure"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Percent returns the share of healthy samples, 100 if there are none
+func (u Uptime) Percent() float64 {
+	if u.Total == 0 {
+		return 100
+	}
+	return 100 * float64(u.Up) / float64(u.Total)
+}
+
+// Tracker follows the checks agents report, keeping the uptime of
+// challenges and alerting about escalated instances
+type Tracker struct {
+	agents *registry.Registry
+	uptime *store.Collection[Uptime]
+	Notify []Notifier
+
+	mu      sync.Mutex
+	alerted map[string]bool // agent/instance -> escalation already alerted
+
+	// Swapped out in tests
+	now func() time.Time
+}
+
+// NewTracker creates a tracker with the uptimes persisted at path,
+// memory-only if empty
+func NewTracker(reg *registry.Registry, path string) (*Tracker, error) {
+	uptime, err := store.Open[Uptime](path)
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{agents: reg, uptime: uptime, alerted: make(map[string]bool), now: time.Now}, nil
+}
+
+// Sample counts the latest reports of the healthy agents towards
+// the uptimes and alerts about newly escalated instances
+func (t *Tracker) Sample(ctx context.Context) error {
+	healthy := registry.HealthHealthy
+	now := t.now().UTC()
+
+	samples := make(map[string]*Uptime)
+	escalated := make(map[string]bool)
+	var alerts []Alert
+	t.mu.Lock()
+	for _, a := range t.agents.Find(registry.Query{Health: &healthy}) {
+		if a.Report == nil {
+			continue
+		}
+		for name, c := range a.Report.Checks {
+			if c.Challenge != "" {
+				u, ok := samples[c.Challenge]
+				if !ok {
+					u = &Uptime{}
+					samples[c.Challenge] = u
+				}
+				u.Instances++
+				if c.Status == StatusHealthy {
+					u.Healthy++
+				} else if c.Status == StatusUnhealthy {
+					u.LastFailure = now
+				}
+			}
+
+			key := a.Id + "/" + name
+			if !c.Escalated {
+				continue
+			}
+			escalated[key] = true
+			if !t.alerted[key] {
+				alerts = append(alerts, Alert{Agent: a.Id, Instance: name, Challenge: c.Challenge, Restarts: c.Restarts, Error: c.Error, Time: now})
+			}
+		}
+	}
+	t.alerted = escalated // recovered instances may be alerted about again
+	t.mu.Unlock()
+
+	err := t.uptime.Update(func(items map[string]Uptime) error {
+		for id, s := range samples {
+			u := items[id]
+			u.Challenge = id
+			u.Up += int64(s.Healthy)
+			u.Total += int64(s.Instances)
+			u.Healthy, u.Instances = s.Healthy, s.Instances
+			if !s.LastFailure.IsZero() {
+				u.LastFailure = s.LastFailure
+			}
+			u.UpdatedAt = now
+			items[id] = u
+		}
+		return nil
+	})
+
+	errs := []error{err}
+	for _, a := range alerts {
+		log.Error().
+			WithMeta("scope", "health").
+			WithMeta("agent", a.Agent).
+			WithMeta("instance", a.Instance).
+			Msgf("instance is down after %d restarts: %s", a.Restarts, a.Error).Send()
+		for _, notify := range t.Notify {
+			if err := notify(ctx, a); err != nil {
+				errs = append(errs, fmt.Errorf("alert about %s: %w", a.Instance, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Uptime returns the uptime of challenge id
+func (t *Tracker) Uptime(id string) (Uptime, bool) {
+	return t.uptime.Get(id)
+}
+
+// Uptimes returns the uptime of every challenge, sorted by id
+func (t *Tracker) Uptimes() []Uptime {
+	return t.uptime.List()
+}
+
+// Run samples every interval until ctx is done
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+		if err := t.Sample(ctx); err != nil {
+			log.Error().WithMeta("scope", "health").Msgf("failed to sample healthchecks: %v", err).Send()
+		}
+	}
+}
@@ -1,40 +1,134 @@
 package cleanup
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 
-	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/log"
 )
 
 type CleanupFunc func() error
 
+// Priority orders cleanups into phases, lower priorities run first.
+// Within a priority, cleanups run in reverse registration order.
+type Priority int
+
+const (
+	PRIORITY_STOP_ACCEPTING Priority = 100 // stop listeners
+	PRIORITY_DRAIN          Priority = 200 // wait for in-flight work
+	PRIORITY_DEFAULT        Priority = 300
+	PRIORITY_CLOSE          Priority = 400 // close databases and files
+	PRIORITY_FLUSH          Priority = 500 // flush logs
+)
+
+type entry struct {
+	name     string
+	fn       CleanupFunc
+	priority Priority
+	parallel bool
+	after    []string
+}
+
+// Option configures a cleanup registration
+type Option func(*entry)
+
+// WithPriority runs the cleanup in the given phase
+func WithPriority(priority Priority) Option {
+	return func(e *entry) { e.priority = priority }
+}
+
+// Parallel marks the cleanup as safe to run concurrently with
+// the other parallel cleanups of its phase, e.g. stopping one
+// of many challenge containers
+func Parallel() Option {
+	return func(e *entry) { e.parallel = true }
+}
+
+// After makes the cleanup wait for the named cleanups
+// of its phase to finish first
+func After(names ...string) Option {
+	return func(e *entry) { e.after = append(e.after, names...) }
+}
+
+// Errors maps the names of failed cleanups to their errors
+type Errors map[string]error
+
+func (e Errors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, e[name]))
+	}
+	return "cleanup failed: " + strings.Join(msgs, "; ")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
 var (
 	once sync.Once
 
+	sigMu    sync.Mutex
+	signals  = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	triggers = make(chan string, 1)
+
 	errMu      sync.Mutex
 	errorIdGen uint64
-	errorFns   = make(map[uint64]CleanupFunc)
+	errorFns   = make(map[uint64]entry)
 
 	mu           sync.Mutex
 	cleanupIdGen uint64
-	cleanupFns   = make(map[uint64]CleanupFunc)
+	cleanupFns   = make(map[uint64]entry)
 )
 
 // Register registers a cleanup function
-// that is called on exit
-func Register(fn CleanupFunc) uint64 {
+// that is called on exit, e.g. Register("docker-prune", fn)
+func Register(name string, fn CleanupFunc) uint64 {
+	return RegisterPriority(name, PRIORITY_DEFAULT, fn)
+}
+
+// RegisterPriority registers a cleanup function
+// that is called on exit in the given phase
+func RegisterPriority(name string, priority Priority, fn CleanupFunc) uint64 {
+	return RegisterWith(name, fn, WithPriority(priority))
+}
+
+// RegisterWith registers a cleanup function
+// that is called on exit, configured by opts
+func RegisterWith(name string, fn CleanupFunc, opts ...Option) uint64 {
 	id := atomic.AddUint64(&cleanupIdGen, 1)
 	mu.Lock()
-	cleanupFns[id] = fn
+	cleanupFns[id] = newEntry(name, fn, opts)
 	mu.Unlock()
 	return id
 }
 
+func newEntry(name string, fn CleanupFunc, opts []Option) entry {
+	e := entry{name: name, fn: fn, priority: PRIORITY_DEFAULT}
+	for _, opt := range opts {
+		opt(&e)
+	}
+	return e
+}
+
 func Unregister(id uint64) {
 	mu.Lock()
 	delete(cleanupFns, id)
@@ -43,10 +137,22 @@ func Unregister(id uint64) {
 
 // RegisterError registers an error cleanup function
 // that is called on error exit
-func RegisterError(fn CleanupFunc) uint64 {
+func RegisterError(name string, fn CleanupFunc) uint64 {
+	return RegisterErrorPriority(name, PRIORITY_DEFAULT, fn)
+}
+
+// RegisterErrorPriority registers an error cleanup function
+// that is called on error exit in the given phase
+func RegisterErrorPriority(name string, priority Priority, fn CleanupFunc) uint64 {
+	return RegisterErrorWith(name, fn, WithPriority(priority))
+}
+
+// RegisterErrorWith registers an error cleanup function
+// that is called on error exit, configured by opts
+func RegisterErrorWith(name string, fn CleanupFunc, opts ...Option) uint64 {
 	id := atomic.AddUint64(&errorIdGen, 1)
 	errMu.Lock()
-	errorFns[id] = fn
+	errorFns[id] = newEntry(name, fn, opts)
 	errMu.Unlock()
 	return id
 }
@@ -57,46 +163,100 @@ func UnregisterError(id uint64) {
 	errMu.Unlock()
 }
 
-func RunErrorCleanup() {
-	errMu.Lock()
-	fns := make([]CleanupFunc, 0, len(errorFns))
-	for _, fn := range errorFns {
-		fns = append(fns, fn)
+// ordered returns the entries by priority, latest registered first
+func ordered(entries map[uint64]entry) []entry {
+	ids := make([]uint64, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
 	}
-	errorFns = make(map[uint64]CleanupFunc)
-	atomic.StoreUint64(&errorIdGen, 0)
-	errMu.Unlock()
-	for i, fn := range fns {
-		name := fmt.Sprintf("error cleanup %d", i)
-		if err := nopanic.NoPanicRun(name, fn); err != nil {
-			fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := entries[ids[i]], entries[ids[j]]
+		if a.priority != b.priority {
+			return a.priority < b.priority
 		}
+		return ids[i] > ids[j]
+	})
+
+	out := make([]entry, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, entries[id])
 	}
+	return out
 }
 
-func RunCleanup() {
+// RunErrorCleanup runs and removes every error cleanup,
+// returning an Errors with the ones that failed
+func RunErrorCleanup() error {
+	errMu.Lock()
+	entries := ordered(errorFns)
+	errorFns = make(map[uint64]entry)
+	atomic.StoreUint64(&errorIdGen, 0)
+	errMu.Unlock()
+	return run("error cleanup", entries)
+}
+
+// RunCleanup runs and removes every cleanup,
+// returning an Errors with the ones that failed
+func RunCleanup() error {
 	mu.Lock()
-	fns := make([]CleanupFunc, 0, len(cleanupFns))
-	for _, fn := range cleanupFns {
-		fns = append(fns, fn)
-	}
-	cleanupFns = make(map[uint64]CleanupFunc)
+	entries := ordered(cleanupFns)
+	cleanupFns = make(map[uint64]entry)
 	atomic.StoreUint64(&cleanupIdGen, 0)
 	mu.Unlock()
-	for i, fn := range fns {
-		name := fmt.Sprintf("cleanup %d", i)
-		if err := nopanic.NoPanicRun(name, fn); err != nil {
-			fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
-		}
+	return run("cleanup", entries)
+}
+
+// SetSignals replaces the signals Listen shuts down on,
+// SIGINT and SIGTERM by default
+func SetSignals(sigs ...os.Signal) {
+	sigMu.Lock()
+	defer sigMu.Unlock()
+	signals = append([]os.Signal(nil), sigs...)
+}
+
+// Trigger makes Listen shut down as if a signal was received
+func Trigger(reason string) {
+	select {
+	case triggers <- reason:
+	default: // a shutdown is already pending
 	}
 }
 
+// Listen blocks until a signal is received or Trigger is called,
+// then runs the error cleanups and cleanups
 func Listen() {
+	_ = ListenContext(context.Background())
+}
+
+// ListenContext is Listen, returning ctx's error without running
+// any cleanups if ctx is done first. Otherwise it returns the
+// cleanups' errors.
+//
+// Cleanups run at most once, however often Listen is called.
+func ListenContext(ctx context.Context) error {
+	sigMu.Lock()
+	sigs := append([]os.Signal(nil), signals...)
+	sigMu.Unlock()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	var reason string
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case sig := <-ch:
+		reason = "received " + sig.String()
+	case reason = <-triggers:
+	}
+
+	var err error
 	once.Do(func() {
-		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-		<-sigs
-		RunErrorCleanup()
-		RunCleanup()
+		log.Info().
+			WithMeta("scope", "cleanup").
+			Msgf("shutting down: %s", reason).Send()
+		err = errors.Join(RunErrorCleanup(), RunCleanup())
 	})
+	return err
 }
@@ -0,0 +1,133 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCleanup_Order(t *testing.T) {
+	var order []string
+	record := func(name string) CleanupFunc {
+		return func() error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	RegisterPriority("flush logs", PRIORITY_FLUSH, record("flush logs"))
+	Register("first", record("first"))
+	RegisterPriority("stop listener", PRIORITY_STOP_ACCEPTING, record("stop listener"))
+	Register("second", record("second"))
+	RegisterPriority("close db", PRIORITY_CLOSE, record("close db"))
+
+	assert.NoError(t, RunCleanup())
+	assert.Equal(t, []string{"stop listener", "second", "first", "close db", "flush logs"}, order)
+}
+
+func TestRunCleanup_Errors(t *testing.T) {
+	errPrune := errors.New("daemon unreachable")
+	Register("docker-prune", func() error { return errPrune })
+	Register("close-db", func() error { return nil })
+
+	err := RunCleanup()
+	var errs Errors
+	assert.ErrorAs(t, err, &errs)
+	assert.Equal(t, Errors{"docker-prune": errPrune}, errs)
+	assert.ErrorIs(t, err, errPrune)
+	assert.EqualError(t, err, "cleanup failed: docker-prune: daemon unreachable")
+
+	Register("flush", func() error { panic("closed pipe") })
+	assert.EqualError(t, RunCleanup(), "cleanup failed: flush: flush panicked: closed pipe")
+}
+
+func TestListenContext(t *testing.T) {
+	once = sync.Once{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, ListenContext(ctx), context.Canceled)
+
+	ran := make(chan struct{})
+	Register("trigger", func() error { close(ran); return nil })
+
+	done := make(chan error, 1)
+	go func() { done <- ListenContext(context.Background()) }()
+	Trigger("test shutdown")
+
+	<-ran
+	assert.NoError(t, <-done)
+}
+
+func TestRunCleanup_Parallel(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		order   []string
+		running atomic.Int32
+		peak    atomic.Int32
+	)
+	record := func(name string) CleanupFunc {
+		return func() error {
+			if n := running.Add(1); n > peak.Load() {
+				peak.Store(n)
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	SetConcurrency(2)
+	defer SetConcurrency(DEFAULT_CLEANUP_CONCURRENCY)
+
+	Register("db", record("db"))
+	RegisterWith("network", record("network"), After("container-a", "container-b"))
+	RegisterWith("container-a", record("container-a"), Parallel())
+	RegisterWith("container-b", record("container-b"), Parallel())
+	RegisterWith("container-c", record("container-c"), Parallel())
+
+	assert.NoError(t, RunCleanup())
+	assert.Equal(t, int32(2), peak.Load())
+	assert.Len(t, order, 5)
+	assert.Equal(t, "db", order[4])
+	assert.Contains(t, order[2:4], "network")
+}
+
+func TestExit(t *testing.T) {
+	var code int
+	osExit = func(c int) { code = c }
+	defer func() { osExit = os.Exit }()
+
+	var ran []string
+	RegisterError("error", func() error { ran = append(ran, "error"); return nil })
+	Register("normal", func() error { ran = append(ran, "normal"); return nil })
+
+	once = sync.Once{}
+	Fail(WithExitCode(errors.New("bad flag"), 2))
+	assert.Equal(t, 2, code)
+	assert.Equal(t, []string{"error", "normal"}, ran)
+
+	ran = nil
+	Register("normal", func() error { ran = append(ran, "normal"); return nil })
+	Exit(0)
+	assert.Empty(t, ran, "cleanups run at most once")
+
+	ran = nil
+	once = sync.Once{}
+	Exit(0)
+	assert.Equal(t, []string{"normal"}, ran)
+	assert.Equal(t, 0, code)
+
+	assert.Equal(t, DEFAULT_FATAL_EXIT_CODE, ExitCode(errors.New("x")))
+	assert.Equal(t, 0, ExitCode(nil))
+}
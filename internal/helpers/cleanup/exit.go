@@ -0,0 +1,85 @@
+package cleanup
+
+import (
+	"errors"
+	"os"
+
+	"github.com/lattesec/log"
+)
+
+// Swapped out in tests
+var osExit = os.Exit
+
+// ExitCoder is an error that carries its own exit code
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+func (e *exitError) ExitCode() int { return e.code }
+
+// WithExitCode wraps err so that Fail exits with code
+func WithExitCode(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{err: err, code: code}
+}
+
+// ExitCode returns the code Fail exits with for err:
+// 0 for nil, the code of the first ExitCoder in the chain
+// or DEFAULT_FATAL_EXIT_CODE
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var ec ExitCoder
+	if errors.As(err, &ec) {
+		return ec.ExitCode()
+	}
+	return DEFAULT_FATAL_EXIT_CODE
+}
+
+// Exit runs the cleanups, flushes the loggers and exits with code.
+// The error cleanups run too when code is not 0.
+//
+// It is the replacement for os.Exit, which skips every cleanup.
+// Cleanups that already ran through Listen are not run again.
+func Exit(code int) {
+	once.Do(func() {
+		var errs []error
+		if code != 0 {
+			errs = append(errs, RunErrorCleanup())
+		}
+		errs = append(errs, RunCleanup())
+		if err := errors.Join(errs...); err != nil {
+			log.Error().
+				WithMeta("scope", "cleanup").
+				Msgf("cleanup failed on exit: %v", err).Send()
+		}
+	})
+	log.Sync()
+	osExit(code)
+}
+
+// Fail logs err and exits with ExitCode(err), see Exit.
+// A nil err exits with 0.
+//
+//	if err := run(); err != nil {
+//		cleanup.Fail(err)
+//	}
+func Fail(err error) {
+	if err != nil {
+		log.Error().
+			WithMeta("scope", "cleanup").
+			Msg(err.Error()).Send()
+	}
+	Exit(ExitCode(err))
+}
@@ -0,0 +1,79 @@
+package cleanup
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/log"
+)
+
+const DEFAULT_FATAL_EXIT_CODE = 1
+
+type fatalHook struct {
+	id uint64
+	fn CleanupFunc
+}
+
+var (
+	fatalMu       sync.Mutex
+	fatalIdGen    uint64 // never reset, so ids are never reused
+	fatalHooks    []fatalHook
+	fatalExitCode atomic.Int32
+)
+
+func init() {
+	fatalExitCode.Store(DEFAULT_FATAL_EXIT_CODE)
+}
+
+// RegisterFatal registers a hook that is called before a Fatal log
+// exits. Hooks run in reverse registration order, like cleanups.
+func RegisterFatal(fn CleanupFunc) uint64 {
+	id := atomic.AddUint64(&fatalIdGen, 1)
+	fatalMu.Lock()
+	fatalHooks = append(fatalHooks, fatalHook{id: id, fn: fn})
+	fatalMu.Unlock()
+	return id
+}
+
+func UnregisterFatal(id uint64) {
+	fatalMu.Lock()
+	fatalHooks = slices.DeleteFunc(fatalHooks, func(h fatalHook) bool { return h.id == id })
+	fatalMu.Unlock()
+}
+
+// SetFatalExitCode sets the code OnFatal exits with
+func SetFatalExitCode(code int) {
+	fatalExitCode.Store(int32(code))
+}
+
+func runFatalHooks() {
+	fatalMu.Lock()
+	hooks := fatalHooks
+	fatalHooks = nil
+	fatalMu.Unlock()
+	for _, h := range slices.Backward(hooks) {
+		name := fmt.Sprintf("fatal hook %d", h.id)
+		if err := nopanic.NoPanicRunErr(name, h.fn); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+		}
+	}
+}
+
+// OnFatal runs the fatal hooks, error cleanups and cleanups,
+// flushes the log handlers and then exits.
+//
+// Fatal logs otherwise bypass every function registered here,
+// so it should be handed to every logger that is built:
+//
+//	log.NewLogger().WithCleanup(cleanup.OnFatal)
+func OnFatal() {
+	runFatalHooks()
+	RunErrorCleanup()
+	RunCleanup()
+	log.Sync()
+	osExit(int(fatalExitCode.Load()))
+}
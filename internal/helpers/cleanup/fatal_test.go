@@ -0,0 +1,57 @@
+package cleanup
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunFatalHooks(t *testing.T) {
+	var ran []string
+	hook := func(name string) CleanupFunc {
+		return func() error { ran = append(ran, name); return nil }
+	}
+	RegisterFatal(hook("first"))
+	dropped := RegisterFatal(hook("dropped"))
+	RegisterFatal(func() error { panic("boom") })
+	RegisterFatal(hook("second"))
+	UnregisterFatal(dropped)
+	UnregisterFatal(dropped) // unregistering twice is fine
+
+	runFatalHooks()
+	assert.Equal(t, []string{"second", "first"}, ran, "in reverse, whatever panics")
+
+	ran = nil
+	runFatalHooks()
+	assert.Empty(t, ran, "hooks only run once")
+
+	RegisterFatal(hook("late"))
+	UnregisterFatal(dropped)
+	runFatalHooks()
+	assert.Equal(t, []string{"late"}, ran, "ids are never reused, a stale one removes nothing")
+}
+
+func TestSetFatalExitCode(t *testing.T) {
+	defer SetFatalExitCode(DEFAULT_FATAL_EXIT_CODE)
+	assert.EqualValues(t, DEFAULT_FATAL_EXIT_CODE, fatalExitCode.Load())
+
+	SetFatalExitCode(3)
+	assert.EqualValues(t, 3, fatalExitCode.Load())
+}
+
+func TestOnFatal(t *testing.T) {
+	var code int
+	osExit = func(c int) { code = c }
+	defer func() { osExit = os.Exit }()
+	defer SetFatalExitCode(DEFAULT_FATAL_EXIT_CODE)
+
+	var ran []string
+	RegisterFatal(func() error { ran = append(ran, "hook"); return nil })
+	Register("cleanup", func() error { ran = append(ran, "cleanup"); return nil })
+
+	SetFatalExitCode(3)
+	OnFatal()
+	assert.Equal(t, 3, code)
+	assert.Equal(t, []string{"hook", "cleanup"}, ran, "fatal hooks run before the cleanups")
+}
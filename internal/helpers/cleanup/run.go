@@ -0,0 +1,178 @@
+package cleanup
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+)
+
+const DEFAULT_CLEANUP_CONCURRENCY = 8
+
+var concurrency atomic.Int32
+
+func init() {
+	concurrency.Store(DEFAULT_CLEANUP_CONCURRENCY)
+}
+
+// SetConcurrency limits how many parallel cleanups run at once
+func SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	concurrency.Store(int32(n))
+}
+
+// A cleanup scheduled in a phase, with the
+// indexes of the cleanups it has to wait for
+type task struct {
+	entry
+	name string
+	deps []int
+	done chan struct{}
+}
+
+// run runs entries, ordered by priority, phase by phase
+func run(kind string, entries []entry) error {
+	var (
+		errMu sync.Mutex
+		errs  = make(Errors)
+		seen  = make(map[string]bool)
+	)
+
+	for start := 0; start < len(entries); {
+		end := start
+		for end < len(entries) && entries[end].priority == entries[start].priority {
+			end++
+		}
+
+		tasks := schedule(kind, entries[start:end], start, seen)
+		runPhase(tasks, func(name string, err error) {
+			errMu.Lock()
+			defer errMu.Unlock()
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+			errs[name] = err
+		})
+		start = end
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// schedule turns a phase's entries into tasks. Cleanups that are
+// not parallel act as barriers, running after everything before
+// them and before everything after them, as they always have.
+func schedule(kind string, entries []entry, offset int, seen map[string]bool) []*task {
+	tasks := make([]*task, len(entries))
+	byName := make(map[string][]int)
+	for i, e := range entries {
+		name := e.name
+		if name == "" {
+			name = fmt.Sprintf("%s %d", kind, offset+i)
+		}
+		if seen[name] {
+			name = fmt.Sprintf("%s#%d", name, offset+i)
+		}
+		seen[name] = true
+		tasks[i] = &task{entry: e, name: name, done: make(chan struct{})}
+		byName[e.name] = append(byName[e.name], i)
+	}
+
+	barrier, since := -1, []int(nil)
+	for i, t := range tasks {
+		if t.parallel {
+			if barrier >= 0 {
+				t.deps = append(t.deps, barrier)
+			}
+			since = append(since, i)
+		} else {
+			if barrier >= 0 {
+				t.deps = append(t.deps, barrier)
+			}
+			t.deps = append(t.deps, since...)
+			barrier, since = i, nil
+		}
+
+		for _, name := range t.after {
+			for _, j := range byName[name] {
+				if j != i {
+					t.deps = append(t.deps, j)
+				}
+			}
+		}
+	}
+
+	if hasCycle(tasks) {
+		fmt.Fprintf(os.Stderr, "%s dependencies form a cycle, running sequentially\n", kind)
+		for i, t := range tasks {
+			t.deps = nil
+			if i > 0 {
+				t.deps = []int{i - 1}
+			}
+		}
+	}
+	return tasks
+}
+
+func hasCycle(tasks []*task) bool {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(tasks))
+
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		switch state[i] {
+		case visiting:
+			return true
+		case visited:
+			return false
+		}
+		state[i] = visiting
+		for _, dep := range tasks[i].deps {
+			if visit(dep) {
+				return true
+			}
+		}
+		state[i] = visited
+		return false
+	}
+
+	for i := range tasks {
+		if visit(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// runPhase runs every task once its dependencies are done,
+// at most SetConcurrency of them at a time
+func runPhase(tasks []*task, fail func(name string, err error)) {
+	sem := make(chan struct{}, concurrency.Load())
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t *task) {
+			defer wg.Done()
+			defer close(t.done)
+			for _, dep := range t.deps {
+				<-tasks[dep].done
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := nopanic.NoPanicRunErr(t.name, t.fn); err != nil {
+				fail(t.name, err)
+			}
+		}(t)
+	}
+	wg.Wait()
+}
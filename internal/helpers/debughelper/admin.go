@@ -0,0 +1,101 @@
+package debughelper
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/logging"
+	"github.com/lattesec/ctfjx/version"
+	"github.com/lattesec/log"
+)
+
+const DEFAULT_ADMIN_ADDR = "127.0.0.1:6060"
+
+var ErrAdminNotLocal = errors.New("admin server must listen on a loopback address")
+
+// AdminConfig gates the admin server, which is off by default
+type AdminConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" json:"enabled" usage:"serve pprof, expvar and log levels"`
+	Addr    string `yaml:"addr" toml:"addr" json:"addr" default:"127.0.0.1:6060" usage:"loopback address of the admin server"`
+}
+
+// NewAdminMux mounts net/http/pprof under /debug/pprof/, expvar
+// under /debug/vars and the log level and metrics handlers under
+// /debug/log/ and the build info under /version.
+// None of them are authenticated.
+func NewAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/debug/log/levels", logging.LevelsHTTPHandler())
+	mux.Handle("/debug/log/metrics", logging.MetricsHTTPHandler())
+	mux.Handle("/version", version.Handler())
+	return mux
+}
+
+// StartAdmin serves NewAdminMux on cfg.Addr, which must be a
+// loopback address. It returns a nil server if cfg is disabled.
+//
+// The server is an io.Closer, so it can be handed to a
+// shutdown.Coordinator as a listener.
+func StartAdmin(cfg AdminConfig) (*http.Server, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	addr := cfg.Addr
+	if addr == "" {
+		addr = DEFAULT_ADMIN_ADDR
+	}
+	if err := checkLoopback(addr); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{
+		Addr:              ln.Addr().String(),
+		Handler:           NewAdminMux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().
+				WithMeta("scope", "admin").
+				Msgf("admin server failed: %v", err).Send()
+		}
+	}()
+
+	log.Info().
+		WithMeta("scope", "admin").
+		WithMeta("addr", srv.Addr).
+		Msg("admin server listening").Send()
+	return srv, nil
+}
+
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%w: %s", ErrAdminNotLocal, addr)
+	}
+	return nil
+}
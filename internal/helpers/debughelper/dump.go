@@ -0,0 +1,142 @@
+package debughelper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lattesec/log"
+)
+
+const DUMP_FILE_MODE = 0o600
+
+// SectionFunc writes one section of a dump, e.g. the open connections
+type SectionFunc func(w io.Writer) error
+
+type section struct {
+	name string
+	fn   SectionFunc
+}
+
+var (
+	sectionMu    sync.Mutex
+	sectionIdGen uint64
+	sections     = make(map[uint64]section)
+)
+
+// RegisterSection adds a section to every dump written by DumpAll
+func RegisterSection(name string, fn SectionFunc) uint64 {
+	id := atomic.AddUint64(&sectionIdGen, 1)
+	sectionMu.Lock()
+	sections[id] = section{name: name, fn: fn}
+	sectionMu.Unlock()
+	return id
+}
+
+func UnregisterSection(id uint64) {
+	sectionMu.Lock()
+	delete(sections, id)
+	sectionMu.Unlock()
+}
+
+// DumpAll writes the stacks of every goroutine, the heap
+// statistics and every registered section to w
+func DumpAll(w io.Writer) error {
+	fmt.Fprintf(w, "=== dump at %s\n\n", time.Now().UTC().Format(time.RFC3339))
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fmt.Fprintf(w, "=== heap\n")
+	fmt.Fprintf(w, "goroutines: %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "heap alloc: %d\nheap sys: %d\nheap objects: %d\n", m.HeapAlloc, m.HeapSys, m.HeapObjects)
+	fmt.Fprintf(w, "total alloc: %d\nsys: %d\nnum gc: %d\n\n", m.TotalAlloc, m.Sys, m.NumGC)
+
+	sectionMu.Lock()
+	ids := make([]uint64, 0, len(sections))
+	for id := range sections {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	secs := make([]section, len(ids))
+	for i, id := range ids {
+		secs[i] = sections[id]
+	}
+	sectionMu.Unlock()
+
+	for _, s := range secs {
+		fmt.Fprintf(w, "=== %s\n", s.name)
+		if err := s.fn(w); err != nil {
+			fmt.Fprintf(w, "failed: %v\n", err)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "=== goroutines\n")
+	return pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// DumpToFile writes a dump to a new timestamped file in dir
+// and returns its path
+func DumpToFile(dir string) (string, error) {
+	pth := filepath.Join(dir, fmt.Sprintf("dump-%s.txt", time.Now().UTC().Format("20060102T150405.000")))
+	f, err := os.OpenFile(pth, os.O_CREATE|os.O_EXCL|os.O_WRONLY, DUMP_FILE_MODE)
+	if err != nil {
+		return "", err
+	}
+	if err := DumpAll(f); err != nil {
+		_ = f.Close()
+		return pth, err
+	}
+	return pth, f.Close()
+}
+
+// DumpOnSignal writes a dump to dir whenever one of sigs, SIGQUIT by
+// default, is received. Handling SIGQUIT replaces Go's default of
+// printing the stacks and exiting. Call the returned func to stop.
+func DumpOnSignal(dir string, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGQUIT}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				pth, err := DumpToFile(dir)
+				if err != nil {
+					log.Error().
+						WithMeta("scope", "debughelper").
+						Msgf("failed to write dump on %s: %v", sig, err).Send()
+					continue
+				}
+				log.Info().
+					WithMeta("scope", "debughelper").
+					WithMeta("path", pth).
+					Msgf("wrote dump on %s", sig).Send()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package debughelper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpToFile(t *testing.T) {
+	id := RegisterSection("connections", func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, "agent-1 -> 10.0.0.2:7000")
+		return err
+	})
+	defer UnregisterSection(id)
+
+	pth, err := DumpToFile(t.TempDir())
+	assert.NoError(t, err)
+
+	b, err := os.ReadFile(pth)
+	assert.NoError(t, err)
+	out := string(b)
+	assert.Contains(t, out, "=== heap")
+	assert.Contains(t, out, "=== connections\nagent-1 -> 10.0.0.2:7000")
+	assert.True(t, strings.Contains(out, "TestDumpToFile"), "goroutine stacks are included")
+}
+
+func TestStartAdmin(t *testing.T) {
+	srv, err := StartAdmin(AdminConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, srv, "disabled by default")
+
+	_, err = StartAdmin(AdminConfig{Enabled: true, Addr: "0.0.0.0:0"})
+	assert.ErrorIs(t, err, ErrAdminNotLocal)
+
+	srv, err = StartAdmin(AdminConfig{Enabled: true, Addr: "127.0.0.1:0"})
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	resp, err := http.Get("http://" + srv.Addr + "/debug/vars")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
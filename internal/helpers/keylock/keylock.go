@@ -0,0 +1,42 @@
+// Keylock package serializes work per key, e.g. per team and
+// challenge, so that work on other keys does not wait for it
+package keylock
+
+import "sync"
+
+// Map holds a lock per key while it is held or waited for. The zero
+// value is ready to use.
+type Map struct {
+	mu    sync.Mutex
+	locks map[string]*lock
+}
+
+type lock struct {
+	mu   sync.Mutex
+	refs int // holders and waiters
+}
+
+// Lock locks key, returning the func that unlocks it
+func (m *Map) Lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*lock)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &lock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+	}
+}
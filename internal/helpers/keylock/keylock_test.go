@@ -0,0 +1,54 @@
+package keylock
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap(t *testing.T) {
+	var m Map
+
+	unlockA := m.Lock("a")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Lock("b")()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("other keys wait for a")
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		defer close(locked)
+		m.Lock("a")()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("a locked twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlockA()
+	<-locked
+
+	var (
+		wg sync.WaitGroup
+		n  int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer m.Lock("c")()
+			n++
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, n)
+	assert.Empty(t, m.locks, "unused locks are dropped")
+}
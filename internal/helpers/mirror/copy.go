@@ -0,0 +1,104 @@
+package mirror
+
+import "reflect"
+
+// DeepCopy returns a copy of v that shares no pointers, slices
+// or maps with it. Shared and cyclic pointers stay shared and
+// cyclic within the copy.
+//
+// Values with a Clone method returning their own type, such as
+// *tls.Config, are copied with it. Funcs, channels and unexported
+// fields are copied shallowly.
+func DeepCopy[T any](v T) T {
+	src := reflect.ValueOf(&v).Elem()
+	dst := reflect.New(src.Type()).Elem()
+	copyValue(dst, src, make(map[copyKey]reflect.Value))
+	return dst.Interface().(T)
+}
+
+// A struct and its first field share an address,
+// so pointers are told apart by type as well
+type copyKey struct {
+	typ  reflect.Type
+	addr uintptr
+}
+
+func copyValue(dst, src reflect.Value, seen map[copyKey]reflect.Value) {
+	if c, ok := cloneMethod(src); ok {
+		dst.Set(c)
+		return
+	}
+
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		key := copyKey{src.Type(), src.Pointer()}
+		if p, ok := seen[key]; ok {
+			dst.Set(p)
+			return
+		}
+		p := reflect.New(src.Type().Elem())
+		seen[key] = p
+		copyValue(p.Elem(), src.Elem(), seen)
+		dst.Set(p)
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		elem := reflect.New(src.Elem().Type()).Elem()
+		copyValue(elem, src.Elem(), seen)
+		dst.Set(elem)
+	case reflect.Struct:
+		dst.Set(src) // keeps the unexported fields
+		for i := 0; i < src.NumField(); i++ {
+			if f := dst.Field(i); f.CanSet() {
+				copyValue(f, src.Field(i), seen)
+			}
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		s := reflect.MakeSlice(src.Type(), src.Len(), src.Cap())
+		for i := 0; i < src.Len(); i++ {
+			copyValue(s.Index(i), src.Index(i), seen)
+		}
+		dst.Set(s)
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			copyValue(dst.Index(i), src.Index(i), seen)
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		m := reflect.MakeMapWithSize(src.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			val := reflect.New(src.Type().Elem()).Elem()
+			copyValue(val, iter.Value(), seen)
+			m.SetMapIndex(iter.Key(), val)
+		}
+		dst.Set(m)
+	default:
+		dst.Set(src)
+	}
+}
+
+// cloneMethod calls v.Clone() if it returns v's own type
+func cloneMethod(v reflect.Value) (reflect.Value, bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return reflect.Value{}, false
+	}
+	m := v.MethodByName("Clone")
+	if !m.IsValid() {
+		return reflect.Value{}, false
+	}
+	t := m.Type()
+	if t.NumIn() != 0 || t.NumOut() != 1 || t.Out(0) != v.Type() {
+		return reflect.Value{}, false
+	}
+	return m.Call(nil)[0], true
+}
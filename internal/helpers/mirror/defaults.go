@@ -0,0 +1,78 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrNotStructPointer = errors.New("not a pointer to a struct")
+
+// ApplyDefaults sets every zero field of the struct ptr points to
+// from its `default:"..."` tag, parsed as by SetString:
+//
+//	type Config struct {
+//		Timeout time.Duration `default:"5s"`
+//		Peers   []string      `default:"a:1,b:2"`
+//	}
+//
+// Nested structs are walked too. A nil pointer to a struct is only
+// allocated if one of its fields gets a default.
+func ApplyDefaults(ptr any) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T", ErrNotStructPointer, ptr)
+	}
+	_, err := applyDefaults(v.Elem(), "")
+	return err
+}
+
+// applyDefaults reports whether any default was applied
+func applyDefaults(v reflect.Value, path string) (bool, error) {
+	t := v.Type()
+	applied := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		name := joinPath(path, field.Name)
+
+		if def, ok := field.Tag.Lookup("default"); ok {
+			if !fv.IsZero() {
+				continue
+			}
+			if err := SetString(fv, def); err != nil {
+				return applied, fmt.Errorf("%s: invalid default %q: %w", name, def, err)
+			}
+			applied = true
+			continue
+		}
+
+		ok, err := applyNestedDefaults(fv, name)
+		if err != nil {
+			return applied, err
+		}
+		applied = applied || ok
+	}
+	return applied, nil
+}
+
+func applyNestedDefaults(fv reflect.Value, name string) (bool, error) {
+	switch {
+	case fv.Kind() == reflect.Struct && !isLeafStruct(fv.Type()):
+		return applyDefaults(fv, name)
+	case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct && !isLeafStruct(fv.Type().Elem()):
+		if !fv.IsNil() {
+			return applyDefaults(fv.Elem(), name)
+		}
+		p := reflect.New(fv.Type().Elem())
+		ok, err := applyDefaults(p.Elem(), name)
+		if ok && err == nil {
+			fv.Set(p)
+		}
+		return ok, err
+	}
+	return false, nil
+}
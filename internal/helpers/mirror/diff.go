@@ -0,0 +1,95 @@
+package mirror
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldChange is a field that differs between two values
+type FieldChange struct {
+	Path string // e.g. "Socket.Timeout" or "Labels[team]"
+	Old  any    // nil if the field was added
+	New  any    // nil if the field was removed
+}
+
+// Diff returns the fields that differ between old and new,
+// sorted by path. Structs, pointers and maps are compared
+// field by field and key by key, everything else as a whole.
+//
+// Values of different types are reported as a single change
+// with an empty path.
+func Diff(old, new any) []FieldChange {
+	var changes []FieldChange
+	diffValue(reflect.ValueOf(old), reflect.ValueOf(new), "", &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffValue(a, b reflect.Value, path string, out *[]FieldChange) {
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		if a.IsValid() != b.IsValid() || (a.IsValid() && !reflect.DeepEqual(a.Interface(), b.Interface())) {
+			*out = append(*out, FieldChange{Path: path, Old: valueOf(a), New: valueOf(b)})
+		}
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*out = append(*out, FieldChange{Path: path, Old: valueOf(a), New: valueOf(b)})
+			}
+			return
+		}
+		diffValue(a.Elem(), b.Elem(), path, out)
+		return
+	case reflect.Struct:
+		if isLeafStruct(a.Type()) {
+			break
+		}
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			switch {
+			case field.Anonymous && (field.IsExported() || field.Type.Kind() == reflect.Struct && !isLeafStruct(field.Type)):
+				diffValue(a.Field(i), b.Field(i), path, out)
+			case field.IsExported() && !field.Anonymous:
+				diffValue(a.Field(i), b.Field(i), joinPath(path, field.Name), out)
+			}
+		}
+		return
+	case reflect.Map:
+		keys := make(map[any]reflect.Value)
+		for _, k := range append(a.MapKeys(), b.MapKeys()...) {
+			keys[k.Interface()] = k
+		}
+		for _, k := range keys {
+			diffValue(a.MapIndex(k), b.MapIndex(k), fmt.Sprintf("%s[%v]", path, k.Interface()), out)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		*out = append(*out, FieldChange{Path: path, Old: a.Interface(), New: b.Interface()})
+	}
+}
+
+func valueOf(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// Structs such as time.Time are compared as a whole
+func isLeafStruct(t reflect.Type) bool {
+	return t.PkgPath() == "time" || IsTextUnmarshaler(t)
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -1,19 +1,82 @@
 package mirror
 
-import "reflect"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var ErrUnsupportedType = errors.New("unsupported type")
 
 // Fresh returns a new zeroed instance of T.
 // If T is a pointer type, it allocates the pointed-to value and returns T itself.
 // If T is a value type, it returns a pointer to a new zeroed value.
+//
+// Nil pointers to structs inside the value are allocated as well,
+// except where a struct refers back to itself or comes from the
+// standard library, such as *tls.Config.
+//
+// It panics if T is an interface type, see FreshErr.
 func Fresh[T any]() any {
-	var zero T
-	typ := reflect.TypeOf(zero)
+	v, err := FreshErr[T]()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
 
-	var a reflect.Type
+// FreshErr is Fresh, returning an error instead of panicking
+func FreshErr[T any]() (any, error) {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() == reflect.Interface {
+		return nil, fmt.Errorf("%w: %s is an interface", ErrUnsupportedType, typ)
+	}
 
+	a := typ
 	if typ.Kind() == reflect.Ptr {
 		a = typ.Elem() // alloc underlying
 	}
 
-	return reflect.New(a).Interface() // type: *T
+	v := reflect.New(a) // type: *T
+	allocNested(v.Elem(), map[reflect.Type]bool{a: true})
+	return v.Interface(), nil
+}
+
+// allocNested allocates the nil struct pointers of v.
+// seen holds the struct types being allocated, to stop
+// at self-referencing types such as linked lists.
+func allocNested(v reflect.Value, seen map[reflect.Type]bool) {
+	if v.Kind() != reflect.Struct || isLeafStruct(v.Type()) {
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+
+		switch {
+		case f.Kind() == reflect.Struct:
+			allocNested(f, seen)
+		case f.Kind() == reflect.Ptr && f.IsNil() && f.Type().Elem().Kind() == reflect.Struct:
+			elem := f.Type().Elem()
+			if seen[elem] || isLeafStruct(elem) || isStdType(elem) {
+				continue
+			}
+			f.Set(reflect.New(elem))
+			seen[elem] = true
+			allocNested(f.Elem(), seen)
+			delete(seen, elem)
+		}
+	}
+}
+
+func isStdType(t reflect.Type) bool {
+	pkg := t.PkgPath()
+	if i := strings.IndexByte(pkg, '/'); i >= 0 {
+		pkg = pkg[:i]
+	}
+	return pkg != "" && !strings.Contains(pkg, ".")
 }
@@ -0,0 +1,141 @@
+package mirror
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type copyNode struct {
+	Name     string
+	Tags     []string
+	Meta     map[string]*copyNode
+	Next     *copyNode
+	Any      any
+	Timeout  time.Duration
+	TLS      *tls.Config
+	internal int
+}
+
+func TestDeepCopy(t *testing.T) {
+	orig := &copyNode{
+		Name:     "root",
+		Tags:     []string{"a", "b"},
+		Meta:     map[string]*copyNode{"child": {Name: "child"}},
+		Any:      []int{1, 2},
+		Timeout:  time.Second,
+		TLS:      &tls.Config{ServerName: "ctfjx"},
+		internal: 7,
+	}
+	orig.Next = orig // cycle
+
+	cp := DeepCopy(orig)
+	assert.Equal(t, "root", cp.Name)
+	assert.Equal(t, 7, cp.internal)
+	assert.Same(t, cp, cp.Next, "cycles are preserved")
+	assert.NotSame(t, orig.TLS, cp.TLS)
+	assert.Equal(t, "ctfjx", cp.TLS.ServerName)
+
+	cp.Tags[0] = "z"
+	cp.Meta["child"].Name = "changed"
+	cp.Any.([]int)[0] = 9
+	assert.Equal(t, "a", orig.Tags[0])
+	assert.Equal(t, "child", orig.Meta["child"].Name)
+	assert.Equal(t, 1, orig.Any.([]int)[0])
+
+	assert.Nil(t, DeepCopy[*copyNode](nil))
+}
+
+type diffInner struct {
+	Timeout time.Duration
+}
+
+type diffCfg struct {
+	Name   string
+	Inner  *diffInner
+	Labels map[string]string
+	Tags   []string
+	secret string
+}
+
+func TestDiff(t *testing.T) {
+	old := &diffCfg{
+		Name:   "a",
+		Inner:  &diffInner{Timeout: time.Second},
+		Labels: map[string]string{"team": "red", "gone": "x"},
+		Tags:   []string{"a"},
+		secret: "a",
+	}
+	new := DeepCopy(old)
+	new.Name = "b"
+	new.Inner.Timeout = 2 * time.Second
+	new.Labels["team"] = "blue"
+	delete(new.Labels, "gone")
+	new.secret = "b"
+
+	assert.Equal(t, []FieldChange{
+		{Path: "Inner.Timeout", Old: time.Second, New: 2 * time.Second},
+		{Path: "Labels[gone]", Old: "x", New: nil},
+		{Path: "Labels[team]", Old: "red", New: "blue"},
+		{Path: "Name", Old: "a", New: "b"},
+	}, Diff(old, new))
+
+	assert.Empty(t, Diff(old, old))
+	assert.Len(t, Diff(old, "other"), 1)
+}
+
+type defaultsPeer struct {
+	Port int `default:"1337"`
+}
+
+type defaultsCfg struct {
+	Name    string        `default:"ctfjx"`
+	Timeout time.Duration `default:"5s"`
+	Tags    []string      `default:"a,b"`
+	Peer    defaultsPeer
+	Backup  *defaultsPeer
+	Unset   *struct{ Name string }
+}
+
+func TestApplyDefaults(t *testing.T) {
+	cfg := &defaultsCfg{Name: "set"}
+	assert.NoError(t, ApplyDefaults(cfg))
+
+	assert.Equal(t, "set", cfg.Name, "non-zero fields are kept")
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, []string{"a", "b"}, cfg.Tags)
+	assert.Equal(t, 1337, cfg.Peer.Port)
+	assert.Equal(t, 1337, cfg.Backup.Port)
+	assert.Nil(t, cfg.Unset)
+
+	assert.ErrorIs(t, ApplyDefaults(*cfg), ErrNotStructPointer)
+
+	bad := &struct {
+		Port int `default:"http"`
+	}{}
+	assert.ErrorContains(t, ApplyDefaults(bad), `Port: invalid default "http"`)
+}
+
+type freshCfg struct {
+	Peer  *defaultsPeer
+	Inner struct{ Peer *defaultsPeer }
+	Next  *freshCfg
+	TLS   *tls.Config
+}
+
+func TestFresh(t *testing.T) {
+	ptr := Fresh[*freshCfg]().(*freshCfg)
+	assert.NotNil(t, ptr.Peer)
+	assert.NotNil(t, ptr.Inner.Peer)
+	assert.Nil(t, ptr.Next, "self references are not allocated")
+	assert.Nil(t, ptr.TLS)
+
+	val := Fresh[freshCfg]().(*freshCfg)
+	assert.NotNil(t, val.Peer)
+
+	_, err := FreshErr[error]()
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	assert.Panics(t, func() { Fresh[error]() })
+}
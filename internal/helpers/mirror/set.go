@@ -0,0 +1,105 @@
+package mirror
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupportedKind = errors.New("unsupported kind")
+	ErrNotSettable     = errors.New("value is not settable")
+
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// SetString parses s into v according to v's type.
+//
+// Supports strings, bools, integers, floats, time.Duration,
+// encoding.TextUnmarshaler, pointers to any of these and
+// slices of any of these given as comma-separated values.
+func SetString(v reflect.Value, s string) error {
+	if !v.CanSet() {
+		return ErrNotSettable
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Ptr:
+		ptr := reflect.New(v.Type().Elem())
+		if err := SetString(ptr.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(ptr)
+	case reflect.Slice:
+		return setSlice(v, s)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedKind, v.Type())
+	}
+	return nil
+}
+
+func setSlice(v reflect.Value, s string) error {
+	if s == "" {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		return nil
+	}
+
+	parts := strings.Split(s, ",")
+	slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+	for i, part := range parts {
+		if err := SetString(slice.Index(i), strings.TrimSpace(part)); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	v.Set(slice)
+	return nil
+}
+
+// IsTextUnmarshaler reports whether a *t can decode itself from text
+func IsTextUnmarshaler(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
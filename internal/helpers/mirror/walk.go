@@ -0,0 +1,43 @@
+package mirror
+
+import "reflect"
+
+// MapStrings replaces every settable string reachable from v,
+// including those in nested structs, pointers, slices and maps,
+// with the result of fn
+func MapStrings(v reflect.Value, fn func(string) string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			MapStrings(v.Elem(), fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				MapStrings(f, fn)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			MapStrings(v.Index(i), fn)
+		}
+	case reflect.Map:
+		mapStringValues(v, fn)
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(fn(v.String()))
+		}
+	}
+}
+
+// Map values are not addressable, so each one is
+// copied, mapped and stored back
+func mapStringValues(v reflect.Value, fn func(string) string) {
+	iter := v.MapRange()
+	for iter.Next() {
+		val := reflect.New(v.Type().Elem()).Elem()
+		val.Set(iter.Value())
+		MapStrings(val, fn)
+		v.SetMapIndex(iter.Key(), val)
+	}
+}
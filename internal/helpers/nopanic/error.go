@@ -0,0 +1,54 @@
+package nopanic
+
+import "fmt"
+
+// PanicError is a recovered panic returned as an error
+type PanicError struct {
+	Panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Name, e.Value)
+}
+
+// Unwrap returns the recovered value if it was an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// NoPanicRunErr calls fn, returning a recovered panic
+// as a *PanicError instead of swallowing it
+func NoPanicRunErr(name string, fn func() error) error {
+	err, p := runOnce(name, fn)
+	if p != nil {
+		return &PanicError{Panic: *p}
+	}
+	return err
+}
+
+// NoPanicRunVoidErr is NoPanicRunErr for functions
+// that return nothing
+func NoPanicRunVoidErr(name string, fn func()) error {
+	return NoPanicRunErr(name, func() error {
+		fn()
+		return nil
+	})
+}
+
+// NoPanicRunValueErr is NoPanicRunErr for functions
+// that also return a value
+func NoPanicRunValueErr[T any](name string, fn func() (T, error)) (T, error) {
+	var (
+		out T
+		err error
+	)
+	perr := NoPanicRunErr(name, func() error {
+		out, err = fn()
+		return nil
+	})
+	if perr != nil {
+		return out, perr
+	}
+	return out, err
+}
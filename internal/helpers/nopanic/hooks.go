@@ -0,0 +1,68 @@
+package nopanic
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Panic describes a recovered panic
+type Panic struct {
+	Name  string // the name the function was run under
+	Value any    // the recovered value
+	Stack []byte
+}
+
+type HookFunc func(p Panic)
+
+var (
+	hookMu    sync.RWMutex
+	hookIdGen uint64
+	hooks     = make(map[uint64]HookFunc)
+)
+
+// RegisterHook registers fn to be called with every recovered
+// panic, e.g. to forward it to a webhook or a metrics counter.
+// Hooks run synchronously before a function is restarted.
+func RegisterHook(fn HookFunc) uint64 {
+	id := atomic.AddUint64(&hookIdGen, 1)
+	hookMu.Lock()
+	hooks[id] = fn
+	hookMu.Unlock()
+	return id
+}
+
+func UnregisterHook(id uint64) {
+	hookMu.Lock()
+	delete(hooks, id)
+	hookMu.Unlock()
+}
+
+func notify(p Panic) {
+	hookMu.RLock()
+	ids := make([]uint64, 0, len(hooks))
+	for id := range hooks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	fns := make([]HookFunc, len(ids))
+	for i, id := range ids {
+		fns[i] = hooks[id]
+	}
+	hookMu.RUnlock()
+
+	for _, fn := range fns {
+		func() {
+			// a panicking hook must not take the caller down,
+			// nor recurse into the hooks
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Fprintf(os.Stderr, "panic hook for %s panicked: %v\n", p.Name, r)
+				}
+			}()
+			fn(p)
+		}()
+	}
+}
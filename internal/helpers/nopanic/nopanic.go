@@ -1,52 +1,107 @@
 package nopanic
 
 import (
+	"context"
+	"runtime/debug"
 	"time"
 
 	"github.com/lattesec/log"
 )
 
-func run[T any](name string, rerun bool, fn func() T) (out T) {
+func run[T any](ctx context.Context, name string, rerun bool, fn func() T, opts ...Option) (out T) {
+	p := newPolicy(opts)
+	rs := p.restarter()
+
 	for {
-		var panicked bool
+		if ctx.Err() != nil {
+			return
+		}
 
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Error().Msgf("panic in %s: %v", name, r).Send()
-					panicked = true
-				}
-			}()
+		start := time.Now()
 
-			out = fn()
-		}()
+		var pn *Panic
+		out, pn = runOnce(name, fn)
+		if pn == nil || !rerun {
+			return
+		}
+		if p.onPanic != nil {
+			p.onPanic(*pn)
+		}
 
-		if !panicked || !rerun {
+		delay, ok := rs.next(start)
+		if !ok {
+			log.Error().
+				WithMeta("scope", "nopanic").
+				Msgf("%s hit its restart limit, giving up", name).Send()
+			if p.onGiveUp != nil {
+				p.onGiveUp(name, pn.Value)
+			}
 			return
 		}
 
-		time.Sleep(1 * time.Second)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
 	}
 }
 
+// runOnce calls fn, recovering and reporting a panic
+func runOnce[T any](name string, fn func() T) (out T, p *Panic) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Msgf("panic in %s: %v", name, r).Send()
+			p = &Panic{Name: name, Value: r, Stack: debug.Stack()}
+			notify(*p)
+		}
+	}()
+
+	return fn(), nil
+}
+
 func NoPanicRun[T any](name string, fn func() T) (out T) {
-	return run(name, false, fn)
+	return run(context.Background(), name, false, fn)
 }
 
 func NoPanicRunVoid(name string, fn func()) {
-	run(name, false, func() any {
+	run(context.Background(), name, false, func() any {
 		fn()
 		return nil
 	})
 }
 
-func NoPanicReRun[T any](name string, fn func() T) (out T) {
-	return run(name, true, fn)
+// NoPanicReRun calls fn again whenever it panics, waiting
+// DEFAULT_RESTART_DELAY in between unless configured otherwise:
+//
+//	nopanic.NoPanicReRun("worker", fn,
+//		nopanic.WithBackoff(time.Second, time.Minute),
+//		nopanic.WithMaxRestarts(5, 10*time.Minute),
+//	)
+func NoPanicReRun[T any](name string, fn func() T, opts ...Option) (out T) {
+	return run(context.Background(), name, true, fn, opts...)
 }
 
-func NoPanicReRunVoid(name string, fn func()) {
-	run(name, true, func() any {
+func NoPanicReRunVoid(name string, fn func(), opts ...Option) {
+	run(context.Background(), name, true, func() any {
 		fn()
 		return nil
-	})
+	}, opts...)
+}
+
+// NoPanicReRunCtx is NoPanicReRun, but stops restarting fn once
+// ctx is done. fn should return when ctx is done as well.
+func NoPanicReRunCtx[T any](ctx context.Context, name string, fn func(ctx context.Context) T, opts ...Option) (out T) {
+	return run(ctx, name, true, func() T {
+		return fn(ctx)
+	}, opts...)
+}
+
+func NoPanicReRunVoidCtx(ctx context.Context, name string, fn func(ctx context.Context), opts ...Option) {
+	run(ctx, name, true, func() any {
+		fn(ctx)
+		return nil
+	}, opts...)
 }
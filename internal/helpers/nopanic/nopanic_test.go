@@ -0,0 +1,102 @@
+package nopanic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoPanicReRun_MaxRestarts(t *testing.T) {
+	var (
+		calls  int
+		gaveUp any
+	)
+	NoPanicReRunVoid("limited", func() {
+		calls++
+		panic("boom")
+	},
+		WithDelay(time.Millisecond),
+		WithMaxRestarts(3, time.Minute),
+		OnGiveUp(func(name string, r any) { gaveUp = r }),
+	)
+
+	assert.Equal(t, 4, calls, "first run plus 3 restarts")
+	assert.Equal(t, "boom", gaveUp)
+}
+
+func TestNoPanicReRun_Backoff(t *testing.T) {
+	r := newPolicy([]Option{WithBackoff(10*time.Millisecond, 40*time.Millisecond)}).restarter()
+
+	var delays []time.Duration
+	for range 4 {
+		d, ok := r.next(time.Now())
+		assert.True(t, ok)
+		delays = append(delays, d)
+	}
+	assert.Equal(t, []time.Duration{
+		10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond,
+	}, delays)
+
+	d, _ := r.next(time.Now().Add(-time.Second))
+	assert.Equal(t, 10*time.Millisecond, d, "a long run resets the backoff")
+}
+
+func TestRegisterHook(t *testing.T) {
+	var got []Panic
+	id := RegisterHook(func(p Panic) { got = append(got, p) })
+	bad := RegisterHook(func(p Panic) { panic("hook") })
+	defer UnregisterHook(bad)
+
+	NoPanicRunVoid("hooked", func() { panic("boom") })
+	UnregisterHook(id)
+	NoPanicRunVoid("hooked", func() { panic("boom") })
+
+	assert.Len(t, got, 1)
+	assert.Equal(t, "hooked", got[0].Name)
+	assert.Equal(t, "boom", got[0].Value)
+	assert.Contains(t, string(got[0].Stack), "TestRegisterHook")
+}
+
+func TestNoPanicReRunCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NoPanicReRunVoidCtx(ctx, "ctx", func(ctx context.Context) {
+			calls++
+			if calls == 2 {
+				cancel()
+			}
+			panic("boom")
+		}, WithDelay(time.Millisecond))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rerun loop did not stop after cancel")
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestNoPanicRunErr(t *testing.T) {
+	cause := errors.New("cause")
+	err := NoPanicRunErr("handler", func() error { panic(cause) })
+
+	var pe *PanicError
+	assert.ErrorAs(t, err, &pe)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "handler panicked: cause", err.Error())
+	assert.NotEmpty(t, pe.Stack)
+
+	assert.Equal(t, cause, NoPanicRunErr("plain", func() error { return cause }))
+
+	v, err := NoPanicRunValueErr("value", func() (int, error) { return 3, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v)
+}
@@ -0,0 +1,116 @@
+package nopanic
+
+import "time"
+
+const (
+	DEFAULT_RESTART_DELAY  = 1 * time.Second
+	DEFAULT_BACKOFF_FACTOR = 2
+)
+
+// Option configures how a rerun function is restarted
+type Option func(*policy)
+
+type policy struct {
+	delay    time.Duration
+	maxDelay time.Duration // 0 keeps the delay fixed
+
+	maxRestarts int // 0 restarts forever
+	window      time.Duration
+
+	onGiveUp func(name string, r any)
+	onPanic  func(p Panic)
+}
+
+func newPolicy(opts []Option) *policy {
+	p := &policy{delay: DEFAULT_RESTART_DELAY}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithDelay sets a fixed delay between restarts
+func WithDelay(d time.Duration) Option {
+	return func(p *policy) {
+		p.delay = d
+		p.maxDelay = 0
+	}
+}
+
+// WithBackoff doubles the delay after every panic, starting
+// at initial and capped at max. It resets once a run outlives max.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(p *policy) {
+		p.delay = initial
+		p.maxDelay = max
+	}
+}
+
+// WithMaxRestarts gives up after n restarts within window.
+// A window of 0 counts every restart.
+func WithMaxRestarts(n int, window time.Duration) Option {
+	return func(p *policy) {
+		p.maxRestarts = n
+		p.window = window
+	}
+}
+
+// OnGiveUp is called with the last recovered value
+// when the restart limit is hit
+func OnGiveUp(fn func(name string, r any)) Option {
+	return func(p *policy) {
+		p.onGiveUp = fn
+	}
+}
+
+// OnPanic is called with every panic of this function,
+// before it is restarted. See RegisterHook for every function.
+func OnPanic(fn func(p Panic)) Option {
+	return func(p *policy) {
+		p.onPanic = fn
+	}
+}
+
+// restarter tracks the state of a single rerun loop
+type restarter struct {
+	p        *policy
+	delay    time.Duration
+	restarts []time.Time
+}
+
+func (p *policy) restarter() *restarter {
+	return &restarter{p: p, delay: p.delay}
+}
+
+// next records a panic of a run that started at start and
+// returns how long to wait, or false to give up
+func (r *restarter) next(start time.Time) (time.Duration, bool) {
+	now := time.Now()
+
+	if r.p.maxRestarts > 0 {
+		if r.p.window > 0 {
+			kept := r.restarts[:0]
+			for _, t := range r.restarts {
+				if now.Sub(t) < r.p.window {
+					kept = append(kept, t)
+				}
+			}
+			r.restarts = kept
+		}
+		if len(r.restarts) >= r.p.maxRestarts {
+			return 0, false
+		}
+		r.restarts = append(r.restarts, now)
+	}
+
+	if r.p.maxDelay == 0 {
+		return r.delay, true
+	}
+
+	if now.Sub(start) > r.p.maxDelay {
+		r.delay = r.p.delay
+	}
+	d := r.delay
+	r.delay = min(r.delay*DEFAULT_BACKOFF_FACTOR, r.p.maxDelay)
+	return d, true
+}
@@ -0,0 +1,213 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/log"
+)
+
+var (
+	ErrWorkerExists = errors.New("worker already exists")
+	ErrStopTimeout  = errors.New("workers did not stop in time")
+)
+
+type State uint8
+
+const (
+	StateIdle State = iota
+	StateRunning
+	StateRestarting
+	StateStopped
+	StateFailed // gave up after hitting its restart limit
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRunning:
+		return "running"
+	case StateRestarting:
+		return "restarting"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+type WorkerFunc func(ctx context.Context)
+
+// Status is a snapshot of a worker's health
+type Status struct {
+	Name      string
+	State     State
+	Panics    int
+	LastPanic any
+	Since     time.Time // when State was entered
+}
+
+type worker struct {
+	name string
+	fn   WorkerFunc
+	opts []nopanic.Option
+
+	status Status
+}
+
+// Supervisor owns a set of named long-running workers,
+// restarts them through nopanic and stops them together.
+//
+//	s := supervisor.New()
+//	s.Add("heartbeat", conn.heartbeat, nopanic.WithBackoff(time.Second, time.Minute))
+//	s.Start(ctx)
+//	defer s.Stop(context.Background())
+type Supervisor struct {
+	mu      sync.Mutex
+	workers map[string]*worker
+	ctx     context.Context // nil until Start
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func New() *Supervisor {
+	return &Supervisor{
+		workers: make(map[string]*worker),
+	}
+}
+
+// Add registers a worker, restarted with opts whenever it panics.
+// Workers added after Start are started right away.
+func (s *Supervisor) Add(name string, fn WorkerFunc, opts ...nopanic.Option) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workers[name]; ok {
+		return fmt.Errorf("%w: %s", ErrWorkerExists, name)
+	}
+
+	w := &worker{
+		name:   name,
+		fn:     fn,
+		opts:   opts,
+		status: Status{Name: name, State: StateIdle, Since: time.Now()},
+	}
+	s.workers[name] = w
+	if s.ctx != nil {
+		s.start(w)
+	}
+	return nil
+}
+
+// Start starts every worker. They stop when ctx is done or Stop is called.
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx != nil {
+		return
+	}
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, w := range s.workers {
+		s.start(w)
+	}
+}
+
+// Ensure that the caller holds the lock
+func (s *Supervisor) start(w *worker) {
+	opts := append([]nopanic.Option{
+		nopanic.OnPanic(func(p nopanic.Panic) {
+			s.update(w, func(st *Status) {
+				st.State = StateRestarting
+				st.Panics++
+				st.LastPanic = p.Value
+			})
+		}),
+		nopanic.OnGiveUp(func(name string, r any) {
+			s.update(w, func(st *Status) { st.State = StateFailed })
+		}),
+	}, w.opts...)
+
+	ctx := s.ctx
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		nopanic.NoPanicReRunVoidCtx(ctx, w.name, func(ctx context.Context) {
+			s.update(w, func(st *Status) { st.State = StateRunning })
+			w.fn(ctx)
+		}, opts...)
+
+		s.update(w, func(st *Status) {
+			if st.State != StateFailed {
+				st.State = StateStopped
+			}
+		})
+		log.Debug().
+			WithMeta("scope", "supervisor").
+			Msgf("worker %s exited", w.name).Send()
+	}()
+}
+
+func (s *Supervisor) update(w *worker, fn func(st *Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := w.status.State
+	fn(&w.status)
+	if w.status.State != prev {
+		w.status.Since = time.Now()
+	}
+}
+
+// Health returns the status of every worker, sorted by name
+func (s *Supervisor) Health() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Status, 0, len(s.workers))
+	for _, w := range s.workers {
+		out = append(out, w.status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Healthy reports whether no worker has given up
+func (s *Supervisor) Healthy() bool {
+	for _, st := range s.Health() {
+		if st.State == StateFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop cancels every worker and waits for them to return
+// or for ctx to be done
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Join(ErrStopTimeout, ctx.Err())
+	}
+}
@@ -0,0 +1,36 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisor(t *testing.T) {
+	s := New()
+
+	assert.NoError(t, s.Add("loop", func(ctx context.Context) { <-ctx.Done() }))
+	assert.ErrorIs(t, s.Add("loop", func(ctx context.Context) {}), ErrWorkerExists)
+	assert.NoError(t, s.Add("broken", func(ctx context.Context) { panic("boom") },
+		nopanic.WithDelay(time.Millisecond),
+		nopanic.WithMaxRestarts(2, time.Minute),
+	))
+
+	s.Start(context.Background())
+	assert.Eventually(t, func() bool { return !s.Healthy() }, 5*time.Second, 5*time.Millisecond)
+
+	health := s.Health()
+	assert.Equal(t, "broken", health[0].Name)
+	assert.Equal(t, StateFailed, health[0].State)
+	assert.Equal(t, 3, health[0].Panics)
+	assert.Equal(t, "boom", health[0].LastPanic)
+	assert.Equal(t, StateRunning, health[1].State)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Stop(ctx))
+	assert.Equal(t, StateStopped, s.Health()[1].State)
+}
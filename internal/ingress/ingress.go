@@ -0,0 +1,251 @@
+package ingress
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/ports"
+	"github.com/lattesec/log"
+)
+
+const DEFAULT_DIAL_TIMEOUT = 5 * time.Second
+
+// Ingress proxies public endpoints to instances
+type Ingress struct {
+	ports       *ports.Allocator // public ports of tcp routes
+	DialTimeout time.Duration
+	// Called on every proxied connection and request, e.g. to
+	// postpone an instance's idle timeout. Optional.
+	Activity func(instance string)
+
+	mu        sync.RWMutex
+	byHost    map[string]Route        // http routes
+	tcp       map[string]*tcpListener // route id -> listener
+	tcpRoutes map[string]Route        // route id -> route
+}
+
+type tcpListener struct {
+	l       net.Listener
+	backend atomicString
+}
+
+type atomicString struct {
+	mu sync.RWMutex
+	s  string
+}
+
+func (a *atomicString) Load() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.s
+}
+
+func (a *atomicString) Store(s string) {
+	a.mu.Lock()
+	a.s = s
+	a.mu.Unlock()
+}
+
+// New creates an ingress allocating the public ports of tcp routes
+// from alloc
+func New(alloc *ports.Allocator) *Ingress {
+	return &Ingress{
+		ports:       alloc,
+		DialTimeout: DEFAULT_DIAL_TIMEOUT,
+		byHost:      make(map[string]Route),
+		tcp:         make(map[string]*tcpListener),
+		tcpRoutes:   make(map[string]Route),
+	}
+}
+
+// Apply makes routes the routes served. TCP routes that already
+// exist keep their public port, even if their backend changed.
+func (in *Ingress) Apply(routes []Route) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	byHost := make(map[string]Route)
+	wanted := make(map[string]bool)
+	var errs []error
+	for _, r := range routes {
+		if r.Protocol == PROTOCOL_HTTP {
+			byHost[strings.ToLower(r.Host)] = r
+			continue
+		}
+
+		wanted[r.id()] = true
+		if tl, ok := in.tcp[r.id()]; ok {
+			r.Port = in.tcpRoutes[r.id()].Port
+			tl.backend.Store(r.Backend)
+			in.tcpRoutes[r.id()] = r
+			continue
+		}
+		if err := in.listen(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for id, tl := range in.tcp {
+		if wanted[id] {
+			continue
+		}
+		route := in.tcpRoutes[id]
+		_ = tl.l.Close()
+		delete(in.tcp, id)
+		delete(in.tcpRoutes, id)
+		if err := in.ports.Release(route.id()); err != nil {
+			errs = append(errs, err)
+		}
+		log.Info().
+			WithMeta("scope", "ingress").
+			WithMeta("instance", route.Instance).
+			Msgf("removed route %s", route).Send()
+	}
+	in.byHost = byHost
+	return errors.Join(errs...)
+}
+
+// listen opens a public port for r, the caller holds the lock
+func (in *Ingress) listen(r Route) error {
+	port, err := in.ports.Allocate(r.id(), ports.PROTOCOL_TCP)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		_ = in.ports.Release(r.id())
+		return err
+	}
+	r.Port = port
+	tl := &tcpListener{l: l}
+	tl.backend.Store(r.Backend)
+	in.tcp[r.id()] = tl
+	in.tcpRoutes[r.id()] = r
+	go in.serveTCP(r.Instance, tl)
+
+	log.Info().
+		WithMeta("scope", "ingress").
+		WithMeta("instance", r.Instance).
+		Msgf("added route %s -> %s", r, r.Backend).Send()
+	return nil
+}
+
+func (in *Ingress) serveTCP(instance string, tl *tcpListener) {
+	for {
+		conn, err := tl.l.Accept()
+		if err != nil {
+			return // closed
+		}
+		if in.Activity != nil {
+			in.Activity(instance)
+		}
+		go in.pipe(conn, tl.backend.Load())
+	}
+}
+
+func (in *Ingress) pipe(conn net.Conn, backend string) {
+	defer conn.Close()
+	upstream, err := net.DialTimeout("tcp", backend, in.DialTimeout)
+	if err != nil {
+		log.Warn().WithMeta("scope", "ingress").Msgf("failed to reach %s: %v", backend, err).Send()
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		if tc, ok := dst.(*net.TCPConn); ok {
+			_ = tc.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go cp(upstream, conn)
+	go cp(conn, upstream)
+	<-done
+	<-done
+}
+
+// Routes returns the routes served, sorted by public endpoint
+func (in *Ingress) Routes() []Route {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	out := make([]Route, 0, len(in.byHost)+len(in.tcpRoutes))
+	for _, r := range in.byHost {
+		out = append(out, r)
+	}
+	for _, r := range in.tcpRoutes {
+		out = append(out, r)
+	}
+	slices.SortFunc(out, func(a, b Route) int { return strings.Compare(a.String(), b.String()) })
+	return out
+}
+
+// Endpoints returns the routes of instance
+func (in *Ingress) Endpoints(instance string) []Route {
+	var out []Route
+	for _, r := range in.Routes() {
+		if r.Instance == instance {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// ServeHTTP proxies requests to the http route of their host
+func (in *Ingress) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	in.mu.RLock()
+	r, ok := in.byHost[strings.ToLower(host)]
+	in.mu.RUnlock()
+	if !ok {
+		http.Error(w, "no such instance", http.StatusNotFound)
+		return
+	}
+	if in.Activity != nil {
+		in.Activity(r.Instance)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(&url.URL{Scheme: "http", Host: r.Backend})
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			log.Warn().WithMeta("scope", "ingress").Msgf("failed to reach %s: %v", r.Backend, err).Send()
+			http.Error(w, "instance unreachable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
+
+// Watch applies the routes returned by desired every interval,
+// until ctx is done, then closes every tcp route
+func (in *Ingress) Watch(ctx context.Context, interval time.Duration, desired func() []Route) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := in.Apply(desired()); err != nil {
+			log.Error().WithMeta("scope", "ingress").Msgf("failed to apply some routes: %v", err).Send()
+		}
+		select {
+		case <-ctx.Done():
+			_ = in.Apply(nil)
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ingress
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/ports"
+	"github.com/lattesec/ctfjx/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDesired(t *testing.T) {
+	placements := []scheduler.Placement{
+		{
+			Request: scheduler.Request{Name: "web1-team42", Spec: container.Spec{
+				Labels: map[string]string{LABEL_HTTP_PORTS: HTTPPorts([]int{80, 8080})},
+			}},
+			Agent: "a",
+			Container: container.Info{Ports: []container.Port{
+				{Container: 80, Host: 30001, Protocol: "tcp"},
+				{Container: 8080, Host: 30002, Protocol: "tcp"},
+				{Container: 1337, Host: 30003, Protocol: "tcp"},
+				{Container: 53, Host: 30004, Protocol: "udp"},
+			}},
+		},
+		{Request: scheduler.Request{Name: "gone"}, Agent: "unknown"},
+	}
+	hosts := map[string]string{"a": "10.0.0.5"}
+
+	routes := Desired("ctf.example", placements, func(agent string) string { return hosts[agent] })
+	require.Len(t, routes, 3)
+	assert.Equal(t, Route{Instance: "web1-team42", Protocol: PROTOCOL_HTTP, Host: "web1-team42.ctf.example", ContainerPort: 80, Backend: "10.0.0.5:30001"}, routes[0])
+	assert.Equal(t, "web1-team42-8080.ctf.example", routes[1].Host)
+	assert.Equal(t, PROTOCOL_TCP, routes[2].Protocol)
+	assert.Equal(t, "10.0.0.5:30003", routes[2].Backend)
+}
+
+func TestHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host+r.URL.Path)
+	}))
+	defer backend.Close()
+
+	alloc, err := ports.New("", []ports.Range{{From: 41000, To: 41100}})
+	require.NoError(t, err)
+	in := New(alloc)
+	var active []string
+	in.Activity = func(instance string) { active = append(active, instance) }
+	require.NoError(t, in.Apply([]Route{{Instance: "web1-team42", Protocol: PROTOCOL_HTTP, Host: "Web1-Team42.ctf.example", Backend: backend.Listener.Addr().String()}}))
+
+	srv := httptest.NewServer(in)
+	defer srv.Close()
+	get := func(host string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/flag", nil)
+		require.NoError(t, err)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get("web1-team42.ctf.example:8080")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "web1-team42.ctf.example:8080/flag", body)
+	assert.Equal(t, []string{"web1-team42"}, active)
+
+	code, _ = get("other.ctf.example")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	require.NoError(t, in.Apply(nil))
+	code, _ = get("web1-team42.ctf.example")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// echo serves one line back prefixed with name
+func echo(t *testing.T, name string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 64)
+				n, _ := conn.Read(buf)
+				_, _ = conn.Write(append([]byte(name+":"), buf[:n]...))
+			}()
+		}
+	}()
+	return l
+}
+
+func TestTCP(t *testing.T) {
+	a, b := echo(t, "a"), echo(t, "b")
+	defer a.Close()
+	defer b.Close()
+
+	alloc, err := ports.New("", []ports.Range{{From: 41000, To: 41100}})
+	require.NoError(t, err)
+	in := New(alloc)
+	defer func() { _ = in.Apply(nil) }()
+
+	route := Route{Instance: "pwn1-team42", Protocol: PROTOCOL_TCP, Host: "pwn1-team42.ctf.example", ContainerPort: 1337, Backend: a.Addr().String()}
+	require.NoError(t, in.Apply([]Route{route}))
+	routes := in.Endpoints("pwn1-team42")
+	require.Len(t, routes, 1)
+	port := routes[0].Port
+	assert.NotZero(t, port)
+	assert.Equal(t, "pwn1-team42.ctf.example:"+strconv.Itoa(port), routes[0].String())
+
+	dial := func() string {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("hi"))
+		require.NoError(t, err)
+		out, _ := io.ReadAll(conn)
+		return string(out)
+	}
+	assert.Equal(t, "a:hi", dial())
+
+	// the instance moved, its public port stays
+	route.Backend = b.Addr().String()
+	require.NoError(t, in.Apply([]Route{route}))
+	assert.Equal(t, port, in.Endpoints("pwn1-team42")[0].Port)
+	assert.Equal(t, "b:hi", dial())
+
+	require.NoError(t, in.Apply(nil))
+	assert.Empty(t, in.Routes())
+	assert.Empty(t, alloc.List())
+	_, err = net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+// Ingress package gives instances stable public endpoints, e.g.
+//
+//	http://web1-team42.ctf.example -> 10.0.0.5:31012
+//	web1-team42.ctf.example:40001  -> 10.0.0.7:30044
+//
+// HTTP routes are told apart by host name on a shared listener,
+// TCP routes get a public port each, kept for as long as the route
+// exists. Routes follow the scheduler's placements, so they move
+// with instances that are rescheduled.
+package ingress
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/scheduler"
+)
+
+const (
+	// Container label listing the container ports that speak http,
+	// comma separated. Others are proxied as tcp.
+	LABEL_HTTP_PORTS = "ctfjx.http-ports"
+
+	PROTOCOL_HTTP = "http"
+	PROTOCOL_TCP  = "tcp"
+)
+
+// Route maps a public endpoint to an instance's port on its agent
+type Route struct {
+	Instance      string `json:"instance"`
+	Protocol      string `json:"protocol"` // http or tcp
+	Host          string `json:"host"`     // public host name
+	Port          int    `json:"port"`     // public port of tcp routes, set by the ingress
+	ContainerPort int    `json:"container_port"`
+	Backend       string `json:"backend"` // agent host:port
+}
+
+// String formats the public endpoint of r
+func (r Route) String() string {
+	if r.Protocol == PROTOCOL_HTTP {
+		return "http://" + r.Host
+	}
+	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+}
+
+// id identifies a route across updates
+func (r Route) id() string {
+	return r.Instance + "/" + strconv.Itoa(r.ContainerPort)
+}
+
+// HTTPPorts formats ports as the value of LABEL_HTTP_PORTS
+func HTTPPorts(ports []int) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ",")
+}
+
+// Desired returns the routes of placements under domain. The first
+// http port of an instance is served at <instance>.<domain>, others
+// at <instance>-<port>.<domain>. hostOf returns the host an agent's
+// published ports are reached at.
+func Desired(domain string, placements []scheduler.Placement, hostOf func(agent string) string) []Route {
+	var out []Route
+	for _, p := range placements {
+		backendHost := hostOf(p.Agent)
+		if backendHost == "" {
+			continue
+		}
+		var httpPorts []int
+		for _, s := range strings.Split(p.Spec.Labels[LABEL_HTTP_PORTS], ",") {
+			if port, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+				httpPorts = append(httpPorts, port)
+			}
+		}
+
+		httpSeen := false
+		for _, published := range p.Container.Ports {
+			if published.Protocol != "" && published.Protocol != PROTOCOL_TCP {
+				continue // udp is not proxied
+			}
+			r := Route{
+				Instance:      p.Name,
+				Protocol:      PROTOCOL_TCP,
+				Host:          p.Name + "." + domain,
+				ContainerPort: published.Container,
+				Backend:       net.JoinHostPort(backendHost, strconv.Itoa(published.Host)),
+			}
+			if slices.Contains(httpPorts, published.Container) {
+				r.Protocol = PROTOCOL_HTTP
+				if httpSeen {
+					r.Host = p.Name + "-" + strconv.Itoa(published.Container) + "." + domain
+				}
+				httpSeen = true
+			}
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// AgentHosts returns the hostOf of Desired, reaching agents at the
+// host of the address they connected from
+func AgentHosts(reg *registry.Registry) func(agent string) string {
+	return func(agent string) string {
+		a, err := reg.Get(agent)
+		if err != nil {
+			return ""
+		}
+		if h, _, err := net.SplitHostPort(a.Address); err == nil {
+			return h
+		}
+		return a.Address
+	}
+}
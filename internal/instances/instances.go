@@ -0,0 +1,609 @@
+// Instances package runs private challenge instances for teams.
+//
+// A team requests an instance of a challenge deployed per team, gets
+// the endpoints to connect to, and may extend, reset or destroy it.
+// Instances are destroyed once their TTL runs out or, with an idle
+// timeout, once they have not been used for that long. A Quota keeps
+// a team from starving the agents with its instances.
+package instances
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/build"
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/health"
+	"github.com/lattesec/ctfjx/internal/helpers/keylock"
+	"github.com/lattesec/ctfjx/internal/ingress"
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/scheduler"
+	"github.com/lattesec/ctfjx/internal/store"
+	"github.com/lattesec/log"
+)
+
+const (
+	DEFAULT_TTL          = time.Hour
+	DEFAULT_EXTEND_BY    = 30 * time.Minute
+	DEFAULT_MAX_LIFETIME = 4 * time.Hour
+	DEFAULT_REAP_EVERY   = 30 * time.Second
+
+	// Label of instance containers, with the team's id
+	LABEL_TEAM = "ctfjx.team"
+	// Agent label with the host players reach its instances at,
+	// the host of the agent's address otherwise
+	LABEL_PUBLIC_HOST = "ctfjx.io/public-host"
+)
+
+var (
+	ErrNotFound        = errors.New("instance not found")
+	ErrNotOnDemand     = errors.New("challenge has no per-team instances")
+	ErrUnknown         = errors.New("challenge is not built")
+	ErrMaxLifetime     = errors.New("instance reached its maximum lifetime")
+	ErrUnsupportedKind = errors.New("deployment kind not supported for instances")
+	ErrNoFlags         = errors.New("no flag generator for dynamic flags")
+	ErrStaticFlag      = errors.New("challenge has no dynamic flag")
+	ErrNotOwned        = errors.New("instance belongs to another team")
+)
+
+// Options tune the lifetime of instances, zero values use the defaults
+type Options struct {
+	TTL         time.Duration // lifetime of a new instance
+	ExtendBy    time.Duration // added to the lifetime by Extend
+	MaxLifetime time.Duration // Extend never goes past this since creation
+	IdleTimeout time.Duration // destroy instances unused for this long, 0 never does
+	Quota       Quota         // of every team
+}
+
+// Endpoint is where players connect to an instance
+type Endpoint struct {
+	Name     string `json:"name,omitempty"`
+	Protocol string `json:"protocol"` // tcp, udp or http
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Target   int    `json:"target"` // the port in the container
+}
+
+// String formats e as a URL for http, host:port otherwise
+func (e Endpoint) String() string {
+	hostport := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	if e.Protocol == challenge.PROTOCOL_HTTP {
+		return "http://" + hostport
+	}
+	return hostport
+}
+
+// Instance is a team's private instance of a challenge
+type Instance struct {
+	Id         string     `json:"id"` // also its container's name
+	Challenge  string     `json:"challenge"`
+	Team       string     `json:"team"`
+	Version    string     `json:"version"` // of the challenge's build
+	Agent      string     `json:"agent"`
+	Endpoints  []Endpoint `json:"endpoints"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastActive time.Time  `json:"last_active"`
+	Nonce      string     `json:"nonce"` // tells instances apart for per-instance flags
+	// Limits of its container, counted against its team's quota
+	Limits container.Limits `json:"limits"`
+}
+
+// Placer places containers on agents, see scheduler.Scheduler
+type Placer interface {
+	Schedule(ctx context.Context, req scheduler.Request) (scheduler.Placement, error)
+	Remove(ctx context.Context, name string) error
+}
+
+var _ Placer = (*scheduler.Scheduler)(nil)
+
+// Manager creates, tracks and reaps instances
+type Manager struct {
+	placer     Placer
+	challenges *challenge.Registry
+	agents     *registry.Registry
+	instances  *store.Collection[Instance]
+	opts       Options
+	now        func() time.Time
+
+	// Derives the flags of challenges with dynamic flags, which
+	// cannot be instanced if nil
+	Flags *flags.Generator
+
+	// Serializes the changes of an instance, so a team never gets two
+	// instances of a challenge, without holding up other instances
+	// while containers are placed
+	locks keylock.Map // by instance id
+
+	mu      sync.Mutex
+	pending map[string]Instance // being placed, counted against quotas
+}
+
+// New creates a manager with its instances persisted at path,
+// memory-only if empty
+func New(placer Placer, challenges *challenge.Registry, agents *registry.Registry, path string, opts Options) (*Manager, error) {
+	instances, err := store.Open[Instance](path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TTL == 0 {
+		opts.TTL = DEFAULT_TTL
+	}
+	if opts.ExtendBy == 0 {
+		opts.ExtendBy = DEFAULT_EXTEND_BY
+	}
+	if opts.MaxLifetime == 0 {
+		opts.MaxLifetime = DEFAULT_MAX_LIFETIME
+	}
+	return &Manager{
+		placer:     placer,
+		challenges: challenges,
+		agents:     agents,
+		instances:  instances,
+		opts:       opts,
+		now:        func() time.Time { return time.Now().UTC() },
+		pending:    make(map[string]Instance),
+	}, nil
+}
+
+var unsafeRe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Longest slug of a team in the id of its instances
+const MAX_TEAM_SLUG = 24
+
+// InstanceId names the instance of team for challengeId: a slug of
+// team, for humans, and a hash of both, since slugs of different pairs
+// may read the same
+func InstanceId(challengeId, team string) string {
+	slug := strings.Trim(unsafeRe.ReplaceAllString(strings.ToLower(team), "-"), "-")
+	if len(slug) > MAX_TEAM_SLUG {
+		slug = strings.TrimRight(slug[:MAX_TEAM_SLUG], "-")
+	}
+	sum := sha256.Sum256([]byte(challengeId + "\x00" + team))
+	hash := hex.EncodeToString(sum[:8])
+	if slug == "" {
+		return challengeId + "-" + hash
+	}
+	return challengeId + "-" + slug + "-" + hash
+}
+
+// owned checks that inst, found under the id of challengeId and team,
+// is theirs
+func owned(inst Instance, challengeId, team string) error {
+	if inst.Challenge != challengeId || inst.Team != team {
+		return fmt.Errorf("%w: %s", ErrNotOwned, inst.Id)
+	}
+	return nil
+}
+
+// Request returns the instance of team for challengeId,
+// deploying it if the team has none
+func (m *Manager) Request(ctx context.Context, challengeId, team string) (Instance, error) {
+	id := InstanceId(challengeId, team)
+	unlock := m.locks.Lock(id)
+	defer unlock()
+
+	if inst, ok := m.instances.Get(id); ok {
+		return inst, owned(inst, challengeId, team)
+	}
+
+	b, ok := m.challenges.Get(challengeId)
+	if !ok {
+		return Instance{}, fmt.Errorf("%w: %s", ErrUnknown, challengeId)
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return Instance{}, err
+	}
+	now := m.now()
+	inst := Instance{
+		Id:         id,
+		Challenge:  challengeId,
+		Team:       team,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(m.opts.TTL),
+		LastActive: now,
+		Nonce:      hex.EncodeToString(nonce),
+	}
+	if err := m.reserve(inst, b); err != nil {
+		return Instance{}, err
+	}
+	defer m.unreserve(id)
+
+	placement, err := m.place(ctx, inst, b)
+	if err != nil {
+		return Instance{}, err
+	}
+	inst.Version, inst.Agent = b.Version, placement.Agent
+	inst.Endpoints = m.endpoints(b, placement)
+	inst.Limits = b.Challenge.Deploy.Limits.Container()
+	if err := m.instances.Put(id, inst); err != nil {
+		_ = m.placer.Remove(context.WithoutCancel(ctx), id)
+		return Instance{}, err
+	}
+	log.Info().
+		WithMeta("scope", "instances").
+		WithMeta("team", team).
+		WithMeta("instance", id).
+		Msgf("instance started on %s", placement.Agent).Send()
+	return inst, nil
+}
+
+func (m *Manager) place(ctx context.Context, inst Instance, b challenge.Build) (scheduler.Placement, error) {
+	d := b.Challenge.Deploy
+	switch {
+	case d == nil || !d.PerTeam:
+		return scheduler.Placement{}, fmt.Errorf("%w: %s", ErrNotOnDemand, b.Id)
+	case d.Type != challenge.DeployImage:
+		return scheduler.Placement{}, fmt.Errorf("%w: %s", ErrUnsupportedKind, d.Type)
+	}
+
+	spec := container.Spec{
+		Name:    inst.Id,
+		Image:   b.Image,
+		Env:     maps.Clone(d.Env),
+		Labels:  map[string]string{build.LABEL_CHALLENGE: b.Id, LABEL_TEAM: inst.Team},
+		Limits:  d.Limits.Container(),
+		Isolate: d.Isolate,
+	}
+	if f := b.Challenge.Flag; f.Type == challenge.FlagDynamic {
+		flag, err := m.flag(b, inst)
+		if err != nil {
+			return scheduler.Placement{}, err
+		}
+		if spec.Env == nil {
+			spec.Env = make(map[string]string)
+		}
+		spec.Env[f.Env] = flag
+		if f.Path != "" {
+			spec.Files = map[string]string{f.Path: flag + "\n"}
+		}
+	}
+	var httpPorts []int
+	for _, p := range d.Ports {
+		spec.Ports = append(spec.Ports, container.Port{Container: p.Port, Protocol: transport(p.Protocol)})
+		if p.Protocol == challenge.PROTOCOL_HTTP {
+			httpPorts = append(httpPorts, p.Port)
+		}
+	}
+	if len(httpPorts) > 0 {
+		spec.Labels[ingress.LABEL_HTTP_PORTS] = ingress.HTTPPorts(httpPorts)
+	}
+	if h := b.Challenge.Healthcheck; h != nil {
+		spec.Labels[health.LABEL_HEALTHCHECK] = health.FromChallenge(*h).Label()
+	}
+	return m.placer.Schedule(ctx, scheduler.Request{
+		Name:      inst.Id,
+		Challenge: b.Id,
+		Spec:      spec,
+		Selector:  d.Selector,
+	})
+}
+
+// transport is the protocol a port is published with
+func transport(protocol string) string {
+	if protocol == challenge.PROTOCOL_HTTP {
+		return challenge.PROTOCOL_TCP
+	}
+	return protocol
+}
+
+// endpoints maps the declared ports of b to where p published them
+func (m *Manager) endpoints(b challenge.Build, p scheduler.Placement) []Endpoint {
+	host := ""
+	if a, err := m.agents.Get(p.Agent); err == nil {
+		host = a.Labels[LABEL_PUBLIC_HOST]
+		if h, _, err := net.SplitHostPort(a.Address); host == "" && err == nil {
+			host = h
+		}
+	}
+
+	var out []Endpoint
+	for _, declared := range b.Challenge.Deploy.Ports {
+		for _, published := range p.Container.Ports {
+			if published.Container != declared.Port || published.Protocol != transport(declared.Protocol) {
+				continue
+			}
+			out = append(out, Endpoint{Name: declared.Name, Protocol: declared.Protocol, Host: host, Port: published.Host, Target: declared.Port})
+			break
+		}
+	}
+	return out
+}
+
+// flag derives the dynamic flag of b for inst
+func (m *Manager) flag(b challenge.Build, inst Instance) (string, error) {
+	if m.Flags == nil {
+		return "", fmt.Errorf("%w: %s", ErrNoFlags, b.Id)
+	}
+	checker, err := m.checker(b)
+	if err != nil {
+		return "", err
+	}
+	return checker.Expected(subject(b, inst))
+}
+
+func (m *Manager) checker(b challenge.Build) (*flags.Checker, error) {
+	spec, err := b.Challenge.FlagSpec()
+	if err != nil {
+		return nil, err
+	}
+	return flags.Compile(b.Id, spec, m.Flags)
+}
+
+// subject is who the dynamic flag of inst is derived for
+func subject(b challenge.Build, inst Instance) string {
+	if b.Challenge.Flag.Per == challenge.FlagPerInstance {
+		return inst.Id + "/" + inst.Nonce
+	}
+	return inst.Team
+}
+
+// current returns the challenge and what the flag of team is derived
+// for, a flag per instance needs the team's instance to be running
+func (m *Manager) current(challengeId, team string) (challenge.Build, string, error) {
+	b, ok := m.challenges.Get(challengeId)
+	if !ok {
+		return challenge.Build{}, "", fmt.Errorf("%w: %s", ErrUnknown, challengeId)
+	}
+	inst := Instance{Id: InstanceId(challengeId, team), Team: team}
+	if b.Challenge.Flag.Type == challenge.FlagDynamic && b.Challenge.Flag.Per == challenge.FlagPerInstance {
+		var err error
+		if inst, err = m.Get(challengeId, team); err != nil {
+			return challenge.Build{}, "", err
+		}
+	}
+	return b, subject(b, inst), nil
+}
+
+// Flag returns the dynamic flag team has for challengeId
+func (m *Manager) Flag(challengeId, team string) (string, error) {
+	b, subj, err := m.current(challengeId, team)
+	if err != nil {
+		return "", err
+	}
+	if b.Challenge.Flag.Type != challenge.FlagDynamic {
+		return "", fmt.Errorf("%w: %s", ErrStaticFlag, challengeId)
+	}
+	checker, err := m.checker(b)
+	if err != nil {
+		return "", err
+	}
+	return checker.Expected(subj)
+}
+
+// CheckFlag tells if submitted is the flag of team for challengeId,
+// whatever its type
+func (m *Manager) CheckFlag(challengeId, team, submitted string) (bool, error) {
+	b, subj, err := m.current(challengeId, team)
+	if err != nil {
+		return false, err
+	}
+	checker, err := m.checker(b)
+	if err != nil {
+		return false, err
+	}
+	return checker.Check(submitted, subj)
+}
+
+// Get returns the instance of team for challengeId
+func (m *Manager) Get(challengeId, team string) (Instance, error) {
+	id := InstanceId(challengeId, team)
+	inst, ok := m.instances.Get(id)
+	if !ok {
+		return Instance{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err := owned(inst, challengeId, team); err != nil {
+		return Instance{}, err
+	}
+	return inst, nil
+}
+
+// List returns the instances of team, every instance if empty
+func (m *Manager) List(team string) []Instance {
+	var out []Instance
+	for _, inst := range m.instances.List() {
+		if team == "" || inst.Team == team {
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// OfChallenge returns the instances of challengeId
+func (m *Manager) OfChallenge(challengeId string) []Instance {
+	var out []Instance
+	for _, inst := range m.instances.List() {
+		if inst.Challenge == challengeId {
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// Extend pushes the expiry of an instance back by ExtendBy,
+// up to MaxLifetime after it was created
+func (m *Manager) Extend(challengeId, team string) (Instance, error) {
+	id := InstanceId(challengeId, team)
+	var out Instance
+	err := m.instances.Update(func(items map[string]Instance) error {
+		inst, ok := items[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		if err := owned(inst, challengeId, team); err != nil {
+			return err
+		}
+		limit := inst.CreatedAt.Add(m.opts.MaxLifetime)
+		if !inst.ExpiresAt.Before(limit) {
+			return fmt.Errorf("%w: %s", ErrMaxLifetime, id)
+		}
+		inst.ExpiresAt = inst.ExpiresAt.Add(m.opts.ExtendBy)
+		if inst.ExpiresAt.After(limit) {
+			inst.ExpiresAt = limit
+		}
+		inst.LastActive = m.now()
+		items[id], out = inst, inst
+		return nil
+	})
+	return out, err
+}
+
+// Touch marks an instance as used now, postponing its idle timeout
+func (m *Manager) Touch(challengeId, team string) error {
+	id := InstanceId(challengeId, team)
+	now := m.now()
+	return m.instances.Update(func(items map[string]Instance) error {
+		inst, ok := items[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		if err := owned(inst, challengeId, team); err != nil {
+			return err
+		}
+		inst.LastActive = now
+		items[id] = inst
+		return nil
+	})
+}
+
+// Reset replaces an instance with a fresh one of the latest build,
+// keeping its expiry
+func (m *Manager) Reset(ctx context.Context, challengeId, team string) (Instance, error) {
+	id := InstanceId(challengeId, team)
+	unlock := m.locks.Lock(id)
+	defer unlock()
+
+	inst, err := m.Get(challengeId, team)
+	if err != nil {
+		return Instance{}, err
+	}
+	b, ok := m.challenges.Get(challengeId)
+	if !ok {
+		return Instance{}, fmt.Errorf("%w: %s", ErrUnknown, challengeId)
+	}
+	// the latest build may need more than the one it replaces
+	if err := m.reserve(inst, b); err != nil {
+		return Instance{}, err
+	}
+	defer m.unreserve(id)
+
+	if err := m.placer.Remove(ctx, id); err != nil && !errors.Is(err, scheduler.ErrNotPlaced) {
+		return Instance{}, err
+	}
+	placement, err := m.place(ctx, inst, b)
+	if err != nil {
+		_ = m.instances.Delete(id) // it is gone
+		return Instance{}, err
+	}
+
+	// keep what Extend and Touch changed meanwhile
+	var out Instance
+	err = m.instances.Update(func(items map[string]Instance) error {
+		inst := items[id]
+		inst.Version, inst.Agent = b.Version, placement.Agent
+		inst.Endpoints = m.endpoints(b, placement)
+		inst.Limits = b.Challenge.Deploy.Limits.Container()
+		inst.LastActive = m.now()
+		items[id], out = inst, inst
+		return nil
+	})
+	return out, err
+}
+
+// Destroy removes an instance
+func (m *Manager) Destroy(ctx context.Context, challengeId, team string) error {
+	id := InstanceId(challengeId, team)
+	unlock := m.locks.Lock(id)
+	defer unlock()
+
+	inst, err := m.Get(challengeId, team)
+	if err != nil {
+		return err
+	}
+	return m.destroy(ctx, inst.Id)
+}
+
+// destroy removes instance id, whose lock the caller holds
+func (m *Manager) destroy(ctx context.Context, id string) error {
+	if _, ok := m.instances.Get(id); !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err := m.placer.Remove(ctx, id); err != nil && !errors.Is(err, scheduler.ErrNotPlaced) {
+		return err
+	}
+	return m.instances.Delete(id)
+}
+
+// Reap destroys the instances that expired or were idle for too long
+// and returns them
+func (m *Manager) Reap(ctx context.Context) ([]Instance, error) {
+	var (
+		reaped []Instance
+		errs   []error
+	)
+	for _, inst := range m.instances.List() {
+		if ok, err := m.reap(ctx, inst.Id); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", inst.Id, err))
+		} else if ok {
+			reaped = append(reaped, inst)
+		}
+	}
+	return reaped, errors.Join(errs...)
+}
+
+// reap destroys instance id if it expired or was idle for too long,
+// as it may have been extended or destroyed since it was listed
+func (m *Manager) reap(ctx context.Context, id string) (bool, error) {
+	unlock := m.locks.Lock(id)
+	defer unlock()
+
+	inst, ok := m.instances.Get(id)
+	if !ok {
+		return false, nil
+	}
+	now := m.now()
+	expired := !now.Before(inst.ExpiresAt)
+	idle := m.opts.IdleTimeout > 0 && now.Sub(inst.LastActive) >= m.opts.IdleTimeout
+	if !expired && !idle {
+		return false, nil
+	}
+	if err := m.destroy(ctx, id); err != nil {
+		return false, err
+	}
+	log.Info().
+		WithMeta("scope", "instances").
+		WithMeta("team", inst.Team).
+		WithMeta("instance", id).
+		Msgf("instance reaped, expired: %t, idle: %t", expired, idle).Send()
+	return true, nil
+}
+
+// Run reaps instances every interval until ctx is done
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if _, err := m.Reap(ctx); err != nil {
+			log.Error().WithMeta("scope", "instances").Msgf("failed to reap instances: %v", err).Send()
+		}
+	}
+}
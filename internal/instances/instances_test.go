@@ -0,0 +1,358 @@
+package instances
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePlacer struct {
+	mu      sync.Mutex
+	placed  map[string]scheduler.Request
+	removed []string
+	port    int
+	slow    chan struct{} // placements of the challenge slow wait for it
+}
+
+func (f *fakePlacer) Schedule(_ context.Context, req scheduler.Request) (scheduler.Placement, error) {
+	if req.Challenge == "slow" {
+		<-f.slow
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.placed[req.Name] = req
+	p := scheduler.Placement{Request: req, Agent: "a", Container: container.Info{Id: "c-" + req.Name}}
+	for _, port := range req.Spec.Ports {
+		f.port++
+		p.Container.Ports = append(p.Container.Ports, container.Port{Container: port.Container, Host: f.port, Protocol: port.Protocol})
+	}
+	return p, nil
+}
+
+func (f *fakePlacer) Remove(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.placed[name]; !ok {
+		return scheduler.ErrNotPlaced
+	}
+	delete(f.placed, name)
+	f.removed = append(f.removed, name)
+	return nil
+}
+
+func newTestManager(t *testing.T, opts Options) (*Manager, *fakePlacer, *time.Time) {
+	challenges, err := challenge.OpenRegistry("")
+	require.NoError(t, err)
+	require.NoError(t, challenges.Put(challenge.Build{
+		Id:      "notes",
+		Version: "v1",
+		Image:   "ctfjx/notes:abc",
+		Challenge: challenge.Challenge{Id: "notes", Flag: challenge.Flag{Type: challenge.FlagStatic, Value: "ctfjx{notes}"}, Deploy: &challenge.Deploy{
+			Type:    challenge.DeployImage,
+			PerTeam: true,
+			Ports: []challenge.Port{
+				{Port: 1337, Protocol: challenge.PROTOCOL_TCP, Name: "shell"},
+				{Port: 80, Protocol: challenge.PROTOCOL_HTTP},
+			},
+		}},
+	}))
+	require.NoError(t, challenges.Put(challenge.Build{Id: "shared", Challenge: challenge.Challenge{Deploy: &challenge.Deploy{Type: challenge.DeployImage}}}))
+
+	agents, err := registry.New("")
+	require.NoError(t, err)
+	require.NoError(t, agents.Register(registry.Agent{Id: "a", Address: "10.0.0.5:41234", Labels: labels.Labels{LABEL_PUBLIC_HOST: "a.ctf.example"}}))
+
+	placer := &fakePlacer{placed: make(map[string]scheduler.Request), port: 30000, slow: make(chan struct{})}
+	m, err := New(placer, challenges, agents, "", opts)
+	require.NoError(t, err)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	return m, placer, &now
+}
+
+func TestInstances(t *testing.T) {
+	m, placer, now := newTestManager(t, Options{TTL: time.Hour, ExtendBy: 30 * time.Minute, MaxLifetime: 105 * time.Minute})
+	ctx := context.Background()
+
+	inst, err := m.Request(ctx, "notes", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, InstanceId("notes", "team42"), inst.Id)
+	assert.Equal(t, "v1", inst.Version)
+	assert.Equal(t, now.Add(time.Hour), inst.ExpiresAt)
+	require.Len(t, inst.Endpoints, 2)
+	assert.Equal(t, "a.ctf.example:30001", inst.Endpoints[0].String())
+	assert.Equal(t, "shell", inst.Endpoints[0].Name)
+	assert.Equal(t, "http://a.ctf.example:30002", inst.Endpoints[1].String())
+
+	req := placer.placed[inst.Id]
+	assert.Equal(t, "team42", req.Spec.Labels[LABEL_TEAM])
+	assert.Equal(t, []container.Port{{Container: 1337, Protocol: "tcp"}, {Container: 80, Protocol: "tcp"}}, req.Spec.Ports)
+
+	again, err := m.Request(ctx, "notes", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, inst, again, "a team has one instance per challenge")
+	assert.Len(t, placer.placed, 1)
+
+	_, err = m.Request(ctx, "shared", "team42")
+	assert.ErrorIs(t, err, ErrNotOnDemand)
+	_, err = m.Request(ctx, "nope", "team42")
+	assert.ErrorIs(t, err, ErrUnknown)
+
+	// Extending stops at the maximum lifetime
+	inst, err = m.Extend("notes", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(90*time.Minute), inst.ExpiresAt)
+	inst, err = m.Extend("notes", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(105*time.Minute), inst.ExpiresAt)
+	_, err = m.Extend("notes", "team42")
+	assert.ErrorIs(t, err, ErrMaxLifetime)
+
+	// Resetting redeploys and keeps the expiry
+	reset, err := m.Reset(ctx, "notes", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, []string{InstanceId("notes", "team42")}, placer.removed)
+	assert.Equal(t, inst.ExpiresAt, reset.ExpiresAt)
+	assert.NotEqual(t, inst.Endpoints, reset.Endpoints)
+
+	_, err = m.Request(ctx, "notes", "Team Rocket")
+	require.NoError(t, err)
+	assert.Len(t, m.List(""), 2)
+	assert.Len(t, m.List("Team Rocket"), 1)
+
+	require.NoError(t, m.Destroy(ctx, "notes", "Team Rocket"))
+	assert.ErrorIs(t, m.Destroy(ctx, "notes", "Team Rocket"), ErrNotFound)
+	_, err = m.Get("notes", "Team Rocket")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	*now = now.Add(2 * time.Hour)
+	reaped, err := m.Reap(ctx)
+	require.NoError(t, err)
+	require.Len(t, reaped, 1)
+	assert.Empty(t, m.List(""))
+	assert.Empty(t, placer.placed)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	m, _, now := newTestManager(t, Options{IdleTimeout: 10 * time.Minute})
+	ctx := context.Background()
+
+	for _, team := range []string{"a", "b"} {
+		_, err := m.Request(ctx, "notes", team)
+		require.NoError(t, err)
+	}
+	*now = now.Add(5 * time.Minute)
+	require.NoError(t, m.Touch("notes", "a"))
+	*now = now.Add(6 * time.Minute)
+
+	reaped, err := m.Reap(ctx)
+	require.NoError(t, err)
+	require.Len(t, reaped, 1)
+	assert.Equal(t, "b", reaped[0].Team)
+	_, err = m.Get("notes", "a")
+	assert.NoError(t, err)
+}
+
+func TestSlowPlacement(t *testing.T) {
+	m, placer, _ := newTestManager(t, Options{Quota: Quota{Instances: 2}})
+	ctx := context.Background()
+	notes, _ := m.challenges.Get("notes")
+	slow := notes
+	slow.Id, slow.Challenge.Id = "slow", "slow"
+	require.NoError(t, m.challenges.Put(slow))
+	require.NoError(t, m.challenges.Put(challenge.Build{Id: "other", Challenge: challenge.Challenge{Id: "other", Deploy: notes.Challenge.Deploy}}))
+
+	done := make(chan error)
+	go func() {
+		_, err := m.Request(ctx, "slow", "team42")
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return m.Usage("team42").Instances == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, err := m.Request(ctx, "notes", "team7")
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "other teams are placed meanwhile")
+	_, err := m.Reap(ctx)
+	assert.NoError(t, err)
+	_, err = m.Request(ctx, "notes", "team42")
+	require.NoError(t, err, "so are other challenges of the team")
+	_, err = m.Request(ctx, "other", "team42")
+	assert.ErrorIs(t, err, ErrQuotaExceeded, "instances being placed count against the quota")
+
+	close(placer.slow)
+	require.NoError(t, <-done)
+	inst, err := m.Get("slow", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, "a", inst.Agent)
+	assert.Equal(t, Usage{Instances: 2}, m.Usage("team42"))
+}
+
+func TestInstanceId(t *testing.T) {
+	assert.Regexp(t, `^web-team42-[0-9a-f]{16}$`, InstanceId("web", "team42"))
+	assert.Regexp(t, `^web-team-rocket-[0-9a-f]{16}$`, InstanceId("web", "Team Rocket"))
+	assert.Regexp(t, `^web-[0-9a-f]{16}$`, InstanceId("web", "!!!"))
+	assert.Regexp(t, `^web-a{24}-[0-9a-f]{16}$`, InstanceId("web", strings.Repeat("a", 100)))
+	assert.NotEqual(t, InstanceId("web", "Team Rocket"), InstanceId("web", "team rocket"))
+	assert.NotEqual(t, InstanceId("web", "1-foo"), InstanceId("web-1", "foo"), "slugs read the same")
+}
+
+func TestNotOwned(t *testing.T) {
+	m, placer, _ := newTestManager(t, Options{})
+	ctx := context.Background()
+
+	theirs, err := m.Request(ctx, "notes", "a")
+	require.NoError(t, err)
+	// a stored instance that is not the team's, under the team's id
+	require.NoError(t, m.instances.Put(InstanceId("notes", "b"), theirs))
+
+	_, err = m.Request(ctx, "notes", "b")
+	assert.ErrorIs(t, err, ErrNotOwned)
+	_, err = m.Get("notes", "b")
+	assert.ErrorIs(t, err, ErrNotOwned)
+	_, err = m.Extend("notes", "b")
+	assert.ErrorIs(t, err, ErrNotOwned)
+	assert.ErrorIs(t, m.Touch("notes", "b"), ErrNotOwned)
+	_, err = m.Reset(ctx, "notes", "b")
+	assert.ErrorIs(t, err, ErrNotOwned)
+	assert.ErrorIs(t, m.Destroy(ctx, "notes", "b"), ErrNotOwned)
+	assert.Contains(t, placer.placed, theirs.Id, "the instance of a is untouched")
+	assert.Empty(t, placer.removed)
+}
+
+func TestDynamicFlags(t *testing.T) {
+	m, placer, _ := newTestManager(t, Options{})
+	ctx := context.Background()
+	dynamic := func(id string, per challenge.FlagScope) {
+		require.NoError(t, m.challenges.Put(challenge.Build{
+			Id:    id,
+			Image: "ctfjx/" + id,
+			Challenge: challenge.Challenge{
+				Id:     id,
+				Flag:   challenge.Flag{Type: challenge.FlagDynamic, Value: "ctfjx{heap_{{hmac}}}", Per: per, Env: "FLAG", Path: "/flag.txt"},
+				Deploy: &challenge.Deploy{Type: challenge.DeployImage, PerTeam: true, Env: map[string]string{"MODE": "prod"}},
+			},
+		}))
+	}
+	dynamic("heap", challenge.FlagPerTeam)
+	dynamic("race", challenge.FlagPerInstance)
+
+	_, err := m.Request(ctx, "heap", "team42")
+	assert.ErrorIs(t, err, ErrNoFlags)
+	m.Flags, err = flags.NewGenerator("0123456789abcdef")
+	require.NoError(t, err)
+
+	_, err = m.Request(ctx, "heap", "team42")
+	require.NoError(t, err)
+	spec := placer.placed[InstanceId("heap", "team42")].Spec
+	flag := spec.Env["FLAG"]
+	assert.Regexp(t, `^ctfjx\{heap_[0-9a-f]{24}\}$`, flag)
+	assert.Equal(t, "prod", spec.Env["MODE"])
+	assert.Equal(t, map[string]string{"/flag.txt": flag + "\n"}, spec.Files)
+	b, _ := m.challenges.Get("heap")
+	assert.NotContains(t, b.Challenge.Deploy.Env, "FLAG", "the challenge's env is not shared")
+
+	ok, err := m.CheckFlag("heap", "team42", " "+flag+"\n")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = m.CheckFlag("heap", "team7", flag)
+	require.NoError(t, err)
+	assert.False(t, ok, "flags are per team")
+	_, err = m.Flag("notes", "team42")
+	assert.ErrorIs(t, err, ErrStaticFlag)
+	ok, err = m.CheckFlag("notes", "team42", "ctfjx{notes}")
+	require.NoError(t, err)
+	assert.True(t, ok, "static flags are checked too")
+
+	// a team flag survives the instance, an instance flag does not
+	require.NoError(t, m.Destroy(ctx, "heap", "team42"))
+	again, err := m.Flag("heap", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, flag, again)
+
+	_, err = m.Flag("race", "team42")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = m.Request(ctx, "race", "team42")
+	require.NoError(t, err)
+	first, err := m.Flag("race", "team42")
+	require.NoError(t, err)
+	_, err = m.Reset(ctx, "race", "team42")
+	require.NoError(t, err)
+	reset, err := m.Flag("race", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, first, reset, "resetting keeps the instance")
+	require.NoError(t, m.Destroy(ctx, "race", "team42"))
+	_, err = m.Request(ctx, "race", "team42")
+	require.NoError(t, err)
+	second, err := m.Flag("race", "team42")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestQuota(t *testing.T) {
+	m, placer, _ := newTestManager(t, Options{Quota: Quota{Instances: 2, CPUs: 2, Memory: 1 << 30}})
+	ctx := context.Background()
+	limited := func(id string, cpus float64, memory env.ByteSize) {
+		require.NoError(t, m.challenges.Put(challenge.Build{
+			Id:    id,
+			Image: "ctfjx/" + id,
+			Challenge: challenge.Challenge{
+				Id:     id,
+				Flag:   challenge.Flag{Type: challenge.FlagStatic, Value: "ctfjx{" + id + "}"},
+				Deploy: &challenge.Deploy{Type: challenge.DeployImage, PerTeam: true, Limits: challenge.Limits{CPUs: cpus, Memory: memory}},
+			},
+		}))
+	}
+	limited("small", 0.5, 256*env.MiB)
+	limited("big", 1.5, 512*env.MiB)
+	limited("huge", 1, 2*env.GiB)
+	limited("tiny", 0.1, 64*env.MiB)
+
+	_, err := m.Request(ctx, "notes", "team42")
+	assert.ErrorIs(t, err, ErrUnlimited, "challenges without limits cannot be counted")
+	_, err = m.Request(ctx, "huge", "team42")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "team team42 uses 0B of 1GiB memory, huge needs 2GiB more")
+
+	_, err = m.Request(ctx, "small", "team42")
+	require.NoError(t, err)
+	_, err = m.Request(ctx, "small", "team42")
+	require.NoError(t, err, "an existing instance is returned as is")
+	_, err = m.Request(ctx, "big", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Instances: 2, CPUs: 2, Memory: 768 << 20}, m.Usage("team42"))
+
+	_, err = m.Request(ctx, "tiny", "team42")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "team team42 already runs 2 of 2 instances, destroy one first")
+	assert.NotContains(t, placer.placed, InstanceId("tiny", "team42"))
+	_, err = m.Request(ctx, "tiny", "team7")
+	require.NoError(t, err, "quotas are per team")
+
+	// resetting replaces an instance, which is not counted twice, but
+	// the new build must fit
+	_, err = m.Reset(ctx, "big", "team42")
+	require.NoError(t, err)
+	limited("big", 2, 512*env.MiB)
+	_, err = m.Reset(ctx, "big", "team42")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "team team42 uses 0.5 of 2 cpus, big needs 2 more")
+	_, err = m.Get("big", "team42")
+	assert.NoError(t, err, "an instance that does not fit is kept")
+
+	require.NoError(t, m.Destroy(ctx, "big", "team42"))
+	_, err = m.Request(ctx, "tiny", "team42")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Instances: 2, CPUs: 0.6, Memory: 320 << 20}, m.Usage("team42"))
+}
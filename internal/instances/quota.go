@@ -0,0 +1,116 @@
+package instances
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/env"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("team quota exceeded")
+	// A challenge without a limit on a resource the quota limits
+	// could use all of it
+	ErrUnlimited = errors.New("challenge sets no limit for the team quota")
+)
+
+// Quota limits what the instances of a team may use at once across
+// all agents, zero values are unlimited
+type Quota struct {
+	Instances int
+	CPUs      float64
+	Memory    int64 // bytes
+}
+
+// Usage is what the instances of a team use
+type Usage struct {
+	Instances int     `json:"instances"`
+	CPUs      float64 `json:"cpus"`
+	Memory    int64   `json:"memory"` // bytes
+}
+
+func (u *Usage) add(l container.Limits) {
+	u.Instances++
+	u.CPUs += l.CPUs
+	u.Memory += l.Memory
+}
+
+// Usage returns what the instances of team use, including those
+// being placed
+func (m *Manager) Usage(team string) Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage(team, "")
+}
+
+// usage is Usage without the instance with id except, the caller
+// holds m.mu
+func (m *Manager) usage(team, except string) Usage {
+	limits := make(map[string]container.Limits)
+	for _, inst := range m.List(team) {
+		limits[inst.Id] = inst.Limits
+	}
+	for id, inst := range m.pending {
+		if inst.Team == team {
+			limits[id] = inst.Limits // a reset replaces its instance
+		}
+	}
+	delete(limits, except)
+
+	var u Usage
+	for _, l := range limits {
+		u.add(l)
+	}
+	return u
+}
+
+// reserve counts inst, to be placed from b, against the quota of its
+// team until unreserve, failing if it does not fit besides the other
+// instances of the team
+func (m *Manager) reserve(inst Instance, b challenge.Build) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkQuota(inst.Team, inst.Id, b); err != nil {
+		return err
+	}
+	if d := b.Challenge.Deploy; d != nil {
+		inst.Limits = d.Limits.Container()
+	}
+	m.pending[inst.Id] = inst
+	return nil
+}
+
+func (m *Manager) unreserve(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pending, id)
+}
+
+// checkQuota tells if team may run an instance of b, besides its
+// instances other than except
+func (m *Manager) checkQuota(team, except string, b challenge.Build) error {
+	if b.Challenge.Deploy == nil {
+		return nil // not instanced at all
+	}
+	q, challengeId, limits := m.opts.Quota, b.Id, b.Challenge.Deploy.Limits.Container()
+	switch {
+	case q.CPUs > 0 && limits.CPUs <= 0:
+		return fmt.Errorf("%w: %s has no cpu limit", ErrUnlimited, challengeId)
+	case q.Memory > 0 && limits.Memory <= 0:
+		return fmt.Errorf("%w: %s has no memory limit", ErrUnlimited, challengeId)
+	}
+
+	u := m.usage(team, except)
+	switch {
+	case q.Instances > 0 && u.Instances+1 > q.Instances:
+		return fmt.Errorf("%w: team %s already runs %d of %d instances, destroy one first", ErrQuotaExceeded, team, u.Instances, q.Instances)
+	case q.CPUs > 0 && u.CPUs+limits.CPUs > q.CPUs:
+		return fmt.Errorf("%w: team %s uses %g of %g cpus, %s needs %g more", ErrQuotaExceeded, team, u.CPUs, q.CPUs, challengeId, limits.CPUs)
+	case q.Memory > 0 && u.Memory+limits.Memory > q.Memory:
+		return fmt.Errorf("%w: team %s uses %s of %s memory, %s needs %s more", ErrQuotaExceeded, team,
+			env.ByteSize(u.Memory), env.ByteSize(q.Memory), challengeId, env.ByteSize(limits.Memory))
+	}
+	return nil
+}
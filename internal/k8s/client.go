@@ -0,0 +1,242 @@
+// K8s package deploys challenges to a Kubernetes cluster,
+// as an alternative to containers hosted by agents.
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/goccy/go-yaml"
+)
+
+const (
+	FIELD_MANAGER = "ctfjx"
+
+	SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+var (
+	ErrNotFound  = errors.New("kubernetes object not found")
+	ErrAPIError  = errors.New("kubernetes api error")
+	ErrNoCluster = errors.New("no kubernetes cluster configured")
+)
+
+// Config is how to reach the API server
+type Config struct {
+	Server     string
+	Token      string
+	CA         []byte // PEM, the system pool if empty
+	ClientCert []byte // PEM
+	ClientKey  []byte // PEM
+	Insecure   bool   // skip verifying the server certificate
+}
+
+// InClusterConfig uses the service account of the pod ctfjx runs in
+func InClusterConfig() (Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return Config{}, ErrNoCluster
+	}
+	token, err := os.ReadFile(SERVICE_ACCOUNT_DIR + "/token")
+	if err != nil {
+		return Config{}, err
+	}
+	ca, err := os.ReadFile(SERVICE_ACCOUNT_DIR + "/ca.crt")
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{Server: "https://" + host + ":" + port, Token: string(token), CA: ca}, nil
+}
+
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server   string `yaml:"server"`
+			CAData   string `yaml:"certificate-authority-data"`
+			CAFile   string `yaml:"certificate-authority"`
+			Insecure bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token    string `yaml:"token"`
+			CertData string `yaml:"client-certificate-data"`
+			KeyData  string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// LoadKubeconfig reads the current context of a kubeconfig file.
+// Only tokens and client certificates are supported, not exec plugins.
+func LoadKubeconfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(b, &kc); err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	var clusterName, userName string
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		cfg.Server, cfg.Insecure = c.Cluster.Server, c.Cluster.Insecure
+		if c.Cluster.CAFile != "" {
+			if cfg.CA, err = os.ReadFile(c.Cluster.CAFile); err != nil {
+				return cfg, err
+			}
+		} else if cfg.CA, err = decodeBase64(c.Cluster.CAData); err != nil {
+			return cfg, err
+		}
+	}
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		cfg.Token = u.User.Token
+		if cfg.ClientCert, err = decodeBase64(u.User.CertData); err != nil {
+			return cfg, err
+		}
+		if cfg.ClientKey, err = decodeBase64(u.User.KeyData); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Server == "" {
+		return cfg, fmt.Errorf("%w: context %q not found in %s", ErrNoCluster, kc.CurrentContext, path)
+	}
+	return cfg, nil
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// Client is a minimal Kubernetes API client
+type Client struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Server == "" {
+		return nil, ErrNoCluster
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if len(cfg.CA) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cfg.CA) {
+			return nil, errors.New("invalid kubernetes CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(cfg.ClientCert) > 0 {
+		cert, err := tls.X509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{cfg: cfg, client: &http.Client{Transport: transport}}, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, query url.Values, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	u := c.cfg.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&status)
+		if res.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", ErrNotFound, status.Message)
+		}
+		return fmt.Errorf("%w: %s %s: %d %s", ErrAPIError, method, path, res.StatusCode, status.Message)
+	}
+	if out == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// Apply creates or updates obj at path with server-side apply
+func (c *Client) Apply(ctx context.Context, path string, obj Object) error {
+	q := url.Values{"fieldManager": {FIELD_MANAGER}, "force": {"true"}}
+	return c.do(ctx, http.MethodPatch, path, "application/apply-patch+yaml", q, obj, nil)
+}
+
+func (c *Client) Get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, nil, out)
+}
+
+// Delete deletes the object at path, including its dependents
+func (c *Client) Delete(ctx context.Context, path string) error {
+	body := map[string]string{"propagationPolicy": "Foreground"}
+	err := c.do(ctx, http.MethodDelete, path, "application/json", nil, body, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
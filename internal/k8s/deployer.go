@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/log"
+)
+
+// Deployment is a challenge, or a team's instance of it, to deploy
+type Deployment struct {
+	Challenge string
+	Team      string // empty for a challenge shared by every team
+	Spec      container.Spec
+}
+
+// Namespace returns the namespace of the deployment,
+// one per challenge or per team instance
+func (d Deployment) Namespace() string {
+	if d.Team == "" {
+		return dnsLabel("ctfjx-" + d.Challenge)
+	}
+	return dnsLabel("ctfjx-" + d.Challenge + "-" + d.Team)
+}
+
+func (d Deployment) labels() map[string]string {
+	l := map[string]string{
+		LABEL_MANAGED:   FIELD_MANAGER,
+		LABEL_CHALLENGE: dnsLabel(d.Challenge),
+	}
+	if d.Team != "" {
+		l[LABEL_TEAM] = dnsLabel(d.Team)
+	}
+	return l
+}
+
+type applied struct {
+	path string
+	obj  Object
+}
+
+// Deployer runs challenges in a Kubernetes cluster. Each one gets
+// its own namespace with a resource quota and a network policy
+// isolating it from the rest of the cluster.
+type Deployer struct {
+	client *Client
+}
+
+func NewDeployer(client *Client) *Deployer {
+	return &Deployer{client: client}
+}
+
+// Deploy creates or updates every object of d
+func (dp *Deployer) Deploy(ctx context.Context, d Deployment) error {
+	if err := d.Spec.Validate(); err != nil {
+		return err
+	}
+	if d.Challenge == "" {
+		return fmt.Errorf("%w: challenge is required", container.ErrInvalidSpec)
+	}
+
+	ns := d.Namespace()
+	name := dnsLabel(d.Spec.Name)
+	labels := d.labels()
+
+	objects := []applied{
+		{"/api/v1/namespaces/" + ns, namespaceObject(ns, labels)},
+		{"/api/v1/namespaces/" + ns + "/resourcequotas/ctfjx", quotaObject(ns, labels, d.Spec.Limits)},
+		{"/apis/networking.k8s.io/v1/namespaces/" + ns + "/networkpolicies/ctfjx-isolation", networkPolicyObject(ns, labels, d.Spec.Ports)},
+		{"/apis/apps/v1/namespaces/" + ns + "/deployments/" + name, deploymentObject(ns, name, labels, d.Spec)},
+	}
+	if len(d.Spec.Ports) > 0 {
+		objects = append(objects, applied{"/api/v1/namespaces/" + ns + "/services/" + name, serviceObject(ns, name, labels, d.Spec.Ports)})
+	}
+
+	for _, o := range objects {
+		if err := dp.client.Apply(ctx, o.path, o.obj); err != nil {
+			return fmt.Errorf("apply %s: %w", o.obj["kind"], err)
+		}
+	}
+
+	log.Info().
+		WithMeta("scope", "k8s").
+		WithMeta("namespace", ns).
+		Msgf("deployed %s", name).Send()
+	return nil
+}
+
+// Remove deletes the namespace of d and everything in it
+func (dp *Deployer) Remove(ctx context.Context, d Deployment) error {
+	return dp.client.Delete(ctx, "/api/v1/namespaces/"+d.Namespace())
+}
+
+// Inspect returns the state of d's pods
+func (dp *Deployer) Inspect(ctx context.Context, d Deployment) (container.Info, error) {
+	name := dnsLabel(d.Spec.Name)
+	var raw struct {
+		Spec struct {
+			Replicas int `json:"replicas"`
+		} `json:"spec"`
+		Status struct {
+			ReadyReplicas     int `json:"readyReplicas"`
+			AvailableReplicas int `json:"availableReplicas"`
+		} `json:"status"`
+	}
+	err := dp.client.Get(ctx, "/apis/apps/v1/namespaces/"+d.Namespace()+"/deployments/"+name, &raw)
+	if errors.Is(err, ErrNotFound) {
+		return container.Info{}, fmt.Errorf("%w: %s", container.ErrNotFound, name)
+	}
+	if err != nil {
+		return container.Info{}, err
+	}
+
+	info := container.Info{
+		Id:     d.Namespace() + "/" + name,
+		Name:   name,
+		Image:  d.Spec.Image,
+		Labels: d.labels(),
+		State:  "pending",
+		Health: container.HealthStarting,
+	}
+	if raw.Status.AvailableReplicas >= raw.Spec.Replicas && raw.Spec.Replicas > 0 {
+		info.State, info.Running, info.Health = "running", true, container.HealthHealthy
+	}
+	return info, nil
+}
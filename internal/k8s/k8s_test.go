@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployer(t *testing.T) {
+	var mu sync.Mutex
+	applied := make(map[string]Object)
+	var deleted []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPatch:
+			assert.Equal(t, "application/apply-patch+yaml", r.Header.Get("Content-Type"))
+			assert.Equal(t, FIELD_MANAGER, r.URL.Query().Get("fieldManager"))
+			var obj Object
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+			applied[r.URL.Path] = obj
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		case http.MethodGet:
+			if _, ok := applied[r.URL.Path]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"message":"not found"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"spec":{"replicas":1},"status":{"availableReplicas":1}}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(Config{Server: srv.URL, Token: "secret"})
+	require.NoError(t, err)
+	dp := NewDeployer(client)
+	ctx := context.Background()
+
+	d := Deployment{
+		Challenge: "Web_1",
+		Team:      "team3",
+		Spec: container.Spec{
+			Name:   "web",
+			Image:  "nginx:1.27",
+			Ports:  []container.Port{{Container: 80, Host: 31080}},
+			Limits: container.Limits{CPUs: 0.5, Memory: 64 << 20},
+		},
+	}
+	assert.Equal(t, "ctfjx-web-1-team3", d.Namespace())
+	require.NoError(t, dp.Deploy(ctx, d))
+
+	ns := "/api/v1/namespaces/ctfjx-web-1-team3"
+	assert.Contains(t, applied, ns)
+	quota := applied[ns+"/resourcequotas/ctfjx"]["spec"].(map[string]any)["hard"].(map[string]any)
+	assert.Equal(t, "1000m", quota["limits.cpu"])
+	assert.Contains(t, applied, "/apis/networking.k8s.io/v1/namespaces/ctfjx-web-1-team3/networkpolicies/ctfjx-isolation")
+	svc := applied[ns+"/services/web"]["spec"].(map[string]any)
+	assert.Equal(t, "NodePort", svc["type"])
+
+	info, err := dp.Inspect(ctx, d)
+	require.NoError(t, err)
+	assert.True(t, info.Running)
+
+	require.NoError(t, dp.Remove(ctx, d))
+	assert.Equal(t, []string{ns}, deleted)
+
+	d.Spec.Name = "missing"
+	_, err = dp.Inspect(ctx, d)
+	assert.ErrorIs(t, err, container.ErrNotFound)
+}
+
+func TestLoadKubeconfig(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(pth, []byte(`
+current-context: ctf
+contexts:
+  - name: other
+    context: {cluster: other, user: other}
+  - name: ctf
+    context: {cluster: ctf, user: admin}
+clusters:
+  - name: ctf
+    cluster:
+      server: https://10.0.0.1:6443
+      insecure-skip-tls-verify: true
+users:
+  - name: admin
+    user:
+      token: abc
+`), 0o600))
+
+	cfg, err := LoadKubeconfig(pth)
+	require.NoError(t, err)
+	assert.Equal(t, Config{Server: "https://10.0.0.1:6443", Token: "abc", Insecure: true}, cfg)
+}
@@ -0,0 +1,189 @@
+package k8s
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/container"
+)
+
+const (
+	LABEL_CHALLENGE = "ctfjx.io/challenge"
+	LABEL_TEAM      = "ctfjx.io/team"
+	LABEL_MANAGED   = "app.kubernetes.io/managed-by"
+)
+
+// Object is a Kubernetes object as sent to the API
+type Object map[string]any
+
+var invalidNameRe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// dnsLabel turns s into a valid object name of at most 63 characters
+func dnsLabel(s string) string {
+	s = invalidNameRe.ReplaceAllString(strings.ToLower(s), "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-")
+}
+
+func metadata(name, namespace string, labels map[string]string) map[string]any {
+	m := map[string]any{"name": name, "labels": labels}
+	if namespace != "" {
+		m["namespace"] = namespace
+	}
+	return m
+}
+
+func namespaceObject(name string, labels map[string]string) Object {
+	return Object{"apiVersion": "v1", "kind": "Namespace", "metadata": metadata(name, "", labels)}
+}
+
+func quantityCPU(cpus float64) string {
+	return strconv.FormatInt(int64(cpus*1000), 10) + "m"
+}
+
+// quotaObject caps the namespace at what the deployment needs,
+// with room for a second pod during rolling updates
+func quotaObject(ns string, labels map[string]string, limits container.Limits) Object {
+	hard := map[string]string{"pods": "2"}
+	if limits.CPUs > 0 {
+		hard["limits.cpu"] = quantityCPU(2 * limits.CPUs)
+	}
+	if limits.Memory > 0 {
+		hard["limits.memory"] = strconv.FormatInt(2*limits.Memory, 10)
+	}
+	return Object{
+		"apiVersion": "v1",
+		"kind":       "ResourceQuota",
+		"metadata":   metadata("ctfjx", ns, labels),
+		"spec":       map[string]any{"hard": hard},
+	}
+}
+
+// networkPolicyObject only lets traffic reach the published ports
+// and only lets the pods resolve names and reach public addresses,
+// so they cannot pivot to other challenges or the cluster
+func networkPolicyObject(ns string, labels map[string]string, ports []container.Port) Object {
+	var ingressPorts []map[string]any
+	for _, p := range ports {
+		ingressPorts = append(ingressPorts, map[string]any{"port": p.Container, "protocol": protocol(p)})
+	}
+	dns := []map[string]any{{"port": 53, "protocol": "UDP"}, {"port": 53, "protocol": "TCP"}}
+
+	return Object{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata":   metadata("ctfjx-isolation", ns, labels),
+		"spec": map[string]any{
+			"podSelector": map[string]any{},
+			"policyTypes": []string{"Ingress", "Egress"},
+			"ingress":     []map[string]any{{"ports": ingressPorts}},
+			"egress": []map[string]any{
+				{
+					"to": []map[string]any{{
+						"namespaceSelector": map[string]any{"matchLabels": map[string]string{"kubernetes.io/metadata.name": "kube-system"}},
+					}},
+					"ports": dns,
+				},
+				{
+					"to": []map[string]any{{
+						"ipBlock": map[string]any{
+							"cidr":   "0.0.0.0/0",
+							"except": []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "100.64.0.0/10"},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func protocol(p container.Port) string {
+	if p.Protocol == "" {
+		return "TCP"
+	}
+	return strings.ToUpper(p.Protocol)
+}
+
+func deploymentObject(ns, name string, labels map[string]string, spec container.Spec) Object {
+	var env []map[string]string
+	for k, v := range spec.Env {
+		env = append(env, map[string]string{"name": k, "value": v})
+	}
+	var ports []map[string]any
+	for _, p := range spec.Ports {
+		ports = append(ports, map[string]any{"containerPort": p.Container, "protocol": protocol(p)})
+	}
+	limits := map[string]string{}
+	if spec.Limits.CPUs > 0 {
+		limits["cpu"] = quantityCPU(spec.Limits.CPUs)
+	}
+	if spec.Limits.Memory > 0 {
+		limits["memory"] = strconv.FormatInt(spec.Limits.Memory, 10)
+	}
+
+	c := map[string]any{
+		"name":      name,
+		"image":     spec.Image,
+		"env":       env,
+		"ports":     ports,
+		"resources": map[string]any{"limits": limits, "requests": limits},
+		"securityContext": map[string]any{
+			"allowPrivilegeEscalation": false,
+		},
+	}
+	if len(spec.Cmd) > 0 {
+		c["command"] = spec.Cmd
+	}
+
+	return Object{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   metadata(name, ns, labels),
+		"spec": map[string]any{
+			"replicas": 1,
+			"selector": map[string]any{"matchLabels": labels},
+			"template": map[string]any{
+				"metadata": map[string]any{"labels": labels},
+				"spec": map[string]any{
+					"automountServiceAccountToken": false,
+					"enableServiceLinks":           false,
+					"containers":                   []map[string]any{c},
+				},
+			},
+		},
+	}
+}
+
+// serviceObject publishes the ports, as a NodePort service
+// if any of them has a host port
+func serviceObject(ns, name string, labels map[string]string, ports []container.Port) Object {
+	typ := "ClusterIP"
+	var svcPorts []map[string]any
+	for _, p := range ports {
+		sp := map[string]any{
+			"name":       fmt.Sprintf("%s-%d", strings.ToLower(protocol(p)), p.Container),
+			"port":       p.Container,
+			"targetPort": p.Container,
+			"protocol":   protocol(p),
+		}
+		if p.Host != 0 {
+			sp["nodePort"] = p.Host
+			typ = "NodePort"
+		}
+		svcPorts = append(svcPorts, sp)
+	}
+	return Object{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   metadata(name, ns, labels),
+		"spec": map[string]any{
+			"type":     typ,
+			"selector": labels,
+			"ports":    svcPorts,
+		},
+	}
+}
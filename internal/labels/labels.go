@@ -0,0 +1,64 @@
+// Labels package describes hosts with key=value pairs and selects
+// them with selectors, e.g. an agent labelled
+//
+//	region=eu,gpu=true,isolation=vm
+//
+// matches the selector
+//
+//	region in (eu, us), gpu, isolation!=container
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidLabel = errors.New("invalid label")
+
+var (
+	keyRe   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,62}[A-Za-z0-9])?$`)
+	valueRe = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]{0,62}[A-Za-z0-9])?)?$`)
+)
+
+// Labels are the key=value pairs describing a host
+type Labels map[string]string
+
+// Parse parses comma separated key=value pairs
+func Parse(s string) (Labels, error) {
+	out := make(Labels)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return out, out.Validate()
+}
+
+// Validate checks that every key and value is well formed
+func (l Labels) Validate() error {
+	for k, v := range l {
+		if !keyRe.MatchString(k) {
+			return fmt.Errorf("%w: key %q", ErrInvalidLabel, k)
+		}
+		if !valueRe.MatchString(v) {
+			return fmt.Errorf("%w: value %q of %s", ErrInvalidLabel, v, k)
+		}
+	}
+	return nil
+}
+
+// String formats the labels as sorted key=value pairs
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
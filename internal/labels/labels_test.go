@@ -0,0 +1,66 @@
+package labels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	l, err := Parse("region=eu, gpu=true,isolation=vm")
+	require.NoError(t, err)
+	assert.Equal(t, Labels{"region": "eu", "gpu": "true", "isolation": "vm"}, l)
+	assert.Equal(t, "gpu=true,isolation=vm,region=eu", l.String())
+
+	_, err = Parse("-bad=x")
+	assert.ErrorIs(t, err, ErrInvalidLabel)
+	_, err = Parse("ok=not ok")
+	assert.ErrorIs(t, err, ErrInvalidLabel)
+}
+
+func TestSelector(t *testing.T) {
+	host := Labels{"region": "eu", "gpu": "true", "isolation": "vm"}
+
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"region=eu", true},
+		{"region==eu", true},
+		{"region=us", false},
+		{"isolation!=container", true},
+		{"arch!=arm64", true},
+		{"region in (eu, us)", true},
+		{"region notin (eu)", false},
+		{"arch notin (arm64)", true},
+		{"gpu", true},
+		{"!gpu", false},
+		{"!tainted", true},
+		{"region in (us,asia), gpu", false},
+		{"region in (eu,us), gpu, isolation!=container", true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		require.NoError(t, err, tt.selector)
+		assert.Equal(t, tt.matches, sel.Matches(host), tt.selector)
+
+		again, err := ParseSelector(sel.String())
+		require.NoError(t, err)
+		assert.Equal(t, sel, again, "String round trips")
+	}
+
+	for _, bad := range []string{"region in eu", "a b", "region in (e u)", "-x=y"} {
+		_, err := ParseSelector(bad)
+		assert.ErrorIs(t, err, ErrInvalidSelector, bad)
+	}
+
+	var v struct{ Selector Selector }
+	require.NoError(t, json.Unmarshal([]byte(`{"Selector":"gpu, region=eu"}`), &v))
+	assert.True(t, v.Selector.Matches(host))
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Selector":"gpu, region=eu"}`, string(b))
+}
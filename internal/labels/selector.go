@@ -0,0 +1,194 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidSelector = errors.New("invalid selector")
+
+type Operator string
+
+const (
+	OP_EQUALS     Operator = "="
+	OP_NOT_EQUALS Operator = "!="
+	OP_IN         Operator = "in"
+	OP_NOT_IN     Operator = "notin"
+	OP_EXISTS     Operator = "exists"
+	OP_NOT_EXISTS Operator = "!"
+)
+
+// Requirement is a single condition of a selector
+type Requirement struct {
+	Key    string
+	Op     Operator
+	Values []string // one for = and !=, none for exists and !
+}
+
+// Matches reports whether l satisfies the requirement.
+// A missing key satisfies != and notin.
+func (r Requirement) Matches(l Labels) bool {
+	v, ok := l[r.Key]
+	switch r.Op {
+	case OP_EQUALS:
+		return ok && v == r.Values[0]
+	case OP_NOT_EQUALS:
+		return !ok || v != r.Values[0]
+	case OP_IN:
+		return ok && slices.Contains(r.Values, v)
+	case OP_NOT_IN:
+		return !ok || !slices.Contains(r.Values, v)
+	case OP_EXISTS:
+		return ok
+	case OP_NOT_EXISTS:
+		return !ok
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Op {
+	case OP_EXISTS:
+		return r.Key
+	case OP_NOT_EXISTS:
+		return "!" + r.Key
+	case OP_IN, OP_NOT_IN:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Op, strings.Join(r.Values, ", "))
+	}
+	return r.Key + string(r.Op) + r.Values[0]
+}
+
+// Selector matches labels satisfying every requirement.
+// The empty selector matches everything.
+//
+// It is written as comma separated requirements:
+//
+//	region=eu            region is eu
+//	isolation!=container isolation is not container, or unset
+//	region in (eu, us)   region is eu or us
+//	arch notin (arm64)   arch is not arm64, or unset
+//	gpu                  gpu is set
+//	!tainted             tainted is not set
+type Selector []Requirement
+
+// Equals returns a selector requiring every label of l
+func Equals(l Labels) Selector {
+	var s Selector
+	for k, v := range l {
+		s = append(s, Requirement{Key: k, Op: OP_EQUALS, Values: []string{v}})
+	}
+	slices.SortFunc(s, func(a, b Requirement) int { return strings.Compare(a.Key, b.Key) })
+	return s
+}
+
+// Matches reports whether l satisfies every requirement of s
+func (s Selector) Matches(l Labels) bool {
+	for _, r := range s {
+		if !r.Matches(l) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s Selector) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Selector) UnmarshalText(b []byte) error {
+	sel, err := ParseSelector(string(b))
+	if err != nil {
+		return err
+	}
+	*s = sel
+	return nil
+}
+
+// ParseSelector parses a selector, see Selector
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range splitRequirements(s) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSelector, part, err)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// splitRequirements splits on the commas outside of parentheses
+func splitRequirements(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parseRequirement(s string) (Requirement, error) {
+	if key, ok := strings.CutPrefix(s, "!"); ok && !strings.ContainsAny(key, "=") {
+		return newRequirement(strings.TrimSpace(key), OP_NOT_EXISTS, nil)
+	}
+	if k, v, ok := strings.Cut(s, "!="); ok {
+		return newRequirement(strings.TrimSpace(k), OP_NOT_EQUALS, []string{strings.TrimSpace(v)})
+	}
+	if k, v, ok := strings.Cut(s, "="); ok {
+		return newRequirement(strings.TrimSpace(k), OP_EQUALS, []string{strings.TrimSpace(strings.TrimPrefix(v, "="))})
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 1 {
+		return newRequirement(fields[0], OP_EXISTS, nil)
+	}
+	if len(fields) < 3 || (fields[1] != string(OP_IN) && fields[1] != string(OP_NOT_IN)) {
+		return Requirement{}, errors.New("expected key, key=value, key!=value, !key or key in (values)")
+	}
+
+	list := strings.TrimSpace(strings.Join(fields[2:], " "))
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return Requirement{}, errors.New("values must be in parentheses")
+	}
+	var values []string
+	for _, v := range strings.Split(list[1:len(list)-1], ",") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return newRequirement(fields[0], Operator(fields[1]), values)
+}
+
+func newRequirement(key string, op Operator, values []string) (Requirement, error) {
+	if err := (Labels{key: ""}).Validate(); err != nil {
+		return Requirement{}, err
+	}
+	for _, v := range values {
+		if err := (Labels{key: v}).Validate(); err != nil {
+			return Requirement{}, err
+		}
+	}
+	return Requirement{Key: key, Op: op, Values: values}, nil
+}
@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lattesec/ctfjx/internal/helpers/cleanup"
+	"github.com/lattesec/log"
+)
+
+const (
+	CTFJX_LOG_LEVEL_ENV  = "CTFJX_LOG_LEVEL"
+	CTFJX_LOG_FORMAT_ENV = "CTFJX_LOG_FORMAT"
+	CTFJX_LOG_FILE_ENV   = "CTFJX_LOG_FILE"
+	CTFJX_LOG_DIR_ENV    = "CTFJX_LOG_DIR"
+
+	DEFAULT_LOGGER_NAME  = "default"
+	DEFAULT_LOG_FILENAME = "ctfjx.log"
+)
+
+type Format string
+
+const (
+	FORMAT_TEXT Format = "text"
+)
+
+var (
+	ErrUnknownLevel  = errors.New("unknown log level")
+	ErrUnknownFormat = errors.New("unknown log format")
+
+	levels = map[string]log.Level{
+		"TRACE": log.TRACE,
+		"DEBUG": log.DEBUG,
+		"INFO":  log.INFO,
+		"WARN":  log.WARN,
+		"ERROR": log.ERROR,
+		"QUIET": log.QUIET,
+	}
+)
+
+// Configures the default logger from the environment so that
+// containers can tune logging without a config file
+func init() {
+	if err := Bootstrap(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to configure logger from environment: %v\n", err)
+	}
+}
+
+func ParseLevel(s string) (log.Level, error) {
+	level, ok := levels[strings.ToUpper(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownLevel, s)
+	}
+	return level, nil
+}
+
+func LevelName(level log.Level) string {
+	for name, l := range levels {
+		if l == level {
+			return name
+		}
+	}
+	return "???"
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FORMAT_TEXT, nil
+	case FORMAT_TEXT, FORMAT_JSON, FORMAT_GCP, FORMAT_CLOUDWATCH:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+	}
+}
+
+// Bootstrap replaces the default logger with one built by FromEnv,
+// but only when at least one of the CTFJX_LOG_* variables is set
+func Bootstrap() error {
+	if !envConfigured() {
+		return nil
+	}
+
+	l, err := FromEnv(DEFAULT_LOGGER_NAME)
+	if err != nil {
+		return err
+	}
+	if err := l.Start(); err != nil {
+		return err
+	}
+
+	SetDefault(l)
+	return nil
+}
+
+// FromEnv builds a logger configured by
+//
+//   - $CTFJX_LOG_LEVEL: TRACE, DEBUG, INFO, WARN, ERROR or QUIET
+//   - $CTFJX_LOG_FORMAT: text, json, gcp or cloudwatch
+//   - $CTFJX_LOG_FILE: the log file, relative to $CTFJX_LOG_DIR if set
+//   - $CTFJX_LOG_DIR: the log directory, logging to ctfjx.log if no file is set
+//
+// Its messages are counted by a MetricsHandler.
+func FromEnv(name string) (*log.Logger, error) {
+	lb := log.NewLogger().
+		Name(name).
+		WithCleanup(cleanup.OnFatal).
+		WithHandlers(NewMetricsHandler())
+
+	var level *log.Level
+	if s := os.Getenv(CTFJX_LOG_LEVEL_ENV); s != "" {
+		l, err := ParseLevel(s)
+		if err != nil {
+			return nil, err
+		}
+		level = &l
+	}
+
+	format, err := ParseFormat(os.Getenv(CTFJX_LOG_FORMAT_ENV))
+	if err != nil {
+		return nil, err
+	}
+
+	// the stdout and stderr handlers can only write text
+	if format != FORMAT_TEXT {
+		lb.WithStdout(false).
+			WithStderr(false).
+			WithHandlers(NewFormatHandler(os.Stdout, format))
+	}
+
+	if pth := envLogPath(); pth != "" {
+		fh := NewFileHandler(pth)
+		fh.SetFormat(format)
+		lb.WithHandlers(fh)
+	}
+
+	l, err := lb.Build()
+	if err != nil {
+		return nil, err
+	}
+	// the builder refuses TRACE, unlike SetLevel
+	if level != nil {
+		if err := l.SetLevel(*level); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func envLogPath() string {
+	file := os.Getenv(CTFJX_LOG_FILE_ENV)
+	dir := os.Getenv(CTFJX_LOG_DIR_ENV)
+
+	switch {
+	case dir == "":
+		return file
+	case file == "":
+		return filepath.Join(dir, DEFAULT_LOG_FILENAME)
+	case filepath.IsAbs(file):
+		return file
+	default:
+		return filepath.Join(dir, file)
+	}
+}
+
+func envConfigured() bool {
+	for _, key := range [4]string{CTFJX_LOG_LEVEL_ENV, CTFJX_LOG_FORMAT_ENV, CTFJX_LOG_FILE_ENV, CTFJX_LOG_DIR_ENV} {
+		if os.Getenv(key) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets the CTFJX_LOG_* variables for the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{CTFJX_LOG_LEVEL_ENV, CTFJX_LOG_FORMAT_ENV, CTFJX_LOG_FILE_ENV, CTFJX_LOG_DIR_ENV} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]log.Level{
+		"trace":   log.TRACE,
+		"DEBUG":   log.DEBUG,
+		" Info\n": log.INFO,
+		"warn":    log.WARN,
+		"ERROR":   log.ERROR,
+		"quiet":   log.QUIET,
+	} {
+		level, err := ParseLevel(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, level, s)
+		assert.Equal(t, want, levels[LevelName(level)], "LevelName round trips")
+	}
+
+	for _, s := range []string{"", "verbose", "3", "WARNING"} {
+		_, err := ParseLevel(s)
+		assert.ErrorIs(t, err, ErrUnknownLevel, s)
+	}
+	assert.Equal(t, "???", LevelName(log.Level(42)))
+}
+
+func TestParseFormat(t *testing.T) {
+	for s, want := range map[string]Format{
+		"":              FORMAT_TEXT,
+		"text":          FORMAT_TEXT,
+		" JSON ":        FORMAT_JSON,
+		"gcp":           FORMAT_GCP,
+		"CloudWatch":    FORMAT_CLOUDWATCH,
+		"\tcloudwatch ": FORMAT_CLOUDWATCH,
+	} {
+		format, err := ParseFormat(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, format, s)
+	}
+
+	for _, s := range []string{"xml", "logfmt", "jsonl"} {
+		_, err := ParseFormat(s)
+		assert.ErrorIs(t, err, ErrUnknownFormat, s)
+	}
+}
+
+func TestEnvLogPath(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(t.TempDir(), "abs.log")
+
+	tests := []struct {
+		name      string
+		file, dir string
+		want      string
+	}{
+		{"neither", "", "", ""},
+		{"only a file", "rel.log", "", "rel.log"},
+		{"only a dir", "", dir, filepath.Join(dir, DEFAULT_LOG_FILENAME)},
+		{"a file relative to the dir", "sub/rel.log", dir, filepath.Join(dir, "sub", "rel.log")},
+		{"an absolute file ignores the dir", abs, dir, abs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv(CTFJX_LOG_FILE_ENV, tt.file)
+			t.Setenv(CTFJX_LOG_DIR_ENV, tt.dir)
+			assert.Equal(t, tt.want, envLogPath())
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		want    log.Level
+		wantErr error
+	}{
+		{"defaults", "", "", log.WARN, nil},
+		{"level", "debug", "", log.DEBUG, nil},
+		{"trace", "TRACE", "", log.TRACE, nil},
+		{"quiet", "quiet", "json", log.QUIET, nil},
+		{"invalid level", "loud", "", 0, ErrUnknownLevel},
+		{"invalid format", "info", "xml", 0, ErrUnknownFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv(CTFJX_LOG_LEVEL_ENV, tt.level)
+			t.Setenv(CTFJX_LOG_FORMAT_ENV, tt.format)
+
+			l, err := FromEnv("env-test")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "env-test", l.GetName())
+			assert.Equal(t, tt.want, l.GetLevel())
+		})
+	}
+}
+
+func TestFromEnv_File(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	clearEnv(t)
+	t.Setenv(CTFJX_LOG_DIR_ENV, dir)
+	t.Setenv(CTFJX_LOG_FILE_ENV, "daemon/ctfjx.json")
+	t.Setenv(CTFJX_LOG_FORMAT_ENV, "json")
+	t.Setenv(CTFJX_LOG_LEVEL_ENV, "info")
+
+	l, err := FromEnv("env-test")
+	require.NoError(t, err)
+	require.NoError(t, l.Start())
+	l.Info().Msg("to the file").Send()
+	require.NoError(t, l.Close())
+
+	data, err := os.ReadFile(filepath.Join(dir, "daemon", "ctfjx.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"logger":"env-test","message":"to the file"`, "in the format set")
+}
+
+func TestBootstrap(t *testing.T) {
+	prev := log.DefaultLogger()
+	defer log.Register(prev)
+	registered, wasRegistered := Get(DEFAULT_LOGGER_NAME)
+	defer func() {
+		if wasRegistered {
+			Register(registered)
+		} else {
+			Unregister(DEFAULT_LOGGER_NAME)
+		}
+	}()
+
+	clearEnv(t)
+	require.NoError(t, Bootstrap())
+	assert.Same(t, prev, log.DefaultLogger(), "nothing set, nothing changed")
+
+	t.Setenv(CTFJX_LOG_LEVEL_ENV, "nope")
+	assert.ErrorIs(t, Bootstrap(), ErrUnknownLevel)
+	assert.Same(t, prev, log.DefaultLogger(), "an invalid variable leaves the default logger")
+
+	t.Setenv(CTFJX_LOG_LEVEL_ENV, "error")
+	require.NoError(t, Bootstrap())
+	l := log.DefaultLogger()
+	defer l.Close()
+	require.NotSame(t, prev, l)
+	assert.True(t, l.IsRunning())
+	assert.Equal(t, log.ERROR, l.GetLevel())
+	assert.Same(t, l, Named(DEFAULT_LOGGER_NAME))
+}
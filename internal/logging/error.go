@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"fmt"
+
+	"github.com/lattesec/log"
+)
+
+// WithError attaches err to the message as structured metadata.
+//
+// Joined and wrapped errors are unwrapped so that every error in
+// the chain gets its own `error.N.type` and `error.N.msg` fields,
+// instead of one multi-line string.
+func WithError(lm *log.LogMessage, err error) *log.LogMessage {
+	if err == nil {
+		return lm
+	}
+
+	lm.WithMetaf("error.type", "%T", err)
+	for i, e := range ErrorChain(err) {
+		lm.WithMetaf(fmt.Sprintf("error.%d.type", i), "%T", e)
+		lm.WithMeta(fmt.Sprintf("error.%d.msg", i), e.Error())
+	}
+	return lm
+}
+
+// ErrorChain flattens err depth-first.
+//
+// Errors created by errors.Join are replaced by the errors they
+// join, as their own message is only the concatenation of those.
+func ErrorChain(err error) []error {
+	var chain []error
+	walkError(err, &chain)
+	return chain
+}
+
+func walkError(err error, chain *[]error) {
+	if err == nil {
+		return
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			walkError(inner, chain)
+		}
+	case interface{ Unwrap() error }:
+		*chain = append(*chain, err)
+		walkError(e.Unwrap(), chain)
+	default:
+		*chain = append(*chain, err)
+	}
+}
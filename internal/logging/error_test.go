@@ -0,0 +1,23 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithError_Chain(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+	err := errors.Join(errA, fmt.Errorf("wrapped: %w", errB))
+
+	assert.Equal(t, []error{errA, fmt.Errorf("wrapped: %w", errB), errB}, ErrorChain(err))
+
+	lm := WithError(log.NewLogMessage(), err)
+	assert.Contains(t, lm.Meta, log.LogMessageMetaKV{K: "error.0.msg", V: "a"})
+	assert.Contains(t, lm.Meta, log.LogMessageMetaKV{K: "error.1.msg", V: "wrapped: b"})
+	assert.Contains(t, lm.Meta, log.LogMessageMetaKV{K: "error.2.msg", V: "b"})
+}
@@ -0,0 +1,395 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lattesec/log"
+)
+
+const (
+	DEFAULT_FLUSH_INTERVAL = time.Second
+	DEFAULT_FLUSH_SIZE     = 64 << 10 // 64KB
+	MAX_UNFLUSHED_SIZE     = 16 << 20 // 16MB kept while writing to the file fails
+
+	DEFAULT_LOG_FILE_MODE os.FileMode = 0o600
+	DEFAULT_LOG_DIR_MODE  os.FileMode = 0o700
+)
+
+var (
+	ErrFileNotOpen = errors.New("log file not open")
+	ErrBufferFull  = errors.New("log file buffer full")
+
+	openFileHandlers sync.Map // map[*FileHandler]struct{}
+)
+
+// FileHandler writes log messages to a file through a buffer.
+//
+// Lines are batched and flushed once the buffer grows past the
+// flush size or when the flush interval elapses, whichever is first.
+// Flush and Close also fsync the file, so the log survives a crash
+// of the host and not only of the process.
+type FileHandler struct {
+	log.BaseHandler
+
+	muFile sync.Mutex // covers file, buf and the settings below
+	path   string
+	file   *os.File // nil while started if reopening it failed
+	buf    *lineBuffer
+	opened bool // between Start and Close, Reopen retries a failed open then
+
+	flushInterval time.Duration
+	flushSize     int
+
+	format Format
+	tee    *MultiWriter // gets every line the file gets, if set
+	queue  *queue
+
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	uid, gid int // -1 leaves the owner unchanged
+}
+
+func NewFileHandler(path string) *FileHandler {
+	f := &FileHandler{
+		path:          filepath.Clean(path),
+		flushInterval: DEFAULT_FLUSH_INTERVAL,
+		flushSize:     DEFAULT_FLUSH_SIZE,
+		format:        FORMAT_TEXT,
+		fileMode:      DEFAULT_LOG_FILE_MODE,
+		dirMode:       DEFAULT_LOG_DIR_MODE,
+		uid:           -1,
+		gid:           -1,
+	}
+	f.queue = newQueue(f.handle)
+
+	f.BaseHandler = log.BaseHandler{
+		StartFunc: func(ctx context.Context, lh log.LogHandler) error {
+			f.muFile.Lock()
+			defer f.muFile.Unlock()
+
+			if err := f.open(); err != nil {
+				return err
+			}
+			f.opened = true
+			openFileHandlers.Store(f, struct{}{})
+			return nil
+		},
+		HandleFunc: handled,
+		CloseFunc: func(ctx context.Context, lh log.LogHandler) error {
+			f.muFile.Lock()
+			defer f.muFile.Unlock()
+
+			f.opened = false
+			openFileHandlers.Delete(f)
+			return f.close()
+		},
+		Subprocesses: []func(context.Context) error{f.queue.drain, f.flusher},
+	}
+
+	return f
+}
+
+func (f *FileHandler) Path() string {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	return f.path
+}
+
+// SetFlushInterval sets how often buffered lines are flushed.
+// It only takes effect when the handler is (re)started.
+func (f *FileHandler) SetFlushInterval(d time.Duration) {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	f.flushInterval = d
+}
+
+// SetFlushSize sets the number of buffered bytes that triggers a flush
+func (f *FileHandler) SetFlushSize(size int) {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	f.flushSize = size
+}
+
+// SetFormat sets the format lines are written in
+func (f *FileHandler) SetFormat(format Format) {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	f.format = format
+}
+
+func (f *FileHandler) Handle(loggerName string, msg *log.LogMessage) {
+	if msg == nil || !f.IsRunning() {
+		return
+	}
+	f.queue.push(loggerName, msg)
+}
+
+func (f *FileHandler) handle(loggerName string, msg *log.LogMessage) error {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+
+	line, err := f.write(loggerName, msg)
+	if err != nil {
+		fileWriteErrors.Add(1)
+	}
+	if f.tee != nil && line != nil {
+		if _, teeErr := f.tee.Write(line); teeErr != nil {
+			err = errors.Join(err, fmt.Errorf("tee: %w", teeErr))
+		}
+	}
+	return err
+}
+
+// SetTee makes every line written to the file go to ws as well,
+// e.g. a test capture buffer or a socket. A failing writer stops
+// neither the file nor the other writers. Closing the handler does
+// not close them.
+func (f *FileHandler) SetTee(ws ...io.Writer) {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	f.tee = nil
+	if len(ws) > 0 {
+		f.tee = NewMultiWriter(ws...)
+	}
+}
+
+// SetPermissions sets the mode of the log file and of the
+// directories created for it.
+// It only takes effect when the file is (re)opened.
+func (f *FileHandler) SetPermissions(fileMode, dirMode os.FileMode) {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	f.fileMode = fileMode
+	f.dirMode = dirMode
+}
+
+// SetOwner sets the owner and group of the log file and of the
+// directories created for it, e.g. so a shared group can read the
+// logs. Pass -1 to leave either unchanged. It is ignored on Windows.
+// It only takes effect when the file is (re)opened.
+func (f *FileHandler) SetOwner(uid, gid int) {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	f.uid = uid
+	f.gid = gid
+}
+
+// Flush writes out buffered lines and fsyncs the file
+func (f *FileHandler) Flush() error {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+	return f.flush(true)
+}
+
+// Reopen closes the log file and opens it again by its path.
+//
+// External tools like logrotate move the file away, after which
+// writes would otherwise keep going to the rotated-away inode.
+// If opening fails, lines are dropped until a later Reopen
+// succeeds.
+func (f *FileHandler) Reopen() error {
+	f.muFile.Lock()
+	defer f.muFile.Unlock()
+
+	if !f.opened {
+		return ErrFileNotOpen
+	}
+	if err := f.close(); err != nil {
+		fileWriteErrors.Add(1)
+		fmt.Fprintf(os.Stderr, "failed to close log file %s: %v\n", f.path, err)
+	}
+
+	fileReopens.Add(1)
+	return f.open()
+}
+
+// callers responsibility to hold muFile
+func (f *FileHandler) open() error {
+	created := missingDirs(filepath.Dir(f.path))
+	if err := os.MkdirAll(filepath.Dir(f.path), f.dirMode); err != nil {
+		return err
+	}
+	// the mode given to MkdirAll is masked by the umask too,
+	// directories that already existed are left alone
+	for _, dir := range created {
+		if err := os.Chmod(dir, f.dirMode); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, f.fileMode)
+	if err != nil {
+		return err
+	}
+
+	// the mode given to OpenFile is masked by the umask
+	// and ignored for files that already exist
+	if err := file.Chmod(f.fileMode); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	if err := f.chown(append(created, f.path)); err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	f.file = file
+	f.buf = &lineBuffer{w: file}
+	return nil
+}
+
+// missingDirs returns dir and those of its parents that do not
+// exist, the topmost first
+func missingDirs(dir string) []string {
+	var out []string
+	for {
+		if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		out = append(out, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	slices.Reverse(out)
+	return out
+}
+
+// Swapped out in tests
+var chown = os.Chown
+
+// callers responsibility to hold muFile
+func (f *FileHandler) chown(paths []string) error {
+	if runtime.GOOS == "windows" || (f.uid < 0 && f.gid < 0) {
+		return nil
+	}
+	for _, pth := range paths {
+		if err := chown(pth, f.uid, f.gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write returns the line it wrote, if it could encode msg.
+// callers responsibility to hold muFile
+func (f *FileHandler) write(loggerName string, msg *log.LogMessage) ([]byte, error) {
+	if f.buf == nil {
+		return nil, ErrFileNotOpen
+	}
+
+	b, err := Encode(f.format, loggerName, msg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.buf.Write(b); err != nil {
+		return b, err
+	}
+
+	if f.buf.Buffered() >= f.flushSize {
+		return b, f.flush(false)
+	}
+	return b, nil
+}
+
+// callers responsibility to hold muFile
+func (f *FileHandler) flush(fsync bool) error {
+	if f.buf == nil {
+		return ErrFileNotOpen
+	}
+
+	if err := f.buf.Flush(); err != nil {
+		return err
+	}
+	if fsync {
+		return f.file.Sync()
+	}
+	return nil
+}
+
+// callers responsibility to hold muFile
+func (f *FileHandler) close() error {
+	if f.file == nil {
+		return nil
+	}
+
+	err := errors.Join(f.flush(true), f.file.Close())
+	f.file = nil
+	f.buf = nil
+	return err
+}
+
+func (f *FileHandler) flusher(ctx context.Context) error {
+	f.muFile.Lock()
+	interval := f.flushInterval
+	f.muFile.Unlock()
+
+	if interval <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			f.muFile.Lock()
+			err := f.flush(false)
+			f.muFile.Unlock()
+
+			// errors such as a full disk may pass, the
+			// lines stay buffered and are retried
+			if err != nil && !errors.Is(err, ErrFileNotOpen) {
+				fileWriteErrors.Add(1)
+				fmt.Fprintf(os.Stderr, "failed to flush log file %s: %v\n", f.Path(), err)
+			}
+		}
+	}
+}
+
+// lineBuffer batches the lines of a file. Unlike a bufio.Writer,
+// which fails for good after an error, it keeps what it could not
+// write so that a later flush may succeed, e.g. once a full disk
+// has room again.
+type lineBuffer struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	if len(b.buf)+len(p) > MAX_UNFLUSHED_SIZE {
+		return 0, ErrBufferFull
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *lineBuffer) Buffered() int {
+	return len(b.buf)
+}
+
+func (b *lineBuffer) Flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	n, err := b.w.Write(b.buf)
+	if err == nil && n < len(b.buf) {
+		err = io.ErrShortWrite
+	}
+	b.buf = b.buf[:copy(b.buf, b.buf[n:])]
+	return err
+}
@@ -0,0 +1,238 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileHandler_FlushOnClose(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "logs", "test.log")
+
+	fh := NewFileHandler(pth)
+	fh.SetFlushInterval(time.Hour)
+
+	l, err := log.NewLogger().
+		WithLevel(log.DEBUG).
+		WithStdout(false).
+		WithStderr(false).
+		WithHandlers(fh).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, l.Start())
+
+	l.Info().Msg("buffered msg").Send()
+	require.NoError(t, l.Close())
+
+	data, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "buffered msg")
+}
+
+func TestFileHandler_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "test.log")
+
+	fh := NewFileHandler(pth)
+	require.NoError(t, fh.Start())
+
+	fh.Handle("test", log.NewLogMessage().Info().Msg("before rotation"))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, fh.Flush())
+	require.NoError(t, os.Rename(pth, pth+".1"))
+
+	require.NoError(t, Reopen())
+	fh.Handle("test", log.NewLogMessage().Info().Msg("after rotation"))
+	require.NoError(t, fh.Close())
+
+	rotated, err := os.ReadFile(pth + ".1")
+	require.NoError(t, err)
+	current, err := os.ReadFile(pth)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(rotated), "before rotation")
+	assert.NotContains(t, string(rotated), "after rotation")
+	assert.Contains(t, string(current), "after rotation")
+}
+
+func TestFileHandler_Permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix permissions")
+	}
+	root := t.TempDir()
+	require.NoError(t, os.Chmod(root, 0o711))
+	pth := filepath.Join(root, "a", "b", "test.log")
+
+	var chowned []string
+	chown = func(name string, uid, gid int) error {
+		assert.Equal(t, os.Getuid(), uid)
+		assert.Equal(t, -1, gid)
+		chowned = append(chowned, name)
+		return nil
+	}
+	defer func() { chown = os.Chown }()
+
+	fh := NewFileHandler(pth)
+	fh.SetPermissions(0o640, 0o777) // past any umask
+	fh.SetOwner(os.Getuid(), -1)
+	require.NoError(t, fh.Start())
+	require.NoError(t, fh.Close())
+
+	mode := func(name string) os.FileMode {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+		return info.Mode().Perm()
+	}
+	assert.Equal(t, os.FileMode(0o640), mode(pth))
+	assert.Equal(t, os.FileMode(0o777), mode(filepath.Join(root, "a")))
+	assert.Equal(t, os.FileMode(0o777), mode(filepath.Join(root, "a", "b")))
+	assert.Equal(t, os.FileMode(0o711), mode(root), "existing directories are left alone")
+	assert.Equal(t, []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b"), pth}, chowned)
+
+	// reopening creates nothing, only the file is chowned again
+	chowned = nil
+	require.NoError(t, fh.Start())
+	require.NoError(t, fh.Close())
+	assert.Equal(t, []string{pth}, chowned)
+}
+
+func TestFileHandler_Tee(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "test.log")
+	var tee bytes.Buffer
+
+	fh := NewFileHandler(pth)
+	fh.SetTee(failingWriter{}, &tee)
+	require.NoError(t, fh.Start())
+	fh.Handle("test", log.NewLogMessage().Info().Msg("teed msg"))
+	require.NoError(t, fh.Close())
+
+	data, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "teed msg")
+	assert.Equal(t, string(data), tee.String(), "a failing writer stops neither the file nor the others")
+}
+
+func TestFileHandler_Format(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "test.log")
+
+	fh := NewFileHandler(pth)
+	fh.SetFormat(FORMAT_GCP)
+	require.NoError(t, fh.Start())
+	fh.Handle("daemon", goldenMessage())
+	fh.Handle("agent", goldenMessage())
+	require.NoError(t, fh.Close())
+
+	data, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	golden, err := Encode(FORMAT_GCP, "daemon", goldenMessage())
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, golden), string(data))
+	assert.Contains(t, string(data[len(golden):]), `"logger":"agent"`)
+}
+
+// fullDisk fails until it has room, like a disk that filled up
+type fullDisk struct {
+	mu   sync.Mutex
+	room bool
+	buf  bytes.Buffer
+}
+
+func (d *fullDisk) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.room {
+		n := min(len(p), 3)
+		d.buf.Write(p[:n])
+		return n, syscall.ENOSPC
+	}
+	return d.buf.Write(p)
+}
+
+func (d *fullDisk) String() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.buf.String()
+}
+
+func TestFileHandler_FlushErrors(t *testing.T) {
+	fh := NewFileHandler(filepath.Join(t.TempDir(), "test.log"))
+	fh.SetFlushInterval(5 * time.Millisecond)
+	require.NoError(t, fh.Start())
+	defer fh.Close()
+
+	disk := &fullDisk{}
+	fh.muFile.Lock()
+	fh.buf.w = disk
+	fh.muFile.Unlock()
+
+	errs := fileWriteErrors.Value()
+	fh.Handle("test", log.NewLogMessage().Info().Msg("while the disk is full"))
+	require.Eventually(t, func() bool { return fileWriteErrors.Value() > errs+1 }, time.Second, time.Millisecond,
+		"the flusher keeps ticking after an error")
+
+	disk.mu.Lock()
+	disk.room = true
+	disk.mu.Unlock()
+	require.Eventually(t, func() bool { return strings.HasSuffix(disk.String(), "while the disk is full\n") }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, strings.Count(disk.String(), "[INFO]"), "partly written lines are not written twice")
+}
+
+func TestFileHandler_ReopenFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	pth := filepath.Join(dir, "test.log")
+
+	fh := NewFileHandler(pth)
+	assert.ErrorIs(t, fh.Reopen(), ErrFileNotOpen, "not started")
+	require.NoError(t, fh.Start())
+
+	// rotated away, with something in the way of the new file
+	require.NoError(t, os.Rename(dir, dir+".1"))
+	require.NoError(t, os.WriteFile(dir, nil, 0o600))
+	assert.Error(t, fh.Reopen())
+	fh.Handle("test", log.NewLogMessage().Info().Msg("lost"))
+	assert.Error(t, fh.Reopen(), "still in the way")
+
+	require.NoError(t, os.Remove(dir))
+	require.NoError(t, fh.Reopen(), "the open is retried from the path")
+	fh.Handle("test", log.NewLogMessage().Info().Msg("after recovery"))
+	require.NoError(t, fh.Close())
+	assert.ErrorIs(t, fh.Reopen(), ErrFileNotOpen, "closed")
+
+	data, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "after recovery")
+}
+
+func TestLineBuffer(t *testing.T) {
+	b := &lineBuffer{w: failingWriter{}}
+	_, err := b.Write([]byte("kept\n"))
+	require.NoError(t, err)
+	assert.Error(t, b.Flush())
+	assert.Equal(t, 5, b.Buffered(), "nothing is lost on errors")
+
+	var out bytes.Buffer
+	b.w = &out
+	require.NoError(t, b.Flush())
+	assert.Equal(t, "kept\n", out.String())
+	assert.Zero(t, b.Buffered())
+
+	b.w = shortWriter{}
+	_, err = b.Write([]byte("half\n"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, b.Flush(), io.ErrShortWrite)
+	assert.Equal(t, 3, b.Buffered())
+
+	_, err = b.Write(make([]byte, MAX_UNFLUSHED_SIZE))
+	assert.ErrorIs(t, err, ErrBufferFull)
+}
@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/lattesec/log"
+)
+
+// Predicate reports whether a message should be kept
+type Predicate func(msg *log.LogMessage) bool
+
+// Filter drops messages that pred rejects
+func Filter(pred Predicate) Stage {
+	return func(_ string, msg *log.LogMessage) *log.LogMessage {
+		if !pred(msg) {
+			return nil
+		}
+		return msg
+	}
+}
+
+// DropMeta rejects messages carrying the metadata key=value,
+// e.g. DropMeta("scope", "heartbeat")
+func DropMeta(key, value string) Predicate {
+	return func(msg *log.LogMessage) bool {
+		for _, kv := range msg.Meta {
+			if kv.K == key && kv.V == value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FilterSet holds predicates that can be added
+// and removed while loggers are running
+type FilterSet struct {
+	idGen uint64
+	mu    sync.RWMutex
+	preds map[uint64]Predicate
+}
+
+func NewFilterSet() *FilterSet {
+	return &FilterSet{preds: make(map[uint64]Predicate)}
+}
+
+func (fs *FilterSet) Add(pred Predicate) uint64 {
+	id := atomic.AddUint64(&fs.idGen, 1)
+	fs.mu.Lock()
+	fs.preds[id] = pred
+	fs.mu.Unlock()
+	return id
+}
+
+func (fs *FilterSet) Remove(id uint64) {
+	fs.mu.Lock()
+	delete(fs.preds, id)
+	fs.mu.Unlock()
+}
+
+// Keep reports whether every predicate in the set keeps msg
+func (fs *FilterSet) Keep(msg *log.LogMessage) bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	for _, pred := range fs.preds {
+		if !pred(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stage returns a stage that applies the set's current predicates
+func (fs *FilterSet) Stage() Stage {
+	return Filter(fs.Keep)
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/logging/logtest"
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropMeta(t *testing.T) {
+	pred := DropMeta("scope", "heartbeat")
+
+	assert.True(t, pred(log.NewLogMessage().Msg("no meta")))
+	assert.True(t, pred(log.NewLogMessage().WithMeta("scope", "store")))
+	assert.True(t, pred(log.NewLogMessage().WithMeta("other", "heartbeat")), "the key has to match")
+	assert.True(t, pred(log.NewLogMessage().Msg("heartbeat")), "so does the value")
+	assert.False(t, pred(log.NewLogMessage().WithMeta("scope", "heartbeat")))
+	assert.False(t, pred(log.NewLogMessage().WithMeta("agent", "a1").WithMeta("scope", "heartbeat")))
+}
+
+func TestFilter(t *testing.T) {
+	stage := Filter(func(msg *log.LogMessage) bool { return msg.Level >= log.WARN })
+
+	warn := log.NewLogMessage().Warn()
+	assert.Same(t, warn, stage("filter-test", warn), "kept messages are passed on as they are")
+	assert.Nil(t, stage("filter-test", log.NewLogMessage().Info()))
+}
+
+func TestFilterSet(t *testing.T) {
+	fs := NewFilterSet()
+	heartbeat := log.NewLogMessage().WithMeta("scope", "heartbeat")
+	debug := log.NewLogMessage().Debug().WithMeta("scope", "store")
+
+	assert.True(t, fs.Keep(heartbeat), "an empty set keeps everything")
+
+	hb := fs.Add(DropMeta("scope", "heartbeat"))
+	lvl := fs.Add(func(msg *log.LogMessage) bool { return msg.Level >= log.INFO })
+	assert.NotEqual(t, hb, lvl)
+	assert.False(t, fs.Keep(heartbeat))
+	assert.False(t, fs.Keep(debug))
+
+	fs.Remove(hb)
+	assert.True(t, fs.Keep(heartbeat.Info()))
+	assert.False(t, fs.Keep(debug), "the other predicates stay")
+	fs.Remove(hb) // removing twice is fine
+
+	fs.Remove(lvl)
+	assert.True(t, fs.Keep(debug))
+	assert.Greater(t, fs.Add(DropMeta("a", "b")), lvl, "ids are not reused")
+}
+
+func TestFilterSet_Stage(t *testing.T) {
+	capture := logtest.NewCapture()
+	require.NoError(t, capture.Start())
+	defer capture.Close()
+	fs := NewFilterSet()
+	p := Pipeline(capture, fs.Stage())
+	beat := func(msg string) *log.LogMessage {
+		return log.NewLogMessage().Info().Msg(msg).WithMeta("scope", "heartbeat")
+	}
+
+	p.Handle("filter-test", beat("beat"))
+	id := fs.Add(DropMeta("scope", "heartbeat"))
+	p.Handle("filter-test", beat("dropped"))
+	p.Handle("filter-test", log.NewLogMessage().Info().Msg("kept"))
+	fs.Remove(id)
+	p.Handle("filter-test", beat("beat again"))
+
+	var got []string
+	for _, e := range capture.Entries() {
+		got = append(got, e.Message)
+	}
+	assert.Equal(t, []string{"beat", "kept", "beat again"}, got, "predicates apply from when they are added until removed")
+}
+
+func TestFilterSet_Concurrent(t *testing.T) {
+	fs := NewFilterSet()
+	msg := log.NewLogMessage().WithMeta("scope", "store")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fs.Remove(fs.Add(DropMeta("scope", "heartbeat")))
+				assert.True(t, fs.Keep(msg))
+			}
+		}()
+	}
+	wg.Wait()
+}
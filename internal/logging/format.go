@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lattesec/log"
+)
+
+const (
+	FORMAT_JSON       Format = "json"       // one JSON object per line
+	FORMAT_GCP        Format = "gcp"        // Google Cloud Logging structured logs
+	FORMAT_CLOUDWATCH Format = "cloudwatch" // AWS CloudWatch embedded metric format
+
+	CLOUDWATCH_NAMESPACE = "ctfjx"
+)
+
+var gcpSeverities = map[log.Level]string{
+	log.TRACE: "DEBUG",
+	log.DEBUG: "DEBUG",
+	log.INFO:  "INFO",
+	log.WARN:  "WARNING",
+	log.ERROR: "ERROR",
+}
+
+// Encode renders msg as a single line in the given format
+func Encode(f Format, loggerName string, msg *log.LogMessage) ([]byte, error) {
+	var v any
+	switch f {
+	case FORMAT_TEXT, "":
+		return []byte(msg.String(loggerName)), nil
+	case FORMAT_JSON:
+		v = map[string]any{
+			"time":    msg.Timestamp.Format(time.RFC3339Nano),
+			"level":   msg.LevelString(),
+			"logger":  loggerName,
+			"message": msg.Message,
+			"meta":    metaMap(msg),
+		}
+	case FORMAT_GCP:
+		v = map[string]any{
+			"time":     msg.Timestamp.Format(time.RFC3339Nano),
+			"severity": gcpSeverity(msg.Level),
+			"logger":   loggerName,
+			"message":  msg.Message,
+			"meta":     metaMap(msg),
+		}
+	case FORMAT_CLOUDWATCH:
+		v = cloudWatchEntry(loggerName, msg)
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func gcpSeverity(level log.Level) string {
+	if s, ok := gcpSeverities[level]; ok {
+		return s
+	}
+	return "DEFAULT"
+}
+
+// Emits a LogMessages count per logger and level alongside the message
+func cloudWatchEntry(loggerName string, msg *log.LogMessage) map[string]any {
+	return map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": msg.Timestamp.UnixMilli(),
+			"CloudWatchMetrics": []map[string]any{{
+				"Namespace":  CLOUDWATCH_NAMESPACE,
+				"Dimensions": [][]string{{"Logger", "Level"}},
+				"Metrics":    []map[string]string{{"Name": "LogMessages", "Unit": "Count"}},
+			}},
+		},
+		"Logger":      loggerName,
+		"Level":       msg.LevelString(),
+		"LogMessages": 1,
+		"message":     msg.Message,
+		"meta":        metaMap(msg),
+	}
+}
+
+func metaMap(msg *log.LogMessage) map[string]string {
+	m := make(map[string]string, len(msg.Meta))
+	for _, kv := range msg.Meta {
+		m[kv.K] = kv.V
+	}
+	return m
+}
+
+// FormatHandler writes messages to a writer in the given format
+type FormatHandler struct {
+	log.BaseHandler
+	format Format
+	writer io.Writer
+	queue  *queue
+}
+
+func NewFormatHandler(w io.Writer, f Format) *FormatHandler {
+	h := &FormatHandler{format: f, writer: w}
+	h.queue = newQueue(func(loggerName string, msg *log.LogMessage) error {
+		b, err := Encode(h.format, loggerName, msg)
+		if err != nil {
+			return err
+		}
+		_, err = h.writer.Write(b)
+		return err
+	})
+
+	h.BaseHandler = log.BaseHandler{
+		HandleFunc: handled,
+		CloseFunc: func(ctx context.Context, lh log.LogHandler) error {
+			if h.writer != os.Stdout && h.writer != os.Stderr {
+				if closer, ok := h.writer.(io.Closer); ok {
+					return closer.Close()
+				}
+			}
+			return nil
+		},
+		Subprocesses: []func(context.Context) error{h.queue.drain},
+	}
+
+	return h
+}
+
+func (h *FormatHandler) Handle(loggerName string, msg *log.LogMessage) {
+	if msg == nil || !h.IsRunning() {
+		return
+	}
+	h.queue.push(loggerName, msg)
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func goldenMessage() *log.LogMessage {
+	msg := log.NewLogMessage().Warn().Msg("disk almost full").
+		WithMeta("scope", "store").
+		WithMeta("free", "5%")
+	msg.Timestamp = time.Date(2024, 3, 1, 12, 30, 45, 123000000, time.UTC)
+	return msg
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		format Format
+		golden string
+	}{
+		{FORMAT_TEXT, `2024-03-01T12:30:45.123Z [WARN] daemon: disk almost full {scope=store, free=5%}`},
+		{FORMAT_JSON, `{"level":"WARN","logger":"daemon","message":"disk almost full","meta":{"free":"5%","scope":"store"},"time":"2024-03-01T12:30:45.123Z"}`},
+		{FORMAT_GCP, `{"logger":"daemon","message":"disk almost full","meta":{"free":"5%","scope":"store"},"severity":"WARNING","time":"2024-03-01T12:30:45.123Z"}`},
+		{FORMAT_CLOUDWATCH, `{"Level":"WARN","LogMessages":1,"Logger":"daemon","_aws":{"CloudWatchMetrics":[{"Dimensions":[["Logger","Level"]],"Metrics":[{"Name":"LogMessages","Unit":"Count"}],"Namespace":"ctfjx"}],"Timestamp":1709296245123},"message":"disk almost full","meta":{"free":"5%","scope":"store"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			b, err := Encode(tt.format, "daemon", goldenMessage())
+			require.NoError(t, err)
+			assert.Equal(t, tt.golden+"\n", string(b))
+		})
+	}
+
+	_, err := Encode("xml", "daemon", goldenMessage())
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestEncode_GCPSeverity(t *testing.T) {
+	for level, severity := range map[log.Level]string{
+		log.DEBUG:    "DEBUG",
+		log.INFO:     "INFO",
+		log.WARN:     "WARNING",
+		log.ERROR:    "ERROR",
+		log.Level(9): "DEFAULT",
+	} {
+		msg := goldenMessage()
+		msg.Level = level
+		b, err := Encode(FORMAT_GCP, "daemon", msg)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `"severity":"`+severity+`"`, level)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe to read while a handler writes it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFormatHandler(t *testing.T) {
+	var out lockedBuffer
+	h := NewFormatHandler(&out, FORMAT_JSON)
+
+	h.Handle("daemon", goldenMessage())
+	assert.Empty(t, out.String(), "messages before Start are dropped")
+
+	require.NoError(t, h.Start())
+	for _, name := range []string{"daemon", "agent", "daemon"} {
+		h.Handle(name, goldenMessage())
+	}
+	require.NoError(t, h.Close())
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 3, "closing handles the queued messages")
+	for i, name := range []string{"daemon", "agent", "daemon"} {
+		assert.Contains(t, lines[i], `"logger":"`+name+`"`, "in order, each with its own logger")
+		assert.Contains(t, lines[i], `"meta":{"free":"5%","scope":"store"}`, "and nothing else in its meta")
+	}
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lattesec/log"
+)
+
+var ErrLoggerNotFound = errors.New("logger not found")
+
+// LevelRequest is the body accepted by LevelsHTTPHandler on PUT
+type LevelRequest struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+}
+
+// LevelsResponse maps logger names to their current level
+type LevelsResponse struct {
+	Loggers map[string]string `json:"loggers"`
+}
+
+// LevelsHTTPHandler reports the level of every registered logger
+// on GET, and changes the level of one logger on PUT, so DEBUG
+// can be enabled for a single subsystem while it is running.
+//
+// The default logger is always included. The handler performs no
+// authentication and must only be mounted on an admin listener.
+func LevelsHTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			if err := setLevel(w, r); err != nil {
+				var tooLarge *http.MaxBytesError
+				status := http.StatusBadRequest
+				switch {
+				case errors.Is(err, ErrLoggerNotFound):
+					status = http.StatusNotFound
+				case errors.As(err, &tooLarge):
+					status = http.StatusRequestEntityTooLarge
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(currentLevels()); err != nil {
+			log.Error().
+				WithMeta("scope", "logging").
+				Msgf("failed to write levels response: %v", err).Send()
+		}
+	})
+}
+
+func setLevel(w http.ResponseWriter, r *http.Request) error {
+	var req LevelRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	level, err := ParseLevel(req.Level)
+	if err != nil {
+		return err
+	}
+
+	l := lookup(req.Logger)
+	if l == nil {
+		return fmt.Errorf("%w: %q", ErrLoggerNotFound, req.Logger)
+	}
+
+	if err := l.SetLevel(level); err != nil {
+		return err
+	}
+
+	log.Info().
+		WithMeta("scope", "logging").
+		WithMeta("logger", req.Logger).
+		WithMeta("level", LevelName(level)).
+		Msg("log level changed").Send()
+	return nil
+}
+
+func lookup(name string) *log.Logger {
+	if l, ok := Get(name); ok {
+		return l
+	}
+	if def := log.DefaultLogger(); def.GetName() == name {
+		return def
+	}
+	return nil
+}
+
+func currentLevels() LevelsResponse {
+	resp := LevelsResponse{Loggers: make(map[string]string)}
+
+	def := log.DefaultLogger()
+	resp.Loggers[def.GetName()] = LevelName(def.GetLevel())
+
+	for _, name := range Names() {
+		if l, ok := Get(name); ok {
+			resp.Loggers[name] = LevelName(l.GetLevel())
+		}
+	}
+	return resp
+}
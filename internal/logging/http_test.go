@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelsHTTPHandler(t *testing.T) {
+	l, err := log.NewLogger().Name("http-test").WithLevel(log.WARN).Build()
+	require.NoError(t, err)
+	Register(l)
+	defer Unregister("http-test")
+
+	h := LevelsHTTPHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"logger":"http-test","level":"debug"}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, log.DEBUG, l.GetLevel())
+
+	var resp LevelsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "DEBUG", resp.Loggers["http-test"])
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"logger":"missing","level":"debug"}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	big := `{"logger":"http-test","level":"debug","pad":"` + strings.Repeat("x", 1<<10) + `"}`
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(big)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
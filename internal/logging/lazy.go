@@ -0,0 +1,28 @@
+package logging
+
+import "github.com/lattesec/log"
+
+// Enabled reports whether l accepts messages of the given level.
+// A nil logger means the default logger.
+func Enabled(l *log.Logger, level log.Level) bool {
+	if l == nil {
+		l = log.DefaultLogger()
+	}
+	return level >= l.GetLevel()
+}
+
+// WithLazy attaches the value returned by fn under key, but only
+// calls fn when the level of l accepts the message's level.
+//
+// Metadata is formatted as soon as it is attached, so expensive
+// values (stack dumps, large structs) would otherwise be computed
+// for messages that are dropped anyway. The level of l is all that
+// is checked: fn is called for messages that a Filter or another
+// stage of a PipelineHandler drops later. Set the message's level
+// before calling WithLazy. A nil logger means the default logger.
+func WithLazy(lm *log.LogMessage, l *log.Logger, key string, fn func() any) *log.LogMessage {
+	if !Enabled(l, lm.Level) {
+		return lm
+	}
+	return lm.WithMeta(key, fn())
+}
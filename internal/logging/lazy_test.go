@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnabled(t *testing.T) {
+	l, err := log.NewLogger().WithLevel(log.WARN).Build()
+	require.NoError(t, err)
+
+	assert.False(t, Enabled(l, log.INFO))
+	assert.True(t, Enabled(l, log.WARN), "the level itself is enabled")
+	assert.True(t, Enabled(l, log.ERROR))
+
+	require.NoError(t, l.SetLevel(log.QUIET))
+	assert.False(t, Enabled(l, log.ERROR), "quiet loggers accept nothing")
+
+	assert.Equal(t, log.DefaultLogger().GetLevel() <= log.ERROR, Enabled(nil, log.ERROR), "nil means the default logger")
+}
+
+func TestWithLazy(t *testing.T) {
+	l, err := log.NewLogger().WithLevel(log.INFO).Build()
+	require.NoError(t, err)
+	calls := 0
+	dump := func() any {
+		calls++
+		return "expensive"
+	}
+
+	msg := log.NewLogMessage().Debug()
+	assert.Same(t, msg, WithLazy(msg, l, "dump", dump))
+	assert.Equal(t, 0, calls, "dropped messages do not compute their values")
+	assert.Empty(t, msg.Meta)
+
+	msg = WithLazy(log.NewLogMessage().Info(), l, "dump", dump)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []log.LogMessageMetaKV{{K: "dump", V: "expensive"}}, msg.Meta)
+
+	require.NoError(t, l.SetLevel(log.DEBUG))
+	WithLazy(log.NewLogMessage().Debug(), l, "dump", dump)
+	assert.Equal(t, 2, calls, "the current level is checked")
+
+	calls = 0
+	WithLazy(log.NewLogMessage().Info(), l, "dump", dump).Debug()
+	assert.Equal(t, 1, calls, "against the level the message had when called")
+}
+
+func TestWithLazy_Stages(t *testing.T) {
+	l, err := log.NewLogger().WithLevel(log.DEBUG).Build()
+	require.NoError(t, err)
+	calls := 0
+
+	msg := WithLazy(log.NewLogMessage().Info(), l, "dump", func() any { calls++; return "" })
+	assert.Nil(t, MinLevel(log.ERROR)("lazy-test", msg))
+	assert.Equal(t, 1, calls, "only the level of the logger is checked")
+}
@@ -0,0 +1,14 @@
+// Logging package extends github.com/lattesec/log with handlers
+// and helpers specific to ctfjx.
+//
+// Usage:
+//
+//	logger, err := log.NewLogger().
+//		WithLevel(log.DEBUG).
+//		WithStdout(false).
+//		WithHandlers(
+//			logging.Pipeline(log.NewWriterHandler(os.Stdout), logging.MinLevel(log.INFO)),
+//			logging.Pipeline(fileHandler, logging.MinLevel(log.DEBUG)),
+//		).
+//		Build()
+package logging
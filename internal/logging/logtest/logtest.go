@@ -0,0 +1,137 @@
+// Logtest package captures log messages so tests
+// can assert on what was logged.
+//
+// Usage:
+//
+//	logger, capture := logtest.NewLogger(t, log.DEBUG)
+//	conn.RegisterLogger(logger)
+//	...
+//	assert.True(t, capture.Contains(log.ERROR, "tls wrap failed"))
+package logtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lattesec/log"
+)
+
+type Entry struct {
+	Logger  string
+	Level   log.Level
+	Message string
+	Meta    []log.LogMessageMetaKV
+}
+
+// Capture is a log handler that records every message it receives.
+//
+// Messages are recorded synchronously, so they can be
+// asserted on as soon as Send returns.
+type Capture struct {
+	mu      sync.RWMutex
+	running bool
+	entries []Entry
+}
+
+func NewCapture() *Capture {
+	return &Capture{}
+}
+
+// NewLogger builds and starts a logger that only writes to the
+// returned capture. The logger is closed when the test ends.
+func NewLogger(t testing.TB, level log.Level) (*log.Logger, *Capture) {
+	t.Helper()
+
+	c := NewCapture()
+	logger, err := log.NewLogger().
+		Name(t.Name()).
+		WithLevel(level).
+		WithStdout(false).
+		WithStderr(false).
+		WithHandlers(c).
+		Build()
+	if err != nil {
+		t.Fatalf("failed to build capture logger: %v", err)
+	}
+	if err := logger.Start(); err != nil {
+		t.Fatalf("failed to start capture logger: %v", err)
+	}
+
+	t.Cleanup(func() { _ = logger.Close() })
+	return logger, c
+}
+
+func (c *Capture) Handle(loggerName string, msg *log.LogMessage) {
+	if msg == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, Entry{
+		Logger:  loggerName,
+		Level:   msg.Level,
+		Message: msg.Message,
+		Meta:    append([]log.LogMessageMetaKV(nil), msg.Meta...),
+	})
+}
+
+func (c *Capture) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		return log.ErrAlreadyStarted
+	}
+	c.running = true
+	return nil
+}
+
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = false
+	return nil
+}
+
+func (c *Capture) IsRunning() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.running
+}
+
+// Entries returns a copy of every recorded message
+func (c *Capture) Entries() []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Entry(nil), c.entries...)
+}
+
+// Contains reports whether a message of the given level
+// containing substr was recorded
+func (c *Capture) Contains(level log.Level, substr string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, e := range c.entries {
+		if e.Level == level && strings.Contains(e.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// MetaValue returns the value of the first metadata entry with the given key
+func (e Entry) MetaValue(key string) (string, bool) {
+	for _, kv := range e.Meta {
+		if kv.K == key {
+			return kv.V, true
+		}
+	}
+	return "", false
+}
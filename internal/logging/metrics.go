@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/lattesec/log"
+)
+
+const METRICS_PREFIX = "ctfjx_log"
+
+/*
+Metrics are published through expvar under "ctfjx_log", and
+in the Prometheus text format through MetricsHTTPHandler.
+
+Messages dropped by the handlers of github.com/lattesec/log
+when their queue is full are not visible from here, so only
+messages that reached a MetricsHandler are counted. Messages
+dropped by a stage of a PipelineHandler, such as a Filter, or
+by a full FileHandler or FormatHandler are counted by logger,
+those below the level of their logger are never built and not
+counted.
+*/
+var (
+	metrics         = expvar.NewMap(METRICS_PREFIX)
+	messagesByLevel = new(expvar.Map).Init()
+	messagesDropped = new(expvar.Map).Init() // by logger
+	fileWriteErrors = new(expvar.Int)
+	fileReopens     = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("messages_total", messagesByLevel)
+	metrics.Set("messages_dropped_total", messagesDropped)
+	metrics.Set("file_write_errors_total", fileWriteErrors)
+	metrics.Set("file_reopens_total", fileReopens)
+}
+
+// MetricsHandler counts the messages it receives by level.
+// Add it to a logger to have its messages counted.
+type MetricsHandler struct {
+	mu      sync.RWMutex
+	running bool
+}
+
+func NewMetricsHandler() *MetricsHandler {
+	return &MetricsHandler{}
+}
+
+func (m *MetricsHandler) Handle(_ string, msg *log.LogMessage) {
+	if msg == nil || !m.IsRunning() {
+		return
+	}
+	messagesByLevel.Add(msg.LevelString(), 1)
+}
+
+func (m *MetricsHandler) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return log.ErrAlreadyStarted
+	}
+	m.running = true
+	return nil
+}
+
+func (m *MetricsHandler) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running = false
+	return nil
+}
+
+func (m *MetricsHandler) IsRunning() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.running
+}
+
+// MetricsHTTPHandler serves the logging metrics
+// in the Prometheus text exposition format
+func MetricsHTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintf(w, "# TYPE %s_messages_total counter\n", METRICS_PREFIX)
+		for _, level := range keys(messagesByLevel) {
+			fmt.Fprintf(w, "%s_messages_total{level=%q} %s\n", METRICS_PREFIX, level, messagesByLevel.Get(level))
+		}
+
+		fmt.Fprintf(w, "# TYPE %s_messages_dropped_total counter\n", METRICS_PREFIX)
+		for _, logger := range keys(messagesDropped) {
+			fmt.Fprintf(w, "%s_messages_dropped_total{logger=%q} %s\n", METRICS_PREFIX, logger, messagesDropped.Get(logger))
+		}
+
+		fmt.Fprintf(w, "# TYPE %s_file_write_errors_total counter\n", METRICS_PREFIX)
+		fmt.Fprintf(w, "%s_file_write_errors_total %d\n", METRICS_PREFIX, fileWriteErrors.Value())
+
+		fmt.Fprintf(w, "# TYPE %s_file_reopens_total counter\n", METRICS_PREFIX)
+		fmt.Fprintf(w, "%s_file_reopens_total %d\n", METRICS_PREFIX, fileReopens.Value())
+	})
+}
+
+// keys returns the keys of m, sorted
+func keys(m *expvar.Map) []string {
+	var out []string
+	m.Do(func(kv expvar.KeyValue) {
+		out = append(out, kv.Key)
+	})
+	sort.Strings(out)
+	return out
+}
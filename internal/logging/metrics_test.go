@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"expvar"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/logging/logtest"
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// count returns the counter under key in m, zero if missing
+func count(t *testing.T, m *expvar.Map, key string) int64 {
+	t.Helper()
+	v := m.Get(key)
+	if v == nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(v.String(), 10, 64)
+	require.NoError(t, err)
+	return n
+}
+
+func TestMetricsHandler(t *testing.T) {
+	h := NewMetricsHandler()
+	msg := log.NewLogMessage().Error().Msg("counted")
+	level := msg.LevelString()
+	before := count(t, messagesByLevel, level)
+
+	h.Handle("metrics-test", msg)
+	assert.Equal(t, before, count(t, messagesByLevel, level), "nothing is counted before Start")
+
+	require.NoError(t, h.Start())
+	assert.ErrorIs(t, h.Start(), log.ErrAlreadyStarted)
+	h.Handle("metrics-test", msg)
+	h.Handle("metrics-test", nil)
+	assert.Equal(t, before+1, count(t, messagesByLevel, level))
+
+	require.NoError(t, h.Close())
+	assert.False(t, h.IsRunning())
+	h.Handle("metrics-test", msg)
+	assert.Equal(t, before+1, count(t, messagesByLevel, level), "nor after Close")
+}
+
+func TestMetricsHTTPHandler(t *testing.T) {
+	h := NewMetricsHandler()
+	require.NoError(t, h.Start())
+	defer h.Close()
+	h.Handle("metrics-test", log.NewLogMessage().Warn())
+	h.Handle("metrics-test", log.NewLogMessage().Debug())
+
+	rec := httptest.NewRecorder()
+	MetricsHTTPHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.Equal(t, "text/plain; version=0.0.4", rec.Header().Get("Content-Type"))
+
+	debug := log.NewLogMessage().Debug().LevelString()
+	warn := log.NewLogMessage().Warn().LevelString()
+	assert.Contains(t, body, "# TYPE ctfjx_log_messages_total counter\n")
+	assert.Contains(t, body, `ctfjx_log_messages_total{level="`+warn+`"} `+strconv.FormatInt(count(t, messagesByLevel, warn), 10)+"\n")
+	assert.Less(t, strings.Index(body, `level="`+debug+`"`), strings.Index(body, `level="`+warn+`"`), "levels are sorted")
+	assert.Contains(t, body, "ctfjx_log_file_write_errors_total "+strconv.FormatInt(fileWriteErrors.Value(), 10)+"\n")
+}
+
+func TestMetrics_Dropped(t *testing.T) {
+	capture := logtest.NewCapture()
+	p := Pipeline(capture, MinLevel(log.INFO))
+	require.NoError(t, p.Start())
+	defer p.Close()
+
+	before := count(t, messagesDropped, "dropped-test")
+	p.Handle("dropped-test", log.NewLogMessage().Debug().Msg("too low"))
+	p.Handle("dropped-test", log.NewLogMessage().Info().Msg("kept"))
+	p.Handle("other-test", log.NewLogMessage().Debug().Msg("too low"))
+
+	assert.Len(t, capture.Entries(), 1)
+	assert.Equal(t, before+1, count(t, messagesDropped, "dropped-test"), "drops are counted by logger")
+
+	rec := httptest.NewRecorder()
+	MetricsHTTPHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "# TYPE ctfjx_log_messages_dropped_total counter\n")
+	assert.Contains(t, rec.Body.String(), `ctfjx_log_messages_dropped_total{logger="dropped-test"} `+strconv.FormatInt(before+1, 10)+"\n")
+}
+
+func TestFromEnv_Metrics(t *testing.T) {
+	t.Setenv(CTFJX_LOG_LEVEL_ENV, "WARN")
+	l, err := FromEnv("metrics-env-test")
+	require.NoError(t, err)
+	l.Stdout(false)
+	l.Stderr(false)
+	require.NoError(t, l.Start())
+	defer l.Close()
+
+	level := log.NewLogMessage().Error().LevelString()
+	before := count(t, messagesByLevel, level)
+	l.Error().Msg("counted").Send()
+	assert.Equal(t, before+1, count(t, messagesByLevel, level), "loggers from the environment count their messages")
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"github.com/lattesec/ctfjx/internal/helpers/cleanup"
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/log"
+)
+
+// Swapped out in tests
+var (
+	osExit   = os.Exit
+	syncLogs = log.Sync
+)
+
+var installPanicHook sync.Once
+
+// InstallPanicHandler makes the panics that nopanic recovers in
+// goroutines flush the log files, and returns the handler to defer
+// at the top of main, see HandlePanic:
+//
+//	func main() {
+//		defer logging.InstallPanicHandler()()
+//		...
+//	}
+func InstallPanicHandler() func() {
+	installPanicHook.Do(func() {
+		nopanic.RegisterHook(func(nopanic.Panic) { flushLogFiles() })
+	})
+	return HandlePanic
+}
+
+// HandlePanic logs a recovered panic with its stack, flushes the log
+// files, runs the cleanups, flushes every log handler and then
+// re-panics.
+//
+// A panic otherwise loses every buffered log line. It has to be
+// deferred directly at the top of main and of every goroutine:
+//
+//	defer logging.HandlePanic()
+func HandlePanic() {
+	if r := recover(); r != nil {
+		handlePanic(r)
+		panic(r)
+	}
+}
+
+// HandlePanicExit is HandlePanic, but exits with code
+// instead of re-panicking
+//
+//	defer logging.HandlePanicExit(2)
+func HandlePanicExit(code int) {
+	if r := recover(); r != nil {
+		handlePanic(r)
+		osExit(code)
+	}
+}
+
+func handlePanic(r any) {
+	log.Error().
+		WithMeta("panic", r).
+		WithMeta("stack", string(debug.Stack())).
+		Msgf("panic: %v", r).Send()
+
+	// before the cleanups too, which may hang or panic themselves
+	flushLogFiles()
+	cleanup.RunErrorCleanup()
+	cleanup.RunCleanup()
+	flushLogFiles()
+	syncLogs()
+}
+
+func flushLogFiles() {
+	if err := flushFileHandlers(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to flush log files: %v\n", err)
+	}
+}
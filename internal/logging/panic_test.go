@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/cleanup"
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/ctfjx/internal/logging/logtest"
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bufferedLog starts a file handler that only flushes when
+// asked and hands it a line, returning the path of its file
+func bufferedLog(t *testing.T) string {
+	t.Helper()
+	pth := filepath.Join(t.TempDir(), "panic.log")
+	fh := NewFileHandler(pth)
+	fh.SetFlushInterval(time.Hour)
+	require.NoError(t, fh.Start())
+	t.Cleanup(func() { _ = fh.Close() })
+
+	fh.Handle("test", log.NewLogMessage().Info().Msg("before the panic"))
+	time.Sleep(50 * time.Millisecond)
+	return pth
+}
+
+func TestHandlePanic(t *testing.T) {
+	prev := log.DefaultLogger()
+	defer log.Register(prev)
+	l, capture := logtest.NewLogger(t, log.DEBUG)
+	log.Register(l)
+	pth := bufferedLog(t)
+
+	var steps []string
+	id := cleanup.Register("panic-test", func() error {
+		if data, _ := os.ReadFile(pth); len(data) > 0 {
+			steps = append(steps, "flushed")
+		}
+		steps = append(steps, "cleanup")
+		return nil
+	})
+	defer cleanup.Unregister(id)
+	syncLogs = func() { steps = append(steps, "sync") }
+	defer func() { syncLogs = log.Sync }()
+
+	func() {
+		defer HandlePanic()
+	}()
+	assert.Empty(t, steps, "nothing happens without a panic")
+	assert.Empty(t, capture.Entries())
+
+	var repanicked any
+	func() {
+		defer func() { repanicked = recover() }()
+		defer InstallPanicHandler()()
+		panic("boom")
+	}()
+
+	assert.Equal(t, "boom", repanicked, "the panic goes on")
+	assert.Equal(t, []string{"flushed", "cleanup", "sync"}, steps, "log files are flushed before the cleanups run")
+
+	entries := capture.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, log.ERROR, entries[0].Level)
+	assert.Equal(t, "panic: boom", entries[0].Message)
+	stack, _ := entries[0].MetaValue("stack")
+	assert.Contains(t, stack, "TestHandlePanic", "with the stack of the panic")
+}
+
+func TestHandlePanicExit(t *testing.T) {
+	var steps []string
+	id := cleanup.Register("panic-test", func() error { steps = append(steps, "cleanup"); return nil })
+	defer cleanup.Unregister(id)
+	osExit = func(code int) { steps = append(steps, "exit "+strconv.Itoa(code)) }
+	defer func() { osExit = os.Exit }()
+
+	func() {
+		defer HandlePanicExit(2)
+		panic("boom")
+	}()
+	assert.Equal(t, []string{"cleanup", "exit 2"}, steps, "exits instead of panicking again")
+}
+
+func TestInstallPanicHandler_Goroutines(t *testing.T) {
+	pth := bufferedLog(t)
+	InstallPanicHandler()
+	InstallPanicHandler() // installing twice is fine
+
+	_ = nopanic.NoPanicRunErr("worker", func() error { panic("boom") })
+
+	data, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "before the panic", "panics recovered by nopanic flush the log files")
+}
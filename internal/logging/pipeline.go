@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"sync"
+
+	"github.com/lattesec/log"
+)
+
+// Stage inspects or transforms a message before it reaches
+// the wrapped handler. Returning nil drops the message, which
+// counts towards the dropped messages of the logger.
+//
+// Messages are shared between every handler of a logger, so
+// stages must Clone a message before modifying it.
+type Stage func(loggerName string, msg *log.LogMessage) *log.LogMessage
+
+// PipelineHandler runs messages through a set of stages
+// before passing them on to the wrapped handler
+type PipelineHandler struct {
+	mu     sync.RWMutex
+	inner  log.LogHandler
+	stages []Stage
+}
+
+func Pipeline(h log.LogHandler, stages ...Stage) *PipelineHandler {
+	return &PipelineHandler{
+		inner:  h,
+		stages: stages,
+	}
+}
+
+// Use appends stages to the pipeline
+func (p *PipelineHandler) Use(stages ...Stage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stages = append(p.stages, stages...)
+}
+
+func (p *PipelineHandler) Handle(loggerName string, msg *log.LogMessage) {
+	p.mu.RLock()
+	stages := p.stages
+	p.mu.RUnlock()
+
+	for _, stage := range stages {
+		if msg = stage(loggerName, msg); msg == nil {
+			messagesDropped.Add(loggerName, 1)
+			return
+		}
+	}
+	p.inner.Handle(loggerName, msg)
+}
+
+func (p *PipelineHandler) Start() error    { return p.inner.Start() }
+func (p *PipelineHandler) Close() error    { return p.inner.Close() }
+func (p *PipelineHandler) IsRunning() bool { return p.inner.IsRunning() }
+
+// Clone returns a copy of msg that can be safely modified
+func Clone(msg *log.LogMessage) *log.LogMessage {
+	cp := *msg
+	cp.Meta = append([]log.LogMessageMetaKV(nil), msg.Meta...)
+	return &cp
+}
+
+// MinLevel drops messages below the given level
+//
+// The logger's own level is applied first, so it has to be
+// set to the lowest level any of its handlers accepts.
+func MinLevel(level log.Level) Stage {
+	return func(_ string, msg *log.LogMessage) *log.LogMessage {
+		if msg.Level < level {
+			return nil
+		}
+		return msg
+	}
+}
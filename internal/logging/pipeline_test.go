@@ -0,0 +1,35 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline_MinLevel(t *testing.T) {
+	var debugBuf, errorBuf bytes.Buffer
+
+	l, err := log.NewLogger().
+		WithLevel(log.DEBUG).
+		WithStdout(false).
+		WithStderr(false).
+		WithHandlers(
+			Pipeline(log.NewWriterHandler(&debugBuf), MinLevel(log.DEBUG)),
+			Pipeline(log.NewWriterHandler(&errorBuf), MinLevel(log.ERROR)),
+		).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, l.Start())
+
+	l.Debug().Msg("debug msg").Send()
+	l.Error().Msg("error msg").Send()
+	require.NoError(t, l.Close())
+
+	assert.Contains(t, debugBuf.String(), "debug msg")
+	assert.Contains(t, debugBuf.String(), "error msg")
+	assert.NotContains(t, errorBuf.String(), "debug msg")
+	assert.Contains(t, errorBuf.String(), "error msg")
+}
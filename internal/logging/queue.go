@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/log"
+)
+
+const QUEUE_SIZE = 1 << 10
+
+// entry is a queued message and the name of its logger
+type entry struct {
+	loggerName string
+	msg        *log.LogMessage
+}
+
+// queue hands messages to a handler on its own goroutine, in order,
+// like log.BaseHandler. log.BaseHandler only passes a copy of the
+// message to its HandleFunc, which hides the name of the logger the
+// formats need, so handlers built on it queue their messages here
+// and run drain as one of their Subprocesses instead.
+type queue struct {
+	entries chan entry
+	handle  func(loggerName string, msg *log.LogMessage) error
+}
+
+func newQueue(handle func(loggerName string, msg *log.LogMessage) error) *queue {
+	return &queue{
+		entries: make(chan entry, QUEUE_SIZE),
+		handle:  handle,
+	}
+}
+
+// push queues a copy of msg, dropping it if the queue is full
+func (q *queue) push(loggerName string, msg *log.LogMessage) {
+	select {
+	case q.entries <- entry{loggerName: loggerName, msg: Clone(msg)}:
+	default:
+		messagesDropped.Add(loggerName, 1)
+	}
+}
+
+// drain handles the queued messages until ctx is done, and then
+// the ones left, so that closing the handler loses none of them
+func (q *queue) drain(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-q.entries:
+					q.run(e)
+				default:
+					return nil
+				}
+			}
+
+		case e := <-q.entries:
+			q.run(e)
+		}
+	}
+}
+
+func (q *queue) run(e entry) {
+	err := nopanic.NoPanicRunErr("log-handler", func() error {
+		return q.handle(e.loggerName, e.msg)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error in logger: %v\n", err)
+	}
+}
+
+// handled stands in for the HandleFunc log.BaseHandler requires,
+// it is never called as messages go through a queue
+func handled(context.Context, *log.LogMessage) error { return nil }
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/lattesec/log"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]*log.Logger)
+)
+
+// Register adds l to the registry under its name,
+// replacing any logger already registered with that name
+func Register(l *log.Logger) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[l.GetName()] = l
+}
+
+func Unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, name)
+}
+
+// Get returns the logger registered under name
+func Get(name string) (*log.Logger, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	l, ok := registry[name]
+	return l, ok
+}
+
+// Named returns the logger registered under name,
+// falling back to the default logger
+func Named(name string) *log.Logger {
+	if l, ok := Get(name); ok {
+		return l
+	}
+	return log.DefaultLogger()
+}
+
+// Names returns the names of every registered logger, sorted
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefault registers l and makes it the logger
+// used by the package-level log functions
+func SetDefault(l *log.Logger) {
+	Register(l)
+	log.Register(l)
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/logging/logtest"
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// named builds a logger that is never started
+func named(t *testing.T, name string) *log.Logger {
+	t.Helper()
+	l, err := log.NewLogger().Name(name).Build()
+	require.NoError(t, err)
+	return l
+}
+
+func TestRegistry(t *testing.T) {
+	first, second := named(t, "registry-test"), named(t, "registry-test")
+	other := named(t, "registry-test-other")
+	defer Unregister("registry-test")
+	defer Unregister("registry-test-other")
+
+	_, ok := Get("registry-test")
+	assert.False(t, ok)
+	assert.Same(t, log.DefaultLogger(), Named("registry-test"), "unknown names fall back to the default logger")
+
+	Register(other)
+	Register(first)
+	l, ok := Get("registry-test")
+	require.True(t, ok)
+	assert.Same(t, first, l)
+	assert.Same(t, first, Named("registry-test"))
+
+	Register(second)
+	assert.Same(t, second, Named("registry-test"), "registering a name again replaces the logger")
+
+	Unregister("registry-test")
+	_, ok = Get("registry-test")
+	assert.False(t, ok)
+	assert.Same(t, other, Named("registry-test-other"), "only the name given is removed")
+	Unregister("registry-test") // unregistering twice is fine
+}
+
+func TestRegistry_Names(t *testing.T) {
+	for _, name := range []string{"names-test-c", "names-test-a", "names-test-b"} {
+		Register(named(t, name))
+		defer Unregister(name)
+	}
+
+	var ours []string
+	for _, name := range Names() {
+		if strings.HasPrefix(name, "names-test-") {
+			ours = append(ours, name)
+		}
+	}
+	assert.Equal(t, []string{"names-test-a", "names-test-b", "names-test-c"}, ours, "sorted")
+
+	names := Names()
+	names[0] = "changed"
+	assert.NotContains(t, Names(), "changed", "the names are a copy")
+}
+
+func TestSetDefault(t *testing.T) {
+	prev := log.DefaultLogger()
+	defer log.Register(prev)
+
+	l, capture := logtest.NewLogger(t, log.DEBUG)
+	SetDefault(l)
+	defer Unregister(l.GetName())
+
+	assert.Same(t, l, log.DefaultLogger())
+	assert.Same(t, l, Named(l.GetName()), "the default logger is registered too")
+	assert.Same(t, l, Named("no-such-logger"))
+
+	log.Info().Msg("through the package").Send()
+	assert.True(t, capture.Contains(log.INFO, "through the package"))
+}
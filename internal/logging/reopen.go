@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/log"
+)
+
+// Reopen reopens the files of every running FileHandler
+func Reopen() error {
+	var errs []error
+	openFileHandlers.Range(func(k, _ any) bool {
+		f := k.(*FileHandler)
+		if err := f.Reopen(); err != nil && !errors.Is(err, ErrFileNotOpen) {
+			errs = append(errs, fmt.Errorf("failed to reopen %s: %w", f.Path(), err))
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// Flush flushes every running FileHandler and then
+// syncs the registered loggers
+func Flush() error {
+	err := flushFileHandlers()
+	log.Sync()
+	return err
+}
+
+func flushFileHandlers() error {
+	var errs []error
+	openFileHandlers.Range(func(k, _ any) bool {
+		f := k.(*FileHandler)
+		if err := f.Flush(); err != nil && !errors.Is(err, ErrFileNotOpen) {
+			errs = append(errs, fmt.Errorf("failed to flush %s: %w", f.Path(), err))
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// AutoReopen watches for SIGHUP and reopens every log file,
+// for use alongside logrotate without copytruncate
+func AutoReopen() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+		for range ch {
+			err := nopanic.NoPanicRunErr("log-sighup-reopen", Reopen)
+			if err != nil {
+				log.Error().
+					WithMeta("scope", "logging").
+					Msgf("failed to reopen log files: %v", err).Send()
+				continue
+			}
+
+			log.Info().
+				WithMeta("scope", "logging").
+				Msg("received SIGHUP, reopened log files").Send()
+		}
+	}()
+}
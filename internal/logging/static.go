@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/lattesec/ctfjx/version"
+	"github.com/lattesec/log"
+)
+
+// StaticFields returns the fields identifying this process,
+// so aggregated logs from many machines stay attributable
+//
+// [role] should be the binary's role, e.g. "daemon" or "agent".
+func StaticFields(role string) []log.LogMessageMetaKV {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "???"
+	}
+
+	info := version.Get()
+	return []log.LogMessageMetaKV{
+		{K: "host", V: hostname},
+		{K: "pid", V: strconv.Itoa(os.Getpid())},
+		{K: "version", V: info.Version},
+		{K: "commit", V: info.Commit},
+		{K: "role", V: role},
+	}
+}
+
+// WithFields stamps fields on every message
+func WithFields(fields []log.LogMessageMetaKV) Stage {
+	return func(_ string, msg *log.LogMessage) *log.LogMessage {
+		if len(fields) == 0 {
+			return msg
+		}
+
+		msg = Clone(msg)
+		msg.Meta = append(msg.Meta, fields...)
+		return msg
+	}
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/lattesec/ctfjx/version"
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticFields(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	info := version.Get()
+
+	assert.Equal(t, []log.LogMessageMetaKV{
+		{K: "host", V: hostname},
+		{K: "pid", V: strconv.Itoa(os.Getpid())},
+		{K: "version", V: info.Version},
+		{K: "commit", V: info.Commit},
+		{K: "role", V: "agent"},
+	}, StaticFields("agent"))
+}
+
+func TestWithFields(t *testing.T) {
+	stage := WithFields([]log.LogMessageMetaKV{{K: "role", V: "daemon"}})
+	msg := log.NewLogMessage().Warn().Msg("stamped").WithMeta("scope", "test")
+
+	out := stage("static-test", msg)
+	assert.Equal(t, []log.LogMessageMetaKV{{K: "scope", V: "test"}, {K: "role", V: "daemon"}}, out.Meta,
+		"fields go after the message's own")
+	assert.Equal(t, "stamped", out.Message)
+	assert.Len(t, msg.Meta, 1, "the message other handlers get is left alone")
+
+	out = stage("static-test", msg)
+	assert.Len(t, out.Meta, 2, "every message is stamped once")
+
+	assert.Same(t, msg, WithFields(nil)("static-test", msg), "no fields, no copy")
+}
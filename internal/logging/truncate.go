@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"unicode/utf8"
+
+	"github.com/lattesec/log"
+)
+
+const (
+	DEFAULT_MAX_MESSAGE_SIZE = 64 << 10 // 64KB
+	DEFAULT_MAX_META_SIZE    = 4 << 10  // 4KB
+
+	TRUNCATION_MARKER = "…"
+)
+
+// Truncate caps the message at maxMsg bytes and every metadata
+// value at maxMeta bytes. Truncated values end with an ellipsis
+// and the message gets a `truncated=true` field.
+//
+// Set either limit to 0 to disable it.
+func Truncate(maxMsg, maxMeta int) Stage {
+	return func(_ string, msg *log.LogMessage) *log.LogMessage {
+		if !needsTruncation(msg, maxMsg, maxMeta) {
+			return msg
+		}
+
+		msg = Clone(msg)
+		msg.Message = truncateString(msg.Message, maxMsg)
+		for i := range msg.Meta {
+			msg.Meta[i].V = truncateString(msg.Meta[i].V, maxMeta)
+		}
+		return msg.WithMeta("truncated", true)
+	}
+}
+
+func needsTruncation(msg *log.LogMessage, maxMsg, maxMeta int) bool {
+	if maxMsg > 0 && len(msg.Message) > maxMsg {
+		return true
+	}
+	if maxMeta > 0 {
+		for _, kv := range msg.Meta {
+			if len(kv.V) > maxMeta {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Cuts s to at most n bytes without splitting a rune, leaving
+// out the marker when n is too small to hold it
+func truncateString(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	marker := TRUNCATION_MARKER
+	if n < len(marker) {
+		marker = ""
+	}
+	n -= len(marker)
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + marker
+}
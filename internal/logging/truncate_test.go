@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/lattesec/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"no limit", "héllo", 0, "héllo"},
+		{"negative limit", "héllo", -1, "héllo"},
+		{"exactly len", "héllo", len("héllo"), "héllo"},
+		{"under limit", "héllo", 10, "héllo"},
+		{"ascii", "hello world", 8, "hello…"},
+		{"limit 1", "hello", 1, "h"},
+		{"limit 1 in a rune", "€uro", 1, ""},
+		{"only the marker fits", "hello", len(TRUNCATION_MARKER), "…"},
+		{"cut before a 2 byte rune", "abcdé", 5, "ab…"},
+		{"cut inside a 2 byte rune", "abcédef", 7, "abc…"},
+		{"cut inside a 3 byte rune", "a€€€", 6, "a…"},
+		{"cut inside a 4 byte rune", "ab😀cd", 6, "ab…"},
+		{"after a 4 byte rune", "😀😀😀", 9, "😀…"},
+		{"one byte short", "€€€", len("€€€") - 1, "€…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateString(tt.s, tt.n)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, utf8.ValidString(got), "never splits a rune")
+			if tt.n > 0 {
+				assert.LessOrEqual(t, len(got), tt.n)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	stage := Truncate(8, 5)
+
+	msg := log.NewLogMessage().Info().Msg("short").WithMeta("k", "v")
+	assert.Same(t, msg, stage("test", msg), "untouched messages are not copied")
+
+	msg = log.NewLogMessage().Info().Msg("a long message").WithMeta("k", "été!")
+	out := stage("test", msg)
+	require.NotSame(t, msg, out)
+	assert.Equal(t, "a long message", msg.Message, "the original is left alone")
+	assert.Equal(t, "a lon…", out.Message)
+	assert.Equal(t, []log.LogMessageMetaKV{{K: "k", V: "é…"}, {K: "truncated", V: "true"}}, out.Meta)
+
+	out = Truncate(0, 0)("test", log.NewLogMessage().Msg(strings.Repeat("x", DEFAULT_MAX_MESSAGE_SIZE+1)))
+	assert.Len(t, out.Message, DEFAULT_MAX_MESSAGE_SIZE+1, "0 disables the limits")
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/lattesec/log"
+)
+
+// MultiWriter duplicates writes to all of its writers.
+//
+// Unlike io.MultiWriter, a failing writer does not stop
+// the remaining writers from receiving the write.
+type MultiWriter struct {
+	mu      sync.RWMutex
+	writers []io.Writer
+}
+
+func NewMultiWriter(ws ...io.Writer) *MultiWriter {
+	return &MultiWriter{writers: ws}
+}
+
+func (m *MultiWriter) Add(ws ...io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writers = append(m.writers, ws...)
+}
+
+func (m *MultiWriter) Write(p []byte) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var errs []error
+	for i, w := range m.writers {
+		n, err := w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("writer %d: %w", i, err))
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
+
+// Close closes every writer that is an io.Closer,
+// apart from stdout and stderr
+func (m *MultiWriter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, w := range m.writers {
+		if w == os.Stdout || w == os.Stderr {
+			continue
+		}
+		if closer, ok := w.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	m.writers = nil
+	return errors.Join(errs...)
+}
+
+// SetStdout makes every logger's stdout output go to ws
+func SetStdout(ws ...io.Writer) error {
+	old := log.DefaultStdoutHandler.Load()
+	if err := log.RegisterStdoutHandler(log.NewWriterHandler(NewMultiWriter(ws...))); err != nil {
+		return err
+	}
+	return closeReplaced(old)
+}
+
+// SetStderr makes every logger's stderr output go to ws
+func SetStderr(ws ...io.Writer) error {
+	old := log.DefaultStderrHandler.Load()
+	if err := log.RegisterStderrHandler(log.NewWriterHandler(NewMultiWriter(ws...))); err != nil {
+		return err
+	}
+	return closeReplaced(old)
+}
+
+func closeReplaced(h *log.WriterHandler) error {
+	if h == nil {
+		return nil
+	}
+	if err := h.Close(); err != nil && !errors.Is(err, log.ErrNotStarted) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+type shortWriter struct{}
+
+func (shortWriter) Write(b []byte) (int, error) { return len(b) / 2, nil }
+
+// recordingCloser records whether it was closed
+type recordingCloser struct {
+	bytes.Buffer
+	closed bool
+	err    error
+}
+
+func (c *recordingCloser) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestMultiWriter(t *testing.T) {
+	var first, last bytes.Buffer
+	m := NewMultiWriter(&first, failingWriter{})
+	m.Add(shortWriter{}, &last)
+
+	n, err := m.Write([]byte("line\n"))
+	assert.Equal(t, 5, n)
+	assert.ErrorContains(t, err, "writer 1: broken pipe")
+	assert.ErrorContains(t, err, "writer 2: short write")
+	assert.Equal(t, "line\n", first.String())
+	assert.Equal(t, "line\n", last.String(), "failing writers do not stop the others")
+
+	assert.NoError(t, m.Close())
+	n, err = m.Write([]byte("after close\n"))
+	assert.Equal(t, 12, n)
+	assert.NoError(t, err)
+	assert.Equal(t, "line\n", last.String(), "closed writers get nothing")
+}
+
+func TestMultiWriter_Close(t *testing.T) {
+	ok, failing := &recordingCloser{}, &recordingCloser{err: errors.New("already closed")}
+	m := NewMultiWriter(os.Stdout, ok, os.Stderr, failing, &bytes.Buffer{})
+
+	assert.ErrorContains(t, m.Close(), "already closed")
+	assert.True(t, ok.closed)
+	assert.True(t, failing.closed, "every closer is closed, whatever the others return")
+
+	_, err := os.Stdout.Stat()
+	assert.NoError(t, err, "stdout is left open")
+	_, err = os.Stderr.Stat()
+	assert.NoError(t, err, "stderr is left open")
+}
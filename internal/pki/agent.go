@@ -0,0 +1,280 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+const (
+	AGENT_CERT_FILE = "agent.crt"
+	AGENT_KEY_FILE  = "agent.key"
+
+	// How long to wait before retrying a failed renewal
+	RENEW_RETRY_DELAY = time.Minute
+)
+
+var ErrNotEnrolled = errors.New("agent is not enrolled")
+
+// Identity is an agent's certificate, key and the CA it trusts,
+// kept in a directory and rotated before the certificate expires
+type Identity struct {
+	dir string
+	now func() time.Time
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	ca   *x509.Certificate
+
+	responses chan certResponse
+}
+
+// LoadIdentity loads the identity kept in dir, if any
+func LoadIdentity(dir string) (*Identity, error) {
+	id := &Identity{dir: dir, now: time.Now, responses: make(chan certResponse, 1)}
+
+	caPEM, err := os.ReadFile(filepath.Join(dir, CA_CERT_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return id, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if id.ca, err = parseCertPEM(caPEM); err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, AGENT_CERT_FILE), filepath.Join(dir, AGENT_KEY_FILE))
+	if err != nil {
+		return nil, err
+	}
+	id.cert = &cert
+	return id, nil
+}
+
+// Enrolled reports whether the agent has a certificate
+func (id *Identity) Enrolled() bool {
+	id.mu.RLock()
+	defer id.mu.RUnlock()
+	return id.cert != nil
+}
+
+// Name returns the name the CA issued the certificate for
+func (id *Identity) Name() string {
+	id.mu.RLock()
+	defer id.mu.RUnlock()
+	if id.cert == nil {
+		return ""
+	}
+	return id.cert.Leaf.Subject.CommonName
+}
+
+// EnrollTLSConfig trusts the daemon only if its CA has fingerprint,
+// for the first connection, before the agent knows the CA
+func EnrollTLSConfig(fingerprint string) *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true, // verified against the pinned CA below
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, 0, len(rawCerts))
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+			for _, ca := range certs {
+				if Fingerprint(ca) != fingerprint {
+					continue
+				}
+				pool := x509.NewCertPool()
+				pool.AddCert(ca)
+				_, err := certs[0].Verify(x509.VerifyOptions{Roots: pool})
+				return err
+			}
+			return ErrFingerprintPin
+		},
+	}
+}
+
+// TLSConfig returns the agent's mTLS config for the daemon at serverName.
+// Renewed certificates are used for new handshakes right away.
+func (id *Identity) TLSConfig(serverName string) (*tls.Config, error) {
+	id.mu.RLock()
+	defer id.mu.RUnlock()
+	if id.cert == nil {
+		return nil, ErrNotEnrolled
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(id.ca)
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ServerName: serverName,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			id.mu.RLock()
+			defer id.mu.RUnlock()
+			return id.cert, nil
+		},
+	}, nil
+}
+
+// Enroll trades token for a certificate over c, which must be
+// connected with EnrollTLSConfig(fingerprint)
+func (id *Identity) Enroll(ctx context.Context, c *socket.Conn, token, fingerprint string) error {
+	return id.request(ctx, c, socket.ActionEnroll, token, fingerprint)
+}
+
+// Renew replaces the certificate with a fresh one over c,
+// which must be connected with TLSConfig
+func (id *Identity) Renew(ctx context.Context, c *socket.Conn) error {
+	id.mu.RLock()
+	ca := id.ca
+	id.mu.RUnlock()
+	if ca == nil {
+		return ErrNotEnrolled
+	}
+	return id.request(ctx, c, socket.ActionRenewCert, "", Fingerprint(ca))
+}
+
+func (id *Identity) request(ctx context.Context, c *socket.Conn, action socket.Action, token, fingerprint string) error {
+	key, err := NewKey()
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		return err
+	}
+
+	// Drop a stale response of a request that timed out
+	select {
+	case <-id.responses:
+	default:
+	}
+	if err := c.SendJSON(action, enrollRequest{Token: token, CSR: csr}); err != nil {
+		return err
+	}
+
+	var res certResponse
+	select {
+	case res = <-id.responses:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	return id.install(res, key, fingerprint)
+}
+
+// install checks that res is a certificate for key issued by the
+// CA with fingerprint, then keeps and persists it
+func (id *Identity) install(res certResponse, key *ecdsa.PrivateKey, fingerprint string) error {
+	ca, err := x509.ParseCertificate(res.CA)
+	if err != nil {
+		return err
+	}
+	if Fingerprint(ca) != fingerprint {
+		return ErrFingerprintPin
+	}
+	leaf, err := x509.ParseCertificate(res.Cert)
+	if err != nil {
+		return err
+	}
+	pub, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok || !pub.Equal(&key.PublicKey) {
+		return errors.New("certificate is not for the requested key")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotIssuedByCA, err)
+	}
+
+	if err := os.MkdirAll(id.dir, 0o700); err != nil {
+		return err
+	}
+	if err := writeKey(filepath.Join(id.dir, AGENT_KEY_FILE), key); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(id.dir, AGENT_CERT_FILE), EncodeCert(res.Cert), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(id.dir, CA_CERT_FILE), EncodeCert(res.CA), 0o644); err != nil {
+		return err
+	}
+
+	id.mu.Lock()
+	id.cert = &tls.Certificate{Certificate: [][]byte{res.Cert}, PrivateKey: key, Leaf: leaf}
+	id.ca = ca
+	id.mu.Unlock()
+
+	log.Info().
+		WithMeta("scope", "pki").
+		WithMeta("name", leaf.Subject.CommonName).
+		WithMeta("expires", leaf.NotAfter.String()).
+		Msg("installed certificate").Send()
+	return nil
+}
+
+// RunRenewal renews the certificate over c whenever RENEW_AFTER
+// of its lifetime has passed, until ctx is done
+func (id *Identity) RunRenewal(ctx context.Context, c *socket.Conn) {
+	var failed bool
+	for {
+		wait := RENEW_RETRY_DELAY
+		id.mu.RLock()
+		if id.cert != nil && !failed {
+			leaf := id.cert.Leaf
+			lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+			wait = max(0, leaf.NotBefore.Add(time.Duration(float64(lifetime)*RENEW_AFTER)).Sub(id.now()))
+		}
+		id.mu.RUnlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		err := id.Renew(ctx, c)
+		failed = err != nil
+		if err != nil {
+			log.Warn().
+				WithMeta("scope", "pki").
+				Msgf("failed to renew certificate: %v", err).Send()
+		}
+	}
+}
+
+// Handlers serves ActionCertificate
+func (id *Identity) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionCertificate: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var res certResponse
+			if err := json.NewDecoder(r).Decode(&res); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid certificate: %v", err).Send()
+				return
+			}
+			select {
+			case id.responses <- res:
+			default:
+			}
+		},
+	}
+}
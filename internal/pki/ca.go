@@ -0,0 +1,289 @@
+// Pki package is the daemon's internal CA, issuing short-lived
+// certificates to enrolled agents for mTLS on the socket layer.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_CA_TTL          = 10 * 365 * 24 * time.Hour
+	DEFAULT_CERT_TTL        = 24 * time.Hour     // of agent certificates
+	DEFAULT_SERVER_CERT_TTL = 7 * 24 * time.Hour // of the daemon's certificate
+
+	// Certificates are renewed once this much of their lifetime has passed
+	RENEW_AFTER = 2.0 / 3.0
+
+	KEY_FILE_MODE = 0o600
+
+	CA_CERT_FILE = "ca.crt"
+	CA_KEY_FILE  = "ca.key"
+)
+
+var (
+	ErrInvalidCSR     = errors.New("invalid certificate request")
+	ErrNotIssuedByCA  = errors.New("certificate not issued by this CA")
+	ErrFingerprintPin = errors.New("CA does not match the pinned fingerprint")
+)
+
+// CA issues the certificates of the daemon and its agents
+type CA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	now  func() time.Time
+
+	mu     sync.Mutex
+	server *tls.Certificate
+}
+
+// LoadOrCreateCA loads the CA from dir, creating it if it does not exist
+func LoadOrCreateCA(dir string) (*CA, error) {
+	certPath, keyPath := filepath.Join(dir, CA_CERT_FILE), filepath.Join(dir, CA_KEY_FILE)
+
+	certPEM, err := os.ReadFile(certPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return createCA(certPath, keyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := parseCertPEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert: cert, key: key, now: time.Now}, nil
+}
+
+func createCA(certPath, keyPath string) (*CA, error) {
+	key, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "ctfjx internal CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(DEFAULT_CA_TTL),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0o700); err != nil {
+		return nil, err
+	}
+	if err := writeKey(keyPath, key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(certPath, EncodeCert(der), 0o644); err != nil {
+		return nil, err
+	}
+	return &CA{cert: cert, key: key, now: time.Now}, nil
+}
+
+// Certificate returns the CA's certificate
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// Pool returns a pool trusting only this CA
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// Fingerprint identifies the CA by the hash of its public key, as
+// "sha256:<hex>". Agents pin it before they trust the CA.
+func (ca *CA) Fingerprint() string {
+	return Fingerprint(ca.cert)
+}
+
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Issue signs a client certificate for name with the public key
+// of csr, valid for ttl. The CSR's subject is ignored.
+func (ca *CA) Issue(csrDER []byte, name string, ttl time.Duration) ([]byte, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSR, err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSR, err)
+	}
+	return ca.sign(csr.PublicKey, name, nil, ttl, x509.ExtKeyUsageClientAuth)
+}
+
+func (ca *CA) sign(pub any, name string, hosts []string, ttl time.Duration, usage x509.ExtKeyUsage) ([]byte, error) {
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := ca.now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Minute), // tolerate some clock skew
+		NotAfter:     now.Add(ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	return x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+}
+
+// Verify checks that cert was issued by this CA for client auth
+func (ca *CA) Verify(cert *x509.Certificate) error {
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:       ca.Pool(),
+		CurrentTime: ca.now(),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotIssuedByCA, err)
+	}
+	return nil
+}
+
+// ServerTLSConfig returns the daemon's listener config for hosts.
+// Its certificate is reissued before it expires. Client certificates
+// are verified if given, so agents can still connect to enroll, see
+// RequireIdentity for the handlers that must check them.
+func (ca *CA) ServerTLSConfig(hosts ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  ca.Pool(),
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return ca.serverCertificate(hosts)
+		},
+	}
+}
+
+func (ca *CA) serverCertificate(hosts []string) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.server != nil && !needsRenewal(ca.server.Leaf, ca.now()) {
+		return ca.server, nil
+	}
+	key, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	der, err := ca.sign(key.Public(), "ctfjxd", hosts, DEFAULT_SERVER_CERT_TTL, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	// The CA is sent along, so agents pinning its fingerprint can enroll
+	ca.server = &tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key, Leaf: leaf}
+	return ca.server, nil
+}
+
+// needsRenewal reports whether RENEW_AFTER of cert's lifetime has passed
+func needsRenewal(cert *x509.Certificate, now time.Time) bool {
+	if cert == nil {
+		return true
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotBefore.Add(time.Duration(float64(lifetime) * RENEW_AFTER)))
+}
+
+// NewKey generates a P-256 key
+func NewKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func EncodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func parseCertPEM(b []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate in PEM")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), KEY_FILE_MODE)
+}
+
+func parseKeyPEM(b []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no key in PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ec, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA key")
+	}
+	return ec, nil
+}
@@ -0,0 +1,187 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+const DEFAULT_TOKEN_TTL = time.Hour
+
+var (
+	ErrInvalidToken     = errors.New("invalid or expired join token")
+	ErrNotAuthenticated = errors.New("connection has no verified client certificate")
+)
+
+type enrollRequest struct {
+	Token string `json:"token,omitempty"` // only to enroll
+	CSR   []byte `json:"csr"`             // DER
+}
+
+type certResponse struct {
+	Cert  []byte `json:"cert,omitempty"` // DER
+	CA    []byte `json:"ca,omitempty"`   // DER
+	Error string `json:"error,omitempty"`
+}
+
+type joinToken struct {
+	agentId string
+	expires time.Time
+}
+
+// Enroller hands out certificates to agents on the daemon: first
+// for a single-use join token, then to renew a certificate that
+// the agent authenticates with
+type Enroller struct {
+	ca  *CA
+	TTL time.Duration // of the certificates
+
+	mu     sync.Mutex
+	tokens map[string]joinToken // by the hash of the token
+}
+
+func NewEnroller(ca *CA) *Enroller {
+	return &Enroller{ca: ca, TTL: DEFAULT_CERT_TTL, tokens: make(map[string]joinToken)}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken returns a join token that lets agent agentId
+// enroll once within ttl
+func (e *Enroller) NewToken(agentId string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.ca.now()
+	for h, t := range e.tokens {
+		if now.After(t.expires) {
+			delete(e.tokens, h)
+		}
+	}
+	e.tokens[hashToken(token)] = joinToken{agentId: agentId, expires: now.Add(ttl)}
+	return token, nil
+}
+
+// redeem consumes token, returning the agent it was issued for
+func (e *Enroller) redeem(token string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h := hashToken(token)
+	t, ok := e.tokens[h]
+	delete(e.tokens, h)
+	if !ok || e.ca.now().After(t.expires) {
+		return "", ErrInvalidToken
+	}
+	return t.agentId, nil
+}
+
+// PeerIdentity returns the name in the verified client
+// certificate of c, false if it has none
+func PeerIdentity(c *socket.Conn) (string, bool) {
+	state, ok := c.TLSState()
+	if !ok || len(state.VerifiedChains) == 0 {
+		return "", false
+	}
+	return state.PeerCertificates[0].Subject.CommonName, true
+}
+
+// RequireIdentity wraps the daemon's handlers, and the default ones,
+// so that only connections with a verified client certificate are
+// served, but for ActionEnroll which gets agents one. ServerTLSConfig
+// only verifies the certificates that are given, daemons listening
+// with it must serve these handlers.
+func RequireIdentity(handlers map[socket.Action]socket.HandlerFunc) map[socket.Action]socket.HandlerFunc {
+	out := maps.Clone(socket.DefaultConnHandlers)
+	maps.Copy(out, handlers)
+	for action, next := range out {
+		if action == socket.ActionEnroll {
+			continue
+		}
+		out[action] = func(c *socket.Conn, h socket.Header, r io.Reader) {
+			if _, ok := PeerIdentity(c); !ok {
+				c.GenLogMsg().Warn().Msgf("refused action %d: %v", action, ErrNotAuthenticated).Send()
+				if err := c.Send(socket.ActionError, []byte(ErrNotAuthenticated.Error())); err != nil {
+					c.GenLogMsg().Error().Msgf("failed to send error: %v", err).Send()
+				}
+				return
+			}
+			next(c, h, r)
+		}
+	}
+	return out
+}
+
+// Enroll issues a certificate for the agent token was issued for
+func (e *Enroller) Enroll(token string, csr []byte) ([]byte, string, error) {
+	id, err := e.redeem(token)
+	if err != nil {
+		return nil, "", err
+	}
+	cert, err := e.ca.Issue(csr, id, e.TTL)
+	return cert, id, err
+}
+
+// Handlers serves ActionEnroll and ActionRenewCert
+func (e *Enroller) Handlers() map[socket.Action]socket.HandlerFunc {
+	handle := func(renew bool) socket.HandlerFunc {
+		return func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var req enrollRequest
+			if err := json.NewDecoder(r).Decode(&req); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid certificate request: %v", err).Send()
+				return
+			}
+
+			var cert []byte
+			var id string
+			var err error
+			if renew {
+				var ok bool
+				if id, ok = PeerIdentity(c); !ok {
+					err = ErrNotAuthenticated
+				} else {
+					cert, err = e.ca.Issue(req.CSR, id, e.TTL)
+				}
+			} else {
+				cert, id, err = e.Enroll(req.Token, req.CSR)
+			}
+
+			res := certResponse{Cert: cert, CA: e.ca.cert.Raw}
+			if err != nil {
+				res = certResponse{Error: err.Error()}
+				c.GenLogMsg().Warn().Msgf("refused certificate: %v", err).Send()
+			} else {
+				log.Info().
+					WithMeta("scope", "pki").
+					WithMeta("agent", id).
+					WithMeta("renew", renew).
+					Msg("issued certificate").Send()
+			}
+			if err := c.SendJSON(socket.ActionCertificate, res); err != nil {
+				c.GenLogMsg().Error().Msgf("failed to send certificate: %v", err).Send()
+			}
+		}
+	}
+
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionEnroll:    handle(false),
+		socket.ActionRenewCert: handle(true),
+	}
+}
@@ -0,0 +1,128 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/ctfjx/internal/socket/sockettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrollAndRenew(t *testing.T) {
+	caDir := t.TempDir()
+	ca, err := LoadOrCreateCA(caDir)
+	require.NoError(t, err)
+	reloaded, err := LoadOrCreateCA(caDir)
+	require.NoError(t, err)
+	assert.Equal(t, ca.Fingerprint(), reloaded.Fingerprint())
+
+	enroller := NewEnroller(ca)
+	token, err := enroller.NewToken("agent-1", DEFAULT_TOKEN_TTL)
+	require.NoError(t, err)
+
+	agentDir := t.TempDir()
+	id, err := LoadIdentity(agentDir)
+	require.NoError(t, err)
+	assert.False(t, id.Enrolled())
+	_, err = id.TLSConfig("127.0.0.1")
+	assert.ErrorIs(t, err, ErrNotEnrolled)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	serverCfg := ca.ServerTLSConfig("127.0.0.1")
+
+	// Enroll over TLS, trusting the daemon by the CA's fingerprint
+	_, agent := sockettest.PairTLS(t, serverCfg, EnrollTLSConfig(ca.Fingerprint()), enroller.Handlers(), id.Handlers())
+	require.NoError(t, id.Enroll(ctx, agent, token, ca.Fingerprint()))
+	assert.True(t, id.Enrolled())
+	assert.Equal(t, "agent-1", id.Name())
+	assert.ErrorContains(t, id.Enroll(ctx, agent, token, ca.Fingerprint()), ErrInvalidToken.Error(), "tokens are single use")
+
+	// Renew over mTLS, named by the certificate
+	reloadedId, err := LoadIdentity(agentDir)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-1", reloadedId.Name())
+	clientCfg, err := reloadedId.TLSConfig("127.0.0.1")
+	require.NoError(t, err)
+	daemon, agent := sockettest.PairTLS(t, serverCfg, clientCfg, enroller.Handlers(), reloadedId.Handlers())
+	name, ok := PeerIdentity(daemon)
+	require.True(t, ok)
+	assert.Equal(t, "agent-1", name)
+
+	before := reloadedId.cert.Leaf.SerialNumber
+	require.NoError(t, reloadedId.Renew(ctx, agent))
+	assert.NotEqual(t, before, reloadedId.cert.Leaf.SerialNumber)
+	assert.Equal(t, "agent-1", reloadedId.Name())
+	require.NoError(t, ca.Verify(reloadedId.cert.Leaf))
+
+	// Renewing needs a client certificate
+	anon, err := LoadIdentity(t.TempDir())
+	require.NoError(t, err)
+	anon.ca = ca.Certificate()
+	_, agent = sockettest.PairTLS(t, serverCfg, EnrollTLSConfig(ca.Fingerprint()), enroller.Handlers(), anon.Handlers())
+	assert.ErrorContains(t, anon.Renew(ctx, agent), ErrNotAuthenticated.Error())
+}
+
+func TestPinning(t *testing.T) {
+	ca, err := LoadOrCreateCA(t.TempDir())
+	require.NoError(t, err)
+	other, err := LoadOrCreateCA(t.TempDir())
+	require.NoError(t, err)
+
+	cert, err := ca.serverCertificate([]string{"localhost"})
+	require.NoError(t, err)
+	assert.NoError(t, EnrollTLSConfig(ca.Fingerprint()).VerifyPeerCertificate(cert.Certificate, nil))
+	assert.ErrorIs(t, EnrollTLSConfig(other.Fingerprint()).VerifyPeerCertificate(cert.Certificate, nil), ErrFingerprintPin)
+
+	now := time.Now()
+	leaf := &x509.Certificate{NotBefore: now.Add(-20 * time.Hour), NotAfter: now.Add(4 * time.Hour)}
+	assert.True(t, needsRenewal(leaf, now))
+	leaf.NotBefore = now.Add(-time.Hour)
+	assert.False(t, needsRenewal(leaf, now))
+}
+
+func TestRequireIdentity(t *testing.T) {
+	ca, err := LoadOrCreateCA(t.TempDir())
+	require.NoError(t, err)
+	enroller := NewEnroller(ca)
+	token, err := enroller.NewToken("agent-1", DEFAULT_TOKEN_TTL)
+	require.NoError(t, err)
+
+	served := make(chan string, 4)
+	handlers := maps.Clone(enroller.Handlers())
+	handlers[socket.ActionPushStatus] = func(c *socket.Conn, h socket.Header, r io.Reader) {
+		name, _ := PeerIdentity(c)
+		served <- name
+	}
+	handlers = RequireIdentity(handlers)
+	assert.Contains(t, handlers, socket.ActionPing, "default handlers are wrapped too")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	serverCfg := ca.ServerTLSConfig("127.0.0.1")
+
+	// Without a certificate, agents may only enroll
+	id, err := LoadIdentity(t.TempDir())
+	require.NoError(t, err)
+	_, agent := sockettest.PairTLS(t, serverCfg, EnrollTLSConfig(ca.Fingerprint()), handlers, id.Handlers())
+	require.NoError(t, agent.Send(socket.ActionPushStatus, []byte("{}")))
+	require.NoError(t, id.Enroll(ctx, agent, token, ca.Fingerprint()))
+	assert.Empty(t, served, "agents without a certificate are refused")
+
+	clientCfg, err := id.TLSConfig("127.0.0.1")
+	require.NoError(t, err)
+	_, agent = sockettest.PairTLS(t, serverCfg, clientCfg, handlers, id.Handlers())
+	require.NoError(t, agent.Send(socket.ActionPushStatus, []byte("{}")))
+	select {
+	case name := <-served:
+		assert.Equal(t, "agent-1", name)
+	case <-ctx.Done():
+		t.Fatal("enrolled agent was not served")
+	}
+}
@@ -0,0 +1,252 @@
+// Ports package hands out the host ports of an agent's instances
+// from configured ranges, e.g.
+//
+//	30000-32767,40000-40100
+//
+// Allocations are persisted, so they survive agent restarts, and
+// ports something else on the host listens on are skipped.
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/store"
+)
+
+const (
+	DEFAULT_RANGE = "30000-32767"
+
+	PROTOCOL_TCP = "tcp"
+	PROTOCOL_UDP = "udp"
+)
+
+var (
+	ErrInvalidRange = errors.New("invalid port range")
+	ErrExhausted    = errors.New("no free port left")
+	ErrConflict     = errors.New("port is already taken")
+)
+
+// Range is an inclusive range of ports
+type Range struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (r Range) Contains(port int) bool {
+	return port >= r.From && port <= r.To
+}
+
+func (r Range) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// ParseRanges parses comma separated ports and from-to ranges
+func ParseRanges(s string) ([]Range, error) {
+	var out []Range
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		r := Range{}
+		var err1, err2 error
+		r.From, err1 = strconv.Atoi(strings.TrimSpace(from))
+		r.To, err2 = strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || r.From < 1 || r.To > 65535 || r.From > r.To {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRange, part)
+		}
+		out = append(out, r)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRange, s)
+	}
+	return out, nil
+}
+
+// Allocation is a port handed out to an owner, such as a container
+type Allocation struct {
+	Port        int       `json:"port"`
+	Protocol    string    `json:"protocol"`
+	Owner       string    `json:"owner"`
+	AllocatedAt time.Time `json:"allocated_at"`
+}
+
+func key(port int, protocol string) string {
+	return strconv.Itoa(port) + "/" + protocol
+}
+
+// Allocator hands out ports from its ranges
+type Allocator struct {
+	ranges []Range
+	allocs *store.Collection[Allocation]
+
+	mu   sync.Mutex
+	next int // index into the ports of the ranges, so freed ports are not reused right away
+
+	// Swapped out in tests
+	inUse func(port int, protocol string) bool
+}
+
+// New creates an allocator with its allocations persisted at path,
+// memory-only if empty
+func New(path string, ranges []Range) (*Allocator, error) {
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: no ranges", ErrInvalidRange)
+	}
+	allocs, err := store.Open[Allocation](path)
+	if err != nil {
+		return nil, err
+	}
+	return &Allocator{ranges: ranges, allocs: allocs, inUse: inUse}, nil
+}
+
+// inUse tells if something on the host listens on port
+func inUse(port int, protocol string) bool {
+	addr := ":" + strconv.Itoa(port)
+	if protocol == PROTOCOL_UDP {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return true
+		}
+		_ = conn.Close()
+		return false
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return true
+	}
+	_ = l.Close()
+	return false
+}
+
+func (a *Allocator) size() int {
+	n := 0
+	for _, r := range a.ranges {
+		n += r.To - r.From + 1
+	}
+	return n
+}
+
+// nth returns the i-th port of the ranges
+func (a *Allocator) nth(i int) int {
+	for _, r := range a.ranges {
+		if n := r.To - r.From + 1; i >= n {
+			i -= n
+			continue
+		}
+		return r.From + i
+	}
+	return 0
+}
+
+// Allocate hands out a free port for owner
+func (a *Allocator) Allocate(owner, protocol string) (int, error) {
+	if protocol == "" {
+		protocol = PROTOCOL_TCP
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	size := a.size()
+	for range size {
+		port := a.nth(a.next)
+		a.next = (a.next + 1) % size
+		if _, taken := a.allocs.Get(key(port, protocol)); taken || a.inUse(port, protocol) {
+			continue
+		}
+		alloc := Allocation{Port: port, Protocol: protocol, Owner: owner, AllocatedAt: time.Now().UTC()}
+		if err := a.allocs.Put(key(port, protocol), alloc); err != nil {
+			return 0, err
+		}
+		return port, nil
+	}
+	return 0, fmt.Errorf("%w in %s", ErrExhausted, a.rangesString())
+}
+
+// Reserve allocates a specific port for owner, which may be outside
+// the ranges. Reserving a port owner already has is a no-op.
+func (a *Allocator) Reserve(owner string, port int, protocol string) error {
+	if protocol == "" {
+		protocol = PROTOCOL_TCP
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if alloc, taken := a.allocs.Get(key(port, protocol)); taken {
+		if alloc.Owner == owner {
+			return nil
+		}
+		return fmt.Errorf("%w: %s by %s", ErrConflict, key(port, protocol), alloc.Owner)
+	}
+	if a.inUse(port, protocol) {
+		return fmt.Errorf("%w: %s is in use on the host", ErrConflict, key(port, protocol))
+	}
+	return a.allocs.Put(key(port, protocol), Allocation{Port: port, Protocol: protocol, Owner: owner, AllocatedAt: time.Now().UTC()})
+}
+
+// Release frees every port of owner
+func (a *Allocator) Release(owner string) error {
+	return a.allocs.Update(func(items map[string]Allocation) error {
+		for k, alloc := range items {
+			if alloc.Owner == owner {
+				delete(items, k)
+			}
+		}
+		return nil
+	})
+}
+
+// Owned returns the allocations of owner, sorted by port
+func (a *Allocator) Owned(owner string) []Allocation {
+	var out []Allocation
+	for _, alloc := range a.allocs.List() {
+		if alloc.Owner == owner {
+			out = append(out, alloc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return out
+}
+
+// List returns every allocation
+func (a *Allocator) List() []Allocation {
+	return a.allocs.List()
+}
+
+// Prune frees the ports of owners that do not exist anymore,
+// e.g. containers removed while the agent was down
+func (a *Allocator) Prune(exists func(owner string) bool) ([]Allocation, error) {
+	var pruned []Allocation
+	err := a.allocs.Update(func(items map[string]Allocation) error {
+		for k, alloc := range items {
+			if !exists(alloc.Owner) {
+				pruned = append(pruned, alloc)
+				delete(items, k)
+			}
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+func (a *Allocator) rangesString() string {
+	parts := make([]string, len(a.ranges))
+	for i, r := range a.ranges {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
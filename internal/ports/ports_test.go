@@ -0,0 +1,96 @@
+package ports
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ container.PortAllocator = (*Allocator)(nil)
+
+func TestParseRanges(t *testing.T) {
+	ranges, err := ParseRanges("30000-30002, 40000")
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{30000, 30002}, {40000, 40000}}, ranges)
+	assert.Equal(t, "40000", ranges[1].String())
+
+	for _, bad := range []string{"", "1-0", "0-10", "a-b", "60000-70000"} {
+		_, err := ParseRanges(bad)
+		assert.ErrorIs(t, err, ErrInvalidRange, bad)
+	}
+}
+
+func TestAllocator(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "ports.json")
+	ranges, err := ParseRanges("30000-30001,30005")
+	require.NoError(t, err)
+	a, err := New(pth, ranges)
+	require.NoError(t, err)
+	busy := map[string]bool{"30001/tcp": true}
+	a.inUse = func(port int, protocol string) bool { return busy[key(port, protocol)] }
+
+	p, err := a.Allocate("web-1", PROTOCOL_TCP)
+	require.NoError(t, err)
+	assert.Equal(t, 30000, p)
+	p, err = a.Allocate("web-1", PROTOCOL_TCP)
+	require.NoError(t, err)
+	assert.Equal(t, 30005, p, "ports in use on the host are skipped")
+	_, err = a.Allocate("web-2", PROTOCOL_TCP)
+	assert.ErrorIs(t, err, ErrExhausted)
+
+	p, err = a.Allocate("dns-1", PROTOCOL_UDP)
+	require.NoError(t, err)
+	assert.Equal(t, 30000, p, "protocols are allocated separately")
+
+	assert.ErrorIs(t, a.Reserve("web-2", 30000, PROTOCOL_TCP), ErrConflict)
+	assert.ErrorIs(t, a.Reserve("web-2", 30001, PROTOCOL_TCP), ErrConflict)
+	assert.NoError(t, a.Reserve("web-1", 30000, PROTOCOL_TCP))
+	assert.NoError(t, a.Reserve("web-2", 8080, PROTOCOL_TCP))
+
+	// Allocations survive restarts
+	again, err := New(pth, ranges)
+	require.NoError(t, err)
+	again.inUse = a.inUse
+	owned := again.Owned("web-1")
+	require.Len(t, owned, 2)
+	assert.Equal(t, []int{30000, 30005}, []int{owned[0].Port, owned[1].Port})
+
+	require.NoError(t, again.Release("web-1"))
+	assert.Empty(t, again.Owned("web-1"))
+	p, err = again.Allocate("web-3", PROTOCOL_TCP)
+	require.NoError(t, err)
+	assert.Equal(t, 30000, p)
+
+	pruned, err := again.Prune(func(owner string) bool { return owner == "web-3" })
+	require.NoError(t, err)
+	assert.Len(t, pruned, 2)
+	assert.Len(t, again.List(), 1)
+}
+
+func TestAllocatePorts(t *testing.T) {
+	ranges, err := ParseRanges("31000-31001")
+	require.NoError(t, err)
+	a, err := New("", ranges)
+	require.NoError(t, err)
+	a.inUse = func(int, string) bool { return false }
+
+	spec, err := container.AllocatePorts(a, container.Spec{Name: "web-1", Ports: []container.Port{{Container: 80}, {Container: 53, Protocol: "udp", Host: 5353}}})
+	require.NoError(t, err)
+	assert.Equal(t, 31000, spec.Ports[0].Host)
+	assert.Equal(t, 5353, spec.Ports[1].Host)
+
+	_, err = container.AllocatePorts(a, container.Spec{Name: "web-2", Ports: []container.Port{{Container: 80}, {Container: 81, Host: 5353, Protocol: "udp"}}})
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Empty(t, a.Owned("web-2"), "a failed allocation releases everything")
+}
+
+func TestInUse(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer l.Close()
+	assert.True(t, inUse(l.Addr().(*net.TCPAddr).Port, PROTOCOL_TCP))
+}
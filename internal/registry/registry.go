@@ -0,0 +1,369 @@
+package registry
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/lattesec/ctfjx/internal/pki"
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/lattesec/ctfjx/internal/store"
+	"github.com/lattesec/log"
+)
+
+// How long an agent may go without a heartbeat before it is stale
+const DEFAULT_STALE_AFTER = 30 * time.Second
+
+var (
+	ErrAgentNotFound = errors.New("agent not found")
+	ErrAgentIdEmpty  = errors.New("agent id is required")
+)
+
+type Health uint8
+
+const (
+	HealthUnknown Health = iota // never seen
+	HealthHealthy
+	HealthStale // no heartbeat within the stale window
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthHealthy:
+		return "healthy"
+	case HealthStale:
+		return "stale"
+	default:
+		return "unknown"
+	}
+}
+
+// Agent is the daemon's record of an agent
+type Agent struct {
+	Id       string        `json:"id"`
+	Address  string        `json:"address"`
+	Version  string        `json:"version"`
+	Labels   labels.Labels `json:"labels,omitempty"`
+	Status   string        `json:"status,omitempty"`   // free-form, set by the agent
+	Draining bool          `json:"draining,omitempty"` // no new instances are scheduled on it
+	LastSeen time.Time     `json:"last_seen"`          // persisted as of the last registration or Update
+
+	// Kept in memory only, see live
+	Report     *status.Report        `json:"report,omitempty"` // the latest status report
+	Violations []container.Violation `json:"violations,omitempty"`
+}
+
+// live is what changes with every heartbeat, status report and
+// violation of an agent. It is kept in memory only, as the
+// Collection rewrites its whole file on every write.
+type live struct {
+	lastSeen   time.Time
+	report     *status.Report
+	violations []container.Violation
+}
+
+// Registry tracks every agent known to the daemon, persisted
+// through a store.Collection and kept fresh by heartbeats.
+// Heartbeats, status reports and violations are kept in memory
+// only, and lost when the daemon restarts.
+type Registry struct {
+	agents     *store.Collection[Agent]
+	staleAfter time.Duration
+	now        func() time.Time
+
+	conns   sync.Map // *socket.Conn -> agent id
+	byAgent sync.Map // agent id -> *socket.Conn
+
+	// Taken after the Collection's lock, never before
+	mu   sync.RWMutex
+	live map[string]live // by agent id, for every agent in the collection
+
+	// Tells if token lets an agent without a verified client
+	// certificate say hello as agentId, see Tokens. Such agents are
+	// refused if nil.
+	Token func(agentId, token string) bool
+}
+
+// Tokens checks hello tokens against a fixed agent id -> token map
+func Tokens(tokens map[string]string) func(agentId, token string) bool {
+	return func(agentId, token string) bool {
+		want, ok := tokens[agentId]
+		return ok && want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(token)) == 1
+	}
+}
+
+// New opens the registry persisted at path, memory-only if empty
+func New(path string) (*Registry, error) {
+	agents, err := store.Open[Agent](path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		agents:     agents,
+		staleAfter: DEFAULT_STALE_AFTER,
+		now:        func() time.Time { return time.Now().UTC() },
+		live:       make(map[string]live),
+	}
+	for _, a := range agents.List() {
+		r.live[a.Id] = live{lastSeen: a.LastSeen}
+	}
+	return r, nil
+}
+
+func (r *Registry) SetStaleAfter(d time.Duration) {
+	r.staleAfter = d
+}
+
+// Register adds an agent or replaces the record with the same id
+func (r *Registry) Register(a Agent) error {
+	if a.Id == "" {
+		return ErrAgentIdEmpty
+	}
+	if err := a.Labels.Validate(); err != nil {
+		return err
+	}
+	if a.LastSeen.IsZero() {
+		a.LastSeen = r.now()
+	}
+	if err := r.agents.Put(a.Id, persisted(a)); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setLive(a)
+	return nil
+}
+
+func (r *Registry) Get(id string) (Agent, error) {
+	a, ok := r.agents.Get(id)
+	if !ok {
+		return a, fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	}
+	return r.withLive(a), nil
+}
+
+// withLive fills in the in-memory fields of a
+func (r *Registry) withLive(a Agent) Agent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if l, ok := r.live[a.Id]; ok {
+		a.LastSeen = l.lastSeen
+		a.Report = l.report
+		a.Violations = slices.Clone(l.violations)
+	}
+	return a
+}
+
+// callers responsibility to hold mu
+func (r *Registry) setLive(a Agent) {
+	r.live[a.Id] = live{lastSeen: a.LastSeen, report: a.Report, violations: a.Violations}
+}
+
+// updateLive changes the in-memory fields of agent id
+func (r *Registry) updateLive(id string, fn func(l *live)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.live[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	}
+	fn(&l)
+	r.live[id] = l
+	return nil
+}
+
+// persisted returns a without the fields kept in memory only
+func persisted(a Agent) Agent {
+	a.Report = nil
+	a.Violations = nil
+	return a
+}
+
+// Update changes the record of an existing agent and persists it.
+// Heartbeat, RecordStatus and RecordViolation only change what is
+// kept in memory, and do not need it.
+func (r *Registry) Update(id string, fn func(a *Agent)) error {
+	return r.agents.Update(func(items map[string]Agent) error {
+		a, ok := items[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+		}
+		a = r.withLive(a)
+		fn(&a)
+		a.Id = id
+		items[id] = persisted(a)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.setLive(a)
+		return nil
+	})
+}
+
+// SetDraining marks agent id as draining, or as schedulable again
+func (r *Registry) SetDraining(id string, draining bool) error {
+	return r.Update(id, func(a *Agent) { a.Draining = draining })
+}
+
+func (r *Registry) Remove(id string) error {
+	if err := r.agents.Delete(id); err != nil {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.live, id)
+	return nil
+}
+
+// List returns every agent, sorted by id
+func (r *Registry) List() []Agent {
+	agents := r.agents.List()
+	for i, a := range agents {
+		agents[i] = r.withLive(a)
+	}
+	return agents
+}
+
+// Heartbeat marks an agent as seen now
+func (r *Registry) Heartbeat(id string) error {
+	now := r.now()
+	return r.updateLive(id, func(l *live) { l.lastSeen = now })
+}
+
+// Health returns the health of a, derived from its last heartbeat
+func (r *Registry) Health(a Agent) Health {
+	switch {
+	case a.LastSeen.IsZero():
+		return HealthUnknown
+	case r.now().Sub(a.LastSeen) > r.staleAfter:
+		return HealthStale
+	default:
+		return HealthHealthy
+	}
+}
+
+// Query selects agents, every set field must match
+type Query struct {
+	Labels   labels.Labels   // agents must have every label
+	Selector labels.Selector // e.g. parsed from a deployment's "region in (eu, us), gpu"
+
+	Schedulable bool // only agents that are not draining
+	Health      *Health
+}
+
+// Find returns the agents matching q, sorted by id
+func (r *Registry) Find(q Query) []Agent {
+	var out []Agent
+	for _, a := range r.List() {
+		if q.Health != nil && r.Health(a) != *q.Health {
+			continue
+		}
+		if q.Schedulable && a.Draining {
+			continue
+		}
+		if !labels.Equals(q.Labels).Matches(a.Labels) || !q.Selector.Matches(a.Labels) {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// Handlers returns the daemon-side handlers that register agents
+// on ActionHello, record their status reports and limit violations
+// and record a heartbeat on every ping and pong.
+// They wrap the default ping and pong handlers.
+func (r *Registry) Handlers() map[socket.Action]socket.HandlerFunc {
+	touch := func(next socket.HandlerFunc) socket.HandlerFunc {
+		return func(c *socket.Conn, h socket.Header, rd io.Reader) {
+			if id, ok := r.conns.Load(c); ok {
+				if err := r.Heartbeat(id.(string)); err != nil {
+					c.GenLogMsg().Debug().Msgf("failed to record heartbeat: %v", err).Send()
+				}
+			}
+			next(c, h, rd)
+		}
+	}
+
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionHello:           r.handleHello,
+		socket.ActionPushStatus:      r.handleStatus,
+		socket.ActionReportViolation: r.handleViolation,
+		socket.ActionPing:            touch(socket.DefaultConnHandlers[socket.ActionPing]),
+		socket.ActionPong:            touch(socket.DefaultConnHandlers[socket.ActionPong]),
+	}
+}
+
+func (r *Registry) handleHello(c *socket.Conn, h socket.Header, rd io.Reader) {
+	hello, err := c.ReadHello(rd)
+	if err != nil {
+		c.GenLogMsg().Error().Msgf("invalid hello: %v", err).Send()
+		return
+	}
+	// Agents with a certificate from the CA may only claim its name,
+	// others need a token for the name they claim
+	if name, ok := pki.PeerIdentity(c); ok {
+		if name != hello.Name {
+			c.GenLogMsg().Warn().Msgf("agent %s claimed to be %s", name, hello.Name).Send()
+			return
+		}
+	} else if r.Token == nil || hello.Token == "" || !r.Token(hello.Name, hello.Token) {
+		c.GenLogMsg().Warn().Msgf("refused hello of %s: no client certificate or valid token", hello.Name).Send()
+		return
+	}
+
+	a, err := r.Get(hello.Name)
+	if err != nil {
+		a = Agent{Id: hello.Name}
+	}
+	previous := a.Version
+	a.Address = c.Config.Address
+	a.Version = hello.Version.Version
+	if hello.Labels != nil {
+		a.Labels = hello.Labels
+	}
+	a.LastSeen = r.now()
+
+	if err := r.Register(a); err != nil {
+		c.GenLogMsg().Error().Msgf("failed to register agent: %v", err).Send()
+		return
+	}
+	r.conns.Store(c, a.Id)
+	r.byAgent.Store(a.Id, c)
+
+	if previous != "" && previous != a.Version {
+		log.Info().
+			WithMeta("scope", "registry").
+			WithMeta("agent", a.Id).
+			Msgf("agent updated from %s to %s", previous, a.Version).Send()
+	}
+	log.Info().
+		WithMeta("scope", "registry").
+		WithMeta("agent", a.Id).
+		WithMeta("version", a.Version).
+		Msg("agent registered").Send()
+}
+
+// Forget drops the association of c with its agent,
+// e.g. once the connection is closed
+func (r *Registry) Forget(c *socket.Conn) {
+	if id, ok := r.conns.LoadAndDelete(c); ok {
+		r.byAgent.CompareAndDelete(id, c)
+	}
+}
+
+// Conn returns the connection of an agent that said hello
+func (r *Registry) Conn(id string) (*socket.Conn, bool) {
+	c, ok := r.byAgent.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return c.(*socket.Conn), true
+}
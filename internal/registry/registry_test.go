@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/lattesec/ctfjx/internal/socket/sockettest"
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "agents.json")
+	r, err := New(pth)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	require.NoError(t, r.Register(Agent{Id: "eu-1", Labels: map[string]string{"region": "eu"}}))
+	require.NoError(t, r.Register(Agent{Id: "us-1", Labels: map[string]string{"region": "us"}}))
+	assert.ErrorIs(t, r.Register(Agent{}), ErrAgentIdEmpty)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, r.Heartbeat("us-1"))
+	assert.ErrorIs(t, r.Heartbeat("missing"), ErrAgentNotFound)
+
+	healthy := HealthHealthy
+	assert.Equal(t, []string{"us-1"}, ids(r.Find(Query{Health: &healthy})))
+	assert.Equal(t, []string{"eu-1"}, ids(r.Find(Query{Labels: map[string]string{"region": "eu"}})))
+	notEU, err := labels.ParseSelector("region!=eu")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"us-1"}, ids(r.Find(Query{Selector: notEU})))
+	assert.ErrorIs(t, r.Register(Agent{Id: "bad", Labels: labels.Labels{"bad key": ""}}), labels.ErrInvalidLabel)
+
+	eu, err := r.Get("eu-1")
+	require.NoError(t, err)
+	assert.Equal(t, HealthStale, r.Health(eu))
+
+	for i := range MAX_VIOLATIONS + 1 {
+		v := container.Violation{Container: "pwn1", Kind: container.VIOLATION_PIDS, Time: now.Add(time.Duration(i) * time.Second)}
+		require.NoError(t, r.RecordViolation("eu-1", v))
+	}
+	eu, err = r.Get("eu-1")
+	require.NoError(t, err)
+	assert.Len(t, eu.Violations, MAX_VIOLATIONS)
+	assert.Equal(t, "eu-1", eu.Violations[0].AgentId)
+	assert.Len(t, r.Violations(now.Add(MAX_VIOLATIONS*time.Second)), 1)
+
+	reopened, err := New(pth)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eu-1", "us-1"}, ids(reopened.List()))
+
+	require.NoError(t, r.Remove("eu-1"))
+	assert.ErrorIs(t, r.Remove("eu-1"), ErrAgentNotFound)
+}
+
+func TestRegistry_InMemory(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "agents.json")
+	r, err := New(pth)
+	require.NoError(t, err)
+
+	registered := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := registered
+	r.now = func() time.Time { return now }
+	require.NoError(t, r.Register(Agent{Id: "a", Version: "v1.0.0"}))
+	before, err := os.ReadFile(pth)
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, r.Heartbeat("a"))
+	require.NoError(t, r.RecordStatus("a", status.Report{AgentId: "a", Version: "v1.0.0", Time: now}))
+	require.NoError(t, r.RecordViolation("a", container.Violation{Container: "pwn1", Kind: container.VIOLATION_PIDS}))
+	after, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after), "heartbeats, reports and violations are not written")
+
+	a, err := r.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, now, a.LastSeen)
+	assert.NotNil(t, a.Report)
+	assert.Len(t, a.Violations, 1)
+
+	require.NoError(t, r.SetDraining("a", true))
+	a, err = r.Get("a")
+	require.NoError(t, err)
+	assert.NotNil(t, a.Report, "persisting keeps what is in memory")
+	assert.Len(t, a.Violations, 1)
+
+	require.NoError(t, r.RecordStatus("a", status.Report{AgentId: "a", Version: "v1.1.0", Time: now}))
+	reopened, err := New(pth)
+	require.NoError(t, err)
+	a, err = reopened.Get("a")
+	require.NoError(t, err)
+	assert.True(t, a.Draining)
+	assert.Equal(t, "v1.1.0", a.Version, "upgrades are written")
+	assert.Nil(t, a.Report)
+	assert.Empty(t, a.Violations)
+	assert.Equal(t, now, a.LastSeen, "as of the last write")
+
+	require.NoError(t, r.Remove("a"))
+	assert.ErrorIs(t, r.Heartbeat("a"), ErrAgentNotFound)
+	assert.ErrorIs(t, r.RecordViolation("a", container.Violation{}), ErrAgentNotFound)
+}
+
+func ids(agents []Agent) []string {
+	out := make([]string, len(agents))
+	for i, a := range agents {
+		out[i] = a.Id
+	}
+	return out
+}
+
+func TestRegistry_Status(t *testing.T) {
+	r, err := New("")
+	require.NoError(t, err)
+	r.SetStaleAfter(time.Minute)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	require.NoError(t, r.Register(Agent{Id: "a"}))
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, []string{"a"}, ids(r.Stale()))
+
+	rep := status.Report{AgentId: "a", Version: "v1.2.0", Time: now.Add(-3 * time.Second), CPU: 12.5}
+	require.NoError(t, r.RecordStatus("a", rep))
+	assert.Empty(t, r.Stale())
+
+	a, err := r.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", a.Version)
+	assert.Equal(t, 3*time.Second, a.Report.ClockSkew)
+	assert.Equal(t, 12.5, a.Report.CPU)
+}
+
+func TestRegistry_Hello(t *testing.T) {
+	r, err := New("")
+	require.NoError(t, err)
+	require.NoError(t, r.Register(Agent{Id: "agent", Address: "10.0.0.1:4000"}))
+	_, agent := sockettest.Pair(t, r.Handlers(), nil)
+
+	registered := func() bool {
+		_, ok := r.Conn("agent")
+		return ok
+	}
+	require.NoError(t, agent.SendHello())
+	assert.Never(t, registered, 100*time.Millisecond, time.Millisecond, "agents without a certificate need a token")
+
+	r.Token = Tokens(map[string]string{"agent": "secret"})
+	agent.Config.Token = "guess"
+	require.NoError(t, agent.SendHello())
+	assert.Never(t, registered, 100*time.Millisecond, time.Millisecond)
+	a, err := r.Get("agent")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:4000", a.Address, "refused hellos leave the record alone")
+
+	agent.Config.Token = "secret"
+	require.NoError(t, agent.SendHello())
+	assert.Eventually(t, registered, time.Second, time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/lattesec/log"
+)
+
+// RecordStatus stores rep as the latest report of agent id,
+// counting as a heartbeat and filling in the clock skew
+func (r *Registry) RecordStatus(id string, rep status.Report) error {
+	now := r.now()
+	rep.ClockSkew = now.Sub(rep.Time)
+	err := r.updateLive(id, func(l *live) {
+		l.lastSeen = now
+		l.report = &rep
+	})
+	if err != nil || rep.Version == "" {
+		return err
+	}
+
+	// only an upgraded agent changes what is persisted
+	if a, ok := r.agents.Get(id); ok && a.Version == rep.Version {
+		return nil
+	}
+	return r.Update(id, func(a *Agent) { a.Version = rep.Version })
+}
+
+func (r *Registry) handleStatus(c *socket.Conn, h socket.Header, rd io.Reader) {
+	id, ok := r.conns.Load(c)
+	if !ok {
+		c.GenLogMsg().Warn().Msg("status from an agent that did not say hello").Send()
+		return
+	}
+
+	rep, err := status.Decode(rd)
+	if err != nil {
+		c.GenLogMsg().Error().Msgf("invalid status report: %v", err).Send()
+		return
+	}
+	if err := r.RecordStatus(id.(string), rep); err != nil {
+		c.GenLogMsg().Error().Msgf("failed to record status: %v", err).Send()
+	}
+}
+
+// Stale returns the agents that have been seen before but
+// missed their heartbeats
+func (r *Registry) Stale() []Agent {
+	stale := HealthStale
+	return r.Find(Query{Health: &stale})
+}
+
+// WatchStale checks the agents every interval and calls fn once
+// for every agent that turns stale, until ctx is done
+func (r *Registry) WatchStale(ctx context.Context, interval time.Duration, fn func(a Agent)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	reported := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		stale := make(map[string]bool)
+		for _, a := range r.Stale() {
+			stale[a.Id] = true
+			if reported[a.Id] {
+				continue
+			}
+			log.Warn().
+				WithMeta("scope", "registry").
+				WithMeta("agent", a.Id).
+				WithMeta("last_seen", a.LastSeen.String()).
+				Msg("agent is stale").Send()
+			fn(a)
+		}
+		reported = stale // recovered agents may be reported again
+	}
+}
@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+// How many violations are kept per agent
+const MAX_VIOLATIONS = 100
+
+// RecordViolation stores v on agent id, dropping the oldest
+// violations beyond MAX_VIOLATIONS
+func (r *Registry) RecordViolation(id string, v container.Violation) error {
+	v.AgentId = id
+	return r.updateLive(id, func(l *live) {
+		l.violations = append(l.violations, v)
+		if over := len(l.violations) - MAX_VIOLATIONS; over > 0 {
+			l.violations = slices.Clone(l.violations[over:])
+		}
+	})
+}
+
+// Violations returns the violations of every agent since t, oldest first
+func (r *Registry) Violations(since time.Time) []container.Violation {
+	var out []container.Violation
+	for _, a := range r.List() {
+		for _, v := range a.Violations {
+			if !v.Time.Before(since) {
+				out = append(out, v)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+func (r *Registry) handleViolation(c *socket.Conn, h socket.Header, rd io.Reader) {
+	id, ok := r.conns.Load(c)
+	if !ok {
+		c.GenLogMsg().Warn().Msg("violation from an agent that did not say hello").Send()
+		return
+	}
+
+	var v container.Violation
+	if err := json.NewDecoder(rd).Decode(&v); err != nil {
+		c.GenLogMsg().Error().Msgf("invalid violation: %v", err).Send()
+		return
+	}
+
+	log.Warn().
+		WithMeta("scope", "registry").
+		WithMeta("agent", id.(string)).
+		WithMeta("container", v.Container).
+		WithMeta("kind", v.Kind).
+		Msgf("limit violation: %s", v.Detail).Send()
+	if err := r.RecordViolation(id.(string), v); err != nil {
+		c.GenLogMsg().Error().Msgf("failed to record violation: %v", err).Send()
+	}
+}
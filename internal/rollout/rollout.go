@@ -0,0 +1,209 @@
+// Rollout package patches live challenges. A new build replaces the
+// running instances one at a time, and the change is annotated so
+// the scoreboard can tell players when a challenge changed under them.
+package rollout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/instances"
+	"github.com/lattesec/ctfjx/internal/store"
+	"github.com/lattesec/log"
+)
+
+var ErrRolloutFailed = errors.New("rollout failed")
+
+// Builder builds challenge bundles, see build.Builder
+type Builder interface {
+	Build(ctx context.Context, dir string) (challenge.Build, error)
+}
+
+// Replacer replaces the instances of a challenge, see instances.Manager
+type Replacer interface {
+	OfChallenge(challengeId string) []instances.Instance
+	Reset(ctx context.Context, challengeId, team string) (instances.Instance, error)
+}
+
+var _ Replacer = (*instances.Manager)(nil)
+
+// Annotation notes on the scoreboard that a challenge changed
+type Annotation struct {
+	Id        string    `json:"id"`
+	Challenge string    `json:"challenge"`
+	Version   string    `json:"version"`
+	Previous  string    `json:"previous"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+// Rollout is the outcome of replacing the instances of a challenge
+type Rollout struct {
+	Challenge string    `json:"challenge"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Redeploy  bool      `json:"redeploy"` // false if only what is handed out changed
+	Updated   []string  `json:"updated,omitempty"`
+	Failed    string    `json:"failed,omitempty"` // the instance the rollout stopped at
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Updater patches challenges and rolls their instances
+type Updater struct {
+	builder     Builder
+	challenges  *challenge.Registry
+	instances   Replacer
+	annotations *store.Collection[Annotation]
+	Pause       time.Duration // between two instances
+
+	mu sync.Mutex // one rollout at a time
+
+	// Swapped out in tests
+	now func() time.Time
+}
+
+// New creates an updater with its annotations persisted at path,
+// memory-only if empty
+func New(builder Builder, challenges *challenge.Registry, replacer Replacer, path string) (*Updater, error) {
+	annotations, err := store.Open[Annotation](path)
+	if err != nil {
+		return nil, err
+	}
+	return &Updater{
+		builder:     builder,
+		challenges:  challenges,
+		instances:   replacer,
+		annotations: annotations,
+		now:         func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// Patch builds the bundle in dir and rolls the challenge's instances
+// to the new version, if it changed. message annotates the change,
+// a default one is used if empty.
+func (u *Updater) Patch(ctx context.Context, dir, message string) (Rollout, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	c, err := challenge.Load(dir)
+	if err != nil {
+		return Rollout{}, err
+	}
+	prev, existed := u.challenges.Get(c.Id)
+	b, err := u.builder.Build(ctx, dir)
+	if err != nil {
+		return Rollout{}, err
+	}
+	if !existed || prev.Version == b.Version {
+		return Rollout{Challenge: b.Id, From: prev.Version, To: b.Version}, nil
+	}
+	if message == "" {
+		message = "updated to version " + b.Version
+	}
+	return u.roll(ctx, prev, b, message)
+}
+
+// Rollback makes version the current build of challenge id again
+// and rolls its instances back to it
+func (u *Updater) Rollback(ctx context.Context, id, version, message string) (Rollout, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	prev, ok := u.challenges.Get(id)
+	if !ok {
+		return Rollout{}, fmt.Errorf("%w: %s", instances.ErrUnknown, id)
+	}
+	b, err := u.challenges.Version(id, version)
+	if err != nil {
+		return Rollout{}, err
+	}
+	if prev.Version == b.Version {
+		return Rollout{Challenge: id, From: prev.Version, To: b.Version}, nil
+	}
+	if err := u.challenges.Put(b); err != nil {
+		return Rollout{}, err
+	}
+	if message == "" {
+		message = "rolled back to version " + b.Version
+	}
+	return u.roll(ctx, prev, b, message)
+}
+
+// roll annotates the change from prev to b and replaces the
+// instances that do not run b, stopping at the first failure
+func (u *Updater) roll(ctx context.Context, prev, b challenge.Build, message string) (Rollout, error) {
+	now := u.now()
+	r := Rollout{Challenge: b.Id, From: prev.Version, To: b.Version, Redeploy: redeploy(prev, b), Started: now}
+	a := Annotation{
+		Id:        b.Id + "-" + strconv.FormatInt(now.UnixNano(), 10),
+		Challenge: b.Id,
+		Version:   b.Version,
+		Previous:  prev.Version,
+		Message:   message,
+		Time:      now,
+	}
+	if err := u.annotations.Put(a.Id, a); err != nil {
+		return r, err
+	}
+	log.Info().
+		WithMeta("scope", "rollout").
+		WithMeta("challenge", b.Id).
+		Msgf("version %s -> %s, redeploy: %t", prev.Version, b.Version, r.Redeploy).Send()
+
+	if r.Redeploy {
+		for _, inst := range u.instances.OfChallenge(b.Id) {
+			if inst.Version == b.Version {
+				continue
+			}
+			if len(r.Updated) > 0 && u.Pause > 0 {
+				select {
+				case <-ctx.Done():
+					r.Failed, r.Finished = inst.Id, u.now()
+					return r, fmt.Errorf("%w at %s: %w", ErrRolloutFailed, inst.Id, ctx.Err())
+				case <-time.After(u.Pause):
+				}
+			}
+			if _, err := u.instances.Reset(ctx, inst.Challenge, inst.Team); err != nil {
+				r.Failed, r.Finished = inst.Id, u.now()
+				log.Error().
+					WithMeta("scope", "rollout").
+					WithMeta("challenge", b.Id).
+					WithMeta("instance", inst.Id).
+					Msgf("stopped rolling out: %v", err).Send()
+				return r, fmt.Errorf("%w at %s: %w", ErrRolloutFailed, inst.Id, err)
+			}
+			r.Updated = append(r.Updated, inst.Id)
+		}
+	}
+	r.Finished = u.now()
+	return r, nil
+}
+
+// redeploy tells if instances of prev must be replaced to run b
+func redeploy(prev, b challenge.Build) bool {
+	return prev.Image != b.Image ||
+		!reflect.DeepEqual(prev.Bundle, b.Bundle) ||
+		!reflect.DeepEqual(prev.Challenge.Deploy, b.Challenge.Deploy) ||
+		!reflect.DeepEqual(prev.Challenge.Healthcheck, b.Challenge.Healthcheck)
+}
+
+// Annotations returns the annotations of challenge id, every
+// annotation if empty, oldest first
+func (u *Updater) Annotations(id string) []Annotation {
+	var out []Annotation
+	for _, a := range u.annotations.List() {
+		if id == "" || a.Challenge == id {
+			out = append(out, a)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Annotation) int { return a.Time.Compare(b.Time) })
+	return out
+}
@@ -0,0 +1,132 @@
+package rollout
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/instances"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBuilder builds the image and version it is told to
+type fakeBuilder struct {
+	challenges *challenge.Registry
+	image      string
+	version    string
+	now        time.Time
+}
+
+func (f *fakeBuilder) Build(_ context.Context, dir string) (challenge.Build, error) {
+	c, err := challenge.Load(dir)
+	if err != nil {
+		return challenge.Build{}, err
+	}
+	f.now = f.now.Add(time.Minute)
+	b := challenge.Build{Id: c.Id, Version: f.version, Image: f.image, Challenge: *c, BuiltAt: f.now}
+	return b, f.challenges.Put(b)
+}
+
+type fakeReplacer struct {
+	instances map[string]instances.Instance
+	current   func() string
+	fail      string
+	reset     []string
+}
+
+func (f *fakeReplacer) OfChallenge(id string) []instances.Instance {
+	var out []instances.Instance
+	for _, team := range []string{"team1", "team2", "team3"} {
+		if inst, ok := f.instances[team]; ok && inst.Challenge == id {
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+func (f *fakeReplacer) Reset(_ context.Context, challengeId, team string) (instances.Instance, error) {
+	inst := f.instances[team]
+	if inst.Id == f.fail {
+		return inst, errors.New("no agent left")
+	}
+	inst.Version = f.current()
+	f.instances[team] = inst
+	f.reset = append(f.reset, inst.Id)
+	return inst, nil
+}
+
+func TestRollout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "notes")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, challenge.FILENAME), []byte(`name: Notes
+category: pwn
+flag:
+  value: ctf{notes}
+deploy:
+  image: notes:1
+  per_team: true
+  ports:
+    - port: 1337
+`), 0o644))
+
+	challenges, err := challenge.OpenRegistry("")
+	require.NoError(t, err)
+	builder := &fakeBuilder{challenges: challenges, image: "notes:1", version: "v1"}
+	replacer := &fakeReplacer{
+		current: func() string { b, _ := challenges.Get("notes"); return b.Version },
+		instances: map[string]instances.Instance{
+			"team1": {Id: "notes-team1", Challenge: "notes", Team: "team1", Version: "v1"},
+			"team2": {Id: "notes-team2", Challenge: "notes", Team: "team2", Version: "v1"},
+			"team3": {Id: "notes-team3", Challenge: "notes", Team: "team3", Version: "v1"},
+		},
+	}
+	u, err := New(builder, challenges, replacer, "")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// the first build has nothing to roll
+	r, err := u.Patch(ctx, dir, "")
+	require.NoError(t, err)
+	assert.Empty(t, r.Updated)
+	assert.Empty(t, u.Annotations(""))
+
+	// a new image replaces every instance
+	builder.image, builder.version = "notes:2", "v2"
+	r, err = u.Patch(ctx, dir, "fixed an unintended solution")
+	require.NoError(t, err)
+	assert.True(t, r.Redeploy)
+	assert.Equal(t, []string{"notes-team1", "notes-team2", "notes-team3"}, r.Updated)
+	annotations := u.Annotations("notes")
+	require.Len(t, annotations, 1)
+	assert.Equal(t, "fixed an unintended solution", annotations[0].Message)
+	assert.Equal(t, "v1", annotations[0].Previous)
+
+	// only attachments changed, instances are left alone
+	replacer.reset = nil
+	builder.version = "v3"
+	r, err = u.Patch(ctx, dir, "")
+	require.NoError(t, err)
+	assert.False(t, r.Redeploy)
+	assert.Empty(t, replacer.reset)
+	assert.Equal(t, "updated to version v3", u.Annotations("notes")[1].Message)
+
+	// a failure stops the rollout
+	replacer.fail = "notes-team2"
+	r, err = u.Rollback(ctx, "notes", "v1", "")
+	assert.ErrorIs(t, err, ErrRolloutFailed)
+	assert.Equal(t, []string{"notes-team1"}, r.Updated)
+	assert.Equal(t, "notes-team2", r.Failed)
+	assert.Equal(t, "v2", replacer.instances["team3"].Version, "left as it was")
+	b, _ := challenges.Get("notes")
+	assert.Equal(t, "v1", b.Version)
+	assert.Len(t, u.Annotations(""), 3)
+
+	assert.Len(t, challenges.Versions("notes"), 3)
+	_, err = u.Rollback(ctx, "notes", "v9", "")
+	assert.ErrorIs(t, err, challenge.ErrUnknownVersion)
+}
@@ -0,0 +1,354 @@
+// Scheduler package places challenge instances on agents.
+//
+// Candidates are the healthy, schedulable agents matching an
+// instance's selector. Among them, the least loaded agent wins,
+// from its latest status report and the instances placed on it,
+// with instances of the same group spread across agents.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/store"
+	"github.com/lattesec/ctfjx/internal/tasks"
+	"github.com/lattesec/log"
+)
+
+const (
+	// Agents tried before giving up on placing an instance
+	DEFAULT_MAX_ATTEMPTS = 3
+
+	// Load added per instance in the same group,
+	// on top of the 0-2 of CPU and memory use
+	SPREAD_WEIGHT = 0.5
+	// Load added per instance of any group
+	INSTANCE_WEIGHT = 0.05
+)
+
+var (
+	ErrNoCandidates   = errors.New("no agent can run the instance")
+	ErrNotPlaced      = errors.New("instance is not placed")
+	ErrAlreadyPlaced  = errors.New("instance is already placed")
+	ErrAgentOffline   = errors.New("agent is not connected")
+	ErrInvalidRequest = errors.New("invalid placement request")
+)
+
+// Request asks for an instance to be placed
+type Request struct {
+	Name      string          `json:"name"` // unique, e.g. notes-team42
+	Challenge string          `json:"challenge"`
+	Spec      container.Spec  `json:"spec"`
+	Selector  labels.Selector `json:"selector,omitempty"` // agents it may run on
+
+	// Instances of the same group are spread across agents,
+	// the challenge's id by default
+	Group string `json:"group,omitempty"`
+	// Groups it must never share an agent with
+	AntiAffinity []string `json:"anti_affinity,omitempty"`
+}
+
+// Placement is an instance running on an agent
+type Placement struct {
+	Request
+	Agent     string         `json:"agent"`
+	Container container.Info `json:"container"`
+	PlacedAt  time.Time      `json:"placed_at"`
+}
+
+// Scheduler places instances and keeps track of them
+type Scheduler struct {
+	registry    *registry.Registry
+	dispatcher  *tasks.Dispatcher
+	placements  *store.Collection[Placement]
+	MaxAttempts int
+
+	mu sync.Mutex // serializes placing, so concurrent requests see each other's load
+
+	// Swapped out in tests
+	deploy func(ctx context.Context, agent string, spec container.Spec) (container.Info, error)
+	remove func(ctx context.Context, agent, id string) error
+}
+
+// New creates a scheduler deploying with signed tasks, with its
+// placements persisted at path, memory-only if empty
+func New(reg *registry.Registry, d *tasks.Dispatcher, path string) (*Scheduler, error) {
+	placements, err := store.Open[Placement](path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scheduler{registry: reg, dispatcher: d, placements: placements, MaxAttempts: DEFAULT_MAX_ATTEMPTS}
+	s.deploy, s.remove = s.deployTask, s.removeTask
+	return s, nil
+}
+
+// Schedule places req on the best agent, trying the next best
+// ones if deploying fails
+func (s *Scheduler) Schedule(ctx context.Context, req Request) (Placement, error) {
+	return s.schedule(ctx, req, nil, false)
+}
+
+// schedule places req on an agent that is not in exclude,
+// replacing its placement if replace is set
+func (s *Scheduler) schedule(ctx context.Context, req Request, exclude []string, replace bool) (Placement, error) {
+	if req.Name == "" {
+		return Placement{}, fmt.Errorf("%w: name is required", ErrInvalidRequest)
+	}
+	if req.Group == "" {
+		req.Group = req.Challenge
+	}
+	if req.Spec.Name == "" {
+		req.Spec.Name = req.Name
+	}
+	if err := req.Spec.Validate(); err != nil {
+		return Placement{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.placements.Get(req.Name); ok && !replace {
+		return Placement{}, fmt.Errorf("%w: %s", ErrAlreadyPlaced, req.Name)
+	}
+
+	var errs []error
+	for range max(s.MaxAttempts, 1) {
+		agent, err := s.pick(req, exclude)
+		if err != nil {
+			return Placement{}, errors.Join(append(errs, err)...)
+		}
+		info, err := s.deploy(ctx, agent, req.Spec)
+		if err != nil {
+			log.Warn().
+				WithMeta("scope", "scheduler").
+				WithMeta("agent", agent).
+				WithMeta("instance", req.Name).
+				Msgf("failed to deploy, trying another agent: %v", err).Send()
+			errs = append(errs, fmt.Errorf("%s: %w", agent, err))
+			exclude = append(exclude, agent)
+			continue
+		}
+
+		p := Placement{Request: req, Agent: agent, Container: info, PlacedAt: time.Now().UTC()}
+		if err := s.placements.Put(req.Name, p); err != nil {
+			return Placement{}, err
+		}
+		log.Info().
+			WithMeta("scope", "scheduler").
+			WithMeta("agent", agent).
+			WithMeta("instance", req.Name).
+			Msg("instance placed").Send()
+		return p, nil
+	}
+	return Placement{}, errors.Join(errs...)
+}
+
+// Candidates returns the agents req may be placed on,
+// least loaded first
+func (s *Scheduler) Candidates(req Request) []string {
+	healthy := registry.HealthHealthy
+	agents := s.registry.Find(registry.Query{Selector: req.Selector, Schedulable: true, Health: &healthy})
+
+	placed := make(map[string][]Placement)
+	for _, p := range s.placements.List() {
+		if p.Name != req.Name {
+			placed[p.Agent] = append(placed[p.Agent], p)
+		}
+	}
+
+	type candidate struct {
+		id   string
+		load float64
+	}
+	var candidates []candidate
+	for _, a := range agents {
+		if conflicts(req, placed[a.Id]) {
+			continue
+		}
+		candidates = append(candidates, candidate{a.Id, load(a, req, placed[a.Id])})
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		switch {
+		case a.load < b.load:
+			return -1
+		case a.load > b.load:
+			return 1
+		}
+		return 0
+	})
+
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.id
+	}
+	return out
+}
+
+func (s *Scheduler) pick(req Request, exclude []string) (string, error) {
+	for _, id := range s.Candidates(req) {
+		if !slices.Contains(exclude, id) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoCandidates, req.Name)
+}
+
+// conflicts tells if req breaks an anti-affinity rule on an agent
+// running placed, either its own or one of theirs
+func conflicts(req Request, placed []Placement) bool {
+	for _, p := range placed {
+		if slices.Contains(req.AntiAffinity, p.Group) || slices.Contains(p.AntiAffinity, req.Group) {
+			return true
+		}
+	}
+	return false
+}
+
+// load scores how busy agent a is for req, lower is better
+func load(a registry.Agent, req Request, placed []Placement) float64 {
+	score := INSTANCE_WEIGHT * float64(len(placed))
+	for _, p := range placed {
+		if p.Group == req.Group {
+			score += SPREAD_WEIGHT
+		}
+	}
+	if rep := a.Report; rep != nil {
+		score += rep.CPU / 100
+		if rep.Memory.Total > 0 {
+			score += float64(rep.Memory.Used) / float64(rep.Memory.Total)
+		}
+	}
+	return score
+}
+
+// Get returns the placement of instance name
+func (s *Scheduler) Get(name string) (Placement, bool) {
+	return s.placements.Get(name)
+}
+
+// Placements returns every placement, sorted by instance name
+func (s *Scheduler) Placements() []Placement {
+	return s.placements.List()
+}
+
+// OnAgent returns the placements on agent id
+func (s *Scheduler) OnAgent(id string) []Placement {
+	var out []Placement
+	for _, p := range s.placements.List() {
+		if p.Agent == id {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Remove stops and removes instance name and forgets its placement
+func (s *Scheduler) Remove(ctx context.Context, name string) error {
+	p, ok := s.placements.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotPlaced, name)
+	}
+	err := s.remove(ctx, p.Agent, p.Container.Id)
+	switch {
+	case errors.Is(err, ErrAgentOffline):
+		log.Warn().
+			WithMeta("scope", "scheduler").
+			WithMeta("agent", p.Agent).
+			WithMeta("instance", name).
+			Msg("agent is offline, forgetting the instance anyway").Send()
+	case err != nil:
+		return err
+	}
+	return s.placements.Delete(name)
+}
+
+// Reschedule moves every instance of agent id to other agents,
+// e.g. once it is stale. The old containers are removed if the
+// agent can still be reached.
+func (s *Scheduler) Reschedule(ctx context.Context, id string) (moved []string, err error) {
+	var errs []error
+	for _, p := range s.OnAgent(id) {
+		if _, err := s.schedule(ctx, p.Request, []string{id}, true); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		moved = append(moved, p.Name)
+		if err := s.remove(ctx, id, p.Container.Id); err != nil {
+			log.Warn().
+				WithMeta("scope", "scheduler").
+				WithMeta("agent", id).
+				WithMeta("instance", p.Name).
+				Msgf("left the old container behind: %v", err).Send()
+		}
+	}
+	return moved, errors.Join(errs...)
+}
+
+// Migrate moves the instance running as inst on agent to another
+// agent, without removing inst. It is a drain.MigrateFunc.
+func (s *Scheduler) Migrate(ctx context.Context, agent registry.Agent, inst container.Info) error {
+	for _, p := range s.OnAgent(agent.Id) {
+		if p.Container.Id == inst.Id {
+			_, err := s.schedule(ctx, p.Request, []string{agent.Id}, true)
+			return err
+		}
+	}
+	return fmt.Errorf("%w: container %s on %s", ErrNotPlaced, inst.Id, agent.Id)
+}
+
+// Watch reschedules the instances of agents that turn stale,
+// checking every interval until ctx is done
+func (s *Scheduler) Watch(ctx context.Context, interval time.Duration) {
+	s.registry.WatchStale(ctx, interval, func(a registry.Agent) {
+		moved, err := s.Reschedule(ctx, a.Id)
+		if err != nil {
+			log.Error().
+				WithMeta("scope", "scheduler").
+				WithMeta("agent", a.Id).
+				Msgf("failed to reschedule some instances: %v", err).Send()
+		}
+		if len(moved) > 0 {
+			log.Info().
+				WithMeta("scope", "scheduler").
+				WithMeta("agent", a.Id).
+				Msgf("rescheduled %d instances", len(moved)).Send()
+		}
+	})
+}
+
+func (s *Scheduler) deployTask(ctx context.Context, agent string, spec container.Spec) (container.Info, error) {
+	c, ok := s.registry.Conn(agent)
+	if !ok {
+		return container.Info{}, fmt.Errorf("%w: %s", ErrAgentOffline, agent)
+	}
+	arg, err := json.Marshal(spec)
+	if err != nil {
+		return container.Info{}, err
+	}
+	out, err := s.dispatcher.Run(ctx, c, tasks.Task{Verb: container.VERB_DEPLOY, Args: []string{string(arg)}})
+	if err != nil {
+		return container.Info{}, err
+	}
+	var info container.Info
+	return info, json.Unmarshal(out, &info)
+}
+
+func (s *Scheduler) removeTask(ctx context.Context, agent, id string) error {
+	c, ok := s.registry.Conn(agent)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentOffline, agent)
+	}
+	for _, verb := range []string{container.VERB_STOP, container.VERB_REMOVE} {
+		if _, err := s.dispatcher.Run(ctx, c, tasks.Task{Verb: verb, Args: []string{id}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
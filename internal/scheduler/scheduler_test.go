@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/lattesec/ctfjx/internal/registry"
+	"github.com/lattesec/ctfjx/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAgents deploys by recording containers per agent
+type fakeAgents struct {
+	mu       sync.Mutex
+	running  map[string][]string // agent -> container ids
+	failing  map[string]bool
+	deployed int
+}
+
+func newTestScheduler(t *testing.T, agents ...registry.Agent) (*Scheduler, *registry.Registry, *fakeAgents) {
+	reg, err := registry.New("")
+	require.NoError(t, err)
+	for _, a := range agents {
+		require.NoError(t, reg.Register(a))
+	}
+	s, err := New(reg, nil, "")
+	require.NoError(t, err)
+
+	f := &fakeAgents{running: make(map[string][]string), failing: make(map[string]bool)}
+	s.deploy = func(ctx context.Context, agent string, spec container.Spec) (container.Info, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.failing[agent] {
+			return container.Info{}, errors.New("out of disk")
+		}
+		f.deployed++
+		id := fmt.Sprintf("c%d", f.deployed)
+		f.running[agent] = append(f.running[agent], id)
+		return container.Info{Id: id, Name: spec.Name, Running: true}, nil
+	}
+	s.remove = func(ctx context.Context, agent, id string) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for i, c := range f.running[agent] {
+			if c == id {
+				f.running[agent] = append(f.running[agent][:i], f.running[agent][i+1:]...)
+				return nil
+			}
+		}
+		return container.ErrNotFound
+	}
+	return s, reg, f
+}
+
+func request(name, challenge string) Request {
+	return Request{Name: name, Challenge: challenge, Spec: container.Spec{Image: "chal/" + challenge}}
+}
+
+func TestSchedule(t *testing.T) {
+	now := time.Now().UTC()
+	busy := &status.Report{CPU: 20, Memory: status.Usage{Used: 1, Total: 8}}
+	s, _, f := newTestScheduler(t,
+		registry.Agent{Id: "a", Labels: labels.Labels{"region": "eu"}, LastSeen: now, Report: busy},
+		registry.Agent{Id: "b", Labels: labels.Labels{"region": "eu"}, LastSeen: now},
+		registry.Agent{Id: "c", Labels: labels.Labels{"region": "us"}, LastSeen: now},
+		registry.Agent{Id: "d", Labels: labels.Labels{"region": "eu"}, LastSeen: now, Draining: true},
+	)
+	ctx := context.Background()
+	eu, err := labels.ParseSelector("region=eu")
+	require.NoError(t, err)
+
+	// Load, then spreading the challenge's instances
+	req := request("web-1", "web")
+	req.Selector = eu
+	p, err := s.Schedule(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "b", p.Agent)
+	assert.Equal(t, "web", p.Group)
+	assert.Equal(t, "web-1", p.Container.Name)
+
+	_, err = s.Schedule(ctx, req)
+	assert.ErrorIs(t, err, ErrAlreadyPlaced)
+
+	req.Name = "web-2"
+	p, err = s.Schedule(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "a", p.Agent, "instances of a challenge are spread")
+
+	// Anti-affinity is hard
+	isolated := request("kernel-1", "kernel")
+	isolated.AntiAffinity = []string{"web"}
+	_, err = s.Schedule(ctx, isolated)
+	require.NoError(t, err)
+	p, _ = s.Get("kernel-1")
+	assert.Equal(t, "c", p.Agent)
+
+	isolated.Name, isolated.Selector = "kernel-2", eu
+	_, err = s.Schedule(ctx, isolated)
+	assert.ErrorIs(t, err, ErrNoCandidates)
+
+	// Retries on other agents
+	f.failing["b"] = true
+	req.Name = "web-3"
+	p, err = s.Schedule(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "a", p.Agent)
+
+	f.failing["a"] = true
+	req.Name = "web-4"
+	_, err = s.Schedule(ctx, req)
+	assert.ErrorIs(t, err, ErrNoCandidates)
+	assert.ErrorContains(t, err, "out of disk")
+
+	require.NoError(t, s.Remove(ctx, "web-3"))
+	_, ok := s.Get("web-3")
+	assert.False(t, ok)
+	assert.Len(t, f.running["a"], 1)
+	assert.ErrorIs(t, s.Remove(ctx, "web-3"), ErrNotPlaced)
+}
+
+func TestReschedule(t *testing.T) {
+	now := time.Now().UTC()
+	s, reg, f := newTestScheduler(t,
+		registry.Agent{Id: "a", LastSeen: now},
+		registry.Agent{Id: "b", LastSeen: now.Add(time.Millisecond)},
+	)
+	ctx := context.Background()
+
+	for _, name := range []string{"x-1", "x-2", "x-3"} {
+		_, err := s.Schedule(ctx, request(name, "x"))
+		require.NoError(t, err)
+	}
+	onA := s.OnAgent("a")
+	require.Len(t, onA, 2)
+
+	// a stops sending heartbeats
+	require.NoError(t, reg.Update("a", func(a *registry.Agent) { a.LastSeen = now.Add(-time.Hour) }))
+	moved, err := s.Reschedule(ctx, "a")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{onA[0].Name, onA[1].Name}, moved)
+	assert.Empty(t, s.OnAgent("a"))
+	assert.Len(t, s.OnAgent("b"), 3)
+	assert.Empty(t, f.running["a"])
+
+	// Migrating during a drain leaves the old container to the drainer
+	agentB, err := reg.Get("b")
+	require.NoError(t, err)
+	require.NoError(t, reg.Update("a", func(a *registry.Agent) { a.LastSeen = time.Now().UTC() }))
+	inst := s.OnAgent("b")[0]
+	require.NoError(t, s.Migrate(ctx, agentB, inst.Container))
+	p, _ := s.Get(inst.Name)
+	assert.Equal(t, "a", p.Agent)
+	assert.Len(t, f.running["b"], 3)
+	assert.ErrorIs(t, s.Migrate(ctx, agentB, container.Info{Id: "nope"}), ErrNotPlaced)
+}
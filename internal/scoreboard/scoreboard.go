@@ -0,0 +1,207 @@
+// Scoreboard package keeps the scores of teams from their solves,
+// e.g.
+//
+//	GET /scoreboard
+//
+// Challenges are worth what their scoring formula, or the event's,
+// gives for their solve count. When a solve changes what a challenge
+// is worth, every team that solved it is scored again.
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/scoring"
+	"github.com/lattesec/ctfjx/internal/submissions"
+	"github.com/lattesec/log"
+)
+
+// Score is where a team stands
+type Score struct {
+	Rank      int       `json:"rank"`
+	Team      string    `json:"team"`
+	Points    int       `json:"points"`
+	Solves    int       `json:"solves"`
+	LastSolve time.Time `json:"last_solve,omitzero"` // the earliest ranks first on ties
+}
+
+// Scoreboard scores the solves of a registry's challenges
+type Scoreboard struct {
+	challenges *challenge.Registry
+	event      scoring.Spec // of challenges without their own
+
+	mu     sync.Mutex
+	solves map[string]map[string]time.Time // challenge -> team -> when
+	values map[string]int                  // challenge -> what each of its solvers got
+	scores map[string]*Score               // by team
+}
+
+// New creates an empty scoreboard, challenges without a formula of
+// their own use event, static if zero
+func New(challenges *challenge.Registry, event scoring.Spec) (*Scoreboard, error) {
+	if event.Formula == "" {
+		event.Formula = scoring.Static
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return &Scoreboard{
+		challenges: challenges,
+		event:      event,
+		solves:     make(map[string]map[string]time.Time),
+		values:     make(map[string]int),
+		scores:     make(map[string]*Score),
+	}, nil
+}
+
+// Load records attempts, e.g. submissions.Service.Solves("") on start
+func (s *Scoreboard) Load(attempts []submissions.Attempt) {
+	for _, a := range attempts {
+		s.Record(a)
+	}
+}
+
+// Record scores a, ignored unless correct and first of its team for
+// its challenge, see submissions.Service.OnSolve. It returns the
+// teams whose score changed.
+func (s *Scoreboard) Record(a submissions.Attempt) []string {
+	if a.Status != submissions.StatusCorrect {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teams := s.solves[a.Challenge]
+	if teams == nil {
+		teams = make(map[string]time.Time)
+		s.solves[a.Challenge] = teams
+	}
+	if _, ok := teams[a.Team]; ok {
+		return nil
+	}
+	teams[a.Team] = a.At
+
+	sc := s.score(a.Team)
+	sc.Solves++
+	if a.At.After(sc.LastSolve) {
+		sc.LastSolve = a.At
+	}
+	changed := s.update(a.Challenge, a.Team)
+	slices.Sort(changed)
+	return changed
+}
+
+// Refresh scores every solve again, after challenges changed their
+// points or formula or were deleted. It returns the teams whose
+// score changed.
+func (s *Scoreboard) Refresh() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []string
+	for id := range s.solves {
+		changed = append(changed, s.update(id, "")...)
+	}
+	slices.Sort(changed)
+	return slices.Compact(changed)
+}
+
+// Value returns what challenge id is worth to its next solver, e.g.
+// for catalog.Catalog.Points
+func (s *Scoreboard) Value(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value(id, len(s.solves[id])+1)
+}
+
+// Scores returns the scores of the teams that solved anything, best
+// first
+func (s *Scoreboard) Scores() []Score {
+	s.mu.Lock()
+	out := make([]Score, 0, len(s.scores))
+	for _, sc := range s.scores {
+		out = append(out, *sc)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b Score) int {
+		if a.Points != b.Points {
+			return b.Points - a.Points
+		}
+		if c := a.LastSolve.Compare(b.LastSolve); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Team, b.Team)
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out
+}
+
+func (s *Scoreboard) score(team string) *Score {
+	sc, ok := s.scores[team]
+	if !ok {
+		sc = &Score{Team: team}
+		s.scores[team] = sc
+	}
+	return sc
+}
+
+// value is what challenge id is worth with solves, nothing once
+// deleted
+func (s *Scoreboard) value(id string, solves int) int {
+	b, ok := s.challenges.Get(id)
+	if !ok {
+		return 0
+	}
+	spec := s.event
+	if b.Challenge.Scoring != nil {
+		spec = *b.Challenge.Scoring
+	}
+	return spec.Value(b.Challenge.Points, solves)
+}
+
+// update gives the solvers of challenge id its current value,
+// newcomer for the first time, and returns the teams whose score
+// changed
+func (s *Scoreboard) update(id, newcomer string) []string {
+	teams := s.solves[id]
+	old, now := s.values[id], s.value(id, len(teams))
+	s.values[id] = now
+	if old != now && (newcomer == "" || len(teams) > 1) {
+		log.Info().
+			WithMeta("scope", "scoreboard").
+			WithMeta("challenge", id).
+			Msgf("worth %d points, was %d", now, old).Send()
+	}
+
+	var changed []string
+	for team := range teams {
+		delta := now - old
+		if team == newcomer {
+			delta = now
+		}
+		if delta != 0 {
+			s.scores[team].Points += delta
+			changed = append(changed, team)
+		}
+	}
+	return changed
+}
+
+// Handler serves the scores under /scoreboard
+func (s *Scoreboard) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /scoreboard", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.Scores())
+	})
+	return mux
+}
@@ -0,0 +1,84 @@
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/scoring"
+	"github.com/lattesec/ctfjx/internal/submissions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreboard(t *testing.T) {
+	challenges, err := challenge.OpenRegistry("")
+	require.NoError(t, err)
+	put := func(id string, points int, sc *challenge.Scoring) {
+		require.NoError(t, challenges.Put(challenge.Build{Id: id, Version: "v1", Challenge: challenge.Challenge{Id: id, Points: points, Scoring: sc}}))
+	}
+	put("static", 100, &challenge.Scoring{Formula: scoring.Static})
+	put("dyn", 500, &challenge.Scoring{Formula: scoring.Linear, Minimum: 100, Decay: 100})
+	put("evt", 50, nil)
+
+	_, err = New(challenges, scoring.Spec{Formula: scoring.Linear})
+	assert.ErrorIs(t, err, scoring.ErrInvalidScoring)
+	s, err := New(challenges, scoring.Spec{Formula: scoring.Linear, Minimum: 10, Decay: 10})
+	require.NoError(t, err)
+
+	var attempts []submissions.Attempt
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	record := func(team, id string, status submissions.Status) []string {
+		a := submissions.Attempt{Team: team, Challenge: id, Status: status, At: start.Add(time.Duration(len(attempts)) * time.Minute)}
+		attempts = append(attempts, a)
+		return s.Record(a)
+	}
+	points := func() map[string]int {
+		out := make(map[string]int)
+		for _, sc := range s.Scores() {
+			out[sc.Team] = sc.Points
+		}
+		return out
+	}
+
+	assert.Equal(t, 500, s.Value("dyn"))
+	assert.Equal(t, []string{"t1"}, record("t1", "dyn", submissions.StatusCorrect))
+	assert.Equal(t, 400, s.Value("dyn"), "the next solver gets less")
+	assert.Equal(t, []string{"t1", "t2"}, record("t2", "dyn", submissions.StatusCorrect), "earlier solvers lose points too")
+	assert.Nil(t, record("t2", "dyn", submissions.StatusCorrect), "solves count once")
+	assert.Nil(t, record("t3", "dyn", submissions.StatusIncorrect))
+	assert.Equal(t, []string{"t3"}, record("t3", "static", submissions.StatusCorrect))
+	assert.Equal(t, []string{"t3"}, record("t3", "evt", submissions.StatusCorrect))
+	assert.Equal(t, []string{"t1", "t3"}, record("t1", "evt", submissions.StatusCorrect), "the event's formula applies")
+	assert.Equal(t, []string{"t4"}, record("t4", "static", submissions.StatusCorrect))
+	assert.Equal(t, map[string]int{"t1": 440, "t2": 400, "t3": 140, "t4": 100}, points())
+
+	put("dyn", 1000, &challenge.Scoring{Formula: scoring.Linear, Minimum: 100, Decay: 100})
+	require.NoError(t, challenges.Delete("evt"))
+	assert.Equal(t, []string{"t1", "t2", "t3"}, s.Refresh())
+	assert.Equal(t, map[string]int{"t1": 900, "t2": 900, "t3": 100, "t4": 100}, points())
+	assert.Empty(t, s.Refresh())
+
+	scores := s.Scores()
+	assert.Equal(t, []string{"t2", "t1", "t3", "t4"}, []string{scores[0].Team, scores[1].Team, scores[2].Team, scores[3].Team},
+		"ties go to the earliest last solve")
+	assert.Equal(t, 2, scores[1].Solves)
+	assert.Equal(t, 2, scores[1].Rank)
+
+	fresh, err := New(challenges, scoring.Spec{Formula: scoring.Linear, Minimum: 10, Decay: 10})
+	require.NoError(t, err)
+	fresh.Load(attempts)
+	assert.Equal(t, scores, fresh.Scores(), "updates match scoring from scratch")
+
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/scoreboard")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var served []Score
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&served))
+	assert.Equal(t, scores, served)
+}
@@ -0,0 +1,92 @@
+// Scoring package computes what challenges are worth as teams solve
+// them. Every team that solved a challenge gets its current value,
+// so the scores of earlier solvers drop with every new solve.
+//
+// With s the solves past the first, initial the challenge's points
+// and minimum its floor, formulas are:
+//
+//	static       initial
+//	linear       initial - decay*s
+//	logarithmic  initial - (initial-minimum) * (s/decay)^2, as CTFd's
+//	parametric   initial - (initial-minimum) * (s/decay)^exponent
+//
+// Values are rounded up and never go below minimum, which the
+// decaying formulas reach after decay solves.
+package scoring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+type Formula string
+
+const (
+	Static      Formula = "static"
+	Linear      Formula = "linear"
+	Logarithmic Formula = "logarithmic"
+	Parametric  Formula = "parametric"
+)
+
+const DEFAULT_EXPONENT = 2
+
+var ErrInvalidScoring = errors.New("invalid scoring")
+
+// Spec is how the value of a challenge decays
+type Spec struct {
+	Formula Formula `yaml:"formula" json:"formula"`
+	Minimum int     `yaml:"minimum,omitempty" json:"minimum,omitempty"`
+	// Points lost per solve for linear, solves until Minimum is
+	// reached for the others
+	Decay    float64 `yaml:"decay,omitempty" json:"decay,omitempty"`
+	Exponent float64 `yaml:"exponent,omitempty" json:"exponent,omitempty"` // parametric only, DEFAULT_EXPONENT if 0
+}
+
+// Validate checks s, whatever points it applies to
+func (s Spec) Validate() error {
+	switch s.Formula {
+	case Static:
+		return nil
+	case Linear, Logarithmic, Parametric:
+	case "":
+		return fmt.Errorf("%w: no formula", ErrInvalidScoring)
+	default:
+		return fmt.Errorf("%w: unknown formula %q", ErrInvalidScoring, s.Formula)
+	}
+	switch {
+	case s.Decay <= 0:
+		return fmt.Errorf("%w: decay must be positive", ErrInvalidScoring)
+	case s.Minimum < 0:
+		return fmt.Errorf("%w: minimum must not be negative", ErrInvalidScoring)
+	case s.Exponent < 0:
+		return fmt.Errorf("%w: exponent must not be negative", ErrInvalidScoring)
+	}
+	return nil
+}
+
+// Value is what a challenge worth initial points is worth after
+// solves, initial if s is invalid
+func (s Spec) Value(initial, solves int) int {
+	if s.Validate() != nil || s.Formula == Static {
+		return initial
+	}
+	minimum := min(s.Minimum, initial)
+	n := float64(max(solves-1, 0)) // the first solve is worth it all
+	spread := float64(initial - minimum)
+
+	var value float64
+	switch s.Formula {
+	case Linear:
+		value = float64(initial) - s.Decay*n
+	case Logarithmic:
+		value = float64(initial) - spread*math.Pow(min(n/s.Decay, 1), 2)
+	case Parametric:
+		exponent := s.Exponent
+		if exponent == 0 {
+			exponent = DEFAULT_EXPONENT
+		}
+		value = float64(initial) - spread*math.Pow(min(n/s.Decay, 1), exponent)
+	}
+	return max(int(math.Ceil(value)), minimum)
+}
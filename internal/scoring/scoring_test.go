@@ -0,0 +1,48 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		spec   Spec
+		solves int
+		want   int
+	}{
+		{Spec{Formula: Static}, 100, 500},
+		{Spec{Formula: Linear, Minimum: 100, Decay: 10}, 0, 500},
+		{Spec{Formula: Linear, Minimum: 100, Decay: 10}, 1, 500},
+		{Spec{Formula: Linear, Minimum: 100, Decay: 10}, 2, 490},
+		{Spec{Formula: Linear, Minimum: 100, Decay: 10}, 50, 100},
+		{Spec{Formula: Logarithmic, Minimum: 100, Decay: 10}, 1, 500},
+		{Spec{Formula: Logarithmic, Minimum: 100, Decay: 10}, 6, 400},
+		{Spec{Formula: Logarithmic, Minimum: 100, Decay: 10}, 11, 100},
+		{Spec{Formula: Logarithmic, Minimum: 100, Decay: 10}, 1000, 100},
+		{Spec{Formula: Logarithmic, Minimum: 100, Decay: 3}, 2, 456},
+		{Spec{Formula: Parametric, Minimum: 100, Decay: 10}, 6, 400},
+		{Spec{Formula: Parametric, Minimum: 100, Decay: 10, Exponent: 1}, 6, 300},
+		{Spec{Formula: Parametric, Minimum: 100, Decay: 10, Exponent: 0.5}, 6, 218},
+		{Spec{Formula: Logarithmic, Minimum: 1000, Decay: 10}, 20, 500},
+		{Spec{Formula: Linear}, 20, 500},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.spec.Value(500, tt.solves), "%+v after %d solves", tt.spec, tt.solves)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Spec{Formula: Static}.Validate())
+	assert.NoError(t, Spec{Formula: Parametric, Decay: 5, Exponent: 3}.Validate())
+	for _, s := range []Spec{
+		{},
+		{Formula: "exponential", Decay: 1},
+		{Formula: Linear},
+		{Formula: Logarithmic, Decay: 1, Minimum: -1},
+		{Formula: Parametric, Decay: 1, Exponent: -1},
+	} {
+		assert.ErrorIs(t, s.Validate(), ErrInvalidScoring, "%+v", s)
+	}
+}
@@ -0,0 +1,191 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/cleanup"
+	"github.com/lattesec/ctfjx/internal/helpers/debughelper"
+	"github.com/lattesec/ctfjx/internal/logging"
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+// How long open Conns get to finish their handlers
+const DEFAULT_SHUTDOWN_DEADLINE = 10 * time.Second
+
+// Coordinator owns the listeners and Conns of a binary and
+// tears them down in order when the process shuts down:
+//
+//  1. listeners are closed     (cleanup.PRIORITY_STOP_ACCEPTING)
+//  2. Conns are sent a goodbye, their handlers are
+//     waited on and then they are closed (cleanup.PRIORITY_DRAIN)
+//  3. the other cleanups run
+//  4. the loggers are flushed  (cleanup.PRIORITY_FLUSH)
+type Coordinator struct {
+	mu        sync.Mutex
+	deadline  time.Duration
+	listeners []io.Closer
+	conns     map[*socket.Conn]struct{}
+	ids       []uint64
+	dumpId    uint64
+}
+
+func New() *Coordinator {
+	return &Coordinator{
+		deadline: DEFAULT_SHUTDOWN_DEADLINE,
+		conns:    make(map[*socket.Conn]struct{}),
+	}
+}
+
+// SetDeadline sets how long in-flight handlers are waited on
+func (c *Coordinator) SetDeadline(d time.Duration) {
+	c.mu.Lock()
+	c.deadline = d
+	c.mu.Unlock()
+}
+
+// AddListener registers anything that accepts new work,
+// such as a net.Listener or an http.Server
+func (c *Coordinator) AddListener(l io.Closer) {
+	c.mu.Lock()
+	c.listeners = append(c.listeners, l)
+	c.mu.Unlock()
+}
+
+func (c *Coordinator) AddConn(conn *socket.Conn) {
+	c.mu.Lock()
+	c.conns[conn] = struct{}{}
+	c.mu.Unlock()
+}
+
+func (c *Coordinator) RemoveConn(conn *socket.Conn) {
+	c.mu.Lock()
+	delete(c.conns, conn)
+	c.mu.Unlock()
+}
+
+// Install registers the shutdown steps as cleanups, and the
+// open Conns as a section of debughelper dumps.
+// Calling it again is a no-op until Uninstall
+func (c *Coordinator) Install() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids != nil {
+		return
+	}
+
+	c.ids = []uint64{
+		cleanup.RegisterPriority("shutdown: stop listeners", cleanup.PRIORITY_STOP_ACCEPTING, c.stopListeners),
+		cleanup.RegisterPriority("shutdown: drain conns", cleanup.PRIORITY_DRAIN, c.drainConns),
+		cleanup.RegisterPriority("shutdown: flush logs", cleanup.PRIORITY_FLUSH, logging.Flush),
+	}
+	c.dumpId = debughelper.RegisterSection("connections", c.dumpConns)
+}
+
+func (c *Coordinator) Uninstall() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range c.ids {
+		cleanup.Unregister(id)
+	}
+	debughelper.UnregisterSection(c.dumpId)
+	c.ids = nil
+}
+
+func (c *Coordinator) dumpConns(w io.Writer) error {
+	c.mu.Lock()
+	conns := make([]string, 0, len(c.conns))
+	for conn := range c.conns {
+		conns = append(conns, conn.String())
+	}
+	c.mu.Unlock()
+
+	sort.Strings(conns)
+	for _, conn := range conns {
+		if _, err := fmt.Fprintln(w, conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Listen installs the shutdown steps and blocks until a
+// shutdown signal or trigger, see cleanup.ListenContext
+func (c *Coordinator) Listen(ctx context.Context) error {
+	c.Install()
+	return cleanup.ListenContext(ctx)
+}
+
+func (c *Coordinator) stopListeners() error {
+	c.mu.Lock()
+	listeners := c.listeners
+	c.listeners = nil
+	c.mu.Unlock()
+
+	var errs []error
+	for _, l := range listeners {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Coordinator) drainConns() error {
+	c.mu.Lock()
+	conns := make([]*socket.Conn, 0, len(c.conns))
+	for conn := range c.conns {
+		conns = append(conns, conn)
+	}
+	c.conns = make(map[*socket.Conn]struct{})
+	deadline := c.deadline
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for _, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := drainConn(ctx, conn); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", conn.Config.Name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func drainConn(ctx context.Context, conn *socket.Conn) error {
+	if !conn.IsOpen() {
+		return nil
+	}
+
+	if err := conn.Send(socket.ActionGoodbye, nil); err != nil {
+		conn.GenLogMsg().Debug().Msgf("failed to send goodbye: %v", err).Send()
+	}
+
+	var errs []error
+	if err := conn.WaitHandlers(ctx); err != nil {
+		log.Warn().
+			WithMeta("scope", "shutdown").
+			WithMeta("conn", conn.Config.Name).
+			Msg("handlers did not finish before the deadline").Send()
+		errs = append(errs, err)
+	}
+	return errors.Join(append(errs, conn.Close())...)
+}
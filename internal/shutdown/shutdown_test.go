@@ -0,0 +1,81 @@
+package shutdown
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/cleanup"
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoordinator(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	raw, err := ln.Accept()
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+
+	cfg := socket.DefaultConnConfig(raw.RemoteAddr().String(), "shutdown-server", nil)
+	cfg.HeartbeatInterval = 0
+	cfg.Handlers[socket.ActionPushStatus] = func(c *socket.Conn, h socket.Header, r io.Reader) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		finished.Store(true)
+	}
+	server := socket.NewConnWithRaw(raw, cfg)
+	go server.Listen()
+
+	c := New()
+	c.AddListener(ln)
+	c.AddConn(server)
+
+	h := socket.Header{Action: socket.ActionPushStatus}
+	b, _ := h.MarshalBytes()
+	_, err = client.Write(b)
+	assert.NoError(t, err)
+	<-started
+
+	var flushed atomic.Bool
+	cleanup.RegisterPriority("flushed", cleanup.PRIORITY_FLUSH-1, func() error {
+		flushed.Store(true)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- c.Listen(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	cleanup.Trigger("test")
+
+	assert.NoError(t, <-done)
+	assert.True(t, finished.Load(), "in-flight handler was not waited on")
+	assert.True(t, flushed.Load())
+	assert.False(t, server.IsOpen())
+
+	_, err = ln.Accept()
+	assert.Error(t, err, "listener should be closed")
+
+	buf := make([]byte, 9)
+	_, err = io.ReadFull(client, buf)
+	assert.NoError(t, err)
+	goodbye, err := socket.UnmarshalHeader(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, socket.ActionGoodbye, goodbye.Action)
+}
+
+func TestCoordinator_Deadline(t *testing.T) {
+	c := New()
+	c.SetDeadline(time.Millisecond)
+	assert.NoError(t, c.drainConns(), "no conns to drain")
+}
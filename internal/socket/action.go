@@ -26,4 +26,25 @@ const (
 	// Status and logs
 	ActionPushStatus    // Agent pushes status update
 	ActionRequestStatus // Server requests current status
+
+	// Remote tasks
+	ActionRunTask    // Daemon asks agent to run a signed task
+	ActionTaskOutput // Agent streams task stdout/stderr
+	ActionTaskResult // Agent reports task exit code
+
+	// Artifact distribution, files are sent with ActionSendFileChunk
+	ActionOfferArtifacts   // Daemon offers a bundle manifest
+	ActionRequestArtifacts // Agent asks for the blobs it does not have
+	ActionArtifactsReady   // Agent has every blob of a bundle
+
+	// Agent self-update, the binary is sent as an artifact bundle
+	ActionOfferUpdate  // Daemon offers a signed agent release
+	ActionUpdateResult // Agent reports whether it installed the release
+
+	ActionReportViolation // Agent reports an instance hitting its limits, e.g. OOM killed
+
+	// Certificates from the daemon's CA
+	ActionEnroll      // Agent trades a join token and a CSR for its first certificate
+	ActionRenewCert   // Agent asks for a fresh certificate over mTLS
+	ActionCertificate // Daemon answers either with a certificate
 )
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"io"
 	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+	"github.com/lattesec/ctfjx/internal/labels"
 )
 
 var ErrAddressRequired = errors.New("address is required")
@@ -13,20 +16,23 @@ type ConnConfig struct {
 	Address string // The address to connect to
 	Name    string // The name of the connection. This only really holds significance in logs.
 
+	Labels labels.Labels // Describe this side to the peer in Hello, e.g. region=eu
+	Token  string        // Sent in Hello by agents without a client certificate
+
 	UseTLS    bool
 	TLSConfig *tls.Config
 
-	AutoReconnect           bool
-	MaxReconnectionAttempts int
-	ReconnectionDelay       time.Duration // The amount of time to wait between reconnection attempts
+	AutoReconnect           bool          `default:"true"`
+	MaxReconnectionAttempts int           `default:"10"`
+	ReconnectionDelay       time.Duration `default:"5s"` // The amount of time to wait between reconnection attempts
 
-	HeartbeatInterval time.Duration // The interval at which to send pings. Set to 0 to disable.
+	HeartbeatInterval time.Duration `default:"10s"` // The interval at which to send pings. Set to 0 to disable.
 
-	MessageSendTimeout time.Duration // The maximum amount of time to wait for a message to be sent
-	MessageRecvTimeout time.Duration // The maximum amount of time to wait for a message to be received
+	MessageSendTimeout time.Duration `default:"5s"` // The maximum amount of time to wait for a message to be sent
+	MessageRecvTimeout time.Duration `default:"5s"` // The maximum amount of time to wait for a message to be received
 
-	MaxHeaderSize  uint
-	MaxMessageSize uint
+	MaxHeaderSize  uint `default:"1048576"` // 1MB
+	MaxMessageSize uint `default:"4194304"` // 4MB
 
 	Handlers map[Action]HandlerFunc // The handlers to use for each action
 }
@@ -38,6 +44,12 @@ func (c *ConnConfig) Validate() error {
 	return nil
 }
 
+// Clone returns a deep copy of the config, so it can
+// be reused for another connection
+func (c *ConnConfig) Clone() *ConnConfig {
+	return mirror.DeepCopy(c)
+}
+
 var DefaultConnHandlers = map[Action]HandlerFunc{
 	ActionPing: func(c *Conn, header Header, r io.Reader) {
 		if err := c.sendPong(); err != nil {
@@ -58,25 +70,17 @@ func DefaultConnConfig(address, name string, tlsCfg *tls.Config) *ConnConfig {
 		handlers[k] = v
 	}
 
-	return &ConnConfig{
+	cfg := &ConnConfig{
 		Address: address,
 		Name:    name,
 
 		UseTLS:    tlsCfg != nil,
 		TLSConfig: tlsCfg,
 
-		AutoReconnect:           true,
-		MaxReconnectionAttempts: 10,
-		ReconnectionDelay:       5 * time.Second,
-
-		HeartbeatInterval: 10 * time.Second,
-
-		MessageSendTimeout: 5 * time.Second,
-		MessageRecvTimeout: 5 * time.Second,
-
-		MaxHeaderSize:  1 << 20, // 1MB
-		MaxMessageSize: 4 << 20, // 4MB
-
 		Handlers: handlers,
 	}
+	if err := mirror.ApplyDefaults(cfg); err != nil {
+		panic(err) // the tags are constant
+	}
+	return cfg
 }
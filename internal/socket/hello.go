@@ -0,0 +1,44 @@
+package socket
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/lattesec/ctfjx/internal/labels"
+	"github.com/lattesec/ctfjx/version"
+)
+
+// Hello is the payload of ActionHello, identifying the peer
+type Hello struct {
+	Name    string        `json:"name"`
+	Version version.Info  `json:"version"`
+	Labels  labels.Labels `json:"labels,omitempty"`
+	Token   string        `json:"token,omitempty"` // authenticates agents without a client certificate
+}
+
+// SendHello introduces this side of the connection to the peer
+func (c *Conn) SendHello() error {
+	return c.SendJSON(ActionHello, Hello{
+		Name:    c.Config.Name,
+		Version: version.Get(),
+		Labels:  c.Config.Labels,
+		Token:   c.Config.Token,
+	})
+}
+
+// ReadHello decodes an ActionHello payload and logs a warning
+// if the peer runs a different version
+func (c *Conn) ReadHello(r io.Reader) (Hello, error) {
+	var h Hello
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return h, err
+	}
+
+	if local := version.Get(); h.Version.Version != local.Version || h.Version.Commit != local.Commit {
+		c.GenLogMsg().Warn().
+			WithMeta("peer_version", h.Version.String()).
+			WithMeta("local_version", local.String()).
+			Msg("version skew with peer").Send()
+	}
+	return h, nil
+}
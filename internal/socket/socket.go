@@ -2,7 +2,9 @@ package socket
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +12,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/ctfjx/internal/logging"
 	"github.com/lattesec/log"
 )
 
@@ -94,6 +98,8 @@ type Conn struct {
 
 	ReadDone chan struct{} // closes when reading is done
 	pongCh   chan struct{}
+
+	inflight sync.WaitGroup // handlers that have not returned yet
 }
 
 func NewConn(cfg *ConnConfig) *Conn {
@@ -266,6 +272,10 @@ func (c *Conn) Close() error {
 	c.muSend.Lock()
 	defer c.muSend.Unlock()
 
+	if c.raw == nil { // already closed, e.g. by the peer
+		return nil
+	}
+
 	c.unsafeGenLogMsg().Info().Msg("closing").Send()
 
 	err := c.raw.Close()
@@ -337,10 +347,11 @@ func (c *Conn) Reconnect() error {
 		time.Sleep(c.Config.ReconnectionDelay)
 	}
 
-	c.GenLogMsg().Warn().
+	err := errors.Join(allErrs...)
+	logging.WithError(c.GenLogMsg().Warn(), err).
 		WithMetaf("attempts", "%d", c.Config.MaxReconnectionAttempts).
 		Msg("reconnect failed").Send()
-	return errors.Join(allErrs...)
+	return err
 }
 
 func (c *Conn) IsOpen() bool {
@@ -421,7 +432,33 @@ func (c *Conn) readLoop() {
 			continue
 		}
 
-		go handler(c, header, bytes.NewReader(payload))
+		c.inflight.Add(1)
+		go func() {
+			defer c.inflight.Done()
+			err := nopanic.NoPanicRunVoidErr(fmt.Sprintf("handler %d", header.Action), func() {
+				handler(c, header, bytes.NewReader(payload))
+			})
+			if err != nil {
+				c.GenLogMsg().Error().Msgf("handler failed: %v", err).Send()
+			}
+		}()
+	}
+}
+
+// WaitHandlers blocks until every dispatched handler has
+// returned or ctx is done
+func (c *Conn) WaitHandlers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -476,6 +513,30 @@ func (c *Conn) heartbeatLoop() {
 	}
 }
 
+// Send writes a message with the given action and payload
+func (c *Conn) Send(action Action, payload []byte) error {
+	if uint(len(payload)) > c.Config.MaxMessageSize {
+		return ErrPayloadTooLarge
+	}
+
+	h := Header{Action: action, Len: uint64(len(payload))}
+	b, err := h.MarshalBytes()
+	if err != nil {
+		return err
+	}
+
+	return c.SafeWrite(append(b, payload...))
+}
+
+// SendJSON writes a message with v encoded as JSON as its payload
+func (c *Conn) SendJSON(action Action, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(action, b)
+}
+
 // Internal ping handler
 func (c *Conn) sendPing() error {
 	h := Header{Action: ActionPing, Len: 0}
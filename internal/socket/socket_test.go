@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lattesec/ctfjx/internal/logging/logtest"
+	"github.com/lattesec/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,3 +85,22 @@ func TestConn_TLSWrap_Fail(t *testing.T) {
 
 	raw.Close()
 }
+
+func TestConn_Connect_TLSFailLogged(t *testing.T) {
+	addr, stop := startMockServer(t, false, func(c net.Conn) {
+		defer c.Close()
+		_, _ = c.Write([]byte("not tls"))
+	})
+	defer stop()
+
+	cfg := DefaultConnConfig(addr, "tls-fail-client", &tls.Config{InsecureSkipVerify: true})
+	cfg.HeartbeatInterval = 0
+
+	logger, capture := logtest.NewLogger(t, log.DEBUG)
+	c := NewConn(cfg)
+	c.RegisterLogger(logger)
+
+	err := c.Connect()
+	assert.ErrorIs(t, err, ErrConnectionTLSUpgradeFailed)
+	assert.True(t, capture.Contains(log.ERROR, "tls wrap failed"), "expected tls failure to be logged")
+}
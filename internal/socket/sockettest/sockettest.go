@@ -0,0 +1,73 @@
+// Sockettest package connects two Conns over loopback TCP,
+// so both sides of a protocol can be tested together.
+//
+// Usage:
+//
+//	daemon, agent := sockettest.Pair(t, pusher.Handlers(), receiver.Handlers())
+//	require.NoError(t, pusher.Push(ctx, daemon, bundle))
+package sockettest
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/stretchr/testify/require"
+)
+
+// Pair returns two connected, listening Conns with the default
+// handlers plus the given ones. They are closed when t ends.
+func Pair(t *testing.T, daemonHandlers, agentHandlers map[socket.Action]socket.HandlerFunc) (daemon, agent *socket.Conn) {
+	t.Helper()
+	return PairTLS(t, nil, nil, daemonHandlers, agentHandlers)
+}
+
+// PairTLS is Pair over TLS, with serverCfg on the daemon and clientCfg
+// on the agent. Both may be nil for plain TCP. The handshake must succeed.
+func PairTLS(t *testing.T, serverCfg, clientCfg *tls.Config, daemonHandlers, agentHandlers map[socket.Action]socket.HandlerFunc) (daemon, agent *socket.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	rawAgent, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	rawDaemon, err := ln.Accept()
+	require.NoError(t, err)
+
+	if serverCfg != nil {
+		tlsDaemon := tls.Server(rawDaemon, serverCfg)
+		handshake := make(chan error, 1)
+		go func() { handshake <- tlsDaemon.Handshake() }()
+		rawAgent, err = socket.WrapTLS(rawAgent, clientCfg)
+		require.NoError(t, err)
+		require.NoError(t, <-handshake)
+		rawDaemon = tlsDaemon
+	}
+
+	daemon = newConn(rawDaemon, "daemon", daemonHandlers)
+	agent = newConn(rawAgent, "agent", agentHandlers)
+	require.Eventually(t, func() bool { return daemon.IsOpen() && agent.IsOpen() }, time.Second, time.Millisecond)
+
+	t.Cleanup(func() {
+		_ = daemon.Close()
+		_ = agent.Close()
+	})
+	return daemon, agent
+}
+
+func newConn(raw net.Conn, name string, handlers map[socket.Action]socket.HandlerFunc) *socket.Conn {
+	cfg := socket.DefaultConnConfig(raw.RemoteAddr().String(), name, nil)
+	cfg.HeartbeatInterval = 0
+	cfg.AutoReconnect = false
+	for a, h := range handlers {
+		cfg.Handlers[a] = h
+	}
+
+	c := socket.NewConnWithRaw(raw, cfg)
+	go c.Listen()
+	return c
+}
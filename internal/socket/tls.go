@@ -21,3 +21,16 @@ func WrapTLS(conn net.Conn, cfg *tls.Config) (net.Conn, error) {
 
 	return tlsConn, nil
 }
+
+// TLSState returns the state of the connection's TLS session,
+// false if it is not a TLS connection
+func (c *Conn) TLSState() (tls.ConnectionState, bool) {
+	c.muConn.RLock()
+	defer c.muConn.RUnlock()
+
+	tlsConn, ok := c.raw.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package status
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+type cpuSampler struct {
+	mu          sync.Mutex
+	idle, total uint64
+}
+
+// sample returns the CPU usage since the previous sample,
+// read from the first line of /proc/stat
+func (s *cpuSampler) sample() float64 {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		return 0
+	}
+	fields := strings.Fields(sc.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0
+	}
+
+	var idle, total uint64
+	for i, v := range fields[1:] {
+		n, _ := strconv.ParseUint(v, 10, 64)
+		total += n
+		if i == 3 || i == 4 { // idle, iowait
+			idle += n
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dIdle, dTotal := idle-s.idle, total-s.total
+	s.idle, s.total = idle, total
+	if dTotal == 0 {
+		return 0
+	}
+	return 100 * float64(dTotal-dIdle) / float64(dTotal)
+}
+
+func memoryUsage() Usage {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return Usage{}
+	}
+	defer f.Close()
+
+	var total, available uint64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		n, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = n * 1024
+		case "MemAvailable:":
+			available = n * 1024
+		}
+	}
+	return Usage{Used: total - available, Total: total}
+}
+
+func diskUsage(pth string) Usage {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(pth, &st); err != nil {
+		return Usage{}
+	}
+	total := st.Blocks * uint64(st.Bsize)
+	free := st.Bavail * uint64(st.Bsize)
+	return Usage{Used: total - free, Total: total}
+}
+
+func loadAverage() [3]float64 {
+	var load [3]float64
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load
+	}
+	fields := strings.Fields(string(b))
+	for i := 0; i < 3 && i < len(fields); i++ {
+		load[i], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	return load
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package status
+
+type cpuSampler struct{}
+
+func (s *cpuSampler) sample() float64 { return 0 }
+
+func memoryUsage() Usage { return Usage{} }
+
+func diskUsage(string) Usage { return Usage{} }
+
+func loadAverage() [3]float64 { return [3]float64{} }
@@ -0,0 +1,132 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/ctfjx/version"
+)
+
+const DEFAULT_REPORT_INTERVAL = 15 * time.Second
+
+// Usage is the used and total amount of a resource, in bytes
+type Usage struct {
+	Used  uint64 `json:"used"`
+	Total uint64 `json:"total"`
+}
+
+// Report is what an agent pushes with ActionPushStatus
+type Report struct {
+	AgentId   string     `json:"agent_id"`
+	Version   string     `json:"version"`
+	Time      time.Time  `json:"time"` // the agent's clock when the report was made
+	CPU       float64    `json:"cpu"`  // percent of all cores, since the previous report
+	Memory    Usage      `json:"memory"`
+	Disk      Usage      `json:"disk"`
+	Load      [3]float64 `json:"load"`
+	Instances []string   `json:"instances"` // ids of the running challenge instances
+
+	// Instance id -> health, for instances with a healthcheck
+	Health map[string]string `json:"health,omitempty"`
+	// Instance id -> state of the healthchecks ctfjx runs itself
+	Checks map[string]Check `json:"checks,omitempty"`
+
+	// Set by the daemon on receipt: its clock minus Time
+	ClockSkew time.Duration `json:"clock_skew,omitempty"`
+}
+
+// Check is the state of an instance's healthcheck
+type Check struct {
+	Challenge string    `json:"challenge,omitempty"`
+	Status    string    `json:"status"`   // starting, healthy or unhealthy
+	Failures  int       `json:"failures"` // in a row, since the last restart
+	Restarts  int       `json:"restarts"` // in a row, without passing in between
+	Escalated bool      `json:"escalated,omitempty"`
+	Error     string    `json:"error,omitempty"` // of the last failed check
+	Checks    int64     `json:"checks"`
+	Passed    int64     `json:"passed"`
+	Since     time.Time `json:"since"` // when Status last changed
+}
+
+// Decode reads a Report from an ActionPushStatus payload
+func Decode(r io.Reader) (Report, error) {
+	var rep Report
+	err := json.NewDecoder(r).Decode(&rep)
+	return rep, err
+}
+
+// Reporter periodically collects and pushes Reports over a Conn
+type Reporter struct {
+	AgentId   string
+	Interval  time.Duration
+	DiskPath  string                   // the filesystem to report, "/" by default
+	Instances func() []string          // optional
+	Health    func() map[string]string // optional
+	Checks    func() map[string]Check  // optional
+
+	sampler cpuSampler
+}
+
+func NewReporter(agentId string) *Reporter {
+	return &Reporter{
+		AgentId:  agentId,
+		Interval: DEFAULT_REPORT_INTERVAL,
+		DiskPath: "/",
+	}
+}
+
+// Collect builds a Report of the current host. Metrics the
+// platform does not support are left zero.
+func (r *Reporter) Collect() Report {
+	rep := Report{
+		AgentId: r.AgentId,
+		Version: version.Get().Version,
+		Time:    time.Now().UTC(),
+		CPU:     r.sampler.sample(),
+		Memory:  memoryUsage(),
+		Disk:    diskUsage(r.DiskPath),
+		Load:    loadAverage(),
+	}
+	if r.Instances != nil {
+		rep.Instances = r.Instances()
+	}
+	if r.Health != nil {
+		rep.Health = r.Health()
+	}
+	if r.Checks != nil {
+		rep.Checks = r.Checks()
+	}
+	return rep
+}
+
+// Handlers answers ActionRequestStatus with a fresh report
+func (r *Reporter) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionRequestStatus: func(c *socket.Conn, h socket.Header, _ io.Reader) {
+			if err := c.SendJSON(socket.ActionPushStatus, r.Collect()); err != nil {
+				c.GenLogMsg().Error().Msgf("failed to push status: %v", err).Send()
+			}
+		},
+	}
+}
+
+// Run pushes a report over c every Interval until ctx is done
+func (r *Reporter) Run(ctx context.Context, c *socket.Conn) {
+	t := time.NewTicker(r.Interval)
+	defer t.Stop()
+
+	for {
+		if err := c.SendJSON(socket.ActionPushStatus, r.Collect()); err != nil {
+			c.GenLogMsg().Warn().Msgf("failed to push status: %v", err).Send()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporter_Collect(t *testing.T) {
+	r := NewReporter("agent-1")
+	r.Instances = func() []string { return []string{"web1-team42"} }
+
+	rep := r.Collect()
+	assert.Equal(t, "agent-1", rep.AgentId)
+	assert.Equal(t, []string{"web1-team42"}, rep.Instances)
+	if runtime.GOOS == "linux" {
+		assert.NotZero(t, rep.Memory.Total)
+		assert.NotZero(t, rep.Disk.Total)
+	}
+
+	b, err := json.Marshal(rep)
+	assert.NoError(t, err)
+	got, err := Decode(bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, rep.AgentId, got.AgentId)
+	assert.True(t, rep.Time.Equal(got.Time))
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+)
+
+// Path the local backend's Handler serves downloads under
+const LOCAL_PATH_PREFIX = "/files/"
+
+// LocalConfig stores objects in a directory, downloaded through
+// Handler at BaseURL
+type LocalConfig struct {
+	Dir        string `yaml:"dir" toml:"dir" json:"dir" usage:"directory attachments are stored in"`
+	BaseURL    string `yaml:"base_url" toml:"base_url" json:"base_url" usage:"public url the files handler is mounted at, e.g. https://files.ctf.example"`
+	Secret     string `yaml:"secret" toml:"secret" json:"secret" usage:"key signing download urls"`
+	SecretFile string `yaml:"secret_file" toml:"secret_file" json:"secret_file" usage:"file to read secret from"`
+}
+
+// Local is a backend on the local disk
+type Local struct {
+	store   *artifacts.Store
+	baseURL string
+	secret  []byte
+
+	// Swapped out in tests
+	now func() time.Time
+}
+
+func NewLocal(cfg LocalConfig) (*Local, error) {
+	switch {
+	case cfg.Dir == "":
+		return nil, fmt.Errorf("%w: local.dir is required", ErrInvalidConfig)
+	case cfg.Secret == "":
+		return nil, fmt.Errorf("%w: local.secret is required", ErrInvalidConfig)
+	}
+	store, err := artifacts.NewStore(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{store: store, baseURL: strings.TrimSuffix(cfg.BaseURL, "/"), secret: []byte(cfg.Secret), now: time.Now}, nil
+}
+
+func (l *Local) Name() string { return BACKEND_LOCAL }
+
+func (l *Local) Has(_ context.Context, digest string) (bool, error) {
+	return l.store.Has(digest), nil
+}
+
+func (l *Local) Put(_ context.Context, digest string, _ int64, r io.Reader) error {
+	got, _, err := l.store.Put(r)
+	if err != nil {
+		return err
+	}
+	if got != digest {
+		_ = l.store.Remove(got)
+		return fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, digest, got)
+	}
+	return nil
+}
+
+func (l *Local) Open(_ context.Context, digest string) (io.ReadCloser, error) {
+	f, err := l.store.Open(digest)
+	if errors.Is(err, artifacts.ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, digest)
+	}
+	return f, err
+}
+
+func (l *Local) Delete(_ context.Context, digest string) error {
+	return l.store.Remove(digest)
+}
+
+// signature authenticates a download of digest as filename
+func (l *Local) signature(digest, filename string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d", digest, filename, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns <BaseURL>/files/<hex>/<filename>?expires=...&sig=...
+func (l *Local) URL(_ context.Context, digest, filename string, expires time.Time) (string, error) {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", l.signature(digest, filename, expires.Unix()))
+	return l.baseURL + LOCAL_PATH_PREFIX + strings.TrimPrefix(digest, "sha256:") + "/" + url.PathEscape(filename) + "?" + q.Encode(), nil
+}
+
+// verify checks a request for LOCAL_PATH_PREFIX<hex>/<filename>
+func (l *Local) verify(r *http.Request) (digest, filename string, err error) {
+	hexDigest, filename, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, LOCAL_PATH_PREFIX), "/")
+	digest = "sha256:" + hexDigest
+	if !ok || filename == "" || strings.Contains(filename, "/") || !artifacts.ValidDigest(digest) {
+		return "", "", ErrInvalidURL
+	}
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || l.now().Unix() > expires {
+		return "", "", ErrInvalidURL
+	}
+	want := l.signature(digest, filename, expires)
+	if !hmac.Equal([]byte(want), []byte(r.URL.Query().Get("sig"))) {
+		return "", "", ErrInvalidURL
+	}
+	return digest, filename, nil
+}
+
+// Handler serves the downloads URL signs, mount it at LOCAL_PATH_PREFIX
+func (l *Local) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		digest, filename, err := l.verify(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		f, err := l.store.Open(digest)
+		if err != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Header().Set("ETag", `"`+digest+`"`)
+		w.Header().Set("Repr-Digest", ReprDigest(digest))
+		w.Header().Set("Cache-Control", "private, immutable")
+		http.ServeContent(w, r, filename, time.Time{}, f)
+	})
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_S3_REGION = "us-east-1"
+
+	// Presigned urls are valid for at most a week
+	S3_MAX_EXPIRY = 7 * 24 * time.Hour
+
+	sigAlgorithm    = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// S3Config stores objects in an S3-compatible bucket, e.g. on MinIO
+type S3Config struct {
+	Endpoint      string `yaml:"endpoint" toml:"endpoint" json:"endpoint" usage:"e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000"`
+	Region        string `yaml:"region" toml:"region" json:"region" default:"us-east-1"`
+	Bucket        string `yaml:"bucket" toml:"bucket" json:"bucket"`
+	Prefix        string `yaml:"prefix" toml:"prefix" json:"prefix" usage:"prepended to object keys"`
+	PathStyle     bool   `yaml:"path_style" toml:"path_style" json:"path_style" usage:"address the bucket in the path, as MinIO needs"`
+	AccessKey     string `yaml:"access_key" toml:"access_key" json:"access_key"`
+	SecretKey     string `yaml:"secret_key" toml:"secret_key" json:"secret_key"`
+	SecretKeyFile string `yaml:"secret_key_file" toml:"secret_key_file" json:"secret_key_file" usage:"file to read secret_key from"`
+
+	Client *http.Client `yaml:"-" toml:"-" json:"-"` // http.DefaultClient if nil
+}
+
+// S3 is a backend on an S3-compatible bucket, requests are signed
+// with AWS Signature Version 4
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+
+	// Swapped out in tests
+	now func() time.Time
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	switch {
+	case cfg.Endpoint == "":
+		return nil, fmt.Errorf("%w: s3.endpoint is required", ErrInvalidConfig)
+	case cfg.Bucket == "":
+		return nil, fmt.Errorf("%w: s3.bucket is required", ErrInvalidConfig)
+	case cfg.AccessKey == "" || cfg.SecretKey == "":
+		return nil, fmt.Errorf("%w: s3.access_key and s3.secret_key are required", ErrInvalidConfig)
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: bad s3.endpoint %q", ErrInvalidConfig, cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = DEFAULT_S3_REGION
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{cfg: cfg, endpoint: u, client: client, now: time.Now}, nil
+}
+
+func (s *S3) Name() string { return BACKEND_S3 }
+
+// key returns the object key of digest, <prefix>sha256/<hex>
+func (s *S3) key(digest string) string {
+	return s.cfg.Prefix + strings.Replace(digest, ":", "/", 1)
+}
+
+// objectURL returns the url of the object at key
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	u.RawPath = escapePath(u.Path)
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method, digest string, size int64, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(s.key(digest)).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	payload := emptyPayload
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		// the object's digest is the hash of the payload S3 verifies,
+		// and the checksum it keeps for GetObjectAttributes
+		payload = strings.TrimPrefix(digest, "sha256:")
+		if sum, err := hex.DecodeString(payload); err == nil {
+			req.Header.Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sum))
+		}
+	}
+	s.sign(req, payload, s.now())
+	return s.client.Do(req)
+}
+
+// check turns error responses into errors
+func check(resp *http.Response, err error, what string) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, what)
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 answered %s for %s: %s", resp.Status, what, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *S3) Has(ctx context.Context, digest string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, digest, 0, nil)
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return false, nil
+	}
+	if err := check(resp, err, digest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3) Put(ctx context.Context, digest string, size int64, r io.Reader) error {
+	resp, err := s.do(ctx, http.MethodPut, digest, size, r)
+	return check(resp, err, digest)
+}
+
+func (s *S3) Open(ctx context.Context, digest string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, digest, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, check(resp, nil, digest)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, digest string) error {
+	resp, err := s.do(ctx, http.MethodDelete, digest, 0, nil)
+	return check(resp, err, digest)
+}
+
+// URL presigns a GET of the object, downloaded as filename
+func (s *S3) URL(_ context.Context, digest, filename string, expires time.Time) (string, error) {
+	// X-Amz-Date has no fraction of a second
+	now := s.now().Truncate(time.Second)
+	ttl := expires.Sub(now)
+	if ttl <= 0 || ttl > S3_MAX_EXPIRY {
+		return "", fmt.Errorf("%w: expiry must be within %s", ErrInvalidConfig, S3_MAX_EXPIRY)
+	}
+	u := s.objectURL(s.key(digest))
+	q := url.Values{}
+	if filename != "" {
+		q.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	return s.presign(http.MethodGet, u, q, ttl, now), nil
+}
+
+// SHA-256 of an empty payload
+var emptyPayload = hex.EncodeToString(sha256.New().Sum(nil))
+
+func (s *S3) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signingKey(t time.Time) []byte {
+	k := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), t.Format("20060102"))
+	k = hmacSHA256(k, s.cfg.Region)
+	k = hmacSHA256(k, "s3")
+	return hmacSHA256(k, "aws4_request")
+}
+
+// sign adds the Authorization header to req, signing its host,
+// x-amz-* and range headers
+func (s *S3) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" || lk == "content-type" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canon := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	sig := s.signature(canon, t)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigAlgorithm, s.cfg.AccessKey, s.scope(t), signed, sig))
+}
+
+// presign returns u with the query signing a method request
+// for ttl, only the host header is signed
+func (s *S3) presign(method string, u *url.URL, q url.Values, ttl time.Duration, t time.Time) string {
+	t = t.UTC()
+	q.Set("X-Amz-Algorithm", sigAlgorithm)
+	q.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(ttl/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	canon := strings.Join([]string{
+		method,
+		escapePath(u.Path),
+		canonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	// the signature goes last, out of the sorted order
+	out := *u
+	out.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + s.signature(canon, t)
+	return out.String()
+}
+
+func (s *S3) signature(canonicalRequest string, t time.Time) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	toSign := strings.Join([]string{sigAlgorithm, t.Format(amzDateFormat), s.scope(t), hex.EncodeToString(hash[:])}, "\n")
+	return hex.EncodeToString(hmacSHA256(s.signingKey(t), toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts and escapes q as SigV4 expects
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		values := slices.Clone(q[k])
+		slices.Sort(values)
+		for _, v := range values {
+			parts = append(parts, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escapePath(p string) string {
+	return escape(p, false)
+}
+
+// escape percent-encodes everything but unreserved characters,
+// and slashes unless slash is set
+func escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,210 @@
+// Storage package keeps challenge attachments where players download
+// them from, on the local disk or in an S3-compatible bucket such as
+// MinIO. Objects are addressed by their SHA-256 digest, so the same
+// file is stored once however many challenges hand it out, and
+// downloads go through expiring signed URLs served by the backend
+// itself rather than through the daemon.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/challenge"
+)
+
+const (
+	BACKEND_LOCAL = "local"
+	BACKEND_S3    = "s3"
+
+	DEFAULT_URL_TTL = 15 * time.Minute
+)
+
+var (
+	ErrNotFound       = errors.New("object not found")
+	ErrInvalidConfig  = errors.New("invalid storage config")
+	ErrInvalidURL     = errors.New("invalid or expired download url")
+	ErrDigestMismatch = artifacts.ErrDigestMismatch
+)
+
+// Backend stores objects by digest, e.g. "sha256:ab12..."
+type Backend interface {
+	Name() string
+	Has(ctx context.Context, digest string) (bool, error)
+	// Put stores the size bytes of r, which the caller has hashed to digest
+	Put(ctx context.Context, digest string, size int64, r io.Reader) error
+	Open(ctx context.Context, digest string) (io.ReadCloser, error)
+	Delete(ctx context.Context, digest string) error
+	// URL returns a link downloading the object as filename, valid until expires
+	URL(ctx context.Context, digest, filename string, expires time.Time) (string, error)
+}
+
+// Config picks and configures a backend
+type Config struct {
+	Backend string        `yaml:"backend" toml:"backend" json:"backend" default:"local" usage:"where attachments are stored, local or s3"`
+	URLTTL  time.Duration `yaml:"url_ttl" toml:"url_ttl" json:"url_ttl" default:"15m" usage:"how long download urls stay valid"`
+	Local   LocalConfig   `yaml:"local" toml:"local" json:"local"`
+	S3      S3Config      `yaml:"s3" toml:"s3" json:"s3"`
+}
+
+// Open returns the storage cfg describes
+func Open(cfg Config) (*Storage, error) {
+	var (
+		b   Backend
+		err error
+	)
+	switch cfg.Backend {
+	case "", BACKEND_LOCAL:
+		b, err = NewLocal(cfg.Local)
+	case BACKEND_S3:
+		b, err = NewS3(cfg.S3)
+	default:
+		err = fmt.Errorf("%w: unknown backend %q", ErrInvalidConfig, cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := New(b)
+	if cfg.URLTTL > 0 {
+		s.URLTTL = cfg.URLTTL
+	}
+	return s, nil
+}
+
+// ReprDigest formats digest as a Repr-Digest header (RFC 9530),
+// e.g. "sha-256=:<base64>:"
+func ReprDigest(digest string) string {
+	sum, err := hex.DecodeString(strings.TrimPrefix(digest, "sha256:"))
+	if err != nil {
+		return ""
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// Object is a stored file
+type Object struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// Storage deduplicates objects on top of a backend
+type Storage struct {
+	backend Backend
+	URLTTL  time.Duration
+
+	// Swapped out in tests
+	now func() time.Time
+}
+
+func New(b Backend) *Storage {
+	return &Storage{backend: b, URLTTL: DEFAULT_URL_TTL, now: time.Now}
+}
+
+func (s *Storage) Backend() Backend {
+	return s.backend
+}
+
+// Upload stores the content of r, unless an object with the same
+// content is already stored
+func (s *Storage) Upload(ctx context.Context, r io.Reader) (Object, error) {
+	tmp, err := os.CreateTemp("", "ctfjx-upload-*")
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return Object{}, err
+	}
+	obj := Object{Digest: "sha256:" + hex.EncodeToString(h.Sum(nil)), Size: size}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return Object{}, err
+	}
+	return obj, s.put(ctx, obj, tmp)
+}
+
+// put uploads r unless it is stored already, failing the upload if
+// r does not have the object's digest
+func (s *Storage) put(ctx context.Context, obj Object, r io.Reader) error {
+	has, err := s.backend.Has(ctx, obj.Digest)
+	if err != nil || has {
+		return err
+	}
+	return s.backend.Put(ctx, obj.Digest, obj.Size, artifacts.NewVerifier(r, obj.Digest))
+}
+
+// Publish uploads the attachments of b from the artifact store,
+// checking them against the digests recorded at build time
+func (s *Storage) Publish(ctx context.Context, store *artifacts.Store, b challenge.Build) error {
+	for _, a := range b.Attachments {
+		f, err := store.Open(a.Digest)
+		if err != nil {
+			return err
+		}
+		err = s.put(ctx, Object{Digest: a.Digest, Size: a.Size}, f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("attachment %s: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// URL returns a link downloading the object as filename,
+// valid for URLTTL
+func (s *Storage) URL(ctx context.Context, digest, filename string) (string, time.Time, error) {
+	if !artifacts.ValidDigest(digest) {
+		return "", time.Time{}, fmt.Errorf("%w: %q", artifacts.ErrInvalidDigest, digest)
+	}
+	expires := s.now().Add(s.URLTTL).Truncate(time.Second)
+	u, err := s.backend.URL(ctx, digest, filename, expires)
+	return u, expires, err
+}
+
+// Open returns the content of the object with digest, reading it
+// fails with ErrDigestMismatch at the end if it was corrupted
+func (s *Storage) Open(ctx context.Context, digest string) (io.ReadCloser, error) {
+	rc, err := s.backend.Open(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	return verifiedReader{artifacts.NewVerifier(rc, digest), rc}, nil
+}
+
+type verifiedReader struct {
+	io.Reader
+	io.Closer
+}
+
+// Verify reads the object with digest back and checks its checksum
+func (s *Storage) Verify(ctx context.Context, digest string) error {
+	rc, err := s.Open(ctx, digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+// Has tells if the object with digest is stored
+func (s *Storage) Has(ctx context.Context, digest string) (bool, error) {
+	return s.backend.Has(ctx, digest)
+}
+
+// Delete removes the object with digest
+func (s *Storage) Delete(ctx context.Context, digest string) error {
+	return s.backend.Delete(ctx, digest)
+}
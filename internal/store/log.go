@@ -0,0 +1,165 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+)
+
+// Log is an append-only file of JSON records, one per line, kept in
+// memory. A Log opened with an empty path is memory-only.
+//
+// Unlike a Collection, a write costs one record whatever the size of
+// the log, for records that are written often and never change, such
+// as submissions.
+type Log[T any] struct {
+	mu     sync.RWMutex
+	file   logFile
+	end    int64 // of the last whole record in file
+	broken error // set if a failed append could not be undone
+	items  []T
+}
+
+// logFile is what a Log needs of its file, swapped out in tests
+type logFile interface {
+	io.Writer
+	io.Seeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// OpenLog loads the log at path, creating it if missing. A record
+// cut short by a crash while it was appended is dropped.
+func OpenLog[T any](path string) (*Log[T], error) {
+	l := &Log[T]{}
+	if path == "" {
+		return l, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, DEFAULT_STORE_FILE_MODE)
+	if err != nil {
+		return nil, err
+	}
+	end, err := l.load(f)
+	if err == nil {
+		// appends go after the last whole record
+		err = f.Truncate(end)
+	}
+	if err == nil {
+		_, err = f.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	l.file = f
+	l.end = end
+	return l, nil
+}
+
+// load reads the records of f, returning where the last one ends
+func (l *Log[T]) load(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	var end int64
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return end, nil // partial or no record
+		}
+		if err != nil {
+			return 0, err
+		}
+		end += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var v T
+		if err := json.Unmarshal(line, &v); err != nil {
+			return 0, fmt.Errorf("record %d: %w", n, err)
+		}
+		l.items = append(l.items, v)
+	}
+}
+
+// Append persists v after the other records. A record that fails
+// to be written is cut from the file, so that the next one starts
+// on a line of its own.
+func (l *Log[T]) Append(v T) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.broken != nil {
+		return l.broken
+	}
+	if l.file != nil {
+		_, err := l.file.Write(data)
+		if err == nil {
+			err = l.file.Sync()
+		}
+		if err != nil {
+			return l.rollback(err)
+		}
+		l.end += int64(len(data))
+	}
+	l.items = append(l.items, mirror.DeepCopy(v))
+	return nil
+}
+
+// rollback cuts the file back to its last whole record after err.
+// callers responsibility to hold mu
+func (l *Log[T]) rollback(err error) error {
+	cutErr := l.file.Truncate(l.end)
+	if cutErr == nil {
+		_, cutErr = l.file.Seek(l.end, io.SeekStart)
+	}
+	if cutErr != nil {
+		l.broken = fmt.Errorf("log broken by a failed append: %w", errors.Join(err, cutErr))
+		return l.broken
+	}
+	return err
+}
+
+// List returns a copy of every record, in the order they were
+// appended
+func (l *Log[T]) List() []T {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := make([]T, len(l.items))
+	for i, v := range l.items {
+		out[i] = mirror.DeepCopy(v)
+	}
+	return out
+}
+
+func (l *Log[T]) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.items)
+}
+
+// Close closes the file of the log, appending fails afterwards
+func (l *Log[T]) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/lattesec/ctfjx/internal/helpers/mirror"
+)
+
+const DEFAULT_STORE_FILE_MODE = 0o600
+
+var ErrNotFound = errors.New("not found")
+
+// Collection is a persistent map of JSON records, kept in memory
+// and rewritten atomically to a single file on every change.
+// A Collection opened with an empty path is memory-only.
+//
+// It is meant for the small, rarely written state of the daemon
+// and agents, such as the agent registry or port allocations.
+type Collection[T any] struct {
+	mu    sync.RWMutex
+	path  string
+	items map[string]T
+}
+
+// Open loads the collection at path, creating it on first write
+func Open[T any](path string) (*Collection[T], error) {
+	c := &Collection[T]{
+		path:  path,
+		items: make(map[string]T),
+	}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.items); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if c.items == nil {
+		c.items = make(map[string]T)
+	}
+	return c, nil
+}
+
+// Memory returns a memory-only collection
+func Memory[T any]() *Collection[T] {
+	c, _ := Open[T]("")
+	return c
+}
+
+// Get returns a copy of the record with id
+func (c *Collection[T]) Get(id string) (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.items[id]
+	return mirror.DeepCopy(v), ok
+}
+
+// List returns a copy of every record, sorted by id
+func (c *Collection[T]) List() []T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ids := c.ids()
+	out := make([]T, len(ids))
+	for i, id := range ids {
+		out[i] = mirror.DeepCopy(c.items[id])
+	}
+	return out
+}
+
+func (c *Collection[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+// Ensure that the caller holds the lock
+func (c *Collection[T]) ids() []string {
+	ids := make([]string, 0, len(c.items))
+	for id := range c.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (c *Collection[T]) Put(id string, v T) error {
+	return c.Update(func(items map[string]T) error {
+		items[id] = v
+		return nil
+	})
+}
+
+func (c *Collection[T]) Delete(id string) error {
+	return c.Update(func(items map[string]T) error {
+		if _, ok := items[id]; !ok {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		delete(items, id)
+		return nil
+	})
+}
+
+// Update calls fn with a copy of every record. If fn returns nil,
+// the copy is persisted and replaces the records, otherwise
+// nothing changes. Updates are serialized.
+func (c *Collection[T]) Update(fn func(items map[string]T) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := mirror.DeepCopy(c.items)
+	if err := fn(items); err != nil {
+		return err
+	}
+	if err := c.persist(items); err != nil {
+		return err
+	}
+	c.items = items
+	return nil
+}
+
+func (c *Collection[T]) persist(items map[string]T) error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, data, DEFAULT_STORE_FILE_MODE)
+}
+
+func writeFileAtomic(pth string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(pth), "."+filepath.Base(pth)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, pth)
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	Name string
+	Tags []string
+}
+
+func TestCollection(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "state", "records.json")
+	c, err := Open[record](pth)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Put("b", record{Name: "b", Tags: []string{"x"}}))
+	require.NoError(t, c.Put("a", record{Name: "a"}))
+
+	got, ok := c.Get("b")
+	assert.True(t, ok)
+	got.Tags[0] = "mutated"
+	got, _ = c.Get("b")
+	assert.Equal(t, "x", got.Tags[0], "records are copied out")
+
+	errAbort := errors.New("abort")
+	err = c.Update(func(items map[string]record) error {
+		delete(items, "a")
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+	assert.Equal(t, 2, c.Len(), "failed updates change nothing")
+
+	reopened, err := Open[record](pth)
+	require.NoError(t, err)
+	assert.Equal(t, []record{{Name: "a"}, {Name: "b", Tags: []string{"x"}}}, reopened.List())
+
+	assert.ErrorIs(t, c.Delete("missing"), ErrNotFound)
+}
+
+func TestLog(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "state", "records.jsonl")
+	l, err := OpenLog[record](pth)
+	require.NoError(t, err)
+
+	require.NoError(t, l.Append(record{Name: "b", Tags: []string{"x"}}))
+	require.NoError(t, l.Append(record{Name: "a"}))
+	got := l.List()
+	got[0].Tags[0] = "mutated"
+	assert.Equal(t, []record{{Name: "b", Tags: []string{"x"}}, {Name: "a"}}, l.List(), "records are copied out, in order")
+	require.NoError(t, l.Close())
+	assert.Error(t, l.Append(record{Name: "c"}), "closed logs are not appended to")
+
+	f, err := os.OpenFile(pth, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"Name": "cut sh`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := OpenLog[record](pth)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len(), "partial records are dropped")
+	require.NoError(t, reopened.Append(record{Name: "c"}))
+	require.NoError(t, reopened.Close())
+	reopened, err = OpenLog[record](pth)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, "c", reopened.List()[2].Name)
+
+	require.NoError(t, os.WriteFile(pth, []byte("{}\nnope\n"), 0o600))
+	_, err = OpenLog[record](pth)
+	assert.ErrorContains(t, err, "record 2")
+
+	mem, err := OpenLog[record]("")
+	require.NoError(t, err)
+	require.NoError(t, mem.Append(record{Name: "a"}))
+	assert.Equal(t, 1, mem.Len())
+}
+
+// tornFile writes half of the next record and fails, like a full disk
+type tornFile struct {
+	*os.File
+	tear, failTruncate bool
+}
+
+func (f *tornFile) Write(p []byte) (int, error) {
+	if f.tear {
+		f.tear = false
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, syscall.ENOSPC
+	}
+	return f.File.Write(p)
+}
+
+func (f *tornFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return syscall.EIO
+	}
+	return f.File.Truncate(size)
+}
+
+func TestLog_FailedAppend(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "records.jsonl")
+	l, err := OpenLog[record](pth)
+	require.NoError(t, err)
+	require.NoError(t, l.Append(record{Name: "a"}))
+
+	torn := &tornFile{File: l.file.(*os.File), tear: true}
+	l.file = torn
+	assert.ErrorIs(t, l.Append(record{Name: "torn"}), syscall.ENOSPC)
+	require.NoError(t, l.Append(record{Name: "b"}), "the disk has room again")
+	assert.Equal(t, 2, l.Len())
+
+	torn.tear, torn.failTruncate = true, true
+	assert.ErrorIs(t, l.Append(record{Name: "torn"}), syscall.EIO)
+	assert.ErrorIs(t, l.Append(record{Name: "c"}), syscall.EIO, "a log that could not be cut is not appended to")
+	require.NoError(t, l.Close())
+
+	reopened, err := OpenLog[record](pth)
+	require.NoError(t, err, "the daemon can restart")
+	defer reopened.Close()
+	assert.Equal(t, []record{{Name: "a"}, {Name: "b"}}, reopened.List())
+}
@@ -0,0 +1,401 @@
+// Submissions package checks the flags teams submit, e.g.
+//
+//	POST /challenges/notes/submit {"flag": "ctfjx{...}"}
+//
+// A submission goes through the event window, the unlock graph,
+// the team's previous solves and the flag itself, and every one is
+// recorded with its outcome, to an append-only log, before another
+// submission of the team for the challenge is checked, so a team
+// never solves a challenge twice.
+package submissions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/helpers/keylock"
+	"github.com/lattesec/ctfjx/internal/instances"
+	"github.com/lattesec/ctfjx/internal/store"
+	"github.com/lattesec/log"
+)
+
+const (
+	// Longest flag accepted, in bytes
+	MAX_FLAG_LEN = 1024
+)
+
+var (
+	ErrEmptyFlag       = errors.New("empty flag")
+	ErrFlagTooLong     = errors.New("flag too long")
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// Status is the outcome of a submission
+type Status string
+
+const (
+	StatusCorrect       Status = "correct"
+	StatusIncorrect     Status = "incorrect"
+	StatusAlreadySolved Status = "already_solved" // the flag was not checked
+	StatusLocked        Status = "locked"         // prerequisites are not solved
+	StatusNotStarted    Status = "not_started"
+	StatusEnded         Status = "ended"
+	StatusUnknown       Status = "unknown_challenge"
+)
+
+// Window is when flags are accepted, zero times leave it open
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// status is StatusNotStarted or StatusEnded if t is outside w
+func (w Window) status(t time.Time) Status {
+	switch {
+	case !w.Start.IsZero() && t.Before(w.Start):
+		return StatusNotStarted
+	case !w.End.IsZero() && !t.Before(w.End):
+		return StatusEnded
+	}
+	return ""
+}
+
+// Attempt is a recorded submission
+type Attempt struct {
+	Id        string    `json:"id"` // sorts in submission order
+	Team      string    `json:"team"`
+	Challenge string    `json:"challenge"`
+	Version   string    `json:"version,omitempty"` // of the challenge's build
+	Flag      string    `json:"flag"`              // as submitted, normalized
+	Status    Status    `json:"status"`
+	At        time.Time `json:"at"`
+}
+
+// Result is what a team is told about its submission
+type Result struct {
+	Status    Status    `json:"status"`
+	Challenge string    `json:"challenge"`
+	Attempt   string    `json:"attempt"`
+	SolvedAt  time.Time `json:"solved_at,omitzero"` // when correct or already solved
+}
+
+// Checker tells if a flag is correct for a team, whatever its type,
+// see instances.Manager
+type Checker interface {
+	CheckFlag(challengeId, team, submitted string) (bool, error)
+}
+
+var _ Checker = (*instances.Manager)(nil)
+
+// unlockGraph is the unlock graph of a generation of the challenges
+type unlockGraph struct {
+	gen uint64
+	g   *challenge.Graph
+	err error
+}
+
+// Service accepts submissions
+type Service struct {
+	challenges *challenge.Registry
+	checker    Checker
+	attempts   *store.Log[Attempt]
+	window     Window
+	locks      keylock.Map // by team and challenge
+
+	mu     sync.RWMutex
+	solves map[string]map[string]Attempt // team -> challenge -> its solve
+	graph  *unlockGraph                  // cached until the challenges change
+
+	// Tells which team sent r, authenticating it. Every request is
+	// unauthenticated if nil.
+	Team func(r *http.Request) (string, error)
+	// Called with every correct attempt once it is recorded, e.g.
+	// scoreboard.Scoreboard.Record
+	OnSolve func(Attempt)
+
+	// Swapped out in tests
+	now func() time.Time
+}
+
+// New creates a service with its attempts logged at path,
+// memory-only if empty
+func New(challenges *challenge.Registry, checker Checker, path string, window Window) (*Service, error) {
+	attempts, err := store.OpenLog[Attempt](path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{
+		challenges: challenges,
+		checker:    checker,
+		attempts:   attempts,
+		window:     window,
+		solves:     make(map[string]map[string]Attempt),
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+	for _, a := range attempts.List() {
+		s.index(a)
+	}
+	return s, nil
+}
+
+// Close closes the log of attempts
+func (s *Service) Close() error {
+	return s.attempts.Close()
+}
+
+// index records a if it is a solve
+func (s *Service) index(a Attempt) {
+	if a.Status != StatusCorrect {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	teams := s.solves[a.Team]
+	if teams == nil {
+		teams = make(map[string]Attempt)
+		s.solves[a.Team] = teams
+	}
+	if _, ok := teams[a.Challenge]; !ok {
+		teams[a.Challenge] = a
+	}
+}
+
+// solved returns the challenges team solved
+func (s *Service) solved(team string) map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]bool, len(s.solves[team]))
+	for id := range s.solves[team] {
+		out[id] = true
+	}
+	return out
+}
+
+// solvedAt returns when team solved challenge id, false if it did not
+func (s *Service) solvedAt(team, id string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.solves[team][id]
+	return a.At, ok
+}
+
+// unlocks returns the unlock graph of the built challenges, built
+// again only once they changed
+func (s *Service) unlocks() (*challenge.Graph, error) {
+	gen := s.challenges.Generation()
+	s.mu.RLock()
+	cached := s.graph
+	s.mu.RUnlock()
+	if cached != nil && cached.gen == gen {
+		return cached.g, cached.err
+	}
+
+	builds := s.challenges.List()
+	cs := make([]*challenge.Challenge, len(builds))
+	for i, b := range builds {
+		c := b.Challenge
+		c.Id = b.Id
+		cs[i] = &c
+	}
+	g, err := challenge.NewGraph(cs)
+
+	s.mu.Lock()
+	s.graph = &unlockGraph{gen: gen, g: g, err: err}
+	s.mu.Unlock()
+	return g, err
+}
+
+// Submit checks flag for challengeId on behalf of team, which must
+// be authenticated, and records the attempt. Errors are failures to
+// check or record it, the flag was neither accepted nor rejected.
+func (s *Service) Submit(team, challengeId, flag string) (Result, error) {
+	flag = flags.Normalize(flag)
+	switch {
+	case team == "":
+		return Result{}, ErrUnauthenticated
+	case flag == "":
+		return Result{}, ErrEmptyFlag
+	case len(flag) > MAX_FLAG_LEN:
+		return Result{}, fmt.Errorf("%w: more than %d bytes", ErrFlagTooLong, MAX_FLAG_LEN)
+	}
+	id, err := attemptId()
+	if err != nil {
+		return Result{}, err
+	}
+
+	unlock := s.locks.Lock(team + "\x00" + challengeId)
+	defer unlock()
+
+	now := s.now()
+	a := Attempt{Id: now.Format("20060102T150405.000000000Z") + "-" + id, Team: team, Challenge: challengeId, Flag: flag, At: now}
+	status, solvedAt, err := s.check(&a)
+	if err != nil {
+		return Result{}, err
+	}
+	a.Status = status
+	if err := s.attempts.Append(a); err != nil {
+		return Result{}, err
+	}
+	s.index(a)
+
+	out := Result{Status: status, Challenge: challengeId, Attempt: a.Id, SolvedAt: solvedAt}
+	if out.Status == StatusCorrect {
+		log.Info().
+			WithMeta("scope", "submissions").
+			WithMeta("team", team).
+			WithMeta("challenge", challengeId).
+			Msg("challenge solved").Send()
+		if s.OnSolve != nil {
+			s.OnSolve(a)
+		}
+	}
+	return out, nil
+}
+
+// check runs the pipeline on a, returning its status and when the
+// challenge was solved
+func (s *Service) check(a *Attempt) (Status, time.Time, error) {
+	if status := s.window.status(a.At); status != "" {
+		return status, time.Time{}, nil
+	}
+	b, ok := s.challenges.Get(a.Challenge)
+	if !ok {
+		return StatusUnknown, time.Time{}, nil
+	}
+	a.Version = b.Version
+
+	if at, ok := s.solvedAt(a.Team, a.Challenge); ok {
+		return StatusAlreadySolved, at, nil
+	}
+	g, err := s.unlocks()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !g.Unlocked(a.Challenge, s.solved(a.Team)) {
+		return StatusLocked, time.Time{}, nil
+	}
+
+	ok, err = s.checker.CheckFlag(a.Challenge, a.Team, a.Flag)
+	switch {
+	case err != nil:
+		return "", time.Time{}, fmt.Errorf("failed to check the flag of %s: %w", a.Challenge, err)
+	case ok:
+		return StatusCorrect, a.At, nil
+	}
+	return StatusIncorrect, time.Time{}, nil
+}
+
+func attemptId() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Attempts returns the attempts of team in submission order, every
+// attempt if empty
+func (s *Service) Attempts(team string) []Attempt {
+	var out []Attempt
+	for _, a := range s.attempts.List() {
+		if team == "" || a.Team == team {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Solves returns the correct attempts of team, of every team if
+// empty, in submission order
+func (s *Service) Solves(team string) []Attempt {
+	s.mu.RLock()
+	var out []Attempt
+	for t, challenges := range s.solves {
+		if team != "" && t != team {
+			continue
+		}
+		for _, a := range challenges {
+			out = append(out, a)
+		}
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(out, func(a, b Attempt) int { return strings.Compare(a.Id, b.Id) })
+	return out
+}
+
+// Visible tells which challenges team may see given its solves,
+// e.g. for catalog.Catalog.Visible
+func (s *Service) Visible(team string) func(id string) bool {
+	solvedIds := s.solved(team)
+	g, err := s.unlocks()
+	if err != nil {
+		log.Error().WithMeta("scope", "submissions").Msgf("invalid unlock graph: %v", err).Send()
+		return func(string) bool { return false }
+	}
+	return func(id string) bool { return g.Unlocked(id, solvedIds) }
+}
+
+// Handler serves submissions under /challenges/{id}/submit
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /challenges/{id}/submit", func(w http.ResponseWriter, r *http.Request) {
+		team, err := s.team(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Flag string `json:"flag"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 2*MAX_FLAG_LEN)).Decode(&body); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := s.Submit(team, r.PathValue("id"), body.Flag)
+		switch {
+		case errors.Is(err, ErrEmptyFlag), errors.Is(err, ErrFlagTooLong):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, instances.ErrNotFound):
+			// per-instance flags are checked against the running instance
+			http.Error(w, "start an instance of the challenge first", http.StatusConflict)
+			return
+		case err != nil:
+			log.Error().WithMeta("scope", "submissions").WithMeta("team", team).Msgf("submission failed: %v", err).Send()
+			http.Error(w, "submission failed, try again", http.StatusInternalServerError)
+			return
+		}
+		// locked challenges are not known to exist
+		if result.Status == StatusLocked {
+			result.Status = StatusUnknown
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	})
+	return mux
+}
+
+func (s *Service) team(r *http.Request) (string, error) {
+	if s.Team == nil {
+		return "", ErrUnauthenticated
+	}
+	team, err := s.Team(r)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	if strings.TrimSpace(team) == "" {
+		return "", ErrUnauthenticated
+	}
+	return team, nil
+}
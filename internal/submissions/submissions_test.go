@@ -0,0 +1,255 @@
+package submissions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/instances"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChecker accepts ctfjx{<challenge>} and, for dynamic,
+// ctfjx{<team>}
+type fakeChecker struct {
+	mu     sync.Mutex
+	checks int
+	slow   chan struct{} // checks of slow wait for it
+}
+
+func (f *fakeChecker) CheckFlag(challengeId, team, submitted string) (bool, error) {
+	if challengeId == "slow" {
+		<-f.slow
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks++
+	switch challengeId {
+	case "broken":
+		return false, errors.New("boom")
+	case "race":
+		return false, fmt.Errorf("%w: race-%s", instances.ErrNotFound, team)
+	case "dynamic":
+		return submitted == "ctfjx{"+team+"}", nil
+	}
+	return submitted == "ctfjx{"+challengeId+"}", nil
+}
+
+func newTestService(t *testing.T, path string, window Window) (*Service, *fakeChecker, *time.Time) {
+	challenges, err := challenge.OpenRegistry("")
+	require.NoError(t, err)
+	put := func(id string, unlock *challenge.Unlock) {
+		require.NoError(t, challenges.Put(challenge.Build{Id: id, Version: "v1", Challenge: challenge.Challenge{Id: id, Category: "misc", Unlock: unlock}}))
+	}
+	put("intro", nil)
+	put("dynamic", nil)
+	put("broken", nil)
+	put("race", nil)
+	put("final", &challenge.Unlock{After: []string{"intro"}})
+
+	checker := &fakeChecker{slow: make(chan struct{})}
+	s, err := New(challenges, checker, path, window)
+	require.NoError(t, err)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex // submissions of other teams run concurrently
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(time.Second)
+		return now
+	}
+	return s, checker, &now
+}
+
+func TestSubmit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attempts.jsonl")
+	s, checker, now := newTestService(t, path, Window{})
+	var hooked []Attempt
+	s.OnSolve = func(a Attempt) { hooked = append(hooked, a) }
+
+	submit := func(team, id, flag string) Result {
+		r, err := s.Submit(team, id, flag)
+		require.NoError(t, err)
+		return r
+	}
+
+	assert.Equal(t, StatusUnknown, submit("t1", "nope", "ctfjx{nope}").Status)
+	assert.Equal(t, StatusLocked, submit("t1", "final", "ctfjx{final}").Status)
+	assert.Equal(t, StatusIncorrect, submit("t1", "intro", "ctfjx{wrong}").Status)
+	assert.Equal(t, 1, checker.checks, "locked and unknown challenges are not checked")
+
+	r := submit("t1", "intro", "  ctfjx{intro}\n")
+	assert.Equal(t, StatusCorrect, r.Status)
+	assert.Equal(t, *now, r.SolvedAt)
+	solvedAt := r.SolvedAt
+
+	again := submit("t1", "intro", "ctfjx{intro}")
+	assert.Equal(t, StatusAlreadySolved, again.Status)
+	assert.Equal(t, solvedAt, again.SolvedAt)
+	assert.Equal(t, 2, checker.checks, "solved challenges are not checked again")
+	assert.Equal(t, StatusCorrect, submit("t1", "final", "ctfjx{final}").Status, "solving intro unlocks final")
+
+	assert.Equal(t, StatusIncorrect, submit("t2", "dynamic", "ctfjx{t1}").Status, "a flag of another team")
+	assert.Equal(t, StatusCorrect, submit("t2", "dynamic", "ctfjx{t2}").Status)
+
+	_, err := s.Submit("t1", "broken", "ctfjx{broken}")
+	assert.ErrorContains(t, err, "boom")
+	_, err = s.Submit("t1", "intro", " ")
+	assert.ErrorIs(t, err, ErrEmptyFlag)
+	_, err = s.Submit("t1", "intro", strings.Repeat("a", MAX_FLAG_LEN+1))
+	assert.ErrorIs(t, err, ErrFlagTooLong)
+	_, err = s.Submit("", "intro", "ctfjx{intro}")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	var statuses []Status
+	for _, a := range s.Attempts("t1") {
+		statuses = append(statuses, a.Status)
+	}
+	assert.Equal(t, []Status{StatusUnknown, StatusLocked, StatusIncorrect, StatusCorrect, StatusAlreadySolved, StatusCorrect}, statuses,
+		"every checked submission is recorded in order, failed checks are not")
+	assert.Len(t, s.Solves(""), 3)
+	assert.Equal(t, s.Solves(""), hooked, "only solves reach the hook")
+	assert.Equal(t, "v1", s.Solves("t2")[0].Version)
+
+	visible := s.Visible("t2")
+	assert.True(t, visible("intro"))
+	assert.False(t, visible("final"))
+
+	require.NoError(t, s.Close())
+	reopened, _, _ := newTestService(t, path, Window{})
+	assert.Equal(t, s.Solves(""), reopened.Solves(""), "attempts are persisted")
+	assert.Equal(t, StatusAlreadySolved, must(reopened.Submit("t1", "intro", "ctfjx{intro}")).Status)
+	assert.Len(t, reopened.Attempts(""), 9)
+}
+
+func TestSubmit_Unlocks(t *testing.T) {
+	s, _, _ := newTestService(t, "", Window{})
+	assert.Equal(t, StatusCorrect, must(s.Submit("t1", "intro", "ctfjx{intro}")).Status)
+	assert.False(t, s.Visible("t1")("sequel"))
+
+	require.NoError(t, s.challenges.Put(challenge.Build{Id: "sequel", Version: "v1", Challenge: challenge.Challenge{Id: "sequel", Unlock: &challenge.Unlock{After: []string{"final"}}}}))
+	assert.Equal(t, StatusLocked, must(s.Submit("t1", "sequel", "ctfjx{sequel}")).Status, "the graph follows the challenges")
+	assert.Equal(t, StatusCorrect, must(s.Submit("t1", "final", "ctfjx{final}")).Status)
+	assert.True(t, s.Visible("t1")("sequel"))
+}
+
+func TestSubmit_OthersDoNotWait(t *testing.T) {
+	s, checker, _ := newTestService(t, "", Window{})
+	require.NoError(t, s.challenges.Put(challenge.Build{Id: "slow", Version: "v1", Challenge: challenge.Challenge{Id: "slow"}}))
+
+	done := make(chan Result)
+	go func() { done <- must(s.Submit("t1", "slow", "ctfjx{slow}")) }()
+	assert.Eventually(t, func() bool {
+		return must(s.Submit("t2", "intro", "ctfjx{intro}")).Status == StatusCorrect
+	}, time.Second, 10*time.Millisecond, "a slow check holds up its team and challenge only")
+	assert.Equal(t, StatusCorrect, must(s.Submit("t1", "intro", "ctfjx{intro}")).Status)
+
+	close(checker.slow)
+	assert.Equal(t, StatusCorrect, (<-done).Status)
+}
+
+func TestWindow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 10, 0, time.UTC)
+	s, checker, now := newTestService(t, "", Window{Start: start, End: start.Add(10 * time.Second)})
+
+	assert.Equal(t, StatusNotStarted, must(s.Submit("t1", "intro", "ctfjx{intro}")).Status)
+	*now = start.Add(-time.Second)
+	assert.Equal(t, StatusCorrect, must(s.Submit("t1", "intro", "ctfjx{intro}")).Status, "the start is inclusive")
+	*now = start.Add(9 * time.Second)
+	assert.Equal(t, StatusEnded, must(s.Submit("t1", "final", "ctfjx{final}")).Status, "the end is exclusive")
+	assert.Equal(t, 1, checker.checks)
+}
+
+func must(r Result, err error) Result {
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestSubmitConcurrently(t *testing.T) {
+	s, _, _ := newTestService(t, "", Window{})
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		correct int
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := s.Submit("t1", "intro", "ctfjx{intro}")
+			assert.NoError(t, err)
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Status == StatusCorrect {
+				correct++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, correct, "a challenge is solved once")
+	assert.Len(t, s.Attempts("t1"), 20)
+}
+
+func TestHandler(t *testing.T) {
+	s, _, _ := newTestService(t, "", Window{})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	post := func(team, id, body string) (*http.Response, Result) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/challenges/"+id+"/submit", strings.NewReader(body))
+		require.NoError(t, err)
+		if team != "" {
+			req.Header.Set("X-Team", team)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var r Result
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&r))
+		}
+		return resp, r
+	}
+
+	resp, _ := post("t1", "intro", `{"flag": "ctfjx{intro}"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "no authentication configured")
+
+	s.Team = func(r *http.Request) (string, error) {
+		if team := r.Header.Get("X-Team"); team != "" {
+			return team, nil
+		}
+		return "", errors.New("no session")
+	}
+	resp, _ = post("", "intro", `{"flag": "ctfjx{intro}"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, r := post("t1", "final", `{"flag": "ctfjx{final}"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, StatusUnknown, r.Status, "locked challenges are not revealed")
+
+	resp, r = post("t1", "intro", `{"flag": "ctfjx{intro}"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, StatusCorrect, r.Status)
+	assert.Equal(t, "intro", r.Challenge)
+	assert.NotEmpty(t, r.Attempt)
+
+	resp, _ = post("t1", "intro", `{"flag": ""}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = post("t1", "intro", `nope`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = post("t1", "race", `{"flag": "ctfjx{race}"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = post("t1", "broken", `{"flag": "ctfjx{broken}"}`)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
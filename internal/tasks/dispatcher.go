@@ -0,0 +1,204 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+)
+
+// Dispatcher signs tasks, sends them to agents and
+// collects their output and results on the daemon
+type Dispatcher struct {
+	key   ed25519.PrivateKey
+	idGen uint64
+
+	mu      sync.Mutex
+	pending map[string]*Pending
+}
+
+func NewDispatcher(key ed25519.PrivateKey) *Dispatcher {
+	return &Dispatcher{
+		key:     key,
+		pending: make(map[string]*Pending),
+	}
+}
+
+// Pending is a dispatched task that has not finished yet
+type Pending struct {
+	conn           *socket.Conn // the task was sent to, the only one it is heard from
+	stdout, stderr io.Writer
+
+	mu      sync.Mutex
+	next    int
+	early   map[int]Output // chunks that arrived before their predecessors
+	result  *Result
+	done    chan struct{}
+	onClose func()
+}
+
+// Dispatch signs t and sends it over c. Its output is written to
+// stdout and stderr in order, either of which may be nil.
+func (d *Dispatcher) Dispatch(c *socket.Conn, t Task, stdout, stderr io.Writer) (*Pending, error) {
+	if t.Id == "" {
+		t.Id = fmt.Sprintf("task-%d-%d", time.Now().UnixNano(), atomic.AddUint64(&d.idGen, 1))
+	}
+	if err := t.Sign(d.key); err != nil {
+		return nil, err
+	}
+
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	p := &Pending{
+		conn:   c,
+		stdout: stdout,
+		stderr: stderr,
+		early:  make(map[int]Output),
+		done:   make(chan struct{}),
+	}
+	p.onClose = func() {
+		d.mu.Lock()
+		delete(d.pending, t.Id)
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	d.pending[t.Id] = p
+	d.mu.Unlock()
+
+	if err := c.SendJSON(socket.ActionRunTask, t); err != nil {
+		p.onClose()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run dispatches t over c and waits for it, returning its stdout.
+// A task that does not exit with 0 returns ErrTaskFailed.
+func (d *Dispatcher) Run(ctx context.Context, c *socket.Conn, t Task) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	p, err := d.Dispatch(c, t, &stdout, &stderr)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		msg := res.Error
+		if msg == "" {
+			msg = strings.TrimSpace(stderr.String())
+		}
+		return stdout.Bytes(), fmt.Errorf("%w: %s exited with %d: %s", ErrTaskFailed, t.Verb, res.ExitCode, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Wait blocks until the task's result and all of its output
+// have arrived, or ctx is done
+func (p *Pending) Wait(ctx context.Context) (Result, error) {
+	select {
+	case <-p.done:
+		return *p.result, nil
+	case <-ctx.Done():
+		p.onClose()
+		return Result{}, ctx.Err()
+	}
+}
+
+func (p *Pending) output(o Output) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.early[o.Seq] = o
+	for {
+		next, ok := p.early[p.next]
+		if !ok {
+			break
+		}
+		delete(p.early, p.next)
+		p.next++
+
+		w := p.stdout
+		if next.Stream == "stderr" {
+			w = p.stderr
+		}
+		_, _ = w.Write(next.Data)
+	}
+	p.finish()
+}
+
+func (p *Pending) setResult(r Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.result = &r
+	p.finish()
+}
+
+// Ensure that the caller holds the lock
+func (p *Pending) finish() {
+	if p.result == nil || p.next < p.result.Outputs {
+		return
+	}
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+		p.onClose()
+	}
+}
+
+// lookup returns the pending task id, if it was sent over c.
+// Task ids are predictable, so messages from any other agent
+// about it are refused.
+func (d *Dispatcher) lookup(c *socket.Conn, id string) (*Pending, bool) {
+	d.mu.Lock()
+	p, ok := d.pending[id]
+	d.mu.Unlock()
+
+	if ok && p.conn != c {
+		c.GenLogMsg().Warn().Msgf("refused message about task %q sent to another agent", id).Send()
+		return nil, false
+	}
+	return p, ok
+}
+
+// Handlers routes ActionTaskOutput and ActionTaskResult
+// to the pending tasks
+func (d *Dispatcher) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionTaskOutput: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var o Output
+			if err := json.NewDecoder(r).Decode(&o); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid task output: %v", err).Send()
+				return
+			}
+			if p, ok := d.lookup(c, o.TaskId); ok {
+				p.output(o)
+			}
+		},
+		socket.ActionTaskResult: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var res Result
+			if err := json.NewDecoder(r).Decode(&res); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid task result: %v", err).Send()
+				return
+			}
+			if p, ok := d.lookup(c, res.TaskId); ok {
+				p.setResult(res)
+			}
+		},
+	}
+}
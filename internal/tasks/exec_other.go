@@ -0,0 +1,7 @@
+//go:build !unix
+
+package tasks
+
+import "os/exec"
+
+func prepareCommand(cmd *exec.Cmd) {}
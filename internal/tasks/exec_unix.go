@@ -0,0 +1,17 @@
+//go:build unix
+
+package tasks
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// prepareCommand runs the command in its own process group,
+// so a timeout kills everything it spawned
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
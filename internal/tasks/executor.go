@@ -0,0 +1,252 @@
+package tasks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/helpers/nopanic"
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/log"
+)
+
+// VerbFunc runs a predefined verb, writing its output to stdout and stderr
+type VerbFunc func(ctx context.Context, args []string, stdout, stderr io.Writer) error
+
+// Executor runs signed tasks on the agent
+type Executor struct {
+	key    ed25519.PublicKey
+	maxAge time.Duration
+
+	Env    []string // names of the variables commands inherit from the agent
+	Cgroup string   // cgroup v2 directory the agent may create task cgroups in, for Limits.Procs
+
+	mu    sync.Mutex
+	verbs map[string]VerbFunc
+	seen  map[string]time.Time // task id -> issued at, to reject replays
+}
+
+// NewExecutor accepts tasks signed by key. Only registered verbs
+// run, and VERB_EXEC only once it is enabled with AllowExec.
+func NewExecutor(key ed25519.PublicKey) *Executor {
+	return &Executor{
+		key:    key,
+		maxAge: DEFAULT_TASK_MAX_AGE,
+		Env:    DEFAULT_TASK_ENV,
+		verbs:  make(map[string]VerbFunc),
+		seen:   make(map[string]time.Time),
+	}
+}
+
+func (e *Executor) RegisterVerb(name string, fn VerbFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.verbs[name] = fn
+}
+
+// AllowExec lets tasks run arbitrary commands with VERB_EXEC
+func (e *Executor) AllowExec() {
+	e.RegisterVerb(VERB_EXEC, nil)
+}
+
+// Run verifies and runs t, writing its output to stdout and stderr
+func (e *Executor) Run(ctx context.Context, t Task, stdout, stderr io.Writer) Result {
+	start := time.Now()
+	res := Result{TaskId: t.Id, ExitCode: -1}
+
+	fn, err := e.accept(t)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	timeout := t.Limits.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_TASK_TIMEOUT
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	maxOutput := t.Limits.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = DEFAULT_MAX_OUTPUT
+	}
+	stdout = &limitWriter{w: stdout, n: maxOutput}
+	stderr = &limitWriter{w: stderr, n: maxOutput}
+
+	if t.Verb == VERB_EXEC {
+		res.ExitCode, err = e.runCommand(ctx, t, stdout, stderr)
+	} else {
+		err = nopanic.NoPanicRunErr("task "+t.Verb, func() error {
+			return fn(ctx, t.Args, stdout, stderr)
+		})
+		if err == nil {
+			res.ExitCode = 0
+		}
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	res.Duration = time.Since(start)
+	return res
+}
+
+func (e *Executor) accept(t Task) (VerbFunc, error) {
+	if err := t.Verify(e.key, e.maxAge); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fn, ok := e.verbs[t.Verb]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownVerb, t.Verb)
+	}
+
+	now := time.Now()
+	for id, issued := range e.seen {
+		if now.Sub(issued) > 2*e.maxAge {
+			delete(e.seen, id)
+		}
+	}
+	if _, ok := e.seen[t.Id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrTaskReplayed, t.Id)
+	}
+	e.seen[t.Id] = t.IssuedAt
+	return fn, nil
+}
+
+// runCommand runs the command of t under its limits, failing if they
+// cannot be applied before it executes
+func (e *Executor) runCommand(ctx context.Context, t Task, stdout, stderr io.Writer) (int, error) {
+	if len(t.Args) == 0 {
+		return -1, errors.New("exec needs a command")
+	}
+
+	cmd := exec.CommandContext(ctx, t.Args[0], t.Args[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = []string{}
+	for _, k := range e.Env {
+		if v, ok := os.LookupEnv(k); ok {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	for k, v := range t.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	prepareCommand(cmd)
+
+	lim, err := limit(cmd, t.Limits, e.Cgroup, t.Id)
+	if err != nil {
+		return -1, fmt.Errorf("failed to apply limits: %w", err)
+	}
+	defer lim.release()
+
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+	if err := lim.started(); err != nil {
+		_ = cmd.Wait()
+		return -1, fmt.Errorf("failed to apply limits: %w", err)
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return -1, fmt.Errorf("task killed: %w", ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// Handlers runs tasks received with ActionRunTask, streaming
+// their output back and finishing with ActionTaskResult
+func (e *Executor) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionRunTask: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var t Task
+			if err := json.NewDecoder(r).Decode(&t); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid task: %v", err).Send()
+				return
+			}
+
+			log.Info().
+				WithMeta("scope", "tasks").
+				WithMeta("task", t.Id).
+				Msgf("running task %s", t.Verb).Send()
+
+			seq := &outputSeq{}
+			res := e.Run(context.Background(), t,
+				&streamWriter{c: c, taskId: t.Id, stream: "stdout", seq: seq},
+				&streamWriter{c: c, taskId: t.Id, stream: "stderr", seq: seq},
+			)
+			res.Outputs = seq.n
+			if err := c.SendJSON(socket.ActionTaskResult, res); err != nil {
+				c.GenLogMsg().Error().Msgf("failed to send task result: %v", err).Send()
+			}
+		},
+	}
+}
+
+// outputSeq numbers the chunks of both streams of a task
+type outputSeq struct {
+	mu sync.Mutex
+	n  int
+}
+
+// streamWriter sends every write as an ActionTaskOutput message
+type streamWriter struct {
+	c      *socket.Conn
+	taskId string
+	stream string
+	seq    *outputSeq
+}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	w.seq.mu.Lock()
+	defer w.seq.mu.Unlock()
+
+	out := Output{TaskId: w.taskId, Seq: w.seq.n, Stream: w.stream, Data: b}
+	if err := w.c.SendJSON(socket.ActionTaskOutput, out); err != nil {
+		return 0, err
+	}
+	w.seq.n++
+	return len(b), nil
+}
+
+// limitWriter drops everything after n bytes, without failing
+// the writer, so a chatty command is not killed by EPIPE
+type limitWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitWriter) Write(b []byte) (int, error) {
+	total := len(b)
+	if l.n <= 0 {
+		return total, nil
+	}
+	if len(b) > l.n {
+		b = b[:l.n]
+	}
+	n, err := l.w.Write(b)
+	l.n -= n
+	if err != nil {
+		return n, err
+	}
+	return total, nil
+}
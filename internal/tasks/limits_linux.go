@@ -0,0 +1,185 @@
+//go:build linux
+
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The agent re-executes itself with this set to "cpu,memory,path", to
+// set the rlimits of a task before exec'ing the task's command at path
+const LIMITS_ENV = "CTFJX_TASK_RLIMITS"
+
+// File descriptor the stub reports failures on, the write end of the
+// pipe in cmd.ExtraFiles. It is closed on exec, so the agent reads
+// nothing once the command runs.
+const limitsReportFd = 3
+
+var cgroupNameRe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+func init() {
+	if spec, ok := os.LookupEnv(LIMITS_ENV); ok {
+		execLimited(spec)
+	}
+}
+
+// execLimited is the stub: it sets the rlimits in spec and execs the
+// task's command, never returning
+func execLimited(spec string) {
+	fail := func(err error) {
+		report := os.NewFile(limitsReportFd, "limits")
+		_, _ = io.WriteString(report, err.Error())
+		os.Exit(127)
+	}
+
+	parts := strings.SplitN(spec, ",", 3)
+	if len(parts) != 3 {
+		fail(fmt.Errorf("invalid %s %q", LIMITS_ENV, spec))
+	}
+	var values [2]uint64
+	for i, p := range parts[:2] {
+		v, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			fail(fmt.Errorf("invalid %s %q", LIMITS_ENV, spec))
+		}
+		values[i] = v
+	}
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, LIMITS_ENV+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	for i, resource := range []int{unix.RLIMIT_CPU, unix.RLIMIT_AS} {
+		if values[i] == 0 {
+			continue
+		}
+		lim := unix.Rlimit{Cur: values[i], Max: values[i]}
+		if err := unix.Setrlimit(resource, &lim); err != nil {
+			fail(fmt.Errorf("setrlimit: %w", err))
+		}
+	}
+	unix.CloseOnExec(limitsReportFd)
+	fail(fmt.Errorf("exec %s: %w", parts[2], unix.Exec(parts[2], os.Args, env)))
+}
+
+// limiter applies the limits of a task to its command
+type limiter struct {
+	report *os.File // read end of the stub's report pipe, if any
+	w      *os.File // its write end, for the stub
+	cgroup string   // created for the task, if any
+	dirFd  *os.File
+}
+
+// limit makes cmd run under l: rlimits are set by the agent
+// re-executed as a stub before it execs the command, and Procs puts
+// the command in its own cgroup below cgroupRoot, as RLIMIT_NPROC
+// counts every process of the user and not those of the task
+func limit(cmd *exec.Cmd, l Limits, cgroupRoot, taskId string) (*limiter, error) {
+	lim := &limiter{}
+	if cmd.Err != nil {
+		return lim, nil // Start fails anyway
+	}
+
+	if l.Procs != 0 {
+		if cgroupRoot == "" {
+			return nil, errors.New("procs limits need a cgroup, see Executor.Cgroup")
+		}
+		if err := lim.joinCgroup(cmd, l.Procs, cgroupRoot, taskId); err != nil {
+			lim.release()
+			return nil, err
+		}
+	}
+
+	if l.CPUTime == 0 && l.Memory == 0 {
+		return lim, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		lim.release()
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		lim.release()
+		return nil, err
+	}
+	// rlimits only take whole seconds, round up not to lift small limits
+	cpu := uint64(math.Ceil(l.CPUTime.Seconds()))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d,%d,%s", LIMITS_ENV, cpu, l.Memory, cmd.Path))
+	cmd.Path = self
+	cmd.ExtraFiles = []*os.File{w} // limitsReportFd
+	lim.report, lim.w = r, w
+	return lim, nil
+}
+
+// joinCgroup creates the cgroup of the task and starts cmd in it
+func (lim *limiter) joinCgroup(cmd *exec.Cmd, procs uint64, root, taskId string) error {
+	name := "task-" + cgroupNameRe.ReplaceAllString(taskId, "_")
+	lim.cgroup = filepath.Join(root, name)
+	if err := os.Mkdir(lim.cgroup, 0o755); err != nil {
+		lim.cgroup = ""
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(lim.cgroup, "pids.max"), []byte(strconv.FormatUint(procs, 10)), 0o644); err != nil {
+		return err
+	}
+	dir, err := os.Open(lim.cgroup)
+	if err != nil {
+		return err
+	}
+	lim.dirFd = dir
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return nil
+}
+
+// started returns the failure the stub reported, if any, once cmd
+// started. The command runs under its limits if it returns nil.
+func (lim *limiter) started() error {
+	if lim.report == nil {
+		return nil
+	}
+	lim.w.Close() // or reading never ends
+	lim.w = nil
+	msg, err := io.ReadAll(lim.report)
+	lim.report.Close()
+	lim.report = nil
+	switch {
+	case err != nil:
+		return err
+	case len(msg) > 0:
+		return errors.New(string(msg))
+	}
+	return nil
+}
+
+// release frees what limit set up, once the command exited
+func (lim *limiter) release() {
+	if lim.report != nil {
+		lim.report.Close()
+		lim.w.Close()
+	}
+	if lim.dirFd != nil {
+		lim.dirFd.Close()
+	}
+	if lim.cgroup != "" {
+		_ = os.Remove(lim.cgroup)
+	}
+}
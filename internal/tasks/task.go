@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	VERB_EXEC = "exec" // run Task.Args as a command
+
+	// Tasks issued longer ago than this are rejected as replays
+	DEFAULT_TASK_MAX_AGE = time.Minute
+	DEFAULT_TASK_TIMEOUT = 5 * time.Minute
+	DEFAULT_MAX_OUTPUT   = 1 << 20 // 1MB per stream
+)
+
+// Variables of the agent that commands inherit, the rest, e.g. its
+// CTFJX_* config and tokens, stays with the agent
+var DEFAULT_TASK_ENV = []string{"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TMPDIR"}
+
+var (
+	ErrInvalidSignature = errors.New("invalid task signature")
+	ErrTaskExpired      = errors.New("task expired")
+	ErrTaskReplayed     = errors.New("task already ran")
+	ErrUnknownVerb      = errors.New("unknown verb")
+	ErrTaskFailed       = errors.New("task failed")
+)
+
+// Limits restricts the resources of a task.
+// Zero values fall back to the defaults or mean unlimited.
+type Limits struct {
+	Timeout   time.Duration `json:"timeout,omitempty"`
+	MaxOutput int           `json:"max_output,omitempty"` // bytes per stream, the rest is dropped
+	CPUTime   time.Duration `json:"cpu_time,omitempty"`   // exec only, Linux only
+	Memory    uint64        `json:"memory,omitempty"`     // address space in bytes, exec only, Linux only
+	Procs     uint64        `json:"procs,omitempty"`      // exec only, Linux only, needs Executor.Cgroup
+}
+
+// Task is a command the daemon asks an agent to run, e.g.
+//
+//	Task{Verb: "restart-challenge", Args: []string{"web1"}}
+//	Task{Verb: VERB_EXEC, Args: []string{"df", "-h"}}
+type Task struct {
+	Id       string            `json:"id"`
+	Verb     string            `json:"verb"`
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"` // exec only
+	Limits   Limits            `json:"limits"`
+	IssuedAt time.Time         `json:"issued_at"`
+
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Output is a chunk of a task's stdout or stderr. Handlers run
+// concurrently, so chunks are numbered to be put back in order.
+type Output struct {
+	TaskId string `json:"task_id"`
+	Seq    int    `json:"seq"`
+	Stream string `json:"stream"` // "stdout" or "stderr"
+	Data   []byte `json:"data"`
+}
+
+// Result is the outcome of a task. ExitCode is -1 if
+// the task could not be run or was killed.
+type Result struct {
+	TaskId   string        `json:"task_id"`
+	ExitCode int           `json:"exit_code"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Outputs  int           `json:"outputs"` // how many Output chunks were sent
+}
+
+func (t *Task) payload() ([]byte, error) {
+	unsigned := *t
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// Sign sets the task's IssuedAt and signs it with key
+func (t *Task) Sign(key ed25519.PrivateKey) error {
+	t.IssuedAt = time.Now().UTC()
+	b, err := t.payload()
+	if err != nil {
+		return err
+	}
+	t.Signature = ed25519.Sign(key, b)
+	return nil
+}
+
+// Verify checks the task's signature against key and that
+// it was issued within maxAge
+func (t *Task) Verify(key ed25519.PublicKey, maxAge time.Duration) error {
+	b, err := t.payload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, b, t.Signature) {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(t.IssuedAt); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: issued %s ago", ErrTaskExpired, age.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/ctfjx/internal/socket/sockettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutor_Verify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	e := NewExecutor(pub)
+	e.RegisterVerb("restart-challenge", func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+		_, err := io.WriteString(stdout, "restarted "+strings.Join(args, ","))
+		return err
+	})
+
+	task := Task{Id: "1", Verb: "restart-challenge", Args: []string{"web1"}}
+	require.NoError(t, task.Sign(priv))
+
+	var out bytes.Buffer
+	res := e.Run(context.Background(), task, &out, io.Discard)
+	assert.Equal(t, 0, res.ExitCode, res.Error)
+	assert.Equal(t, "restarted web1", out.String())
+
+	res = e.Run(context.Background(), task, io.Discard, io.Discard)
+	assert.Contains(t, res.Error, ErrTaskReplayed.Error())
+
+	tampered := task
+	tampered.Id = "2"
+	res = e.Run(context.Background(), tampered, io.Discard, io.Discard)
+	assert.Equal(t, ErrInvalidSignature.Error(), res.Error)
+
+	exec := Task{Id: "3", Verb: VERB_EXEC, Args: []string{"true"}}
+	require.NoError(t, exec.Sign(priv))
+	res = e.Run(context.Background(), exec, io.Discard, io.Discard)
+	assert.Contains(t, res.Error, ErrUnknownVerb.Error(), "exec is off by default")
+}
+
+func TestDispatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	e := NewExecutor(pub)
+	e.AllowExec()
+	d := NewDispatcher(priv)
+
+	daemon, _ := sockettest.Pair(t, d.Handlers(), e.Handlers())
+
+	var stdout, stderr bytes.Buffer
+	p, err := d.Dispatch(daemon, Task{
+		Verb: VERB_EXEC,
+		Args: []string{"sh", "-c", "echo one; echo two >&2; echo three; exit 3"},
+	}, &stdout, &stderr)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := p.Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Equal(t, "one\nthree\n", stdout.String())
+	assert.Equal(t, "two\n", stderr.String())
+
+	p, err = d.Dispatch(daemon, Task{
+		Verb:   VERB_EXEC,
+		Args:   []string{"sleep", "10"},
+		Limits: Limits{Timeout: 50 * time.Millisecond},
+	}, nil, nil)
+	require.NoError(t, err)
+	res, err = p.Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Contains(t, res.Error, "killed")
+}
+
+func TestExecutor_Limits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("limits are linux only")
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	e := NewExecutor(pub)
+	e.AllowExec()
+	t.Setenv("CTFJX_AGENT_SECRET", "hunter2")
+
+	run := func(id string, args []string, env map[string]string, l Limits) (Result, string) {
+		task := Task{Id: id, Verb: VERB_EXEC, Args: args, Env: env, Limits: l}
+		require.NoError(t, task.Sign(priv))
+		var out bytes.Buffer
+		res := e.Run(context.Background(), task, &out, io.Discard)
+		return res, out.String()
+	}
+
+	res, out := run("1", []string{"sh", "-c", "ulimit -v; ulimit -t"}, nil,
+		Limits{Memory: 512 << 20, CPUTime: 1500 * time.Millisecond})
+	assert.Equal(t, 0, res.ExitCode, res.Error)
+	assert.Equal(t, "524288\n2\n", out, "limits apply before the command runs")
+
+	res, out = run("2", []string{"sh", "-c", `echo "$CTFJX_AGENT_SECRET,$TASK_VAR,$CTFJX_TASK_RLIMITS"`},
+		map[string]string{"TASK_VAR": "set"}, Limits{Memory: 512 << 20})
+	assert.Equal(t, 0, res.ExitCode, res.Error)
+	assert.Equal(t, ",set,\n", out, "the agent's variables stay with the agent")
+
+	res, _ = run("3", []string{"true"}, nil, Limits{Procs: 10})
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Contains(t, res.Error, "failed to apply limits")
+
+	notExec := t.TempDir() + "/script"
+	require.NoError(t, os.WriteFile(notExec, []byte("#!/bin/sh\n"), 0o644))
+	res, _ = run("4", []string{notExec}, nil, Limits{Memory: 512 << 20})
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Contains(t, res.Error, "failed to apply limits")
+	assert.Contains(t, res.Error, "permission denied", "the stub reports why")
+}
+
+func TestDispatch_OtherAgent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	e := NewExecutor(pub)
+	e.AllowExec()
+	d := NewDispatcher(priv)
+
+	daemon, _ := sockettest.Pair(t, d.Handlers(), e.Handlers())
+	_, rogue := sockettest.Pair(t, d.Handlers(), nil)
+
+	var stdout bytes.Buffer
+	p, err := d.Dispatch(daemon, Task{
+		Id:   "task-1",
+		Verb: VERB_EXEC,
+		Args: []string{"sh", "-c", "sleep 0.2; echo real"},
+	}, &stdout, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, rogue.SendJSON(socket.ActionTaskOutput, Output{TaskId: "task-1", Seq: 0, Stream: "stdout", Data: []byte("forged\n")}))
+	require.NoError(t, rogue.SendJSON(socket.ActionTaskResult, Result{TaskId: "task-1", ExitCode: 7, Outputs: 1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := p.Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, "real\n", stdout.String(), "only the agent the task was sent to is heard")
+}
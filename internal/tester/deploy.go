@@ -0,0 +1,149 @@
+package tester
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+
+	"github.com/lattesec/ctfjx/internal/build"
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/container"
+	"github.com/lattesec/ctfjx/internal/flags"
+	"github.com/lattesec/ctfjx/internal/instances"
+)
+
+func checkStatic(challengeId string, spec flags.Spec, submitted string) (bool, error) {
+	checker, err := flags.Compile(challengeId, spec, nil)
+	if err != nil {
+		return false, err
+	}
+	return checker.Check(submitted, "")
+}
+
+// Instances deploys per-team challenges as instances of TEAM,
+// as players get them
+type Instances struct {
+	manager *instances.Manager
+}
+
+var _ Deployer = Instances{}
+
+func NewInstances(m *instances.Manager) Instances {
+	return Instances{manager: m}
+}
+
+func (d Instances) Deploy(ctx context.Context, b challenge.Build) (Target, error) {
+	if !b.Challenge.Deploy.PerTeam {
+		return Target{}, fmt.Errorf("%w: %s is not deployed per team", ErrUnsupported, b.Id)
+	}
+	// a leftover of an interrupted test is not fresh
+	_ = d.manager.Destroy(ctx, b.Id, TEAM)
+	inst, err := d.manager.Request(ctx, b.Id, TEAM)
+	if err != nil {
+		return Target{}, err
+	}
+	t := Target{
+		Ports: make(map[int]int),
+		Check: func(submitted string) (bool, error) {
+			return d.manager.CheckFlag(b.Id, TEAM, submitted)
+		},
+		Close: func(ctx context.Context) error {
+			return d.manager.Destroy(ctx, b.Id, TEAM)
+		},
+	}
+	for _, e := range inst.Endpoints {
+		t.Host = e.Host
+		t.Ports[e.Target] = e.Port
+	}
+	return t, nil
+}
+
+// Local deploys image challenges straight on a runtime, with ports
+// published on the loopback, e.g. in CI
+type Local struct {
+	rt container.Runtime
+	// dynamic flags only need to agree within a test
+	flags *flags.Generator
+}
+
+var _ Deployer = (*Local)(nil)
+
+func NewLocal(rt container.Runtime) (*Local, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	g, err := flags.NewGenerator(hex.EncodeToString(secret))
+	if err != nil {
+		return nil, err
+	}
+	return &Local{rt: rt, flags: g}, nil
+}
+
+func (l *Local) Deploy(ctx context.Context, b challenge.Build) (Target, error) {
+	d := b.Challenge.Deploy
+	if d.Type != challenge.DeployImage {
+		return Target{}, fmt.Errorf("%w: %s deployments are not supported locally", ErrUnsupported, d.Type)
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return Target{}, err
+	}
+	spec := container.Spec{
+		Name:   "ctfjx-test-" + b.Id + "-" + hex.EncodeToString(suffix),
+		Image:  b.Image,
+		Env:    maps.Clone(d.Env),
+		Labels: map[string]string{build.LABEL_CHALLENGE: b.Id},
+		Limits: d.Limits.Container(),
+	}
+	for _, p := range d.Ports {
+		protocol := p.Protocol
+		if protocol == challenge.PROTOCOL_HTTP {
+			protocol = challenge.PROTOCOL_TCP
+		}
+		spec.Ports = append(spec.Ports, container.Port{Container: p.Port, HostIP: "127.0.0.1", Protocol: protocol})
+	}
+
+	flagSpec, err := b.Challenge.FlagSpec()
+	if err != nil {
+		return Target{}, err
+	}
+	checker, err := flags.Compile(b.Id, flagSpec, l.flags)
+	if err != nil {
+		return Target{}, err
+	}
+	if f := b.Challenge.Flag; f.Type == challenge.FlagDynamic {
+		flag, err := checker.Expected(TEAM)
+		if err != nil {
+			return Target{}, err
+		}
+		if spec.Env == nil {
+			spec.Env = make(map[string]string)
+		}
+		spec.Env[f.Env] = flag
+		if f.Path != "" {
+			spec.Files = map[string]string{f.Path: flag + "\n"}
+		}
+	}
+
+	info, err := container.Deploy(ctx, l.rt, spec)
+	if err != nil {
+		return Target{}, err
+	}
+	t := Target{
+		Host:  "127.0.0.1",
+		Ports: make(map[int]int),
+		Check: func(submitted string) (bool, error) {
+			return checker.Check(submitted, TEAM)
+		},
+		Close: func(ctx context.Context) error {
+			return l.rt.Remove(ctx, info.Id)
+		},
+	}
+	for _, p := range info.Ports {
+		t.Ports[p.Container] = p.Host
+	}
+	return t, nil
+}
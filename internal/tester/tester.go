@@ -0,0 +1,275 @@
+// Tester package runs the solve scripts of challenges against fresh
+// instances, so broken challenges are caught before players hit them:
+// in CI before the event, with a Local deployer, and periodically
+// during it through the instance manager.
+//
+// A solve script runs from the bundle's directory with the instance
+// in CTFJX_HOST and CTFJX_PORT, and passes if it exits with 0 and
+// prints a flag the challenge accepts.
+package tester
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/log"
+)
+
+const (
+	// Team the instances of tests are requested for
+	TEAM = "ctfjx-tester"
+
+	DEFAULT_INTERVAL = 30 * time.Minute
+
+	// Bytes of output kept in results
+	OUTPUT_LIMIT = 2048
+
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip" // no solve script, or nothing to deploy it on
+)
+
+var (
+	ErrUnsupported = errors.New("challenge cannot be deployed for tests")
+	ErrNoFlag      = errors.New("solve printed no correct flag")
+	ErrNotReady    = errors.New("instance never accepted connections")
+)
+
+// Target is a fresh instance of a challenge
+type Target struct {
+	Host  string
+	Ports map[int]int // container port -> published port
+	// Check tells if a flag is correct for this instance
+	Check func(submitted string) (bool, error)
+	Close func(ctx context.Context) error
+}
+
+// Deployer deploys fresh instances for tests
+type Deployer interface {
+	// Deploy returns ErrUnsupported for challenges it cannot run
+	Deploy(ctx context.Context, b challenge.Build) (Target, error)
+}
+
+// Result is the outcome of a test
+type Result struct {
+	Challenge string        `json:"challenge"`
+	Version   string        `json:"version"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Output    string        `json:"output,omitempty"` // the end of it
+	Duration  time.Duration `json:"duration"`
+	At        time.Time     `json:"at"`
+}
+
+func (r Result) String() string {
+	s := fmt.Sprintf("%s %s (%s)", r.Status, r.Challenge, r.Duration.Round(time.Millisecond))
+	if r.Error != "" {
+		s += ": " + r.Error
+	}
+	return s
+}
+
+// Tester runs solve scripts and keeps the latest result of each
+// challenge
+type Tester struct {
+	deployer Deployer
+
+	mu      sync.Mutex
+	results map[string]Result
+
+	// Swapped out in tests
+	now func() time.Time
+}
+
+func New(d Deployer) *Tester {
+	return &Tester{deployer: d, results: make(map[string]Result), now: time.Now}
+}
+
+// Test deploys b, runs its solve script and tears the instance down
+func (t *Tester) Test(ctx context.Context, b challenge.Build) Result {
+	start := t.now()
+	r := Result{Challenge: b.Id, Version: b.Version, At: start}
+	output, err := t.test(ctx, b)
+	r.Duration = t.now().Sub(start)
+	if len(output) > OUTPUT_LIMIT {
+		output = output[len(output)-OUTPUT_LIMIT:]
+	}
+	r.Output = string(output)
+	switch {
+	case b.Challenge.Solve == nil:
+		r.Status, r.Error = StatusSkip, "no solve script"
+	case errors.Is(err, ErrUnsupported):
+		r.Status, r.Error = StatusSkip, err.Error()
+	case err != nil:
+		r.Status, r.Error = StatusFail, err.Error()
+	default:
+		r.Status = StatusPass
+	}
+
+	t.mu.Lock()
+	t.results[b.Id] = r
+	t.mu.Unlock()
+	return r
+}
+
+func (t *Tester) test(ctx context.Context, b challenge.Build) ([]byte, error) {
+	s := b.Challenge.Solve
+	if s == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.Timeout))
+	defer cancel()
+
+	target := Target{Check: func(submitted string) (bool, error) {
+		spec, err := b.Challenge.FlagSpec()
+		if err != nil {
+			return false, err
+		}
+		return checkStatic(b.Id, spec, submitted)
+	}}
+	if b.Challenge.Deploy != nil {
+		var err error
+		if target, err = t.deployer.Deploy(ctx, b); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := target.Close(context.WithoutCancel(ctx)); err != nil {
+				log.Warn().WithMeta("scope", "tester").WithMeta("challenge", b.Id).
+					Msgf("failed to remove the test instance: %v", err).Send()
+			}
+		}()
+	}
+
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Dir = b.Source
+	cmd.Env = append(os.Environ(), "CTFJX_CHALLENGE="+b.Id)
+	if port, ok := target.Ports[s.Port]; ok {
+		addr := net.JoinHostPort(target.Host, strconv.Itoa(port))
+		if err := waitReady(ctx, addr); err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, "CTFJX_HOST="+target.Host, "CTFJX_PORT="+strconv.Itoa(port))
+	}
+	var stdout, output bytes.Buffer
+	combined := &syncWriter{w: &output}
+	cmd.Stdout = io.MultiWriter(&stdout, combined)
+	cmd.Stderr = combined
+	if err := cmd.Run(); err != nil {
+		return output.Bytes(), fmt.Errorf("solve: %w", err)
+	}
+
+	for _, candidate := range candidates(stdout.String()) {
+		ok, err := target.Check(candidate)
+		if err != nil {
+			return output.Bytes(), err
+		}
+		if ok {
+			return output.Bytes(), nil
+		}
+	}
+	return output.Bytes(), ErrNoFlag
+}
+
+// syncWriter lets stdout and stderr be copied into the same buffer
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// candidates returns what in the output of a solve may be the
+// flag: every line, and every word of them
+func candidates(stdout string) []string {
+	var out []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		out = append(out, line)
+		if fields := strings.Fields(line); len(fields) > 1 {
+			out = append(out, fields...)
+		}
+	}
+	return out
+}
+
+// waitReady waits until addr accepts connections
+func waitReady(ctx context.Context, addr string) error {
+	var d net.Dialer
+	for {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s: %v", ErrNotReady, addr, err)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// TestAll tests builds one after the other
+func (t *Tester) TestAll(ctx context.Context, builds []challenge.Build) []Result {
+	out := make([]Result, 0, len(builds))
+	for _, b := range builds {
+		out = append(out, t.Test(ctx, b))
+	}
+	return out
+}
+
+// Results returns the latest result of every tested challenge
+func (t *Tester) Results() []Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Result, 0, len(t.results))
+	for _, r := range t.results {
+		out = append(out, r)
+	}
+	slices.SortFunc(out, func(a, b Result) int { return strings.Compare(a.Challenge, b.Challenge) })
+	return out
+}
+
+// Run tests the challenges of reg every interval until ctx is done,
+// logging failures
+func (t *Tester) Run(ctx context.Context, reg *challenge.Registry, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		for _, b := range reg.List() {
+			if ctx.Err() != nil {
+				return
+			}
+			if b.Challenge.Solve == nil {
+				continue
+			}
+			r := t.Test(ctx, b)
+			if r.Status == StatusFail {
+				log.Error().WithMeta("scope", "tester").WithMeta("challenge", b.Id).
+					Msgf("solve check failed: %s", r.Error).Send()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/challenge"
+	"github.com/lattesec/ctfjx/internal/env"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeployer serves every challenge on a local listener, whose
+// flag is ctfjx{<published port>}
+type fakeDeployer struct {
+	t      *testing.T
+	closed []string
+}
+
+func (f *fakeDeployer) Deploy(_ context.Context, b challenge.Build) (Target, error) {
+	if !b.Challenge.Deploy.PerTeam {
+		return Target{}, ErrUnsupported
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(f.t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	return Target{
+		Host:  "127.0.0.1",
+		Ports: map[int]int{1337: port},
+		Check: func(submitted string) (bool, error) {
+			return submitted == fmt.Sprintf("ctfjx{%d}", port), nil
+		},
+		Close: func(context.Context) error {
+			f.closed = append(f.closed, b.Id)
+			return l.Close()
+		},
+	}, nil
+}
+
+func TestTester(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	build := func(id, script string, perTeam bool) challenge.Build {
+		c := challenge.Challenge{
+			Id:     id,
+			Flag:   challenge.Flag{Type: challenge.FlagStatic, Value: "ctfjx{crypto}"},
+			Deploy: &challenge.Deploy{PerTeam: perTeam, Ports: []challenge.Port{{Port: 1337}}},
+		}
+		if script != "" {
+			c.Solve = &challenge.Solve{Command: []string{"sh", "-c", script}, Port: 1337, Timeout: env.Duration(10 * time.Second)}
+		}
+		return challenge.Build{Id: id, Version: "v1", Source: t.TempDir(), Challenge: c}
+	}
+
+	f := &fakeDeployer{t: t}
+	tt := New(f)
+	ctx := context.Background()
+
+	r := tt.Test(ctx, build("pwn", `echo "[+] flag: ctfjx{$CTFJX_PORT}"`, true))
+	assert.Equal(t, StatusPass, r.Status, r.Error)
+	assert.Contains(t, r.Output, "[+] flag")
+	assert.Equal(t, []string{"pwn"}, f.closed, "instances are torn down")
+
+	r = tt.Test(ctx, build("pwn", `echo ctfjx{0}; echo oops >&2`, true))
+	assert.Equal(t, StatusFail, r.Status)
+	assert.Equal(t, ErrNoFlag.Error(), r.Error)
+	assert.Contains(t, r.Output, "oops")
+
+	r = tt.Test(ctx, build("web", `echo ctfjx{$CTFJX_PORT}; exit 1`, true))
+	assert.Equal(t, StatusFail, r.Status)
+	assert.Contains(t, r.Error, "exit status 1")
+
+	assert.Equal(t, StatusSkip, tt.Test(ctx, build("notes", "", true)).Status)
+	assert.Equal(t, StatusSkip, tt.Test(ctx, build("shared", `true`, false)).Status)
+
+	offline := build("crypto", `echo ctfjx{crypto}`, false)
+	offline.Challenge.Deploy = nil
+	assert.Equal(t, StatusPass, tt.Test(ctx, offline).Status, "challenges without a service are solved offline")
+
+	var ids []string
+	for _, r := range tt.Results() {
+		ids = append(ids, r.Challenge+":"+r.Status)
+	}
+	assert.Equal(t, []string{"crypto:pass", "notes:skip", "pwn:fail", "shared:skip", "web:fail"}, ids)
+}
+
+func TestCandidates(t *testing.T) {
+	assert.Equal(t, []string{"ctfjx{a b}", "ctfjx{a", "b}", "done"}, candidates("  ctfjx{a b}\n\ndone\n"))
+}
@@ -0,0 +1,105 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/socket"
+)
+
+// Publisher signs agent releases on the daemon and rolls them out
+type Publisher struct {
+	key    ed25519.PrivateKey
+	store  *artifacts.Store
+	pusher *artifacts.Pusher
+
+	mu      sync.Mutex
+	waiters map[*socket.Conn]chan Result
+}
+
+func NewPublisher(key ed25519.PrivateKey, store *artifacts.Store, pusher *artifacts.Pusher) *Publisher {
+	return &Publisher{
+		key:     key,
+		store:   store,
+		pusher:  pusher,
+		waiters: make(map[*socket.Conn]chan Result),
+	}
+}
+
+// Release stores the binary read from r and returns it as
+// a signed release of version for goos/goarch
+func (p *Publisher) Release(version, goos, goarch string, r io.Reader) (Release, error) {
+	digest, size, err := p.store.Put(r)
+	if err != nil {
+		return Release{}, err
+	}
+	rel := Release{Version: version, OS: goos, Arch: goarch, Digest: digest, Size: size}
+	if err := rel.Sign(p.key); err != nil {
+		return Release{}, err
+	}
+	return rel, nil
+}
+
+// Offer sends rel to the agent on c and waits until it has installed it.
+// The agent restarts afterwards and reports the new version in its Hello.
+func (p *Publisher) Offer(ctx context.Context, c *socket.Conn, rel Release) error {
+	b := artifacts.Bundle{
+		Name:  rel.BundleName(),
+		Files: []artifacts.File{{Path: BINARY_NAME, Digest: rel.Digest, Size: rel.Size, Mode: 0o755}},
+	}
+	if err := p.pusher.Push(ctx, c, b); err != nil {
+		return err
+	}
+
+	ch := make(chan Result, 1)
+	p.mu.Lock()
+	p.waiters[c] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiters, c)
+		p.mu.Unlock()
+	}()
+
+	if err := c.SendJSON(socket.ActionOfferUpdate, rel); err != nil {
+		return err
+	}
+
+	select {
+	case res := <-ch:
+		if res.Error != "" {
+			return fmt.Errorf("%w: %s", ErrUpdateFailed, res.Error)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handlers serves ActionUpdateResult
+func (p *Publisher) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionUpdateResult: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var res Result
+			if err := json.NewDecoder(r).Decode(&res); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid update result: %v", err).Send()
+				return
+			}
+
+			p.mu.Lock()
+			ch, ok := p.waiters[c]
+			p.mu.Unlock()
+			if ok {
+				select {
+				case ch <- res:
+				default:
+				}
+			}
+		},
+	}
+}
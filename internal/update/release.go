@@ -0,0 +1,128 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The name of the agent binary in a release bundle
+const BINARY_NAME = "ctfjx-agent"
+
+var (
+	ErrInvalidSignature = errors.New("invalid release signature")
+	ErrWrongPlatform    = errors.New("release is for another platform")
+	ErrUpdateFailed     = errors.New("agent update failed")
+	// Old signed releases could be replayed to roll agents back to a
+	// vulnerable build
+	ErrNotNewer = errors.New("release is not newer than the running agent")
+)
+
+// Release is a signed agent binary, offered with ActionOfferUpdate.
+// The binary itself is pushed to the agent as an artifact bundle.
+type Release struct {
+	Version  string    `json:"version"`
+	OS       string    `json:"os"`
+	Arch     string    `json:"arch"`
+	Digest   string    `json:"digest"` // of the binary in the artifact store
+	Size     int64     `json:"size"`
+	IssuedAt time.Time `json:"issued_at"`
+
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Result is the payload of ActionUpdateResult
+type Result struct {
+	Version string `json:"version"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BundleName returns the name of the artifact bundle
+// carrying the release's binary
+func (r Release) BundleName() string {
+	return fmt.Sprintf("%s-%s-%s-%s", BINARY_NAME, r.Version, r.OS, r.Arch)
+}
+
+func (r *Release) payload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// Sign sets the release's IssuedAt and signs it with key
+func (r *Release) Sign(key ed25519.PrivateKey) error {
+	r.IssuedAt = time.Now().UTC()
+	b, err := r.payload()
+	if err != nil {
+		return err
+	}
+	r.Signature = ed25519.Sign(key, b)
+	return nil
+}
+
+// Verify checks the release's signature against key
+// and that it was built for this platform
+func (r *Release) Verify(key ed25519.PublicKey) error {
+	b, err := r.payload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, b, r.Signature) {
+		return ErrInvalidSignature
+	}
+	if r.OS != runtime.GOOS || r.Arch != runtime.GOARCH {
+		return fmt.Errorf("%w: %s/%s", ErrWrongPlatform, r.OS, r.Arch)
+	}
+	return nil
+}
+
+// parseVersion reads v[MAJOR].[MINOR].[PATCH], optionally followed by
+// -prerelease and +build
+func parseVersion(v string) (nums [3]int, pre string, ok bool) {
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "+")
+	v, pre, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return nums, "", false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nums, "", false
+		}
+		nums[i] = n
+	}
+	return nums, pre, true
+}
+
+// newer tells if release is a later version than current. Agents
+// not built from a release, e.g. devel, accept any release.
+func newer(release, current string) (bool, error) {
+	r, rpre, ok := parseVersion(release)
+	if !ok {
+		return false, fmt.Errorf("%w: unparsable version %q", ErrNotNewer, release)
+	}
+	c, cpre, ok := parseVersion(current)
+	if !ok {
+		return true, nil
+	}
+	if n := slices.Compare(r[:], c[:]); n != 0 {
+		return n > 0, nil
+	}
+	// prereleases come before their release, and are compared as strings
+	switch {
+	case rpre == cpre:
+		return false, nil
+	case rpre == "":
+		return true, nil
+	case cpre == "":
+		return false, nil
+	}
+	return rpre > cpre, nil
+}
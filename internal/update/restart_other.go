@@ -0,0 +1,37 @@
+//go:build !unix
+
+package update
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/lattesec/ctfjx/internal/helpers/cleanup"
+)
+
+// replace moves the running dst aside before renaming src over it,
+// as a running binary cannot be overwritten
+func replace(src, dst string) error {
+	old := dst + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(dst, old); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		_ = os.Rename(old, dst)
+		return err
+	}
+	return nil
+}
+
+// restart starts exe and exits
+func restart(exe string) error {
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	cleanup.Exit(0)
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package update
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/lattesec/ctfjx/internal/helpers/cleanup"
+	"github.com/lattesec/log"
+)
+
+// replace renames src over dst, which is atomic on unix
+// even while dst is running
+func replace(src, dst string) error {
+	return os.Rename(src, dst)
+}
+
+// restart runs the cleanups and re-executes exe in place,
+// keeping its pid for the service manager
+func restart(exe string) error {
+	if err := cleanup.RunCleanup(); err != nil {
+		log.Warn().
+			WithMeta("scope", "update").
+			Msgf("cleanup failed before restart: %v", err).Send()
+	}
+	log.Sync()
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
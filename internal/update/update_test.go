@@ -0,0 +1,108 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/socket/sockettest"
+	"github.com/lattesec/ctfjx/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffer(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	daemonStore, err := artifacts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	agentStore, err := artifacts.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	pusher := artifacts.NewPusher(daemonStore)
+	publisher := NewPublisher(priv, daemonStore, pusher)
+	daemonHandlers := pusher.Handlers()
+	maps.Copy(daemonHandlers, publisher.Handlers())
+
+	exe := filepath.Join(t.TempDir(), BINARY_NAME)
+	require.NoError(t, os.WriteFile(exe, []byte("old"), 0o755))
+	restarted := make(chan struct{}, 1)
+	updater := NewUpdater(pub, agentStore)
+	updater.Executable = exe
+	updater.Restart = func() error {
+		restarted <- struct{}{}
+		return nil
+	}
+	agentHandlers := artifacts.NewReceiver(agentStore).Handlers()
+	maps.Copy(agentHandlers, updater.Handlers())
+
+	daemon, _ := sockettest.Pair(t, daemonHandlers, agentHandlers)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rel, err := publisher.Release("v9.9.9", runtime.GOOS, runtime.GOARCH, strings.NewReader("new"))
+	require.NoError(t, err)
+	require.NoError(t, publisher.Offer(ctx, daemon, rel))
+
+	select {
+	case <-restarted:
+	case <-ctx.Done():
+		t.Fatal("agent did not restart")
+	}
+	b, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(b))
+
+	forged := rel
+	forged.Version = "v9.9.10"
+	assert.ErrorIs(t, publisher.Offer(ctx, daemon, forged), ErrUpdateFailed)
+	assert.ErrorIs(t, updater.Install(forged), ErrInvalidSignature)
+
+	other, err := publisher.Release("v9.9.11", "plan9", runtime.GOARCH, strings.NewReader("new"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, updater.Install(other), ErrWrongPlatform)
+
+	// Old signed releases are not installed again
+	version.Version = "v1.2.0"
+	defer func() { version.Version = "devel" }()
+	older, err := publisher.Release("v1.1.9", runtime.GOOS, runtime.GOARCH, strings.NewReader("vulnerable"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, updater.Install(older), ErrNotNewer)
+	assert.ErrorIs(t, publisher.Offer(ctx, daemon, older), ErrUpdateFailed)
+	b, err = os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(b))
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		release, current string
+		want             bool
+	}{
+		{"v1.2.1", "v1.2.0", true},
+		{"v1.10.0", "v1.9.9", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.1.9", "v1.2.0", false},
+		{"v1.2.0", "v1.2.0-rc.1", true},
+		{"v1.2.0-rc.1", "v1.2.0", false},
+		{"v1.2.0-rc.2", "v1.2.0-rc.1", true},
+		{"1.2.0+abc", "v1.1.0", true},
+		{"v0.0.1", "devel", true},
+	}
+	for _, tt := range tests {
+		got, err := newer(tt.release, tt.current)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%s over %s", tt.release, tt.current)
+	}
+	_, err := newer("latest", "v1.0.0")
+	assert.ErrorIs(t, err, ErrNotNewer)
+}
@@ -0,0 +1,150 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lattesec/ctfjx/internal/artifacts"
+	"github.com/lattesec/ctfjx/internal/socket"
+	"github.com/lattesec/ctfjx/version"
+	"github.com/lattesec/log"
+)
+
+// Updater installs the releases offered to an agent.
+// The binary must already be in store, see Publisher.Offer.
+type Updater struct {
+	key   ed25519.PublicKey
+	store *artifacts.Store
+
+	Executable string       // the binary to replace, defaults to os.Executable
+	Restart    func() error // called after a release is installed, defaults to re-executing the binary
+}
+
+func NewUpdater(key ed25519.PublicKey, store *artifacts.Store) *Updater {
+	return &Updater{key: key, store: store}
+}
+
+func (u *Updater) executable() (string, error) {
+	if u.Executable != "" {
+		return u.Executable, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// Install verifies rel and atomically replaces the agent binary with
+// it, if it is newer than the running agent
+func (u *Updater) Install(rel Release) error {
+	if err := rel.Verify(u.key); err != nil {
+		return err
+	}
+	current := version.Get().Version
+	if ok, err := newer(rel.Version, current); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%w: %s, running %s", ErrNotNewer, rel.Version, current)
+	}
+	exe, err := u.executable()
+	if err != nil {
+		return err
+	}
+
+	src, err := u.store.Open(rel.Digest)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+"-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, src)
+	if err == nil && n != rel.Size {
+		err = fmt.Errorf("%w: got %d bytes, want %d", artifacts.ErrDigestMismatch, n, rel.Size)
+	}
+	if err == nil {
+		err = tmp.Chmod(0o755)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return replace(tmp.Name(), exe)
+}
+
+// Handlers serves ActionOfferUpdate
+func (u *Updater) Handlers() map[socket.Action]socket.HandlerFunc {
+	return map[socket.Action]socket.HandlerFunc{
+		socket.ActionOfferUpdate: func(c *socket.Conn, h socket.Header, r io.Reader) {
+			var rel Release
+			if err := json.NewDecoder(r).Decode(&rel); err != nil {
+				c.GenLogMsg().Error().Msgf("invalid update offer: %v", err).Send()
+				return
+			}
+			u.handleOffer(c, rel)
+		},
+	}
+}
+
+func (u *Updater) handleOffer(c *socket.Conn, rel Release) {
+	current := version.Get().Version
+	if rel.Version == current {
+		_ = c.SendJSON(socket.ActionUpdateResult, Result{Version: rel.Version})
+		return
+	}
+
+	err := u.Install(rel)
+	res := Result{Version: rel.Version}
+	if err != nil {
+		res.Error = err.Error()
+		log.Error().
+			WithMeta("scope", "update").
+			WithMeta("version", rel.Version).
+			Msgf("failed to install update: %v", err).Send()
+	} else {
+		log.Info().
+			WithMeta("scope", "update").
+			Msgf("updated from %s to %s, restarting", current, rel.Version).Send()
+	}
+
+	if err := c.SendJSON(socket.ActionUpdateResult, res); err != nil {
+		c.GenLogMsg().Error().Msgf("failed to send update result: %v", err).Send()
+	}
+	if res.Error != "" {
+		return
+	}
+
+	// Restarting drains this conn, which waits for this handler
+	restartFn := u.Restart
+	if restartFn == nil {
+		restartFn = func() error {
+			exe, err := u.executable()
+			if err != nil {
+				return err
+			}
+			return restart(exe)
+		}
+	}
+	go func() {
+		if err := restartFn(); err != nil {
+			log.Error().
+				WithMeta("scope", "update").
+				Msgf("failed to restart: %v", err).Send()
+		}
+	}()
+}
@@ -0,0 +1,26 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	Commit = "0123456789abcdef"
+	defer func() { Commit = "" }()
+
+	info := Get()
+	assert.Equal(t, "devel", info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, "devel (0123456789ab, "+runtime.Version()+", "+info.Platform+")", info.String())
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/version", nil))
+	var got Info
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, info, got)
+}